@@ -0,0 +1,187 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/mailer"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+func main() {
+	var (
+		command = flag.String("command", "", "Command: import, export")
+		file    = flag.String("file", "-", "File to import from or export to, - for stdin or stdout")
+		format  = flag.String("format", "", "File format: csv or json (default: from the file extension, else csv)")
+		mode    = flag.String("mode", "password", "How imported users get in: password (print temporary passwords) or invitation (email invitations)")
+		dryRun  = flag.Bool("dry-run", false, "Check every row of an import without importing anything")
+		verbose = flag.Bool("verbose", false, "Verbose output")
+	)
+	flag.Parse()
+
+	// Set up logging. Logs go to stderr, so that exports can go to stdout.
+	logLevel := slog.LevelWarn
+	if *verbose {
+		logLevel = slog.LevelDebug
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+		Level: logLevel,
+	}))
+	slog.SetDefault(logger)
+
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	listFormat := services.UserListFormat(*format)
+	if listFormat == "" {
+		listFormat = services.UserListCSV
+		if strings.EqualFold(filepath.Ext(*file), ".json") {
+			listFormat = services.UserListJSON
+		}
+	}
+	if !listFormat.IsValid() {
+		slog.Error("Unknown format", "format", *format)
+		os.Exit(1)
+	}
+
+	// Initialize database connection
+	db, err := database.NewDBClient(&database.Config{
+		Type:     cfg.DB.Type,
+		Host:     cfg.DB.Host,
+		Port:     cfg.DB.Port,
+		User:     cfg.DB.User,
+		Password: cfg.DB.Password,
+		Database: cfg.DB.Database,
+		SSLMode:  cfg.DB.SSLMode,
+	})
+	if err != nil {
+		slog.Error("Failed to connect to database", "error", err)
+		os.Exit(1)
+	}
+	defer func() { _ = db.Close() }()
+
+	userService := services.NewUserService(db)
+	importService := services.NewUserImportService(db, userService, services.NewInvitationService(db))
+	m, err := mailer.FromConfig(cfg.Mail)
+	if err != nil {
+		slog.Error("Failed to set up mail", "error", err)
+		os.Exit(1)
+	}
+	emailService := services.NewEmailService(db, m)
+	importService.SetEmail(emailService)
+	if cfg.Auth.LocalAuth.RequireEmailVerification {
+		userService.SetEmailVerification(emailService)
+	}
+
+	// Execute command
+	ctx := services.WithPublicURL(context.Background(), cfg.Server.BaseURL)
+	switch *command {
+	case "import":
+		err = importUsers(ctx, importService, *file, listFormat, services.ImportMode(*mode), *dryRun)
+
+	case "export":
+		err = exportUsers(ctx, importService, *file, listFormat)
+
+	default:
+		slog.Error("Unknown command", "command", *command)
+		fmt.Println("Available commands: import, export")
+		os.Exit(1)
+	}
+
+	if err != nil {
+		if errors.Is(err, services.ErrNoPublicURL) {
+			err = fmt.Errorf("%w: set server.base_url so invitation links work", err)
+		}
+		slog.Error("Command failed", "command", *command, "error", err)
+		os.Exit(1)
+	}
+}
+
+// importUsers imports the users in the file and prints what happened to
+// each, failing if any row was invalid or could not be imported
+func importUsers(ctx context.Context, importService *services.UserImportService, file string, format services.UserListFormat, mode services.ImportMode, dryRun bool) error {
+	in := io.Reader(os.Stdin)
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		in = f
+	}
+
+	records, err := services.ReadUserRecords(in, format)
+	if err != nil {
+		return err
+	}
+	// The command line can give any role and add users to any group
+	report, err := importService.Import(ctx, nil, records, mode, dryRun)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "ROW\tUSERNAME\tEMAIL\tROLE\tGROUPS\tSTATUS\tDETAILS")
+	for _, row := range report.Rows {
+		details := row.TemporaryPassword
+		if row.Error != "" {
+			details = strings.TrimSpace(details + " " + row.Error)
+		}
+		for _, e := range row.Errors {
+			details += e.Field + " " + e.Message + "; "
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", row.Row, row.Username, row.Email, row.Role,
+			strings.Join(row.Groups, ";"), row.Status, strings.TrimSuffix(details, "; "))
+	}
+	_ = w.Flush()
+
+	switch {
+	case report.Invalid > 0:
+		return fmt.Errorf("%d of %d rows are invalid, nothing was imported", report.Invalid, len(report.Rows))
+	case report.Failed > 0:
+		return fmt.Errorf("%d of %d rows could not be imported", report.Failed, len(report.Rows))
+	case dryRun:
+		fmt.Printf("\nDry run: all %d rows are valid, nothing was imported\n", len(report.Rows))
+	default:
+		fmt.Printf("\nImported %d users\n", report.Imported)
+	}
+	return nil
+}
+
+// exportUsers writes every user to the file
+func exportUsers(ctx context.Context, importService *services.UserImportService, file string, format services.UserListFormat) error {
+	records, err := importService.ExportUsers(ctx)
+	if err != nil {
+		return err
+	}
+
+	out := io.Writer(os.Stdout)
+	if file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = f.Close() }()
+		out = f
+	}
+	if err := services.WriteUserRecords(out, format, records); err != nil {
+		return err
+	}
+	slog.Info("Exported users", "count", len(records))
+	return nil
+}
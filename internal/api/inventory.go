@@ -0,0 +1,155 @@
+package api
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+// InventoryHandler serves spools, filaments and materials from whichever
+// inventory backend is configured
+type InventoryHandler struct {
+	service services.InventoryProvider
+}
+
+func NewInventoryHandler(service services.InventoryProvider) *InventoryHandler {
+	return &InventoryHandler{
+		service: service,
+	}
+}
+
+// GetSpools returns all available spools from the inventory
+func (h *InventoryHandler) GetSpools(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("handling get spools request")
+
+	spools, err := h.service.GetSpools(r.Context())
+	if err != nil {
+		slog.Error("failed to get spools", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Debug("successfully retrieved spools", "count", len(spools))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(spools); err != nil {
+		slog.Error("failed to encode spools response", "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetSpool returns a specific spool by ID
+func (h *InventoryHandler) GetSpool(w http.ResponseWriter, r *http.Request) {
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		slog.Warn("get spool request missing id parameter")
+		http.Error(w, "spool ID is required", http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		slog.Warn("invalid spool ID", "id", idStr, "error", err)
+		http.Error(w, "invalid spool ID", http.StatusBadRequest)
+		return
+	}
+
+	slog.Debug("handling get spool request", "id", id)
+	spool, err := h.service.GetSpool(r.Context(), id)
+	if err != nil {
+		slog.Error("failed to get spool", "id", id, "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Debug("successfully retrieved spool", "id", id)
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(spool); err != nil {
+		slog.Error("failed to encode spool response", "id", id, "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetMaterials returns all unique materials from the inventory
+func (h *InventoryHandler) GetMaterials(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("handling get materials request")
+
+	materials, err := h.service.GetMaterials(r.Context())
+	if err != nil {
+		slog.Error("failed to get materials", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Debug("successfully retrieved materials", "count", len(materials))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(materials); err != nil {
+		slog.Error("failed to encode materials response", "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetVendors returns all filament vendors from the inventory
+func (h *InventoryHandler) GetVendors(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("handling get vendors request")
+
+	vendors, err := h.service.GetVendors(r.Context())
+	if err != nil {
+		slog.Error("failed to get vendors", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Debug("successfully retrieved vendors", "count", len(vendors))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(vendors); err != nil {
+		slog.Error("failed to encode vendors response", "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetFilaments returns the filament catalogue from the inventory
+func (h *InventoryHandler) GetFilaments(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("handling get filaments request")
+
+	filaments, err := h.service.GetFilaments(r.Context())
+	if err != nil {
+		slog.Error("failed to get filaments", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Debug("successfully retrieved filaments", "count", len(filaments))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(filaments); err != nil {
+		slog.Error("failed to encode filaments response", "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetLocations returns all spool storage locations from the inventory
+func (h *InventoryHandler) GetLocations(w http.ResponseWriter, r *http.Request) {
+	slog.Debug("handling get locations request")
+
+	locations, err := h.service.GetLocations(r.Context())
+	if err != nil {
+		slog.Error("failed to get locations", "error", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	slog.Debug("successfully retrieved locations", "count", len(locations))
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(locations); err != nil {
+		slog.Error("failed to encode locations response", "error", err)
+		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
+		return
+	}
+}
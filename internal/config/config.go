@@ -5,7 +5,10 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log/slog"
+	"net/netip"
+	"net/url"
 	"os"
+	"regexp"
 	"strings"
 	"time"
 
@@ -19,7 +22,11 @@ type Config struct {
 	DB       DBConfig
 	Log      LogConfig
 	Spoolman SpoolmanConfig
+	Pricing  PricingConfig
+	Billing  BillingConfig
+	Quotas   QuotaConfig
 	Auth     AuthConfig
+	Mail     MailConfig
 }
 
 // ServerConfig holds server-related configuration
@@ -27,6 +34,9 @@ type ServerConfig struct {
 	Host  string
 	Port  string
 	HTTPS *bool // Optional explicit HTTPS setting
+	// BaseURL is the public URL of the server, which emailed links point at.
+	// OIDC callbacks are derived from each request when it is empty.
+	BaseURL string
 }
 
 // DBConfig holds database-related configuration
@@ -47,23 +57,126 @@ type LogConfig struct {
 
 // SpoolmanConfig holds Spoolman-related configuration
 type SpoolmanConfig struct {
-	Enabled  bool
-	Endpoint string
+	Enabled     bool
+	Endpoint    string
+	Realtime    bool // Subscribe to Spoolman's websocket change feed
+	ExtraFields bool // Record printers and print requests in spool extra fields
+}
+
+// PricingConfig holds the rates used to price print requests
+type PricingConfig struct {
+	Enabled           bool
+	Currency          string
+	MachineHourRate   float64 // Charged per hour of print time
+	HandlingFee       float64 // Flat fee added to every request
+	DefaultPricePerKg float64 // Filament price used when the spool and filament have no price
+}
+
+// BillingConfig holds configuration for charging users for their prints
+type BillingConfig struct {
+	Enabled             bool
+	HoldNegativeBalance bool // Keep requests pending approval while their owner owes money
+}
+
+// QuotaConfig holds the default limits on what each user may request. A
+// limit of zero means unlimited. Admins can override the limits per user or
+// role.
+type QuotaConfig struct {
+	Enabled         bool
+	MaxOpenRequests int     // Requests that are not done yet
+	MonthlyGrams    float64 // Filament per calendar month
+	MonthlyHours    float64 // Print time per calendar month
 }
 
 // AuthConfig holds authentication-related configuration
 type AuthConfig struct {
-	Enabled        bool            `json:"enabled"`
-	SessionSecret  string          `json:"session_secret"`
-	SessionTimeout time.Duration   `json:"session_timeout"`
-	LocalAuth      LocalAuthConfig `json:"local_auth"`
-	OIDC           OIDCConfig      `json:"oidc"`
+	Enabled        bool                `json:"enabled"`
+	SessionSecret  string              `json:"session_secret"`
+	SessionTimeout time.Duration       `json:"session_timeout"`
+	LocalAuth      LocalAuthConfig     `json:"local_auth"`
+	OIDC           OIDCConfig          `json:"oidc"`
+	LDAP           LDAPConfig          `json:"ldap"`
+	TrustedHeader  TrustedHeaderConfig `json:"trusted_header"`
+	WebAuthn       WebAuthnConfig      `json:"webauthn"`
 }
 
 // LocalAuthConfig holds local authentication configuration
 type LocalAuthConfig struct {
 	Enabled           bool `json:"enabled"`
 	AllowRegistration bool `json:"allow_registration"`
+	// RequireEmailVerification makes users who register give an email
+	// address, and follow a link sent to it before they can log in
+	RequireEmailVerification bool          `json:"require_email_verification"`
+	TOTP                     TOTPConfig    `json:"totp"`
+	Lockout                  LockoutConfig `json:"lockout"`
+}
+
+// LockoutConfig holds limits on failed password logins to each username,
+// on top of the per-IP rate limit
+type LockoutConfig struct {
+	Enabled bool `json:"enabled"`
+	// MaxAttempts is how many failed logins in a row lock the username
+	MaxAttempts int `json:"max_attempts"`
+	// Duration is how long usernames stay locked, and how long failed
+	// logins are remembered for
+	Duration time.Duration `json:"duration"`
+	// MaxDelay caps the wait before answering a failed login, which doubles
+	// with each failure
+	MaxDelay time.Duration `json:"max_delay"`
+}
+
+// TOTPConfig holds configuration for two-factor authentication of local
+// accounts with an authenticator app
+type TOTPConfig struct {
+	Issuer string `json:"issuer"` // Shown in authenticator apps
+	// RequiredRoles are the roles whose local accounts must set up two-factor
+	// authentication before they can use the application
+	RequiredRoles []string `json:"required_roles"`
+}
+
+// WebAuthnConfig holds configuration for logging in with security keys and
+// passkeys
+type WebAuthnConfig struct {
+	Enabled bool `json:"enabled"`
+	// RPID is the domain passkeys are registered for, derived from
+	// server.base_url when empty. Passkeys stop working if it changes.
+	RPID   string `json:"rp_id"`
+	RPName string `json:"rp_name"` // Shown by authenticators
+	// Origins are the origins logins may come from, derived from
+	// server.base_url when empty
+	Origins []string `json:"origins"`
+}
+
+// MailConfig holds configuration for sending email, e.g. password reset links
+type MailConfig struct {
+	Backend string         `json:"backend"`  // "smtp", "file" or "log"
+	From    string         `json:"from"`     // e.g. "print-dis <print@example.com>"
+	FileDir string         `json:"file_dir"` // Where the file backend writes messages
+	SMTP    SMTPMailConfig `json:"smtp"`
+}
+
+// SMTPMailConfig holds the SMTP server email is sent through
+type SMTPMailConfig struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	TLS      string `json:"tls"` // "starttls", "tls" or "none"
+}
+
+// TrustedHeaderConfig holds configuration for trusting the user named in a
+// header set by an authenticating reverse proxy, such as Authelia,
+// oauth2-proxy or Tailscale serve
+type TrustedHeaderConfig struct {
+	Enabled      bool   `json:"enabled"`
+	UserHeader   string `json:"user_header"`
+	EmailHeader  string `json:"email_header"`
+	NameHeader   string `json:"name_header"`
+	GroupsHeader string `json:"groups_header"` // Comma-separated group names
+	// TrustedProxies are the addresses the headers are accepted from. They
+	// are ignored on requests from anywhere else.
+	TrustedProxies []netip.Prefix      `json:"trusted_proxies"`
+	RoleMap        []RoleMappingConfig `json:"role_mapping"`
 }
 
 // OIDCConfig holds OIDC authentication configuration
@@ -73,13 +186,89 @@ type OIDCConfig struct {
 
 // OIDCProviderConfig holds configuration for a single OIDC provider
 type OIDCProviderConfig struct {
-	Name         string `json:"name"`
-	IssuerURL    string `json:"issuer_url"`
-	ClientID     string `json:"client_id"`
-	ClientSecret string `json:"client_secret"`
-	Enabled      bool   `json:"enabled"`
+	Name         string   `json:"name"`         // Used in URLs, e.g. /api/auth/oidc/{name}/login
+	DisplayName  string   `json:"display_name"` // Shown on the login page
+	IssuerURL    string   `json:"issuer_url"`
+	ClientID     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	Enabled      bool     `json:"enabled"`
+	Scopes       []string `json:"scopes"`
+	// TrustEmail treats the provider's email addresses as verified even when
+	// it does not send email_verified, e.g. for a self-hosted provider
+	TrustEmail bool                `json:"trust_email"`
+	Claims     OIDCClaimsConfig    `json:"claims"`
+	RoleMap    []RoleMappingConfig `json:"role_mapping"`
 }
 
+// OIDCClaimsConfig names the ID token claims that user details are read from.
+// Nested claims are named with dots, e.g. "realm_access.roles".
+type OIDCClaimsConfig struct {
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
+	Groups      string `json:"groups"`
+}
+
+// LDAPConfig holds LDAP authentication configuration. Logins with a username
+// and password that do not match a local account are checked against each
+// provider in turn.
+type LDAPConfig struct {
+	Providers []LDAPProviderConfig `json:"providers"`
+}
+
+// LDAPProviderConfig holds configuration for a single LDAP directory, such as
+// OpenLDAP or Active Directory
+type LDAPProviderConfig struct {
+	Name    string `json:"name"` // Identifies the directory users are linked to
+	Enabled bool   `json:"enabled"`
+	URL     string `json:"url"` // ldap:// or ldaps://
+	// StartTLS upgrades ldap:// connections to TLS before binding
+	StartTLS           bool          `json:"start_tls"`
+	CAFile             string        `json:"ca_file"` // PEM certificates to trust instead of the system's
+	InsecureSkipVerify bool          `json:"insecure_skip_verify"`
+	Timeout            time.Duration `json:"timeout"`
+	// BindDN and BindPassword are the service account users are searched
+	// for with, or empty to search anonymously
+	BindDN       string `json:"bind_dn"`
+	BindPassword string `json:"bind_password"`
+	UserBaseDN   string `json:"user_base_dn"`
+	// UserFilter finds the user logging in, with {username} replaced by
+	// their escaped username, e.g. "(&(objectClass=person)(uid={username}))"
+	UserFilter string `json:"user_filter"`
+	// GroupBaseDN and GroupFilter search for the user's groups, with {dn}
+	// and {username} replaced, e.g. "(member={dn})", in addition to those
+	// in the groups attribute
+	GroupBaseDN string               `json:"group_base_dn"`
+	GroupFilter string               `json:"group_filter"`
+	Attributes  LDAPAttributesConfig `json:"attributes"`
+	// RoleMap grants roles by group, named by either their DN or cn
+	RoleMap []RoleMappingConfig `json:"role_mapping"`
+}
+
+// LDAPAttributesConfig names the attributes user details are read from
+type LDAPAttributesConfig struct {
+	// ID identifies users for linking them to accounts, e.g. entryUUID. It
+	// defaults to the username attribute.
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	Email       string `json:"email"`
+	DisplayName string `json:"display_name"`
+	Groups      string `json:"groups"` // DNs of the user's groups, e.g. memberOf
+}
+
+// RoleMappingConfig grants a role to members of a group at an identity
+// provider or authenticating proxy. When role mappings are configured, users'
+// roles are set from their groups at every login, using the first mapping that
+// matches, or the user role if none do.
+type RoleMappingConfig struct {
+	Group string `json:"group"`
+	Role  string `json:"role"`
+}
+
+// oidcProviderNameRegex matches valid OIDC provider names, which appear in
+// callback URLs
+var oidcProviderNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
 // Load loads configuration from multiple sources in the following order:
 // 1. Default values
 // 2. Config file (if specified)
@@ -114,6 +303,31 @@ func Load() (*Config, error) {
 	// Set up command-line flags
 	setupFlags(v)
 
+	oidcProviders, err := parseOIDCProviders(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OIDC providers: %w", err)
+	}
+
+	ldapProviders, err := parseLDAPProviders(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP providers: %w", err)
+	}
+
+	trustedHeader, err := parseTrustedHeader(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted header auth: %w", err)
+	}
+
+	mail, err := parseMail(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mail configuration: %w", err)
+	}
+
+	lockout, err := parseLockout(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lockout configuration: %w", err)
+	}
+
 	// Parse session timeout
 	sessionTimeout, err := time.ParseDuration(v.GetString("auth.session_timeout"))
 	if err != nil {
@@ -129,8 +343,9 @@ func Load() (*Config, error) {
 	// Create config struct
 	config := &Config{
 		Server: ServerConfig{
-			Host: v.GetString("server.host"),
-			Port: v.GetString("server.port"),
+			Host:    v.GetString("server.host"),
+			Port:    v.GetString("server.port"),
+			BaseURL: strings.TrimSuffix(v.GetString("server.base_url"), "/"),
 		},
 		DB: DBConfig{
 			Type:     v.GetString("db.type"),
@@ -145,36 +360,153 @@ func Load() (*Config, error) {
 			Level: v.GetString("log.level"),
 		},
 		Spoolman: SpoolmanConfig{
-			Enabled:  v.GetBool("spoolman.enabled"),
-			Endpoint: v.GetString("spoolman.endpoint"),
+			Enabled:     v.GetBool("spoolman.enabled"),
+			Endpoint:    v.GetString("spoolman.endpoint"),
+			Realtime:    v.GetBool("spoolman.realtime"),
+			ExtraFields: v.GetBool("spoolman.extra_fields"),
+		},
+		Pricing: PricingConfig{
+			Enabled:           v.GetBool("pricing.enabled"),
+			Currency:          v.GetString("pricing.currency"),
+			MachineHourRate:   v.GetFloat64("pricing.machine_hour_rate"),
+			HandlingFee:       v.GetFloat64("pricing.handling_fee"),
+			DefaultPricePerKg: v.GetFloat64("pricing.default_price_per_kg"),
+		},
+		Billing: BillingConfig{
+			Enabled:             v.GetBool("billing.enabled"),
+			HoldNegativeBalance: v.GetBool("billing.hold_negative_balance"),
+		},
+		Quotas: QuotaConfig{
+			Enabled:         v.GetBool("quotas.enabled"),
+			MaxOpenRequests: v.GetInt("quotas.max_open_requests"),
+			MonthlyGrams:    v.GetFloat64("quotas.monthly_grams"),
+			MonthlyHours:    v.GetFloat64("quotas.monthly_hours"),
 		},
 		Auth: AuthConfig{
 			Enabled:        v.GetBool("auth.enabled"),
 			SessionSecret:  sessionSecret,
 			SessionTimeout: sessionTimeout,
 			LocalAuth: LocalAuthConfig{
-				Enabled:           v.GetBool("auth.local_auth.enabled"),
-				AllowRegistration: v.GetBool("auth.local_auth.allow_registration"),
+				Enabled:                  v.GetBool("auth.local_auth.enabled"),
+				AllowRegistration:        v.GetBool("auth.local_auth.allow_registration"),
+				RequireEmailVerification: v.GetBool("auth.local_auth.require_email_verification"),
+				TOTP: TOTPConfig{
+					Issuer:        v.GetString("auth.local_auth.totp.issuer"),
+					RequiredRoles: v.GetStringSlice("auth.local_auth.totp.required_roles"),
+				},
+				Lockout: lockout,
 			},
 			OIDC: OIDCConfig{
-				Providers: parseOIDCProviders(v),
+				Providers: oidcProviders,
+			},
+			LDAP: LDAPConfig{
+				Providers: ldapProviders,
+			},
+			TrustedHeader: trustedHeader,
+			WebAuthn: WebAuthnConfig{
+				Enabled: v.GetBool("auth.webauthn.enabled"),
+				RPID:    v.GetString("auth.webauthn.rp_id"),
+				RPName:  v.GetString("auth.webauthn.rp_name"),
+				Origins: v.GetStringSlice("auth.webauthn.origins"),
 			},
 		},
+		Mail: mail,
+	}
+
+	if err := checkMailLinks(config); err != nil {
+		return nil, fmt.Errorf("invalid mail configuration: %w", err)
+	}
+
+	if err := resolveWebAuthn(&config.Auth.WebAuthn, config.Server.BaseURL); err != nil {
+		return nil, fmt.Errorf("invalid WebAuthn configuration: %w", err)
 	}
 
 	return config, nil
 }
 
-// parseOIDCProviders parses OIDC provider configurations from viper
-func parseOIDCProviders(v *viper.Viper) []OIDCProviderConfig {
-	// For now, we'll support a simple configuration structure
-	// This can be extended later to support dynamic provider lists from config
+// checkMailLinks checks that emails which link back to the server can do so.
+// Links only ever point at server.base_url, never at the host a request
+// claims to be for, so email can't be sent without it.
+func checkMailLinks(cfg *Config) error {
+	if cfg.Server.BaseURL != "" || !cfg.Auth.LocalAuth.Enabled {
+		return nil
+	}
+	if cfg.Mail.Backend != "log" {
+		return fmt.Errorf("server.base_url is required to email links with the %s backend", cfg.Mail.Backend)
+	}
+	if cfg.Auth.LocalAuth.RequireEmailVerification {
+		return fmt.Errorf("server.base_url is required to email verification links")
+	}
+	return nil
+}
+
+// resolveWebAuthn derives the WebAuthn RP ID and origins that are not
+// configured from server.base_url. They are never derived from the host a
+// request claims to be for, so passkeys can't be used while either is still
+// empty.
+func resolveWebAuthn(cfg *WebAuthnConfig, baseURL string) error {
+	if !cfg.Enabled || baseURL == "" {
+		return nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Scheme == "" || u.Hostname() == "" {
+		return fmt.Errorf("server.base_url %q is not an absolute URL", baseURL)
+	}
+	if cfg.RPID == "" {
+		cfg.RPID = u.Hostname()
+	}
+	if len(cfg.Origins) == 0 {
+		cfg.Origins = []string{u.Scheme + "://" + u.Host}
+	}
+	return nil
+}
+
+// parseOIDCProviders parses the auth.oidc.providers list, plus the google and
+// microsoft providers that could be configured before the list existed
+func parseOIDCProviders(v *viper.Viper) ([]OIDCProviderConfig, error) {
+	var entries []struct {
+		Name         string   `mapstructure:"name"`
+		DisplayName  string   `mapstructure:"display_name"`
+		IssuerURL    string   `mapstructure:"issuer_url"`
+		ClientID     string   `mapstructure:"client_id"`
+		ClientSecret string   `mapstructure:"client_secret"`
+		Enabled      *bool    `mapstructure:"enabled"`
+		Scopes       []string `mapstructure:"scopes"`
+		TrustEmail   bool     `mapstructure:"trust_email"`
+		Claims       struct {
+			Username    string `mapstructure:"username"`
+			Email       string `mapstructure:"email"`
+			DisplayName string `mapstructure:"display_name"`
+			Groups      string `mapstructure:"groups"`
+		} `mapstructure:"claims"`
+		RoleMap []RoleMappingConfig `mapstructure:"role_mapping"`
+	}
+	if err := v.UnmarshalKey("auth.oidc.providers", &entries); err != nil {
+		return nil, err
+	}
+
 	var providers []OIDCProviderConfig
+	for _, entry := range entries {
+		providers = append(providers, OIDCProviderConfig{
+			Name:         entry.Name,
+			DisplayName:  entry.DisplayName,
+			IssuerURL:    entry.IssuerURL,
+			ClientID:     entry.ClientID,
+			ClientSecret: entry.ClientSecret,
+			// Listed providers are enabled unless they say otherwise
+			Enabled:    entry.Enabled == nil || *entry.Enabled,
+			Scopes:     entry.Scopes,
+			TrustEmail: entry.TrustEmail,
+			Claims:     OIDCClaimsConfig(entry.Claims),
+			RoleMap:    entry.RoleMap,
+		})
+	}
 
 	// Check if there's a Google provider configured
 	if v.GetString("auth.oidc.google.client_id") != "" {
 		providers = append(providers, OIDCProviderConfig{
 			Name:         "google",
+			DisplayName:  "Google",
 			IssuerURL:    "https://accounts.google.com",
 			ClientID:     v.GetString("auth.oidc.google.client_id"),
 			ClientSecret: v.GetString("auth.oidc.google.client_secret"),
@@ -186,6 +518,7 @@ func parseOIDCProviders(v *viper.Viper) []OIDCProviderConfig {
 	if v.GetString("auth.oidc.microsoft.client_id") != "" {
 		providers = append(providers, OIDCProviderConfig{
 			Name:         "microsoft",
+			DisplayName:  "Microsoft",
 			IssuerURL:    "https://login.microsoftonline.com/common/v2.0",
 			ClientID:     v.GetString("auth.oidc.microsoft.client_id"),
 			ClientSecret: v.GetString("auth.oidc.microsoft.client_secret"),
@@ -193,7 +526,246 @@ func parseOIDCProviders(v *viper.Viper) []OIDCProviderConfig {
 		})
 	}
 
-	return providers
+	seen := make(map[string]bool, len(providers))
+	for i := range providers {
+		provider := &providers[i]
+		if !oidcProviderNameRegex.MatchString(provider.Name) {
+			return nil, fmt.Errorf("provider name %q must be lowercase letters, digits and dashes", provider.Name)
+		}
+		if seen[provider.Name] {
+			return nil, fmt.Errorf("provider %q is configured more than once", provider.Name)
+		}
+		seen[provider.Name] = true
+
+		if provider.Enabled && (provider.IssuerURL == "" || provider.ClientID == "") {
+			return nil, fmt.Errorf("provider %q needs an issuer_url and client_id", provider.Name)
+		}
+		if provider.DisplayName == "" {
+			provider.DisplayName = provider.Name
+		}
+		for _, mapping := range provider.RoleMap {
+			if mapping.Group == "" || mapping.Role == "" {
+				return nil, fmt.Errorf("provider %q has a role mapping without a group or role", provider.Name)
+			}
+		}
+	}
+
+	return providers, nil
+}
+
+// parseLDAPProviders parses the auth.ldap.providers list, filling in the
+// defaults for OpenLDAP
+func parseLDAPProviders(v *viper.Viper) ([]LDAPProviderConfig, error) {
+	var entries []struct {
+		Name               string `mapstructure:"name"`
+		Enabled            *bool  `mapstructure:"enabled"`
+		URL                string `mapstructure:"url"`
+		StartTLS           bool   `mapstructure:"start_tls"`
+		CAFile             string `mapstructure:"ca_file"`
+		InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+		Timeout            string `mapstructure:"timeout"`
+		BindDN             string `mapstructure:"bind_dn"`
+		BindPassword       string `mapstructure:"bind_password"`
+		UserBaseDN         string `mapstructure:"user_base_dn"`
+		UserFilter         string `mapstructure:"user_filter"`
+		GroupBaseDN        string `mapstructure:"group_base_dn"`
+		GroupFilter        string `mapstructure:"group_filter"`
+		Attributes         struct {
+			ID          string `mapstructure:"id"`
+			Username    string `mapstructure:"username"`
+			Email       string `mapstructure:"email"`
+			DisplayName string `mapstructure:"display_name"`
+			Groups      string `mapstructure:"groups"`
+		} `mapstructure:"attributes"`
+		RoleMap []RoleMappingConfig `mapstructure:"role_mapping"`
+	}
+	if err := v.UnmarshalKey("auth.ldap.providers", &entries); err != nil {
+		return nil, err
+	}
+
+	var providers []LDAPProviderConfig
+	seen := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		provider := LDAPProviderConfig{
+			Name: entry.Name,
+			// Listed providers are enabled unless they say otherwise
+			Enabled:            entry.Enabled == nil || *entry.Enabled,
+			URL:                entry.URL,
+			StartTLS:           entry.StartTLS,
+			CAFile:             entry.CAFile,
+			InsecureSkipVerify: entry.InsecureSkipVerify,
+			Timeout:            10 * time.Second,
+			BindDN:             entry.BindDN,
+			BindPassword:       entry.BindPassword,
+			UserBaseDN:         entry.UserBaseDN,
+			UserFilter:         entry.UserFilter,
+			GroupBaseDN:        entry.GroupBaseDN,
+			GroupFilter:        entry.GroupFilter,
+			Attributes:         LDAPAttributesConfig(entry.Attributes),
+			RoleMap:            entry.RoleMap,
+		}
+
+		if !oidcProviderNameRegex.MatchString(provider.Name) {
+			return nil, fmt.Errorf("provider name %q must be lowercase letters, digits and dashes", provider.Name)
+		}
+		if seen[provider.Name] {
+			return nil, fmt.Errorf("provider %q is configured more than once", provider.Name)
+		}
+		seen[provider.Name] = true
+
+		if entry.Timeout != "" {
+			timeout, err := time.ParseDuration(entry.Timeout)
+			if err != nil || timeout <= 0 {
+				return nil, fmt.Errorf("provider %q has an invalid timeout %q", provider.Name, entry.Timeout)
+			}
+			provider.Timeout = timeout
+		}
+		if provider.UserFilter == "" {
+			provider.UserFilter = "(uid={username})"
+		}
+		if provider.Attributes.Username == "" {
+			provider.Attributes.Username = "uid"
+		}
+		if provider.Attributes.Email == "" {
+			provider.Attributes.Email = "mail"
+		}
+		if provider.Attributes.DisplayName == "" {
+			provider.Attributes.DisplayName = "cn"
+		}
+		if provider.Attributes.Groups == "" {
+			provider.Attributes.Groups = "memberOf"
+		}
+
+		if provider.Enabled && (provider.URL == "" || provider.UserBaseDN == "") {
+			return nil, fmt.Errorf("provider %q needs a url and user_base_dn", provider.Name)
+		}
+		if !strings.Contains(provider.UserFilter, "{username}") {
+			return nil, fmt.Errorf("provider %q user_filter must contain {username}", provider.Name)
+		}
+		if (provider.GroupBaseDN == "") != (provider.GroupFilter == "") {
+			return nil, fmt.Errorf("provider %q needs both group_base_dn and group_filter to search for groups", provider.Name)
+		}
+		for _, mapping := range provider.RoleMap {
+			if mapping.Group == "" || mapping.Role == "" {
+				return nil, fmt.Errorf("provider %q has a role mapping without a group or role", provider.Name)
+			}
+		}
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
+
+// parseTrustedHeader parses the trusted header auth configuration
+func parseTrustedHeader(v *viper.Viper) (TrustedHeaderConfig, error) {
+	cfg := TrustedHeaderConfig{
+		Enabled:      v.GetBool("auth.trusted_header.enabled"),
+		UserHeader:   v.GetString("auth.trusted_header.user_header"),
+		EmailHeader:  v.GetString("auth.trusted_header.email_header"),
+		NameHeader:   v.GetString("auth.trusted_header.name_header"),
+		GroupsHeader: v.GetString("auth.trusted_header.groups_header"),
+	}
+	if err := v.UnmarshalKey("auth.trusted_header.role_mapping", &cfg.RoleMap); err != nil {
+		return cfg, err
+	}
+	for _, mapping := range cfg.RoleMap {
+		if mapping.Group == "" || mapping.Role == "" {
+			return cfg, fmt.Errorf("role mapping without a group or role")
+		}
+	}
+
+	for _, proxy := range v.GetStringSlice("auth.trusted_header.trusted_proxies") {
+		// Accept single addresses as well as CIDRs
+		prefix, err := netip.ParsePrefix(proxy)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(proxy)
+			if addrErr != nil {
+				return cfg, fmt.Errorf("invalid trusted proxy %q: %w", proxy, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		cfg.TrustedProxies = append(cfg.TrustedProxies, prefix.Masked())
+	}
+
+	if cfg.Enabled && cfg.UserHeader == "" {
+		return cfg, fmt.Errorf("user_header is required")
+	}
+	if cfg.Enabled && len(cfg.TrustedProxies) == 0 {
+		// Trusting the header from anywhere would let anyone log in as anyone
+		return cfg, fmt.Errorf("trusted_proxies is required")
+	}
+
+	return cfg, nil
+}
+
+// parseMail parses the mail configuration
+func parseMail(v *viper.Viper) (MailConfig, error) {
+	cfg := MailConfig{
+		Backend: v.GetString("mail.backend"),
+		From:    v.GetString("mail.from"),
+		FileDir: v.GetString("mail.file_dir"),
+		SMTP: SMTPMailConfig{
+			Host:     v.GetString("mail.smtp.host"),
+			Port:     v.GetInt("mail.smtp.port"),
+			Username: v.GetString("mail.smtp.username"),
+			Password: v.GetString("mail.smtp.password"),
+			TLS:      v.GetString("mail.smtp.tls"),
+		},
+	}
+
+	switch cfg.Backend {
+	case "smtp":
+		if cfg.SMTP.Host == "" {
+			return cfg, fmt.Errorf("smtp.host is required")
+		}
+		switch cfg.SMTP.TLS {
+		case "starttls", "tls", "none":
+		default:
+			return cfg, fmt.Errorf("smtp.tls must be starttls, tls or none, not %q", cfg.SMTP.TLS)
+		}
+	case "file":
+		if cfg.FileDir == "" {
+			return cfg, fmt.Errorf("file_dir is required")
+		}
+	case "log":
+	default:
+		return cfg, fmt.Errorf("backend must be smtp, file or log, not %q", cfg.Backend)
+	}
+	if cfg.From == "" {
+		return cfg, fmt.Errorf("from is required")
+	}
+
+	return cfg, nil
+}
+
+// parseLockout parses the failed login lockout configuration
+func parseLockout(v *viper.Viper) (LockoutConfig, error) {
+	cfg := LockoutConfig{
+		Enabled:     v.GetBool("auth.local_auth.lockout.enabled"),
+		MaxAttempts: v.GetInt("auth.local_auth.lockout.max_attempts"),
+	}
+	if !cfg.Enabled {
+		return cfg, nil
+	}
+
+	var err error
+	if cfg.Duration, err = time.ParseDuration(v.GetString("auth.local_auth.lockout.duration")); err != nil {
+		return cfg, fmt.Errorf("invalid duration: %w", err)
+	}
+	if cfg.MaxDelay, err = time.ParseDuration(v.GetString("auth.local_auth.lockout.max_delay")); err != nil {
+		return cfg, fmt.Errorf("invalid max_delay: %w", err)
+	}
+	if cfg.MaxAttempts < 1 {
+		return cfg, fmt.Errorf("max_attempts must be at least 1")
+	}
+	if cfg.Duration <= 0 {
+		return cfg, fmt.Errorf("duration must be positive")
+	}
+	if cfg.MaxDelay < 0 {
+		return cfg, fmt.Errorf("max_delay must not be negative")
+	}
+
+	return cfg, nil
 }
 
 // setDefaults sets default values for configuration
@@ -216,6 +788,25 @@ func setDefaults(v *viper.Viper) {
 	// Spoolman defaults
 	v.SetDefault("spoolman.enabled", false)
 	v.SetDefault("spoolman.endpoint", "http://localhost:8000")
+	v.SetDefault("spoolman.realtime", true)
+	v.SetDefault("spoolman.extra_fields", true)
+
+	// Pricing defaults
+	v.SetDefault("pricing.enabled", false)
+	v.SetDefault("pricing.currency", "USD")
+	v.SetDefault("pricing.machine_hour_rate", 0.0)
+	v.SetDefault("pricing.handling_fee", 0.0)
+	v.SetDefault("pricing.default_price_per_kg", 20.0)
+
+	// Billing defaults
+	v.SetDefault("billing.enabled", false)
+	v.SetDefault("billing.hold_negative_balance", false)
+
+	// Quota defaults
+	v.SetDefault("quotas.enabled", false)
+	v.SetDefault("quotas.max_open_requests", 0)
+	v.SetDefault("quotas.monthly_grams", 0.0)
+	v.SetDefault("quotas.monthly_hours", 0.0)
 
 	// Auth defaults
 	v.SetDefault("auth.enabled", true)
@@ -223,18 +814,48 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("auth.session_timeout", "24h")
 	v.SetDefault("auth.local_auth.enabled", true)
 	v.SetDefault("auth.local_auth.allow_registration", false)
+	v.SetDefault("auth.local_auth.require_email_verification", false)
+	v.SetDefault("auth.local_auth.totp.issuer", "print-dis")
+	v.SetDefault("auth.local_auth.totp.required_roles", []string{})
+	v.SetDefault("auth.local_auth.lockout.enabled", true)
+	v.SetDefault("auth.local_auth.lockout.max_attempts", 10)
+	v.SetDefault("auth.local_auth.lockout.duration", "15m")
+	v.SetDefault("auth.local_auth.lockout.max_delay", "8s")
+	v.SetDefault("auth.webauthn.enabled", true)
+	v.SetDefault("auth.webauthn.rp_id", "")
+	v.SetDefault("auth.webauthn.rp_name", "print-dis")
+	v.SetDefault("auth.webauthn.origins", []string{})
+	v.SetDefault("auth.trusted_header.enabled", false)
+	v.SetDefault("auth.trusted_header.user_header", "Remote-User")
+	v.SetDefault("auth.trusted_header.email_header", "Remote-Email")
+	v.SetDefault("auth.trusted_header.name_header", "Remote-Name")
+	v.SetDefault("auth.trusted_header.groups_header", "Remote-Groups")
 	v.SetDefault("auth.oidc.google.enabled", false)
 	v.SetDefault("auth.oidc.microsoft.enabled", false)
+
+	// Mail defaults
+	v.SetDefault("mail.backend", "log")
+	v.SetDefault("mail.from", "print-dis <print-dis@localhost>")
+	v.SetDefault("mail.file_dir", "mail")
+	v.SetDefault("mail.smtp.host", "")
+	v.SetDefault("mail.smtp.port", 587)
+	v.SetDefault("mail.smtp.username", "")
+	v.SetDefault("mail.smtp.password", "")
+	v.SetDefault("mail.smtp.tls", "starttls")
 }
 
 // setupFlags sets up command-line flags
 func setupFlags(v *viper.Viper) {
 	// Create a new flag set
 	flags := pflag.NewFlagSet("print-dis", pflag.ExitOnError)
+	// Leave flags of the command line tools, such as migrate's -command, to
+	// them
+	flags.ParseErrorsWhitelist.UnknownFlags = true
 
 	// Server flags
 	flags.String("host", v.GetString("server.host"), "Host to bind the server to")
 	flags.String("port", v.GetString("server.port"), "Port to bind the server to")
+	flags.String("base-url", v.GetString("server.base_url"), "Public URL of the server, e.g. https://print.example.com")
 
 	// Database flags
 	flags.String("db-type", v.GetString("db.type"), "Database type (sqlite or postgres)")
@@ -251,6 +872,25 @@ func setupFlags(v *viper.Viper) {
 	// Spoolman flags
 	flags.Bool("spoolman-enabled", v.GetBool("spoolman.enabled"), "Enable Spoolman integration")
 	flags.String("spoolman-endpoint", v.GetString("spoolman.endpoint"), "Spoolman API endpoint")
+	flags.Bool("spoolman-realtime", v.GetBool("spoolman.realtime"), "Subscribe to Spoolman's websocket change feed")
+	flags.Bool("spoolman-extra-fields", v.GetBool("spoolman.extra_fields"), "Record printers and print requests in Spoolman spool extra fields")
+
+	// Pricing flags
+	flags.Bool("pricing-enabled", v.GetBool("pricing.enabled"), "Estimate and record the cost of print requests")
+	flags.String("pricing-currency", v.GetString("pricing.currency"), "Currency code shown with prices")
+	flags.Float64("pricing-machine-hour-rate", v.GetFloat64("pricing.machine_hour_rate"), "Price per hour of print time")
+	flags.Float64("pricing-handling-fee", v.GetFloat64("pricing.handling_fee"), "Flat fee added to every print request")
+	flags.Float64("pricing-default-price-per-kg", v.GetFloat64("pricing.default_price_per_kg"), "Filament price per kg when the spool has no price")
+
+	// Billing flags
+	flags.Bool("billing-enabled", v.GetBool("billing.enabled"), "Charge users for completed print requests")
+	flags.Bool("billing-hold-negative-balance", v.GetBool("billing.hold_negative_balance"), "Hold requests pending approval while their owner owes money")
+
+	// Quota flags
+	flags.Bool("quotas-enabled", v.GetBool("quotas.enabled"), "Limit what each user may request")
+	flags.Int("quotas-max-open-requests", v.GetInt("quotas.max_open_requests"), "Maximum requests per user that are not done yet (0 for unlimited)")
+	flags.Float64("quotas-monthly-grams", v.GetFloat64("quotas.monthly_grams"), "Filament per user per month in grams (0 for unlimited)")
+	flags.Float64("quotas-monthly-hours", v.GetFloat64("quotas.monthly_hours"), "Print time per user per month in hours (0 for unlimited)")
 
 	// Auth flags
 	flags.Bool("auth-enabled", v.GetBool("auth.enabled"), "Enable authentication")
@@ -265,6 +905,7 @@ func setupFlags(v *viper.Viper) {
 	// Bind flags to viper
 	_ = v.BindPFlag("server.host", flags.Lookup("host"))
 	_ = v.BindPFlag("server.port", flags.Lookup("port"))
+	_ = v.BindPFlag("server.base_url", flags.Lookup("base-url"))
 	_ = v.BindPFlag("db.type", flags.Lookup("db-type"))
 	_ = v.BindPFlag("db.host", flags.Lookup("db-host"))
 	_ = v.BindPFlag("db.port", flags.Lookup("db-port"))
@@ -275,6 +916,19 @@ func setupFlags(v *viper.Viper) {
 	_ = v.BindPFlag("log.level", flags.Lookup("log-level"))
 	_ = v.BindPFlag("spoolman.enabled", flags.Lookup("spoolman-enabled"))
 	_ = v.BindPFlag("spoolman.endpoint", flags.Lookup("spoolman-endpoint"))
+	_ = v.BindPFlag("spoolman.realtime", flags.Lookup("spoolman-realtime"))
+	_ = v.BindPFlag("spoolman.extra_fields", flags.Lookup("spoolman-extra-fields"))
+	_ = v.BindPFlag("pricing.enabled", flags.Lookup("pricing-enabled"))
+	_ = v.BindPFlag("pricing.currency", flags.Lookup("pricing-currency"))
+	_ = v.BindPFlag("pricing.machine_hour_rate", flags.Lookup("pricing-machine-hour-rate"))
+	_ = v.BindPFlag("pricing.handling_fee", flags.Lookup("pricing-handling-fee"))
+	_ = v.BindPFlag("pricing.default_price_per_kg", flags.Lookup("pricing-default-price-per-kg"))
+	_ = v.BindPFlag("billing.enabled", flags.Lookup("billing-enabled"))
+	_ = v.BindPFlag("billing.hold_negative_balance", flags.Lookup("billing-hold-negative-balance"))
+	_ = v.BindPFlag("quotas.enabled", flags.Lookup("quotas-enabled"))
+	_ = v.BindPFlag("quotas.max_open_requests", flags.Lookup("quotas-max-open-requests"))
+	_ = v.BindPFlag("quotas.monthly_grams", flags.Lookup("quotas-monthly-grams"))
+	_ = v.BindPFlag("quotas.monthly_hours", flags.Lookup("quotas-monthly-hours"))
 	_ = v.BindPFlag("auth.enabled", flags.Lookup("auth-enabled"))
 	_ = v.BindPFlag("auth.session_secret", flags.Lookup("auth-session-secret"))
 	_ = v.BindPFlag("auth.session_timeout", flags.Lookup("auth-session-timeout"))
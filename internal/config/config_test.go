@@ -0,0 +1,423 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func readConfig(t *testing.T, yaml string) *viper.Viper {
+	t.Helper()
+
+	v := viper.New()
+	v.SetConfigType("yaml")
+	if err := v.ReadConfig(strings.NewReader(yaml)); err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	return v
+}
+
+func TestParseOIDCProviders(t *testing.T) {
+	v := readConfig(t, `
+auth:
+  oidc:
+    providers:
+      - name: authentik
+        display_name: Authentik
+        issuer_url: https://auth.example.com/application/o/print-dis/
+        client_id: print-dis
+        client_secret: secret
+        scopes: [openid, email, profile, groups]
+        claims:
+          groups: realm_access.roles
+        role_mapping:
+          - group: print-admins
+            role: admin
+      - name: keycloak
+        issuer_url: https://keycloak.example.com/realms/lab
+        client_id: print-dis
+        enabled: false
+    google:
+      client_id: google-client
+      enabled: true
+`)
+
+	providers, err := parseOIDCProviders(v)
+	if err != nil {
+		t.Fatalf("Failed to parse providers: %v", err)
+	}
+	if len(providers) != 3 {
+		t.Fatalf("Expected 3 providers, got %+v", providers)
+	}
+
+	authentik := providers[0]
+	if authentik.Name != "authentik" || authentik.DisplayName != "Authentik" || !authentik.Enabled {
+		t.Errorf("Unexpected authentik provider %+v", authentik)
+	}
+	if authentik.IssuerURL != "https://auth.example.com/application/o/print-dis/" || authentik.ClientSecret != "secret" {
+		t.Errorf("Unexpected authentik provider %+v", authentik)
+	}
+	if len(authentik.Scopes) != 4 || authentik.Claims.Groups != "realm_access.roles" {
+		t.Errorf("Expected scopes and claim mappings, got %+v", authentik)
+	}
+	if len(authentik.RoleMap) != 1 || authentik.RoleMap[0] != (RoleMappingConfig{Group: "print-admins", Role: "admin"}) {
+		t.Errorf("Expected role mapping, got %+v", authentik.RoleMap)
+	}
+
+	if keycloak := providers[1]; keycloak.Enabled || keycloak.DisplayName != "keycloak" {
+		t.Errorf("Expected disabled keycloak provider named after itself, got %+v", keycloak)
+	}
+	if google := providers[2]; google.Name != "google" || google.IssuerURL != "https://accounts.google.com" || !google.Enabled {
+		t.Errorf("Expected legacy google provider, got %+v", google)
+	}
+}
+
+func TestParseOIDCProvidersRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{"invalid name", `
+auth:
+  oidc:
+    providers:
+      - name: "My SSO"
+        issuer_url: https://sso.example.com
+        client_id: print-dis
+`},
+		{"duplicate name", `
+auth:
+  oidc:
+    providers:
+      - name: google
+        issuer_url: https://accounts.google.com
+        client_id: a
+    google:
+      client_id: b
+`},
+		{"missing issuer", `
+auth:
+  oidc:
+    providers:
+      - name: sso
+        client_id: print-dis
+`},
+		{"incomplete role mapping", `
+auth:
+  oidc:
+    providers:
+      - name: sso
+        issuer_url: https://sso.example.com
+        client_id: print-dis
+        role_mapping:
+          - group: admins
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseOIDCProviders(readConfig(t, tt.yaml)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestParseLDAPProviders(t *testing.T) {
+	v := readConfig(t, `
+auth:
+  ldap:
+    providers:
+      - name: campus
+        url: ldaps://ldap.example.edu
+        bind_dn: cn=print-dis,ou=services,dc=example,dc=edu
+        bind_password: secret
+        user_base_dn: ou=people,dc=example,dc=edu
+        timeout: 3s
+        role_mapping:
+          - group: cn=print-admins,ou=groups,dc=example,dc=edu
+            role: admin
+      - name: ad
+        url: ldap://dc.example.edu
+        start_tls: true
+        user_base_dn: dc=example,dc=edu
+        user_filter: "(sAMAccountName={username})"
+        group_base_dn: dc=example,dc=edu
+        group_filter: "(member={dn})"
+        attributes:
+          id: objectGUID
+          username: sAMAccountName
+          display_name: displayName
+        enabled: false
+`)
+
+	providers, err := parseLDAPProviders(v)
+	if err != nil {
+		t.Fatalf("Failed to parse providers: %v", err)
+	}
+	if len(providers) != 2 {
+		t.Fatalf("Expected 2 providers, got %+v", providers)
+	}
+
+	campus := providers[0]
+	if !campus.Enabled || campus.URL != "ldaps://ldap.example.edu" || campus.BindPassword != "secret" || campus.Timeout != 3*time.Second {
+		t.Errorf("Unexpected campus provider %+v", campus)
+	}
+	want := LDAPAttributesConfig{Username: "uid", Email: "mail", DisplayName: "cn", Groups: "memberOf"}
+	if campus.UserFilter != "(uid={username})" || campus.Attributes != want {
+		t.Errorf("Expected OpenLDAP defaults, got %+v", campus)
+	}
+	if len(campus.RoleMap) != 1 || campus.RoleMap[0].Role != "admin" {
+		t.Errorf("Expected role mapping, got %+v", campus.RoleMap)
+	}
+
+	ad := providers[1]
+	if ad.Enabled || !ad.StartTLS || ad.Timeout != 10*time.Second || ad.GroupFilter != "(member={dn})" {
+		t.Errorf("Unexpected ad provider %+v", ad)
+	}
+	if ad.Attributes.ID != "objectGUID" || ad.Attributes.Username != "sAMAccountName" || ad.Attributes.Email != "mail" {
+		t.Errorf("Expected attribute mappings, got %+v", ad.Attributes)
+	}
+}
+
+func TestParseLDAPProvidersRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{"missing url", `
+auth:
+  ldap:
+    providers:
+      - name: campus
+        user_base_dn: dc=example,dc=edu
+`},
+		{"filter without username", `
+auth:
+  ldap:
+    providers:
+      - name: campus
+        url: ldap://ldap.example.edu
+        user_base_dn: dc=example,dc=edu
+        user_filter: "(uid=alice)"
+`},
+		{"group filter without base", `
+auth:
+  ldap:
+    providers:
+      - name: campus
+        url: ldap://ldap.example.edu
+        user_base_dn: dc=example,dc=edu
+        group_filter: "(member={dn})"
+`},
+		{"invalid timeout", `
+auth:
+  ldap:
+    providers:
+      - name: campus
+        url: ldap://ldap.example.edu
+        user_base_dn: dc=example,dc=edu
+        timeout: soon
+`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parseLDAPProviders(readConfig(t, tt.yaml)); err == nil {
+				t.Error("Expected an error")
+			}
+		})
+	}
+}
+
+func TestParseTrustedHeader(t *testing.T) {
+	v := readConfig(t, `
+auth:
+  trusted_header:
+    enabled: true
+    user_header: X-Forwarded-User
+    trusted_proxies: ["10.0.0.0/8", "192.168.1.10", "fd00::1/64"]
+    role_mapping:
+      - group: print-admins
+        role: admin
+`)
+
+	cfg, err := parseTrustedHeader(v)
+	if err != nil {
+		t.Fatalf("Failed to parse trusted header config: %v", err)
+	}
+	if !cfg.Enabled || cfg.UserHeader != "X-Forwarded-User" {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+
+	expected := []string{"10.0.0.0/8", "192.168.1.10/32", "fd00::/64"}
+	if len(cfg.TrustedProxies) != len(expected) {
+		t.Fatalf("Expected %v, got %v", expected, cfg.TrustedProxies)
+	}
+	for i, prefix := range cfg.TrustedProxies {
+		if prefix.String() != expected[i] {
+			t.Errorf("Expected %s, got %s", expected[i], prefix)
+		}
+	}
+	if len(cfg.RoleMap) != 1 || cfg.RoleMap[0] != (RoleMappingConfig{Group: "print-admins", Role: "admin"}) {
+		t.Errorf("Expected role mapping, got %+v", cfg.RoleMap)
+	}
+
+	for _, yaml := range []string{
+		"auth:\n  trusted_header:\n    enabled: true\n    user_header: Remote-User\n",
+		"auth:\n  trusted_header:\n    enabled: true\n    user_header: Remote-User\n    trusted_proxies: [not-an-address]\n",
+	} {
+		if _, err := parseTrustedHeader(readConfig(t, yaml)); err == nil {
+			t.Errorf("Expected an error for %q", yaml)
+		}
+	}
+}
+
+func TestParseMail(t *testing.T) {
+	v := readConfig(t, `
+mail:
+  backend: smtp
+  from: "Print Queue <print@example.com>"
+  smtp:
+    host: smtp.example.com
+    username: print
+`)
+	setDefaults(v)
+
+	cfg, err := parseMail(v)
+	if err != nil {
+		t.Fatalf("Failed to parse mail config: %v", err)
+	}
+	expected := SMTPMailConfig{Host: "smtp.example.com", Port: 587, Username: "print", TLS: "starttls"}
+	if cfg.Backend != "smtp" || cfg.From != "Print Queue <print@example.com>" || cfg.SMTP != expected {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+
+	// Mail is logged unless configured otherwise
+	v = readConfig(t, "")
+	setDefaults(v)
+	if cfg, err := parseMail(v); err != nil || cfg.Backend != "log" {
+		t.Errorf("Expected the log backend by default, got %+v, %v", cfg, err)
+	}
+
+	for _, yaml := range []string{
+		"mail:\n  backend: pigeon\n",
+		"mail:\n  backend: smtp\n",
+		"mail:\n  backend: smtp\n  smtp:\n    host: smtp.example.com\n    tls: ssl\n",
+		"mail:\n  backend: file\n  file_dir: \"\"\n",
+		"mail:\n  from: \"\"\n",
+	} {
+		v := readConfig(t, yaml)
+		setDefaults(v)
+		if _, err := parseMail(v); err == nil {
+			t.Errorf("Expected an error for %q", yaml)
+		}
+	}
+}
+
+func TestCheckMailLinks(t *testing.T) {
+	tests := []struct {
+		name    string
+		baseURL string
+		backend string
+		verify  bool
+		wantErr bool
+	}{
+		{name: "logged mail without base URL", backend: "log"},
+		{name: "sent mail with base URL", baseURL: "https://print.example.com", backend: "smtp"},
+		{name: "sent mail without base URL", backend: "smtp", wantErr: true},
+		{name: "written mail without base URL", backend: "file", wantErr: true},
+		{name: "verification without base URL", backend: "log", verify: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &Config{
+				Server: ServerConfig{BaseURL: tt.baseURL},
+				Auth:   AuthConfig{LocalAuth: LocalAuthConfig{Enabled: true, RequireEmailVerification: tt.verify}},
+				Mail:   MailConfig{Backend: tt.backend},
+			}
+			if err := checkMailLinks(cfg); (err != nil) != tt.wantErr {
+				t.Errorf("checkMailLinks() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResolveWebAuthn(t *testing.T) {
+	tests := []struct {
+		name        string
+		baseURL     string
+		cfg         WebAuthnConfig
+		wantRPID    string
+		wantOrigins []string
+		wantErr     bool
+	}{
+		{name: "no base URL", cfg: WebAuthnConfig{Enabled: true}},
+		{
+			name:        "derived from base URL",
+			baseURL:     "https://print.example.com:8443/app",
+			cfg:         WebAuthnConfig{Enabled: true},
+			wantRPID:    "print.example.com",
+			wantOrigins: []string{"https://print.example.com:8443"},
+		},
+		{
+			name:        "configured values win",
+			baseURL:     "https://print.example.com",
+			cfg:         WebAuthnConfig{Enabled: true, RPID: "example.com", Origins: []string{"https://example.com"}},
+			wantRPID:    "example.com",
+			wantOrigins: []string{"https://example.com"},
+		},
+		{name: "relative base URL", baseURL: "print.example.com", cfg: WebAuthnConfig{Enabled: true}, wantErr: true},
+		{name: "disabled", baseURL: "https://print.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := tt.cfg
+			err := resolveWebAuthn(&cfg, tt.baseURL)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveWebAuthn() error = %v, want error %v", err, tt.wantErr)
+			}
+			if cfg.RPID != tt.wantRPID || !reflect.DeepEqual(cfg.Origins, tt.wantOrigins) {
+				t.Errorf("Expected RP ID %q and origins %v, got %q and %v", tt.wantRPID, tt.wantOrigins, cfg.RPID, cfg.Origins)
+			}
+		})
+	}
+}
+
+func TestParseLockout(t *testing.T) {
+	v := readConfig(t, "")
+	setDefaults(v)
+	cfg, err := parseLockout(v)
+	if err != nil {
+		t.Fatalf("Failed to parse lockout config: %v", err)
+	}
+	expected := LockoutConfig{Enabled: true, MaxAttempts: 10, Duration: 15 * time.Minute, MaxDelay: 8 * time.Second}
+	if cfg != expected {
+		t.Errorf("Expected lockout to be on by default, got %+v", cfg)
+	}
+
+	for _, yaml := range []string{
+		"auth:\n  local_auth:\n    lockout:\n      max_attempts: 0\n",
+		"auth:\n  local_auth:\n    lockout:\n      duration: forever\n",
+		"auth:\n  local_auth:\n    lockout:\n      duration: 0s\n",
+		"auth:\n  local_auth:\n    lockout:\n      max_delay: -1s\n",
+	} {
+		v := readConfig(t, yaml)
+		setDefaults(v)
+		if _, err := parseLockout(v); err == nil {
+			t.Errorf("Expected an error for %q", yaml)
+		}
+	}
+
+	// Limits are not checked when lockout is off
+	v = readConfig(t, "auth:\n  local_auth:\n    lockout:\n      enabled: false\n      max_attempts: 0\n")
+	setDefaults(v)
+	if cfg, err := parseLockout(v); err != nil || cfg.Enabled {
+		t.Errorf("Expected lockout to be off, got %+v, %v", cfg, err)
+	}
+}
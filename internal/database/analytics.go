@@ -0,0 +1,258 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/models"
+)
+
+// analyticsSQL holds the SQL for timestamps that differs between databases.
+// Analytics compare timestamps as seconds since the Unix epoch, since SQLite
+// stores them as text that only sorts correctly in a single time zone.
+type analyticsSQL struct {
+	// seconds converts a timestamp column to seconds since the Unix epoch
+	seconds func(column string) string
+	// bucket converts a timestamp column to the start of its bucket, as
+	// YYYY-MM-DD in UTC
+	bucket func(column string, bucket models.AnalyticsBucket) string
+	// month converts seconds since the Unix epoch to its month, as YYYY-MM in
+	// UTC
+	month func(seconds string) string
+}
+
+var sqliteAnalytics = analyticsSQL{
+	seconds: func(column string) string {
+		return "((julianday(" + column + ") - 2440587.5) * 86400.0)"
+	},
+	bucket: func(column string, bucket models.AnalyticsBucket) string {
+		if bucket == models.AnalyticsBucketWeek {
+			return "date(" + column + ", 'weekday 0', '-6 days')"
+		}
+		return "date(" + column + ")"
+	},
+	month: func(seconds string) string {
+		return "strftime('%Y-%m', " + seconds + ", 'unixepoch')"
+	},
+}
+
+var postgresAnalytics = analyticsSQL{
+	seconds: func(column string) string {
+		return "EXTRACT(EPOCH FROM " + column + ")"
+	},
+	bucket: func(column string, bucket models.AnalyticsBucket) string {
+		if bucket == models.AnalyticsBucketWeek {
+			return "to_char(date_trunc('week', " + column + " AT TIME ZONE 'UTC'), 'YYYY-MM-DD')"
+		}
+		return "to_char(" + column + " AT TIME ZONE 'UTC', 'YYYY-MM-DD')"
+	},
+	month: func(seconds string) string {
+		return "to_char(to_timestamp(" + seconds + ") AT TIME ZONE 'UTC', 'YYYY-MM')"
+	},
+}
+
+// inRange returns a condition that a timestamp column is within the range,
+// and its arguments
+func (a analyticsSQL) inRange(column string, r models.AnalyticsRange) (string, []any) {
+	seconds := a.seconds(column)
+	return seconds + " >= ? AND " + seconds + " < ?", []any{r.From.Unix(), r.To.Unix()}
+}
+
+// completedCTE selects when each print request was first completed, in
+// seconds since the Unix epoch
+func (a analyticsSQL) completedCTE() string {
+	return fmt.Sprintf(`completed AS (
+			SELECT print_request_id, MIN(%s) AS done_at
+			FROM print_request_status_events
+			WHERE to_status = %d
+			GROUP BY print_request_id
+		)`, a.seconds("created_at"), models.StatusDone)
+}
+
+// CreatePrintRequestStatusEvent records a print request changing status
+// within the transaction
+func (t *txWrapper) CreatePrintRequestStatusEvent(ctx context.Context, event *models.PrintRequestStatusEvent) error {
+	query := `INSERT INTO print_request_status_events (print_request_id, from_status, to_status, created_at) VALUES (?, ?, ?, ?)`
+
+	_, err := t.tx.ExecContext(ctx, t.tx.Rebind(query), event.PrintRequestID, event.FromStatus, event.ToStatus, event.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create print request status event: %w", err)
+	}
+	return nil
+}
+
+// countPrintRequestStatuses counts the print requests submitted in each
+// bucket of the range, and those reaching each later status
+func (c *baseClient) countPrintRequestStatuses(ctx context.Context, a analyticsSQL, r models.AnalyticsRange, bucket models.AnalyticsBucket) ([]*models.StatusCount, error) {
+	submitted, submittedArgs := a.inRange("created_at", r)
+	changed, changedArgs := a.inRange("created_at", r)
+	query := fmt.Sprintf(`
+		SELECT bucket, status, COUNT(DISTINCT print_request_id) AS count
+		FROM (
+			SELECT %s AS bucket, %d AS status, id AS print_request_id
+			FROM print_requests
+			WHERE %s
+			UNION ALL
+			SELECT %s AS bucket, to_status AS status, print_request_id
+			FROM print_request_status_events
+			WHERE to_status <> %d AND %s
+		) changes
+		GROUP BY bucket, status
+		ORDER BY bucket, status`,
+		a.bucket("created_at", bucket), models.StatusPendingApproval, submitted,
+		a.bucket("created_at", bucket), models.StatusPendingApproval, changed)
+
+	counts := []*models.StatusCount{}
+	if err := c.db.SelectContext(ctx, &counts, c.db.Rebind(query), append(submittedArgs, changedArgs...)...); err != nil {
+		return nil, fmt.Errorf("failed to count print request statuses: %w", err)
+	}
+	return counts, nil
+}
+
+// listTurnarounds lists how long print requests approved or completed in
+// the range took to be approved, and then to be completed
+func (c *baseClient) listTurnarounds(ctx context.Context, a analyticsSQL, r models.AnalyticsRange) ([]*models.Turnaround, error) {
+	query := fmt.Sprintf(`
+		WITH milestones AS (
+			SELECT pr.id,
+				%s AS submitted_at,
+				MIN(CASE WHEN e.to_status = %d THEN %s END) AS approved_at,
+				MIN(CASE WHEN e.to_status = %d THEN %s END) AS done_at
+			FROM print_requests pr
+			JOIN print_request_status_events e ON e.print_request_id = pr.id
+			GROUP BY pr.id, pr.created_at
+		)
+		SELECT
+			CASE WHEN approved_at >= ? AND approved_at < ? THEN approved_at - submitted_at END AS approval_seconds,
+			CASE WHEN done_at >= ? AND done_at < ? AND approved_at <= done_at THEN done_at - approved_at END AS completion_seconds
+		FROM milestones
+		WHERE (approved_at >= ? AND approved_at < ?) OR (done_at >= ? AND done_at < ?)`,
+		a.seconds("pr.created_at"),
+		models.StatusEnqueued, a.seconds("e.created_at"),
+		models.StatusDone, a.seconds("e.created_at"))
+
+	from, to := r.From.Unix(), r.To.Unix()
+	turnarounds := []*models.Turnaround{}
+	if err := c.db.SelectContext(ctx, &turnarounds, c.db.Rebind(query), from, to, from, to, from, to, from, to); err != nil {
+		return nil, fmt.Errorf("failed to list turnarounds: %w", err)
+	}
+	return turnarounds, nil
+}
+
+// sumMaterialUsage sums the filament used by print requests completed in
+// the range, by material and color
+func (c *baseClient) sumMaterialUsage(ctx context.Context, a analyticsSQL, r models.AnalyticsRange) ([]*models.MaterialUsage, error) {
+	query := `
+		WITH ` + a.completedCTE() + `
+		SELECT COALESCE(pr.material, '') AS material, COALESCE(pr.color, '') AS color, COUNT(*) AS requests,
+			COALESCE(SUM(COALESCE(pr.actual_grams, pr.estimated_grams, 0)), 0) AS grams
+		FROM completed c
+		JOIN print_requests pr ON pr.id = c.print_request_id
+		WHERE c.done_at >= ? AND c.done_at < ?
+		GROUP BY COALESCE(pr.material, ''), COALESCE(pr.color, '')
+		ORDER BY grams DESC, material, color`
+
+	usage := []*models.MaterialUsage{}
+	if err := c.db.SelectContext(ctx, &usage, c.db.Rebind(query), r.From.Unix(), r.To.Unix()); err != nil {
+		return nil, fmt.Errorf("failed to sum material usage: %w", err)
+	}
+	return usage, nil
+}
+
+// sumPrinterUsage sums the printing time of print requests completed on
+// each printer in the range
+func (c *baseClient) sumPrinterUsage(ctx context.Context, a analyticsSQL, r models.AnalyticsRange) ([]*models.PrinterUsage, error) {
+	query := `
+		WITH ` + a.completedCTE() + `
+		SELECT p.id AS printer_id, p.name, COUNT(pr.id) AS requests,
+			COALESCE(SUM(COALESCE(pr.actual_hours, pr.estimated_hours, 0)), 0) AS hours
+		FROM printers p
+		LEFT JOIN print_requests pr ON pr.printer_id = p.id
+			AND pr.id IN (SELECT print_request_id FROM completed WHERE done_at >= ? AND done_at < ?)
+		GROUP BY p.id, p.name
+		ORDER BY hours DESC, p.name`
+
+	usage := []*models.PrinterUsage{}
+	if err := c.db.SelectContext(ctx, &usage, c.db.Rebind(query), r.From.Unix(), r.To.Unix()); err != nil {
+		return nil, fmt.Errorf("failed to sum printer usage: %w", err)
+	}
+	return usage, nil
+}
+
+// listTopRequesters lists the users who submitted the most print requests
+// in the range
+func (c *baseClient) listTopRequesters(ctx context.Context, a analyticsSQL, r models.AnalyticsRange, limit int) ([]*models.RequesterUsage, error) {
+	submitted, args := a.inRange("pr.created_at", r)
+	query := fmt.Sprintf(`
+		SELECT pr.user_id, u.username, u.display_name, COUNT(*) AS requests,
+			SUM(CASE WHEN pr.status = %[1]d THEN 1 ELSE 0 END) AS completed,
+			COALESCE(SUM(CASE WHEN pr.status = %[1]d THEN COALESCE(pr.actual_grams, pr.estimated_grams, 0) ELSE 0 END), 0) AS grams
+		FROM print_requests pr
+		JOIN users u ON u.id = pr.user_id
+		WHERE %[2]s
+		GROUP BY pr.user_id, u.username, u.display_name
+		ORDER BY requests DESC, grams DESC, u.username
+		LIMIT ?`, models.StatusDone, submitted)
+
+	requesters := []*models.RequesterUsage{}
+	if err := c.db.SelectContext(ctx, &requesters, c.db.Rebind(query), append(args, limit)...); err != nil {
+		return nil, fmt.Errorf("failed to list top requesters: %w", err)
+	}
+	return requesters, nil
+}
+
+// getUserPrintTotals sums up a user's print requests
+func (c *baseClient) getUserPrintTotals(ctx context.Context, a analyticsSQL, userID string) (*models.UserPrintTotals, error) {
+	query := `
+		WITH ` + a.completedCTE() + fmt.Sprintf(`
+		SELECT
+			COALESCE(SUM(CASE WHEN pr.status = %[1]d THEN 1 ELSE 0 END), 0) AS pending,
+			COALESCE(SUM(CASE WHEN pr.status = %[2]d THEN 1 ELSE 0 END), 0) AS enqueued,
+			COALESCE(SUM(CASE WHEN pr.status = %[3]d THEN 1 ELSE 0 END), 0) AS in_progress,
+			COALESCE(SUM(CASE WHEN pr.status = %[4]d THEN 1 ELSE 0 END), 0) AS done,
+			COALESCE(SUM(CASE WHEN pr.status = %[4]d THEN COALESCE(pr.actual_grams, pr.estimated_grams, 0) ELSE 0 END), 0) AS grams,
+			COALESCE(SUM(CASE WHEN pr.status = %[4]d THEN COALESCE(pr.actual_cost, pr.estimated_cost, 0) ELSE 0 END), 0) AS spend,
+			AVG(CASE WHEN pr.status = %[4]d THEN c.done_at - %[5]s END) AS average_turnaround_seconds
+		FROM print_requests pr
+		LEFT JOIN completed c ON c.print_request_id = pr.id
+		WHERE pr.user_id = ?`,
+		models.StatusPendingApproval, models.StatusEnqueued, models.StatusInProgress, models.StatusDone,
+		a.seconds("pr.created_at"))
+
+	var totals models.UserPrintTotals
+	if err := c.db.GetContext(ctx, &totals, c.db.Rebind(query), userID); err != nil {
+		return nil, fmt.Errorf("failed to get user print totals: %w", err)
+	}
+	return &totals, nil
+}
+
+// listUserMonthlyHistory lists, for each month since the given time, how many
+// print requests a user submitted and completed. Months without any are left
+// out.
+func (c *baseClient) listUserMonthlyHistory(ctx context.Context, a analyticsSQL, userID string, since time.Time) ([]*models.UserMonthStats, error) {
+	query := `
+		WITH ` + a.completedCTE() + fmt.Sprintf(`
+		SELECT month, SUM(submitted) AS submitted, SUM(completed) AS completed, SUM(grams) AS grams, SUM(spend) AS spend
+		FROM (
+			SELECT %[1]s AS month, 1 AS submitted, 0 AS completed, 0.0 AS grams, 0.0 AS spend
+			FROM print_requests
+			WHERE user_id = ? AND %[2]s >= ?
+			UNION ALL
+			SELECT %[3]s AS month, 0 AS submitted, 1 AS completed,
+				COALESCE(pr.actual_grams, pr.estimated_grams, 0) AS grams,
+				COALESCE(pr.actual_cost, pr.estimated_cost, 0) AS spend
+			FROM completed c
+			JOIN print_requests pr ON pr.id = c.print_request_id
+			WHERE pr.user_id = ? AND c.done_at >= ?
+		) history
+		GROUP BY month
+		ORDER BY month`,
+		a.month(a.seconds("created_at")), a.seconds("created_at"), a.month("c.done_at"))
+
+	history := []*models.UserMonthStats{}
+	if err := c.db.SelectContext(ctx, &history, c.db.Rebind(query), userID, since.Unix(), userID, since.Unix()); err != nil {
+		return nil, fmt.Errorf("failed to list user monthly history: %w", err)
+	}
+	return history, nil
+}
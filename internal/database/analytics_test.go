@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/bjschafer/print-dis/internal/models"
+)
+
+// errRecorded is returned for every query the recording driver receives
+var errRecorded = errors.New("query recorded")
+
+// recordedQuery is a query sent to the recording driver and its arguments
+type recordedQuery struct {
+	query string
+	args  int
+}
+
+// recordingConnector opens connections that record queries instead of running
+// them, so that the SQL built for a database can be checked without one
+type recordingConnector struct {
+	queries []recordedQuery
+}
+
+func (c *recordingConnector) Connect(context.Context) (driver.Conn, error) {
+	return &recordingConn{connector: c}, nil
+}
+
+func (c *recordingConnector) Driver() driver.Driver {
+	return recordingDriver{}
+}
+
+type recordingDriver struct{}
+
+func (recordingDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("open with a connector")
+}
+
+type recordingConn struct {
+	connector *recordingConnector
+}
+
+func (c *recordingConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.connector.queries = append(c.connector.queries, recordedQuery{query: query, args: len(args)})
+	return nil, errRecorded
+}
+
+func (c *recordingConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not recorded")
+}
+
+func (c *recordingConn) Close() error {
+	return nil
+}
+
+func (c *recordingConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not recorded")
+}
+
+// sqliteOnlySQL matches functions PostgreSQL does not have
+var sqliteOnlySQL = regexp.MustCompile(`(?i)\b(julianday|strftime|date)\(|'unixepoch'`)
+
+// postgresPlaceholder matches PostgreSQL's numbered placeholders
+var postgresPlaceholder = regexp.MustCompile(`\$(\d+)`)
+
+// TestAnalyticsDialects builds every analytics query for each database, so
+// that the PostgreSQL queries are checked without a PostgreSQL server
+func TestAnalyticsDialects(t *testing.T) {
+	ctx := context.Background()
+	r := models.AnalyticsRange{From: time.Date(2001, time.March, 5, 0, 0, 0, 0, time.UTC), To: time.Date(2001, time.March, 19, 0, 0, 0, 0, time.UTC)}
+
+	for _, dbType := range []string{"sqlite3", "postgres"} {
+		t.Run(dbType, func(t *testing.T) {
+			connector := &recordingConnector{}
+			db := sqlx.NewDb(sql.OpenDB(connector), dbType)
+			t.Cleanup(func() { _ = db.Close() })
+
+			var client DBClient
+			if dbType == "postgres" {
+				client = &postgresClient{baseClient: baseClient{db: db}, logger: slog.Default()}
+			} else {
+				client = &sqliteClient{baseClient: baseClient{db: db}, logger: slog.Default()}
+			}
+
+			queries := map[string]func() error{
+				"daily statuses": func() error {
+					_, err := client.CountPrintRequestStatuses(ctx, r, models.AnalyticsBucketDay)
+					return err
+				},
+				"weekly statuses": func() error {
+					_, err := client.CountPrintRequestStatuses(ctx, r, models.AnalyticsBucketWeek)
+					return err
+				},
+				"turnarounds": func() error {
+					_, err := client.ListTurnarounds(ctx, r)
+					return err
+				},
+				"material usage": func() error {
+					_, err := client.SumMaterialUsage(ctx, r)
+					return err
+				},
+				"printer usage": func() error {
+					_, err := client.SumPrinterUsage(ctx, r)
+					return err
+				},
+				"top requesters": func() error {
+					_, err := client.ListTopRequesters(ctx, r, 10)
+					return err
+				},
+				"user totals": func() error {
+					_, err := client.GetUserPrintTotals(ctx, "user-id")
+					return err
+				},
+				"user history": func() error {
+					_, err := client.ListUserMonthlyHistory(ctx, "user-id", r.From)
+					return err
+				},
+			}
+
+			for name, run := range queries {
+				connector.queries = nil
+				if err := run(); !errors.Is(err, errRecorded) {
+					t.Errorf("%s: expected the query to be recorded, got %v", name, err)
+					continue
+				}
+				if len(connector.queries) != 1 {
+					t.Errorf("%s: expected 1 query, got %d", name, len(connector.queries))
+					continue
+				}
+				if err := checkQuery(dbType, connector.queries[0]); err != nil {
+					t.Errorf("%s: %v\n%s", name, err, connector.queries[0].query)
+				}
+			}
+		})
+	}
+}
+
+// checkQuery checks that a query is written for the database and takes the
+// arguments it was given
+func checkQuery(dbType string, q recordedQuery) error {
+	if depth := strings.Count(q.query, "(") - strings.Count(q.query, ")"); depth != 0 {
+		return fmt.Errorf("unbalanced parentheses")
+	}
+
+	if dbType == "sqlite3" {
+		if placeholders := strings.Count(q.query, "?"); placeholders != q.args {
+			return fmt.Errorf("%d placeholders for %d arguments", placeholders, q.args)
+		}
+		return nil
+	}
+
+	if match := sqliteOnlySQL.FindString(q.query); match != "" {
+		return fmt.Errorf("uses %s, which PostgreSQL does not have", match)
+	}
+	if strings.Contains(q.query, "?") {
+		return fmt.Errorf("has placeholders that were not rebound")
+	}
+	used := map[string]bool{}
+	for _, match := range postgresPlaceholder.FindAllStringSubmatch(q.query, -1) {
+		used[match[1]] = true
+	}
+	for i := 1; i <= q.args; i++ {
+		if !used[fmt.Sprint(i)] {
+			return fmt.Errorf("argument $%d is not used", i)
+		}
+	}
+	if len(used) != q.args {
+		return fmt.Errorf("%d placeholders for %d arguments", len(used), q.args)
+	}
+	return nil
+}
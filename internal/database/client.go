@@ -3,7 +3,10 @@ package database
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/bjschafer/print-dis/internal/models"
 	"github.com/jmoiron/sqlx"
@@ -41,6 +44,13 @@ type DBClient interface {
 	DeleteFilament(ctx context.Context, id int) error
 	ListFilaments(ctx context.Context) ([]*models.Filament, error)
 
+	// Spool operations
+	CreateSpool(ctx context.Context, spool *models.Spool) error
+	GetSpool(ctx context.Context, id int) (*models.Spool, error)
+	UpdateSpool(ctx context.Context, spool *models.Spool) error
+	DeleteSpool(ctx context.Context, id int) error
+	ListSpools(ctx context.Context) ([]*models.Spool, error)
+
 	// Job operations
 	CreateJob(ctx context.Context, job *models.Job) error
 	GetJob(ctx context.Context, id int) (*models.Job, error)
@@ -55,6 +65,116 @@ type DBClient interface {
 	DeletePrintRequest(ctx context.Context, id string) error
 	ListPrintRequests(ctx context.Context) ([]*models.PrintRequest, error)
 	ListPrintRequestsByUserID(ctx context.Context, userID string) ([]*models.PrintRequest, error)
+	ListPrintRequestsBySpoolID(ctx context.Context, spoolID int) ([]*models.PrintRequest, error)
+
+	// Billing operations
+	CreateCharge(ctx context.Context, charge *models.Charge) error
+	GetCharge(ctx context.Context, id int) (*models.Charge, error)
+	GetChargeByPrintRequestID(ctx context.Context, printRequestID string) (*models.Charge, error)
+	UpdateCharge(ctx context.Context, charge *models.Charge) error
+	ListChargesByUserID(ctx context.Context, userID string) ([]*models.Charge, error)
+	CreatePayment(ctx context.Context, payment *models.Payment) error
+	ListPaymentsByUserID(ctx context.Context, userID string) ([]*models.Payment, error)
+	GetBalance(ctx context.Context, userID string) (*models.Balance, error)
+	ListBalances(ctx context.Context) ([]*models.Balance, error)
+
+	// Quota override operations
+	CreateQuotaOverride(ctx context.Context, override *models.QuotaOverride) error
+	GetQuotaOverride(ctx context.Context, scope models.QuotaScope, subject string) (*models.QuotaOverride, error)
+	UpdateQuotaOverride(ctx context.Context, override *models.QuotaOverride) error
+	DeleteQuotaOverride(ctx context.Context, id int) error
+	ListQuotaOverrides(ctx context.Context) ([]*models.QuotaOverride, error)
+
+	// Group operations
+	CreateGroup(ctx context.Context, group *models.Group) error
+	GetGroup(ctx context.Context, id string) (*models.Group, error)
+	UpdateGroup(ctx context.Context, group *models.Group) error
+	DeleteGroup(ctx context.Context, id string) error
+	ListGroups(ctx context.Context) ([]*models.Group, error)
+	SetGroupMembership(ctx context.Context, membership *models.GroupMembership) error
+	DeleteGroupMembership(ctx context.Context, groupID, userID string) error
+	ListGroupMembers(ctx context.Context, groupID string) ([]*models.GroupMembership, error)
+	ListGroupMembershipsByUserID(ctx context.Context, userID string) ([]*models.GroupMembership, error)
+	ListPrintRequestsByGroupID(ctx context.Context, groupID string) ([]*models.PrintRequest, error)
+
+	// Role operations
+	CreateRole(ctx context.Context, role *models.RoleDefinition) error
+	GetRole(ctx context.Context, name models.Role) (*models.RoleDefinition, error)
+	UpdateRole(ctx context.Context, role *models.RoleDefinition) error
+	DeleteRole(ctx context.Context, name models.Role) error
+	ListRoles(ctx context.Context) ([]*models.RoleDefinition, error)
+
+	// OIDC identity operations
+	CreateOIDCIdentity(ctx context.Context, identity *models.UserOIDCIdentity) error
+	GetOIDCIdentity(ctx context.Context, providerName, subject string) (*models.UserOIDCIdentity, error)
+
+	// LDAP identity operations
+	CreateLDAPIdentity(ctx context.Context, identity *models.UserLDAPIdentity) error
+	GetLDAPIdentity(ctx context.Context, providerName, subject string) (*models.UserLDAPIdentity, error)
+
+	// API token operations
+	CreateAPIToken(ctx context.Context, token *models.APIToken) error
+	GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error)
+	ListAPITokensByUserID(ctx context.Context, userID string) ([]*models.APIToken, error)
+	UpdateAPITokenLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error
+	DeleteAPIToken(ctx context.Context, id string) error
+	DeleteAPITokensByUserID(ctx context.Context, userID string) error
+
+	// User session operations
+	CreateUserSession(ctx context.Context, session *models.UserSession) error
+	GetUserSessionByToken(ctx context.Context, tokenHash string) (*models.UserSession, error)
+	UpdateUserSession(ctx context.Context, session *models.UserSession) error
+	TouchUserSession(ctx context.Context, id string, lastSeenAt time.Time, ipAddress string) error
+	ListUserSessionsByUserID(ctx context.Context, userID string, now time.Time) ([]*models.UserSession, error)
+	DeleteUserSession(ctx context.Context, id string) error
+	DeleteUserSessionsByUserID(ctx context.Context, userID, exceptID string) error
+	DeleteExpiredUserSessions(ctx context.Context, now time.Time) (int64, error)
+
+	// Two-factor authentication operations
+	SaveUserTOTP(ctx context.Context, totp *models.UserTOTP) error
+	GetUserTOTP(ctx context.Context, userID string) (*models.UserTOTP, error)
+	UpdateUserTOTPCounter(ctx context.Context, userID string, counter int64) (bool, error)
+	DeleteUserTOTP(ctx context.Context, userID string) error
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codes []*models.RecoveryCode) error
+	UseRecoveryCode(ctx context.Context, userID, codeHash string, usedAt time.Time) (bool, error)
+	CountUnusedRecoveryCodes(ctx context.Context, userID string) (int, error)
+
+	// WebAuthn credential operations
+	CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error
+	GetWebAuthnCredential(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error)
+	ListWebAuthnCredentialsByUserID(ctx context.Context, userID string) ([]*models.WebAuthnCredential, error)
+	UpdateWebAuthnCredentialUsage(ctx context.Context, id string, signCount int64, lastUsedAt time.Time) error
+	DeleteWebAuthnCredential(ctx context.Context, id string) error
+
+	// Email token operations
+	CreateEmailToken(ctx context.Context, token *models.EmailToken) error
+	UseEmailToken(ctx context.Context, purpose models.EmailTokenPurpose, tokenHash string, usedAt time.Time) (*models.EmailToken, error)
+	DeleteEmailTokensByUserID(ctx context.Context, userID string, purpose models.EmailTokenPurpose) error
+
+	// Failed login operations
+	GetLoginAttempts(ctx context.Context, username string) (*models.LoginAttempts, error)
+	RecordLoginFailure(ctx context.Context, username string, failedAt, since time.Time) (*models.LoginAttempts, error)
+	LockLogin(ctx context.Context, username string, until, now time.Time) (bool, error)
+	DeleteLoginAttempts(ctx context.Context, username string) error
+	DeleteStaleLoginAttempts(ctx context.Context, before time.Time) (int64, error)
+
+	// Invitation operations
+	CreateInvitation(ctx context.Context, invitation *models.Invitation) error
+	ListInvitations(ctx context.Context) ([]*models.Invitation, error)
+	RevokeInvitation(ctx context.Context, id string, revokedAt time.Time) (bool, error)
+
+	// Audit log operations
+	CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	ListAuditEvents(ctx context.Context, filter models.AuditEventFilter) ([]*models.AuditEvent, int, error)
+
+	// Print request analytics
+	CountPrintRequestStatuses(ctx context.Context, r models.AnalyticsRange, bucket models.AnalyticsBucket) ([]*models.StatusCount, error)
+	ListTurnarounds(ctx context.Context, r models.AnalyticsRange) ([]*models.Turnaround, error)
+	SumMaterialUsage(ctx context.Context, r models.AnalyticsRange) ([]*models.MaterialUsage, error)
+	SumPrinterUsage(ctx context.Context, r models.AnalyticsRange) ([]*models.PrinterUsage, error)
+	ListTopRequesters(ctx context.Context, r models.AnalyticsRange, limit int) ([]*models.RequesterUsage, error)
+	GetUserPrintTotals(ctx context.Context, userID string) (*models.UserPrintTotals, error)
+	ListUserMonthlyHistory(ctx context.Context, userID string, since time.Time) ([]*models.UserMonthStats, error)
 
 	// Transaction operations
 	BeginTx(ctx context.Context) (Tx, error)
@@ -74,17 +194,217 @@ type Tx interface {
 	GetUserByUsername(ctx context.Context, username string) (*models.User, error)
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	UpdateUser(ctx context.Context, user *models.User) error
+	ReassignUserRecords(ctx context.Context, fromUserID, toUserID string) (int64, error)
+	DeleteUser(ctx context.Context, id string) error
+
+	// OIDC identity operations
+	CreateOIDCIdentity(ctx context.Context, identity *models.UserOIDCIdentity) error
+
+	// LDAP identity operations
+	CreateLDAPIdentity(ctx context.Context, identity *models.UserLDAPIdentity) error
+
+	// Group operations
+	SetGroupMembership(ctx context.Context, membership *models.GroupMembership) error
+
+	// Invitation operations
+	UseInvitation(ctx context.Context, codeHash string, now time.Time) (*models.Invitation, error)
+
+	// LockUser locks a user until the transaction ends, so that checks of
+	// what they have requested are not raced by their other requests, and
+	// returns them. It returns nil if the user does not exist.
+	LockUser(ctx context.Context, id string) (*models.User, error)
 
 	// PrintRequest operations
 	CreatePrintRequest(ctx context.Context, request *models.PrintRequest) error
 	GetPrintRequest(ctx context.Context, id string) (*models.PrintRequest, error)
+	ListPrintRequestsByUserID(ctx context.Context, userID string) ([]*models.PrintRequest, error)
 	UpdatePrintRequest(ctx context.Context, request *models.PrintRequest) error
+	CreatePrintRequestStatusEvent(ctx context.Context, event *models.PrintRequestStatusEvent) error
+
+	// Printer operations
+	GetPrinter(ctx context.Context, id int) (*models.Printer, error)
+
+	// Charge operations
+	CreateCharge(ctx context.Context, charge *models.Charge) error
+	GetChargeByPrintRequestID(ctx context.Context, printRequestID string) (*models.Charge, error)
+	UpdateCharge(ctx context.Context, charge *models.Charge) error
 
 	// Transaction control
 	Commit() error
 	Rollback() error
 }
 
+// materialColumns lists the materials columns scanned into models.Material
+const materialColumns = `id, name, COALESCE(density, 0) as density, COALESCE(diameter, 1.75) as diameter`
+
+// filamentSelect selects filaments joined with their material
+const filamentSelect = `
+		SELECT f.id, f.name, f.vendor, f.color_hex, f.weight, f.price,
+			f.settings_extruder_temp, f.settings_bed_temp,
+			m.id as "material.id", m.name as "material.name",
+			COALESCE(m.density, 0) as "material.density", COALESCE(m.diameter, 1.75) as "material.diameter"
+		FROM filaments f
+		JOIN materials m ON f.material_id = m.id`
+
+// spoolSelect selects spools joined with their filament and material
+const spoolSelect = `
+		SELECT s.id, s.initial_weight, s.remaining_weight, s.location, s.lot_nr, s.comment,
+			s.archived, s.created_at,
+			f.id as "filament.id", f.name as "filament.name", f.vendor as "filament.vendor",
+			f.color_hex as "filament.color_hex", f.weight as "filament.weight", f.price as "filament.price",
+			f.settings_extruder_temp as "filament.settings_extruder_temp",
+			f.settings_bed_temp as "filament.settings_bed_temp",
+			m.id as "filament.material.id", m.name as "filament.material.name",
+			COALESCE(m.density, 0) as "filament.material.density",
+			COALESCE(m.diameter, 1.75) as "filament.material.diameter"
+		FROM spools s
+		JOIN filaments f ON s.filament_id = f.id
+		JOIN materials m ON f.material_id = m.id`
+
+// chargeColumns lists the charges columns scanned into models.Charge
+const chargeColumns = `id, user_id, print_request_id, amount_cents, description, waived, waived_reason, created_at, updated_at`
+
+// paymentColumns lists the payments columns scanned into models.Payment
+const paymentColumns = `id, user_id, amount_cents, method, reference, note, recorded_by, created_at`
+
+// balanceSelect selects each user's total charges, excluding waived ones, and payments
+const balanceSelect = `
+		SELECT u.id AS user_id, u.username,
+			COALESCE((SELECT SUM(c.amount_cents) FROM charges c WHERE c.user_id = u.id AND c.waived = FALSE), 0) AS charged,
+			COALESCE((SELECT SUM(p.amount_cents) FROM payments p WHERE p.user_id = u.id), 0) AS paid
+		FROM users u`
+
+// quotaOverrideColumns lists the quota_overrides columns scanned into models.QuotaOverride
+const quotaOverrideColumns = `id, scope, subject, max_open_requests, monthly_grams, monthly_hours, created_at, updated_at`
+
+// groupColumns lists the groups columns scanned into models.Group
+const groupColumns = `id, name, description, created_at, updated_at`
+
+// groupMembershipSelect selects group memberships joined with their group and user names
+const groupMembershipSelect = `
+		SELECT gm.group_id, g.name AS group_name, gm.user_id, u.username, gm.role, gm.created_at
+		FROM group_memberships gm
+		JOIN groups g ON gm.group_id = g.id
+		JOIN users u ON gm.user_id = u.id`
+
+// roleColumns lists the roles columns scanned into models.RoleDefinition
+const roleColumns = `name, description, built_in, created_at, updated_at`
+
+// apiTokenColumns lists the api_tokens columns scanned into apiTokenRow
+const apiTokenColumns = `id, user_id, name, token_hash, prefix, scopes, expires_at, last_used_at, created_at`
+
+// apiTokenRow is an api_tokens row, whose scopes are stored space-separated
+type apiTokenRow struct {
+	models.APIToken
+	Scopes string `db:"scopes"`
+}
+
+// toModel converts the row to an API token
+func (r *apiTokenRow) toModel() *models.APIToken {
+	token := r.APIToken
+	token.Scopes = []models.Permission{}
+	for _, scope := range strings.Fields(r.Scopes) {
+		token.Scopes = append(token.Scopes, models.Permission(scope))
+	}
+	return &token
+}
+
+// joinScopes formats an API token's scopes for storage
+func joinScopes(scopes []models.Permission) string {
+	values := make([]string, len(scopes))
+	for i, scope := range scopes {
+		values[i] = string(scope)
+	}
+	return strings.Join(values, " ")
+}
+
+// userSessionColumns lists the user_sessions columns scanned into models.UserSession
+const userSessionColumns = `id, COALESCE(user_id, '') AS user_id, session_token, data, user_agent, ip_address,
+			expires_at, created_at, last_seen_at`
+
+// nullIfEmpty stores an empty string as NULL, e.g. for optional foreign keys
+func nullIfEmpty(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// userTOTPColumns lists the user_totp columns scanned into models.UserTOTP
+const userTOTPColumns = `user_id, secret, enabled, last_counter, created_at, enabled_at`
+
+// webAuthnCredentialColumns lists the user_webauthn_credentials columns scanned into models.WebAuthnCredential
+const webAuthnCredentialColumns = `id, user_id, name, credential_id, public_key, sign_count, created_at, last_used_at`
+
+// emailTokenColumns lists the email_tokens columns scanned into models.EmailToken
+const emailTokenColumns = `id, user_id, purpose, token_hash, email, expires_at, used_at, created_at`
+
+// loginAttemptsColumns lists the login_attempts columns scanned into models.LoginAttempts
+const loginAttemptsColumns = `username, failed_count, last_failed_at, locked_until`
+
+// invitationColumns lists the invitations columns scanned into models.Invitation
+const invitationColumns = `id, code_hash, prefix, email, role, group_id, max_uses, uses, expires_at, revoked_at, created_by, created_at`
+
+// auditEventColumns lists the audit_events columns scanned into auditEventRow
+const auditEventColumns = `id, actor_id, actor_name, action, target_type, target_id, changes, ip_address, user_agent, created_at`
+
+// auditEventRow is an audit_events row, whose changes are stored as JSON
+type auditEventRow struct {
+	models.AuditEvent
+	Changes string `db:"changes"`
+}
+
+// toModel converts the row to an audit event
+func (r *auditEventRow) toModel() (*models.AuditEvent, error) {
+	event := r.AuditEvent
+	if r.Changes != "" {
+		if err := json.Unmarshal([]byte(r.Changes), &event.Changes); err != nil {
+			return nil, fmt.Errorf("failed to decode changes of audit event %s: %w", r.ID, err)
+		}
+	}
+	return &event, nil
+}
+
+// auditEventWhere returns the WHERE clause selecting the filter's audit
+// events, with ? placeholders, and its arguments
+func auditEventWhere(filter models.AuditEventFilter) (string, []any) {
+	var conditions []string
+	var args []any
+	if filter.Actor != "" {
+		conditions = append(conditions, "(actor_id = ? OR actor_name = ?)")
+		args = append(args, filter.Actor, filter.Actor)
+	}
+	if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if filter.TargetType != "" {
+		conditions = append(conditions, "target_type = ?")
+		args = append(args, filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		conditions = append(conditions, "target_id = ?")
+		args = append(args, filter.TargetID)
+	}
+	if filter.Since != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, *filter.Since)
+	}
+	if filter.Until != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, *filter.Until)
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// printRequestColumns lists the print_requests columns scanned into models.PrintRequest
+const printRequestColumns = `id, user_id, group_id, file_link, notes, spool_id, printer_id, color, material, status,
+			spool_needs_replacement, estimated_grams, estimated_hours, estimated_cost,
+			actual_grams, actual_hours, actual_cost, created_at, updated_at`
+
 // Config holds the database configuration
 type Config struct {
 	Type     string // "sqlite" or "postgres"
@@ -132,6 +452,70 @@ func (c *baseClient) GetDB() *sql.DB {
 	return c.db.DB
 }
 
+// CreateAuditEvent adds an event to the audit log
+func (c *baseClient) CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+	changes := ""
+	if len(event.Changes) > 0 {
+		data, err := json.Marshal(event.Changes)
+		if err != nil {
+			return fmt.Errorf("failed to encode audit event changes: %w", err)
+		}
+		changes = string(data)
+	}
+
+	query := `INSERT INTO audit_events (` + auditEventColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := c.db.ExecContext(ctx, c.db.Rebind(query),
+		event.ID,
+		event.ActorID,
+		event.ActorName,
+		event.Action,
+		event.TargetType,
+		event.TargetID,
+		changes,
+		event.IPAddress,
+		event.UserAgent,
+		event.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEvents lists the audit events matching the filter, newest first,
+// and returns how many match in total, ignoring its limit and offset
+func (c *baseClient) ListAuditEvents(ctx context.Context, filter models.AuditEventFilter) ([]*models.AuditEvent, int, error) {
+	where, args := auditEventWhere(filter)
+
+	var total int
+	if err := c.db.GetContext(ctx, &total, c.db.Rebind(`SELECT COUNT(*) FROM audit_events`+where), args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count audit events: %w", err)
+	}
+
+	query := `SELECT ` + auditEventColumns + ` FROM audit_events` + where + ` ORDER BY created_at DESC, id`
+	if filter.Limit > 0 {
+		query += ` LIMIT ? OFFSET ?`
+		args = append(args, filter.Limit, filter.Offset)
+	}
+	var rows []*auditEventRow
+	if err := c.db.SelectContext(ctx, &rows, c.db.Rebind(query), args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to list audit events: %w", err)
+	}
+
+	events := make([]*models.AuditEvent, len(rows))
+	for i, row := range rows {
+		event, err := row.toModel()
+		if err != nil {
+			return nil, 0, err
+		}
+		events[i] = event
+	}
+	return events, total, nil
+}
+
 // txWrapper wraps an sqlx.Tx to implement the Tx interface
 type txWrapper struct {
 	tx *sqlx.Tx
@@ -150,10 +534,10 @@ func (t *txWrapper) Rollback() error {
 // CreateUser creates a new user within the transaction
 func (t *txWrapper) CreateUser(ctx context.Context, user *models.User) error {
 	query := `
-		INSERT INTO users (id, username, email, password_hash, display_name, role, created_at, updated_at, enabled)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		INSERT INTO users (id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := t.tx.ExecContext(ctx, query,
+	_, err := t.tx.ExecContext(ctx, t.tx.Rebind(query),
 		user.ID,
 		user.Username,
 		user.Email,
@@ -163,6 +547,8 @@ func (t *txWrapper) CreateUser(ctx context.Context, user *models.User) error {
 		user.CreatedAt,
 		user.UpdatedAt,
 		user.Enabled,
+		user.EmailVerifiedAt,
+		user.MustChangePassword,
 	)
 	if err != nil {
 		return fmt.Errorf("failed to create user: %w", err)
@@ -173,9 +559,9 @@ func (t *txWrapper) CreateUser(ctx context.Context, user *models.User) error {
 // GetUser retrieves a user by ID within the transaction
 func (t *txWrapper) GetUser(ctx context.Context, id string) (*models.User, error) {
 	var user models.User
-	query := `SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled FROM users WHERE id = ?`
+	query := `SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password FROM users WHERE id = ?`
 
-	err := t.tx.GetContext(ctx, &user, query, id)
+	err := t.tx.GetContext(ctx, &user, t.tx.Rebind(query), id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -185,12 +571,23 @@ func (t *txWrapper) GetUser(ctx context.Context, id string) (*models.User, error
 	return &user, nil
 }
 
+// LockUser locks a user within the transaction and returns them. Writing
+// the row takes its lock on PostgreSQL, and the database write lock on
+// SQLite, where rows cannot be locked alone.
+func (t *txWrapper) LockUser(ctx context.Context, id string) (*models.User, error) {
+	query := `UPDATE users SET updated_at = updated_at WHERE id = ?`
+	if _, err := t.tx.ExecContext(ctx, t.tx.Rebind(query), id); err != nil {
+		return nil, fmt.Errorf("failed to lock user: %w", err)
+	}
+	return t.GetUser(ctx, id)
+}
+
 // GetUserByUsername retrieves a user by username within the transaction
 func (t *txWrapper) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	var user models.User
-	query := `SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled FROM users WHERE username = ?`
+	query := `SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password FROM users WHERE username = ?`
 
-	err := t.tx.GetContext(ctx, &user, query, username)
+	err := t.tx.GetContext(ctx, &user, t.tx.Rebind(query), username)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -203,9 +600,9 @@ func (t *txWrapper) GetUserByUsername(ctx context.Context, username string) (*mo
 // GetUserByEmail retrieves a user by email within the transaction
 func (t *txWrapper) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	var user models.User
-	query := `SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled FROM users WHERE email = ?`
+	query := `SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password FROM users WHERE email = ?`
 
-	err := t.tx.GetContext(ctx, &user, query, email)
+	err := t.tx.GetContext(ctx, &user, t.tx.Rebind(query), email)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -219,10 +616,10 @@ func (t *txWrapper) GetUserByEmail(ctx context.Context, email string) (*models.U
 func (t *txWrapper) UpdateUser(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users 
-		SET username = ?, email = ?, password_hash = ?, display_name = ?, role = ?, updated_at = ?, enabled = ?
+		SET username = ?, email = ?, password_hash = ?, display_name = ?, role = ?, updated_at = ?, enabled = ?, email_verified_at = ?, must_change_password = ?
 		WHERE id = ?`
 
-	_, err := t.tx.ExecContext(ctx, query,
+	_, err := t.tx.ExecContext(ctx, t.tx.Rebind(query),
 		user.Username,
 		user.Email,
 		user.PasswordHash,
@@ -230,6 +627,8 @@ func (t *txWrapper) UpdateUser(ctx context.Context, user *models.User) error {
 		user.Role,
 		user.UpdatedAt,
 		user.Enabled,
+		user.EmailVerifiedAt,
+		user.MustChangePassword,
 		user.ID,
 	)
 	if err != nil {
@@ -238,21 +637,157 @@ func (t *txWrapper) UpdateUser(ctx context.Context, user *models.User) error {
 	return nil
 }
 
+// ReassignUserRecords moves a user's print requests, charges and payments to
+// another user within the transaction, returning the number of print
+// requests moved
+func (t *txWrapper) ReassignUserRecords(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	result, err := t.tx.ExecContext(ctx, t.tx.Rebind(`UPDATE print_requests SET user_id = ? WHERE user_id = ?`), toUserID, fromUserID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to reassign print requests: %w", err)
+	}
+	moved, err := result.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("failed to reassign print requests: %w", err)
+	}
+
+	for _, table := range []string{"charges", "payments"} {
+		if _, err := t.tx.ExecContext(ctx, t.tx.Rebind(`UPDATE `+table+` SET user_id = ? WHERE user_id = ?`), toUserID, fromUserID); err != nil {
+			return 0, fmt.Errorf("failed to reassign %s: %w", table, err)
+		}
+	}
+	return moved, nil
+}
+
+// userOwnedTables lists the tables whose rows belong to a user and are
+// deleted with them. PostgreSQL cascades these deletes itself, but SQLite
+// does not enforce foreign keys.
+var userOwnedTables = []string{
+	"user_sessions",
+	"user_oidc_identities",
+	"user_ldap_identities",
+	"api_tokens",
+	"group_memberships",
+	"user_totp",
+	"user_recovery_codes",
+	"user_webauthn_credentials",
+	"email_tokens",
+	"charges",
+	"payments",
+}
+
+// DeleteUser deletes a user and everything that belongs to them within the
+// transaction. Their print requests must be reassigned first.
+func (t *txWrapper) DeleteUser(ctx context.Context, id string) error {
+	for _, table := range userOwnedTables {
+		if _, err := t.tx.ExecContext(ctx, t.tx.Rebind(`DELETE FROM `+table+` WHERE user_id = ?`), id); err != nil {
+			return fmt.Errorf("failed to delete user's %s: %w", table, err)
+		}
+	}
+
+	queries := []string{
+		`DELETE FROM quota_overrides WHERE scope = 'user' AND subject = ?`,
+		`UPDATE invitations SET created_by = NULL WHERE created_by = ?`,
+		`DELETE FROM users WHERE id = ?`,
+	}
+	for _, query := range queries {
+		if _, err := t.tx.ExecContext(ctx, t.tx.Rebind(query), id); err != nil {
+			return fmt.Errorf("failed to delete user: %w", err)
+		}
+	}
+	return nil
+}
+
+// CreateOIDCIdentity links an OIDC identity to a user within the transaction
+func (t *txWrapper) CreateOIDCIdentity(ctx context.Context, identity *models.UserOIDCIdentity) error {
+	query := `INSERT INTO user_oidc_identities (id, user_id, provider_name, subject, created_at) VALUES (?, ?, ?, ?, ?)`
+
+	_, err := t.tx.ExecContext(ctx, t.tx.Rebind(query), identity.ID, identity.UserID, identity.ProviderName, identity.Subject, identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create OIDC identity: %w", err)
+	}
+	return nil
+}
+
+// CreateLDAPIdentity links an LDAP identity to a user within the transaction
+func (t *txWrapper) CreateLDAPIdentity(ctx context.Context, identity *models.UserLDAPIdentity) error {
+	query := `INSERT INTO user_ldap_identities (id, user_id, provider_name, subject, created_at) VALUES (?, ?, ?, ?, ?)`
+
+	_, err := t.tx.ExecContext(ctx, t.tx.Rebind(query), identity.ID, identity.UserID, identity.ProviderName, identity.Subject, identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create LDAP identity: %w", err)
+	}
+	return nil
+}
+
+// SetGroupMembership adds a user to a group, or changes their role in it,
+// within the transaction
+func (t *txWrapper) SetGroupMembership(ctx context.Context, membership *models.GroupMembership) error {
+	if membership.CreatedAt.IsZero() {
+		membership.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO group_memberships (group_id, user_id, role, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (group_id, user_id) DO UPDATE SET role = excluded.role`
+	_, err := t.tx.ExecContext(ctx, t.tx.Rebind(query), membership.GroupID, membership.UserID, membership.Role, membership.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set group membership: %w", err)
+	}
+	return nil
+}
+
+// UseInvitation counts a use of a usable invitation within the transaction
+// and returns it, or nil if there is no usable invitation with the code
+func (t *txWrapper) UseInvitation(ctx context.Context, codeHash string, now time.Time) (*models.Invitation, error) {
+	query := `
+		UPDATE invitations SET uses = uses + 1
+		WHERE code_hash = ? AND revoked_at IS NULL AND uses < max_uses AND (expires_at IS NULL OR expires_at > ?)`
+	result, err := t.tx.ExecContext(ctx, t.tx.Rebind(query), codeHash, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use invitation: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to use invitation: %w", err)
+	}
+	if rows == 0 {
+		return nil, nil
+	}
+
+	invitation := &models.Invitation{}
+	query = `SELECT ` + invitationColumns + ` FROM invitations WHERE code_hash = ?`
+	if err := t.tx.GetContext(ctx, invitation, t.tx.Rebind(query), codeHash); err != nil {
+		return nil, fmt.Errorf("failed to get invitation: %w", err)
+	}
+	return invitation, nil
+}
+
 // CreatePrintRequest creates a new print request within the transaction
 func (t *txWrapper) CreatePrintRequest(ctx context.Context, request *models.PrintRequest) error {
 	query := `
-		INSERT INTO print_requests (id, user_id, file_link, notes, material, color, status, spool_id, created_at, updated_at)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		INSERT INTO print_requests (id, user_id, group_id, file_link, notes, material, color, status, spool_id, printer_id, spool_needs_replacement,
+			estimated_grams, estimated_hours, estimated_cost, actual_grams, actual_hours, actual_cost, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
-	_, err := t.tx.ExecContext(ctx, query,
+	_, err := t.tx.ExecContext(ctx, t.tx.Rebind(query),
 		request.ID,
 		request.UserID,
+		request.GroupID,
 		request.FileLink,
 		request.Notes,
 		request.Material,
 		request.Color,
 		request.Status,
 		request.SpoolID,
+		request.PrinterID,
+		request.SpoolNeedsReplacement,
+		request.EstimatedGrams,
+		request.EstimatedHours,
+		request.EstimatedCost,
+		request.ActualGrams,
+		request.ActualHours,
+		request.ActualCost,
 		request.CreatedAt,
 		request.UpdatedAt,
 	)
@@ -265,9 +800,9 @@ func (t *txWrapper) CreatePrintRequest(ctx context.Context, request *models.Prin
 // GetPrintRequest retrieves a print request by ID within the transaction
 func (t *txWrapper) GetPrintRequest(ctx context.Context, id string) (*models.PrintRequest, error) {
 	var request models.PrintRequest
-	query := `SELECT id, user_id, file_link, notes, material, color, status, spool_id, created_at, updated_at FROM print_requests WHERE id = ?`
+	query := `SELECT ` + printRequestColumns + ` FROM print_requests WHERE id = ?`
 
-	err := t.tx.GetContext(ctx, &request, query, id)
+	err := t.tx.GetContext(ctx, &request, t.tx.Rebind(query), id)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
@@ -277,20 +812,42 @@ func (t *txWrapper) GetPrintRequest(ctx context.Context, id string) (*models.Pri
 	return &request, nil
 }
 
+// ListPrintRequestsByUserID retrieves a user's print requests within the
+// transaction, newest first
+func (t *txWrapper) ListPrintRequestsByUserID(ctx context.Context, userID string) ([]*models.PrintRequest, error) {
+	query := `SELECT ` + printRequestColumns + ` FROM print_requests WHERE user_id = ? ORDER BY created_at DESC`
+
+	requests := []*models.PrintRequest{}
+	if err := t.tx.SelectContext(ctx, &requests, t.tx.Rebind(query), userID); err != nil {
+		return nil, fmt.Errorf("failed to query print requests for user: %w", err)
+	}
+	return requests, nil
+}
+
 // UpdatePrintRequest updates a print request within the transaction
 func (t *txWrapper) UpdatePrintRequest(ctx context.Context, request *models.PrintRequest) error {
 	query := `
 		UPDATE print_requests 
-		SET file_link = ?, notes = ?, material = ?, color = ?, status = ?, spool_id = ?, updated_at = ?
+		SET group_id = ?, file_link = ?, notes = ?, material = ?, color = ?, status = ?, spool_id = ?, printer_id = ?, spool_needs_replacement = ?,
+			estimated_grams = ?, estimated_hours = ?, estimated_cost = ?, actual_grams = ?, actual_hours = ?, actual_cost = ?, updated_at = ?
 		WHERE id = ?`
 
-	_, err := t.tx.ExecContext(ctx, query,
+	_, err := t.tx.ExecContext(ctx, t.tx.Rebind(query),
+		request.GroupID,
 		request.FileLink,
 		request.Notes,
 		request.Material,
 		request.Color,
 		request.Status,
 		request.SpoolID,
+		request.PrinterID,
+		request.SpoolNeedsReplacement,
+		request.EstimatedGrams,
+		request.EstimatedHours,
+		request.EstimatedCost,
+		request.ActualGrams,
+		request.ActualHours,
+		request.ActualCost,
 		request.UpdatedAt,
 		request.ID,
 	)
@@ -299,3 +856,118 @@ func (t *txWrapper) UpdatePrintRequest(ctx context.Context, request *models.Prin
 	}
 	return nil
 }
+
+// GetPrinter retrieves a printer by ID within the transaction
+func (t *txWrapper) GetPrinter(ctx context.Context, id int) (*models.Printer, error) {
+	printer := &models.Printer{}
+	query := `SELECT id, name, dim_x as "dimensions.x", dim_y as "dimensions.y", dim_z as "dimensions.z", url FROM printers WHERE id = ?`
+
+	err := t.tx.GetContext(ctx, printer, t.tx.Rebind(query), id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get printer: %w", err)
+	}
+	return printer, nil
+}
+
+// CreateCharge creates a charge within the transaction
+func (t *txWrapper) CreateCharge(ctx context.Context, charge *models.Charge) error {
+	now := time.Now()
+	charge.CreatedAt = now
+	charge.UpdatedAt = now
+
+	query := `
+		INSERT INTO charges (user_id, print_request_id, amount_cents, description, waived, waived_reason, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?) RETURNING id`
+	err := t.tx.QueryRowContext(ctx, t.tx.Rebind(query),
+		charge.UserID,
+		charge.PrintRequestID,
+		charge.Amount,
+		charge.Description,
+		charge.Waived,
+		charge.WaivedReason,
+		charge.CreatedAt,
+		charge.UpdatedAt,
+	).Scan(&charge.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create charge: %w", err)
+	}
+	return nil
+}
+
+// GetChargeByPrintRequestID retrieves the charge for a print request within
+// the transaction
+func (t *txWrapper) GetChargeByPrintRequestID(ctx context.Context, printRequestID string) (*models.Charge, error) {
+	charge := &models.Charge{}
+	query := `SELECT ` + chargeColumns + ` FROM charges WHERE print_request_id = ?`
+
+	err := t.tx.GetContext(ctx, charge, t.tx.Rebind(query), printRequestID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get charge: %w", err)
+	}
+	return charge, nil
+}
+
+// UpdateCharge updates a charge within the transaction
+func (t *txWrapper) UpdateCharge(ctx context.Context, charge *models.Charge) error {
+	charge.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE charges
+		SET amount_cents = ?, description = ?, waived = ?, waived_reason = ?, updated_at = ?
+		WHERE id = ?`
+	_, err := t.tx.ExecContext(ctx, t.tx.Rebind(query),
+		charge.Amount,
+		charge.Description,
+		charge.Waived,
+		charge.WaivedReason,
+		charge.UpdatedAt,
+		charge.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update charge: %w", err)
+	}
+	return nil
+}
+
+// loadRolePermissions fills in the permissions granted by each of the roles
+func loadRolePermissions(ctx context.Context, db sqlx.QueryerContext, roles []*models.RoleDefinition) error {
+	var grants []struct {
+		Role       models.Role       `db:"role"`
+		Permission models.Permission `db:"permission"`
+	}
+	if err := sqlx.SelectContext(ctx, db, &grants, `SELECT role, permission FROM role_permissions ORDER BY role, permission`); err != nil {
+		return fmt.Errorf("failed to query role permissions: %w", err)
+	}
+
+	byRole := make(map[models.Role]*models.RoleDefinition, len(roles))
+	for _, role := range roles {
+		role.Permissions = []models.Permission{}
+		byRole[role.Name] = role
+	}
+	for _, grant := range grants {
+		if role, ok := byRole[grant.Role]; ok {
+			role.Permissions = append(role.Permissions, grant.Permission)
+		}
+	}
+	return nil
+}
+
+// replaceRolePermissions replaces the permissions granted by a role
+func replaceRolePermissions(ctx context.Context, tx *sqlx.Tx, role *models.RoleDefinition) error {
+	if _, err := tx.ExecContext(ctx, tx.Rebind(`DELETE FROM role_permissions WHERE role = ?`), role.Name); err != nil {
+		return fmt.Errorf("failed to delete role permissions: %w", err)
+	}
+	for _, permission := range role.Permissions {
+		query := tx.Rebind(`INSERT INTO role_permissions (role, permission) VALUES (?, ?)`)
+		if _, err := tx.ExecContext(ctx, query, role.Name, permission); err != nil {
+			return fmt.Errorf("failed to grant role permission: %w", err)
+		}
+	}
+	return nil
+}
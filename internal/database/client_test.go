@@ -2,8 +2,13 @@ package database
 
 import (
 	"context"
+	"math"
 	"os"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/bjschafer/print-dis/internal/migrations"
 	"github.com/bjschafer/print-dis/internal/models"
@@ -221,6 +226,86 @@ func testDatabaseClient(t *testing.T, client DBClient, dbType string) {
 		}
 	})
 
+	// Test spool operations
+	t.Run("Spool CRUD", func(t *testing.T) {
+		material := &models.Material{Name: "Test Material Spool", Density: 1.24, Diameter: 1.75}
+		if err := client.CreateMaterial(ctx, material); err != nil {
+			t.Fatalf("Failed to create material: %v", err)
+		}
+		filament := &models.Filament{
+			Name:     "Spool Filament",
+			Material: *material,
+			Vendor:   "Test Vendor",
+			ColorHex: "00ff00",
+			Weight:   1000,
+		}
+		if err := client.CreateFilament(ctx, filament); err != nil {
+			t.Fatalf("Failed to create filament: %v", err)
+		}
+
+		// Create a spool
+		spool := &models.Spool{
+			Filament:        *filament,
+			InitialWeight:   1000,
+			RemainingWeight: 1000,
+			Location:        "Shelf A",
+			CreatedAt:       time.Now(),
+		}
+		if err := client.CreateSpool(ctx, spool); err != nil {
+			t.Fatalf("Failed to create spool: %v", err)
+		}
+
+		// Get the spool, including its filament and material
+		got, err := client.GetSpool(ctx, spool.Id)
+		if err != nil {
+			t.Fatalf("Failed to get spool: %v", err)
+		}
+		if got == nil {
+			t.Fatal("Expected spool to exist")
+		}
+		if got.Filament.Vendor != "Test Vendor" || got.Filament.Material.Name != material.Name {
+			t.Errorf("Expected spool filament to be loaded, got %+v", got.Filament)
+		}
+		if got.Filament.Material.Diameter != 1.75 {
+			t.Errorf("Expected material diameter 1.75, got %v", got.Filament.Material.Diameter)
+		}
+
+		// Update the spool
+		spool.RemainingWeight = 250
+		spool.Archived = true
+		if err := client.UpdateSpool(ctx, spool); err != nil {
+			t.Fatalf("Failed to update spool: %v", err)
+		}
+		got, err = client.GetSpool(ctx, spool.Id)
+		if err != nil {
+			t.Fatalf("Failed to get updated spool: %v", err)
+		}
+		if got.RemainingWeight != 250 || !got.Archived {
+			t.Errorf("Expected updated spool, got %+v", got)
+		}
+
+		// List spools
+		spools, err := client.ListSpools(ctx)
+		if err != nil {
+			t.Fatalf("Failed to list spools: %v", err)
+		}
+		if len(spools) != 1 {
+			t.Errorf("Expected 1 spool, got %d", len(spools))
+		}
+
+		// Delete the spool
+		if err := client.DeleteSpool(ctx, spool.Id); err != nil {
+			t.Fatalf("Failed to delete spool: %v", err)
+		}
+		got, err = client.GetSpool(ctx, spool.Id)
+		if err != nil {
+			t.Fatalf("Failed to get deleted spool: %v", err)
+		}
+		if got != nil {
+			t.Error("Expected spool to be deleted")
+		}
+	})
+
 	// Test job operations
 	t.Run("Job CRUD", func(t *testing.T) {
 		// Create required dependencies
@@ -319,4 +404,1371 @@ func testDatabaseClient(t *testing.T, client DBClient, dbType string) {
 			t.Error("Expected job to be deleted")
 		}
 	})
+
+	// Test print request operations
+	t.Run("PrintRequest CRUD", func(t *testing.T) {
+		user := models.NewUser("print-request-owner", nil)
+		user.ID = "print-request-owner-id"
+		if err := client.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		spoolID := 42
+		request := models.NewPrintRequest(user.ID, "https://example.com/model.stl", "Please print in red")
+		request.ID = "print-request-id"
+		request.SpoolID = &spoolID
+
+		if err := client.CreatePrintRequest(ctx, request); err != nil {
+			t.Fatalf("Failed to create print request: %v", err)
+		}
+
+		got, err := client.GetPrintRequest(ctx, request.ID)
+		if err != nil {
+			t.Fatalf("Failed to get print request: %v", err)
+		}
+		if got == nil {
+			t.Fatal("Expected print request to exist")
+		}
+		if got.Notes != request.Notes {
+			t.Errorf("Expected notes %q, got %q", request.Notes, got.Notes)
+		}
+		if got.Status != models.StatusPendingApproval {
+			t.Errorf("Expected status %s, got %s", models.StatusPendingApproval, got.Status)
+		}
+
+		// Update the print request
+		request.Status = models.StatusEnqueued
+		request.SpoolNeedsReplacement = true
+		if err := client.UpdatePrintRequest(ctx, request); err != nil {
+			t.Fatalf("Failed to update print request: %v", err)
+		}
+
+		// Look it up by spool
+		bySpool, err := client.ListPrintRequestsBySpoolID(ctx, spoolID)
+		if err != nil {
+			t.Fatalf("Failed to list print requests by spool: %v", err)
+		}
+		if len(bySpool) != 1 {
+			t.Fatalf("Expected 1 print request for spool, got %d", len(bySpool))
+		}
+		if bySpool[0].Status != models.StatusEnqueued || !bySpool[0].SpoolNeedsReplacement {
+			t.Errorf("Expected updated print request, got status %s and needs replacement %v",
+				bySpool[0].Status, bySpool[0].SpoolNeedsReplacement)
+		}
+
+		// Quotas are checked against a user's requests with the user locked
+		tx, err := client.BeginTx(ctx)
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %v", err)
+		}
+		locked, err := tx.LockUser(ctx, user.ID)
+		if err != nil || locked == nil || locked.ID != user.ID {
+			t.Fatalf("Expected to lock %s, got %+v, %v", user.ID, locked, err)
+		}
+		byUser, err := tx.ListPrintRequestsByUserID(ctx, user.ID)
+		if err != nil || len(byUser) != 1 || byUser[0].ID != request.ID {
+			t.Fatalf("Expected the user's print request, got %+v, %v", byUser, err)
+		}
+		if missing, err := tx.LockUser(ctx, "missing-user-id"); err != nil || missing != nil {
+			t.Errorf("Expected no user to lock, got %+v, %v", missing, err)
+		}
+		if err := tx.CreatePrintRequestStatusEvent(ctx, &models.PrintRequestStatusEvent{
+			PrintRequestID: request.ID, ToStatus: models.StatusEnqueued, CreatedAt: time.Now(),
+		}); err != nil {
+			t.Fatalf("Failed to create status event: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+
+		// Delete the print request
+		if err := client.DeletePrintRequest(ctx, request.ID); err != nil {
+			t.Fatalf("Failed to delete print request: %v", err)
+		}
+		got, err = client.GetPrintRequest(ctx, request.ID)
+		if err != nil {
+			t.Fatalf("Failed to get deleted print request: %v", err)
+		}
+		if got != nil {
+			t.Error("Expected print request to be deleted")
+		}
+
+		// along with its status history
+		countEvents := `SELECT COUNT(*) FROM print_request_status_events WHERE print_request_id = ?`
+		if dbType == "postgres" {
+			countEvents = strings.Replace(countEvents, "?", "$1", 1)
+		}
+		var events int
+		if err := client.GetDB().QueryRowContext(ctx, countEvents, request.ID).Scan(&events); err != nil || events != 0 {
+			t.Errorf("Expected the status history to be deleted, got %d events, %v", events, err)
+		}
+	})
+
+	// Test billing operations
+	t.Run("Billing", func(t *testing.T) {
+		user := models.NewUser("billing-user", nil)
+		user.ID = "billing-user-id"
+		if err := client.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		requestID := "billing-request-id"
+		charge := &models.Charge{UserID: user.ID, PrintRequestID: &requestID, Amount: 1250, Description: "Print"}
+		if err := client.CreateCharge(ctx, charge); err != nil {
+			t.Fatalf("Failed to create charge: %v", err)
+		}
+		if charge.ID == 0 {
+			t.Fatal("Expected charge ID to be set")
+		}
+		waived := &models.Charge{UserID: user.ID, Amount: 10000, Description: "Waived"}
+		if err := client.CreateCharge(ctx, waived); err != nil {
+			t.Fatalf("Failed to create charge: %v", err)
+		}
+		waived.Waived = true
+		waived.WaivedReason = "Failed print"
+		if err := client.UpdateCharge(ctx, waived); err != nil {
+			t.Fatalf("Failed to update charge: %v", err)
+		}
+
+		payment := &models.Payment{UserID: user.ID, Amount: 1000, Method: "cash", RecordedBy: user.ID}
+		if err := client.CreatePayment(ctx, payment); err != nil {
+			t.Fatalf("Failed to create payment: %v", err)
+		}
+
+		byRequest, err := client.GetChargeByPrintRequestID(ctx, requestID)
+		if err != nil {
+			t.Fatalf("Failed to get charge by print request: %v", err)
+		}
+		if byRequest == nil || byRequest.ID != charge.ID {
+			t.Fatalf("Expected charge %d for print request, got %+v", charge.ID, byRequest)
+		}
+
+		got, err := client.GetCharge(ctx, waived.ID)
+		if err != nil {
+			t.Fatalf("Failed to get charge: %v", err)
+		}
+		if got == nil || !got.Waived || got.WaivedReason != "Failed print" {
+			t.Errorf("Expected waived charge, got %+v", got)
+		}
+
+		charges, err := client.ListChargesByUserID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Failed to list charges: %v", err)
+		}
+		if len(charges) != 2 {
+			t.Errorf("Expected 2 charges, got %d", len(charges))
+		}
+		payments, err := client.ListPaymentsByUserID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Failed to list payments: %v", err)
+		}
+		if len(payments) != 1 || payments[0].Method != "cash" {
+			t.Errorf("Expected 1 cash payment, got %+v", payments)
+		}
+
+		// Waived charges do not count towards the balance
+		balance, err := client.GetBalance(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Failed to get balance: %v", err)
+		}
+		if balance == nil || balance.Charged != 1250 || balance.Paid != 1000 {
+			t.Errorf("Expected 12.5 charged and 10 paid, got %+v", balance)
+		}
+
+		balances, err := client.ListBalances(ctx)
+		if err != nil {
+			t.Fatalf("Failed to list balances: %v", err)
+		}
+		found := false
+		for _, b := range balances {
+			if b.UserID == user.ID {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("Expected billing user in balances")
+		}
+
+		missing, err := client.GetBalance(ctx, "no-such-user")
+		if err != nil {
+			t.Fatalf("Failed to get balance of missing user: %v", err)
+		}
+		if missing != nil {
+			t.Error("Expected no balance for missing user")
+		}
+
+		// Print requests are charged in the transaction that completes them
+		txRequestID := "billing-tx-request-id"
+		for _, commit := range []bool{false, true} {
+			tx, err := client.BeginTx(ctx)
+			if err != nil {
+				t.Fatalf("Failed to begin transaction: %v", err)
+			}
+			txCharge := &models.Charge{UserID: user.ID, PrintRequestID: &txRequestID, Amount: 500, Description: "Print"}
+			if err := tx.CreateCharge(ctx, txCharge); err != nil || txCharge.ID == 0 {
+				t.Fatalf("Failed to create charge in transaction: %v, id %d", err, txCharge.ID)
+			}
+			txCharge.Amount = 750
+			if err := tx.UpdateCharge(ctx, txCharge); err != nil {
+				t.Fatalf("Failed to update charge in transaction: %v", err)
+			}
+			if got, err := tx.GetChargeByPrintRequestID(ctx, txRequestID); err != nil || got == nil || got.Amount != 750 {
+				t.Fatalf("Expected the updated charge in the transaction, got %+v, %v", got, err)
+			}
+			if commit {
+				err = tx.Commit()
+			} else {
+				err = tx.Rollback()
+			}
+			if err != nil {
+				t.Fatalf("Failed to end transaction: %v", err)
+			}
+			if got, _ := client.GetChargeByPrintRequestID(ctx, txRequestID); (got != nil) != commit {
+				t.Errorf("Expected the charge to be kept only if committed (%v), got %+v", commit, got)
+			}
+		}
+	})
+
+	// Test quota override operations
+	t.Run("QuotaOverride CRUD", func(t *testing.T) {
+		maxOpen := 3
+		override := &models.QuotaOverride{
+			Scope:       models.QuotaScopeRole,
+			Subject:     string(models.RoleUser),
+			QuotaLimits: models.QuotaLimits{MaxOpenRequests: &maxOpen},
+		}
+		if err := client.CreateQuotaOverride(ctx, override); err != nil {
+			t.Fatalf("Failed to create quota override: %v", err)
+		}
+		if override.ID == 0 {
+			t.Fatal("Expected quota override ID to be set")
+		}
+
+		got, err := client.GetQuotaOverride(ctx, models.QuotaScopeRole, string(models.RoleUser))
+		if err != nil {
+			t.Fatalf("Failed to get quota override: %v", err)
+		}
+		if got == nil || got.MaxOpenRequests == nil || *got.MaxOpenRequests != 3 {
+			t.Fatalf("Expected quota override with 3 open requests, got %+v", got)
+		}
+		if got.MonthlyGrams != nil || got.MonthlyHours != nil {
+			t.Errorf("Expected unset limits to be nil, got %+v", got.QuotaLimits)
+		}
+
+		// Update the override
+		grams := 250.0
+		override.MaxOpenRequests = nil
+		override.MonthlyGrams = &grams
+		if err := client.UpdateQuotaOverride(ctx, override); err != nil {
+			t.Fatalf("Failed to update quota override: %v", err)
+		}
+
+		overrides, err := client.ListQuotaOverrides(ctx)
+		if err != nil {
+			t.Fatalf("Failed to list quota overrides: %v", err)
+		}
+		if len(overrides) != 1 {
+			t.Fatalf("Expected 1 quota override, got %d", len(overrides))
+		}
+		if overrides[0].MaxOpenRequests != nil || overrides[0].MonthlyGrams == nil || *overrides[0].MonthlyGrams != 250 {
+			t.Errorf("Expected updated quota override, got %+v", overrides[0].QuotaLimits)
+		}
+
+		// Delete the override
+		if err := client.DeleteQuotaOverride(ctx, override.ID); err != nil {
+			t.Fatalf("Failed to delete quota override: %v", err)
+		}
+		got, err = client.GetQuotaOverride(ctx, models.QuotaScopeRole, string(models.RoleUser))
+		if err != nil {
+			t.Fatalf("Failed to get deleted quota override: %v", err)
+		}
+		if got != nil {
+			t.Error("Expected quota override to be deleted")
+		}
+	})
+
+	// Test group operations
+	t.Run("Group CRUD", func(t *testing.T) {
+		member := models.NewUser("group-member", nil)
+		member.ID = "group-member-id"
+		moderator := models.NewUser("group-moderator", nil)
+		moderator.ID = "group-moderator-id"
+		for _, user := range []*models.User{member, moderator} {
+			if err := client.CreateUser(ctx, user); err != nil {
+				t.Fatalf("Failed to create user: %v", err)
+			}
+		}
+
+		group := &models.Group{ID: "group-id", Name: "Robotics Lab", Description: "Robot parts"}
+		if err := client.CreateGroup(ctx, group); err != nil {
+			t.Fatalf("Failed to create group: %v", err)
+		}
+
+		group.Description = "Robot parts and enclosures"
+		if err := client.UpdateGroup(ctx, group); err != nil {
+			t.Fatalf("Failed to update group: %v", err)
+		}
+		got, err := client.GetGroup(ctx, group.ID)
+		if err != nil {
+			t.Fatalf("Failed to get group: %v", err)
+		}
+		if got == nil || got.Description != group.Description {
+			t.Fatalf("Expected updated group, got %+v", got)
+		}
+
+		// Add members, then promote one of them
+		for _, membership := range []*models.GroupMembership{
+			{GroupID: group.ID, UserID: member.ID, Role: models.GroupRoleMember},
+			{GroupID: group.ID, UserID: moderator.ID, Role: models.GroupRoleMember},
+			{GroupID: group.ID, UserID: moderator.ID, Role: models.GroupRoleModerator},
+		} {
+			if err := client.SetGroupMembership(ctx, membership); err != nil {
+				t.Fatalf("Failed to set group membership: %v", err)
+			}
+		}
+
+		members, err := client.ListGroupMembers(ctx, group.ID)
+		if err != nil {
+			t.Fatalf("Failed to list group members: %v", err)
+		}
+		if len(members) != 2 {
+			t.Fatalf("Expected 2 group members, got %d", len(members))
+		}
+
+		memberships, err := client.ListGroupMembershipsByUserID(ctx, moderator.ID)
+		if err != nil {
+			t.Fatalf("Failed to list group memberships: %v", err)
+		}
+		if len(memberships) != 1 || memberships[0].Role != models.GroupRoleModerator || memberships[0].GroupName != group.Name {
+			t.Errorf("Expected moderator membership of %q, got %+v", group.Name, memberships)
+		}
+
+		// Submit a request to the group
+		request := models.NewPrintRequest(member.ID, "https://example.com/gripper.stl", "")
+		request.ID = "group-print-request-id"
+		request.GroupID = &group.ID
+		if err := client.CreatePrintRequest(ctx, request); err != nil {
+			t.Fatalf("Failed to create print request: %v", err)
+		}
+		requests, err := client.ListPrintRequestsByGroupID(ctx, group.ID)
+		if err != nil {
+			t.Fatalf("Failed to list print requests by group: %v", err)
+		}
+		if len(requests) != 1 || requests[0].ID != request.ID {
+			t.Fatalf("Expected the group's print request, got %+v", requests)
+		}
+
+		if err := client.DeleteGroupMembership(ctx, group.ID, member.ID); err != nil {
+			t.Fatalf("Failed to delete group membership: %v", err)
+		}
+		memberships, err = client.ListGroupMembershipsByUserID(ctx, member.ID)
+		if err != nil {
+			t.Fatalf("Failed to list group memberships: %v", err)
+		}
+		if len(memberships) != 0 {
+			t.Errorf("Expected no memberships, got %d", len(memberships))
+		}
+
+		// Deleting the group keeps its requests
+		if err := client.DeleteGroup(ctx, group.ID); err != nil {
+			t.Fatalf("Failed to delete group: %v", err)
+		}
+		got, err = client.GetGroup(ctx, group.ID)
+		if err != nil {
+			t.Fatalf("Failed to get deleted group: %v", err)
+		}
+		if got != nil {
+			t.Error("Expected group to be deleted")
+		}
+		kept, err := client.GetPrintRequest(ctx, request.ID)
+		if err != nil {
+			t.Fatalf("Failed to get print request: %v", err)
+		}
+		if kept == nil || kept.GroupID != nil {
+			t.Errorf("Expected print request without a group, got %+v", kept)
+		}
+	})
+
+	// Test role operations
+	t.Run("Role CRUD", func(t *testing.T) {
+		roles, err := client.ListRoles(ctx)
+		if err != nil {
+			t.Fatalf("Failed to list roles: %v", err)
+		}
+		if len(roles) != 3 {
+			t.Fatalf("Expected the 3 built-in roles, got %d", len(roles))
+		}
+		for _, builtIn := range models.BuiltInRoles() {
+			var seeded *models.RoleDefinition
+			for _, role := range roles {
+				if role.Name == builtIn.Name {
+					seeded = role
+				}
+			}
+			if seeded == nil || !seeded.BuiltIn {
+				t.Fatalf("Expected built-in role %s, got %+v", builtIn.Name, seeded)
+			}
+			if len(seeded.Permissions) != len(builtIn.Permissions) {
+				t.Errorf("Expected role %s to be seeded with %v, got %v", builtIn.Name, builtIn.Permissions, seeded.Permissions)
+			}
+		}
+
+		operator := &models.RoleDefinition{
+			Name:        "operator",
+			Description: "Runs the printers",
+			Permissions: []models.Permission{models.PermissionManagePrintRequests, models.PermissionCreatePrintRequests},
+		}
+		if err := client.CreateRole(ctx, operator); err != nil {
+			t.Fatalf("Failed to create role: %v", err)
+		}
+
+		// Replace the role's permissions
+		operator.Permissions = []models.Permission{models.PermissionManagePrintRequests}
+		if err := client.UpdateRole(ctx, operator); err != nil {
+			t.Fatalf("Failed to update role: %v", err)
+		}
+		got, err := client.GetRole(ctx, "operator")
+		if err != nil {
+			t.Fatalf("Failed to get role: %v", err)
+		}
+		if got == nil || got.BuiltIn || len(got.Permissions) != 1 || got.Permissions[0] != models.PermissionManagePrintRequests {
+			t.Fatalf("Expected operator role with one permission, got %+v", got)
+		}
+
+		if err := client.DeleteRole(ctx, "operator"); err != nil {
+			t.Fatalf("Failed to delete role: %v", err)
+		}
+		got, err = client.GetRole(ctx, "operator")
+		if err != nil {
+			t.Fatalf("Failed to get deleted role: %v", err)
+		}
+		if got != nil {
+			t.Error("Expected role to be deleted")
+		}
+	})
+
+	t.Run("OIDC identities", func(t *testing.T) {
+		user := models.NewUser("oidc-user", nil)
+		user.ID = "oidc-user-id"
+		if err := client.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		identity := &models.UserOIDCIdentity{
+			ID:           "oidc-identity-1",
+			UserID:       user.ID,
+			ProviderName: "example",
+			Subject:      "subject-1",
+		}
+		if err := client.CreateOIDCIdentity(ctx, identity); err != nil {
+			t.Fatalf("Failed to create OIDC identity: %v", err)
+		}
+
+		got, err := client.GetOIDCIdentity(ctx, "example", "subject-1")
+		if err != nil {
+			t.Fatalf("Failed to get OIDC identity: %v", err)
+		}
+		if got == nil || got.UserID != user.ID {
+			t.Fatalf("Expected identity linked to %s, got %+v", user.ID, got)
+		}
+
+		// Subjects are only unique within a provider
+		got, err = client.GetOIDCIdentity(ctx, "other", "subject-1")
+		if err != nil {
+			t.Fatalf("Failed to get OIDC identity: %v", err)
+		}
+		if got != nil {
+			t.Errorf("Expected no identity for another provider, got %+v", got)
+		}
+
+		duplicate := *identity
+		duplicate.ID = "oidc-identity-2"
+		if err := client.CreateOIDCIdentity(ctx, &duplicate); err == nil {
+			t.Error("Expected linking the same identity twice to fail")
+		}
+	})
+
+	t.Run("LDAP identities", func(t *testing.T) {
+		user := models.NewUser("ldap-user", nil)
+		user.ID = "ldap-user-id"
+		if err := client.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		identity := &models.UserLDAPIdentity{
+			ID:           "ldap-identity-1",
+			UserID:       user.ID,
+			ProviderName: "campus",
+			Subject:      "alice",
+		}
+		if err := client.CreateLDAPIdentity(ctx, identity); err != nil {
+			t.Fatalf("Failed to create LDAP identity: %v", err)
+		}
+
+		got, err := client.GetLDAPIdentity(ctx, "campus", "alice")
+		if err != nil {
+			t.Fatalf("Failed to get LDAP identity: %v", err)
+		}
+		if got == nil || got.UserID != user.ID {
+			t.Fatalf("Expected identity linked to %s, got %+v", user.ID, got)
+		}
+
+		// LDAP identities are separate from OIDC identities with the same names
+		oidcIdentity, err := client.GetOIDCIdentity(ctx, "campus", "alice")
+		if err != nil {
+			t.Fatalf("Failed to get OIDC identity: %v", err)
+		}
+		if oidcIdentity != nil {
+			t.Errorf("Expected no OIDC identity, got %+v", oidcIdentity)
+		}
+
+		duplicate := *identity
+		duplicate.ID = "ldap-identity-2"
+		if err := client.CreateLDAPIdentity(ctx, &duplicate); err == nil {
+			t.Error("Expected linking the same identity twice to fail")
+		}
+	})
+
+	t.Run("API tokens", func(t *testing.T) {
+		user := models.NewUser("token-user", nil)
+		user.ID = "token-user-id"
+		if err := client.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		expiresAt := time.Now().Add(24 * time.Hour).Truncate(time.Second)
+		token := &models.APIToken{
+			ID:        "api-token-1",
+			UserID:    user.ID,
+			Name:      "slicer",
+			TokenHash: "hash-1",
+			Prefix:    "pdis_ABCDEF",
+			Scopes:    []models.Permission{models.PermissionCreatePrintRequests, models.PermissionViewOwnPrintRequests},
+			ExpiresAt: &expiresAt,
+		}
+		if err := client.CreateAPIToken(ctx, token); err != nil {
+			t.Fatalf("Failed to create API token: %v", err)
+		}
+
+		got, err := client.GetAPITokenByHash(ctx, "hash-1")
+		if err != nil {
+			t.Fatalf("Failed to get API token: %v", err)
+		}
+		if got == nil || got.UserID != user.ID || got.Name != "slicer" || got.LastUsedAt != nil {
+			t.Fatalf("Unexpected API token %+v", got)
+		}
+		if len(got.Scopes) != 2 || !got.HasScope(models.PermissionCreatePrintRequests) {
+			t.Errorf("Expected scopes to round-trip, got %v", got.Scopes)
+		}
+		if got.ExpiresAt == nil || !got.ExpiresAt.Equal(expiresAt) {
+			t.Errorf("Expected expiry %v, got %v", expiresAt, got.ExpiresAt)
+		}
+
+		if got, err := client.GetAPITokenByHash(ctx, "missing"); err != nil || got != nil {
+			t.Errorf("Expected no token for unknown hash, got %+v, %v", got, err)
+		}
+
+		lastUsed := time.Now().Truncate(time.Second)
+		if err := client.UpdateAPITokenLastUsed(ctx, token.ID, lastUsed); err != nil {
+			t.Fatalf("Failed to update API token: %v", err)
+		}
+		tokens, err := client.ListAPITokensByUserID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Failed to list API tokens: %v", err)
+		}
+		if len(tokens) != 1 || tokens[0].LastUsedAt == nil || !tokens[0].LastUsedAt.Equal(lastUsed) {
+			t.Fatalf("Expected one token used at %v, got %+v", lastUsed, tokens)
+		}
+
+		if err := client.DeleteAPIToken(ctx, token.ID); err != nil {
+			t.Fatalf("Failed to delete API token: %v", err)
+		}
+		if tokens, _ := client.ListAPITokensByUserID(ctx, user.ID); len(tokens) != 0 {
+			t.Errorf("Expected token to be deleted, got %+v", tokens)
+		}
+
+		// All of a user's tokens are deleted together
+		for _, id := range []string{"api-token-2", "api-token-3"} {
+			if err := client.CreateAPIToken(ctx, &models.APIToken{ID: id, UserID: user.ID, Name: id, TokenHash: id, Prefix: "pdis_" + id}); err != nil {
+				t.Fatalf("Failed to create API token: %v", err)
+			}
+		}
+		if err := client.DeleteAPITokensByUserID(ctx, user.ID); err != nil {
+			t.Fatalf("Failed to delete API tokens: %v", err)
+		}
+		if tokens, _ := client.ListAPITokensByUserID(ctx, user.ID); len(tokens) != 0 {
+			t.Errorf("Expected all tokens to be deleted, got %+v", tokens)
+		}
+	})
+
+	t.Run("User sessions", func(t *testing.T) {
+		user := models.NewUser("session-user", nil)
+		user.ID = "session-user-id"
+		if err := client.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		now := time.Now().Truncate(time.Second)
+		newSession := func(id, token, userID string, expiresAt time.Time) *models.UserSession {
+			session := &models.UserSession{
+				ID:           id,
+				UserID:       userID,
+				SessionToken: token,
+				Data:         "data-" + id,
+				UserAgent:    "test-agent",
+				IPAddress:    "192.0.2.1",
+				ExpiresAt:    expiresAt,
+				CreatedAt:    now,
+				LastSeenAt:   now,
+			}
+			if err := client.CreateUserSession(ctx, session); err != nil {
+				t.Fatalf("Failed to create session %s: %v", id, err)
+			}
+			return session
+		}
+
+		// Sessions can exist before anyone logs in
+		anonymous := newSession("session-anon", "token-anon", "", now.Add(time.Hour))
+		got, err := client.GetUserSessionByToken(ctx, "token-anon")
+		if err != nil {
+			t.Fatalf("Failed to get session: %v", err)
+		}
+		if got == nil || got.UserID != "" || got.Data != "data-session-anon" {
+			t.Fatalf("Unexpected session %+v", got)
+		}
+		if got, err := client.GetUserSessionByToken(ctx, "missing"); err != nil || got != nil {
+			t.Errorf("Expected no session for unknown token, got %+v, %v", got, err)
+		}
+
+		// Logging in attaches the session to the user
+		anonymous.UserID = user.ID
+		anonymous.Data = "logged-in"
+		if err := client.UpdateUserSession(ctx, anonymous); err != nil {
+			t.Fatalf("Failed to update session: %v", err)
+		}
+		newSession("session-2", "token-2", user.ID, now.Add(time.Hour))
+		newSession("session-expired", "token-expired", user.ID, now.Add(-time.Hour))
+
+		lastSeen := now.Add(time.Minute)
+		if err := client.TouchUserSession(ctx, "session-2", lastSeen, "198.51.100.7"); err != nil {
+			t.Fatalf("Failed to touch session: %v", err)
+		}
+
+		sessions, err := client.ListUserSessionsByUserID(ctx, user.ID, now)
+		if err != nil {
+			t.Fatalf("Failed to list sessions: %v", err)
+		}
+		if len(sessions) != 2 || sessions[0].ID != "session-2" || sessions[1].ID != "session-anon" {
+			t.Fatalf("Expected two unexpired sessions, most recent first, got %+v", sessions)
+		}
+		if !sessions[0].LastSeenAt.Equal(lastSeen) || sessions[0].IPAddress != "198.51.100.7" {
+			t.Errorf("Expected session activity to be recorded, got %+v", sessions[0])
+		}
+		if sessions[1].Data != "logged-in" {
+			t.Errorf("Expected session data to be updated, got %q", sessions[1].Data)
+		}
+
+		deleted, err := client.DeleteExpiredUserSessions(ctx, now)
+		if err != nil {
+			t.Fatalf("Failed to delete expired sessions: %v", err)
+		}
+		if deleted != 1 {
+			t.Errorf("Expected one expired session to be deleted, got %d", deleted)
+		}
+
+		if err := client.DeleteUserSessionsByUserID(ctx, user.ID, "session-2"); err != nil {
+			t.Fatalf("Failed to delete other sessions: %v", err)
+		}
+		if sessions, _ := client.ListUserSessionsByUserID(ctx, user.ID, now); len(sessions) != 1 || sessions[0].ID != "session-2" {
+			t.Errorf("Expected only the kept session, got %+v", sessions)
+		}
+
+		if err := client.DeleteUserSession(ctx, "session-2"); err != nil {
+			t.Fatalf("Failed to delete session: %v", err)
+		}
+		if got, _ := client.GetUserSessionByToken(ctx, "token-2"); got != nil {
+			t.Errorf("Expected session to be deleted, got %+v", got)
+		}
+	})
+
+	t.Run("Two-factor authentication", func(t *testing.T) {
+		user := models.NewUser("totp-user", nil)
+		user.ID = "totp-user-id"
+		if err := client.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		if got, err := client.GetUserTOTP(ctx, user.ID); err != nil || got != nil {
+			t.Fatalf("Expected no enrolment, got %+v, %v", got, err)
+		}
+
+		now := time.Now().Truncate(time.Second)
+		enrolment := &models.UserTOTP{UserID: user.ID, Secret: "FIRST", CreatedAt: now}
+		if err := client.SaveUserTOTP(ctx, enrolment); err != nil {
+			t.Fatalf("Failed to save enrolment: %v", err)
+		}
+
+		// Saving again replaces the enrolment
+		enrolment.Secret = "SECOND"
+		enrolment.Enabled = true
+		enrolment.EnabledAt = &now
+		enrolment.LastCounter = 100
+		if err := client.SaveUserTOTP(ctx, enrolment); err != nil {
+			t.Fatalf("Failed to update enrolment: %v", err)
+		}
+		got, err := client.GetUserTOTP(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Failed to get enrolment: %v", err)
+		}
+		if got == nil || got.Secret != "SECOND" || !got.Enabled || got.LastCounter != 100 || got.EnabledAt == nil {
+			t.Fatalf("Unexpected enrolment %+v", got)
+		}
+
+		// The counter only moves forwards
+		if advanced, err := client.UpdateUserTOTPCounter(ctx, user.ID, 100); err != nil || advanced {
+			t.Errorf("Expected reused time step to be refused, got %v, %v", advanced, err)
+		}
+		if advanced, err := client.UpdateUserTOTPCounter(ctx, user.ID, 101); err != nil || !advanced {
+			t.Errorf("Expected later time step to be accepted, got %v, %v", advanced, err)
+		}
+
+		codes := []*models.RecoveryCode{
+			{ID: "recovery-1", CodeHash: "hash-a", CreatedAt: now},
+			{ID: "recovery-2", CodeHash: "hash-b", CreatedAt: now},
+		}
+		if err := client.ReplaceRecoveryCodes(ctx, user.ID, codes); err != nil {
+			t.Fatalf("Failed to create recovery codes: %v", err)
+		}
+		if used, err := client.UseRecoveryCode(ctx, user.ID, "hash-a", now); err != nil || !used {
+			t.Errorf("Expected recovery code to be used, got %v, %v", used, err)
+		}
+		if used, _ := client.UseRecoveryCode(ctx, user.ID, "hash-a", now); used {
+			t.Error("Expected recovery code to only work once")
+		}
+		if count, err := client.CountUnusedRecoveryCodes(ctx, user.ID); err != nil || count != 1 {
+			t.Errorf("Expected one unused recovery code, got %d, %v", count, err)
+		}
+
+		// Replacing the codes invalidates the old ones
+		if err := client.ReplaceRecoveryCodes(ctx, user.ID, []*models.RecoveryCode{{ID: "recovery-3", CodeHash: "hash-c", CreatedAt: now}}); err != nil {
+			t.Fatalf("Failed to replace recovery codes: %v", err)
+		}
+		if used, _ := client.UseRecoveryCode(ctx, user.ID, "hash-b", now); used {
+			t.Error("Expected replaced recovery code to be refused")
+		}
+
+		if err := client.DeleteUserTOTP(ctx, user.ID); err != nil {
+			t.Fatalf("Failed to delete enrolment: %v", err)
+		}
+		if got, _ := client.GetUserTOTP(ctx, user.ID); got != nil {
+			t.Errorf("Expected enrolment to be deleted, got %+v", got)
+		}
+		if count, _ := client.CountUnusedRecoveryCodes(ctx, user.ID); count != 0 {
+			t.Errorf("Expected recovery codes to be deleted, got %d", count)
+		}
+	})
+
+	t.Run("WebAuthn credentials", func(t *testing.T) {
+		user := models.NewUser("passkey-user", nil)
+		user.ID = "passkey-user-id"
+		if err := client.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		credential := &models.WebAuthnCredential{
+			ID:           "webauthn-1",
+			UserID:       user.ID,
+			Name:         "YubiKey",
+			CredentialID: "Y3JlZGVudGlhbC0x",
+			PublicKey:    []byte{0xa5, 0x01, 0x02},
+		}
+		if err := client.CreateWebAuthnCredential(ctx, credential); err != nil {
+			t.Fatalf("Failed to create credential: %v", err)
+		}
+
+		// Credential IDs are unique across users
+		duplicate := *credential
+		duplicate.ID = "webauthn-2"
+		if err := client.CreateWebAuthnCredential(ctx, &duplicate); err == nil {
+			t.Error("Expected duplicate credential ID to be refused")
+		}
+
+		got, err := client.GetWebAuthnCredential(ctx, credential.CredentialID)
+		if err != nil {
+			t.Fatalf("Failed to get credential: %v", err)
+		}
+		if got == nil || got.UserID != user.ID || string(got.PublicKey) != string(credential.PublicKey) {
+			t.Fatalf("Unexpected credential %+v", got)
+		}
+		if got, err := client.GetWebAuthnCredential(ctx, "missing"); err != nil || got != nil {
+			t.Errorf("Expected no credential, got %+v, %v", got, err)
+		}
+
+		now := time.Now().Truncate(time.Second)
+		if err := client.UpdateWebAuthnCredentialUsage(ctx, credential.ID, 7, now); err != nil {
+			t.Fatalf("Failed to update credential: %v", err)
+		}
+		credentials, err := client.ListWebAuthnCredentialsByUserID(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Failed to list credentials: %v", err)
+		}
+		if len(credentials) != 1 || credentials[0].SignCount != 7 || credentials[0].LastUsedAt == nil {
+			t.Fatalf("Unexpected credentials %+v", credentials)
+		}
+
+		if err := client.DeleteWebAuthnCredential(ctx, credential.ID); err != nil {
+			t.Fatalf("Failed to delete credential: %v", err)
+		}
+		if credentials, _ := client.ListWebAuthnCredentialsByUserID(ctx, user.ID); len(credentials) != 0 {
+			t.Errorf("Expected credential to be deleted, got %+v", credentials)
+		}
+	})
+
+	t.Run("Email tokens", func(t *testing.T) {
+		email := "reset@example.com"
+		user := models.NewUser("reset-user", &email)
+		user.ID = "reset-user-id"
+		if err := client.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		now := time.Now()
+		newToken := func(id, hash string, expiresAt time.Time) *models.EmailToken {
+			token := &models.EmailToken{
+				ID:        id,
+				UserID:    user.ID,
+				Purpose:   models.EmailTokenPasswordReset,
+				TokenHash: hash,
+				Email:     email,
+				ExpiresAt: expiresAt,
+			}
+			if err := client.CreateEmailToken(ctx, token); err != nil {
+				t.Fatalf("Failed to create token: %v", err)
+			}
+			return token
+		}
+		newToken("email-token-1", "hash-1", now.Add(time.Hour))
+		newToken("email-token-2", "hash-2", now.Add(-time.Minute))
+		newToken("email-token-3", "hash-3", now.Add(time.Hour))
+
+		// Tokens are only usable for their purpose
+		if got, err := client.UseEmailToken(ctx, models.EmailTokenVerifyEmail, "hash-1", now); err != nil || got != nil {
+			t.Errorf("Expected token for another purpose to be refused, got %+v, %v", got, err)
+		}
+		got, err := client.UseEmailToken(ctx, models.EmailTokenPasswordReset, "hash-1", now)
+		if err != nil {
+			t.Fatalf("Failed to use token: %v", err)
+		}
+		if got == nil || got.UserID != user.ID || got.Email != email || got.UsedAt == nil {
+			t.Fatalf("Unexpected token %+v", got)
+		}
+		// Tokens can only be used once, and not once they have expired
+		if got, err := client.UseEmailToken(ctx, models.EmailTokenPasswordReset, "hash-1", now); err != nil || got != nil {
+			t.Errorf("Expected used token to be refused, got %+v, %v", got, err)
+		}
+		if got, err := client.UseEmailToken(ctx, models.EmailTokenPasswordReset, "hash-2", now); err != nil || got != nil {
+			t.Errorf("Expected expired token to be refused, got %+v, %v", got, err)
+		}
+
+		if err := client.DeleteEmailTokensByUserID(ctx, user.ID, models.EmailTokenPasswordReset); err != nil {
+			t.Fatalf("Failed to delete tokens: %v", err)
+		}
+		if got, err := client.UseEmailToken(ctx, models.EmailTokenPasswordReset, "hash-3", now); err != nil || got != nil {
+			t.Errorf("Expected deleted token to be refused, got %+v, %v", got, err)
+		}
+	})
+
+	t.Run("Email verification", func(t *testing.T) {
+		email := "verify@example.com"
+		user := models.NewUser("verify-user", &email)
+		user.ID = "verify-user-id"
+		if err := client.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		if got, _ := client.GetUser(ctx, user.ID); got == nil || got.EmailVerifiedAt != nil {
+			t.Fatalf("Expected new user to be unverified, got %+v", got)
+		}
+
+		verifiedAt := time.Now().Truncate(time.Second)
+		user.EmailVerifiedAt = &verifiedAt
+		if err := client.UpdateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to update user: %v", err)
+		}
+		got, err := client.GetUserByEmail(ctx, email)
+		if err != nil {
+			t.Fatalf("Failed to get user: %v", err)
+		}
+		if got == nil || got.EmailVerifiedAt == nil || !got.EmailVerifiedAt.Equal(verifiedAt) {
+			t.Errorf("Expected email to be verified at %v, got %+v", verifiedAt, got)
+		}
+	})
+
+	t.Run("Deleting users", func(t *testing.T) {
+		// Deleted users' print requests can be anonymised by moving them to a
+		// placeholder that cannot log in
+		placeholder, err := client.GetUser(ctx, models.DeletedUserID)
+		if err != nil {
+			t.Fatalf("Failed to get placeholder user: %v", err)
+		}
+		if placeholder == nil || placeholder.Enabled || placeholder.HasPassword() {
+			t.Fatalf("Expected a disabled placeholder without a password, got %+v", placeholder)
+		}
+
+		leaving := models.NewUser("leaving-user", nil)
+		leaving.ID = "leaving-user-id"
+		leaving.MustChangePassword = true
+		heir := models.NewUser("heir-user", nil)
+		heir.ID = "heir-user-id"
+		for _, user := range []*models.User{leaving, heir} {
+			if err := client.CreateUser(ctx, user); err != nil {
+				t.Fatalf("Failed to create user: %v", err)
+			}
+		}
+		if got, _ := client.GetUser(ctx, leaving.ID); got == nil || !got.MustChangePassword {
+			t.Errorf("Expected user to have to change their password, got %+v", got)
+		}
+
+		request := models.NewPrintRequest(leaving.ID, "https://example.com/leaving.stl", "")
+		request.ID = "leaving-request-id"
+		if err := client.CreatePrintRequest(ctx, request); err != nil {
+			t.Fatalf("Failed to create print request: %v", err)
+		}
+		if err := client.CreateCharge(ctx, &models.Charge{UserID: leaving.ID, PrintRequestID: &request.ID, Amount: 250}); err != nil {
+			t.Fatalf("Failed to create charge: %v", err)
+		}
+		now := time.Now()
+		if err := client.CreateUserSession(ctx, &models.UserSession{
+			ID: "leaving-session", UserID: leaving.ID, SessionToken: "leaving-token", ExpiresAt: now.Add(time.Hour), CreatedAt: now, LastSeenAt: now,
+		}); err != nil {
+			t.Fatalf("Failed to create session: %v", err)
+		}
+
+		tx, err := client.BeginTx(ctx)
+		if err != nil {
+			t.Fatalf("Failed to begin transaction: %v", err)
+		}
+		moved, err := tx.ReassignUserRecords(ctx, leaving.ID, heir.ID)
+		if err != nil || moved != 1 {
+			t.Fatalf("Expected 1 print request to be reassigned, got %d, %v", moved, err)
+		}
+		if err := tx.DeleteUser(ctx, leaving.ID); err != nil {
+			t.Fatalf("Failed to delete user: %v", err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatalf("Failed to commit: %v", err)
+		}
+
+		if got, _ := client.GetUser(ctx, leaving.ID); got != nil {
+			t.Errorf("Expected user to be deleted, got %+v", got)
+		}
+		if got, _ := client.GetPrintRequest(ctx, request.ID); got == nil || got.UserID != heir.ID {
+			t.Errorf("Expected print request to belong to %s, got %+v", heir.ID, got)
+		}
+		if charges, _ := client.ListChargesByUserID(ctx, heir.ID); len(charges) != 1 {
+			t.Errorf("Expected the charge to be reassigned, got %+v", charges)
+		}
+		if session, _ := client.GetUserSessionByToken(ctx, "leaving-token"); session != nil {
+			t.Errorf("Expected the user's session to be deleted, got %+v", session)
+		}
+	})
+
+	t.Run("Audit events", func(t *testing.T) {
+		adminID := "audit-admin-id"
+		start := time.Now().Add(-time.Hour).Truncate(time.Second)
+		events := []*models.AuditEvent{
+			{ID: "audit-1", ActorName: "mallory", Action: models.AuditLoginFailed, TargetType: models.AuditTargetUser, IPAddress: "192.0.2.1", CreatedAt: start},
+			{ID: "audit-2", ActorID: &adminID, ActorName: "audit-admin", Action: models.AuditUserRoleChanged, TargetType: models.AuditTargetUser, TargetID: "audit-user-id",
+				Changes: models.AuditChanges{"role": {Before: "user", After: "moderator"}}, UserAgent: "test", CreatedAt: start.Add(time.Minute)},
+			{ID: "audit-3", ActorID: &adminID, ActorName: "audit-admin", Action: models.AuditUserStatusChanged, TargetType: models.AuditTargetUser, TargetID: "audit-user-id",
+				CreatedAt: start.Add(2 * time.Minute)},
+		}
+		for _, event := range events {
+			if err := client.CreateAuditEvent(ctx, event); err != nil {
+				t.Fatalf("Failed to create audit event: %v", err)
+			}
+		}
+
+		// Newest first, paginated, with the total for the filter
+		got, total, err := client.ListAuditEvents(ctx, models.AuditEventFilter{Actor: adminID, Limit: 1})
+		if err != nil || total != 2 || len(got) != 1 || got[0].ID != "audit-3" {
+			t.Fatalf("Expected the newest of 2 events, got %+v, %d, %v", got, total, err)
+		}
+		got, _, err = client.ListAuditEvents(ctx, models.AuditEventFilter{Actor: adminID, Limit: 1, Offset: 1})
+		if err != nil || len(got) != 1 || got[0].ID != "audit-2" {
+			t.Fatalf("Expected the second event, got %+v, %v", got, err)
+		}
+		if change := got[0].Changes["role"]; change.Before != "user" || change.After != "moderator" {
+			t.Errorf("Expected role change to be stored, got %+v", got[0].Changes)
+		}
+
+		for name, tt := range map[string]struct {
+			filter   models.AuditEventFilter
+			expected int
+		}{
+			"actor name": {models.AuditEventFilter{Actor: "mallory"}, 1},
+			"action":     {models.AuditEventFilter{Action: models.AuditUserRoleChanged}, 1},
+			"target":     {models.AuditEventFilter{TargetType: models.AuditTargetUser, TargetID: "audit-user-id"}, 2},
+			"since":      {models.AuditEventFilter{Actor: adminID, Since: &events[2].CreatedAt}, 1},
+			"until":      {models.AuditEventFilter{Actor: adminID, Until: &events[2].CreatedAt}, 1},
+		} {
+			got, total, err := client.ListAuditEvents(ctx, tt.filter)
+			if err != nil || total != tt.expected || len(got) != tt.expected {
+				t.Errorf("%s: expected %d events, got %d (%d total), %v", name, tt.expected, len(got), total, err)
+			}
+		}
+	})
+
+	t.Run("Print request analytics", func(t *testing.T) {
+		// Two weeks in 2001, so that print requests from other tests are not
+		// counted. Times are stored in a zone other than UTC, since buckets are
+		// UTC dates.
+		eastern := time.FixedZone("EST", -5*60*60)
+		at := func(day, hour int) time.Time {
+			return time.Date(2001, time.March, day, hour, 0, 0, 0, time.UTC).In(eastern)
+		}
+		r := models.AnalyticsRange{From: at(5, 0), To: at(19, 0)}
+
+		for _, username := range []string{"ana", "bo"} {
+			user := models.NewUser("analytics-"+username, nil)
+			user.ID = "analytics-" + username + "-id"
+			if err := client.CreateUser(ctx, user); err != nil {
+				t.Fatalf("Failed to create user: %v", err)
+			}
+		}
+		printer := &models.Printer{Name: "Analytics Printer", Url: "http://localhost:8080"}
+		if err := client.CreatePrinter(ctx, printer); err != nil {
+			t.Fatalf("Failed to create printer: %v", err)
+		}
+
+		pla, red := "PLA", "red"
+		actualGrams, actualHours, estimatedGrams, estimatedHours := 50.0, 3.0, 30.0, 2.0
+		type change struct {
+			to models.PrintRequestStatus
+			at time.Time
+		}
+		for _, tt := range []struct {
+			id, userID string
+			created    time.Time
+			changes    []change
+		}{
+			// Approved in 2 hours and done a day later
+			{"analytics-a", "analytics-ana-id", at(5, 10), []change{
+				{models.StatusEnqueued, at(5, 12)}, {models.StatusInProgress, at(6, 9)}, {models.StatusDone, at(6, 12)},
+			}},
+			// Submitted late on the 6th in New York, which is the 7th in UTC
+			{"analytics-b", "analytics-ana-id", at(7, 4), []change{
+				{models.StatusEnqueued, at(7, 8)}, {models.StatusInProgress, at(11, 8)}, {models.StatusDone, at(12, 8)},
+			}},
+			{"analytics-c", "analytics-bo-id", at(12, 9), nil},
+			// Submitted before the range, and approved in it
+			{"analytics-d", "analytics-bo-id", time.Date(2001, time.February, 1, 0, 0, 0, 0, time.UTC), []change{
+				{models.StatusEnqueued, at(5, 1)},
+			}},
+		} {
+			request := models.NewPrintRequest(tt.userID, "https://example.com/model.stl", "")
+			request.ID = tt.id
+			request.CreatedAt = tt.created
+			request.Material, request.Color, request.PrinterID = &pla, &red, &printer.Id
+			if tt.id == "analytics-a" {
+				request.ActualGrams, request.ActualHours = &actualGrams, &actualHours
+			} else {
+				request.EstimatedGrams, request.EstimatedHours = &estimatedGrams, &estimatedHours
+			}
+			if len(tt.changes) > 0 {
+				request.Status = tt.changes[len(tt.changes)-1].to
+			}
+			if err := client.CreatePrintRequest(ctx, request); err != nil {
+				t.Fatalf("Failed to create print request: %v", err)
+			}
+
+			tx, err := client.BeginTx(ctx)
+			if err != nil {
+				t.Fatalf("Failed to begin transaction: %v", err)
+			}
+			from := models.StatusPendingApproval
+			for _, c := range tt.changes {
+				event := &models.PrintRequestStatusEvent{PrintRequestID: tt.id, FromStatus: &from, ToStatus: c.to, CreatedAt: c.at}
+				if err := tx.CreatePrintRequestStatusEvent(ctx, event); err != nil {
+					t.Fatalf("Failed to create status event: %v", err)
+				}
+				from = c.to
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("Failed to commit: %v", err)
+			}
+		}
+
+		countsOf := func(bucket models.AnalyticsBucket) map[string]int {
+			t.Helper()
+			counts, err := client.CountPrintRequestStatuses(ctx, r, bucket)
+			if err != nil {
+				t.Fatalf("Failed to count statuses: %v", err)
+			}
+			got := make(map[string]int)
+			for _, c := range counts {
+				got[c.Bucket+" "+c.Status.String()] = c.Count
+			}
+			return got
+		}
+		expected := map[string]int{
+			"2001-03-05 StatusPendingApproval": 1, "2001-03-05 StatusEnqueued": 2,
+			"2001-03-06 StatusInProgress": 1, "2001-03-06 StatusDone": 1,
+			"2001-03-07 StatusPendingApproval": 1, "2001-03-07 StatusEnqueued": 1,
+			"2001-03-11 StatusInProgress":      1,
+			"2001-03-12 StatusPendingApproval": 1, "2001-03-12 StatusDone": 1,
+		}
+		if got := countsOf(models.AnalyticsBucketDay); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected daily counts %v, got %v", expected, got)
+		}
+		expected = map[string]int{
+			"2001-03-05 StatusPendingApproval": 2, "2001-03-05 StatusEnqueued": 3, "2001-03-05 StatusInProgress": 2, "2001-03-05 StatusDone": 1,
+			"2001-03-12 StatusPendingApproval": 1, "2001-03-12 StatusDone": 1,
+		}
+		if got := countsOf(models.AnalyticsBucketWeek); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected weekly counts %v, got %v", expected, got)
+		}
+
+		turnarounds, err := client.ListTurnarounds(ctx, r)
+		if err != nil {
+			t.Fatalf("Failed to list turnarounds: %v", err)
+		}
+		var approvals, completions []int
+		for _, turnaround := range turnarounds {
+			if turnaround.ApprovalSeconds != nil {
+				approvals = append(approvals, int(math.Round(*turnaround.ApprovalSeconds/3600)))
+			}
+			if turnaround.CompletionSeconds != nil {
+				completions = append(completions, int(math.Round(*turnaround.CompletionSeconds/3600)))
+			}
+		}
+		sort.Ints(approvals)
+		sort.Ints(completions)
+		if !reflect.DeepEqual(approvals, []int{2, 4, 769}) || !reflect.DeepEqual(completions, []int{24, 120}) {
+			t.Errorf("Expected approvals after 2, 4 and 769 hours and completions after 24 and 120, got %v and %v", approvals, completions)
+		}
+
+		materials, err := client.SumMaterialUsage(ctx, r)
+		if err != nil || len(materials) != 1 {
+			t.Fatalf("Expected usage of one material, got %+v, %v", materials, err)
+		}
+		if m := materials[0]; m.Material != "PLA" || m.Color != "red" || m.Requests != 2 || m.Grams != 80 {
+			t.Errorf("Expected 80g of red PLA over 2 requests, got %+v", m)
+		}
+
+		printers, err := client.SumPrinterUsage(ctx, r)
+		if err != nil {
+			t.Fatalf("Failed to sum printer usage: %v", err)
+		}
+		for _, p := range printers {
+			if p.PrinterID == printer.Id && (p.Requests != 2 || p.Hours != 5) {
+				t.Errorf("Expected 5 hours over 2 requests, got %+v", p)
+			} else if p.PrinterID != printer.Id && p.Requests != 0 {
+				t.Errorf("Expected other printers to be unused, got %+v", p)
+			}
+		}
+
+		requesters, err := client.ListTopRequesters(ctx, r, 1)
+		if err != nil || len(requesters) != 1 {
+			t.Fatalf("Expected the top requester, got %+v, %v", requesters, err)
+		}
+		if top := requesters[0]; top.Username != "analytics-ana" || top.Requests != 2 || top.Completed != 2 || top.Grams != 80 {
+			t.Errorf("Expected ana to have completed 2 requests using 80g, got %+v", top)
+		}
+
+		// Deleting a request deletes its status history
+		if err := client.DeletePrintRequest(ctx, "analytics-b"); err != nil {
+			t.Fatalf("Failed to delete print request: %v", err)
+		}
+		if turnarounds, err := client.ListTurnarounds(ctx, r); err != nil || len(turnarounds) != 2 {
+			t.Errorf("Expected 2 turnarounds after deleting a request, got %d, %v", len(turnarounds), err)
+		}
+	})
+
+	t.Run("User print stats", func(t *testing.T) {
+		user := models.NewUser("stats-user", nil)
+		user.ID = "stats-user-id"
+		if err := client.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+
+		day := func(month time.Month, day int) time.Time {
+			return time.Date(2001, month, day, 12, 0, 0, 0, time.UTC)
+		}
+		actualGrams, actualCost, estimatedGrams, estimatedCost := 20.0, 1.5, 10.0, 0.5
+		for _, tt := range []struct {
+			id      string
+			created time.Time
+			done    time.Time
+		}{
+			// Submitted in April and done 22 days later, in May
+			{"stats-a", day(time.April, 10), day(time.May, 2)},
+			{"stats-b", day(time.May, 20), day(time.May, 21)},
+			{"stats-c", day(time.May, 25), time.Time{}},
+		} {
+			request := models.NewPrintRequest(user.ID, "https://example.com/model.stl", "")
+			request.ID = tt.id
+			request.CreatedAt = tt.created
+			if tt.id == "stats-a" {
+				request.ActualGrams, request.ActualCost = &actualGrams, &actualCost
+			} else {
+				request.EstimatedGrams, request.EstimatedCost = &estimatedGrams, &estimatedCost
+			}
+			if tt.done.IsZero() {
+				if err := client.CreatePrintRequest(ctx, request); err != nil {
+					t.Fatalf("Failed to create print request: %v", err)
+				}
+				continue
+			}
+			request.Status = models.StatusDone
+			if err := client.CreatePrintRequest(ctx, request); err != nil {
+				t.Fatalf("Failed to create print request: %v", err)
+			}
+			tx, err := client.BeginTx(ctx)
+			if err != nil {
+				t.Fatalf("Failed to begin transaction: %v", err)
+			}
+			if err := tx.CreatePrintRequestStatusEvent(ctx, &models.PrintRequestStatusEvent{PrintRequestID: tt.id, ToStatus: models.StatusDone, CreatedAt: tt.done}); err != nil {
+				t.Fatalf("Failed to create status event: %v", err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("Failed to commit: %v", err)
+			}
+		}
+
+		totals, err := client.GetUserPrintTotals(ctx, user.ID)
+		if err != nil {
+			t.Fatalf("Failed to get user print totals: %v", err)
+		}
+		if totals.Pending != 1 || totals.Enqueued != 0 || totals.InProgress != 0 || totals.Done != 2 || totals.Grams != 30 || totals.Spend != 2 {
+			t.Errorf("Expected 1 pending and 2 done using 30g for 2.00, got %+v", totals)
+		}
+		if totals.AverageTurnaroundSeconds == nil || math.Round(*totals.AverageTurnaroundSeconds) != 11.5*24*60*60 {
+			t.Errorf("Expected an average turnaround of 11.5 days, got %v", totals.AverageTurnaroundSeconds)
+		}
+
+		totals, err = client.GetUserPrintTotals(ctx, "no-such-user")
+		if err != nil || totals.Done != 0 || totals.Grams != 0 || totals.AverageTurnaroundSeconds != nil {
+			t.Errorf("Expected nothing for an unknown user, got %+v, %v", totals, err)
+		}
+
+		history, err := client.ListUserMonthlyHistory(ctx, user.ID, time.Date(2001, time.April, 1, 0, 0, 0, 0, time.UTC))
+		if err != nil {
+			t.Fatalf("Failed to list monthly history: %v", err)
+		}
+		expected := []*models.UserMonthStats{
+			{Month: "2001-04", Submitted: 1},
+			{Month: "2001-05", Submitted: 2, Completed: 2, Grams: 30, Spend: 2},
+		}
+		if !reflect.DeepEqual(history, expected) {
+			t.Errorf("Expected history %+v, got %+v", expected, history)
+		}
+
+		history, err = client.ListUserMonthlyHistory(ctx, user.ID, time.Date(2001, time.May, 3, 0, 0, 0, 0, time.UTC))
+		if err != nil || len(history) != 1 || history[0].Submitted != 2 || history[0].Completed != 1 {
+			t.Errorf("Expected 2 submitted and 1 completed since May 3rd, got %+v, %v", history, err)
+		}
+	})
+
+	t.Run("Login attempts", func(t *testing.T) {
+		now := time.Now()
+		window := 15 * time.Minute
+
+		if attempts, err := client.GetLoginAttempts(ctx, "guessed"); err != nil || attempts != nil {
+			t.Fatalf("Expected no login attempts, got %+v, %v", attempts, err)
+		}
+		for i := 1; i <= 3; i++ {
+			attempts, err := client.RecordLoginFailure(ctx, "guessed", now, now.Add(-window))
+			if err != nil {
+				t.Fatalf("Failed to record login failure: %v", err)
+			}
+			if attempts.FailedCount != i || attempts.IsLocked(now) {
+				t.Errorf("Expected %d unlocked failures, got %+v", i, attempts)
+			}
+		}
+
+		// Only the first lock counts until it expires
+		until := now.Add(window)
+		if locked, err := client.LockLogin(ctx, "guessed", until, now); err != nil || !locked {
+			t.Errorf("Expected to lock login, got %v, %v", locked, err)
+		}
+		if locked, err := client.LockLogin(ctx, "guessed", until.Add(time.Minute), now); err != nil || locked {
+			t.Errorf("Expected login to be locked already, got %v, %v", locked, err)
+		}
+		attempts, err := client.GetLoginAttempts(ctx, "guessed")
+		if err != nil || attempts == nil || !attempts.IsLocked(now) || attempts.IsLocked(until) {
+			t.Errorf("Expected login to be locked until %v, got %+v, %v", until, attempts, err)
+		}
+
+		// Failures long after the last one start counting again
+		later := now.Add(window + time.Minute)
+		attempts, err = client.RecordLoginFailure(ctx, "guessed", later, later.Add(-window))
+		if err != nil || attempts.FailedCount != 1 || attempts.LockedUntil != nil {
+			t.Errorf("Expected count to start again, got %+v, %v", attempts, err)
+		}
+
+		if _, err := client.RecordLoginFailure(ctx, "forgotten", now, now.Add(-window)); err != nil {
+			t.Fatalf("Failed to record login failure: %v", err)
+		}
+		if deleted, err := client.DeleteStaleLoginAttempts(ctx, now.Add(time.Second)); err != nil || deleted != 1 {
+			t.Errorf("Expected to delete 1 stale username, got %d, %v", deleted, err)
+		}
+		if err := client.DeleteLoginAttempts(ctx, "guessed"); err != nil {
+			t.Fatalf("Failed to delete login attempts: %v", err)
+		}
+		if attempts, _ := client.GetLoginAttempts(ctx, "guessed"); attempts != nil {
+			t.Errorf("Expected login attempts to be deleted, got %+v", attempts)
+		}
+	})
+
+	t.Run("Invitations", func(t *testing.T) {
+		now := time.Now()
+		expired := now.Add(-time.Minute)
+		invitations := []*models.Invitation{
+			{ID: "inv-open", CodeHash: "open-hash", Prefix: "OPEN12", Role: models.RoleUser, MaxUses: 2},
+			{ID: "inv-expired", CodeHash: "expired-hash", Prefix: "EXPI12", Role: models.RoleUser, MaxUses: 1, ExpiresAt: &expired},
+		}
+		for _, invitation := range invitations {
+			if err := client.CreateInvitation(ctx, invitation); err != nil {
+				t.Fatalf("Failed to create invitation: %v", err)
+			}
+		}
+		listed, err := client.ListInvitations(ctx)
+		if err != nil || len(listed) != 2 {
+			t.Fatalf("Expected 2 invitations, got %d, %v", len(listed), err)
+		}
+
+		useInvitation := func(codeHash string) *models.Invitation {
+			t.Helper()
+			tx, err := client.BeginTx(ctx)
+			if err != nil {
+				t.Fatalf("Failed to begin transaction: %v", err)
+			}
+			invitation, err := tx.UseInvitation(ctx, codeHash, now)
+			if err != nil {
+				t.Fatalf("Failed to use invitation: %v", err)
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatalf("Failed to commit: %v", err)
+			}
+			return invitation
+		}
+		for uses := 1; uses <= 2; uses++ {
+			if invitation := useInvitation("open-hash"); invitation == nil || invitation.Uses != uses {
+				t.Errorf("Expected use %d of the invitation, got %+v", uses, invitation)
+			}
+		}
+		if invitation := useInvitation("open-hash"); invitation != nil {
+			t.Errorf("Expected used up invitation to be refused, got %+v", invitation)
+		}
+		if invitation := useInvitation("expired-hash"); invitation != nil {
+			t.Errorf("Expected expired invitation to be refused, got %+v", invitation)
+		}
+
+		if revoked, err := client.RevokeInvitation(ctx, "inv-open", now); err != nil || !revoked {
+			t.Errorf("Expected to revoke invitation, got %v, %v", revoked, err)
+		}
+		if revoked, err := client.RevokeInvitation(ctx, "inv-open", now); err != nil || revoked {
+			t.Errorf("Expected invitation to be revoked already, got %v, %v", revoked, err)
+		}
+	})
 }
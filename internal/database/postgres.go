@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/bjschafer/print-dis/internal/models"
 	"github.com/jmoiron/sqlx"
@@ -118,8 +119,19 @@ func (c *postgresClient) ListPrinters(ctx context.Context) ([]*models.Printer, e
 
 // Filament operations
 func (c *postgresClient) CreateFilament(ctx context.Context, filament *models.Filament) error {
-	query := `INSERT INTO filaments (name, material_id) VALUES ($1, $2) RETURNING id`
-	err := c.db.QueryRowContext(ctx, query, filament.Name, filament.Material.Id).Scan(&filament.Id)
+	query := `
+		INSERT INTO filaments (name, material_id, vendor, color_hex, weight, price, settings_extruder_temp, settings_bed_temp)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	err := c.db.QueryRowContext(ctx, query,
+		filament.Name,
+		filament.Material.Id,
+		filament.Vendor,
+		filament.ColorHex,
+		filament.Weight,
+		filament.Price,
+		filament.ExtruderTemp,
+		filament.BedTemp,
+	).Scan(&filament.Id)
 	if err != nil {
 		return fmt.Errorf("failed to create filament: %w", err)
 	}
@@ -127,11 +139,7 @@ func (c *postgresClient) CreateFilament(ctx context.Context, filament *models.Fi
 }
 
 func (c *postgresClient) GetFilament(ctx context.Context, id int) (*models.Filament, error) {
-	query := `
-		SELECT f.id, f.name, m.id as "material.id", m.name as "material.name" 
-		FROM filaments f 
-		JOIN materials m ON f.material_id = m.id 
-		WHERE f.id = $1`
+	query := filamentSelect + ` WHERE f.id = $1`
 
 	filament := &models.Filament{}
 	err := c.db.GetContext(ctx, filament, query, id)
@@ -145,8 +153,22 @@ func (c *postgresClient) GetFilament(ctx context.Context, id int) (*models.Filam
 }
 
 func (c *postgresClient) UpdateFilament(ctx context.Context, filament *models.Filament) error {
-	query := `UPDATE filaments SET name = $1, material_id = $2 WHERE id = $3`
-	_, err := c.db.ExecContext(ctx, query, filament.Name, filament.Material.Id, filament.Id)
+	query := `
+		UPDATE filaments
+		SET name = $1, material_id = $2, vendor = $3, color_hex = $4, weight = $5, price = $6,
+			settings_extruder_temp = $7, settings_bed_temp = $8
+		WHERE id = $9`
+	_, err := c.db.ExecContext(ctx, query,
+		filament.Name,
+		filament.Material.Id,
+		filament.Vendor,
+		filament.ColorHex,
+		filament.Weight,
+		filament.Price,
+		filament.ExtruderTemp,
+		filament.BedTemp,
+		filament.Id,
+	)
 	if err != nil {
 		return fmt.Errorf("failed to update filament: %w", err)
 	}
@@ -163,10 +185,7 @@ func (c *postgresClient) DeleteFilament(ctx context.Context, id int) error {
 }
 
 func (c *postgresClient) ListFilaments(ctx context.Context) ([]*models.Filament, error) {
-	query := `
-		SELECT f.id, f.name, m.id as "material.id", m.name as "material.name" 
-		FROM filaments f 
-		JOIN materials m ON f.material_id = m.id`
+	query := filamentSelect + ` ORDER BY f.vendor, f.name`
 
 	filaments := []*models.Filament{}
 	err := c.db.SelectContext(ctx, &filaments, query)
@@ -176,6 +195,82 @@ func (c *postgresClient) ListFilaments(ctx context.Context) ([]*models.Filament,
 	return filaments, nil
 }
 
+// Spool operations
+func (c *postgresClient) CreateSpool(ctx context.Context, spool *models.Spool) error {
+	query := `
+		INSERT INTO spools (filament_id, initial_weight, remaining_weight, location, lot_nr, comment, archived)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, created_at`
+	err := c.db.QueryRowContext(ctx, query,
+		spool.Filament.Id,
+		spool.InitialWeight,
+		spool.RemainingWeight,
+		spool.Location,
+		spool.LotNr,
+		spool.Comment,
+		spool.Archived,
+	).Scan(&spool.Id, &spool.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create spool: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) GetSpool(ctx context.Context, id int) (*models.Spool, error) {
+	query := spoolSelect + ` WHERE s.id = $1`
+
+	spool := &models.Spool{}
+	err := c.db.GetContext(ctx, spool, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get spool: %w", err)
+	}
+	return spool, nil
+}
+
+func (c *postgresClient) UpdateSpool(ctx context.Context, spool *models.Spool) error {
+	query := `
+		UPDATE spools
+		SET filament_id = $1, initial_weight = $2, remaining_weight = $3, location = $4,
+			lot_nr = $5, comment = $6, archived = $7
+		WHERE id = $8`
+	_, err := c.db.ExecContext(ctx, query,
+		spool.Filament.Id,
+		spool.InitialWeight,
+		spool.RemainingWeight,
+		spool.Location,
+		spool.LotNr,
+		spool.Comment,
+		spool.Archived,
+		spool.Id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update spool: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) DeleteSpool(ctx context.Context, id int) error {
+	query := `DELETE FROM spools WHERE id = $1`
+	_, err := c.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete spool: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) ListSpools(ctx context.Context) ([]*models.Spool, error) {
+	query := spoolSelect + ` ORDER BY s.id`
+
+	spools := []*models.Spool{}
+	err := c.db.SelectContext(ctx, &spools, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query spools: %w", err)
+	}
+	return spools, nil
+}
+
 // Job operations
 func (c *postgresClient) CreateJob(ctx context.Context, job *models.Job) error {
 	query := `INSERT INTO jobs (printer_id, filament_id, material_id) VALUES ($1, $2, $3) RETURNING id`
@@ -266,8 +361,8 @@ func (c *postgresClient) ListJobs(ctx context.Context) ([]*models.Job, error) {
 
 // Material operations
 func (c *postgresClient) CreateMaterial(ctx context.Context, material *models.Material) error {
-	query := `INSERT INTO materials (name) VALUES ($1) RETURNING id`
-	err := c.db.QueryRowContext(ctx, query, material.Name).Scan(&material.Id)
+	query := `INSERT INTO materials (name, density, diameter) VALUES ($1, $2, $3) RETURNING id`
+	err := c.db.QueryRowContext(ctx, query, material.Name, material.Density, material.Diameter).Scan(&material.Id)
 	if err != nil {
 		return fmt.Errorf("failed to create material: %w", err)
 	}
@@ -275,18 +370,21 @@ func (c *postgresClient) CreateMaterial(ctx context.Context, material *models.Ma
 }
 
 func (c *postgresClient) GetMaterial(ctx context.Context, id int) (*models.Material, error) {
-	query := `SELECT id, name FROM materials WHERE id = $1`
+	query := `SELECT ` + materialColumns + ` FROM materials WHERE id = $1`
 	material := &models.Material{}
 	err := c.db.GetContext(ctx, material, query, id)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
 		return nil, fmt.Errorf("failed to get material: %w", err)
 	}
 	return material, nil
 }
 
 func (c *postgresClient) UpdateMaterial(ctx context.Context, material *models.Material) error {
-	query := `UPDATE materials SET name = $1 WHERE id = $2`
-	_, err := c.db.ExecContext(ctx, query, material.Name, material.Id)
+	query := `UPDATE materials SET name = $1, density = $2, diameter = $3 WHERE id = $4`
+	_, err := c.db.ExecContext(ctx, query, material.Name, material.Density, material.Diameter, material.Id)
 	if err != nil {
 		return fmt.Errorf("failed to update material: %w", err)
 	}
@@ -303,7 +401,7 @@ func (c *postgresClient) DeleteMaterial(ctx context.Context, id int) error {
 }
 
 func (c *postgresClient) ListMaterials(ctx context.Context) ([]*models.Material, error) {
-	query := `SELECT id, name FROM materials`
+	query := `SELECT ` + materialColumns + ` FROM materials ORDER BY name`
 	materials := []*models.Material{}
 	err := c.db.SelectContext(ctx, &materials, query)
 	if err != nil {
@@ -316,8 +414,10 @@ func (c *postgresClient) ListMaterials(ctx context.Context) ([]*models.Material,
 func (c *postgresClient) CreatePrintRequest(ctx context.Context, request *models.PrintRequest) error {
 	query := `
 		INSERT INTO print_requests (
-			id, user_id, file_link, notes, spool_id, color, material, status, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+			id, user_id, group_id, file_link, notes, spool_id, printer_id, color, material, status,
+			spool_needs_replacement, estimated_grams, estimated_hours, estimated_cost,
+			actual_grams, actual_hours, actual_cost, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19)`
 
 	c.logger.Debug("executing create print request query",
 		"id", request.ID,
@@ -328,12 +428,21 @@ func (c *postgresClient) CreatePrintRequest(ctx context.Context, request *models
 	_, err := c.db.ExecContext(ctx, query,
 		request.ID,
 		request.UserID,
+		request.GroupID,
 		request.FileLink,
 		request.Notes,
 		request.SpoolID,
+		request.PrinterID,
 		request.Color,
 		request.Material,
 		request.Status,
+		request.SpoolNeedsReplacement,
+		request.EstimatedGrams,
+		request.EstimatedHours,
+		request.EstimatedCost,
+		request.ActualGrams,
+		request.ActualHours,
+		request.ActualCost,
 		request.CreatedAt,
 		request.UpdatedAt,
 	)
@@ -350,7 +459,7 @@ func (c *postgresClient) CreatePrintRequest(ctx context.Context, request *models
 
 func (c *postgresClient) GetPrintRequest(ctx context.Context, id string) (*models.PrintRequest, error) {
 	query := `
-		SELECT id, user_id, file_link, notes, spool_id, color, material, status, created_at, updated_at
+		SELECT ` + printRequestColumns + `
 		FROM print_requests
 		WHERE id = $1`
 
@@ -376,9 +485,10 @@ func (c *postgresClient) GetPrintRequest(ctx context.Context, id string) (*model
 func (c *postgresClient) UpdatePrintRequest(ctx context.Context, request *models.PrintRequest) error {
 	query := `
 		UPDATE print_requests
-		SET user_id = $1, file_link = $2, notes = $3, spool_id = $4, color = $5,
-			material = $6, status = $7, updated_at = $8
-		WHERE id = $9`
+		SET user_id = $1, group_id = $2, file_link = $3, notes = $4, spool_id = $5, printer_id = $6, color = $7,
+			material = $8, status = $9, spool_needs_replacement = $10, estimated_grams = $11, estimated_hours = $12,
+			estimated_cost = $13, actual_grams = $14, actual_hours = $15, actual_cost = $16, updated_at = $17
+		WHERE id = $18`
 
 	c.logger.Debug("executing update print request query",
 		"id", request.ID,
@@ -388,12 +498,21 @@ func (c *postgresClient) UpdatePrintRequest(ctx context.Context, request *models
 
 	_, err := c.db.ExecContext(ctx, query,
 		request.UserID,
+		request.GroupID,
 		request.FileLink,
 		request.Notes,
 		request.SpoolID,
+		request.PrinterID,
 		request.Color,
 		request.Material,
 		request.Status,
+		request.SpoolNeedsReplacement,
+		request.EstimatedGrams,
+		request.EstimatedHours,
+		request.EstimatedCost,
+		request.ActualGrams,
+		request.ActualHours,
+		request.ActualCost,
 		request.UpdatedAt,
 		request.ID,
 	)
@@ -427,7 +546,7 @@ func (c *postgresClient) DeletePrintRequest(ctx context.Context, id string) erro
 
 func (c *postgresClient) ListPrintRequests(ctx context.Context) ([]*models.PrintRequest, error) {
 	query := `
-		SELECT id, user_id, file_link, notes, spool_id, color, material, status, created_at, updated_at
+		SELECT ` + printRequestColumns + `
 		FROM print_requests
 		ORDER BY created_at DESC`
 
@@ -451,7 +570,7 @@ func (c *postgresClient) ListPrintRequests(ctx context.Context) ([]*models.Print
 
 func (c *postgresClient) ListPrintRequestsByUserID(ctx context.Context, userID string) ([]*models.PrintRequest, error) {
 	query := `
-		SELECT id, user_id, file_link, notes, spool_id, color, material, status, created_at, updated_at
+		SELECT ` + printRequestColumns + `
 		FROM print_requests
 		WHERE user_id = $1
 		ORDER BY created_at DESC`
@@ -476,11 +595,33 @@ func (c *postgresClient) ListPrintRequestsByUserID(ctx context.Context, userID s
 	return requests, nil
 }
 
+func (c *postgresClient) ListPrintRequestsBySpoolID(ctx context.Context, spoolID int) ([]*models.PrintRequest, error) {
+	query := `
+		SELECT ` + printRequestColumns + `
+		FROM print_requests
+		WHERE spool_id = $1
+		ORDER BY created_at DESC`
+
+	c.logger.Debug("executing list print requests by spool query", "spool_id", spoolID)
+
+	requests := []*models.PrintRequest{}
+	err := c.db.SelectContext(ctx, &requests, query, spoolID)
+	if err != nil {
+		c.logger.Error("failed to query print requests for spool",
+			"error", err,
+			"spool_id", spoolID,
+		)
+		return nil, fmt.Errorf("failed to query print requests for spool: %w", err)
+	}
+
+	return requests, nil
+}
+
 // User operations
 func (c *postgresClient) CreateUser(ctx context.Context, user *models.User) error {
 	query := `
-		INSERT INTO users (id, username, email, password_hash, display_name, role, created_at, updated_at, enabled)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+		INSERT INTO users (id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)`
 
 	c.logger.Debug("executing create user query", "username", user.Username)
 
@@ -494,6 +635,8 @@ func (c *postgresClient) CreateUser(ctx context.Context, user *models.User) erro
 		user.CreatedAt,
 		user.UpdatedAt,
 		user.Enabled,
+		user.EmailVerifiedAt,
+		user.MustChangePassword,
 	)
 	if err != nil {
 		c.logger.Error("failed to create user", "error", err, "username", user.Username)
@@ -505,7 +648,7 @@ func (c *postgresClient) CreateUser(ctx context.Context, user *models.User) erro
 
 func (c *postgresClient) GetUser(ctx context.Context, id string) (*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled
+		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password
 		FROM users
 		WHERE id = $1`
 
@@ -523,7 +666,7 @@ func (c *postgresClient) GetUser(ctx context.Context, id string) (*models.User,
 
 func (c *postgresClient) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled
+		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password
 		FROM users
 		WHERE username = $1`
 
@@ -541,7 +684,7 @@ func (c *postgresClient) GetUserByUsername(ctx context.Context, username string)
 
 func (c *postgresClient) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled
+		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password
 		FROM users
 		WHERE email = $1`
 
@@ -560,8 +703,8 @@ func (c *postgresClient) GetUserByEmail(ctx context.Context, email string) (*mod
 func (c *postgresClient) UpdateUser(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users
-		SET username = $1, email = $2, password_hash = $3, display_name = $4, role = $5, updated_at = $6, enabled = $7
-		WHERE id = $8`
+		SET username = $1, email = $2, password_hash = $3, display_name = $4, role = $5, updated_at = $6, enabled = $7, email_verified_at = $8, must_change_password = $9
+		WHERE id = $10`
 
 	_, err := c.db.ExecContext(ctx, query,
 		user.Username,
@@ -571,6 +714,8 @@ func (c *postgresClient) UpdateUser(ctx context.Context, user *models.User) erro
 		user.Role,
 		user.UpdatedAt,
 		user.Enabled,
+		user.EmailVerifiedAt,
+		user.MustChangePassword,
 		user.ID,
 	)
 	if err != nil {
@@ -591,7 +736,7 @@ func (c *postgresClient) DeleteUser(ctx context.Context, id string) error {
 
 func (c *postgresClient) ListUsers(ctx context.Context) ([]*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled
+		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password
 		FROM users
 		ORDER BY created_at DESC`
 
@@ -603,3 +748,1085 @@ func (c *postgresClient) ListUsers(ctx context.Context) ([]*models.User, error)
 
 	return users, nil
 }
+
+// Billing operations
+func (c *postgresClient) CreateCharge(ctx context.Context, charge *models.Charge) error {
+	now := time.Now()
+	charge.CreatedAt = now
+	charge.UpdatedAt = now
+
+	query := `
+		INSERT INTO charges (user_id, print_request_id, amount_cents, description, waived, waived_reason, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	err := c.db.QueryRowContext(ctx, query,
+		charge.UserID,
+		charge.PrintRequestID,
+		charge.Amount,
+		charge.Description,
+		charge.Waived,
+		charge.WaivedReason,
+		charge.CreatedAt,
+		charge.UpdatedAt,
+	).Scan(&charge.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create charge: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) GetCharge(ctx context.Context, id int) (*models.Charge, error) {
+	query := `SELECT ` + chargeColumns + ` FROM charges WHERE id = $1`
+
+	charge := &models.Charge{}
+	err := c.db.GetContext(ctx, charge, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get charge: %w", err)
+	}
+	return charge, nil
+}
+
+func (c *postgresClient) GetChargeByPrintRequestID(ctx context.Context, printRequestID string) (*models.Charge, error) {
+	query := `SELECT ` + chargeColumns + ` FROM charges WHERE print_request_id = $1`
+
+	charge := &models.Charge{}
+	err := c.db.GetContext(ctx, charge, query, printRequestID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get charge: %w", err)
+	}
+	return charge, nil
+}
+
+func (c *postgresClient) UpdateCharge(ctx context.Context, charge *models.Charge) error {
+	charge.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE charges
+		SET amount_cents = $1, description = $2, waived = $3, waived_reason = $4, updated_at = $5
+		WHERE id = $6`
+	_, err := c.db.ExecContext(ctx, query,
+		charge.Amount,
+		charge.Description,
+		charge.Waived,
+		charge.WaivedReason,
+		charge.UpdatedAt,
+		charge.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update charge: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) ListChargesByUserID(ctx context.Context, userID string) ([]*models.Charge, error) {
+	query := `SELECT ` + chargeColumns + ` FROM charges WHERE user_id = $1 ORDER BY created_at, id`
+
+	charges := []*models.Charge{}
+	err := c.db.SelectContext(ctx, &charges, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query charges: %w", err)
+	}
+	return charges, nil
+}
+
+func (c *postgresClient) CreatePayment(ctx context.Context, payment *models.Payment) error {
+	if payment.CreatedAt.IsZero() {
+		payment.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO payments (user_id, amount_cents, method, reference, note, recorded_by, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	err := c.db.QueryRowContext(ctx, query,
+		payment.UserID,
+		payment.Amount,
+		payment.Method,
+		payment.Reference,
+		payment.Note,
+		payment.RecordedBy,
+		payment.CreatedAt,
+	).Scan(&payment.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create payment: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) ListPaymentsByUserID(ctx context.Context, userID string) ([]*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE user_id = $1 ORDER BY created_at, id`
+
+	payments := []*models.Payment{}
+	err := c.db.SelectContext(ctx, &payments, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query payments: %w", err)
+	}
+	return payments, nil
+}
+
+func (c *postgresClient) GetBalance(ctx context.Context, userID string) (*models.Balance, error) {
+	query := balanceSelect + ` WHERE u.id = $1`
+
+	balance := &models.Balance{}
+	err := c.db.GetContext(ctx, balance, query, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+	return balance, nil
+}
+
+func (c *postgresClient) ListBalances(ctx context.Context) ([]*models.Balance, error) {
+	query := balanceSelect + ` ORDER BY u.username`
+
+	balances := []*models.Balance{}
+	err := c.db.SelectContext(ctx, &balances, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query balances: %w", err)
+	}
+	return balances, nil
+}
+
+// Quota override operations
+func (c *postgresClient) CreateQuotaOverride(ctx context.Context, override *models.QuotaOverride) error {
+	now := time.Now()
+	override.CreatedAt = now
+	override.UpdatedAt = now
+
+	query := `
+		INSERT INTO quota_overrides (scope, subject, max_open_requests, monthly_grams, monthly_hours, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+	err := c.db.QueryRowContext(ctx, query,
+		override.Scope,
+		override.Subject,
+		override.MaxOpenRequests,
+		override.MonthlyGrams,
+		override.MonthlyHours,
+		override.CreatedAt,
+		override.UpdatedAt,
+	).Scan(&override.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create quota override: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) GetQuotaOverride(ctx context.Context, scope models.QuotaScope, subject string) (*models.QuotaOverride, error) {
+	query := `SELECT ` + quotaOverrideColumns + ` FROM quota_overrides WHERE scope = $1 AND subject = $2`
+
+	override := &models.QuotaOverride{}
+	err := c.db.GetContext(ctx, override, query, scope, subject)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get quota override: %w", err)
+	}
+	return override, nil
+}
+
+func (c *postgresClient) UpdateQuotaOverride(ctx context.Context, override *models.QuotaOverride) error {
+	override.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE quota_overrides
+		SET max_open_requests = $1, monthly_grams = $2, monthly_hours = $3, updated_at = $4
+		WHERE id = $5`
+	_, err := c.db.ExecContext(ctx, query,
+		override.MaxOpenRequests,
+		override.MonthlyGrams,
+		override.MonthlyHours,
+		override.UpdatedAt,
+		override.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update quota override: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) DeleteQuotaOverride(ctx context.Context, id int) error {
+	query := `DELETE FROM quota_overrides WHERE id = $1`
+	_, err := c.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete quota override: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) ListQuotaOverrides(ctx context.Context) ([]*models.QuotaOverride, error) {
+	query := `SELECT ` + quotaOverrideColumns + ` FROM quota_overrides ORDER BY scope, subject`
+
+	overrides := []*models.QuotaOverride{}
+	err := c.db.SelectContext(ctx, &overrides, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quota overrides: %w", err)
+	}
+	return overrides, nil
+}
+
+// Group operations
+func (c *postgresClient) CreateGroup(ctx context.Context, group *models.Group) error {
+	now := time.Now()
+	group.CreatedAt = now
+	group.UpdatedAt = now
+
+	query := `INSERT INTO groups (id, name, description, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := c.db.ExecContext(ctx, query, group.ID, group.Name, group.Description, group.CreatedAt, group.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create group: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) GetGroup(ctx context.Context, id string) (*models.Group, error) {
+	query := `SELECT ` + groupColumns + ` FROM groups WHERE id = $1`
+
+	group := &models.Group{}
+	err := c.db.GetContext(ctx, group, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
+	return group, nil
+}
+
+func (c *postgresClient) UpdateGroup(ctx context.Context, group *models.Group) error {
+	group.UpdatedAt = time.Now()
+
+	query := `UPDATE groups SET name = $1, description = $2, updated_at = $3 WHERE id = $4`
+	_, err := c.db.ExecContext(ctx, query, group.Name, group.Description, group.UpdatedAt, group.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update group: %w", err)
+	}
+	return nil
+}
+
+// DeleteGroup deletes a group and its memberships. Its print requests are kept
+// without a group.
+func (c *postgresClient) DeleteGroup(ctx context.Context, id string) error {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `UPDATE print_requests SET group_id = NULL WHERE group_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to clear group from print requests: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM group_memberships WHERE group_id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete group memberships: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM groups WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) ListGroups(ctx context.Context) ([]*models.Group, error) {
+	query := `SELECT ` + groupColumns + ` FROM groups ORDER BY name`
+
+	groups := []*models.Group{}
+	err := c.db.SelectContext(ctx, &groups, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query groups: %w", err)
+	}
+	return groups, nil
+}
+
+// SetGroupMembership adds a user to a group, or changes their role if they
+// are already a member
+func (c *postgresClient) SetGroupMembership(ctx context.Context, membership *models.GroupMembership) error {
+	if membership.CreatedAt.IsZero() {
+		membership.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO group_memberships (group_id, user_id, role, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (group_id, user_id) DO UPDATE SET role = excluded.role`
+	_, err := c.db.ExecContext(ctx, query, membership.GroupID, membership.UserID, membership.Role, membership.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set group membership: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) DeleteGroupMembership(ctx context.Context, groupID, userID string) error {
+	query := `DELETE FROM group_memberships WHERE group_id = $1 AND user_id = $2`
+	_, err := c.db.ExecContext(ctx, query, groupID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete group membership: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) ListGroupMembers(ctx context.Context, groupID string) ([]*models.GroupMembership, error) {
+	query := groupMembershipSelect + ` WHERE gm.group_id = $1 ORDER BY u.username`
+
+	memberships := []*models.GroupMembership{}
+	err := c.db.SelectContext(ctx, &memberships, query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group members: %w", err)
+	}
+	return memberships, nil
+}
+
+func (c *postgresClient) ListGroupMembershipsByUserID(ctx context.Context, userID string) ([]*models.GroupMembership, error) {
+	query := groupMembershipSelect + ` WHERE gm.user_id = $1 ORDER BY g.name`
+
+	memberships := []*models.GroupMembership{}
+	err := c.db.SelectContext(ctx, &memberships, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group memberships: %w", err)
+	}
+	return memberships, nil
+}
+
+func (c *postgresClient) ListPrintRequestsByGroupID(ctx context.Context, groupID string) ([]*models.PrintRequest, error) {
+	query := `
+		SELECT ` + printRequestColumns + `
+		FROM print_requests
+		WHERE group_id = $1
+		ORDER BY created_at DESC`
+
+	requests := []*models.PrintRequest{}
+	err := c.db.SelectContext(ctx, &requests, query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query print requests for group: %w", err)
+	}
+	return requests, nil
+}
+
+func (c *postgresClient) CreateRole(ctx context.Context, role *models.RoleDefinition) error {
+	now := time.Now()
+	role.CreatedAt = now
+	role.UpdatedAt = now
+
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `INSERT INTO roles (name, description, built_in, created_at, updated_at) VALUES ($1, $2, $3, $4, $5)`
+	if _, err = tx.ExecContext(ctx, query, role.Name, role.Description, role.BuiltIn, role.CreatedAt, role.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+	if err = replaceRolePermissions(ctx, tx, role); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) GetRole(ctx context.Context, name models.Role) (*models.RoleDefinition, error) {
+	query := `SELECT ` + roleColumns + ` FROM roles WHERE name = $1`
+
+	role := &models.RoleDefinition{}
+	err := c.db.GetContext(ctx, role, query, name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	role.Permissions = []models.Permission{}
+	query = `SELECT permission FROM role_permissions WHERE role = $1 ORDER BY permission`
+	if err := c.db.SelectContext(ctx, &role.Permissions, query, name); err != nil {
+		return nil, fmt.Errorf("failed to query role permissions: %w", err)
+	}
+	return role, nil
+}
+
+func (c *postgresClient) UpdateRole(ctx context.Context, role *models.RoleDefinition) error {
+	role.UpdatedAt = time.Now()
+
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `UPDATE roles SET description = $1, updated_at = $2 WHERE name = $3`
+	if _, err = tx.ExecContext(ctx, query, role.Description, role.UpdatedAt, role.Name); err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+	if err = replaceRolePermissions(ctx, tx, role); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) DeleteRole(ctx context.Context, name models.Role) error {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role = $1`, name); err != nil {
+		return fmt.Errorf("failed to delete role permissions: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM roles WHERE name = $1`, name); err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) ListRoles(ctx context.Context) ([]*models.RoleDefinition, error) {
+	query := `SELECT ` + roleColumns + ` FROM roles ORDER BY name`
+
+	roles := []*models.RoleDefinition{}
+	if err := c.db.SelectContext(ctx, &roles, query); err != nil {
+		return nil, fmt.Errorf("failed to query roles: %w", err)
+	}
+	if err := loadRolePermissions(ctx, c.db, roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// OIDC identity operations
+func (c *postgresClient) CreateOIDCIdentity(ctx context.Context, identity *models.UserOIDCIdentity) error {
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO user_oidc_identities (id, user_id, provider_name, subject, created_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := c.db.ExecContext(ctx, query, identity.ID, identity.UserID, identity.ProviderName, identity.Subject, identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create OIDC identity: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) GetOIDCIdentity(ctx context.Context, providerName, subject string) (*models.UserOIDCIdentity, error) {
+	query := `SELECT id, user_id, provider_name, subject, created_at FROM user_oidc_identities WHERE provider_name = $1 AND subject = $2`
+
+	identity := &models.UserOIDCIdentity{}
+	err := c.db.GetContext(ctx, identity, query, providerName, subject)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get OIDC identity: %w", err)
+	}
+	return identity, nil
+}
+
+// LDAP identity operations
+func (c *postgresClient) CreateLDAPIdentity(ctx context.Context, identity *models.UserLDAPIdentity) error {
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO user_ldap_identities (id, user_id, provider_name, subject, created_at) VALUES ($1, $2, $3, $4, $5)`
+	_, err := c.db.ExecContext(ctx, query, identity.ID, identity.UserID, identity.ProviderName, identity.Subject, identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create LDAP identity: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) GetLDAPIdentity(ctx context.Context, providerName, subject string) (*models.UserLDAPIdentity, error) {
+	query := `SELECT id, user_id, provider_name, subject, created_at FROM user_ldap_identities WHERE provider_name = $1 AND subject = $2`
+
+	identity := &models.UserLDAPIdentity{}
+	err := c.db.GetContext(ctx, identity, query, providerName, subject)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get LDAP identity: %w", err)
+	}
+	return identity, nil
+}
+
+// API token operations
+func (c *postgresClient) CreateAPIToken(ctx context.Context, token *models.APIToken) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO api_tokens (` + apiTokenColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := c.db.ExecContext(ctx, query,
+		token.ID,
+		token.UserID,
+		token.Name,
+		token.TokenHash,
+		token.Prefix,
+		joinScopes(token.Scopes),
+		token.ExpiresAt,
+		token.LastUsedAt,
+		token.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create API token: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE token_hash = $1`
+
+	var row apiTokenRow
+	err := c.db.GetContext(ctx, &row, query, tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+	return row.toModel(), nil
+}
+
+func (c *postgresClient) ListAPITokensByUserID(ctx context.Context, userID string) ([]*models.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE user_id = $1 ORDER BY created_at DESC`
+
+	var rows []apiTokenRow
+	if err := c.db.SelectContext(ctx, &rows, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to query API tokens: %w", err)
+	}
+	tokens := make([]*models.APIToken, 0, len(rows))
+	for i := range rows {
+		tokens = append(tokens, rows[i].toModel())
+	}
+	return tokens, nil
+}
+
+func (c *postgresClient) UpdateAPITokenLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error {
+	query := `UPDATE api_tokens SET last_used_at = $1 WHERE id = $2`
+	if _, err := c.db.ExecContext(ctx, query, lastUsedAt, id); err != nil {
+		return fmt.Errorf("failed to update API token: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) DeleteAPIToken(ctx context.Context, id string) error {
+	query := `DELETE FROM api_tokens WHERE id = $1`
+	if _, err := c.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete API token: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) DeleteAPITokensByUserID(ctx context.Context, userID string) error {
+	query := `DELETE FROM api_tokens WHERE user_id = $1`
+	if _, err := c.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to delete API tokens: %w", err)
+	}
+	return nil
+}
+
+// User session operations
+func (c *postgresClient) CreateUserSession(ctx context.Context, session *models.UserSession) error {
+	query := `
+		INSERT INTO user_sessions (id, user_id, session_token, data, user_agent, ip_address, expires_at, created_at, last_seen_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
+	_, err := c.db.ExecContext(ctx, query,
+		session.ID,
+		nullIfEmpty(session.UserID),
+		session.SessionToken,
+		session.Data,
+		session.UserAgent,
+		session.IPAddress,
+		session.ExpiresAt,
+		session.CreatedAt,
+		session.LastSeenAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) GetUserSessionByToken(ctx context.Context, tokenHash string) (*models.UserSession, error) {
+	query := `SELECT ` + userSessionColumns + ` FROM user_sessions WHERE session_token = $1`
+
+	session := &models.UserSession{}
+	err := c.db.GetContext(ctx, session, query, tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return session, nil
+}
+
+func (c *postgresClient) UpdateUserSession(ctx context.Context, session *models.UserSession) error {
+	query := `
+		UPDATE user_sessions SET user_id = $1, data = $2, expires_at = $3, last_seen_at = $4
+		WHERE session_token = $5`
+	_, err := c.db.ExecContext(ctx, query, nullIfEmpty(session.UserID), session.Data, session.ExpiresAt, session.LastSeenAt, session.SessionToken)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) TouchUserSession(ctx context.Context, id string, lastSeenAt time.Time, ipAddress string) error {
+	query := `UPDATE user_sessions SET last_seen_at = $1, ip_address = $2 WHERE id = $3`
+	if _, err := c.db.ExecContext(ctx, query, lastSeenAt, ipAddress, id); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) ListUserSessionsByUserID(ctx context.Context, userID string, now time.Time) ([]*models.UserSession, error) {
+	query := `SELECT ` + userSessionColumns + ` FROM user_sessions WHERE user_id = $1 AND expires_at > $2 ORDER BY last_seen_at DESC`
+
+	sessions := []*models.UserSession{}
+	if err := c.db.SelectContext(ctx, &sessions, query, userID, now); err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (c *postgresClient) DeleteUserSession(ctx context.Context, id string) error {
+	query := `DELETE FROM user_sessions WHERE id = $1`
+	if _, err := c.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) DeleteUserSessionsByUserID(ctx context.Context, userID, exceptID string) error {
+	query := `DELETE FROM user_sessions WHERE user_id = $1 AND id <> $2`
+	if _, err := c.db.ExecContext(ctx, query, userID, exceptID); err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) DeleteExpiredUserSessions(ctx context.Context, now time.Time) (int64, error) {
+	query := `DELETE FROM user_sessions WHERE expires_at <= $1`
+	result, err := c.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Two-factor authentication operations
+func (c *postgresClient) SaveUserTOTP(ctx context.Context, totp *models.UserTOTP) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret, enabled, last_counter, created_at, enabled_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, enabled = excluded.enabled,
+			last_counter = excluded.last_counter, created_at = excluded.created_at, enabled_at = excluded.enabled_at`
+	_, err := c.db.ExecContext(ctx, query, totp.UserID, totp.Secret, totp.Enabled, totp.LastCounter, totp.CreatedAt, totp.EnabledAt)
+	if err != nil {
+		return fmt.Errorf("failed to save TOTP enrolment: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) GetUserTOTP(ctx context.Context, userID string) (*models.UserTOTP, error) {
+	query := `SELECT ` + userTOTPColumns + ` FROM user_totp WHERE user_id = $1`
+
+	totp := &models.UserTOTP{}
+	err := c.db.GetContext(ctx, totp, query, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get TOTP enrolment: %w", err)
+	}
+	return totp, nil
+}
+
+func (c *postgresClient) UpdateUserTOTPCounter(ctx context.Context, userID string, counter int64) (bool, error) {
+	// Only move forwards, so that concurrent logins cannot both use a code
+	query := `UPDATE user_totp SET last_counter = $1 WHERE user_id = $2 AND last_counter < $1`
+	result, err := c.db.ExecContext(ctx, query, counter, userID)
+	if err != nil {
+		return false, fmt.Errorf("failed to update TOTP counter: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update TOTP counter: %w", err)
+	}
+	return rows > 0, nil
+}
+
+func (c *postgresClient) DeleteUserTOTP(ctx context.Context, userID string) error {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete TOTP enrolment: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) ReplaceRecoveryCodes(ctx context.Context, userID string, codes []*models.RecoveryCode) error {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = $1`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	query := `INSERT INTO user_recovery_codes (id, user_id, code_hash, created_at) VALUES ($1, $2, $3, $4)`
+	for _, code := range codes {
+		if _, err = tx.ExecContext(ctx, query, code.ID, userID, code.CodeHash, code.CreatedAt); err != nil {
+			return fmt.Errorf("failed to create recovery code: %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) UseRecoveryCode(ctx context.Context, userID, codeHash string, usedAt time.Time) (bool, error) {
+	query := `UPDATE user_recovery_codes SET used_at = $1 WHERE user_id = $2 AND code_hash = $3 AND used_at IS NULL`
+	result, err := c.db.ExecContext(ctx, query, usedAt, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	return rows > 0, nil
+}
+
+func (c *postgresClient) CountUnusedRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	query := `SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = $1 AND used_at IS NULL`
+
+	var count int
+	if err := c.db.GetContext(ctx, &count, query, userID); err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// WebAuthn credential operations
+func (c *postgresClient) CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	if credential.CreatedAt.IsZero() {
+		credential.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO user_webauthn_credentials (` + webAuthnCredentialColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := c.db.ExecContext(ctx, query,
+		credential.ID,
+		credential.UserID,
+		credential.Name,
+		credential.CredentialID,
+		credential.PublicKey,
+		credential.SignCount,
+		credential.CreatedAt,
+		credential.LastUsedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create WebAuthn credential: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) GetWebAuthnCredential(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM user_webauthn_credentials WHERE credential_id = $1`
+
+	credential := &models.WebAuthnCredential{}
+	err := c.db.GetContext(ctx, credential, query, credentialID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get WebAuthn credential: %w", err)
+	}
+	return credential, nil
+}
+
+func (c *postgresClient) ListWebAuthnCredentialsByUserID(ctx context.Context, userID string) ([]*models.WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM user_webauthn_credentials WHERE user_id = $1 ORDER BY created_at`
+
+	var credentials []*models.WebAuthnCredential
+	if err := c.db.SelectContext(ctx, &credentials, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to query WebAuthn credentials: %w", err)
+	}
+	return credentials, nil
+}
+
+func (c *postgresClient) UpdateWebAuthnCredentialUsage(ctx context.Context, id string, signCount int64, lastUsedAt time.Time) error {
+	query := `UPDATE user_webauthn_credentials SET sign_count = $1, last_used_at = $2 WHERE id = $3`
+	if _, err := c.db.ExecContext(ctx, query, signCount, lastUsedAt, id); err != nil {
+		return fmt.Errorf("failed to update WebAuthn credential: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) DeleteWebAuthnCredential(ctx context.Context, id string) error {
+	query := `DELETE FROM user_webauthn_credentials WHERE id = $1`
+	if _, err := c.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete WebAuthn credential: %w", err)
+	}
+	return nil
+}
+
+// Email token operations
+func (c *postgresClient) CreateEmailToken(ctx context.Context, token *models.EmailToken) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO email_tokens (` + emailTokenColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`
+	_, err := c.db.ExecContext(ctx, query,
+		token.ID,
+		token.UserID,
+		token.Purpose,
+		token.TokenHash,
+		token.Email,
+		token.ExpiresAt,
+		token.UsedAt,
+		token.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create email token: %w", err)
+	}
+	return nil
+}
+
+// UseEmailToken marks an unused, unexpired token as used and returns it, or
+// nil if there is no such token
+func (c *postgresClient) UseEmailToken(ctx context.Context, purpose models.EmailTokenPurpose, tokenHash string, usedAt time.Time) (*models.EmailToken, error) {
+	query := `UPDATE email_tokens SET used_at = $1 WHERE token_hash = $2 AND purpose = $3 AND used_at IS NULL AND expires_at > $4`
+	result, err := c.db.ExecContext(ctx, query, usedAt, tokenHash, purpose, usedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use email token: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to use email token: %w", err)
+	}
+	if rows == 0 {
+		return nil, nil
+	}
+
+	token := &models.EmailToken{}
+	query = `SELECT ` + emailTokenColumns + ` FROM email_tokens WHERE token_hash = $1`
+	if err := c.db.GetContext(ctx, token, query, tokenHash); err != nil {
+		return nil, fmt.Errorf("failed to get email token: %w", err)
+	}
+	return token, nil
+}
+
+func (c *postgresClient) DeleteEmailTokensByUserID(ctx context.Context, userID string, purpose models.EmailTokenPurpose) error {
+	query := `DELETE FROM email_tokens WHERE user_id = $1 AND purpose = $2`
+	if _, err := c.db.ExecContext(ctx, query, userID, purpose); err != nil {
+		return fmt.Errorf("failed to delete email tokens: %w", err)
+	}
+	return nil
+}
+
+// Failed login operations
+func (c *postgresClient) GetLoginAttempts(ctx context.Context, username string) (*models.LoginAttempts, error) {
+	query := `SELECT ` + loginAttemptsColumns + ` FROM login_attempts WHERE username = $1`
+
+	attempts := &models.LoginAttempts{}
+	err := c.db.GetContext(ctx, attempts, query, username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get login attempts: %w", err)
+	}
+	return attempts, nil
+}
+
+// RecordLoginFailure counts a failed login to the username and returns its
+// failures. Counting starts again if the last failure was before since.
+func (c *postgresClient) RecordLoginFailure(ctx context.Context, username string, failedAt, since time.Time) (*models.LoginAttempts, error) {
+	query := `
+		INSERT INTO login_attempts (username, failed_count, last_failed_at) VALUES ($1, 1, $2)
+		ON CONFLICT (username) DO UPDATE SET
+			failed_count = CASE WHEN login_attempts.last_failed_at < $3 THEN 1 ELSE login_attempts.failed_count + 1 END,
+			locked_until = CASE WHEN login_attempts.last_failed_at < $3 THEN NULL ELSE login_attempts.locked_until END,
+			last_failed_at = excluded.last_failed_at`
+	if _, err := c.db.ExecContext(ctx, query, username, failedAt, since); err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	attempts, err := c.GetLoginAttempts(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if attempts == nil {
+		return nil, fmt.Errorf("failed to record login failure: no login attempts for %q", username)
+	}
+	return attempts, nil
+}
+
+// LockLogin refuses logins to the username until the time, and returns false
+// if it was already locked
+func (c *postgresClient) LockLogin(ctx context.Context, username string, until, now time.Time) (bool, error) {
+	query := `UPDATE login_attempts SET locked_until = $1 WHERE username = $2 AND (locked_until IS NULL OR locked_until <= $3)`
+	result, err := c.db.ExecContext(ctx, query, until, username, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock login: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to lock login: %w", err)
+	}
+	return rows > 0, nil
+}
+
+func (c *postgresClient) DeleteLoginAttempts(ctx context.Context, username string) error {
+	query := `DELETE FROM login_attempts WHERE username = $1`
+	if _, err := c.db.ExecContext(ctx, query, username); err != nil {
+		return fmt.Errorf("failed to delete login attempts: %w", err)
+	}
+	return nil
+}
+
+// DeleteStaleLoginAttempts forgets usernames whose last failed login was
+// before the time and that are not locked
+func (c *postgresClient) DeleteStaleLoginAttempts(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM login_attempts WHERE last_failed_at < $1 AND (locked_until IS NULL OR locked_until < $1)`
+	result, err := c.db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stale login attempts: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Invitation operations
+func (c *postgresClient) CreateInvitation(ctx context.Context, invitation *models.Invitation) error {
+	if invitation.CreatedAt.IsZero() {
+		invitation.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO invitations (` + invitationColumns + `) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`
+	_, err := c.db.ExecContext(ctx, query,
+		invitation.ID,
+		invitation.CodeHash,
+		invitation.Prefix,
+		invitation.Email,
+		invitation.Role,
+		invitation.GroupID,
+		invitation.MaxUses,
+		invitation.Uses,
+		invitation.ExpiresAt,
+		invitation.RevokedAt,
+		invitation.CreatedBy,
+		invitation.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+	return nil
+}
+
+func (c *postgresClient) ListInvitations(ctx context.Context) ([]*models.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations ORDER BY created_at DESC`
+
+	var invitations []*models.Invitation
+	if err := c.db.SelectContext(ctx, &invitations, query); err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation stops an invitation from being used, and returns false if
+// there is no such invitation or it was already revoked
+func (c *postgresClient) RevokeInvitation(ctx context.Context, id string, revokedAt time.Time) (bool, error) {
+	query := `UPDATE invitations SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`
+	result, err := c.db.ExecContext(ctx, query, revokedAt, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// Print request analytics
+
+func (c *postgresClient) CountPrintRequestStatuses(ctx context.Context, r models.AnalyticsRange, bucket models.AnalyticsBucket) ([]*models.StatusCount, error) {
+	return c.countPrintRequestStatuses(ctx, postgresAnalytics, r, bucket)
+}
+
+func (c *postgresClient) ListTurnarounds(ctx context.Context, r models.AnalyticsRange) ([]*models.Turnaround, error) {
+	return c.listTurnarounds(ctx, postgresAnalytics, r)
+}
+
+func (c *postgresClient) SumMaterialUsage(ctx context.Context, r models.AnalyticsRange) ([]*models.MaterialUsage, error) {
+	return c.sumMaterialUsage(ctx, postgresAnalytics, r)
+}
+
+func (c *postgresClient) SumPrinterUsage(ctx context.Context, r models.AnalyticsRange) ([]*models.PrinterUsage, error) {
+	return c.sumPrinterUsage(ctx, postgresAnalytics, r)
+}
+
+func (c *postgresClient) ListTopRequesters(ctx context.Context, r models.AnalyticsRange, limit int) ([]*models.RequesterUsage, error) {
+	return c.listTopRequesters(ctx, postgresAnalytics, r, limit)
+}
+
+func (c *postgresClient) GetUserPrintTotals(ctx context.Context, userID string) (*models.UserPrintTotals, error) {
+	return c.getUserPrintTotals(ctx, postgresAnalytics, userID)
+}
+
+func (c *postgresClient) ListUserMonthlyHistory(ctx context.Context, userID string, since time.Time) ([]*models.UserMonthStats, error) {
+	return c.listUserMonthlyHistory(ctx, postgresAnalytics, userID, since)
+}
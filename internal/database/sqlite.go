@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log/slog"
+	"time"
 
 	"github.com/bjschafer/print-dis/internal/models"
 	"github.com/jmoiron/sqlx"
@@ -108,8 +109,19 @@ func (c *sqliteClient) ListPrinters(ctx context.Context) ([]*models.Printer, err
 
 // Filament operations
 func (c *sqliteClient) CreateFilament(ctx context.Context, filament *models.Filament) error {
-	query := `INSERT INTO filaments (name, material_id) VALUES (?, ?)`
-	result, err := c.db.ExecContext(ctx, query, filament.Name, filament.Material.Id)
+	query := `
+		INSERT INTO filaments (name, material_id, vendor, color_hex, weight, price, settings_extruder_temp, settings_bed_temp)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := c.db.ExecContext(ctx, query,
+		filament.Name,
+		filament.Material.Id,
+		filament.Vendor,
+		filament.ColorHex,
+		filament.Weight,
+		filament.Price,
+		filament.ExtruderTemp,
+		filament.BedTemp,
+	)
 	if err != nil {
 		return fmt.Errorf("failed to create filament: %w", err)
 	}
@@ -123,11 +135,7 @@ func (c *sqliteClient) CreateFilament(ctx context.Context, filament *models.Fila
 }
 
 func (c *sqliteClient) GetFilament(ctx context.Context, id int) (*models.Filament, error) {
-	query := `
-		SELECT f.id, f.name, m.id as "material.id", m.name as "material.name" 
-		FROM filaments f 
-		JOIN materials m ON f.material_id = m.id 
-		WHERE f.id = ?`
+	query := filamentSelect + ` WHERE f.id = ?`
 
 	filament := &models.Filament{}
 	err := c.db.GetContext(ctx, filament, query, id)
@@ -141,8 +149,22 @@ func (c *sqliteClient) GetFilament(ctx context.Context, id int) (*models.Filamen
 }
 
 func (c *sqliteClient) UpdateFilament(ctx context.Context, filament *models.Filament) error {
-	query := `UPDATE filaments SET name = ?, material_id = ? WHERE id = ?`
-	_, err := c.db.ExecContext(ctx, query, filament.Name, filament.Material.Id, filament.Id)
+	query := `
+		UPDATE filaments
+		SET name = ?, material_id = ?, vendor = ?, color_hex = ?, weight = ?, price = ?,
+			settings_extruder_temp = ?, settings_bed_temp = ?
+		WHERE id = ?`
+	_, err := c.db.ExecContext(ctx, query,
+		filament.Name,
+		filament.Material.Id,
+		filament.Vendor,
+		filament.ColorHex,
+		filament.Weight,
+		filament.Price,
+		filament.ExtruderTemp,
+		filament.BedTemp,
+		filament.Id,
+	)
 	if err != nil {
 		return fmt.Errorf("failed to update filament: %w", err)
 	}
@@ -159,10 +181,7 @@ func (c *sqliteClient) DeleteFilament(ctx context.Context, id int) error {
 }
 
 func (c *sqliteClient) ListFilaments(ctx context.Context) ([]*models.Filament, error) {
-	query := `
-		SELECT f.id, f.name, m.id as "material.id", m.name as "material.name" 
-		FROM filaments f 
-		JOIN materials m ON f.material_id = m.id`
+	query := filamentSelect + ` ORDER BY f.vendor, f.name`
 
 	filaments := []*models.Filament{}
 	err := c.db.SelectContext(ctx, &filaments, query)
@@ -172,6 +191,93 @@ func (c *sqliteClient) ListFilaments(ctx context.Context) ([]*models.Filament, e
 	return filaments, nil
 }
 
+// Spool operations
+func (c *sqliteClient) CreateSpool(ctx context.Context, spool *models.Spool) error {
+	if spool.CreatedAt.IsZero() {
+		spool.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO spools (filament_id, initial_weight, remaining_weight, location, lot_nr, comment, archived, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := c.db.ExecContext(ctx, query,
+		spool.Filament.Id,
+		spool.InitialWeight,
+		spool.RemainingWeight,
+		spool.Location,
+		spool.LotNr,
+		spool.Comment,
+		spool.Archived,
+		spool.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create spool: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	spool.Id = int(id)
+	return nil
+}
+
+func (c *sqliteClient) GetSpool(ctx context.Context, id int) (*models.Spool, error) {
+	query := spoolSelect + ` WHERE s.id = ?`
+
+	spool := &models.Spool{}
+	err := c.db.GetContext(ctx, spool, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get spool: %w", err)
+	}
+	return spool, nil
+}
+
+func (c *sqliteClient) UpdateSpool(ctx context.Context, spool *models.Spool) error {
+	query := `
+		UPDATE spools
+		SET filament_id = ?, initial_weight = ?, remaining_weight = ?, location = ?,
+			lot_nr = ?, comment = ?, archived = ?
+		WHERE id = ?`
+	_, err := c.db.ExecContext(ctx, query,
+		spool.Filament.Id,
+		spool.InitialWeight,
+		spool.RemainingWeight,
+		spool.Location,
+		spool.LotNr,
+		spool.Comment,
+		spool.Archived,
+		spool.Id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update spool: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) DeleteSpool(ctx context.Context, id int) error {
+	query := `DELETE FROM spools WHERE id = ?`
+	_, err := c.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete spool: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) ListSpools(ctx context.Context) ([]*models.Spool, error) {
+	query := spoolSelect + ` ORDER BY s.id`
+
+	spools := []*models.Spool{}
+	err := c.db.SelectContext(ctx, &spools, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query spools: %w", err)
+	}
+	return spools, nil
+}
+
 // Job operations
 func (c *sqliteClient) CreateJob(ctx context.Context, job *models.Job) error {
 	query := `INSERT INTO jobs (printer_id, filament_id, material_id) VALUES (?, ?, ?)`
@@ -268,8 +374,8 @@ func (c *sqliteClient) ListJobs(ctx context.Context) ([]*models.Job, error) {
 
 // Material operations
 func (c *sqliteClient) CreateMaterial(ctx context.Context, material *models.Material) error {
-	query := `INSERT INTO materials (name) VALUES (?)`
-	result, err := c.db.ExecContext(ctx, query, material.Name)
+	query := `INSERT INTO materials (name, density, diameter) VALUES (?, ?, ?)`
+	result, err := c.db.ExecContext(ctx, query, material.Name, material.Density, material.Diameter)
 	if err != nil {
 		return fmt.Errorf("failed to create material: %w", err)
 	}
@@ -283,18 +389,21 @@ func (c *sqliteClient) CreateMaterial(ctx context.Context, material *models.Mate
 }
 
 func (c *sqliteClient) GetMaterial(ctx context.Context, id int) (*models.Material, error) {
-	query := `SELECT id, name FROM materials WHERE id = ?`
+	query := `SELECT ` + materialColumns + ` FROM materials WHERE id = ?`
 	material := &models.Material{}
 	err := c.db.GetContext(ctx, material, query, id)
 	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
 		return nil, fmt.Errorf("failed to get material: %w", err)
 	}
 	return material, nil
 }
 
 func (c *sqliteClient) UpdateMaterial(ctx context.Context, material *models.Material) error {
-	query := `UPDATE materials SET name = ? WHERE id = ?`
-	_, err := c.db.ExecContext(ctx, query, material.Name, material.Id)
+	query := `UPDATE materials SET name = ?, density = ?, diameter = ? WHERE id = ?`
+	_, err := c.db.ExecContext(ctx, query, material.Name, material.Density, material.Diameter, material.Id)
 	if err != nil {
 		return fmt.Errorf("failed to update material: %w", err)
 	}
@@ -311,7 +420,7 @@ func (c *sqliteClient) DeleteMaterial(ctx context.Context, id int) error {
 }
 
 func (c *sqliteClient) ListMaterials(ctx context.Context) ([]*models.Material, error) {
-	query := `SELECT id, name FROM materials`
+	query := `SELECT ` + materialColumns + ` FROM materials ORDER BY name`
 	materials := []*models.Material{}
 	err := c.db.SelectContext(ctx, &materials, query)
 	if err != nil {
@@ -324,8 +433,10 @@ func (c *sqliteClient) ListMaterials(ctx context.Context) ([]*models.Material, e
 func (c *sqliteClient) CreatePrintRequest(ctx context.Context, request *models.PrintRequest) error {
 	query := `
 		INSERT INTO print_requests (
-			id, user_id, file_link, notes, spool_id, color, material, status, created_at, updated_at
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+			id, user_id, group_id, file_link, notes, spool_id, printer_id, color, material, status,
+			spool_needs_replacement, estimated_grams, estimated_hours, estimated_cost,
+			actual_grams, actual_hours, actual_cost, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	c.logger.Debug("executing create print request query",
 		"id", request.ID,
@@ -336,12 +447,21 @@ func (c *sqliteClient) CreatePrintRequest(ctx context.Context, request *models.P
 	_, err := c.db.ExecContext(ctx, query,
 		request.ID,
 		request.UserID,
+		request.GroupID,
 		request.FileLink,
 		request.Notes,
 		request.SpoolID,
+		request.PrinterID,
 		request.Color,
 		request.Material,
 		request.Status,
+		request.SpoolNeedsReplacement,
+		request.EstimatedGrams,
+		request.EstimatedHours,
+		request.EstimatedCost,
+		request.ActualGrams,
+		request.ActualHours,
+		request.ActualCost,
 		request.CreatedAt,
 		request.UpdatedAt,
 	)
@@ -358,7 +478,7 @@ func (c *sqliteClient) CreatePrintRequest(ctx context.Context, request *models.P
 
 func (c *sqliteClient) GetPrintRequest(ctx context.Context, id string) (*models.PrintRequest, error) {
 	query := `
-		SELECT id, user_id, file_link, notes, spool_id, color, material, status, created_at, updated_at
+		SELECT ` + printRequestColumns + `
 		FROM print_requests
 		WHERE id = ?`
 
@@ -384,8 +504,9 @@ func (c *sqliteClient) GetPrintRequest(ctx context.Context, id string) (*models.
 func (c *sqliteClient) UpdatePrintRequest(ctx context.Context, request *models.PrintRequest) error {
 	query := `
 		UPDATE print_requests
-		SET user_id = ?, file_link = ?, notes = ?, spool_id = ?, color = ?,
-			material = ?, status = ?, updated_at = ?
+		SET user_id = ?, group_id = ?, file_link = ?, notes = ?, spool_id = ?, printer_id = ?, color = ?,
+			material = ?, status = ?, spool_needs_replacement = ?, estimated_grams = ?, estimated_hours = ?,
+			estimated_cost = ?, actual_grams = ?, actual_hours = ?, actual_cost = ?, updated_at = ?
 		WHERE id = ?`
 
 	c.logger.Debug("executing update print request query",
@@ -396,12 +517,21 @@ func (c *sqliteClient) UpdatePrintRequest(ctx context.Context, request *models.P
 
 	_, err := c.db.ExecContext(ctx, query,
 		request.UserID,
+		request.GroupID,
 		request.FileLink,
 		request.Notes,
 		request.SpoolID,
+		request.PrinterID,
 		request.Color,
 		request.Material,
 		request.Status,
+		request.SpoolNeedsReplacement,
+		request.EstimatedGrams,
+		request.EstimatedHours,
+		request.EstimatedCost,
+		request.ActualGrams,
+		request.ActualHours,
+		request.ActualCost,
 		request.UpdatedAt,
 		request.ID,
 	)
@@ -417,25 +547,39 @@ func (c *sqliteClient) UpdatePrintRequest(ctx context.Context, request *models.P
 }
 
 func (c *sqliteClient) DeletePrintRequest(ctx context.Context, id string) error {
-	query := `DELETE FROM print_requests WHERE id = ?`
-
 	c.logger.Debug("executing delete print request query", "id", id)
 
-	_, err := c.db.ExecContext(ctx, query, id)
+	tx, err := c.db.BeginTxx(ctx, nil)
 	if err != nil {
-		c.logger.Error("failed to delete print request",
-			"error", err,
-			"id", id,
-		)
-		return fmt.Errorf("failed to delete print request: %w", err)
+		return fmt.Errorf("failed to begin transaction: %w", err)
 	}
+	defer func() {
+		if err != nil {
+			c.logger.Error("failed to delete print request",
+				"error", err,
+				"id", id,
+			)
+			_ = tx.Rollback()
+		}
+	}()
 
+	// SQLite does not enforce foreign keys, so the status history is not
+	// deleted with the request
+	if _, err = tx.ExecContext(ctx, `DELETE FROM print_request_status_events WHERE print_request_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete print request status events: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM print_requests WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete print request: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
 func (c *sqliteClient) ListPrintRequests(ctx context.Context) ([]*models.PrintRequest, error) {
 	query := `
-		SELECT id, user_id, file_link, notes, spool_id, color, material, status, created_at, updated_at
+		SELECT ` + printRequestColumns + `
 		FROM print_requests
 		ORDER BY created_at DESC`
 
@@ -459,7 +603,7 @@ func (c *sqliteClient) ListPrintRequests(ctx context.Context) ([]*models.PrintRe
 
 func (c *sqliteClient) ListPrintRequestsByUserID(ctx context.Context, userID string) ([]*models.PrintRequest, error) {
 	query := `
-		SELECT id, user_id, file_link, notes, spool_id, color, material, status, created_at, updated_at
+		SELECT ` + printRequestColumns + `
 		FROM print_requests
 		WHERE user_id = ?
 		ORDER BY created_at DESC`
@@ -484,11 +628,33 @@ func (c *sqliteClient) ListPrintRequestsByUserID(ctx context.Context, userID str
 	return requests, nil
 }
 
+func (c *sqliteClient) ListPrintRequestsBySpoolID(ctx context.Context, spoolID int) ([]*models.PrintRequest, error) {
+	query := `
+		SELECT ` + printRequestColumns + `
+		FROM print_requests
+		WHERE spool_id = ?
+		ORDER BY created_at DESC`
+
+	c.logger.Debug("executing list print requests by spool query", "spool_id", spoolID)
+
+	requests := []*models.PrintRequest{}
+	err := c.db.SelectContext(ctx, &requests, query, spoolID)
+	if err != nil {
+		c.logger.Error("failed to query print requests for spool",
+			"error", err,
+			"spool_id", spoolID,
+		)
+		return nil, fmt.Errorf("failed to query print requests for spool: %w", err)
+	}
+
+	return requests, nil
+}
+
 // User operations
 func (c *sqliteClient) CreateUser(ctx context.Context, user *models.User) error {
 	query := `
-		INSERT INTO users (id, username, email, password_hash, display_name, role, created_at, updated_at, enabled)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+		INSERT INTO users (id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
 
 	c.logger.Debug("executing create user query", "username", user.Username)
 
@@ -502,6 +668,8 @@ func (c *sqliteClient) CreateUser(ctx context.Context, user *models.User) error
 		user.CreatedAt,
 		user.UpdatedAt,
 		user.Enabled,
+		user.EmailVerifiedAt,
+		user.MustChangePassword,
 	)
 	if err != nil {
 		c.logger.Error("failed to create user", "error", err, "username", user.Username)
@@ -513,7 +681,7 @@ func (c *sqliteClient) CreateUser(ctx context.Context, user *models.User) error
 
 func (c *sqliteClient) GetUser(ctx context.Context, id string) (*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled
+		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password
 		FROM users
 		WHERE id = ?`
 
@@ -531,7 +699,7 @@ func (c *sqliteClient) GetUser(ctx context.Context, id string) (*models.User, er
 
 func (c *sqliteClient) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled
+		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password
 		FROM users
 		WHERE username = ?`
 
@@ -549,7 +717,7 @@ func (c *sqliteClient) GetUserByUsername(ctx context.Context, username string) (
 
 func (c *sqliteClient) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled
+		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password
 		FROM users
 		WHERE email = ?`
 
@@ -568,7 +736,7 @@ func (c *sqliteClient) GetUserByEmail(ctx context.Context, email string) (*model
 func (c *sqliteClient) UpdateUser(ctx context.Context, user *models.User) error {
 	query := `
 		UPDATE users
-		SET username = ?, email = ?, password_hash = ?, display_name = ?, role = ?, updated_at = ?, enabled = ?
+		SET username = ?, email = ?, password_hash = ?, display_name = ?, role = ?, updated_at = ?, enabled = ?, email_verified_at = ?, must_change_password = ?
 		WHERE id = ?`
 
 	_, err := c.db.ExecContext(ctx, query,
@@ -579,6 +747,8 @@ func (c *sqliteClient) UpdateUser(ctx context.Context, user *models.User) error
 		user.Role,
 		user.UpdatedAt,
 		user.Enabled,
+		user.EmailVerifiedAt,
+		user.MustChangePassword,
 		user.ID,
 	)
 	if err != nil {
@@ -599,7 +769,7 @@ func (c *sqliteClient) DeleteUser(ctx context.Context, id string) error {
 
 func (c *sqliteClient) ListUsers(ctx context.Context) ([]*models.User, error) {
 	query := `
-		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled
+		SELECT id, username, email, password_hash, display_name, role, created_at, updated_at, enabled, email_verified_at, must_change_password
 		FROM users
 		ORDER BY created_at DESC`
 
@@ -611,3 +781,1103 @@ func (c *sqliteClient) ListUsers(ctx context.Context) ([]*models.User, error) {
 
 	return users, nil
 }
+
+// Billing operations
+func (c *sqliteClient) CreateCharge(ctx context.Context, charge *models.Charge) error {
+	now := time.Now()
+	charge.CreatedAt = now
+	charge.UpdatedAt = now
+
+	query := `
+		INSERT INTO charges (user_id, print_request_id, amount_cents, description, waived, waived_reason, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := c.db.ExecContext(ctx, query,
+		charge.UserID,
+		charge.PrintRequestID,
+		charge.Amount,
+		charge.Description,
+		charge.Waived,
+		charge.WaivedReason,
+		charge.CreatedAt,
+		charge.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create charge: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	charge.ID = int(id)
+	return nil
+}
+
+func (c *sqliteClient) GetCharge(ctx context.Context, id int) (*models.Charge, error) {
+	query := `SELECT ` + chargeColumns + ` FROM charges WHERE id = ?`
+
+	charge := &models.Charge{}
+	err := c.db.GetContext(ctx, charge, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get charge: %w", err)
+	}
+	return charge, nil
+}
+
+func (c *sqliteClient) GetChargeByPrintRequestID(ctx context.Context, printRequestID string) (*models.Charge, error) {
+	query := `SELECT ` + chargeColumns + ` FROM charges WHERE print_request_id = ?`
+
+	charge := &models.Charge{}
+	err := c.db.GetContext(ctx, charge, query, printRequestID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get charge: %w", err)
+	}
+	return charge, nil
+}
+
+func (c *sqliteClient) UpdateCharge(ctx context.Context, charge *models.Charge) error {
+	charge.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE charges
+		SET amount_cents = ?, description = ?, waived = ?, waived_reason = ?, updated_at = ?
+		WHERE id = ?`
+	_, err := c.db.ExecContext(ctx, query,
+		charge.Amount,
+		charge.Description,
+		charge.Waived,
+		charge.WaivedReason,
+		charge.UpdatedAt,
+		charge.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update charge: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) ListChargesByUserID(ctx context.Context, userID string) ([]*models.Charge, error) {
+	query := `SELECT ` + chargeColumns + ` FROM charges WHERE user_id = ? ORDER BY created_at, id`
+
+	charges := []*models.Charge{}
+	err := c.db.SelectContext(ctx, &charges, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query charges: %w", err)
+	}
+	return charges, nil
+}
+
+func (c *sqliteClient) CreatePayment(ctx context.Context, payment *models.Payment) error {
+	if payment.CreatedAt.IsZero() {
+		payment.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO payments (user_id, amount_cents, method, reference, note, recorded_by, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := c.db.ExecContext(ctx, query,
+		payment.UserID,
+		payment.Amount,
+		payment.Method,
+		payment.Reference,
+		payment.Note,
+		payment.RecordedBy,
+		payment.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create payment: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	payment.ID = int(id)
+	return nil
+}
+
+func (c *sqliteClient) ListPaymentsByUserID(ctx context.Context, userID string) ([]*models.Payment, error) {
+	query := `SELECT ` + paymentColumns + ` FROM payments WHERE user_id = ? ORDER BY created_at, id`
+
+	payments := []*models.Payment{}
+	err := c.db.SelectContext(ctx, &payments, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query payments: %w", err)
+	}
+	return payments, nil
+}
+
+func (c *sqliteClient) GetBalance(ctx context.Context, userID string) (*models.Balance, error) {
+	query := balanceSelect + ` WHERE u.id = ?`
+
+	balance := &models.Balance{}
+	err := c.db.GetContext(ctx, balance, query, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get balance: %w", err)
+	}
+	return balance, nil
+}
+
+func (c *sqliteClient) ListBalances(ctx context.Context) ([]*models.Balance, error) {
+	query := balanceSelect + ` ORDER BY u.username`
+
+	balances := []*models.Balance{}
+	err := c.db.SelectContext(ctx, &balances, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query balances: %w", err)
+	}
+	return balances, nil
+}
+
+// Quota override operations
+func (c *sqliteClient) CreateQuotaOverride(ctx context.Context, override *models.QuotaOverride) error {
+	now := time.Now()
+	override.CreatedAt = now
+	override.UpdatedAt = now
+
+	query := `
+		INSERT INTO quota_overrides (scope, subject, max_open_requests, monthly_grams, monthly_hours, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	result, err := c.db.ExecContext(ctx, query,
+		override.Scope,
+		override.Subject,
+		override.MaxOpenRequests,
+		override.MonthlyGrams,
+		override.MonthlyHours,
+		override.CreatedAt,
+		override.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create quota override: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to get last insert id: %w", err)
+	}
+	override.ID = int(id)
+	return nil
+}
+
+func (c *sqliteClient) GetQuotaOverride(ctx context.Context, scope models.QuotaScope, subject string) (*models.QuotaOverride, error) {
+	query := `SELECT ` + quotaOverrideColumns + ` FROM quota_overrides WHERE scope = ? AND subject = ?`
+
+	override := &models.QuotaOverride{}
+	err := c.db.GetContext(ctx, override, query, scope, subject)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get quota override: %w", err)
+	}
+	return override, nil
+}
+
+func (c *sqliteClient) UpdateQuotaOverride(ctx context.Context, override *models.QuotaOverride) error {
+	override.UpdatedAt = time.Now()
+
+	query := `
+		UPDATE quota_overrides
+		SET max_open_requests = ?, monthly_grams = ?, monthly_hours = ?, updated_at = ?
+		WHERE id = ?`
+	_, err := c.db.ExecContext(ctx, query,
+		override.MaxOpenRequests,
+		override.MonthlyGrams,
+		override.MonthlyHours,
+		override.UpdatedAt,
+		override.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update quota override: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) DeleteQuotaOverride(ctx context.Context, id int) error {
+	query := `DELETE FROM quota_overrides WHERE id = ?`
+	_, err := c.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete quota override: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) ListQuotaOverrides(ctx context.Context) ([]*models.QuotaOverride, error) {
+	query := `SELECT ` + quotaOverrideColumns + ` FROM quota_overrides ORDER BY scope, subject`
+
+	overrides := []*models.QuotaOverride{}
+	err := c.db.SelectContext(ctx, &overrides, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query quota overrides: %w", err)
+	}
+	return overrides, nil
+}
+
+// Group operations
+func (c *sqliteClient) CreateGroup(ctx context.Context, group *models.Group) error {
+	now := time.Now()
+	group.CreatedAt = now
+	group.UpdatedAt = now
+
+	query := `INSERT INTO groups (id, name, description, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`
+	_, err := c.db.ExecContext(ctx, query, group.ID, group.Name, group.Description, group.CreatedAt, group.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create group: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) GetGroup(ctx context.Context, id string) (*models.Group, error) {
+	query := `SELECT ` + groupColumns + ` FROM groups WHERE id = ?`
+
+	group := &models.Group{}
+	err := c.db.GetContext(ctx, group, query, id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get group: %w", err)
+	}
+	return group, nil
+}
+
+func (c *sqliteClient) UpdateGroup(ctx context.Context, group *models.Group) error {
+	group.UpdatedAt = time.Now()
+
+	query := `UPDATE groups SET name = ?, description = ?, updated_at = ? WHERE id = ?`
+	_, err := c.db.ExecContext(ctx, query, group.Name, group.Description, group.UpdatedAt, group.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update group: %w", err)
+	}
+	return nil
+}
+
+// DeleteGroup deletes a group and its memberships. Its print requests are kept
+// without a group.
+func (c *sqliteClient) DeleteGroup(ctx context.Context, id string) error {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `UPDATE print_requests SET group_id = NULL WHERE group_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to clear group from print requests: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM group_memberships WHERE group_id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete group memberships: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM groups WHERE id = ?`, id); err != nil {
+		return fmt.Errorf("failed to delete group: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) ListGroups(ctx context.Context) ([]*models.Group, error) {
+	query := `SELECT ` + groupColumns + ` FROM groups ORDER BY name`
+
+	groups := []*models.Group{}
+	err := c.db.SelectContext(ctx, &groups, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query groups: %w", err)
+	}
+	return groups, nil
+}
+
+// SetGroupMembership adds a user to a group, or changes their role if they
+// are already a member
+func (c *sqliteClient) SetGroupMembership(ctx context.Context, membership *models.GroupMembership) error {
+	if membership.CreatedAt.IsZero() {
+		membership.CreatedAt = time.Now()
+	}
+
+	query := `
+		INSERT INTO group_memberships (group_id, user_id, role, created_at)
+		VALUES (?, ?, ?, ?)
+		ON CONFLICT (group_id, user_id) DO UPDATE SET role = excluded.role`
+	_, err := c.db.ExecContext(ctx, query, membership.GroupID, membership.UserID, membership.Role, membership.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to set group membership: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) DeleteGroupMembership(ctx context.Context, groupID, userID string) error {
+	query := `DELETE FROM group_memberships WHERE group_id = ? AND user_id = ?`
+	_, err := c.db.ExecContext(ctx, query, groupID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete group membership: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) ListGroupMembers(ctx context.Context, groupID string) ([]*models.GroupMembership, error) {
+	query := groupMembershipSelect + ` WHERE gm.group_id = ? ORDER BY u.username`
+
+	memberships := []*models.GroupMembership{}
+	err := c.db.SelectContext(ctx, &memberships, query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group members: %w", err)
+	}
+	return memberships, nil
+}
+
+func (c *sqliteClient) ListGroupMembershipsByUserID(ctx context.Context, userID string) ([]*models.GroupMembership, error) {
+	query := groupMembershipSelect + ` WHERE gm.user_id = ? ORDER BY g.name`
+
+	memberships := []*models.GroupMembership{}
+	err := c.db.SelectContext(ctx, &memberships, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query group memberships: %w", err)
+	}
+	return memberships, nil
+}
+
+func (c *sqliteClient) ListPrintRequestsByGroupID(ctx context.Context, groupID string) ([]*models.PrintRequest, error) {
+	query := `
+		SELECT ` + printRequestColumns + `
+		FROM print_requests
+		WHERE group_id = ?
+		ORDER BY created_at DESC`
+
+	requests := []*models.PrintRequest{}
+	err := c.db.SelectContext(ctx, &requests, query, groupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query print requests for group: %w", err)
+	}
+	return requests, nil
+}
+
+func (c *sqliteClient) CreateRole(ctx context.Context, role *models.RoleDefinition) error {
+	now := time.Now()
+	role.CreatedAt = now
+	role.UpdatedAt = now
+
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `INSERT INTO roles (name, description, built_in, created_at, updated_at) VALUES (?, ?, ?, ?, ?)`
+	if _, err = tx.ExecContext(ctx, query, role.Name, role.Description, role.BuiltIn, role.CreatedAt, role.UpdatedAt); err != nil {
+		return fmt.Errorf("failed to create role: %w", err)
+	}
+	if err = replaceRolePermissions(ctx, tx, role); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) GetRole(ctx context.Context, name models.Role) (*models.RoleDefinition, error) {
+	query := `SELECT ` + roleColumns + ` FROM roles WHERE name = ?`
+
+	role := &models.RoleDefinition{}
+	err := c.db.GetContext(ctx, role, query, name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+
+	role.Permissions = []models.Permission{}
+	query = `SELECT permission FROM role_permissions WHERE role = ? ORDER BY permission`
+	if err := c.db.SelectContext(ctx, &role.Permissions, query, name); err != nil {
+		return nil, fmt.Errorf("failed to query role permissions: %w", err)
+	}
+	return role, nil
+}
+
+func (c *sqliteClient) UpdateRole(ctx context.Context, role *models.RoleDefinition) error {
+	role.UpdatedAt = time.Now()
+
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	query := `UPDATE roles SET description = ?, updated_at = ? WHERE name = ?`
+	if _, err = tx.ExecContext(ctx, query, role.Description, role.UpdatedAt, role.Name); err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+	if err = replaceRolePermissions(ctx, tx, role); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) DeleteRole(ctx context.Context, name models.Role) error {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM role_permissions WHERE role = ?`, name); err != nil {
+		return fmt.Errorf("failed to delete role permissions: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM roles WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("failed to delete role: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) ListRoles(ctx context.Context) ([]*models.RoleDefinition, error) {
+	query := `SELECT ` + roleColumns + ` FROM roles ORDER BY name`
+
+	roles := []*models.RoleDefinition{}
+	if err := c.db.SelectContext(ctx, &roles, query); err != nil {
+		return nil, fmt.Errorf("failed to query roles: %w", err)
+	}
+	if err := loadRolePermissions(ctx, c.db, roles); err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+// OIDC identity operations
+func (c *sqliteClient) CreateOIDCIdentity(ctx context.Context, identity *models.UserOIDCIdentity) error {
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO user_oidc_identities (id, user_id, provider_name, subject, created_at) VALUES (?, ?, ?, ?, ?)`
+	_, err := c.db.ExecContext(ctx, query, identity.ID, identity.UserID, identity.ProviderName, identity.Subject, identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create OIDC identity: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) GetOIDCIdentity(ctx context.Context, providerName, subject string) (*models.UserOIDCIdentity, error) {
+	query := `SELECT id, user_id, provider_name, subject, created_at FROM user_oidc_identities WHERE provider_name = ? AND subject = ?`
+
+	identity := &models.UserOIDCIdentity{}
+	err := c.db.GetContext(ctx, identity, query, providerName, subject)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get OIDC identity: %w", err)
+	}
+	return identity, nil
+}
+
+// LDAP identity operations
+func (c *sqliteClient) CreateLDAPIdentity(ctx context.Context, identity *models.UserLDAPIdentity) error {
+	if identity.CreatedAt.IsZero() {
+		identity.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO user_ldap_identities (id, user_id, provider_name, subject, created_at) VALUES (?, ?, ?, ?, ?)`
+	_, err := c.db.ExecContext(ctx, query, identity.ID, identity.UserID, identity.ProviderName, identity.Subject, identity.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create LDAP identity: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) GetLDAPIdentity(ctx context.Context, providerName, subject string) (*models.UserLDAPIdentity, error) {
+	query := `SELECT id, user_id, provider_name, subject, created_at FROM user_ldap_identities WHERE provider_name = ? AND subject = ?`
+
+	identity := &models.UserLDAPIdentity{}
+	err := c.db.GetContext(ctx, identity, query, providerName, subject)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get LDAP identity: %w", err)
+	}
+	return identity, nil
+}
+
+// API token operations
+func (c *sqliteClient) CreateAPIToken(ctx context.Context, token *models.APIToken) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO api_tokens (` + apiTokenColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := c.db.ExecContext(ctx, query,
+		token.ID,
+		token.UserID,
+		token.Name,
+		token.TokenHash,
+		token.Prefix,
+		joinScopes(token.Scopes),
+		token.ExpiresAt,
+		token.LastUsedAt,
+		token.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create API token: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE token_hash = ?`
+
+	var row apiTokenRow
+	err := c.db.GetContext(ctx, &row, query, tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+	return row.toModel(), nil
+}
+
+func (c *sqliteClient) ListAPITokensByUserID(ctx context.Context, userID string) ([]*models.APIToken, error) {
+	query := `SELECT ` + apiTokenColumns + ` FROM api_tokens WHERE user_id = ? ORDER BY created_at DESC`
+
+	var rows []apiTokenRow
+	if err := c.db.SelectContext(ctx, &rows, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to query API tokens: %w", err)
+	}
+	tokens := make([]*models.APIToken, 0, len(rows))
+	for i := range rows {
+		tokens = append(tokens, rows[i].toModel())
+	}
+	return tokens, nil
+}
+
+func (c *sqliteClient) UpdateAPITokenLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error {
+	query := `UPDATE api_tokens SET last_used_at = ? WHERE id = ?`
+	if _, err := c.db.ExecContext(ctx, query, lastUsedAt, id); err != nil {
+		return fmt.Errorf("failed to update API token: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) DeleteAPIToken(ctx context.Context, id string) error {
+	query := `DELETE FROM api_tokens WHERE id = ?`
+	if _, err := c.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete API token: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) DeleteAPITokensByUserID(ctx context.Context, userID string) error {
+	query := `DELETE FROM api_tokens WHERE user_id = ?`
+	if _, err := c.db.ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to delete API tokens: %w", err)
+	}
+	return nil
+}
+
+// User session operations
+func (c *sqliteClient) CreateUserSession(ctx context.Context, session *models.UserSession) error {
+	query := `
+		INSERT INTO user_sessions (id, user_id, session_token, data, user_agent, ip_address, expires_at, created_at, last_seen_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := c.db.ExecContext(ctx, query,
+		session.ID,
+		nullIfEmpty(session.UserID),
+		session.SessionToken,
+		session.Data,
+		session.UserAgent,
+		session.IPAddress,
+		session.ExpiresAt,
+		session.CreatedAt,
+		session.LastSeenAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) GetUserSessionByToken(ctx context.Context, tokenHash string) (*models.UserSession, error) {
+	query := `SELECT ` + userSessionColumns + ` FROM user_sessions WHERE session_token = ?`
+
+	session := &models.UserSession{}
+	err := c.db.GetContext(ctx, session, query, tokenHash)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	return session, nil
+}
+
+func (c *sqliteClient) UpdateUserSession(ctx context.Context, session *models.UserSession) error {
+	query := `
+		UPDATE user_sessions SET user_id = ?, data = ?, expires_at = ?, last_seen_at = ?
+		WHERE session_token = ?`
+	_, err := c.db.ExecContext(ctx, query, nullIfEmpty(session.UserID), session.Data, session.ExpiresAt, session.LastSeenAt, session.SessionToken)
+	if err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) TouchUserSession(ctx context.Context, id string, lastSeenAt time.Time, ipAddress string) error {
+	query := `UPDATE user_sessions SET last_seen_at = ?, ip_address = ? WHERE id = ?`
+	if _, err := c.db.ExecContext(ctx, query, lastSeenAt, ipAddress, id); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) ListUserSessionsByUserID(ctx context.Context, userID string, now time.Time) ([]*models.UserSession, error) {
+	query := `SELECT ` + userSessionColumns + ` FROM user_sessions WHERE user_id = ? AND expires_at > ? ORDER BY last_seen_at DESC`
+
+	sessions := []*models.UserSession{}
+	if err := c.db.SelectContext(ctx, &sessions, query, userID, now); err != nil {
+		return nil, fmt.Errorf("failed to query sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (c *sqliteClient) DeleteUserSession(ctx context.Context, id string) error {
+	query := `DELETE FROM user_sessions WHERE id = ?`
+	if _, err := c.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) DeleteUserSessionsByUserID(ctx context.Context, userID, exceptID string) error {
+	query := `DELETE FROM user_sessions WHERE user_id = ? AND id <> ?`
+	if _, err := c.db.ExecContext(ctx, query, userID, exceptID); err != nil {
+		return fmt.Errorf("failed to delete sessions: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) DeleteExpiredUserSessions(ctx context.Context, now time.Time) (int64, error) {
+	query := `DELETE FROM user_sessions WHERE expires_at <= ?`
+	result, err := c.db.ExecContext(ctx, query, now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete expired sessions: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Two-factor authentication operations
+func (c *sqliteClient) SaveUserTOTP(ctx context.Context, totp *models.UserTOTP) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret, enabled, last_counter, created_at, enabled_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, enabled = excluded.enabled,
+			last_counter = excluded.last_counter, created_at = excluded.created_at, enabled_at = excluded.enabled_at`
+	_, err := c.db.ExecContext(ctx, query, totp.UserID, totp.Secret, totp.Enabled, totp.LastCounter, totp.CreatedAt, totp.EnabledAt)
+	if err != nil {
+		return fmt.Errorf("failed to save TOTP enrolment: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) GetUserTOTP(ctx context.Context, userID string) (*models.UserTOTP, error) {
+	query := `SELECT ` + userTOTPColumns + ` FROM user_totp WHERE user_id = ?`
+
+	totp := &models.UserTOTP{}
+	err := c.db.GetContext(ctx, totp, query, userID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get TOTP enrolment: %w", err)
+	}
+	return totp, nil
+}
+
+func (c *sqliteClient) UpdateUserTOTPCounter(ctx context.Context, userID string, counter int64) (bool, error) {
+	// Only move forwards, so that concurrent logins cannot both use a code
+	query := `UPDATE user_totp SET last_counter = ? WHERE user_id = ? AND last_counter < ?`
+	result, err := c.db.ExecContext(ctx, query, counter, userID, counter)
+	if err != nil {
+		return false, fmt.Errorf("failed to update TOTP counter: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update TOTP counter: %w", err)
+	}
+	return rows > 0, nil
+}
+
+func (c *sqliteClient) DeleteUserTOTP(ctx context.Context, userID string) error {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_totp WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete TOTP enrolment: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) ReplaceRecoveryCodes(ctx context.Context, userID string, codes []*models.RecoveryCode) error {
+	tx, err := c.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if _, err = tx.ExecContext(ctx, `DELETE FROM user_recovery_codes WHERE user_id = ?`, userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	query := `INSERT INTO user_recovery_codes (id, user_id, code_hash, created_at) VALUES (?, ?, ?, ?)`
+	for _, code := range codes {
+		if _, err = tx.ExecContext(ctx, query, code.ID, userID, code.CodeHash, code.CreatedAt); err != nil {
+			return fmt.Errorf("failed to create recovery code: %w", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) UseRecoveryCode(ctx context.Context, userID, codeHash string, usedAt time.Time) (bool, error) {
+	query := `UPDATE user_recovery_codes SET used_at = ? WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`
+	result, err := c.db.ExecContext(ctx, query, usedAt, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	return rows > 0, nil
+}
+
+func (c *sqliteClient) CountUnusedRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	query := `SELECT COUNT(*) FROM user_recovery_codes WHERE user_id = ? AND used_at IS NULL`
+
+	var count int
+	if err := c.db.GetContext(ctx, &count, query, userID); err != nil {
+		return 0, fmt.Errorf("failed to count recovery codes: %w", err)
+	}
+	return count, nil
+}
+
+// WebAuthn credential operations
+func (c *sqliteClient) CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	if credential.CreatedAt.IsZero() {
+		credential.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO user_webauthn_credentials (` + webAuthnCredentialColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := c.db.ExecContext(ctx, query,
+		credential.ID,
+		credential.UserID,
+		credential.Name,
+		credential.CredentialID,
+		credential.PublicKey,
+		credential.SignCount,
+		credential.CreatedAt,
+		credential.LastUsedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create WebAuthn credential: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) GetWebAuthnCredential(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM user_webauthn_credentials WHERE credential_id = ?`
+
+	credential := &models.WebAuthnCredential{}
+	err := c.db.GetContext(ctx, credential, query, credentialID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get WebAuthn credential: %w", err)
+	}
+	return credential, nil
+}
+
+func (c *sqliteClient) ListWebAuthnCredentialsByUserID(ctx context.Context, userID string) ([]*models.WebAuthnCredential, error) {
+	query := `SELECT ` + webAuthnCredentialColumns + ` FROM user_webauthn_credentials WHERE user_id = ? ORDER BY created_at`
+
+	var credentials []*models.WebAuthnCredential
+	if err := c.db.SelectContext(ctx, &credentials, query, userID); err != nil {
+		return nil, fmt.Errorf("failed to query WebAuthn credentials: %w", err)
+	}
+	return credentials, nil
+}
+
+func (c *sqliteClient) UpdateWebAuthnCredentialUsage(ctx context.Context, id string, signCount int64, lastUsedAt time.Time) error {
+	query := `UPDATE user_webauthn_credentials SET sign_count = ?, last_used_at = ? WHERE id = ?`
+	if _, err := c.db.ExecContext(ctx, query, signCount, lastUsedAt, id); err != nil {
+		return fmt.Errorf("failed to update WebAuthn credential: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) DeleteWebAuthnCredential(ctx context.Context, id string) error {
+	query := `DELETE FROM user_webauthn_credentials WHERE id = ?`
+	if _, err := c.db.ExecContext(ctx, query, id); err != nil {
+		return fmt.Errorf("failed to delete WebAuthn credential: %w", err)
+	}
+	return nil
+}
+
+// Email token operations
+func (c *sqliteClient) CreateEmailToken(ctx context.Context, token *models.EmailToken) error {
+	if token.CreatedAt.IsZero() {
+		token.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO email_tokens (` + emailTokenColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := c.db.ExecContext(ctx, query,
+		token.ID,
+		token.UserID,
+		token.Purpose,
+		token.TokenHash,
+		token.Email,
+		token.ExpiresAt,
+		token.UsedAt,
+		token.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create email token: %w", err)
+	}
+	return nil
+}
+
+// UseEmailToken marks an unused, unexpired token as used and returns it, or
+// nil if there is no such token
+func (c *sqliteClient) UseEmailToken(ctx context.Context, purpose models.EmailTokenPurpose, tokenHash string, usedAt time.Time) (*models.EmailToken, error) {
+	query := `UPDATE email_tokens SET used_at = ? WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?`
+	result, err := c.db.ExecContext(ctx, query, usedAt, tokenHash, purpose, usedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to use email token: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return nil, fmt.Errorf("failed to use email token: %w", err)
+	}
+	if rows == 0 {
+		return nil, nil
+	}
+
+	token := &models.EmailToken{}
+	query = `SELECT ` + emailTokenColumns + ` FROM email_tokens WHERE token_hash = ?`
+	if err := c.db.GetContext(ctx, token, query, tokenHash); err != nil {
+		return nil, fmt.Errorf("failed to get email token: %w", err)
+	}
+	return token, nil
+}
+
+func (c *sqliteClient) DeleteEmailTokensByUserID(ctx context.Context, userID string, purpose models.EmailTokenPurpose) error {
+	query := `DELETE FROM email_tokens WHERE user_id = ? AND purpose = ?`
+	if _, err := c.db.ExecContext(ctx, query, userID, purpose); err != nil {
+		return fmt.Errorf("failed to delete email tokens: %w", err)
+	}
+	return nil
+}
+
+// Failed login operations
+func (c *sqliteClient) GetLoginAttempts(ctx context.Context, username string) (*models.LoginAttempts, error) {
+	query := `SELECT ` + loginAttemptsColumns + ` FROM login_attempts WHERE username = ?`
+
+	attempts := &models.LoginAttempts{}
+	err := c.db.GetContext(ctx, attempts, query, username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to get login attempts: %w", err)
+	}
+	return attempts, nil
+}
+
+// RecordLoginFailure counts a failed login to the username and returns its
+// failures. Counting starts again if the last failure was before since.
+func (c *sqliteClient) RecordLoginFailure(ctx context.Context, username string, failedAt, since time.Time) (*models.LoginAttempts, error) {
+	query := `
+		INSERT INTO login_attempts (username, failed_count, last_failed_at) VALUES (?, 1, ?)
+		ON CONFLICT (username) DO UPDATE SET
+			failed_count = CASE WHEN login_attempts.last_failed_at < ? THEN 1 ELSE login_attempts.failed_count + 1 END,
+			locked_until = CASE WHEN login_attempts.last_failed_at < ? THEN NULL ELSE login_attempts.locked_until END,
+			last_failed_at = excluded.last_failed_at`
+	if _, err := c.db.ExecContext(ctx, query, username, failedAt, since, since); err != nil {
+		return nil, fmt.Errorf("failed to record login failure: %w", err)
+	}
+
+	attempts, err := c.GetLoginAttempts(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	if attempts == nil {
+		return nil, fmt.Errorf("failed to record login failure: no login attempts for %q", username)
+	}
+	return attempts, nil
+}
+
+// LockLogin refuses logins to the username until the time, and returns false
+// if it was already locked
+func (c *sqliteClient) LockLogin(ctx context.Context, username string, until, now time.Time) (bool, error) {
+	query := `UPDATE login_attempts SET locked_until = ? WHERE username = ? AND (locked_until IS NULL OR locked_until <= ?)`
+	result, err := c.db.ExecContext(ctx, query, until, username, now)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock login: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to lock login: %w", err)
+	}
+	return rows > 0, nil
+}
+
+func (c *sqliteClient) DeleteLoginAttempts(ctx context.Context, username string) error {
+	query := `DELETE FROM login_attempts WHERE username = ?`
+	if _, err := c.db.ExecContext(ctx, query, username); err != nil {
+		return fmt.Errorf("failed to delete login attempts: %w", err)
+	}
+	return nil
+}
+
+// DeleteStaleLoginAttempts forgets usernames whose last failed login was
+// before the time and that are not locked
+func (c *sqliteClient) DeleteStaleLoginAttempts(ctx context.Context, before time.Time) (int64, error) {
+	query := `DELETE FROM login_attempts WHERE last_failed_at < ? AND (locked_until IS NULL OR locked_until < ?)`
+	result, err := c.db.ExecContext(ctx, query, before, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete stale login attempts: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+// Invitation operations
+func (c *sqliteClient) CreateInvitation(ctx context.Context, invitation *models.Invitation) error {
+	if invitation.CreatedAt.IsZero() {
+		invitation.CreatedAt = time.Now()
+	}
+
+	query := `INSERT INTO invitations (` + invitationColumns + `) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := c.db.ExecContext(ctx, query,
+		invitation.ID,
+		invitation.CodeHash,
+		invitation.Prefix,
+		invitation.Email,
+		invitation.Role,
+		invitation.GroupID,
+		invitation.MaxUses,
+		invitation.Uses,
+		invitation.ExpiresAt,
+		invitation.RevokedAt,
+		invitation.CreatedBy,
+		invitation.CreatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create invitation: %w", err)
+	}
+	return nil
+}
+
+func (c *sqliteClient) ListInvitations(ctx context.Context) ([]*models.Invitation, error) {
+	query := `SELECT ` + invitationColumns + ` FROM invitations ORDER BY created_at DESC`
+
+	var invitations []*models.Invitation
+	if err := c.db.SelectContext(ctx, &invitations, query); err != nil {
+		return nil, fmt.Errorf("failed to list invitations: %w", err)
+	}
+	return invitations, nil
+}
+
+// RevokeInvitation stops an invitation from being used, and returns false if
+// there is no such invitation or it was already revoked
+func (c *sqliteClient) RevokeInvitation(ctx context.Context, id string, revokedAt time.Time) (bool, error) {
+	query := `UPDATE invitations SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`
+	result, err := c.db.ExecContext(ctx, query, revokedAt, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to revoke invitation: %w", err)
+	}
+	return rows > 0, nil
+}
+
+// Print request analytics
+
+func (c *sqliteClient) CountPrintRequestStatuses(ctx context.Context, r models.AnalyticsRange, bucket models.AnalyticsBucket) ([]*models.StatusCount, error) {
+	return c.countPrintRequestStatuses(ctx, sqliteAnalytics, r, bucket)
+}
+
+func (c *sqliteClient) ListTurnarounds(ctx context.Context, r models.AnalyticsRange) ([]*models.Turnaround, error) {
+	return c.listTurnarounds(ctx, sqliteAnalytics, r)
+}
+
+func (c *sqliteClient) SumMaterialUsage(ctx context.Context, r models.AnalyticsRange) ([]*models.MaterialUsage, error) {
+	return c.sumMaterialUsage(ctx, sqliteAnalytics, r)
+}
+
+func (c *sqliteClient) SumPrinterUsage(ctx context.Context, r models.AnalyticsRange) ([]*models.PrinterUsage, error) {
+	return c.sumPrinterUsage(ctx, sqliteAnalytics, r)
+}
+
+func (c *sqliteClient) ListTopRequesters(ctx context.Context, r models.AnalyticsRange, limit int) ([]*models.RequesterUsage, error) {
+	return c.listTopRequesters(ctx, sqliteAnalytics, r, limit)
+}
+
+func (c *sqliteClient) GetUserPrintTotals(ctx context.Context, userID string) (*models.UserPrintTotals, error) {
+	return c.getUserPrintTotals(ctx, sqliteAnalytics, userID)
+}
+
+func (c *sqliteClient) ListUserMonthlyHistory(ctx context.Context, userID string, since time.Time) ([]*models.UserMonthStats, error) {
+	return c.listUserMonthlyHistory(ctx, sqliteAnalytics, userID, since)
+}
@@ -1,8 +1,12 @@
 package handlers
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log/slog"
+	"mime"
 	"net/http"
 	"time"
 
@@ -11,11 +15,15 @@ import (
 	"github.com/bjschafer/print-dis/internal/models"
 	"github.com/bjschafer/print-dis/internal/response"
 	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/validation"
 )
 
 // AdminHandler handles admin-related HTTP requests
 type AdminHandler struct {
 	userService *services.UserService
+	lockout     *services.LockoutService
+	imports     *services.UserImportService
+	audit       *services.AuditService
 	config      *config.Config
 }
 
@@ -27,6 +35,119 @@ func NewAdminHandler(userService *services.UserService, config *config.Config) *
 	}
 }
 
+// SetLockout lets admins see and clear failed login lockouts
+func (h *AdminHandler) SetLockout(lockout *services.LockoutService) {
+	h.lockout = lockout
+}
+
+// SetUserImport lets admins import and export users in bulk
+func (h *AdminHandler) SetUserImport(imports *services.UserImportService) {
+	h.imports = imports
+}
+
+// SetAudit records changes admins make to users in the audit log
+func (h *AdminHandler) SetAudit(audit *services.AuditService) {
+	h.audit = audit
+}
+
+// auditUser records something done to a user in the audit log
+func (h *AdminHandler) auditUser(r *http.Request, action models.AuditAction, userID string, changes models.AuditChanges) {
+	recordAudit(r, h.audit, &models.AuditEvent{
+		Action:     action,
+		TargetType: models.AuditTargetUser,
+		TargetID:   userID,
+		Changes:    changes,
+	})
+}
+
+// UserLockoutResponse is a user's failed logins
+type UserLockoutResponse struct {
+	FailedAttempts int        `json:"failed_attempts"`
+	LastFailedAt   *time.Time `json:"last_failed_at,omitempty"`
+	Locked         bool       `json:"locked"`
+	LockedUntil    *time.Time `json:"locked_until,omitempty"`
+}
+
+// GetUserLockout handles GET /api/admin/users/lockout?id=
+func (h *AdminHandler) GetUserLockout(w http.ResponseWriter, r *http.Request) {
+	targetUser, ok := h.lockoutTarget(w, r)
+	if !ok {
+		return
+	}
+
+	attempts, err := h.lockout.Status(r.Context(), targetUser.Username)
+	if err != nil {
+		slog.Error("failed to get failed logins", "error", err, "user_id", targetUser.ID)
+		response.WriteInternalError(w, "Failed to get failed logins", err.Error())
+		return
+	}
+
+	resp := UserLockoutResponse{}
+	if attempts != nil {
+		resp.FailedAttempts = attempts.FailedCount
+		resp.LastFailedAt = &attempts.LastFailedAt
+		if attempts.IsLocked(time.Now()) {
+			resp.Locked = true
+			resp.LockedUntil = attempts.LockedUntil
+		}
+	}
+	response.WriteSuccessResponse(w, resp, "")
+}
+
+// UnlockUser handles DELETE /api/admin/users/lockout?id=, letting a user
+// locked out after failed logins log in with their password again
+func (h *AdminHandler) UnlockUser(w http.ResponseWriter, r *http.Request) {
+	targetUser, ok := h.lockoutTarget(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.lockout.Unlock(r.Context(), targetUser.Username); err != nil {
+		slog.Error("failed to unlock user", "error", err, "user_id", targetUser.ID)
+		response.WriteInternalError(w, "Failed to unlock user", err.Error())
+		return
+	}
+
+	slog.Info("admin unlocked user", "user_id", targetUser.ID, "admin_id", middleware.GetUserID(r))
+	h.auditUser(r, models.AuditUserUnlocked, targetUser.ID, nil)
+	response.WriteNoContentResponse(w)
+}
+
+// lockoutTarget returns the user in the id query parameter, if lockout is
+// enabled and the current user can manage them, and writes an error
+// response otherwise
+func (h *AdminHandler) lockoutTarget(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	if h.lockout == nil {
+		response.WriteNotFoundError(w, "Account lockout is not enabled")
+		return nil, false
+	}
+	return h.manageTarget(w, r)
+}
+
+// manageTarget returns the user in the id query parameter, if the current
+// user can manage them, and writes an error response otherwise
+func (h *AdminHandler) manageTarget(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userID := r.URL.Query().Get("id")
+	if userID == "" {
+		response.WriteBadRequestError(w, "User ID is required", "")
+		return nil, false
+	}
+
+	// The placeholder that owns deleted users' print requests is not a user
+	// anyone can manage
+	targetUser, err := h.userService.GetUser(r.Context(), userID)
+	if err != nil || targetUser == nil || targetUser.ID == models.DeletedUserID {
+		response.WriteNotFoundError(w, "User not found")
+		return nil, false
+	}
+
+	if currentUser := middleware.GetUser(r); currentUser != nil && !currentUser.CanManageUser(targetUser) {
+		response.WriteForbiddenError(w, "Cannot manage this user")
+		return nil, false
+	}
+	return targetUser, true
+}
+
 // ListUsers handles GET /api/admin/users
 func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	users, err := h.userService.ListUsers(r.Context())
@@ -39,15 +160,359 @@ func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	response.WriteSuccessResponse(w, users, "")
 }
 
-// UpdateUserRole handles PUT /api/admin/users/{id}/role
-func (h *AdminHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
-	// Get the target user ID from the URL path
-	userID := r.URL.Query().Get("id")
-	if userID == "" {
-		response.WriteErrorResponse(w, http.StatusBadRequest, response.BadRequest, "User ID required", "")
+// CreateUserRequest is an admin's request to create a local account
+type CreateUserRequest struct {
+	Username    string      `json:"username"`
+	Email       string      `json:"email,omitempty"`
+	DisplayName string      `json:"display_name,omitempty"`
+	Role        models.Role `json:"role,omitempty"` // Defaults to user
+}
+
+// Validate validates the create user request
+func (r *CreateUserRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Username = validation.SanitizeString(r.Username)
+	r.Email = validation.SanitizeString(r.Email)
+	r.DisplayName = validation.SanitizeDisplayName(r.DisplayName)
+
+	validator.ValidateRequired("username", r.Username)
+	validator.ValidateUsername("username", r.Username)
+	validator.ValidateEmail("email", r.Email)
+	validator.ValidateNoHTML("email", r.Email)
+	validator.ValidateDisplayName("display_name", r.DisplayName)
+
+	if r.Role == "" {
+		r.Role = models.RoleUser
+	}
+	if !r.Role.IsValid() {
+		validator.AddError("role", "unknown role")
+	}
+
+	return validator.Errors()
+}
+
+// CreateUserResponse is a created user and their temporary password
+type CreateUserResponse struct {
+	User              *models.User `json:"user"`
+	TemporaryPassword string       `json:"temporary_password"`
+}
+
+// CreateUser handles POST /api/admin/users, creating a local account with a
+// temporary password that the user must change when they first log in
+func (h *AdminHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
+	var req CreateUserRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	// Nobody can create users with more access than they have
+	if currentUser := middleware.GetUser(r); currentUser != nil && !currentUser.CanGrantRole(req.Role) {
+		response.WriteForbiddenError(w, "Cannot create users with the "+string(req.Role)+" role")
+		return
+	}
+
+	user, password, err := h.userService.CreateUser(r.Context(), req.Username, req.Email, req.DisplayName, req.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrUsernameTaken), errors.Is(err, services.ErrEmailTaken):
+			response.WriteConflictError(w, err.Error(), "User with this username or email already exists")
+		default:
+			slog.Error("failed to create user", "error", err)
+			response.WriteBadRequestError(w, "Failed to create user", err.Error())
+		}
+		return
+	}
+
+	slog.Info("admin created user", "user_id", user.ID, "admin_id", middleware.GetUserID(r))
+	h.auditUser(r, models.AuditUserCreated, user.ID, models.AuditChanges{
+		"username":     {After: user.Username},
+		"email":        {After: user.Email},
+		"display_name": {After: user.DisplayName},
+		"role":         {After: user.Role},
+	})
+	response.WriteCreatedResponse(w, CreateUserResponse{User: user, TemporaryPassword: password},
+		"User created. Give them the temporary password now, it will not be shown again.")
+}
+
+// UpdateUserRequest changes a user's email address and display name.
+// Omitted fields are left alone, and empty ones are cleared.
+type UpdateUserRequest struct {
+	Email       *string `json:"email"`
+	DisplayName *string `json:"display_name"`
+}
+
+// Validate validates the update user request
+func (r *UpdateUserRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	if r.Email != nil {
+		email := validation.SanitizeString(*r.Email)
+		r.Email = &email
+		validator.ValidateEmail("email", email)
+		validator.ValidateNoHTML("email", email)
+	}
+	if r.DisplayName != nil {
+		displayName := validation.SanitizeDisplayName(*r.DisplayName)
+		r.DisplayName = &displayName
+		validator.ValidateDisplayName("display_name", displayName)
+	}
+
+	return validator.Errors()
+}
+
+// UpdateUser handles PUT /api/admin/users?id=, changing a user's email
+// address and display name
+func (h *AdminHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	targetUser, ok := h.manageTarget(w, r)
+	if !ok {
+		return
+	}
+
+	var req UpdateUserRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	user, err := h.userService.UpdateProfile(r.Context(), targetUser.ID, req.Email, req.DisplayName)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrEmailTaken):
+			response.WriteConflictError(w, err.Error(), "User with this email already exists")
+		case errors.Is(err, services.ErrUserNotFound):
+			response.WriteNotFoundError(w, "User not found")
+		default:
+			slog.Error("failed to update user", "error", err, "user_id", targetUser.ID)
+			response.WriteBadRequestError(w, "Failed to update user", err.Error())
+		}
+		return
+	}
+
+	slog.Info("admin updated user", "user_id", user.ID, "admin_id", middleware.GetUserID(r))
+	changes := models.AuditChanges{}
+	if !equalStringPtr(targetUser.Email, user.Email) {
+		changes["email"] = models.AuditChange{Before: targetUser.Email, After: user.Email}
+	}
+	if !equalStringPtr(targetUser.DisplayName, user.DisplayName) {
+		changes["display_name"] = models.AuditChange{Before: targetUser.DisplayName, After: user.DisplayName}
+	}
+	h.auditUser(r, models.AuditUserUpdated, user.ID, changes)
+	response.WriteSuccessResponse(w, user, "User updated successfully")
+}
+
+// TemporaryPasswordResponse is a password an admin gives to a user, who must
+// change it when they next log in
+type TemporaryPasswordResponse struct {
+	TemporaryPassword string `json:"temporary_password"`
+}
+
+// ResetUserPassword handles POST /api/admin/users/password?id=, giving a
+// user a new temporary password and logging them out everywhere
+func (h *AdminHandler) ResetUserPassword(w http.ResponseWriter, r *http.Request) {
+	targetUser, ok := h.manageTarget(w, r)
+	if !ok {
+		return
+	}
+
+	password, err := h.userService.ResetPassword(r.Context(), targetUser.ID)
+	if err != nil {
+		slog.Error("failed to reset password", "error", err, "user_id", targetUser.ID)
+		response.WriteInternalError(w, "Failed to reset password", err.Error())
 		return
 	}
 
+	slog.Info("admin reset user's password", "user_id", targetUser.ID, "admin_id", middleware.GetUserID(r))
+	h.auditUser(r, models.AuditUserPasswordReset, targetUser.ID, nil)
+	response.WriteSuccessResponse(w, TemporaryPasswordResponse{TemporaryPassword: password},
+		"Password reset. Give the user the temporary password now, it will not be shown again.")
+}
+
+// DeleteUserResponse says where a deleted user's print requests went
+type DeleteUserResponse struct {
+	ReassignedTo  string `json:"reassigned_to"`
+	PrintRequests int64  `json:"print_requests"`
+}
+
+// DeleteUser handles DELETE /api/admin/users?id=. The user's print requests,
+// charges and payments are reassigned to the user in the reassign_to query
+// parameter, who must be someone the admin can manage, or with anonymise=true
+// moved to a placeholder for deleted users.
+func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
+	targetUser, ok := h.manageTarget(w, r)
+	if !ok {
+		return
+	}
+
+	// Admins must choose what happens to the print requests
+	reassignTo := r.URL.Query().Get("reassign_to")
+	anonymise := r.URL.Query().Get("anonymise") == "true"
+	if (reassignTo == "") == !anonymise {
+		response.WriteBadRequestError(w, "Choose whether to reassign or anonymise the user's print requests",
+			"set either reassign_to to a user ID or anonymise=true")
+		return
+	}
+	if anonymise {
+		reassignTo = models.DeletedUserID
+	}
+
+	// Reassigning charges and payments changes who owes money, so they can
+	// only go to someone the admin could manage
+	if reassignTo != models.DeletedUserID {
+		heir, err := h.userService.GetUser(r.Context(), reassignTo)
+		if err != nil || heir == nil {
+			response.WriteBadRequestError(w, "Cannot reassign print requests to this user", "")
+			return
+		}
+		if currentUser := middleware.GetUser(r); currentUser != nil && !currentUser.CanManageUser(heir) {
+			response.WriteForbiddenError(w, "Cannot reassign print requests to this user")
+			return
+		}
+	}
+
+	moved, err := h.userService.DeleteUser(r.Context(), targetUser.ID, reassignTo)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidReassignment):
+			response.WriteBadRequestError(w, "Cannot reassign print requests to this user", "")
+		case errors.Is(err, services.ErrUserNotFound):
+			response.WriteNotFoundError(w, "User not found")
+		default:
+			slog.Error("failed to delete user", "error", err, "user_id", targetUser.ID)
+			response.WriteInternalError(w, "Failed to delete user", err.Error())
+		}
+		return
+	}
+
+	slog.Info("admin deleted user", "user_id", targetUser.ID, "admin_id", middleware.GetUserID(r), "reassigned_to", reassignTo)
+	h.auditUser(r, models.AuditUserDeleted, targetUser.ID, models.AuditChanges{
+		"username":      {Before: targetUser.Username},
+		"email":         {Before: targetUser.Email},
+		"role":          {Before: targetUser.Role},
+		"reassigned_to": {After: reassignTo},
+	})
+	response.WriteSuccessResponse(w, DeleteUserResponse{ReassignedTo: reassignTo, PrintRequests: moved}, "User deleted successfully")
+}
+
+// maxImportSize caps the size of import files
+const maxImportSize = 1 << 20
+
+// ImportUsers handles POST /api/admin/users/import, creating users from a CSV
+// or JSON file in the body. The format query parameter is csv or json, and
+// defaults to csv for text/csv bodies and json otherwise. mode=password, the
+// default, creates users with temporary passwords, and mode=invitation emails
+// them invitations. With dry_run=true every row is checked but nothing is
+// imported.
+func (h *AdminHandler) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	format := services.UserListFormat(query.Get("format"))
+	if format == "" {
+		format = services.UserListJSON
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "text/csv" {
+			format = services.UserListCSV
+		}
+	}
+	if !format.IsValid() {
+		response.WriteBadRequestError(w, "Invalid format", "format must be csv or json")
+		return
+	}
+	mode := services.ImportMode(query.Get("mode"))
+	if mode == "" {
+		mode = services.ImportTemporaryPasswords
+	}
+	if !mode.IsValid() {
+		response.WriteBadRequestError(w, "Invalid mode", "mode must be password or invitation")
+		return
+	}
+	dryRun := query.Get("dry_run") == "true"
+
+	records, err := services.ReadUserRecords(http.MaxBytesReader(w, r.Body, maxImportSize), format)
+	if err != nil {
+		response.WriteBadRequestError(w, "Failed to read import file", err.Error())
+		return
+	}
+
+	ctx := services.WithPublicURL(r.Context(), h.config.Server.BaseURL)
+	report, err := h.imports.Import(ctx, middleware.GetUser(r), records, mode, dryRun)
+	if err != nil {
+		if errors.Is(err, services.ErrInvitationsUnavailable) || errors.Is(err, services.ErrNoPublicURL) {
+			response.WriteBadRequestError(w, "Cannot email invitations", err.Error())
+			return
+		}
+		slog.Error("failed to import users", "error", err)
+		response.WriteInternalError(w, "Failed to import users", err.Error())
+		return
+	}
+
+	switch {
+	case dryRun:
+		response.WriteSuccessResponse(w, report, "Dry run, nothing was imported")
+	case report.Invalid > 0:
+		var invalid []services.ImportRowResult
+		for _, row := range report.Rows {
+			if row.Status == services.ImportRowInvalid {
+				invalid = append(invalid, row)
+			}
+		}
+		response.WriteValidationError(w, invalid)
+	default:
+		slog.Info("admin imported users", "admin_id", middleware.GetUserID(r), "mode", mode, "imported", report.Imported, "failed", report.Failed)
+		var imported []string
+		for _, row := range report.Rows {
+			if row.Status == services.ImportRowCreated || row.Status == services.ImportRowInvited {
+				imported = append(imported, row.Username)
+			}
+		}
+		recordAudit(r, h.audit, &models.AuditEvent{
+			Action:     models.AuditUsersImported,
+			TargetType: models.AuditTargetUser,
+			Changes:    models.AuditChanges{"usernames": {After: imported}},
+		})
+		message := fmt.Sprintf("Imported %d users", report.Imported)
+		if mode == services.ImportTemporaryPasswords {
+			message += ". Give them their temporary passwords now, they will not be shown again."
+		}
+		response.WriteSuccessResponse(w, report, message)
+	}
+}
+
+// ExportUsers handles GET /api/admin/users/export, downloading every user as
+// a file that can be imported again. The format query parameter is csv, the
+// default, or json.
+func (h *AdminHandler) ExportUsers(w http.ResponseWriter, r *http.Request) {
+	format := services.UserListFormat(r.URL.Query().Get("format"))
+	if format == "" {
+		format = services.UserListCSV
+	}
+	if !format.IsValid() {
+		response.WriteBadRequestError(w, "Invalid format", "format must be csv or json")
+		return
+	}
+
+	records, err := h.imports.ExportUsers(r.Context())
+	if err != nil {
+		slog.Error("failed to export users", "error", err)
+		response.WriteInternalError(w, "Failed to export users", err.Error())
+		return
+	}
+	var buf bytes.Buffer
+	if err := services.WriteUserRecords(&buf, format, records); err != nil {
+		slog.Error("failed to write user export", "error", err, "format", format)
+		response.WriteInternalError(w, "Failed to export users", err.Error())
+		return
+	}
+
+	contentType := "application/json"
+	if format == services.UserListCSV {
+		contentType = "text/csv"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", "users-"+time.Now().Format("2006-01-02")+"."+string(format)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// UpdateUserRole handles PUT /api/admin/users/{id}/role
+func (h *AdminHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
 	// Get the current user from context
 	currentUser, ok := r.Context().Value(middleware.UserKey).(*models.User)
 	if !ok {
@@ -55,6 +520,13 @@ func (h *AdminHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Get the target user, if the current user can manage them
+	targetUser, ok := h.manageTarget(w, r)
+	if !ok {
+		return
+	}
+	userID := targetUser.ID
+
 	// Parse the new role from request body
 	var req struct {
 		Role string `json:"role"`
@@ -71,27 +543,14 @@ func (h *AdminHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Get the target user
-	targetUser, err := h.userService.GetUser(r.Context(), userID)
-	if err != nil {
-		slog.Error("failed to get target user", "error", err, "user_id", userID)
-		response.WriteErrorResponse(w, http.StatusNotFound, response.NotFound, "User not found", "")
-		return
-	}
-
-	// Check if current user can manage the target user
-	if !currentUser.CanManageUser(targetUser) {
-		response.WriteErrorResponse(w, http.StatusForbidden, response.Forbidden, "Cannot manage this user", "")
-		return
-	}
-
-	// Additional check: only admins can promote to admin
-	if newRole == models.RoleAdmin && currentUser.Role != models.RoleAdmin {
-		response.WriteErrorResponse(w, http.StatusForbidden, response.Forbidden, "Only admins can promote to admin", "")
+	// Nobody can give others more access than they have
+	if !currentUser.CanGrantRole(newRole) {
+		response.WriteErrorResponse(w, http.StatusForbidden, response.Forbidden, "Cannot give the "+string(newRole)+" role", "")
 		return
 	}
 
 	// Update the user's role
+	oldRole := targetUser.Role
 	targetUser.Role = newRole
 	targetUser.UpdatedAt = time.Now()
 
@@ -104,8 +563,11 @@ func (h *AdminHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
 	slog.Info("user role updated",
 		"admin_user_id", currentUser.ID,
 		"target_user_id", userID,
-		"old_role", targetUser.Role,
+		"old_role", oldRole,
 		"new_role", newRole)
+	h.auditUser(r, models.AuditUserRoleChanged, userID, models.AuditChanges{
+		"role": {Before: oldRole, After: newRole},
+	})
 
 	userResponse := map[string]interface{}{
 		"user": targetUser,
@@ -115,13 +577,6 @@ func (h *AdminHandler) UpdateUserRole(w http.ResponseWriter, r *http.Request) {
 
 // ToggleUserStatus handles PUT /api/admin/users/{id}/status
 func (h *AdminHandler) ToggleUserStatus(w http.ResponseWriter, r *http.Request) {
-	// Get the target user ID from the URL path
-	userID := r.URL.Query().Get("id")
-	if userID == "" {
-		response.WriteErrorResponse(w, http.StatusBadRequest, response.BadRequest, "User ID required", "")
-		return
-	}
-
 	// Get the current user from context
 	currentUser, ok := r.Context().Value(middleware.UserKey).(*models.User)
 	if !ok {
@@ -129,6 +584,13 @@ func (h *AdminHandler) ToggleUserStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
+	// Get the target user, if the current user can manage them
+	targetUser, ok := h.manageTarget(w, r)
+	if !ok {
+		return
+	}
+	userID := targetUser.ID
+
 	// Parse the new status from request body
 	var req struct {
 		Enabled bool `json:"enabled"`
@@ -138,21 +600,8 @@ func (h *AdminHandler) ToggleUserStatus(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Get the target user
-	targetUser, err := h.userService.GetUser(r.Context(), userID)
-	if err != nil {
-		slog.Error("failed to get target user", "error", err, "user_id", userID)
-		response.WriteErrorResponse(w, http.StatusNotFound, response.NotFound, "User not found", "")
-		return
-	}
-
-	// Check if current user can manage the target user
-	if !currentUser.CanManageUser(targetUser) {
-		response.WriteErrorResponse(w, http.StatusForbidden, response.Forbidden, "Cannot manage this user", "")
-		return
-	}
-
 	// Update the user's status
+	var err error
 	if req.Enabled {
 		err = h.userService.EnableUser(r.Context(), userID)
 	} else {
@@ -169,6 +618,9 @@ func (h *AdminHandler) ToggleUserStatus(w http.ResponseWriter, r *http.Request)
 		"admin_user_id", currentUser.ID,
 		"target_user_id", userID,
 		"enabled", req.Enabled)
+	h.auditUser(r, models.AuditUserStatusChanged, userID, models.AuditChanges{
+		"enabled": {Before: targetUser.Enabled, After: req.Enabled},
+	})
 
 	response.WriteSuccessResponse(w, nil, "User status updated successfully")
 }
@@ -0,0 +1,397 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/mailer"
+	"github.com/bjschafer/print-dis/internal/mailer/mailertest"
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+// newAdminTestApp serves login, password changes and the admin user and role
+// endpoints, which need a logged in user but no particular permission, and
+// emails invitations through a fake SMTP server
+func newAdminTestApp(t *testing.T) *emailTestApp {
+	t.Helper()
+	db := newTestDB(t)
+	smtp := mailertest.NewServer(t)
+	cfg := &config.Config{
+		Server: config.ServerConfig{BaseURL: "https://print.example.com"},
+		Auth: config.AuthConfig{
+			Enabled:        true,
+			SessionSecret:  "test-session-secret-that-is-long-enough",
+			SessionTimeout: time.Hour,
+			LocalAuth:      config.LocalAuthConfig{Enabled: true},
+		},
+	}
+	userService := services.NewUserService(db)
+	sessionStore := middleware.NewSessionStore(cfg, db)
+	authHandler := NewAuthHandler(userService, services.NewTwoFactorService(db, cfg.Auth.LocalAuth.TOTP), sessionStore, cfg)
+	adminHandler := NewAdminHandler(userService, cfg)
+	userImportService := services.NewUserImportService(db, userService, services.NewInvitationService(db))
+	userImportService.SetEmail(services.NewEmailService(db, mailer.NewSMTPMailer(mailer.SMTPConfig{
+		Host: smtp.Host,
+		Port: smtp.Port,
+		TLS:  mailer.TLSNone,
+		From: "print-dis <print@example.com>",
+	})))
+	adminHandler.SetUserImport(userImportService)
+	auditService := services.NewAuditService(db)
+	authHandler.SetAudit(auditService)
+	adminHandler.SetAudit(auditService)
+	auditHandler := NewAuditHandler(auditService)
+	analyticsHandler := NewAnalyticsHandler(services.NewAnalyticsService(db))
+	roleHandler := NewRoleHandler(services.NewRoleService(db))
+	roleHandler.SetAudit(auditService)
+	groupHandler := NewGroupHandler(services.NewGroupService(db), userService)
+	groupHandler.SetAudit(auditService)
+	invitationHandler := NewInvitationHandler(services.NewInvitationService(db), cfg)
+	invitationHandler.SetAudit(auditService)
+	sessionMW := sessionStore.SessionMiddleware()
+	authMW := sessionStore.AuthMiddleware(cfg)
+	authenticated := func(handler http.HandlerFunc) http.Handler {
+		return sessionMW(authMW(handler))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/auth/login", sessionMW(http.HandlerFunc(authHandler.Login)))
+	mux.Handle("/api/auth/me", authenticated(authHandler.GetCurrentUser))
+	mux.Handle("/api/auth/change-password", authenticated(authHandler.ChangePassword))
+	mux.Handle("GET /api/admin/users", authenticated(adminHandler.ListUsers))
+	mux.Handle("POST /api/admin/users", authenticated(adminHandler.CreateUser))
+	mux.Handle("PUT /api/admin/users", authenticated(adminHandler.UpdateUser))
+	mux.Handle("DELETE /api/admin/users", authenticated(adminHandler.DeleteUser))
+	mux.Handle("POST /api/admin/users/password", authenticated(adminHandler.ResetUserPassword))
+	mux.Handle("POST /api/admin/users/import", authenticated(adminHandler.ImportUsers))
+	mux.Handle("GET /api/admin/users/export", authenticated(adminHandler.ExportUsers))
+	mux.Handle("PUT /api/admin/users/role", authenticated(adminHandler.UpdateUserRole))
+	mux.Handle("PUT /api/admin/users/status", authenticated(adminHandler.ToggleUserStatus))
+	mux.Handle("POST /api/admin/roles", authenticated(roleHandler.CreateRole))
+	mux.Handle("PUT /api/admin/roles", authenticated(roleHandler.UpdateRole))
+	mux.Handle("DELETE /api/admin/roles", authenticated(roleHandler.DeleteRole))
+	mux.Handle("PUT /api/groups/members", authenticated(groupHandler.SetMember))
+	mux.Handle("DELETE /api/groups/members", authenticated(groupHandler.RemoveMember))
+	mux.Handle("POST /api/admin/invitations", authenticated(invitationHandler.CreateInvitation))
+	mux.Handle("DELETE /api/admin/invitations", authenticated(invitationHandler.RevokeInvitation))
+	mux.Handle("GET /api/admin/audit", authenticated(auditHandler.ListEvents))
+	mux.Handle("GET /api/admin/audit/export", authenticated(auditHandler.ExportEvents))
+	mux.Handle("GET /api/admin/analytics", authenticated(analyticsHandler.GetReport))
+	mux.Handle("GET /api/user/stats", authenticated(analyticsHandler.GetUserStats))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &emailTestApp{db: db, server: server, smtp: smtp}
+}
+
+func TestAdminUserLifecycle(t *testing.T) {
+	ctx := context.Background()
+	app := newAdminTestApp(t)
+
+	adminEmail := "admin@example.com"
+	admin := models.NewUser("admin", &adminEmail)
+	admin.ID = "admin-id"
+	admin.Role = models.RoleAdmin
+	if err := admin.SetPassword("admin-password"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := app.db.CreateUser(ctx, admin); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	adminClient, status := app.login(t, "admin", "admin-password")
+	if status != http.StatusOK {
+		t.Fatalf("Failed to log in as admin: %d", status)
+	}
+
+	// Admins create users with a temporary password
+	status, data := app.do(t, adminClient, http.MethodPost, "/api/admin/users", CreateUserRequest{
+		Username:    "newbie",
+		Email:       "newbie@example.com",
+		DisplayName: "New Bie",
+	})
+	var created CreateUserResponse
+	if err := json.Unmarshal(data, &created); status != http.StatusCreated || err != nil || created.TemporaryPassword == "" {
+		t.Fatalf("Failed to create user: %d %s", status, data)
+	}
+	if created.User.Role != models.RoleUser || !created.User.MustChangePassword {
+		t.Errorf("Expected a user who must change their password, got %+v", created.User)
+	}
+	userID := created.User.ID
+	if status, _ := app.do(t, adminClient, http.MethodPost, "/api/admin/users", CreateUserRequest{Username: "newbie"}); status != http.StatusConflict {
+		t.Errorf("Expected taken username to be refused, got %d", status)
+	}
+
+	// The user must change the temporary password before anything else
+	client, status := app.login(t, "newbie", created.TemporaryPassword)
+	if status != http.StatusOK {
+		t.Fatalf("Failed to log in with temporary password: %d", status)
+	}
+	status, data = app.do(t, client, http.MethodGet, "/api/auth/me", nil)
+	var me UserResponse
+	if err := json.Unmarshal(data, &me); status != http.StatusOK || err != nil || !me.PasswordChangeRequired {
+		t.Errorf("Expected user to be told to change their password, got %d %s", status, data)
+	}
+	if status, _ := app.do(t, client, http.MethodGet, "/api/admin/users", nil); status != http.StatusForbidden {
+		t.Errorf("Expected requests before changing the password to be refused, got %d", status)
+	}
+	if status, _ := app.do(t, client, http.MethodPost, "/api/auth/change-password", ChangePasswordRequest{
+		CurrentPassword: created.TemporaryPassword,
+		NewPassword:     "chosen-password",
+	}); status != http.StatusOK {
+		t.Fatalf("Failed to change password: %d", status)
+	}
+	status, data = app.do(t, client, http.MethodGet, "/api/admin/users", nil)
+	var users []*models.User
+	if err := json.Unmarshal(data, &users); status != http.StatusOK || err != nil || len(users) != 2 {
+		t.Fatalf("Expected to list 2 users after changing the password, got %d %s", status, data)
+	}
+
+	// Admins edit email addresses and display names
+	taken := adminEmail
+	if status, _ := app.do(t, adminClient, http.MethodPut, "/api/admin/users?id="+userID, UpdateUserRequest{Email: &taken}); status != http.StatusConflict {
+		t.Errorf("Expected taken email to be refused, got %d", status)
+	}
+	newEmail, noName := "renamed@example.com", ""
+	if status, _ := app.do(t, adminClient, http.MethodPut, "/api/admin/users?id="+userID, UpdateUserRequest{Email: &newEmail, DisplayName: &noName}); status != http.StatusOK {
+		t.Fatalf("Failed to update user: %d", status)
+	}
+	if user, _ := app.db.GetUser(ctx, userID); user.Email == nil || *user.Email != newEmail || user.DisplayName != nil {
+		t.Errorf("Expected email to change and display name to be cleared, got %+v", user)
+	}
+
+	// Resetting the password logs the user out, revokes their API tokens and
+	// gives them another temporary password
+	newbie, _ := app.db.GetUser(ctx, userID)
+	_, secret, err := services.NewTokenService(app.db).CreateToken(ctx, newbie, "script", []models.Permission{models.PermissionViewOwnPrintRequests}, nil)
+	if err != nil {
+		t.Fatalf("Failed to create API token: %v", err)
+	}
+	bearerStatus := func() int {
+		req, _ := http.NewRequest(http.MethodGet, app.server.URL+"/api/auth/me", nil)
+		req.Header.Set("Authorization", "Bearer "+secret)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("GET /api/auth/me failed: %v", err)
+		}
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+	if status := bearerStatus(); status != http.StatusOK {
+		t.Fatalf("Expected the API token to authenticate, got %d", status)
+	}
+	status, data = app.do(t, adminClient, http.MethodPost, "/api/admin/users/password?id="+userID, nil)
+	var reset TemporaryPasswordResponse
+	if err := json.Unmarshal(data, &reset); status != http.StatusOK || err != nil || reset.TemporaryPassword == "" {
+		t.Fatalf("Failed to reset password: %d %s", status, data)
+	}
+	if status, _ := app.do(t, client, http.MethodGet, "/api/auth/me", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected user to be logged out, got %d", status)
+	}
+	if status := bearerStatus(); status != http.StatusUnauthorized {
+		t.Errorf("Expected the API token to be revoked, got %d", status)
+	}
+	if _, status := app.login(t, "newbie", "chosen-password"); status != http.StatusUnauthorized {
+		t.Errorf("Expected the old password to be refused, got %d", status)
+	}
+	if user, _ := app.db.GetUser(ctx, userID); !user.MustChangePassword {
+		t.Error("Expected user to have to change their password again")
+	}
+
+	// Deleted users' print requests are reassigned or anonymised, as the
+	// admin chooses
+	leaver := models.NewUser("leaver", nil)
+	leaver.ID = "leaver-id"
+	heir := models.NewUser("heir", nil)
+	heir.ID = "heir-id"
+	for _, user := range []*models.User{leaver, heir} {
+		if err := app.db.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	newbieRequest := models.NewPrintRequest(userID, "https://example.com/newbie.stl", "")
+	newbieRequest.ID = "newbie-request"
+	leaverRequest := models.NewPrintRequest(leaver.ID, "https://example.com/leaver.stl", "")
+	leaverRequest.ID = "leaver-request"
+	for _, request := range []*models.PrintRequest{newbieRequest, leaverRequest} {
+		if err := app.db.CreatePrintRequest(ctx, request); err != nil {
+			t.Fatalf("Failed to create print request: %v", err)
+		}
+	}
+
+	for path, expected := range map[string]int{
+		"/api/admin/users?id=" + userID:                                             http.StatusBadRequest,
+		"/api/admin/users?id=" + userID + "&anonymise=true&reassign_to=" + admin.ID: http.StatusBadRequest,
+		"/api/admin/users?id=" + userID + "&reassign_to=" + userID:                  http.StatusBadRequest,
+		"/api/admin/users?id=" + userID + "&reassign_to=ghost":                      http.StatusBadRequest,
+		"/api/admin/users?id=" + userID + "&reassign_to=" + admin.ID:                http.StatusForbidden,
+		"/api/admin/users?id=" + admin.ID + "&anonymise=true":                       http.StatusForbidden,
+		"/api/admin/users?id=" + models.DeletedUserID + "&anonymise=true":           http.StatusNotFound,
+	} {
+		if status, _ := app.do(t, adminClient, http.MethodDelete, path, nil); status != expected {
+			t.Errorf("Expected DELETE %s to get %d, got %d", path, expected, status)
+		}
+	}
+
+	// Moderators can't move a user's charges and payments onto an admin
+	moderator := models.NewUser("moderator", nil)
+	moderator.ID = "moderator-id"
+	moderator.Role = models.RoleModerator
+	if err := moderator.SetPassword("moderator-password"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := app.db.CreateUser(ctx, moderator); err != nil {
+		t.Fatalf("Failed to create moderator: %v", err)
+	}
+	moderatorClient, status := app.login(t, "moderator", "moderator-password")
+	if status != http.StatusOK {
+		t.Fatalf("Failed to log in as moderator: %d", status)
+	}
+	if status, _ := app.do(t, moderatorClient, http.MethodDelete, "/api/admin/users?id="+leaver.ID+"&reassign_to="+admin.ID, nil); status != http.StatusForbidden {
+		t.Errorf("Expected reassigning to an admin to be refused, got %d", status)
+	}
+
+	// Nor can the placeholder's role or status be changed
+	for path, body := range map[string]any{
+		"/api/admin/users/role?id=" + models.DeletedUserID:   map[string]string{"role": "moderator"},
+		"/api/admin/users/status?id=" + models.DeletedUserID: map[string]bool{"enabled": true},
+	} {
+		if status, _ := app.do(t, adminClient, http.MethodPut, path, body); status != http.StatusNotFound {
+			t.Errorf("Expected PUT %s to get %d, got %d", path, http.StatusNotFound, status)
+		}
+	}
+	if placeholder, _ := app.db.GetUser(ctx, models.DeletedUserID); placeholder == nil || placeholder.Enabled || placeholder.Role != models.RoleUser {
+		t.Errorf("Expected the placeholder to be unchanged, got %+v", placeholder)
+	}
+
+	status, data = app.do(t, adminClient, http.MethodDelete, "/api/admin/users?id="+userID+"&reassign_to="+heir.ID, nil)
+	var deleted DeleteUserResponse
+	if err := json.Unmarshal(data, &deleted); status != http.StatusOK || err != nil || deleted.PrintRequests != 1 {
+		t.Fatalf("Failed to delete user: %d %s", status, data)
+	}
+	if status, _ := app.do(t, adminClient, http.MethodDelete, "/api/admin/users?id="+leaver.ID+"&anonymise=true", nil); status != http.StatusOK {
+		t.Fatalf("Failed to delete user: %d", status)
+	}
+
+	for id, owner := range map[string]string{newbieRequest.ID: heir.ID, leaverRequest.ID: models.DeletedUserID} {
+		if request, _ := app.db.GetPrintRequest(ctx, id); request == nil || request.UserID != owner {
+			t.Errorf("Expected print request %s to belong to %s, got %+v", id, owner, request)
+		}
+	}
+	for _, id := range []string{userID, leaver.ID} {
+		if user, _ := app.db.GetUser(ctx, id); user != nil {
+			t.Errorf("Expected user %s to be deleted", id)
+		}
+	}
+}
+
+func TestAdminUserImport(t *testing.T) {
+	ctx := context.Background()
+	app := newAdminTestApp(t)
+
+	adminEmail := "admin@example.com"
+	admin := models.NewUser("admin", &adminEmail)
+	admin.ID = "admin-id"
+	admin.Role = models.RoleAdmin
+	if err := admin.SetPassword("admin-password"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := app.db.CreateUser(ctx, admin); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	lab := &models.Group{ID: "lab-id", Name: "Robotics Lab", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := app.db.CreateGroup(ctx, lab); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	adminClient, status := app.login(t, "admin", "admin-password")
+	if status != http.StatusOK {
+		t.Fatalf("Failed to log in as admin: %d", status)
+	}
+
+	cohort := []services.UserRecord{
+		{Username: "student1", Email: "student1@example.edu", DisplayName: "Student One", Group: "robotics lab"},
+		{Username: "student2", Email: "student2@example.edu", Role: "moderator"},
+	}
+	invalid := append([]services.UserRecord{
+		{Username: "x", Email: adminEmail, Group: "Chemistry"},
+		{Username: "student1"},
+	}, cohort...)
+
+	// Dry runs check every row without importing anything
+	status, data := app.do(t, adminClient, http.MethodPost, "/api/admin/users/import?dry_run=true", invalid)
+	var report services.ImportReport
+	if err := json.Unmarshal(data, &report); status != http.StatusOK || err != nil || len(report.Rows) != 4 {
+		t.Fatalf("Failed to dry run import: %d %s", status, data)
+	}
+	if report.Invalid != 2 || report.Rows[0].Status != services.ImportRowInvalid || report.Rows[2].Status != services.ImportRowInvalid {
+		t.Errorf("Expected the first row and the repeated username to be invalid, got %+v", report.Rows)
+	}
+	if errs := report.Rows[0].Errors; len(errs) != 3 {
+		t.Errorf("Expected errors for the username, email and group, got %+v", errs)
+	}
+
+	// Nothing is imported if any row is invalid
+	if status, _ := app.do(t, adminClient, http.MethodPost, "/api/admin/users/import", invalid); status != http.StatusBadRequest {
+		t.Errorf("Expected invalid rows to be refused, got %d", status)
+	}
+	if user, _ := app.db.GetUserByUsername(ctx, "student2"); user != nil {
+		t.Error("Expected no users to be imported")
+	}
+
+	status, data = app.do(t, adminClient, http.MethodPost, "/api/admin/users/import", cohort)
+	report = services.ImportReport{}
+	if err := json.Unmarshal(data, &report); status != http.StatusOK || err != nil || report.Imported != 2 {
+		t.Fatalf("Failed to import users: %d %s", status, data)
+	}
+	student1 := report.Rows[0]
+	if student1.Status != services.ImportRowCreated || student1.TemporaryPassword == "" {
+		t.Fatalf("Expected a user with a temporary password, got %+v", student1)
+	}
+	if _, status := app.login(t, "student1", student1.TemporaryPassword); status != http.StatusOK {
+		t.Errorf("Failed to log in with temporary password: %d", status)
+	}
+	if memberships, _ := app.db.ListGroupMembershipsByUserID(ctx, student1.UserID); len(memberships) != 1 || memberships[0].GroupID != lab.ID {
+		t.Errorf("Expected student1 to join the lab, got %+v", memberships)
+	}
+
+	// Invitations are emailed instead of creating accounts
+	status, data = app.do(t, adminClient, http.MethodPost, "/api/admin/users/import?mode=invitation", []services.UserRecord{
+		{Username: "student3", Email: "student3@example.edu", Group: lab.ID},
+	})
+	report = services.ImportReport{}
+	if err := json.Unmarshal(data, &report); status != http.StatusOK || err != nil || report.Rows[0].Status != services.ImportRowInvited {
+		t.Fatalf("Failed to import with invitations: %d %s", status, data)
+	}
+	msg := app.smtp.WaitForMessages(t, 1)[0]
+	if msg.To[0] != "student3@example.edu" || !strings.Contains(msg.Body, "https://print.example.com/auth.html?email=student3%40example.edu&invitation_code=") {
+		t.Errorf("Expected an invitation link, got %+v", msg)
+	}
+	if invitations, _ := app.db.ListInvitations(ctx); len(invitations) != 1 || invitations[0].GroupID == nil || invitations[0].MaxUses != 1 {
+		t.Errorf("Expected a single-use invitation to the lab, got %+v", invitations)
+	}
+
+	// Exports can be imported again
+	resp, err := adminClient.Get(app.server.URL + "/api/admin/users/export")
+	if err != nil {
+		t.Fatalf("Failed to export users: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	records, err := services.ReadUserRecords(resp.Body, services.UserListCSV)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("Failed to read export: %d %v", resp.StatusCode, err)
+	}
+	exported := make(map[string]services.UserRecord)
+	for _, record := range records {
+		exported[record.Username] = record
+	}
+	if len(exported) != 3 || exported["student1"].Group != lab.Name || exported["student2"].Role != models.RoleModerator {
+		t.Errorf("Expected admin and both students to be exported, got %+v", records)
+	}
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+const (
+	// defaultAnalyticsDays is how many days analytics cover when no range is
+	// given, up to and including today
+	defaultAnalyticsDays = 30
+	// maxAnalyticsBuckets is the most buckets a report can have, so that a
+	// long range is grouped by week
+	maxAnalyticsBuckets = 400
+	// defaultTopRequesters is how many top requesters are listed when none is
+	// given
+	defaultTopRequesters = 10
+	// maxTopRequesters is the most top requesters listed at once
+	maxTopRequesters = 100
+	// defaultHistoryMonths is how many months of history users' statistics
+	// include when none is given
+	defaultHistoryMonths = 12
+	// maxHistoryMonths is the most months of history users' statistics include
+	maxHistoryMonths = 60
+)
+
+// AnalyticsHandler handles HTTP requests for print request analytics
+type AnalyticsHandler struct {
+	analytics *services.AnalyticsService
+	now       func() time.Time
+	logger    *slog.Logger
+}
+
+// NewAnalyticsHandler creates a new analytics handler
+func NewAnalyticsHandler(analytics *services.AnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analytics: analytics,
+		now:       time.Now,
+		logger:    slog.Default(),
+	}
+}
+
+// GetReport handles GET /api/admin/analytics?from=&to=&bucket=&top=. The
+// range is of UTC dates, with both from and to included.
+func (h *AnalyticsHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	bucket := models.AnalyticsBucketDay
+	if value := query.Get("bucket"); value != "" {
+		bucket = models.AnalyticsBucket(value)
+		if !bucket.IsValid() {
+			response.WriteBadRequestError(w, "Invalid bucket", "bucket must be one of: day, week")
+			return
+		}
+	}
+
+	today := models.AnalyticsBucketDay.Start(h.now())
+	to := today
+	from := today.AddDate(0, 0, 1-defaultAnalyticsDays)
+	for name, dest := range map[string]*time.Time{"from": &from, "to": &to} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.DateOnly, value)
+		if err != nil {
+			response.WriteBadRequestError(w, "Invalid "+name, name+" must be a date, such as 2024-01-02")
+			return
+		}
+		*dest = parsed
+	}
+	if to.Before(from) {
+		response.WriteBadRequestError(w, "Invalid range", "from must not be after to")
+		return
+	}
+	rng := models.AnalyticsRange{From: from, To: to.AddDate(0, 0, 1)}
+
+	buckets := 0
+	for start := bucket.Start(rng.From); start.Before(rng.To); start = bucket.Next(start) {
+		if buckets++; buckets > maxAnalyticsBuckets {
+			response.WriteBadRequestError(w, "Range too long",
+				fmt.Sprintf("at most %d buckets can be reported at once; narrow the range or group by week", maxAnalyticsBuckets))
+			return
+		}
+	}
+
+	top := defaultTopRequesters
+	if value := query.Get("top"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxTopRequesters {
+			response.WriteBadRequestError(w, "Invalid top", fmt.Sprintf("top must be between 1 and %d", maxTopRequesters))
+			return
+		}
+		top = parsed
+	}
+
+	report, err := h.analytics.Report(r.Context(), rng, bucket, top)
+	if err != nil {
+		h.logger.Error("failed to report analytics", "error", err)
+		response.WriteInternalError(w, "Failed to report analytics", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, report, "")
+}
+
+// GetUserStats handles GET /api/user/stats?months=, reporting the logged in
+// user's own print request statistics
+func (h *AnalyticsHandler) GetUserStats(w http.ResponseWriter, r *http.Request) {
+	user := middleware.GetUser(r)
+	if user == nil {
+		response.WriteUnauthorizedError(w, "Authentication required")
+		return
+	}
+
+	months := defaultHistoryMonths
+	if value := r.URL.Query().Get("months"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed <= 0 || parsed > maxHistoryMonths {
+			response.WriteBadRequestError(w, "Invalid months", fmt.Sprintf("months must be between 1 and %d", maxHistoryMonths))
+			return
+		}
+		months = parsed
+	}
+
+	stats, err := h.analytics.UserStats(r.Context(), user, months)
+	if err != nil {
+		h.logger.Error("failed to get user stats", "error", err, "user_id", user.ID)
+		response.WriteInternalError(w, "Failed to get statistics", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, stats, "")
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/models"
+)
+
+func TestAnalyticsReport(t *testing.T) {
+	ctx := context.Background()
+	app := newAdminTestApp(t)
+
+	admin := models.NewUser("admin", nil)
+	admin.ID = "admin-id"
+	admin.Role = models.RoleAdmin
+	if err := admin.SetPassword("admin-password"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := app.db.CreateUser(ctx, admin); err != nil {
+		t.Fatalf("Failed to create admin: %v", err)
+	}
+	request := models.NewPrintRequest(admin.ID, "https://example.com/model.stl", "")
+	request.ID = "analytics-request"
+	if err := app.db.CreatePrintRequest(ctx, request); err != nil {
+		t.Fatalf("Failed to create print request: %v", err)
+	}
+	adminClient, status := app.login(t, "admin", "admin-password")
+	if status != http.StatusOK {
+		t.Fatalf("Failed to log in as admin: %d", status)
+	}
+
+	report := func(query string) models.AnalyticsReport {
+		t.Helper()
+		status, data := app.do(t, adminClient, http.MethodGet, "/api/admin/analytics"+query, nil)
+		var report models.AnalyticsReport
+		if err := json.Unmarshal(data, &report); status != http.StatusOK || err != nil {
+			t.Fatalf("Failed to report analytics %q: %d %s", query, status, data)
+		}
+		return report
+	}
+
+	// The last 30 days by default, including today's submission
+	got := report("")
+	if len(got.Throughput) != 30 || got.Bucket != models.AnalyticsBucketDay {
+		t.Fatalf("Expected 30 daily buckets, got %d %s", len(got.Throughput), got.Bucket)
+	}
+	if counts := got.Throughput[29].Counts; counts["StatusPendingApproval"] != 1 || counts["StatusDone"] != 0 {
+		t.Errorf("Expected today's submission, got %v", counts)
+	}
+	if len(got.TopRequesters) != 1 || got.TopRequesters[0].Username != "admin" {
+		t.Errorf("Expected the admin as top requester, got %+v", got.TopRequesters)
+	}
+
+	// Both ends of the range are included, and weeks start on Monday
+	got = report("?from=2024-05-01&to=2024-05-06&bucket=week")
+	if len(got.Throughput) != 2 || got.Throughput[0].Start != "2024-04-29" || got.Throughput[1].Start != "2024-05-06" {
+		t.Errorf("Expected the weeks of April 29 and May 6, got %+v", got.Throughput)
+	}
+	if got.Approval.Count != 0 || got.Approval.MedianSeconds != nil {
+		t.Errorf("Expected no approvals, got %+v", got.Approval)
+	}
+
+	for _, query := range []string{"?bucket=month", "?from=May", "?from=2024-05-02&to=2024-05-01", "?from=2020-01-01&to=2024-01-01", "?top=0"} {
+		if status, _ := app.do(t, adminClient, http.MethodGet, "/api/admin/analytics"+query, nil); status != http.StatusBadRequest {
+			t.Errorf("Expected %q to be rejected, got %d", query, status)
+		}
+	}
+	if got = report("?from=2020-01-01&to=2024-01-01&bucket=week"); len(got.Throughput) != 210 {
+		t.Errorf("Expected 210 weekly buckets, got %d", len(got.Throughput))
+	}
+}
+
+func TestUserStats(t *testing.T) {
+	ctx := context.Background()
+	app := newAdminTestApp(t)
+
+	for _, username := range []string{"ana", "bo"} {
+		user := models.NewUser(username, nil)
+		user.ID = username + "-id"
+		if err := user.SetPassword(username + "-password"); err != nil {
+			t.Fatalf("Failed to set password: %v", err)
+		}
+		if err := app.db.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create %s: %v", username, err)
+		}
+	}
+	for i, status := range []models.PrintRequestStatus{models.StatusPendingApproval, models.StatusEnqueued, models.StatusEnqueued} {
+		request := models.NewPrintRequest("ana-id", "https://example.com/model.stl", "")
+		request.ID = fmt.Sprintf("stats-request-%d", i)
+		request.Status = status
+		if err := app.db.CreatePrintRequest(ctx, request); err != nil {
+			t.Fatalf("Failed to create print request: %v", err)
+		}
+	}
+
+	stats := func(username, query string) models.UserStats {
+		t.Helper()
+		client, status := app.login(t, username, username+"-password")
+		if status != http.StatusOK {
+			t.Fatalf("Failed to log in as %s: %d", username, status)
+		}
+		status, data := app.do(t, client, http.MethodGet, "/api/user/stats"+query, nil)
+		var stats models.UserStats
+		if err := json.Unmarshal(data, &stats); status != http.StatusOK || err != nil {
+			t.Fatalf("Failed to get stats %q: %d %s", query, status, data)
+		}
+		return stats
+	}
+
+	// Users only see their own requests, with a year of history by default
+	got := stats("ana", "")
+	if got.Total != 3 || got.Counts["StatusPendingApproval"] != 1 || got.Counts["StatusEnqueued"] != 2 || got.Counts["StatusDone"] != 0 {
+		t.Errorf("Expected ana's 3 requests, got %+v", got)
+	}
+	if len(got.History) != 12 || got.History[11].Submitted != 3 || got.History[11].Month != time.Now().UTC().Format("2006-01") {
+		t.Errorf("Expected 12 months of history ending with 3 requests this month, got %+v", got.History)
+	}
+	if got.AverageTurnaroundSeconds != nil || got.Quota != nil {
+		t.Errorf("Expected no turnaround or quota, got %+v", got)
+	}
+
+	if got = stats("bo", "?months=2"); got.Total != 0 || len(got.History) != 2 || got.History[1].Submitted != 0 {
+		t.Errorf("Expected no requests for bo, got %+v", got)
+	}
+
+	client, _ := app.login(t, "bo", "bo-password")
+	for _, query := range []string{"?months=0", "?months=61", "?months=year"} {
+		if status, _ := app.do(t, client, http.MethodGet, "/api/user/stats"+query, nil); status != http.StatusBadRequest {
+			t.Errorf("Expected %q to be rejected, got %d", query, status)
+		}
+	}
+}
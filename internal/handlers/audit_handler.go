@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+const (
+	// defaultAuditPageSize is how many audit events are listed when no limit
+	// is given
+	defaultAuditPageSize = 50
+	// maxAuditPageSize is the most audit events listed at once
+	maxAuditPageSize = 500
+	// maxAuditExportRows is the most audit events exported at once
+	maxAuditExportRows = 100000
+)
+
+// recordAudit adds an event to the audit log, if there is one, filling in
+// the logged in user and where the request came from
+func recordAudit(r *http.Request, audit *services.AuditService, event *models.AuditEvent) {
+	if audit == nil {
+		return
+	}
+	if event.ActorID == nil {
+		if user := middleware.GetUser(r); user != nil {
+			event.ActorID = &user.ID
+			event.ActorName = user.Username
+		}
+	}
+	event.IPAddress = middleware.ClientIP(r)
+	event.UserAgent = r.UserAgent()
+	audit.Record(r.Context(), event)
+}
+
+// auditLogin records a user logging in
+func auditLogin(r *http.Request, audit *services.AuditService, user *models.User) {
+	recordAudit(r, audit, &models.AuditEvent{
+		ActorID:    &user.ID,
+		ActorName:  user.Username,
+		Action:     models.AuditLogin,
+		TargetType: models.AuditTargetUser,
+		TargetID:   user.ID,
+	})
+}
+
+// auditLoginFailed records a failed login, with the username tried, or the
+// user ID when it is known
+func auditLoginFailed(r *http.Request, audit *services.AuditService, username string, userID *string) {
+	event := &models.AuditEvent{
+		ActorID:    userID,
+		ActorName:  username,
+		Action:     models.AuditLoginFailed,
+		TargetType: models.AuditTargetUser,
+	}
+	if userID != nil {
+		event.TargetID = *userID
+	}
+	recordAudit(r, audit, event)
+}
+
+// AuditHandler handles HTTP requests for the audit log
+type AuditHandler struct {
+	audit  *services.AuditService
+	logger *slog.Logger
+}
+
+// NewAuditHandler creates a new audit handler
+func NewAuditHandler(audit *services.AuditService) *AuditHandler {
+	return &AuditHandler{
+		audit:  audit,
+		logger: slog.Default(),
+	}
+}
+
+// AuditEventPage is a page of the audit log
+type AuditEventPage struct {
+	Events []*models.AuditEvent `json:"events"`
+	Total  int                  `json:"total"`
+	Limit  int                  `json:"limit"`
+	Offset int                  `json:"offset"`
+}
+
+// ListEvents handles GET /api/admin/audit?actor=&action=&target_type=&target_id=&since=&until=&limit=&offset=
+func (h *AuditHandler) ListEvents(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseAuditFilter(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter.Limit = defaultAuditPageSize
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 || limit > maxAuditPageSize {
+			response.WriteBadRequestError(w, "Invalid limit", fmt.Sprintf("limit must be between 1 and %d", maxAuditPageSize))
+			return
+		}
+		filter.Limit = limit
+	}
+	if value := query.Get("offset"); value != "" {
+		offset, err := strconv.Atoi(value)
+		if err != nil || offset < 0 {
+			response.WriteBadRequestError(w, "Invalid offset", "offset must be zero or more")
+			return
+		}
+		filter.Offset = offset
+	}
+
+	events, total, err := h.audit.ListEvents(r.Context(), filter)
+	if err != nil {
+		h.logger.Error("failed to list audit events", "error", err)
+		response.WriteInternalError(w, "Failed to list audit events", err.Error())
+		return
+	}
+	if events == nil {
+		events = []*models.AuditEvent{}
+	}
+
+	response.WriteSuccessResponse(w, AuditEventPage{Events: events, Total: total, Limit: filter.Limit, Offset: filter.Offset}, "")
+}
+
+// ExportEvents handles GET /api/admin/audit/export?actor=&action=&target_type=&target_id=&since=&until=
+// and writes the matching events as CSV
+func (h *AuditHandler) ExportEvents(w http.ResponseWriter, r *http.Request) {
+	filter, ok := parseAuditFilter(w, r)
+	if !ok {
+		return
+	}
+	filter.Limit = maxAuditExportRows
+
+	events, total, err := h.audit.ListEvents(r.Context(), filter)
+	if err != nil {
+		h.logger.Error("failed to list audit events", "error", err)
+		response.WriteInternalError(w, "Failed to list audit events", err.Error())
+		return
+	}
+	if total > len(events) {
+		response.WriteBadRequestError(w, "Too many audit events",
+			fmt.Sprintf("%d events match, at most %d can be exported at once; narrow the filter", total, maxAuditExportRows))
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := services.WriteAuditEventsCSV(&buf, events); err != nil {
+		h.logger.Error("failed to write audit events", "error", err)
+		response.WriteInternalError(w, "Failed to export audit events", err.Error())
+		return
+	}
+
+	filename := fmt.Sprintf("audit-%s.csv", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
+
+// parseAuditFilter reads an audit event filter from the query string,
+// writing an error response if it is invalid
+func parseAuditFilter(w http.ResponseWriter, r *http.Request) (models.AuditEventFilter, bool) {
+	query := r.URL.Query()
+	filter := models.AuditEventFilter{
+		Actor:      query.Get("actor"),
+		Action:     models.AuditAction(query.Get("action")),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+	}
+
+	for name, dest := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			response.WriteBadRequestError(w, "Invalid "+name, name+" must be an RFC 3339 time, such as 2024-01-02T15:04:05Z")
+			return filter, false
+		}
+		*dest = &parsed
+	}
+
+	return filter, true
+}
+
+// equalStringPtr reports whether two optional strings are the same
+func equalStringPtr(a, b *string) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+func TestAuditLog(t *testing.T) {
+	ctx := context.Background()
+	app := newAdminTestApp(t)
+
+	for _, u := range []struct{ id, username, password string }{
+		{"admin-id", "admin", "admin-password"},
+		{"bob-id", "bob", "bob-password"},
+	} {
+		user := models.NewUser(u.username, nil)
+		user.ID = u.id
+		if u.username == "admin" {
+			user.Role = models.RoleAdmin
+		}
+		if err := user.SetPassword(u.password); err != nil {
+			t.Fatalf("Failed to set password: %v", err)
+		}
+		if err := app.db.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create %s: %v", u.username, err)
+		}
+	}
+
+	if _, status := app.login(t, "bob", "wrong-password"); status != http.StatusUnauthorized {
+		t.Fatalf("Expected a wrong password to fail, got %d", status)
+	}
+	adminClient, status := app.login(t, "admin", "admin-password")
+	if status != http.StatusOK {
+		t.Fatalf("Failed to log in as admin: %d", status)
+	}
+	if status, data := app.do(t, adminClient, http.MethodPut, "/api/admin/users/role?id=bob-id", map[string]string{"role": "moderator"}); status != http.StatusOK {
+		t.Fatalf("Failed to change role: %d %s", status, data)
+	}
+	if status, data := app.do(t, adminClient, http.MethodPut, "/api/admin/users/status?id=bob-id", map[string]bool{"enabled": false}); status != http.StatusOK {
+		t.Fatalf("Failed to disable user: %d %s", status, data)
+	}
+
+	list := func(query string) AuditEventPage {
+		t.Helper()
+		status, data := app.do(t, adminClient, http.MethodGet, "/api/admin/audit"+query, nil)
+		var page AuditEventPage
+		if err := json.Unmarshal(data, &page); status != http.StatusOK || err != nil {
+			t.Fatalf("Failed to list audit events %q: %d %s", query, status, data)
+		}
+		return page
+	}
+
+	// Role changes record the old role as well as the new one
+	page := list("?action=user.role_changed&target_id=bob-id")
+	if page.Total != 1 || len(page.Events) != 1 {
+		t.Fatalf("Expected one role change, got %+v", page)
+	}
+	event := page.Events[0]
+	if event.ActorID == nil || *event.ActorID != "admin-id" || event.ActorName != "admin" || event.TargetType != models.AuditTargetUser {
+		t.Errorf("Expected the admin to have changed bob's role, got %+v", event)
+	}
+	if change := event.Changes["role"]; change.Before != "user" || change.After != "moderator" {
+		t.Errorf("Expected the role to change from user to moderator, got %+v", change)
+	}
+	if event.IPAddress == "" || event.UserAgent == "" {
+		t.Errorf("Expected the IP address and user agent to be recorded, got %+v", event)
+	}
+
+	page = list("?action=user.status_changed")
+	if len(page.Events) != 1 || page.Events[0].Changes["enabled"].Before != true || page.Events[0].Changes["enabled"].After != false {
+		t.Errorf("Expected bob to have been disabled, got %+v", page.Events)
+	}
+
+	// Failed logins are recorded with the username tried
+	page = list("?actor=bob")
+	if len(page.Events) != 1 || page.Events[0].Action != models.AuditLoginFailed || page.Events[0].ActorID != nil {
+		t.Errorf("Expected bob's failed login, got %+v", page.Events)
+	}
+	page = list("?actor=admin-id&action=auth.login")
+	if len(page.Events) != 1 {
+		t.Errorf("Expected the admin's login, got %+v", page.Events)
+	}
+
+	// Events are paginated
+	page = list("?limit=3")
+	if page.Total != 4 || len(page.Events) != 3 || page.Limit != 3 {
+		t.Errorf("Expected the first 3 of 4 events, got %+v", page)
+	}
+	page = list("?limit=3&offset=3")
+	if page.Total != 4 || len(page.Events) != 1 || page.Offset != 3 {
+		t.Errorf("Expected the last of 4 events, got %+v", page)
+	}
+	if page = list("?since=2999-01-01T00:00:00Z"); page.Total != 0 || page.Events == nil {
+		t.Errorf("Expected no future events, got %+v", page)
+	}
+
+	for _, query := range []string{"?since=yesterday", "?limit=0", "?limit=501", "?offset=-1"} {
+		if status, _ := app.do(t, adminClient, http.MethodGet, "/api/admin/audit"+query, nil); status != http.StatusBadRequest {
+			t.Errorf("Expected %q to be rejected, got %d", query, status)
+		}
+	}
+
+	// The log can be exported as CSV
+	resp, err := adminClient.Get(app.server.URL + "/api/admin/audit/export?target_id=bob-id")
+	if err != nil {
+		t.Fatalf("Failed to export audit events: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/csv" {
+		t.Fatalf("Failed to export audit events: %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	rows, err := csv.NewReader(resp.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("Failed to read exported CSV: %v", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "created_at" {
+		t.Fatalf("Expected a header and 2 events, got %q", rows)
+	}
+	if rows[1][2] != "admin" || rows[1][5] != "bob-id" {
+		t.Errorf("Expected the admin's change to bob, got %q", rows[1])
+	}
+}
+
+func TestAuditLogAdministration(t *testing.T) {
+	ctx := context.Background()
+	app := newAdminTestApp(t)
+
+	admin := models.NewUser("admin", nil)
+	admin.ID = "admin-id"
+	admin.Role = models.RoleAdmin
+	if err := admin.SetPassword("admin-password"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	bob := models.NewUser("bob", nil)
+	bob.ID = uuid.NewString()
+	for _, user := range []*models.User{admin, bob} {
+		if err := app.db.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create %s: %v", user.Username, err)
+		}
+	}
+	lab := &models.Group{ID: uuid.NewString(), Name: "Lab", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	if err := app.db.CreateGroup(ctx, lab); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	adminClient, status := app.login(t, "admin", "admin-password")
+	if status != http.StatusOK {
+		t.Fatalf("Failed to log in as admin: %d", status)
+	}
+
+	// Anyone can claim to be forwarded from somewhere else, so the header is
+	// ignored on requests that don't come from a trusted proxy
+	body, _ := json.Marshal(RoleRequest{Name: "operator", Permissions: []models.Permission{models.PermissionViewOwnPrintRequests}})
+	req, _ := http.NewRequest(http.MethodPost, app.server.URL+"/api/admin/roles", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	resp, err := adminClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to create role: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("Failed to create role: %d", resp.StatusCode)
+	}
+
+	steps := []struct {
+		method, path string
+		body         any
+		expected     int
+	}{
+		{http.MethodPut, "/api/admin/roles?name=operator", RoleRequest{Description: "Runs the printers", Permissions: []models.Permission{models.PermissionCreatePrintRequests}}, http.StatusOK},
+		{http.MethodDelete, "/api/admin/roles?name=operator", nil, http.StatusNoContent},
+		{http.MethodPut, "/api/groups/members?group_id=" + lab.ID, SetGroupMemberRequest{UserID: bob.ID, Role: models.GroupRoleMember}, http.StatusOK},
+		{http.MethodPut, "/api/groups/members?group_id=" + lab.ID, SetGroupMemberRequest{UserID: bob.ID, Role: models.GroupRoleModerator}, http.StatusOK},
+		{http.MethodDelete, "/api/groups/members?group_id=" + lab.ID + "&user_id=" + bob.ID, nil, http.StatusNoContent},
+	}
+	for _, step := range steps {
+		if status, data := app.do(t, adminClient, step.method, step.path, step.body); status != step.expected {
+			t.Fatalf("%s %s: expected %d, got %d %s", step.method, step.path, step.expected, status, data)
+		}
+	}
+	status, data := app.do(t, adminClient, http.MethodPost, "/api/admin/invitations", CreateInvitationRequest{GroupID: lab.ID})
+	var invitation CreateInvitationResponse
+	if err := json.Unmarshal(data, &invitation); status != http.StatusCreated || err != nil {
+		t.Fatalf("Failed to create invitation: %d %s", status, data)
+	}
+	if status, _ := app.do(t, adminClient, http.MethodDelete, "/api/admin/invitations?id="+invitation.ID, nil); status != http.StatusNoContent {
+		t.Fatalf("Failed to revoke invitation: %d", status)
+	}
+
+	events, _, err := services.NewAuditService(app.db).ListEvents(ctx, models.AuditEventFilter{})
+	if err != nil {
+		t.Fatalf("Failed to list audit events: %v", err)
+	}
+	byAction := map[models.AuditAction][]*models.AuditEvent{}
+	for _, event := range events {
+		byAction[event.Action] = append(byAction[event.Action], event)
+	}
+
+	created := byAction[models.AuditRoleCreated]
+	if len(created) != 1 || created[0].TargetID != "operator" || created[0].ActorName != "admin" {
+		t.Fatalf("Expected the admin to have created the operator role, got %+v", created)
+	}
+	if created[0].IPAddress != "127.0.0.1" {
+		t.Errorf("Expected the forwarded address to be ignored, got %q", created[0].IPAddress)
+	}
+	if updated := byAction[models.AuditRoleUpdated]; len(updated) != 1 || updated[0].Changes["description"].Before != "" || updated[0].Changes["description"].After != "Runs the printers" {
+		t.Errorf("Expected the role's description change, got %+v", updated)
+	}
+	if deleted := byAction[models.AuditRoleDeleted]; len(deleted) != 1 || deleted[0].Changes["description"].Before != "Runs the printers" {
+		t.Errorf("Expected the role's deletion, got %+v", deleted)
+	}
+
+	set := byAction[models.AuditGroupMemberSet]
+	if len(set) != 2 || set[0].TargetID != lab.ID || set[0].TargetType != models.AuditTargetGroup {
+		t.Fatalf("Expected bob to have been added and promoted, got %+v", set)
+	}
+	// Newest first
+	if change := set[0].Changes["role"]; change.Before != "member" || change.After != "moderator" {
+		t.Errorf("Expected bob to have been promoted, got %+v", change)
+	}
+	if change := set[1].Changes["role"]; change.Before != nil || change.After != "member" {
+		t.Errorf("Expected bob to have been added, got %+v", change)
+	}
+	if removed := byAction[models.AuditGroupMemberRemoved]; len(removed) != 1 || removed[0].Changes["user_id"].Before != bob.ID || removed[0].Changes["role"].Before != "moderator" {
+		t.Errorf("Expected bob to have been removed, got %+v", removed)
+	}
+
+	if created := byAction[models.AuditInvitationCreated]; len(created) != 1 || created[0].TargetID != invitation.ID || created[0].Changes["group_id"].After != lab.ID {
+		t.Errorf("Expected the invitation to lab to have been created, got %+v", created)
+	}
+	if revoked := byAction[models.AuditInvitationRevoked]; len(revoked) != 1 || revoked[0].TargetID != invitation.ID {
+		t.Errorf("Expected the invitation to have been revoked, got %+v", revoked)
+	}
+}
@@ -2,33 +2,63 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strings"
 
 	"github.com/bjschafer/print-dis/internal/config"
 	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
 	"github.com/bjschafer/print-dis/internal/response"
 	"github.com/bjschafer/print-dis/internal/services"
 	"github.com/bjschafer/print-dis/internal/validation"
+	"github.com/bjschafer/print-dis/internal/webauthn"
 )
 
 // AuthHandler handles authentication-related HTTP requests
 type AuthHandler struct {
 	userService  *services.UserService
+	twoFactor    *services.TwoFactorService
 	sessionStore *middleware.SessionStore
 	config       *config.Config
+	quotas       *services.QuotaService
+	webAuthn     *services.WebAuthnService
+	emails       *services.EmailService
+	audit        *services.AuditService
 }
 
 // NewAuthHandler creates a new AuthHandler
-func NewAuthHandler(userService *services.UserService, sessionStore *middleware.SessionStore, config *config.Config) *AuthHandler {
+func NewAuthHandler(userService *services.UserService, twoFactor *services.TwoFactorService, sessionStore *middleware.SessionStore, config *config.Config) *AuthHandler {
 	return &AuthHandler{
 		userService:  userService,
+		twoFactor:    twoFactor,
 		sessionStore: sessionStore,
 		config:       config,
 	}
 }
 
+// SetQuotas includes the user's quota status in the current user response
+func (h *AuthHandler) SetQuotas(quotas *services.QuotaService) {
+	h.quotas = quotas
+}
+
+// SetWebAuthn allows logging in with a passkey instead of a password
+func (h *AuthHandler) SetWebAuthn(webAuthn *services.WebAuthnService) {
+	h.webAuthn = webAuthn
+}
+
+// SetEmail allows resetting forgotten passwords and verifying email addresses
+// with links sent by email
+func (h *AuthHandler) SetEmail(emails *services.EmailService) {
+	h.emails = emails
+}
+
+// SetAudit records logins and failed logins in the audit log
+func (h *AuthHandler) SetAudit(audit *services.AuditService) {
+	h.audit = audit
+}
+
 // LoginRequest represents a login request
 type LoginRequest struct {
 	Username string `json:"username"`
@@ -50,11 +80,42 @@ func (r *LoginRequest) Validate() validation.ValidationErrors {
 	return validator.Errors()
 }
 
+// TwoFactorLoginRequest represents the second step of logging in, with
+// either a code from the user's authenticator app or a recovery code
+type TwoFactorLoginRequest struct {
+	Code         string `json:"code,omitempty"`
+	RecoveryCode string `json:"recovery_code,omitempty"`
+}
+
+// Validate validates the two-factor login request
+func (r *TwoFactorLoginRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Code = validation.SanitizeString(r.Code)
+	r.RecoveryCode = validation.SanitizeString(r.RecoveryCode)
+
+	if (r.Code == "") == (r.RecoveryCode == "") {
+		validator.AddError("code", "either code or recovery_code is required")
+	}
+	validator.ValidateLength("code", r.Code, 0, 10)
+	validator.ValidateLength("recovery_code", r.RecoveryCode, 0, 20)
+
+	return validator.Errors()
+}
+
+// TwoFactorChallengeResponse is returned by Login when the user must also
+// enter a two-factor code at /api/auth/login/2fa
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool `json:"two_factor_required"`
+}
+
 // RegisterRequest represents a registration request
 type RegisterRequest struct {
 	Username string `json:"username"`
 	Email    string `json:"email,omitempty"`
 	Password string `json:"password"`
+	// InvitationCode lets people register when open registration is disabled
+	InvitationCode string `json:"invitation_code,omitempty"`
 }
 
 // Validate validates the registration request
@@ -84,6 +145,18 @@ type UserResponse struct {
 	DisplayName *string `json:"display_name,omitempty"`
 	Enabled     bool    `json:"enabled"`
 	Role        string  `json:"role"`
+
+	// EmailVerificationRequired is set after registering when the user must
+	// follow the link emailed to them before they can log in
+	EmailVerificationRequired bool `json:"email_verification_required,omitempty"`
+	// PasswordChangeRequired is set when the user has a temporary password
+	// from an admin, and must change it before doing anything else
+	PasswordChangeRequired bool `json:"password_change_required,omitempty"`
+
+	Quota       *models.QuotaStatus       `json:"quota,omitempty"`       // Only set on the current user when quotas are enabled
+	Groups      []models.GroupMembership  `json:"groups,omitempty"`      // Only set on the current user
+	Permissions []models.Permission       `json:"permissions,omitempty"` // Only set on the current user
+	TwoFactor   *services.TwoFactorStatus `json:"two_factor,omitempty"`  // Only set on the current user
 }
 
 // Login handles user login
@@ -108,12 +181,173 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	// Authenticate user
 	user, err := h.userService.AuthenticateUser(r.Context(), req.Username, req.Password)
+	if err != nil {
+		auditLoginFailed(r, h.audit, req.Username, nil)
+	}
+	if errors.Is(err, services.ErrEmailNotVerified) {
+		slog.Info("unverified user attempted login", "username", validation.SanitizeLogString(req.Username))
+		response.WriteForbiddenError(w, "Verify your email address with the link sent to it before logging in")
+		return
+	}
+	if errors.Is(err, services.ErrAccountLocked) {
+		slog.Warn("login to locked username refused", "username", validation.SanitizeLogString(req.Username))
+		response.WriteErrorResponse(w, http.StatusTooManyRequests, response.BadRequest, "Too many failed logins. Try again later, or reset your password.", "")
+		return
+	}
 	if err != nil {
 		slog.Info("authentication failed", "username", validation.SanitizeLogString(req.Username), "error", err)
 		response.WriteUnauthorizedError(w, "Invalid credentials")
 		return
 	}
 
+	// Users with two-factor authentication get a partial session until they
+	// enter their code
+	twoFactorEnabled, err := h.twoFactor.IsEnabled(r.Context(), user.ID)
+	if err != nil {
+		slog.Error("failed to check two-factor authentication", "user_id", user.ID, "error", err)
+		response.WriteInternalError(w, "Failed to log in", err.Error())
+		return
+	}
+	if twoFactorEnabled {
+		if err := h.sessionStore.BeginTwoFactorLogin(w, r, user.ID); err != nil {
+			slog.Error("failed to create session", "user_id", user.ID, "error", err)
+			response.WriteInternalError(w, "Failed to create session", err.Error())
+			return
+		}
+		response.WriteSuccessResponse(w, TwoFactorChallengeResponse{TwoFactorRequired: true}, "Two-factor authentication code required")
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// LoginTwoFactor handles the second step of logging in for users with
+// two-factor authentication
+func (h *AuthHandler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		return
+	}
+
+	userID := h.sessionStore.PendingTwoFactorUser(r)
+	if userID == "" {
+		response.WriteUnauthorizedError(w, "Log in with your password first")
+		return
+	}
+
+	var req TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	var err error
+	if req.RecoveryCode != "" {
+		err = h.twoFactor.UseRecoveryCode(r.Context(), userID, req.RecoveryCode)
+	} else {
+		err = h.twoFactor.Verify(r.Context(), userID, req.Code)
+	}
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidTwoFactorCode) {
+			slog.Info("two-factor authentication failed", "user_id", userID)
+			auditLoginFailed(r, h.audit, "", &userID)
+			if err := h.sessionStore.RecordTwoFactorFailure(w, r); err != nil {
+				slog.Error("failed to record two-factor failure", "user_id", userID, "error", err)
+			}
+			response.WriteUnauthorizedError(w, "Invalid code")
+			return
+		}
+		slog.Error("failed to verify two-factor code", "user_id", userID, "error", err)
+		response.WriteInternalError(w, "Failed to verify code", err.Error())
+		return
+	}
+
+	user, err := h.userService.GetUser(r.Context(), userID)
+	if err != nil {
+		slog.Error("failed to get user", "user_id", userID, "error", err)
+		response.WriteUnauthorizedError(w, "Invalid credentials")
+		return
+	}
+	if user == nil || !user.Enabled {
+		response.WriteUnauthorizedError(w, "Invalid credentials")
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// BeginPasskeyLogin handles POST /api/auth/login/passkey/options, which
+// returns the options to pass to navigator.credentials.get() to log in with a
+// passkey instead of a password
+func (h *AuthHandler) BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if h.webAuthn == nil {
+		response.WriteNotFoundError(w, "Passkey login is not enabled")
+		return
+	}
+
+	options, err := h.webAuthn.BeginLogin()
+	if err != nil {
+		slog.Error("failed to begin passkey login", "error", err)
+		response.WriteInternalError(w, "Failed to log in", err.Error())
+		return
+	}
+	if err := saveChallenge(w, r, webAuthnLoginKey, options.Challenge); err != nil {
+		slog.Error("failed to save session", "error", err)
+		response.WriteInternalError(w, "Failed to log in", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, options, "")
+}
+
+// LoginPasskey handles POST /api/auth/login/passkey with the credential
+// returned by navigator.credentials.get(). Passkeys verify the user, e.g. with
+// a PIN or fingerprint, so no two-factor code is asked for.
+func (h *AuthHandler) LoginPasskey(w http.ResponseWriter, r *http.Request) {
+	if h.webAuthn == nil {
+		response.WriteNotFoundError(w, "Passkey login is not enabled")
+		return
+	}
+
+	var assertion webauthn.AssertionResponse
+	if err := json.NewDecoder(r.Body).Decode(&assertion); err != nil {
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	challenge := takeChallenge(w, r, webAuthnLoginKey)
+	if challenge == nil {
+		response.WriteUnauthorizedError(w, "Start logging in with the passkey again")
+		return
+	}
+
+	user, err := h.webAuthn.FinishLogin(r.Context(), challenge, &assertion)
+	if err != nil {
+		if errors.Is(err, webauthn.ErrInvalidResponse) {
+			slog.Info("passkey authentication failed", "error", err)
+			response.WriteUnauthorizedError(w, "Passkey not recognised")
+			return
+		}
+		slog.Error("failed to verify passkey", "error", err)
+		response.WriteInternalError(w, "Failed to log in", err.Error())
+		return
+	}
+	if !user.Enabled {
+		slog.Info("disabled user attempted passkey login", "user_id", user.ID)
+		response.WriteUnauthorizedError(w, "Invalid credentials")
+		return
+	}
+
+	h.completeLogin(w, r, user)
+}
+
+// completeLogin starts a logged in session for the user
+func (h *AuthHandler) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User) {
 	// Create session with regeneration to prevent session fixation
 	if err := h.sessionStore.RegenerateSession(w, r, user.ID); err != nil {
 		slog.Error("failed to create session", "user_id", user.ID, "error", err)
@@ -123,16 +357,18 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 
 	// Return user info
 	userResponse := UserResponse{
-		ID:          user.ID,
-		Username:    user.Username,
-		Email:       user.Email,
-		DisplayName: user.DisplayName,
-		Enabled:     user.Enabled,
-		Role:        string(user.Role),
+		ID:                     user.ID,
+		Username:               user.Username,
+		Email:                  user.Email,
+		DisplayName:            user.DisplayName,
+		Enabled:                user.Enabled,
+		Role:                   string(user.Role),
+		PasswordChangeRequired: user.MustChangePassword,
 	}
 
 	response.WriteSuccessResponse(w, userResponse, "Login successful")
 	slog.Info("user logged in", "user_id", user.ID, "username", user.Username)
+	auditLogin(r, h.audit, user)
 }
 
 // Logout handles user logout
@@ -166,12 +402,6 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Check if registration is allowed
-	if !h.config.Auth.LocalAuth.AllowRegistration {
-		response.WriteForbiddenError(w, "Registration is disabled")
-		return
-	}
-
 	var req RegisterRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		slog.Error("failed to decode register request", "error", err)
@@ -179,17 +409,32 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Check if registration is allowed. Invited users can always register.
+	if !h.config.Auth.LocalAuth.AllowRegistration && req.InvitationCode == "" {
+		response.WriteForbiddenError(w, "Registration is disabled")
+		return
+	}
+
 	// Validate input
 	if validationErrors := req.Validate(); len(validationErrors) > 0 {
 		validation.WriteValidationError(w, validationErrors)
 		return
 	}
 
-	// Register user
-	user, err := h.userService.RegisterUser(r.Context(), req.Username, req.Email, req.Password)
+	// Register user. Verification emails link to this server.
+	ctx := services.WithPublicURL(r.Context(), h.config.Server.BaseURL)
+	var user *models.User
+	var err error
+	if req.InvitationCode != "" {
+		user, err = h.userService.RegisterInvitedUser(ctx, req.InvitationCode, req.Username, req.Email, req.Password)
+	} else {
+		user, err = h.userService.RegisterUser(ctx, req.Username, req.Email, req.Password)
+	}
 	if err != nil {
 		slog.Info("registration failed", "username", validation.SanitizeLogString(req.Username), "error", err)
-		if strings.Contains(err.Error(), "already exists") {
+		if errors.Is(err, services.ErrInvalidInvitation) {
+			response.WriteBadRequestError(w, "This invitation code is invalid, used up or expired", "")
+		} else if strings.Contains(err.Error(), "already exists") {
 			response.WriteConflictError(w, err.Error(), "User with this username or email already exists")
 		} else {
 			response.WriteBadRequestError(w, "Registration failed", err.Error())
@@ -197,12 +442,6 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Automatically log in the user after registration
-	if err := h.sessionStore.LoginUser(w, r, user.ID); err != nil {
-		slog.Error("failed to create session after registration", "user_id", user.ID, "error", err)
-		// Don't fail the registration, just log the error
-	}
-
 	// Return user info
 	userResponse := UserResponse{
 		ID:          user.ID,
@@ -213,6 +452,20 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		Role:        string(user.Role),
 	}
 
+	if h.config.Auth.LocalAuth.RequireEmailVerification {
+		// The user logs in once they have verified their address
+		userResponse.EmailVerificationRequired = true
+		response.WriteCreatedResponse(w, userResponse, "Check your email for a link to verify your address")
+		slog.Info("user registered", "user_id", user.ID, "username", user.Username)
+		return
+	}
+
+	// Automatically log in the user after registration
+	if err := h.sessionStore.LoginUser(w, r, user.ID); err != nil {
+		slog.Error("failed to create session after registration", "user_id", user.ID, "error", err)
+		// Don't fail the registration, just log the error
+	}
+
 	response.WriteCreatedResponse(w, userResponse, "User registered successfully")
 	slog.Info("user registered", "user_id", user.ID, "username", user.Username)
 }
@@ -238,12 +491,37 @@ func (h *AuthHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
 	}
 
 	userResponse := UserResponse{
-		ID:          user.ID,
-		Username:    user.Username,
-		Email:       user.Email,
-		DisplayName: user.DisplayName,
-		Enabled:     user.Enabled,
-		Role:        string(user.Role),
+		ID:                     user.ID,
+		Username:               user.Username,
+		Email:                  user.Email,
+		DisplayName:            user.DisplayName,
+		Enabled:                user.Enabled,
+		Role:                   string(user.Role),
+		PasswordChangeRequired: user.MustChangePassword,
+		Permissions:            user.GrantedPermissions(),
+	}
+
+	// Memberships are loaded by the auth middleware, which also limits the
+	// permissions of requests made with an API token to the token's scopes
+	if current := middleware.GetUser(r); current != nil {
+		userResponse.Groups = current.Memberships
+		userResponse.Permissions = current.GrantedPermissions()
+	}
+
+	twoFactor, err := h.twoFactor.Status(r.Context(), user)
+	if err != nil {
+		slog.Error("failed to get two-factor status", "user_id", userID, "error", err)
+	} else {
+		userResponse.TwoFactor = twoFactor
+	}
+
+	if h.quotas != nil {
+		quota, err := h.quotas.Status(r.Context(), user)
+		if err != nil {
+			slog.Error("failed to get quota status", "user_id", userID, "error", err)
+		} else {
+			userResponse.Quota = quota
+		}
 	}
 
 	response.WriteSuccessResponse(w, userResponse, "")
@@ -293,6 +571,10 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Changing the password logs out all sessions, so note whether this
+	// request has one to replace
+	hasSession := h.sessionStore.CurrentSessionID(r) != ""
+
 	// Change password
 	if err := h.userService.ChangePassword(r.Context(), userID, req.CurrentPassword, req.NewPassword); err != nil {
 		slog.Info("password change failed", "user_id", userID, "error", err)
@@ -304,6 +586,176 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Keep the user logged in here with a fresh session
+	if hasSession {
+		if err := h.sessionStore.RegenerateSession(w, r, userID); err != nil {
+			slog.Error("failed to regenerate session after password change", "error", err, "user_id", userID)
+		}
+	}
+
 	response.WriteSuccessResponse(w, nil, "Password changed successfully")
 	slog.Info("password changed", "user_id", userID)
 }
+
+// EmailLinkRequest asks for a link to be emailed to an address, to reset a
+// forgotten password or verify the address
+type EmailLinkRequest struct {
+	Email string `json:"email"`
+}
+
+// Validate validates the email link request
+func (r *EmailLinkRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Email = validation.SanitizeString(r.Email)
+
+	validator.ValidateRequired("email", r.Email)
+	validator.ValidateEmail("email", r.Email)
+	validator.ValidateLength("email", r.Email, 1, 254)
+
+	return validator.Errors()
+}
+
+// ResetPasswordRequest sets a new password with the token from a password
+// reset link
+type ResetPasswordRequest struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// Validate validates the reset password request
+func (r *ResetPasswordRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Token = validation.SanitizeString(r.Token)
+
+	validator.ValidateRequired("token", r.Token)
+	validator.ValidateRequired("password", r.Password)
+	validator.ValidateLength("token", r.Token, 1, 100)
+	validator.ValidateLength("password", r.Password, 8, 128)
+
+	return validator.Errors()
+}
+
+// VerifyEmailRequest verifies an email address with the token from a
+// verification link
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+// Validate validates the verify email request
+func (r *VerifyEmailRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Token = validation.SanitizeString(r.Token)
+
+	validator.ValidateRequired("token", r.Token)
+	validator.ValidateLength("token", r.Token, 1, 100)
+
+	return validator.Errors()
+}
+
+// ForgotPassword handles POST /api/auth/forgot-password, which emails a
+// password reset link. It responds the same whether or not the address
+// belongs to an account.
+func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	// Links can only be emailed if the server knows its public URL
+	if h.emails == nil || h.config.Server.BaseURL == "" {
+		response.WriteNotFoundError(w, "Password reset is not enabled")
+		return
+	}
+
+	var req EmailLinkRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx := services.WithPublicURL(r.Context(), h.config.Server.BaseURL)
+	if err := h.emails.RequestPasswordReset(ctx, req.Email); err != nil {
+		slog.Error("failed to request password reset", "error", err)
+		response.WriteInternalError(w, "Failed to send password reset link", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, nil, "If an account has this email address, a link to reset its password has been sent to it")
+}
+
+// ResetPassword handles POST /api/auth/reset-password with the token from a
+// password reset link. The user is logged out everywhere, and logs in again
+// with the new password.
+func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	if h.emails == nil {
+		response.WriteNotFoundError(w, "Password reset is not enabled")
+		return
+	}
+
+	var req ResetPasswordRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	user, err := h.emails.ResetPassword(r.Context(), req.Token, req.Password)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidEmailToken) {
+			response.WriteBadRequestError(w, "This password reset link is invalid or has expired", "")
+			return
+		}
+		slog.Error("failed to reset password", "error", err)
+		response.WriteInternalError(w, "Failed to reset password", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, nil, "Password reset, log in with your new password")
+	slog.Info("password reset", "user_id", user.ID)
+}
+
+// VerifyEmail handles POST /api/auth/verify-email with the token from a
+// verification link
+func (h *AuthHandler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	if h.emails == nil {
+		response.WriteNotFoundError(w, "Email verification is not enabled")
+		return
+	}
+
+	var req VerifyEmailRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	if _, err := h.emails.VerifyEmail(r.Context(), req.Token); err != nil {
+		if errors.Is(err, services.ErrInvalidEmailToken) {
+			response.WriteBadRequestError(w, "This verification link is invalid or has expired", "")
+			return
+		}
+		slog.Error("failed to verify email", "error", err)
+		response.WriteInternalError(w, "Failed to verify email address", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, nil, "Email address verified")
+}
+
+// ResendVerification handles POST /api/auth/verify-email/resend, which emails
+// a new verification link. Like ForgotPassword, it does not reveal whether
+// the address belongs to an account.
+func (h *AuthHandler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	// Links can only be emailed if the server knows its public URL
+	if h.emails == nil || h.config.Server.BaseURL == "" {
+		response.WriteNotFoundError(w, "Email verification is not enabled")
+		return
+	}
+
+	var req EmailLinkRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	ctx := services.WithPublicURL(r.Context(), h.config.Server.BaseURL)
+	if err := h.emails.ResendVerification(ctx, req.Email); err != nil {
+		slog.Error("failed to resend verification email", "error", err)
+		response.WriteInternalError(w, "Failed to send verification link", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, nil, "If an account with this email address needs verifying, a new link has been sent to it")
+}
@@ -0,0 +1,390 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/mailer"
+	"github.com/bjschafer/print-dis/internal/mailer/mailertest"
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+// emailTestApp serves the auth endpoints, sending email through a fake SMTP
+// server
+type emailTestApp struct {
+	db     database.DBClient
+	server *httptest.Server
+	smtp   *mailertest.Server
+}
+
+func newEmailTestApp(t *testing.T, requireVerification bool) *emailTestApp {
+	t.Helper()
+	db := newTestDB(t)
+	smtp := mailertest.NewServer(t)
+	smtp.Username = "print-dis"
+	smtp.Password = "smtp-password"
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{Host: "localhost", Port: "8080", BaseURL: "https://print.example.com"},
+		Auth: config.AuthConfig{
+			Enabled:        true,
+			SessionSecret:  "test-session-secret-that-is-long-enough",
+			SessionTimeout: time.Hour,
+			LocalAuth: config.LocalAuthConfig{
+				Enabled:                  true,
+				AllowRegistration:        true,
+				RequireEmailVerification: requireVerification,
+				Lockout:                  config.LockoutConfig{Enabled: true, MaxAttempts: 3, Duration: time.Hour},
+			},
+		},
+	}
+	userService := services.NewUserService(db)
+	emailService := services.NewEmailService(db, mailer.NewSMTPMailer(mailer.SMTPConfig{
+		Host:     smtp.Host,
+		Port:     smtp.Port,
+		Username: "print-dis",
+		Password: "smtp-password",
+		TLS:      mailer.TLSNone,
+		From:     "print-dis <print@example.com>",
+	}))
+	if requireVerification {
+		userService.SetEmailVerification(emailService)
+	}
+	lockoutService := services.NewLockoutService(db, cfg.Auth.LocalAuth.Lockout)
+	lockoutService.SetNotifier(emailService)
+	userService.SetLockout(lockoutService)
+	adminHandler := NewAdminHandler(userService, cfg)
+	adminHandler.SetLockout(lockoutService)
+	sessionStore := middleware.NewSessionStore(cfg, db)
+	authHandler := NewAuthHandler(userService, services.NewTwoFactorService(db, cfg.Auth.LocalAuth.TOTP), sessionStore, cfg)
+	authHandler.SetEmail(emailService)
+	sessionMW := sessionStore.SessionMiddleware()
+	authMW := sessionStore.AuthMiddleware(cfg)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/auth/login", sessionMW(http.HandlerFunc(authHandler.Login)))
+	mux.Handle("/api/auth/register", sessionMW(http.HandlerFunc(authHandler.Register)))
+	mux.Handle("/api/auth/me", sessionMW(authMW(http.HandlerFunc(authHandler.GetCurrentUser))))
+	mux.HandleFunc("POST /api/auth/forgot-password", authHandler.ForgotPassword)
+	mux.HandleFunc("POST /api/auth/reset-password", authHandler.ResetPassword)
+	mux.HandleFunc("POST /api/auth/verify-email", authHandler.VerifyEmail)
+	mux.HandleFunc("POST /api/auth/verify-email/resend", authHandler.ResendVerification)
+	mux.HandleFunc("GET /api/admin/users/lockout", adminHandler.GetUserLockout)
+	mux.HandleFunc("DELETE /api/admin/users/lockout", adminHandler.UnlockUser)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &emailTestApp{db: db, server: server, smtp: smtp}
+}
+
+func (a *emailTestApp) do(t *testing.T, client *http.Client, method, path string, body any) (int, json.RawMessage) {
+	t.Helper()
+	var payload []byte
+	if body != nil {
+		payload, _ = json.Marshal(body)
+	}
+	req, _ := http.NewRequest(method, a.server.URL+path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s failed: %v", method, path, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&envelope)
+	return resp.StatusCode, envelope.Data
+}
+
+func (a *emailTestApp) login(t *testing.T, username, password string) (*http.Client, int) {
+	t.Helper()
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Jar: jar}
+	status, _ := a.do(t, client, http.MethodPost, "/api/auth/login", LoginRequest{Username: username, Password: password})
+	return client, status
+}
+
+// linkToken returns the token in the link in an email
+func linkToken(t *testing.T, msg mailertest.Message, param string) string {
+	t.Helper()
+	match := regexp.MustCompile(`https://print\.example\.com/auth\.html\?` + param + `=([A-Z2-7]+)`).FindStringSubmatch(msg.Body)
+	if match == nil {
+		t.Fatalf("Expected a %s link in %q", param, msg.Body)
+	}
+	return match[1]
+}
+
+func TestPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	app := newEmailTestApp(t, false)
+
+	email := "forgetful@example.com"
+	user := models.NewUser("forgetful", &email)
+	user.ID = "forgetful-id"
+	if err := user.SetPassword("old-password"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := app.db.CreateUser(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	oldSession, status := app.login(t, "forgetful", "old-password")
+	if status != http.StatusOK {
+		t.Fatalf("Failed to log in: %d", status)
+	}
+	anonymous := &http.Client{}
+
+	// Unknown addresses get the same response, and no email
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/forgot-password", EmailLinkRequest{Email: "stranger@example.com"}); status != http.StatusOK {
+		t.Errorf("Expected unknown address to be accepted, got %d", status)
+	}
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/forgot-password", EmailLinkRequest{Email: email}); status != http.StatusOK {
+		t.Fatalf("Failed to request password reset: %d", status)
+	}
+	messages := app.smtp.WaitForMessages(t, 1)
+	msg := messages[0]
+	if len(messages) != 1 || len(msg.To) != 1 || msg.To[0] != email || !strings.Contains(msg.Header.Get("Subject"), "Reset") {
+		t.Fatalf("Expected one reset email to %s, got %+v", email, messages)
+	}
+	token := linkToken(t, msg, "reset_token")
+
+	// Tokens are stored hashed
+	if stored, _ := app.db.UseEmailToken(ctx, models.EmailTokenPasswordReset, token, time.Now()); stored != nil {
+		t.Error("Expected the token not to be stored as sent")
+	}
+
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/reset-password", ResetPasswordRequest{Token: "WRONG", Password: "new-password"}); status != http.StatusBadRequest {
+		t.Errorf("Expected unknown token to be refused, got %d", status)
+	}
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/reset-password", ResetPasswordRequest{Token: token, Password: "short"}); status != http.StatusBadRequest {
+		t.Errorf("Expected short password to be refused, got %d", status)
+	}
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/reset-password", ResetPasswordRequest{Token: token, Password: "new-password"}); status != http.StatusOK {
+		t.Fatalf("Failed to reset password: %d", status)
+	}
+	// Links only work once
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/reset-password", ResetPasswordRequest{Token: token, Password: "another-password"}); status != http.StatusBadRequest {
+		t.Errorf("Expected used token to be refused, got %d", status)
+	}
+
+	// The old password and sessions no longer work
+	if _, status := app.login(t, "forgetful", "old-password"); status != http.StatusUnauthorized {
+		t.Errorf("Expected old password to be refused, got %d", status)
+	}
+	if status, _ := app.do(t, oldSession, http.MethodGet, "/api/auth/me", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected old session to be logged out, got %d", status)
+	}
+	if _, status := app.login(t, "forgetful", "new-password"); status != http.StatusOK {
+		t.Errorf("Expected new password to work, got %d", status)
+	}
+
+	// Only the latest link works
+	for range 2 {
+		if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/forgot-password", EmailLinkRequest{Email: email}); status != http.StatusOK {
+			t.Fatalf("Failed to request password reset: %d", status)
+		}
+	}
+	messages = app.smtp.WaitForMessages(t, 3)
+	first, second := linkToken(t, messages[1], "reset_token"), linkToken(t, messages[2], "reset_token")
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/reset-password", ResetPasswordRequest{Token: first, Password: "newer-password"}); status != http.StatusBadRequest {
+		t.Errorf("Expected replaced token to be refused, got %d", status)
+	}
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/reset-password", ResetPasswordRequest{Token: second, Password: "newer-password"}); status != http.StatusOK {
+		t.Errorf("Expected latest token to work, got %d", status)
+	}
+}
+
+func TestEmailLinksIgnoreRequestHost(t *testing.T) {
+	ctx := context.Background()
+	app := newEmailTestApp(t, false)
+
+	email := "spoofed@example.com"
+	user := models.NewUser("spoofed", &email)
+	if err := user.SetPassword("spoofed-password"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := app.db.CreateUser(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Links point at server.base_url whatever host the request claims
+	req, _ := http.NewRequest(http.MethodPost, app.server.URL+"/api/auth/forgot-password", strings.NewReader(`{"email":"`+email+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Forwarded-Proto", "https")
+	req.Host = "attacker.example"
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to request password reset: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("Failed to request password reset: %d", resp.StatusCode)
+	}
+	msg := app.smtp.WaitForMessages(t, 1)[0]
+	if strings.Contains(msg.Body, "attacker.example") {
+		t.Errorf("Expected the link not to use the request's host, got %q", msg.Body)
+	}
+	linkToken(t, msg, "reset_token")
+
+	// Without server.base_url, links are not emailed at all
+	cfg := &config.Config{Auth: config.AuthConfig{LocalAuth: config.LocalAuthConfig{Enabled: true}}}
+	authHandler := NewAuthHandler(services.NewUserService(app.db), services.NewTwoFactorService(app.db, cfg.Auth.LocalAuth.TOTP), middleware.NewSessionStore(cfg, app.db), cfg)
+	authHandler.SetEmail(services.NewEmailService(app.db, mailer.NewSMTPMailer(mailer.SMTPConfig{
+		Host: app.smtp.Host,
+		Port: app.smtp.Port,
+		TLS:  mailer.TLSNone,
+		From: "print-dis <print@example.com>",
+	})))
+	for path, handler := range map[string]http.HandlerFunc{
+		"/api/auth/forgot-password":     authHandler.ForgotPassword,
+		"/api/auth/verify-email/resend": authHandler.ResendVerification,
+	} {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"email":"`+email+`"}`)))
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("Expected %s to be disabled without a base URL, got %d", path, rec.Code)
+		}
+	}
+	if messages := app.smtp.Messages(); len(messages) != 1 {
+		t.Errorf("Expected no more email, got %d messages", len(messages))
+	}
+}
+
+func TestEmailVerification(t *testing.T) {
+	app := newEmailTestApp(t, true)
+	anonymous := &http.Client{}
+
+	register := RegisterRequest{Username: "newcomer", Password: "correct-horse-battery"}
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/register", register); status != http.StatusBadRequest {
+		t.Errorf("Expected registration without an email to be refused, got %d", status)
+	}
+	register.Email = "newcomer@example.com"
+	status, data := app.do(t, anonymous, http.MethodPost, "/api/auth/register", register)
+	var registered UserResponse
+	if err := json.Unmarshal(data, &registered); status != http.StatusCreated || err != nil || !registered.EmailVerificationRequired {
+		t.Fatalf("Expected registration to need verification, got %d %s", status, data)
+	}
+
+	// The verification email is sent before registering responds
+	messages := app.smtp.Messages()
+	if len(messages) != 1 || messages[0].To[0] != "newcomer@example.com" {
+		t.Fatalf("Expected a verification email, got %+v", messages)
+	}
+	token := linkToken(t, messages[0], "verify_token")
+
+	if _, status := app.login(t, "newcomer", "correct-horse-battery"); status != http.StatusForbidden {
+		t.Errorf("Expected login before verifying to be refused, got %d", status)
+	}
+	// Wrong passwords are refused as usual, without revealing the account
+	// is unverified
+	if _, status := app.login(t, "newcomer", "wrong-password"); status != http.StatusUnauthorized {
+		t.Errorf("Expected wrong password to be refused, got %d", status)
+	}
+
+	// Asking again replaces the first link
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/verify-email/resend", EmailLinkRequest{Email: "newcomer@example.com"}); status != http.StatusOK {
+		t.Fatalf("Failed to resend verification: %d", status)
+	}
+	messages = app.smtp.WaitForMessages(t, 2)
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/verify-email", VerifyEmailRequest{Token: token}); status != http.StatusBadRequest {
+		t.Errorf("Expected replaced token to be refused, got %d", status)
+	}
+	token = linkToken(t, messages[1], "verify_token")
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/verify-email", VerifyEmailRequest{Token: token}); status != http.StatusOK {
+		t.Fatalf("Failed to verify email: %d", status)
+	}
+
+	if _, status := app.login(t, "newcomer", "correct-horse-battery"); status != http.StatusOK {
+		t.Errorf("Expected login after verifying to succeed, got %d", status)
+	}
+
+	// Verified accounts are not sent more links
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/verify-email/resend", EmailLinkRequest{Email: "newcomer@example.com"}); status != http.StatusOK {
+		t.Errorf("Expected resend to be accepted, got %d", status)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if messages := app.smtp.Messages(); len(messages) != 2 {
+		t.Errorf("Expected no more emails, got %d", len(messages))
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	ctx := context.Background()
+	app := newEmailTestApp(t, false)
+	anonymous := &http.Client{}
+
+	email := "target@example.com"
+	user := models.NewUser("target", &email)
+	user.ID = "target-id"
+	if err := user.SetPassword("right-password"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := app.db.CreateUser(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Known and unknown usernames are locked after the same failures, with
+	// the same responses
+	for _, username := range []string{"target", "ghost"} {
+		for i, expected := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests, http.StatusTooManyRequests} {
+			if _, status := app.login(t, username, "wrong-password"); status != expected {
+				t.Errorf("Expected attempt %d to %s to get %d, got %d", i+1, username, expected, status)
+			}
+		}
+	}
+	if _, status := app.login(t, "TARGET", "right-password"); status != http.StatusTooManyRequests {
+		t.Errorf("Expected the right password to be refused while locked, got %d", status)
+	}
+
+	// Only the real account is told, once
+	messages := app.smtp.WaitForMessages(t, 1)
+	if messages[0].To[0] != email || !strings.Contains(messages[0].Body, "3 failed attempts") {
+		t.Errorf("Expected a lockout email to %s, got %+v", email, messages[0])
+	}
+
+	status, data := app.do(t, anonymous, http.MethodGet, "/api/admin/users/lockout?id="+user.ID, nil)
+	var lockout UserLockoutResponse
+	if err := json.Unmarshal(data, &lockout); status != http.StatusOK || err != nil || !lockout.Locked || lockout.FailedAttempts != 3 {
+		t.Errorf("Expected user to be locked after 3 failures, got %d %s", status, data)
+	}
+	if status, _ := app.do(t, anonymous, http.MethodDelete, "/api/admin/users/lockout?id="+user.ID, nil); status != http.StatusNoContent {
+		t.Fatalf("Failed to unlock user: %d", status)
+	}
+	if _, status := app.login(t, "target", "right-password"); status != http.StatusOK {
+		t.Errorf("Expected login after unlocking to succeed, got %d", status)
+	}
+
+	// Resetting the password also unlocks the account
+	for range 3 {
+		app.login(t, "target", "wrong-password")
+	}
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/forgot-password", EmailLinkRequest{Email: email}); status != http.StatusOK {
+		t.Fatalf("Failed to request password reset: %d", status)
+	}
+	// The second lockout email and the reset email are sent in the background,
+	// in either order
+	var token string
+	for _, msg := range app.smtp.WaitForMessages(t, 3)[1:] {
+		if strings.Contains(msg.Body, "reset_token") {
+			token = linkToken(t, msg, "reset_token")
+		}
+	}
+	if status, _ := app.do(t, anonymous, http.MethodPost, "/api/auth/reset-password", ResetPasswordRequest{Token: token, Password: "newer-password"}); status != http.StatusOK {
+		t.Fatalf("Failed to reset password: %d", status)
+	}
+	if _, status := app.login(t, "target", "newer-password"); status != http.StatusOK {
+		t.Errorf("Expected login after resetting password to succeed, got %d", status)
+	}
+}
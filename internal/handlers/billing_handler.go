@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/statement"
+	"github.com/bjschafer/print-dis/internal/validation"
+)
+
+// maxPaymentAmount is the largest single payment that can be recorded
+const maxPaymentAmount models.Money = 100000_00
+
+// BillingHandler handles HTTP requests for user balances, payments and statements
+type BillingHandler struct {
+	ledger *services.LedgerService
+	audit  *services.AuditService
+	logger *slog.Logger
+}
+
+// NewBillingHandler creates a new billing handler
+func NewBillingHandler(ledger *services.LedgerService) *BillingHandler {
+	return &BillingHandler{
+		ledger: ledger,
+		logger: slog.Default(),
+	}
+}
+
+// SetAudit records payments and waived charges in the audit log
+func (h *BillingHandler) SetAudit(audit *services.AuditService) {
+	h.audit = audit
+}
+
+// RecordPaymentRequest represents the request body for recording a payment
+type RecordPaymentRequest struct {
+	UserID    string        `json:"user_id"`
+	Amount    *models.Money `json:"amount"`
+	Method    string        `json:"method"`
+	Reference string        `json:"reference"`
+	Note      string        `json:"note"`
+}
+
+// Validate validates the record payment request
+func (r *RecordPaymentRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	validator.ValidateRequired("user_id", r.UserID)
+	validator.ValidateUUID("user_id", r.UserID)
+
+	if r.Amount == nil {
+		validator.AddError("amount", "is required")
+	} else if *r.Amount <= 0 {
+		validator.AddError("amount", "must be greater than zero")
+	} else if *r.Amount > maxPaymentAmount {
+		validator.AddError("amount", "must be at most "+maxPaymentAmount.String())
+	}
+
+	validator.ValidateLength("method", r.Method, 0, 50)
+	validator.ValidateNoHTML("method", r.Method)
+	validator.ValidateLength("reference", r.Reference, 0, 100)
+	validator.ValidateNoHTML("reference", r.Reference)
+	validator.ValidateNotes("note", r.Note)
+
+	return validator.Errors()
+}
+
+// WaiveChargeRequest represents the request body for waiving a charge
+type WaiveChargeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Validate validates the waive charge request
+func (r *WaiveChargeRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	validator.ValidateRequired("reason", r.Reason)
+	validator.ValidateLength("reason", r.Reason, 0, 500)
+	validator.ValidateNoHTML("reason", r.Reason)
+
+	return validator.Errors()
+}
+
+// Ledger lists a user's charges and payments
+type Ledger struct {
+	Balance  *models.Balance   `json:"balance"`
+	Charges  []*models.Charge  `json:"charges"`
+	Payments []*models.Payment `json:"payments"`
+}
+
+// GetBalance handles GET /api/billing/balance
+func (h *BillingHandler) GetBalance(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		response.WriteUnauthorizedError(w, "Authentication required")
+		return
+	}
+
+	balance, err := h.ledger.GetBalance(r.Context(), userID)
+	if err != nil {
+		response.WriteInternalError(w, "Failed to get balance", err.Error())
+		return
+	}
+	if balance == nil {
+		response.WriteNotFoundError(w, "User not found")
+		return
+	}
+
+	response.WriteSuccessResponse(w, balance, "")
+}
+
+// GetStatement handles GET /api/billing/statement?month=YYYY-MM&format=json|csv|pdf
+func (h *BillingHandler) GetStatement(w http.ResponseWriter, r *http.Request) {
+	userID := middleware.GetUserID(r)
+	if userID == "" {
+		response.WriteUnauthorizedError(w, "Authentication required")
+		return
+	}
+
+	h.writeStatement(w, r, userID)
+}
+
+// ListBalances handles GET /api/admin/billing/balances
+func (h *BillingHandler) ListBalances(w http.ResponseWriter, r *http.Request) {
+	balances, err := h.ledger.ListBalances(r.Context())
+	if err != nil {
+		response.WriteInternalError(w, "Failed to list balances", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, balances, "")
+}
+
+// GetLedger handles GET /api/admin/billing/ledger?user_id=
+func (h *BillingHandler) GetLedger(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	balance, err := h.ledger.GetBalance(r.Context(), userID)
+	if err != nil {
+		response.WriteInternalError(w, "Failed to get balance", err.Error())
+		return
+	}
+	if balance == nil {
+		response.WriteNotFoundError(w, "User not found")
+		return
+	}
+
+	charges, err := h.ledger.ListCharges(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("failed to list charges", "error", err, "user_id", validation.SanitizeLogString(userID))
+		response.WriteInternalError(w, "Failed to list charges", err.Error())
+		return
+	}
+	payments, err := h.ledger.ListPayments(r.Context(), userID)
+	if err != nil {
+		h.logger.Error("failed to list payments", "error", err, "user_id", validation.SanitizeLogString(userID))
+		response.WriteInternalError(w, "Failed to list payments", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, Ledger{Balance: balance, Charges: charges, Payments: payments}, "")
+}
+
+// RecordPayment handles POST /api/admin/billing/payments
+func (h *BillingHandler) RecordPayment(w http.ResponseWriter, r *http.Request) {
+	var req RecordPaymentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	payment := &models.Payment{
+		UserID:     req.UserID,
+		Amount:     *req.Amount,
+		Method:     req.Method,
+		Reference:  req.Reference,
+		Note:       req.Note,
+		RecordedBy: middleware.GetUserID(r),
+	}
+	if err := h.ledger.RecordPayment(r.Context(), payment); err != nil {
+		response.WriteInternalError(w, "Failed to record payment", err.Error())
+		return
+	}
+
+	recordAudit(r, h.audit, &models.AuditEvent{
+		Action:     models.AuditPaymentRecorded,
+		TargetType: models.AuditTargetPayment,
+		TargetID:   strconv.Itoa(payment.ID),
+		Changes: models.AuditChanges{
+			"user_id":   {After: payment.UserID},
+			"amount":    {After: payment.Amount},
+			"method":    {After: payment.Method},
+			"reference": {After: payment.Reference},
+		},
+	})
+
+	response.WriteCreatedResponse(w, payment, "Payment recorded successfully")
+}
+
+// WaiveCharge handles POST /api/admin/billing/charges/waive?id=
+func (h *BillingHandler) WaiveCharge(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id <= 0 {
+		response.WriteBadRequestError(w, "Invalid charge ID", "")
+		return
+	}
+
+	var req WaiveChargeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	charge, err := h.ledger.WaiveCharge(r.Context(), id, req.Reason)
+	if errors.Is(err, services.ErrChargeWaived) {
+		response.WriteConflictError(w, "Charge is already waived", "")
+		return
+	}
+	if err != nil {
+		response.WriteInternalError(w, "Failed to waive charge", err.Error())
+		return
+	}
+	if charge == nil {
+		response.WriteNotFoundError(w, "Charge not found")
+		return
+	}
+
+	recordAudit(r, h.audit, &models.AuditEvent{
+		Action:     models.AuditChargeWaived,
+		TargetType: models.AuditTargetCharge,
+		TargetID:   strconv.Itoa(charge.ID),
+		Changes: models.AuditChanges{
+			"waived":        {After: true},
+			"waived_reason": {After: charge.WaivedReason},
+		},
+	})
+
+	response.WriteSuccessResponse(w, charge, "Charge waived successfully")
+}
+
+// GetUserStatement handles GET /api/admin/billing/statement?user_id=&month=YYYY-MM&format=json|csv|pdf
+func (h *BillingHandler) GetUserStatement(w http.ResponseWriter, r *http.Request) {
+	userID, ok := userIDParam(w, r)
+	if !ok {
+		return
+	}
+
+	h.writeStatement(w, r, userID)
+}
+
+// userIDParam reads the user_id query parameter, writing an error response
+// and returning false if it is missing or not a UUID
+func userIDParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		response.WriteBadRequestError(w, "User ID is required", "")
+		return "", false
+	}
+
+	validator := validation.NewValidator()
+	validator.ValidateUUID("user_id", userID)
+	if validationErrors := validator.Errors(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return "", false
+	}
+	return userID, true
+}
+
+// writeStatement builds a user's statement for the requested month and writes
+// it in the requested format. The month defaults to the current one.
+func (h *BillingHandler) writeStatement(w http.ResponseWriter, r *http.Request, userID string) {
+	query := r.URL.Query()
+
+	month := time.Now().UTC()
+	if value := query.Get("month"); value != "" {
+		parsed, err := time.Parse("2006-01", value)
+		if err != nil {
+			response.WriteBadRequestError(w, "Invalid month", "month must be in YYYY-MM format")
+			return
+		}
+		month = parsed
+	}
+
+	format := query.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" && format != "pdf" {
+		response.WriteBadRequestError(w, "Invalid format", "format must be one of json, csv or pdf")
+		return
+	}
+
+	s, err := h.ledger.Statement(r.Context(), userID, month.Year(), month.Month())
+	if err != nil {
+		h.logger.Error("failed to build statement", "error", err, "user_id", validation.SanitizeLogString(userID))
+		response.WriteInternalError(w, "Failed to build statement", err.Error())
+		return
+	}
+	if s == nil {
+		response.WriteNotFoundError(w, "User not found")
+		return
+	}
+
+	var buf bytes.Buffer
+	var contentType string
+	switch format {
+	case "json":
+		response.WriteSuccessResponse(w, s, "")
+		return
+	case "csv":
+		contentType = "text/csv"
+		err = statement.WriteCSV(&buf, s)
+	case "pdf":
+		contentType = "application/pdf"
+		err = statement.WritePDF(&buf, s)
+	}
+	if err != nil {
+		h.logger.Error("failed to render statement", "error", err, "format", format)
+		response.WriteInternalError(w, "Failed to render statement", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", statement.Filename(s, format)))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(buf.Bytes())
+}
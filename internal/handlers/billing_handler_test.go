@@ -0,0 +1,248 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+// newBillingTestApp serves login and the billing endpoints, which are behind
+// the manage billing permission in the router
+func newBillingTestApp(t *testing.T) *emailTestApp {
+	t.Helper()
+	db := newTestDB(t)
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			Enabled:        true,
+			SessionSecret:  "test-session-secret-that-is-long-enough",
+			SessionTimeout: time.Hour,
+			LocalAuth:      config.LocalAuthConfig{Enabled: true},
+		},
+	}
+	userService := services.NewUserService(db)
+	sessionStore := middleware.NewSessionStore(cfg, db)
+	authHandler := NewAuthHandler(userService, services.NewTwoFactorService(db, cfg.Auth.LocalAuth.TOTP), sessionStore, cfg)
+	billingHandler := NewBillingHandler(services.NewLedgerService(db, config.BillingConfig{Enabled: true}, "EUR"))
+	billingHandler.SetAudit(services.NewAuditService(db))
+	sessionMW := sessionStore.SessionMiddleware()
+	authMW := sessionStore.AuthMiddleware(cfg)
+	authenticated := func(handler http.HandlerFunc) http.Handler {
+		return sessionMW(authMW(handler))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/auth/login", sessionMW(http.HandlerFunc(authHandler.Login)))
+	mux.Handle("GET /api/billing/balance", authenticated(billingHandler.GetBalance))
+	mux.Handle("GET /api/billing/statement", authenticated(billingHandler.GetStatement))
+	mux.Handle("GET /api/admin/billing/ledger", authenticated(billingHandler.GetLedger))
+	mux.Handle("GET /api/admin/billing/statement", authenticated(billingHandler.GetUserStatement))
+	mux.Handle("POST /api/admin/billing/payments", authenticated(billingHandler.RecordPayment))
+	mux.Handle("POST /api/admin/billing/charges/waive", authenticated(billingHandler.WaiveCharge))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &emailTestApp{db: db, server: server}
+}
+
+// createBillingUsers creates an admin and a user, returning their IDs and
+// logged in clients
+func createBillingUsers(t *testing.T, app *emailTestApp) (adminID, aliceID string, adminClient, aliceClient *http.Client) {
+	t.Helper()
+	ctx := context.Background()
+	for _, u := range []struct {
+		username string
+		role     models.Role
+		id       *string
+		client   **http.Client
+	}{
+		{"admin", models.RoleAdmin, &adminID, &adminClient},
+		{"alice", models.RoleUser, &aliceID, &aliceClient},
+	} {
+		user := models.NewUser(u.username, nil)
+		user.ID = uuid.NewString()
+		user.Role = u.role
+		if err := user.SetPassword(u.username + "-password"); err != nil {
+			t.Fatalf("Failed to set password: %v", err)
+		}
+		if err := app.db.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create %s: %v", u.username, err)
+		}
+		client, status := app.login(t, u.username, u.username+"-password")
+		if status != http.StatusOK {
+			t.Fatalf("Failed to log in as %s: %d", u.username, status)
+		}
+		*u.id, *u.client = user.ID, client
+	}
+	return adminID, aliceID, adminClient, aliceClient
+}
+
+func TestBillingPaymentsAndWaivers(t *testing.T) {
+	ctx := context.Background()
+	app := newBillingTestApp(t)
+	_, aliceID, adminClient, aliceClient := createBillingUsers(t, app)
+
+	kept := &models.Charge{UserID: aliceID, Amount: 25_00, Description: "Print request 1"}
+	waived := &models.Charge{UserID: aliceID, Amount: 15_00, Description: "Print request 2"}
+	for _, charge := range []*models.Charge{kept, waived} {
+		if err := app.db.CreateCharge(ctx, charge); err != nil {
+			t.Fatalf("Failed to create charge: %v", err)
+		}
+	}
+
+	// Payments must be for a user, and more than nothing but not absurdly much
+	payment := func(userID, amount string) map[string]any {
+		body := map[string]any{"user_id": userID, "method": "cash"}
+		if amount != "" {
+			body["amount"] = json.RawMessage(amount)
+		}
+		return body
+	}
+	for _, tt := range []struct {
+		name     string
+		body     map[string]any
+		expected int
+	}{
+		{"missing amount", payment(aliceID, ""), http.StatusBadRequest},
+		{"zero", payment(aliceID, "0"), http.StatusBadRequest},
+		{"negative", payment(aliceID, "-5.00"), http.StatusBadRequest},
+		{"over the limit", payment(aliceID, "100000.01"), http.StatusBadRequest},
+		{"fraction of a cent", payment(aliceID, "1.005"), http.StatusBadRequest},
+		{"missing user", payment("", "10.00"), http.StatusBadRequest},
+		{"user ID not a UUID", payment("alice", "10.00"), http.StatusBadRequest},
+		{"payment", payment(aliceID, "10.00"), http.StatusCreated},
+	} {
+		if status, data := app.do(t, adminClient, http.MethodPost, "/api/admin/billing/payments", tt.body); status != tt.expected {
+			t.Errorf("%s: expected %d, got %d %s", tt.name, tt.expected, status, data)
+		}
+	}
+
+	// A charge can only be waived once, with a reason
+	waivePath := "/api/admin/billing/charges/waive?id=" + strconv.Itoa(waived.ID)
+	for _, tt := range []struct {
+		name, path string
+		body       WaiveChargeRequest
+		expected   int
+	}{
+		{"missing reason", waivePath, WaiveChargeRequest{}, http.StatusBadRequest},
+		{"charge ID not a number", "/api/admin/billing/charges/waive?id=abc", WaiveChargeRequest{Reason: "Failed print"}, http.StatusBadRequest},
+		{"missing charge", "/api/admin/billing/charges/waive?id=9999", WaiveChargeRequest{Reason: "Failed print"}, http.StatusNotFound},
+		{"waiver", waivePath, WaiveChargeRequest{Reason: "Failed print"}, http.StatusOK},
+		{"waived twice", waivePath, WaiveChargeRequest{Reason: "Changed my mind"}, http.StatusConflict},
+	} {
+		if status, data := app.do(t, adminClient, http.MethodPost, tt.path, tt.body); status != tt.expected {
+			t.Errorf("%s: expected %d, got %d %s", tt.name, tt.expected, status, data)
+		}
+	}
+	if stored, _ := app.db.GetCharge(ctx, waived.ID); stored == nil || !stored.Waived || stored.WaivedReason != "Failed print" {
+		t.Errorf("Expected the first reason for waiving the charge to be kept, got %+v", stored)
+	}
+
+	// The ledger shows what is owed without the waived charge
+	status, data := app.do(t, adminClient, http.MethodGet, "/api/admin/billing/ledger?user_id="+aliceID, nil)
+	var ledger Ledger
+	if err := json.Unmarshal(data, &ledger); status != http.StatusOK || err != nil {
+		t.Fatalf("Failed to get ledger: %d %s", status, data)
+	}
+	if ledger.Balance.Charged != 25_00 || ledger.Balance.Paid != 10_00 || len(ledger.Charges) != 2 || len(ledger.Payments) != 1 {
+		t.Errorf("Expected 25.00 charged and 10.00 paid, got %+v", ledger)
+	}
+	status, data = app.do(t, aliceClient, http.MethodGet, "/api/billing/balance", nil)
+	var balance models.Balance
+	if err := json.Unmarshal(data, &balance); status != http.StatusOK || err != nil || balance.Balance != -15_00 {
+		t.Errorf("Expected alice to owe 15.00, got %d %s", status, data)
+	}
+
+	for path, expected := range map[string]int{
+		"/api/admin/billing/ledger":                                http.StatusBadRequest,
+		"/api/admin/billing/ledger?user_id=alice":                  http.StatusBadRequest,
+		"/api/admin/billing/ledger?user_id=" + uuid.NewString():    http.StatusNotFound,
+		"/api/admin/billing/statement?user_id=alice":               http.StatusBadRequest,
+		"/api/admin/billing/statement?user_id=" + uuid.NewString(): http.StatusNotFound,
+	} {
+		if status, _ := app.do(t, adminClient, http.MethodGet, path, nil); status != expected {
+			t.Errorf("GET %s: expected %d, got %d", path, expected, status)
+		}
+	}
+
+	// Payments and waivers are audited
+	events, _, err := services.NewAuditService(app.db).ListEvents(ctx, models.AuditEventFilter{TargetType: models.AuditTargetCharge})
+	if err != nil || len(events) != 1 || events[0].TargetID != strconv.Itoa(waived.ID) || events[0].Changes["waived_reason"].After != "Failed print" {
+		t.Errorf("Expected the waiver to be audited, got %+v %v", events, err)
+	}
+	events, _, err = services.NewAuditService(app.db).ListEvents(ctx, models.AuditEventFilter{Action: models.AuditPaymentRecorded})
+	if err != nil || len(events) != 1 || events[0].ActorName != "admin" || events[0].Changes["user_id"].After != aliceID {
+		t.Errorf("Expected the payment to be audited, got %+v %v", events, err)
+	}
+}
+
+func TestBillingStatements(t *testing.T) {
+	ctx := context.Background()
+	app := newBillingTestApp(t)
+	_, aliceID, adminClient, aliceClient := createBillingUsers(t, app)
+
+	if err := app.db.CreateCharge(ctx, &models.Charge{UserID: aliceID, Amount: 12_50, Description: "Print request 1"}); err != nil {
+		t.Fatalf("Failed to create charge: %v", err)
+	}
+	if err := app.db.CreatePayment(ctx, &models.Payment{UserID: aliceID, Amount: 5_00, Method: "cash"}); err != nil {
+		t.Fatalf("Failed to create payment: %v", err)
+	}
+	month := time.Now().UTC().Format("2006-01")
+
+	// Users get their own statement, and admins anyone's
+	for _, path := range []string{"/api/billing/statement", "/api/admin/billing/statement?user_id=" + aliceID + "&month=" + month} {
+		client := aliceClient
+		if strings.HasPrefix(path, "/api/admin") {
+			client = adminClient
+		}
+		status, data := app.do(t, client, http.MethodGet, path, nil)
+		var statement models.Statement
+		if err := json.Unmarshal(data, &statement); status != http.StatusOK || err != nil {
+			t.Fatalf("Failed to get statement from %s: %d %s", path, status, data)
+		}
+		if statement.UserID != aliceID || statement.Currency != "EUR" || len(statement.Entries) != 2 || statement.ClosingBalance != -7_50 {
+			t.Errorf("Expected alice's statement closing at -7.50, got %+v", statement)
+		}
+	}
+
+	// Earlier months carry nothing over
+	status, data := app.do(t, aliceClient, http.MethodGet, "/api/billing/statement?month=2000-01", nil)
+	var statement models.Statement
+	if err := json.Unmarshal(data, &statement); status != http.StatusOK || err != nil || len(statement.Entries) != 0 || statement.ClosingBalance != 0 {
+		t.Errorf("Expected an empty statement for 2000-01, got %d %s", status, data)
+	}
+
+	for format, contentType := range map[string]string{"csv": "text/csv", "pdf": "application/pdf"} {
+		resp, err := aliceClient.Get(app.server.URL + "/api/billing/statement?format=" + format)
+		if err != nil {
+			t.Fatalf("Failed to download %s statement: %v", format, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != contentType || len(body) == 0 {
+			t.Errorf("Expected a %s statement, got %d %s", format, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+		expected := `attachment; filename="statement-alice-` + month + `.` + format + `"`
+		if disposition := resp.Header.Get("Content-Disposition"); disposition != expected {
+			t.Errorf("Expected %s statement to download as %q, got %q", format, expected, disposition)
+		}
+	}
+
+	for _, query := range []string{"?month=2024-13", "?month=last", "?format=xml"} {
+		if status, _ := app.do(t, aliceClient, http.MethodGet, "/api/billing/statement"+query, nil); status != http.StatusBadRequest {
+			t.Errorf("Expected %q to be rejected, got %d", query, status)
+		}
+	}
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/validation"
+)
+
+// GroupHandler handles HTTP requests for groups and their members
+type GroupHandler struct {
+	groups      *services.GroupService
+	userService *services.UserService
+	audit       *services.AuditService
+	logger      *slog.Logger
+}
+
+// NewGroupHandler creates a new group handler
+func NewGroupHandler(groups *services.GroupService, userService *services.UserService) *GroupHandler {
+	return &GroupHandler{
+		groups:      groups,
+		userService: userService,
+		logger:      slog.Default(),
+	}
+}
+
+// SetAudit records members being added, changed and removed in the audit log
+func (h *GroupHandler) SetAudit(audit *services.AuditService) {
+	h.audit = audit
+}
+
+// GroupRequest represents the request body for creating or updating a group
+type GroupRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// Validate validates the group request
+func (r *GroupRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Name = validation.SanitizeString(r.Name)
+	r.Description = validation.SanitizeString(r.Description)
+
+	validator.ValidateRequired("name", r.Name)
+	validator.ValidateLength("name", r.Name, 1, 100)
+	validator.ValidateNoHTML("name", r.Name)
+	validator.ValidateLength("description", r.Description, 0, 500)
+	validator.ValidateNoHTML("description", r.Description)
+
+	return validator.Errors()
+}
+
+// SetGroupMemberRequest represents the request body for adding a member to a
+// group or changing their role
+type SetGroupMemberRequest struct {
+	UserID string           `json:"user_id"`
+	Role   models.GroupRole `json:"role"`
+}
+
+// Validate validates the set group member request
+func (r *SetGroupMemberRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	validator.ValidateRequired("user_id", r.UserID)
+	validator.ValidateUUID("user_id", r.UserID)
+	if !r.Role.IsValid() {
+		validator.AddError("role", "must be one of: member, moderator")
+	}
+
+	return validator.Errors()
+}
+
+// ListGroups handles GET /api/admin/groups
+func (h *GroupHandler) ListGroups(w http.ResponseWriter, r *http.Request) {
+	groups, err := h.groups.ListGroups(r.Context())
+	if err != nil {
+		h.logger.Error("failed to list groups", "error", err)
+		response.WriteInternalError(w, "Failed to list groups", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, groups, "")
+}
+
+// CreateGroup handles POST /api/admin/groups
+func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req GroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	group := &models.Group{Name: req.Name, Description: req.Description}
+	if err := h.groups.CreateGroup(r.Context(), group); err != nil {
+		response.WriteInternalError(w, "Failed to create group", err.Error())
+		return
+	}
+
+	response.WriteCreatedResponse(w, group, "Group created successfully")
+}
+
+// UpdateGroup handles PUT /api/admin/groups?id=
+func (h *GroupHandler) UpdateGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.getGroup(w, r, r.URL.Query().Get("id"))
+	if !ok {
+		return
+	}
+
+	var req GroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	group.Name = req.Name
+	group.Description = req.Description
+	if err := h.groups.UpdateGroup(r.Context(), group); err != nil {
+		response.WriteInternalError(w, "Failed to update group", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, group, "Group updated successfully")
+}
+
+// DeleteGroup handles DELETE /api/admin/groups?id=
+func (h *GroupHandler) DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.getGroup(w, r, r.URL.Query().Get("id"))
+	if !ok {
+		return
+	}
+
+	if err := h.groups.DeleteGroup(r.Context(), group.ID); err != nil {
+		response.WriteInternalError(w, "Failed to delete group", err.Error())
+		return
+	}
+
+	response.WriteNoContentResponse(w)
+}
+
+// ListMyGroups handles GET /api/groups, the groups the current user belongs to
+func (h *GroupHandler) ListMyGroups(w http.ResponseWriter, r *http.Request) {
+	memberships := []models.GroupMembership{}
+	if user := middleware.GetUser(r); user != nil && user.Memberships != nil {
+		memberships = user.Memberships
+	}
+
+	response.WriteSuccessResponse(w, memberships, "")
+}
+
+// ListMembers handles GET /api/groups/members?group_id=
+func (h *GroupHandler) ListMembers(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.getGroup(w, r, r.URL.Query().Get("group_id"))
+	if !ok {
+		return
+	}
+
+	if user := middleware.GetUser(r); user != nil && !user.HasPermission(models.PermissionManageGroups) && !user.HasGroupPermission(models.PermissionViewGroupPrintRequests, group.ID) {
+		response.WriteForbiddenError(w, "You are not a member of this group")
+		return
+	}
+
+	members, err := h.groups.ListMembers(r.Context(), group.ID)
+	if err != nil {
+		h.logger.Error("failed to list group members", "error", err, "group_id", group.ID)
+		response.WriteInternalError(w, "Failed to list group members", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, members, "")
+}
+
+// SetMember handles PUT /api/groups/members?group_id=. Group moderators may
+// add regular users as members; only users who manage groups may appoint
+// group moderators.
+func (h *GroupHandler) SetMember(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.getGroup(w, r, r.URL.Query().Get("group_id"))
+	if !ok {
+		return
+	}
+
+	var req SetGroupMemberRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	target, ok := h.getMember(w, r, req.UserID)
+	if !ok {
+		return
+	}
+
+	user := middleware.GetUser(r)
+	if req.Role == models.GroupRoleModerator && user != nil && !user.HasPermission(models.PermissionManageGroups) {
+		response.WriteForbiddenError(w, "Only group managers can appoint group moderators")
+		return
+	}
+	if !canManageMember(user, target, group.ID) {
+		response.WriteForbiddenError(w, "You cannot manage this user's membership")
+		return
+	}
+
+	if err := h.groups.SetMember(r.Context(), group.ID, target.ID, req.Role); err != nil {
+		response.WriteInternalError(w, "Failed to set group member", err.Error())
+		return
+	}
+
+	changes := models.AuditChanges{
+		"user_id": {After: target.ID},
+		"role":    {After: req.Role},
+	}
+	if previous, ok := target.GroupRole(group.ID); ok {
+		changes["user_id"] = models.AuditChange{Before: target.ID, After: target.ID}
+		changes["role"] = models.AuditChange{Before: previous, After: req.Role}
+	}
+	h.auditMember(r, models.AuditGroupMemberSet, group.ID, changes)
+
+	response.WriteSuccessResponse(w, nil, "Group member saved successfully")
+}
+
+// RemoveMember handles DELETE /api/groups/members?group_id=&user_id=
+func (h *GroupHandler) RemoveMember(w http.ResponseWriter, r *http.Request) {
+	group, ok := h.getGroup(w, r, r.URL.Query().Get("group_id"))
+	if !ok {
+		return
+	}
+
+	target, ok := h.getMember(w, r, r.URL.Query().Get("user_id"))
+	if !ok {
+		return
+	}
+
+	if !canManageMember(middleware.GetUser(r), target, group.ID) {
+		response.WriteForbiddenError(w, "You cannot manage this user's membership")
+		return
+	}
+
+	if err := h.groups.RemoveMember(r.Context(), group.ID, target.ID); err != nil {
+		response.WriteInternalError(w, "Failed to remove group member", err.Error())
+		return
+	}
+
+	if previous, ok := target.GroupRole(group.ID); ok {
+		h.auditMember(r, models.AuditGroupMemberRemoved, group.ID, models.AuditChanges{
+			"user_id": {Before: target.ID},
+			"role":    {Before: previous},
+		})
+	}
+
+	response.WriteNoContentResponse(w)
+}
+
+// auditMember records a change to a group's members in the audit log
+func (h *GroupHandler) auditMember(r *http.Request, action models.AuditAction, groupID string, changes models.AuditChanges) {
+	recordAudit(r, h.audit, &models.AuditEvent{
+		Action:     action,
+		TargetType: models.AuditTargetGroup,
+		TargetID:   groupID,
+		Changes:    changes,
+	})
+}
+
+// getGroup looks up a group by ID, writing an error response and returning
+// false if it cannot be found
+func (h *GroupHandler) getGroup(w http.ResponseWriter, r *http.Request, id string) (*models.Group, bool) {
+	if id == "" {
+		response.WriteBadRequestError(w, "Group ID is required", "")
+		return nil, false
+	}
+
+	group, err := h.groups.GetGroup(r.Context(), id)
+	if err != nil {
+		h.logger.Error("failed to get group", "error", err, "id", validation.SanitizeLogString(id))
+		response.WriteInternalError(w, "Failed to get group", err.Error())
+		return nil, false
+	}
+	if group == nil {
+		response.WriteNotFoundError(w, "Group not found")
+		return nil, false
+	}
+	return group, true
+}
+
+// getMember looks up a user with their group memberships, writing an error
+// response and returning false if they cannot be found
+func (h *GroupHandler) getMember(w http.ResponseWriter, r *http.Request, userID string) (*models.User, bool) {
+	if userID == "" {
+		response.WriteBadRequestError(w, "User ID is required", "")
+		return nil, false
+	}
+
+	user, err := h.userService.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		response.WriteNotFoundError(w, "User not found")
+		return nil, false
+	}
+
+	if err := h.groups.LoadMemberships(r.Context(), user); err != nil {
+		h.logger.Error("failed to load group memberships", "error", err, "user_id", user.ID)
+		response.WriteInternalError(w, "Failed to load group memberships", err.Error())
+		return nil, false
+	}
+	return user, true
+}
+
+// canManageMember checks if user may add, change or remove target's
+// membership of a group. Users who manage groups may manage anyone, while
+// group moderators may only manage regular users who are not moderators of
+// the group.
+func canManageMember(user, target *models.User, groupID string) bool {
+	if user == nil || user.HasPermission(models.PermissionManageGroups) {
+		// Authentication is disabled, or the user manages all groups
+		return true
+	}
+
+	if role, ok := user.GroupRole(groupID); !ok || role != models.GroupRoleModerator {
+		return false
+	}
+
+	if role, ok := target.GroupRole(groupID); ok {
+		return role == models.GroupRoleMember && user.CanManageUser(target)
+	}
+	return !target.Role.HasPermission(models.PermissionManageUsers) && target.ID != user.ID
+}
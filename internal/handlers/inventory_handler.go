@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/validation"
+)
+
+// LocalInventoryHandler handles administration of the local filament inventory
+type LocalInventoryHandler struct {
+	service *services.LocalInventoryService
+	logger  *slog.Logger
+}
+
+// NewLocalInventoryHandler creates a new inventory handler
+func NewLocalInventoryHandler(service *services.LocalInventoryService) *LocalInventoryHandler {
+	return &LocalInventoryHandler{
+		service: service,
+		logger:  slog.Default(),
+	}
+}
+
+// MaterialRequest represents the request body for creating or updating a material
+type MaterialRequest struct {
+	Name     string  `json:"name"`
+	Density  float64 `json:"density"`
+	Diameter float64 `json:"diameter"`
+}
+
+// Validate validates the material data
+func (r *MaterialRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Name = validation.SanitizeMaterial(r.Name)
+	validator.ValidateRequired("name", r.Name)
+	validator.ValidateMaterial("name", r.Name)
+
+	if r.Density < 0 {
+		validator.AddError("density", "must not be negative")
+	}
+	if r.Diameter < 0 {
+		validator.AddError("diameter", "must not be negative")
+	}
+
+	return validator.Errors()
+}
+
+// FilamentRequest represents the request body for creating or updating a filament
+type FilamentRequest struct {
+	Name         string  `json:"name"`
+	MaterialID   int     `json:"material_id"`
+	Vendor       string  `json:"vendor"`
+	ColorHex     string  `json:"color_hex"`
+	Weight       float64 `json:"weight"`
+	Price        float64 `json:"price"`
+	ExtruderTemp int     `json:"settings_extruder_temp"`
+	BedTemp      int     `json:"settings_bed_temp"`
+}
+
+// Validate validates the filament data
+func (r *FilamentRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Name = validation.SanitizeString(r.Name)
+	r.Vendor = validation.SanitizeString(r.Vendor)
+	r.ColorHex = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(r.ColorHex)), "#")
+
+	validator.ValidateRequired("name", r.Name)
+	validator.ValidateLength("name", r.Name, 1, 100)
+	validator.ValidateNoHTML("name", r.Name)
+	validator.ValidateLength("vendor", r.Vendor, 0, 100)
+	validator.ValidateNoHTML("vendor", r.Vendor)
+
+	if r.MaterialID <= 0 {
+		validator.AddError("material_id", "is required")
+	}
+	if r.ColorHex != "" && !isHexColor(r.ColorHex) {
+		validator.AddError("color_hex", "must be a 6 digit hex color")
+	}
+	if r.Weight < 0 || r.Price < 0 || r.ExtruderTemp < 0 || r.BedTemp < 0 {
+		validator.AddError("filament", "weights, prices and temperatures must not be negative")
+	}
+
+	return validator.Errors()
+}
+
+// SpoolRequest represents the request body for creating or updating a spool
+type SpoolRequest struct {
+	FilamentID      int     `json:"filament_id"`
+	InitialWeight   float64 `json:"initial_weight"`
+	RemainingWeight float64 `json:"remaining_weight"`
+	Location        string  `json:"location"`
+	LotNr           string  `json:"lot_nr"`
+	Comment         string  `json:"comment"`
+	Archived        bool    `json:"archived"`
+}
+
+// Validate validates the spool data
+func (r *SpoolRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Location = validation.SanitizeString(r.Location)
+	r.LotNr = validation.SanitizeString(r.LotNr)
+	r.Comment = validation.SanitizeNotes(r.Comment)
+
+	if r.FilamentID <= 0 {
+		validator.AddError("filament_id", "is required")
+	}
+	if r.InitialWeight < 0 || r.RemainingWeight < 0 {
+		validator.AddError("weight", "must not be negative")
+	}
+	validator.ValidateLength("location", r.Location, 0, 100)
+	validator.ValidateLength("lot_nr", r.LotNr, 0, 100)
+	validator.ValidateNotes("comment", r.Comment)
+
+	return validator.Errors()
+}
+
+// ListMaterials handles GET /api/admin/inventory/materials
+func (h *LocalInventoryHandler) ListMaterials(w http.ResponseWriter, r *http.Request) {
+	materials, err := h.service.ListMaterials(r.Context())
+	if err != nil {
+		response.WriteInternalError(w, "Failed to list materials", "")
+		return
+	}
+	response.WriteSuccessResponse(w, materials, "")
+}
+
+// CreateMaterial handles POST /api/admin/inventory/materials
+func (h *LocalInventoryHandler) CreateMaterial(w http.ResponseWriter, r *http.Request) {
+	var req MaterialRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	material := &models.Material{Name: req.Name, Density: req.Density, Diameter: req.Diameter}
+	if err := h.service.CreateMaterial(r.Context(), material); err != nil {
+		response.WriteInternalError(w, "Failed to create material", "")
+		return
+	}
+	response.WriteCreatedResponse(w, material, "Material created successfully")
+}
+
+// UpdateMaterial handles PUT /api/admin/inventory/materials?id=
+func (h *LocalInventoryHandler) UpdateMaterial(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.id(w, r)
+	if !ok {
+		return
+	}
+	var req MaterialRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	material := &models.Material{Id: id, Name: req.Name, Density: req.Density, Diameter: req.Diameter}
+	if err := h.service.UpdateMaterial(r.Context(), material); err != nil {
+		response.WriteInternalError(w, "Failed to update material", err.Error())
+		return
+	}
+	response.WriteSuccessResponse(w, material, "Material updated successfully")
+}
+
+// DeleteMaterial handles DELETE /api/admin/inventory/materials?id=
+func (h *LocalInventoryHandler) DeleteMaterial(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.id(w, r)
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteMaterial(r.Context(), id); err != nil {
+		response.WriteInternalError(w, "Failed to delete material", "")
+		return
+	}
+	response.WriteSuccessResponse(w, nil, "Material deleted successfully")
+}
+
+// ListFilaments handles GET /api/admin/inventory/filaments
+func (h *LocalInventoryHandler) ListFilaments(w http.ResponseWriter, r *http.Request) {
+	filaments, err := h.service.ListFilamentRecords(r.Context())
+	if err != nil {
+		response.WriteInternalError(w, "Failed to list filaments", "")
+		return
+	}
+	response.WriteSuccessResponse(w, filaments, "")
+}
+
+// CreateFilament handles POST /api/admin/inventory/filaments
+func (h *LocalInventoryHandler) CreateFilament(w http.ResponseWriter, r *http.Request) {
+	var req FilamentRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	filament := req.toFilament()
+	if err := h.service.CreateFilament(r.Context(), filament); err != nil {
+		response.WriteInternalError(w, "Failed to create filament", err.Error())
+		return
+	}
+	response.WriteCreatedResponse(w, filament, "Filament created successfully")
+}
+
+// UpdateFilament handles PUT /api/admin/inventory/filaments?id=
+func (h *LocalInventoryHandler) UpdateFilament(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.id(w, r)
+	if !ok {
+		return
+	}
+	var req FilamentRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	filament := req.toFilament()
+	filament.Id = id
+	if err := h.service.UpdateFilament(r.Context(), filament); err != nil {
+		response.WriteInternalError(w, "Failed to update filament", err.Error())
+		return
+	}
+	response.WriteSuccessResponse(w, filament, "Filament updated successfully")
+}
+
+// DeleteFilament handles DELETE /api/admin/inventory/filaments?id=
+func (h *LocalInventoryHandler) DeleteFilament(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.id(w, r)
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteFilament(r.Context(), id); err != nil {
+		response.WriteInternalError(w, "Failed to delete filament", "")
+		return
+	}
+	response.WriteSuccessResponse(w, nil, "Filament deleted successfully")
+}
+
+// ListSpools handles GET /api/admin/inventory/spools
+func (h *LocalInventoryHandler) ListSpools(w http.ResponseWriter, r *http.Request) {
+	spools, err := h.service.ListSpoolRecords(r.Context())
+	if err != nil {
+		response.WriteInternalError(w, "Failed to list spools", "")
+		return
+	}
+	response.WriteSuccessResponse(w, spools, "")
+}
+
+// CreateSpool handles POST /api/admin/inventory/spools
+func (h *LocalInventoryHandler) CreateSpool(w http.ResponseWriter, r *http.Request) {
+	var req SpoolRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	spool := req.toSpool()
+	if err := h.service.CreateSpool(r.Context(), spool); err != nil {
+		response.WriteInternalError(w, "Failed to create spool", err.Error())
+		return
+	}
+	response.WriteCreatedResponse(w, spool, "Spool created successfully")
+}
+
+// UpdateSpool handles PUT /api/admin/inventory/spools?id=
+func (h *LocalInventoryHandler) UpdateSpool(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.id(w, r)
+	if !ok {
+		return
+	}
+	var req SpoolRequest
+	if !h.decode(w, r, &req) {
+		return
+	}
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	spool := req.toSpool()
+	spool.Id = id
+	if err := h.service.UpdateSpool(r.Context(), spool); err != nil {
+		response.WriteInternalError(w, "Failed to update spool", err.Error())
+		return
+	}
+	response.WriteSuccessResponse(w, spool, "Spool updated successfully")
+}
+
+// DeleteSpool handles DELETE /api/admin/inventory/spools?id=
+func (h *LocalInventoryHandler) DeleteSpool(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.id(w, r)
+	if !ok {
+		return
+	}
+	if err := h.service.DeleteSpool(r.Context(), id); err != nil {
+		response.WriteInternalError(w, "Failed to delete spool", "")
+		return
+	}
+	response.WriteSuccessResponse(w, nil, "Spool deleted successfully")
+}
+
+func (r *FilamentRequest) toFilament() *models.Filament {
+	return &models.Filament{
+		Name:         r.Name,
+		Material:     models.Material{Id: r.MaterialID},
+		Vendor:       r.Vendor,
+		ColorHex:     r.ColorHex,
+		Weight:       r.Weight,
+		Price:        r.Price,
+		ExtruderTemp: r.ExtruderTemp,
+		BedTemp:      r.BedTemp,
+	}
+}
+
+func (r *SpoolRequest) toSpool() *models.Spool {
+	return &models.Spool{
+		Filament:        models.Filament{Id: r.FilamentID},
+		InitialWeight:   r.InitialWeight,
+		RemainingWeight: r.RemainingWeight,
+		Location:        r.Location,
+		LotNr:           r.LotNr,
+		Comment:         r.Comment,
+		Archived:        r.Archived,
+	}
+}
+
+// decode parses the JSON request body, writing an error response on failure
+func (h *LocalInventoryHandler) decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		h.logger.Error("failed to decode inventory request body", "error", err)
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return false
+	}
+	return true
+}
+
+// id parses the record ID query parameter, writing an error response if it is invalid
+func (h *LocalInventoryHandler) id(w http.ResponseWriter, r *http.Request) (int, bool) {
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		response.WriteBadRequestError(w, "ID is required", "")
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		h.logger.Warn("invalid inventory ID", "id", validation.SanitizeLogString(idStr))
+		response.WriteBadRequestError(w, "Invalid ID", "")
+		return 0, false
+	}
+	return id, true
+}
+
+// isHexColor reports whether s is a 6 digit hex color without the leading #
+func isHexColor(s string) bool {
+	if len(s) != 6 {
+		return false
+	}
+	for _, c := range s {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/validation"
+)
+
+// InvitationHandler handles HTTP requests for managing invitation codes
+type InvitationHandler struct {
+	invitations *services.InvitationService
+	config      *config.Config
+	audit       *services.AuditService
+	logger      *slog.Logger
+}
+
+// NewInvitationHandler creates a new invitation handler
+func NewInvitationHandler(invitations *services.InvitationService, cfg *config.Config) *InvitationHandler {
+	return &InvitationHandler{
+		invitations: invitations,
+		config:      cfg,
+		logger:      slog.Default(),
+	}
+}
+
+// SetAudit records invitations being created and revoked in the audit log
+func (h *InvitationHandler) SetAudit(audit *services.AuditService) {
+	h.audit = audit
+}
+
+// CreateInvitationRequest represents the request body for creating an
+// invitation
+type CreateInvitationRequest struct {
+	Email     string      `json:"email,omitempty"`    // Only this address can register with the code
+	Role      models.Role `json:"role,omitempty"`     // Defaults to user
+	GroupID   string      `json:"group_id,omitempty"` // Group to join as a member
+	MaxUses   int         `json:"max_uses,omitempty"` // Defaults to 1
+	ExpiresAt *time.Time  `json:"expires_at"`         // Omit for an invitation that does not expire
+}
+
+// Validate validates the create invitation request
+func (r *CreateInvitationRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Email = validation.SanitizeString(r.Email)
+	validator.ValidateEmail("email", r.Email)
+	validator.ValidateNoHTML("email", r.Email)
+
+	if r.MaxUses == 0 {
+		r.MaxUses = 1
+	}
+	if r.MaxUses < 1 || r.MaxUses > services.MaxInvitationUses {
+		validator.AddError("max_uses", "must be between 1 and "+strconv.Itoa(services.MaxInvitationUses))
+	}
+	if r.Email != "" && r.MaxUses != 1 {
+		validator.AddError("max_uses", "invitations for an email address can only be used once")
+	}
+
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		validator.AddError("expires_at", "must be in the future")
+	}
+
+	return validator.Errors()
+}
+
+// CreateInvitationResponse is a newly created invitation with its code, which
+// is only ever returned here
+type CreateInvitationResponse struct {
+	*models.Invitation
+	Code string `json:"code"`
+	// Link opens the registration form with the code filled in. It is only
+	// given when server.base_url is set.
+	Link string `json:"link,omitempty"`
+}
+
+// ListInvitations handles GET /api/admin/invitations
+func (h *InvitationHandler) ListInvitations(w http.ResponseWriter, r *http.Request) {
+	invitations, err := h.invitations.ListInvitations(r.Context())
+	if err != nil {
+		h.logger.Error("failed to list invitations", "error", err)
+		response.WriteInternalError(w, "Failed to list invitations", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, invitations, "")
+}
+
+// CreateInvitation handles POST /api/admin/invitations
+func (h *InvitationHandler) CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	var req CreateInvitationRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	invitation := &models.Invitation{
+		Role:      req.Role,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if req.Email != "" {
+		invitation.Email = &req.Email
+	}
+	if req.GroupID != "" {
+		invitation.GroupID = &req.GroupID
+	}
+
+	code, err := h.invitations.CreateInvitation(r.Context(), middleware.GetUser(r), invitation)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvitationRequest):
+			response.WriteBadRequestError(w, "Invalid invitation", err.Error())
+		case errors.Is(err, services.ErrInvitationForbidden):
+			response.WriteForbiddenError(w, err.Error())
+		default:
+			h.logger.Error("failed to create invitation", "error", err)
+			response.WriteInternalError(w, "Failed to create invitation", err.Error())
+		}
+		return
+	}
+
+	recordAudit(r, h.audit, &models.AuditEvent{
+		Action:     models.AuditInvitationCreated,
+		TargetType: models.AuditTargetInvitation,
+		TargetID:   invitation.ID,
+		Changes: models.AuditChanges{
+			"prefix":     {After: invitation.Prefix},
+			"email":      {After: invitation.Email},
+			"role":       {After: invitation.Role},
+			"group_id":   {After: invitation.GroupID},
+			"max_uses":   {After: invitation.MaxUses},
+			"expires_at": {After: invitation.ExpiresAt},
+		},
+	})
+
+	created := CreateInvitationResponse{Invitation: invitation, Code: code}
+	if h.config.Server.BaseURL != "" {
+		created.Link = h.config.Server.BaseURL + "/auth.html?" + url.Values{"invitation_code": {code}}.Encode()
+	}
+	response.WriteCreatedResponse(w, created, "Invitation created. Copy the code or link now, it will not be shown again.")
+}
+
+// RevokeInvitation handles DELETE /api/admin/invitations?id=
+func (h *InvitationHandler) RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		response.WriteBadRequestError(w, "Invitation ID is required", "")
+		return
+	}
+
+	if err := h.invitations.RevokeInvitation(r.Context(), id); err != nil {
+		if errors.Is(err, services.ErrInvitationNotFound) {
+			response.WriteNotFoundError(w, "Invitation not found")
+			return
+		}
+		h.logger.Error("failed to revoke invitation", "error", err, "invitation_id", id)
+		response.WriteInternalError(w, "Failed to revoke invitation", err.Error())
+		return
+	}
+
+	h.logger.Info("admin revoked invitation", "invitation_id", id, "admin_id", middleware.GetUserID(r))
+	recordAudit(r, h.audit, &models.AuditEvent{
+		Action:     models.AuditInvitationRevoked,
+		TargetType: models.AuditTargetInvitation,
+		TargetID:   id,
+	})
+	response.WriteNoContentResponse(w)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+// newInvitationTestApp serves registration, with open registration disabled,
+// and the invitation admin endpoints without authentication
+func newInvitationTestApp(t *testing.T) (*emailTestApp, database.DBClient) {
+	t.Helper()
+	db := newTestDB(t)
+	cfg := &config.Config{
+		Server: config.ServerConfig{BaseURL: "https://print.example.com"},
+		Auth: config.AuthConfig{
+			Enabled:        true,
+			SessionSecret:  "test-session-secret-that-is-long-enough",
+			SessionTimeout: time.Hour,
+			LocalAuth:      config.LocalAuthConfig{Enabled: true},
+		},
+	}
+	userService := services.NewUserService(db)
+	sessionStore := middleware.NewSessionStore(cfg, db)
+	authHandler := NewAuthHandler(userService, services.NewTwoFactorService(db, cfg.Auth.LocalAuth.TOTP), sessionStore, cfg)
+	invitationHandler := NewInvitationHandler(services.NewInvitationService(db), cfg)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/auth/register", sessionStore.SessionMiddleware()(http.HandlerFunc(authHandler.Register)))
+	mux.HandleFunc("GET /api/admin/invitations", invitationHandler.ListInvitations)
+	mux.HandleFunc("POST /api/admin/invitations", invitationHandler.CreateInvitation)
+	mux.HandleFunc("DELETE /api/admin/invitations", invitationHandler.RevokeInvitation)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &emailTestApp{db: db, server: server}, db
+}
+
+func TestInviteOnlyRegistration(t *testing.T) {
+	ctx := context.Background()
+	app, db := newInvitationTestApp(t)
+	client := &http.Client{}
+
+	group := &models.Group{ID: "lab-id", Name: "Lab"}
+	if err := db.CreateGroup(ctx, group); err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+
+	createInvitation := func(req CreateInvitationRequest) CreateInvitationResponse {
+		t.Helper()
+		status, data := app.do(t, client, http.MethodPost, "/api/admin/invitations", req)
+		var created CreateInvitationResponse
+		if err := json.Unmarshal(data, &created); status != http.StatusCreated || err != nil {
+			t.Fatalf("Failed to create invitation: %d %s", status, data)
+		}
+		return created
+	}
+	register := func(username, email, code string) int {
+		t.Helper()
+		status, _ := app.do(t, client, http.MethodPost, "/api/auth/register", RegisterRequest{
+			Username:       username,
+			Email:          email,
+			Password:       "correct-horse-battery",
+			InvitationCode: code,
+		})
+		return status
+	}
+
+	if status := register("walkin", "", ""); status != http.StatusForbidden {
+		t.Errorf("Expected registration without an invitation to be refused, got %d", status)
+	}
+	if status := register("walkin", "", "NOTACODE"); status != http.StatusBadRequest {
+		t.Errorf("Expected an unknown code to be refused, got %d", status)
+	}
+
+	// A code for two lab members, who join the group
+	lab := createInvitation(CreateInvitationRequest{GroupID: group.ID, MaxUses: 2})
+	if lab.CodeHash != "" || lab.Prefix != lab.Code[:6] || !strings.HasPrefix(lab.Link, "https://print.example.com/auth.html?invitation_code=") {
+		t.Errorf("Unexpected invitation %+v", lab)
+	}
+	for _, username := range []string{"member-one", "member-two"} {
+		// People paste codes with stray spaces and lowercase
+		if status := register(username, "", " "+strings.ToLower(lab.Code)+" "); status != http.StatusCreated {
+			t.Fatalf("Expected %s to register, got %d", username, status)
+		}
+		user, _ := db.GetUserByUsername(ctx, username)
+		memberships, _ := db.ListGroupMembershipsByUserID(ctx, user.ID)
+		if user.Role != models.RoleUser || len(memberships) != 1 || memberships[0].GroupID != group.ID || memberships[0].Role != models.GroupRoleMember {
+			t.Errorf("Expected %s to be a member of the lab, got %+v", username, memberships)
+		}
+	}
+	if status := register("member-three", "", lab.Code); status != http.StatusBadRequest {
+		t.Errorf("Expected used up code to be refused, got %d", status)
+	}
+
+	// A code for one address, for a new moderator. Failed registrations do
+	// not use it up.
+	moderator := createInvitation(CreateInvitationRequest{Email: "mod@example.com", Role: models.RoleModerator})
+	if status := register("someone", "someone@example.com", moderator.Code); status != http.StatusBadRequest {
+		t.Errorf("Expected code for another address to be refused, got %d", status)
+	}
+	if status := register("member-one", "mod@example.com", moderator.Code); status != http.StatusConflict {
+		t.Errorf("Expected taken username to be refused, got %d", status)
+	}
+	if status := register("new-mod", "MOD@example.com", moderator.Code); status != http.StatusCreated {
+		t.Fatalf("Expected moderator to register, got %d", status)
+	}
+	if user, _ := db.GetUserByUsername(ctx, "new-mod"); user == nil || user.Role != models.RoleModerator {
+		t.Errorf("Expected new-mod to be a moderator, got %+v", user)
+	}
+
+	// Revoked codes stop working
+	revoked := createInvitation(CreateInvitationRequest{MaxUses: 10})
+	if status, _ := app.do(t, client, http.MethodDelete, "/api/admin/invitations?id="+revoked.ID, nil); status != http.StatusNoContent {
+		t.Fatalf("Failed to revoke invitation: %d", status)
+	}
+	if status, _ := app.do(t, client, http.MethodDelete, "/api/admin/invitations?id="+revoked.ID, nil); status != http.StatusNotFound {
+		t.Errorf("Expected revoking twice to fail, got %d", status)
+	}
+	if status := register("late", "", revoked.Code); status != http.StatusBadRequest {
+		t.Errorf("Expected revoked code to be refused, got %d", status)
+	}
+
+	status, data := app.do(t, client, http.MethodGet, "/api/admin/invitations", nil)
+	var invitations []*models.Invitation
+	if err := json.Unmarshal(data, &invitations); status != http.StatusOK || err != nil || len(invitations) != 3 {
+		t.Fatalf("Expected 3 invitations, got %d %s", status, data)
+	}
+	if strings.Contains(string(data), lab.Code) {
+		t.Error("Expected codes not to be listed")
+	}
+
+	for _, req := range []CreateInvitationRequest{
+		{Role: "overlord"},
+		{GroupID: "no-such-group"},
+		{Email: "one@example.com", MaxUses: 5},
+		{MaxUses: services.MaxInvitationUses + 1},
+	} {
+		if status, _ := app.do(t, client, http.MethodPost, "/api/admin/invitations", req); status != http.StatusBadRequest {
+			t.Errorf("Expected %+v to be refused, got %d", req, status)
+		}
+	}
+}
@@ -0,0 +1,299 @@
+package handlers
+
+import (
+	"cmp"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/oidc"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/validation"
+)
+
+// Session values that carry a login attempt from the login redirect to the
+// callback
+const (
+	oidcProviderKey = "oidc_provider"
+	oidcStateKey    = "oidc_state"
+	oidcNonceKey    = "oidc_nonce"
+	oidcVerifierKey = "oidc_verifier"
+)
+
+// Claims that user details are read from unless a provider maps them
+// elsewhere
+const (
+	defaultUsernameClaim    = "preferred_username"
+	defaultEmailClaim       = "email"
+	defaultDisplayNameClaim = "name"
+	defaultGroupsClaim      = "groups"
+)
+
+// oidcProvider is a configured OpenID Connect provider
+type oidcProvider struct {
+	*oidc.Provider
+	config config.OIDCProviderConfig
+}
+
+// OIDCProviderResponse describes a provider users can log in with
+type OIDCProviderResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
+
+// OIDCHandler handles logging in with OpenID Connect providers
+type OIDCHandler struct {
+	providers    map[string]*oidcProvider
+	order        []string // Provider names in the order they are configured
+	userService  *services.UserService
+	sessionStore *middleware.SessionStore
+	config       *config.Config
+	audit        *services.AuditService
+	logger       *slog.Logger
+}
+
+// NewOIDCHandler creates a new OIDC handler for the enabled providers
+func NewOIDCHandler(userService *services.UserService, sessionStore *middleware.SessionStore, cfg *config.Config) *OIDCHandler {
+	providers := make(map[string]*oidcProvider)
+	var order []string
+	for _, provider := range cfg.Auth.OIDC.Providers {
+		if !provider.Enabled {
+			continue
+		}
+		providers[provider.Name] = &oidcProvider{
+			Provider: oidc.NewProvider(oidc.Config{
+				Name:         provider.Name,
+				IssuerURL:    provider.IssuerURL,
+				ClientID:     provider.ClientID,
+				ClientSecret: provider.ClientSecret,
+				Scopes:       provider.Scopes,
+			}, nil),
+			config: provider,
+		}
+		order = append(order, provider.Name)
+	}
+
+	return &OIDCHandler{
+		providers:    providers,
+		order:        order,
+		userService:  userService,
+		sessionStore: sessionStore,
+		config:       cfg,
+		logger:       slog.Default(),
+	}
+}
+
+// SetAudit records logins in the audit log
+func (h *OIDCHandler) SetAudit(audit *services.AuditService) {
+	h.audit = audit
+}
+
+// ListProviders handles GET /api/auth/oidc/providers, the providers shown on
+// the login page
+func (h *OIDCHandler) ListProviders(w http.ResponseWriter, r *http.Request) {
+	providers := make([]OIDCProviderResponse, 0, len(h.order))
+	for _, name := range h.order {
+		providers = append(providers, OIDCProviderResponse{
+			Name:        name,
+			DisplayName: h.providers[name].config.DisplayName,
+			LoginURL:    "/api/auth/oidc/" + url.PathEscape(name) + "/login",
+		})
+	}
+
+	response.WriteSuccessResponse(w, providers, "")
+}
+
+// Login handles GET /api/auth/oidc/{provider}/login by redirecting the user to
+// the provider to log in
+func (h *OIDCHandler) Login(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.providers[r.PathValue("provider")]
+	if !ok {
+		response.WriteNotFoundError(w, "OIDC provider not found")
+		return
+	}
+
+	session := middleware.GetSession(r)
+	if session == nil {
+		response.WriteInternalError(w, "Session error", "")
+		return
+	}
+
+	values := make(map[string]string, 3)
+	for _, key := range []string{oidcStateKey, oidcNonceKey, oidcVerifierKey} {
+		value, err := oidc.RandomString()
+		if err != nil {
+			response.WriteInternalError(w, "Failed to start login", err.Error())
+			return
+		}
+		values[key] = value
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), h.callbackURL(r, provider.Name()), values[oidcStateKey], values[oidcNonceKey], values[oidcVerifierKey])
+	if err != nil {
+		h.logger.Error("failed to start OIDC login", "provider", provider.Name(), "error", err)
+		redirectLoginError(w, r, "Single sign-on is currently unavailable")
+		return
+	}
+
+	session.Values[oidcProviderKey] = provider.Name()
+	for key, value := range values {
+		session.Values[key] = value
+	}
+	if err := session.Save(r, w); err != nil {
+		h.logger.Error("failed to save session", "error", err)
+		response.WriteInternalError(w, "Failed to start login", err.Error())
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// Callback handles GET /api/auth/oidc/{provider}/callback, where the provider
+// sends the user back after logging in. A user who is already logged in links
+// the identity to their account; otherwise they are logged in as the user
+// linked to the identity, which is created on their first login.
+func (h *OIDCHandler) Callback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.providers[r.PathValue("provider")]
+	if !ok {
+		response.WriteNotFoundError(w, "OIDC provider not found")
+		return
+	}
+
+	session := middleware.GetSession(r)
+	if session == nil {
+		response.WriteInternalError(w, "Session error", "")
+		return
+	}
+
+	// The login attempt can only be completed once
+	providerName, _ := session.Values[oidcProviderKey].(string)
+	state, _ := session.Values[oidcStateKey].(string)
+	nonce, _ := session.Values[oidcNonceKey].(string)
+	verifier, _ := session.Values[oidcVerifierKey].(string)
+	for _, key := range []string{oidcProviderKey, oidcStateKey, oidcNonceKey, oidcVerifierKey} {
+		delete(session.Values, key)
+	}
+	if err := session.Save(r, w); err != nil {
+		h.logger.Error("failed to save session", "error", err)
+	}
+
+	query := r.URL.Query()
+	if errorCode := query.Get("error"); errorCode != "" {
+		h.logger.Info("OIDC login was not completed", "provider", provider.Name(), "error", validation.SanitizeLogString(errorCode))
+		redirectLoginError(w, r, "Single sign-on was cancelled or denied")
+		return
+	}
+	if state == "" || providerName != provider.Name() || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state)) != 1 {
+		h.logger.Warn("OIDC callback with unexpected state", "provider", provider.Name())
+		redirectLoginError(w, r, "Single sign-on failed, please try again")
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(r.Context(), query.Get("code"), h.callbackURL(r, provider.Name()), verifier)
+	if err != nil {
+		h.logger.Error("failed to exchange OIDC code", "provider", provider.Name(), "error", err)
+		redirectLoginError(w, r, "Single sign-on failed, please try again")
+		return
+	}
+	claims, err := provider.Verify(r.Context(), rawIDToken, nonce)
+	if err != nil {
+		h.logger.Warn("failed to verify OIDC ID token", "provider", provider.Name(), "error", err)
+		redirectLoginError(w, r, "Single sign-on failed, please try again")
+		return
+	}
+
+	// Link the identity to the account of a user who is already logged in
+	if userID, ok := session.Values["user_id"].(string); ok && userID != "" {
+		if err := h.userService.LinkOIDCIdentity(r.Context(), userID, provider.Name(), claims.Subject); err != nil {
+			h.logger.Warn("failed to link OIDC identity", "provider", provider.Name(), "user_id", userID, "error", err)
+			if errors.Is(err, services.ErrOIDCIdentityLinked) {
+				redirectLoginError(w, r, "This account is already linked to another user")
+				return
+			}
+			redirectLoginError(w, r, "Failed to link account, please try again")
+			return
+		}
+		http.Redirect(w, r, "/dashboard.html", http.StatusFound)
+		return
+	}
+
+	user, err := h.userService.FindOrCreateUserFromOIDC(r.Context(), h.profile(provider, claims))
+	if err != nil {
+		if errors.Is(err, services.ErrOIDCEmailInUse) {
+			redirectLoginError(w, r, "An account with this email already exists. Log in and sign in with this provider again to link it.")
+			return
+		}
+		h.logger.Error("failed to find or create OIDC user", "provider", provider.Name(), "error", err)
+		redirectLoginError(w, r, "Single sign-on failed, please try again")
+		return
+	}
+	if !user.Enabled {
+		h.logger.Info("disabled user attempted OIDC login", "user_id", user.ID)
+		redirectLoginError(w, r, "Account disabled")
+		return
+	}
+
+	// Create session with regeneration to prevent session fixation
+	if err := h.sessionStore.RegenerateSession(w, r, user.ID); err != nil {
+		h.logger.Error("failed to create session", "user_id", user.ID, "error", err)
+		redirectLoginError(w, r, "Failed to create session")
+		return
+	}
+
+	h.logger.Info("user logged in with OIDC", "user_id", user.ID, "provider", provider.Name())
+	auditLogin(r, h.audit, user)
+	http.Redirect(w, r, "/dashboard.html", http.StatusFound)
+}
+
+// profile reads the user's details from their ID token using the provider's
+// claim and role mappings
+func (h *OIDCHandler) profile(provider *oidcProvider, claims *oidc.Claims) services.OIDCProfile {
+	mapping := provider.config.Claims
+	profile := services.OIDCProfile{
+		Provider:    provider.Name(),
+		Subject:     claims.Subject,
+		Username:    claims.String(cmp.Or(mapping.Username, defaultUsernameClaim)),
+		DisplayName: claims.String(cmp.Or(mapping.DisplayName, defaultDisplayNameClaim)),
+	}
+
+	// Only trust addresses the provider has verified
+	if bool(claims.EmailVerified) || provider.config.TrustEmail {
+		profile.Email = claims.String(cmp.Or(mapping.Email, defaultEmailClaim))
+	}
+
+	if len(provider.config.RoleMap) > 0 {
+		profile.Role = services.RoleFromGroups(provider.config.RoleMap, claims.Strings(cmp.Or(mapping.Groups, defaultGroupsClaim)))
+	}
+
+	return profile
+}
+
+// callbackURL returns the URL the provider sends users back to, which must be
+// registered with the provider
+func (h *OIDCHandler) callbackURL(r *http.Request, providerName string) string {
+	return publicURL(r, h.config) + "/api/auth/oidc/" + url.PathEscape(providerName) + "/callback"
+}
+
+// publicURL returns the public URL of the server, which is derived from the
+// request unless server.base_url is set
+func publicURL(r *http.Request, cfg *config.Config) string {
+	if cfg.Server.BaseURL != "" {
+		return cfg.Server.BaseURL
+	}
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// redirectLoginError sends the user back to the login page with an error
+func redirectLoginError(w http.ResponseWriter, r *http.Request, message string) {
+	http.Redirect(w, r, "/auth.html?error="+url.QueryEscape(message), http.StatusFound)
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/migrations"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/oidc/oidctest"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+func init() {
+	// Register types for gob encoding used by session store, as main does
+	gob.Register(time.Time{})
+}
+
+// newTestDB creates a migrated SQLite database that is removed after the test
+func newTestDB(t *testing.T) database.DBClient {
+	t.Helper()
+
+	db, err := database.NewDBClient(&database.Config{Type: "sqlite", Database: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := migrations.NewMigrator(db.GetDB(), "sqlite").Up(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	return db
+}
+
+// oidcTestApp is the application's OIDC routes backed by a fake provider
+type oidcTestApp struct {
+	server *httptest.Server
+	issuer *oidctest.Issuer
+	db     database.DBClient
+	client *http.Client
+}
+
+// newOIDCTestApp starts the application with a provider named "example",
+// whose configuration may be changed by configure
+func newOIDCTestApp(t *testing.T, configure ...func(*config.OIDCProviderConfig)) *oidcTestApp {
+	t.Helper()
+
+	db := newTestDB(t)
+	issuer := oidctest.NewIssuer(t, "print-dis", "client-secret")
+	provider := config.OIDCProviderConfig{
+		Name:         "example",
+		DisplayName:  "Example SSO",
+		IssuerURL:    issuer.URL(),
+		ClientID:     issuer.ClientID,
+		ClientSecret: issuer.ClientSecret,
+		Enabled:      true,
+	}
+	for _, fn := range configure {
+		fn(&provider)
+	}
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{Host: "localhost", Port: "8080"},
+		Auth: config.AuthConfig{
+			Enabled:        true,
+			SessionSecret:  "test-session-secret-that-is-long-enough",
+			SessionTimeout: time.Hour,
+			OIDC:           config.OIDCConfig{Providers: []config.OIDCProviderConfig{provider}},
+		},
+	}
+
+	sessionStore := middleware.NewSessionStore(cfg, db)
+	userService := services.NewUserService(db)
+	handler := NewOIDCHandler(userService, sessionStore, cfg)
+	authHandler := NewAuthHandler(userService, services.NewTwoFactorService(db, cfg.Auth.LocalAuth.TOTP), sessionStore, cfg)
+	sessionMW := sessionStore.SessionMiddleware()
+	authMW := sessionStore.AuthMiddleware(cfg)
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /api/auth/oidc/providers", http.HandlerFunc(handler.ListProviders))
+	mux.Handle("GET /api/auth/oidc/{provider}/login", sessionMW(http.HandlerFunc(handler.Login)))
+	mux.Handle("GET /api/auth/oidc/{provider}/callback", sessionMW(http.HandlerFunc(handler.Callback)))
+	mux.Handle("/api/auth/login", sessionMW(http.HandlerFunc(authHandler.Login)))
+	mux.Handle("GET /api/auth/me", sessionMW(authMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(middleware.GetUserID(r)))
+	}))))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &oidcTestApp{server: server, issuer: issuer, db: db, client: client}
+}
+
+// get makes a request and returns the response's status and redirect location
+func (a *oidcTestApp) get(t *testing.T, u string) (int, string) {
+	t.Helper()
+
+	resp, err := a.client.Get(u)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", u, err)
+	}
+	_ = resp.Body.Close()
+	return resp.StatusCode, resp.Header.Get("Location")
+}
+
+// login logs in at the fake provider and returns where the callback redirects
+func (a *oidcTestApp) login(t *testing.T) string {
+	t.Helper()
+
+	status, authURL := a.get(t, a.server.URL+"/api/auth/oidc/example/login")
+	if status != http.StatusFound {
+		t.Fatalf("Expected login to redirect to the provider, got %d", status)
+	}
+	callbackURL, err := a.issuer.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Provider rejected the authorization request: %v", err)
+	}
+
+	status, location := a.get(t, callbackURL)
+	if status != http.StatusFound {
+		t.Fatalf("Expected callback to redirect, got %d", status)
+	}
+	return location
+}
+
+// currentUserID returns the ID of the logged in user, or "" if nobody is
+func (a *oidcTestApp) currentUserID(t *testing.T) string {
+	t.Helper()
+
+	resp, err := a.client.Get(a.server.URL + "/api/auth/me")
+	if err != nil {
+		t.Fatalf("Failed to get current user: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return ""
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read current user: %v", err)
+	}
+	return string(body)
+}
+
+func TestOIDCLogin(t *testing.T) {
+	ctx := context.Background()
+	app := newOIDCTestApp(t)
+	app.issuer.SetUser(map[string]any{"sub": "alice-sub", "email": "alice@example.com", "email_verified": true, "name": "Alice"})
+
+	if location := app.login(t); location != "/dashboard.html" {
+		t.Fatalf("Expected login to succeed, redirected to %s", location)
+	}
+
+	identity, err := app.db.GetOIDCIdentity(ctx, "example", "alice-sub")
+	if err != nil || identity == nil {
+		t.Fatalf("Expected identity to be linked, got %v, %v", identity, err)
+	}
+	if got := app.currentUserID(t); got != identity.UserID {
+		t.Fatalf("Expected to be logged in as %s, got %q", identity.UserID, got)
+	}
+	user, err := app.db.GetUser(ctx, identity.UserID)
+	if err != nil || user == nil || user.DisplayName == nil || *user.DisplayName != "Alice" {
+		t.Fatalf("Expected user created from the ID token, got %+v, %v", user, err)
+	}
+
+	// Logging in again finds the same user by their identity, even if their
+	// email has changed at the provider
+	app.issuer.SetUser(map[string]any{"sub": "alice-sub", "email": "alice@new.example.com", "email_verified": true})
+	app.client.Jar, _ = cookiejar.New(nil)
+	if location := app.login(t); location != "/dashboard.html" {
+		t.Fatalf("Expected second login to succeed, redirected to %s", location)
+	}
+	if got := app.currentUserID(t); got != identity.UserID {
+		t.Errorf("Expected to be logged in as the same user %s, got %q", identity.UserID, got)
+	}
+}
+
+func TestOIDCLoginDoesNotMatchByEmail(t *testing.T) {
+	ctx := context.Background()
+	app := newOIDCTestApp(t)
+
+	email := "bob@example.com"
+	existing := models.NewUser("bob", &email)
+	existing.ID = "bob-id"
+	if err := existing.SetPassword("correct-horse-battery"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := app.db.CreateUser(ctx, existing); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Anyone who controls an account at the provider could claim Bob's address
+	app.issuer.SetUser(map[string]any{"sub": "mallory", "email": "bob@example.com", "email_verified": true})
+	if location := app.login(t); !strings.HasPrefix(location, "/auth.html?error=") {
+		t.Fatalf("Expected login to be refused, redirected to %s", location)
+	}
+	if got := app.currentUserID(t); got != "" {
+		t.Fatalf("Expected not to be logged in, got %q", got)
+	}
+
+	// Once logged in with their password, the user can link the identity to
+	// their account and log in with it from then on
+	resp, err := app.client.Post(app.server.URL+"/api/auth/login", "application/json", strings.NewReader(`{"username":"bob","password":"correct-horse-battery"}`))
+	if err != nil {
+		t.Fatalf("Failed to log in: %v", err)
+	}
+	_ = resp.Body.Close()
+	if got := app.currentUserID(t); got != existing.ID {
+		t.Fatalf("Expected to be logged in as %s, got %q", existing.ID, got)
+	}
+
+	app.issuer.SetUser(map[string]any{"sub": "bob-sub", "email": "bob@example.com", "email_verified": true})
+	if location := app.login(t); location != "/dashboard.html" {
+		t.Fatalf("Expected identity to be linked, redirected to %s", location)
+	}
+
+	app.client.Jar, _ = cookiejar.New(nil)
+	if location := app.login(t); location != "/dashboard.html" {
+		t.Fatalf("Expected login with the linked identity to succeed, redirected to %s", location)
+	}
+	if got := app.currentUserID(t); got != existing.ID {
+		t.Errorf("Expected to be logged in as %s, got %q", existing.ID, got)
+	}
+}
+
+func TestOIDCCallbackRejectsForgedRequests(t *testing.T) {
+	app := newOIDCTestApp(t)
+
+	status, authURL := app.get(t, app.server.URL+"/api/auth/oidc/example/login")
+	if status != http.StatusFound {
+		t.Fatalf("Expected login to redirect to the provider, got %d", status)
+	}
+	callbackURL, err := app.issuer.Authorize(authURL)
+	if err != nil {
+		t.Fatalf("Provider rejected the authorization request: %v", err)
+	}
+
+	// A callback with another state, e.g. from a login the attacker started
+	forged, _ := url.Parse(callbackURL)
+	query := forged.Query()
+	query.Set("state", "attacker-state")
+	forged.RawQuery = query.Encode()
+	if _, location := app.get(t, forged.String()); !strings.HasPrefix(location, "/auth.html?error=") {
+		t.Errorf("Expected forged state to be refused, redirected to %s", location)
+	}
+
+	// The login attempt is used up, so the genuine callback cannot be replayed
+	if _, location := app.get(t, callbackURL); !strings.HasPrefix(location, "/auth.html?error=") {
+		t.Errorf("Expected replayed callback to be refused, redirected to %s", location)
+	}
+	if got := app.currentUserID(t); got != "" {
+		t.Errorf("Expected not to be logged in, got %q", got)
+	}
+
+	if status, _ := app.get(t, app.server.URL+"/api/auth/oidc/unknown/login"); status != http.StatusNotFound {
+		t.Errorf("Expected unknown provider to return 404, got %d", status)
+	}
+}
+
+func TestOIDCClaimAndRoleMapping(t *testing.T) {
+	ctx := context.Background()
+	app := newOIDCTestApp(t, func(provider *config.OIDCProviderConfig) {
+		provider.TrustEmail = true
+		provider.Claims = config.OIDCClaimsConfig{
+			Username: "nickname",
+			Groups:   "realm_access.roles",
+		}
+		provider.RoleMap = []config.RoleMappingConfig{
+			{Group: "print-admins", Role: "no-such-role"},
+			{Group: "print-mods", Role: string(models.RoleModerator)},
+		}
+	})
+
+	app.issuer.SetUser(map[string]any{
+		"sub":            "carol-sub",
+		"nickname":       "carol",
+		"email":          "carol@example.com",
+		"email_verified": false,
+		"realm_access":   map[string]any{"roles": []string{"staff", "print-admins", "print-mods"}},
+	})
+	if location := app.login(t); location != "/dashboard.html" {
+		t.Fatalf("Expected login to succeed, redirected to %s", location)
+	}
+
+	user, err := app.db.GetUserByUsername(ctx, "carol")
+	if err != nil || user == nil {
+		t.Fatalf("Expected user named from the mapped claim, got %+v, %v", user, err)
+	}
+	if user.Email == nil || *user.Email != "carol@example.com" {
+		t.Errorf("Expected the provider's email to be trusted, got %v", user.Email)
+	}
+	if user.Role != models.RoleModerator {
+		t.Errorf("Expected the first valid mapped role, got %s", user.Role)
+	}
+
+	// Leaving the group at the provider takes the role away at the next login
+	app.issuer.SetUser(map[string]any{"sub": "carol-sub", "realm_access": map[string]any{"roles": []string{"staff"}}})
+	app.client.Jar, _ = cookiejar.New(nil)
+	if location := app.login(t); location != "/dashboard.html" {
+		t.Fatalf("Expected second login to succeed, redirected to %s", location)
+	}
+	user, err = app.db.GetUser(ctx, user.ID)
+	if err != nil || user == nil || user.Role != models.RoleUser {
+		t.Errorf("Expected role to be reset to user, got %+v, %v", user, err)
+	}
+}
+
+func TestListOIDCProviders(t *testing.T) {
+	app := newOIDCTestApp(t)
+
+	resp, err := app.client.Get(app.server.URL + "/api/auth/oidc/providers")
+	if err != nil {
+		t.Fatalf("Failed to list providers: %v", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var result struct {
+		Data []OIDCProviderResponse `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("Failed to decode providers: %v", err)
+	}
+	want := []OIDCProviderResponse{{Name: "example", DisplayName: "Example SSO", LoginURL: "/api/auth/oidc/example/login"}}
+	if len(result.Data) != 1 || result.Data[0] != want[0] {
+		t.Errorf("Expected providers %+v, got %+v", want, result.Data)
+	}
+}
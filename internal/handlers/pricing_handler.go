@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/validation"
+)
+
+// PricingHandler handles HTTP requests for print pricing
+type PricingHandler struct {
+	service *services.PricingService
+	logger  *slog.Logger
+}
+
+// NewPricingHandler creates a new pricing handler
+func NewPricingHandler(service *services.PricingService) *PricingHandler {
+	return &PricingHandler{
+		service: service,
+		logger:  slog.Default(),
+	}
+}
+
+// GetQuote handles GET /api/pricing/quote?spool_id=&grams=&hours=
+func (h *PricingHandler) GetQuote(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	validator := validation.NewValidator()
+
+	var spoolID *int
+	if value := query.Get("spool_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil || id <= 0 {
+			validator.AddError("spool_id", "must be a positive integer")
+		} else {
+			spoolID = &id
+		}
+	}
+	grams := parseAmount(validator, "grams", query.Get("grams"), maxPrintGrams)
+	hours := parseAmount(validator, "hours", query.Get("hours"), maxPrintHours)
+
+	if validationErrors := validator.Errors(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	quote := h.service.Quote(r.Context(), spoolID, grams, hours)
+	response.WriteSuccessResponse(w, quote, "")
+}
+
+// parseAmount parses an optional non-negative number from a query parameter
+func parseAmount(validator *validation.Validator, field, value string, max float64) float64 {
+	if value == "" {
+		return 0
+	}
+	amount, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		validator.AddError(field, "must be a number")
+		return 0
+	}
+	validator.ValidateRange(field, &amount, 0, max)
+	return amount
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+// newPrintRequestTestApp serves login and the print request endpoints, which
+// check permissions themselves
+func newPrintRequestTestApp(t *testing.T) *emailTestApp {
+	t.Helper()
+	db := newTestDB(t)
+	cfg := &config.Config{
+		Auth: config.AuthConfig{
+			Enabled:        true,
+			SessionSecret:  "test-session-secret-that-is-long-enough",
+			SessionTimeout: time.Hour,
+			LocalAuth:      config.LocalAuthConfig{Enabled: true},
+		},
+	}
+	userService := services.NewUserService(db)
+	sessionStore := middleware.NewSessionStore(cfg, db)
+	authHandler := NewAuthHandler(userService, services.NewTwoFactorService(db, cfg.Auth.LocalAuth.TOTP), sessionStore, cfg)
+	printRequestHandler := NewPrintRequestHandler(services.NewPrintRequestService(db), nil)
+	sessionMW := sessionStore.SessionMiddleware()
+	authMW := sessionStore.AuthMiddleware(cfg)
+	authenticated := func(handler http.HandlerFunc) http.Handler {
+		return sessionMW(authMW(handler))
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/auth/login", sessionMW(http.HandlerFunc(authHandler.Login)))
+	mux.Handle("GET /api/print-requests", authenticated(printRequestHandler.ListPrintRequests))
+	mux.Handle("GET /api/print-requests/get", authenticated(printRequestHandler.GetPrintRequest))
+	mux.Handle("PUT /api/print-requests", authenticated(printRequestHandler.UpdatePrintRequest))
+	mux.Handle("DELETE /api/print-requests", authenticated(printRequestHandler.DeletePrintRequest))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return &emailTestApp{db: db, server: server}
+}
+
+func TestPrintRequestGroupAccess(t *testing.T) {
+	ctx := context.Background()
+	app := newPrintRequestTestApp(t)
+
+	labA := &models.Group{ID: uuid.NewString(), Name: "Lab A", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	labB := &models.Group{ID: uuid.NewString(), Name: "Lab B", CreatedAt: time.Now(), UpdatedAt: time.Now()}
+	for _, group := range []*models.Group{labA, labB} {
+		if err := app.db.CreateGroup(ctx, group); err != nil {
+			t.Fatalf("Failed to create group: %v", err)
+		}
+	}
+
+	// The owner and a peer are in lab A, an outsider is in lab B and is
+	// moderated by lab B's moderator
+	clients := map[string]*http.Client{}
+	for _, member := range []struct {
+		username string
+		group    *models.Group
+		role     models.GroupRole
+	}{
+		{"owner", labA, models.GroupRoleMember},
+		{"peer", labA, models.GroupRoleMember},
+		{"outsider", labB, models.GroupRoleMember},
+		{"lab-b-moderator", labB, models.GroupRoleModerator},
+	} {
+		user := models.NewUser(member.username, nil)
+		user.ID = member.username + "-id"
+		if err := user.SetPassword("member-password"); err != nil {
+			t.Fatalf("Failed to set password: %v", err)
+		}
+		if err := app.db.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+		if err := app.db.SetGroupMembership(ctx, &models.GroupMembership{GroupID: member.group.ID, UserID: user.ID, Role: member.role, CreatedAt: time.Now()}); err != nil {
+			t.Fatalf("Failed to add group member: %v", err)
+		}
+		client, status := app.login(t, member.username, "member-password")
+		if status != http.StatusOK {
+			t.Fatalf("Failed to log in as %s: %d", member.username, status)
+		}
+		clients[member.username] = client
+	}
+
+	request := models.NewPrintRequest("owner-id", "https://example.com/owner.stl", "")
+	request.ID = uuid.NewString()
+	request.GroupID = &labA.ID
+	if err := app.db.CreatePrintRequest(ctx, request); err != nil {
+		t.Fatalf("Failed to create print request: %v", err)
+	}
+	path := "/api/print-requests?id=" + request.ID
+
+	// Only the owner and lab A see the request
+	for username, visible := range map[string]bool{"owner": true, "peer": true, "outsider": false, "lab-b-moderator": false} {
+		status, data := app.do(t, clients[username], http.MethodGet, "/api/print-requests", nil)
+		var requests []*models.PrintRequest
+		if err := json.Unmarshal(data, &requests); status != http.StatusOK || err != nil {
+			t.Fatalf("Failed to list print requests as %s: %d %s", username, status, data)
+		}
+		if (len(requests) == 1) != visible {
+			t.Errorf("Expected %s to see the request: %v, got %d requests", username, visible, len(requests))
+		}
+
+		expected := http.StatusForbidden
+		if visible {
+			expected = http.StatusOK
+		}
+		if status, _ := app.do(t, clients[username], http.MethodGet, "/api/print-requests/get?id="+request.ID, nil); status != expected {
+			t.Errorf("Expected %s to get %d fetching the request, got %d", username, expected, status)
+		}
+	}
+
+	// Only the owner edits it, and it can't be moved into another lab's queue
+	update := CreatePrintRequestRequest{FileLink: "https://example.com/moved.stl", GroupID: &labB.ID}
+	for _, username := range []string{"peer", "outsider", "lab-b-moderator"} {
+		if status, _ := app.do(t, clients[username], http.MethodPut, path, update); status != http.StatusForbidden {
+			t.Errorf("Expected %s to be refused editing the request, got %d", username, status)
+		}
+		if status, _ := app.do(t, clients[username], http.MethodDelete, path, nil); status != http.StatusForbidden {
+			t.Errorf("Expected %s to be refused deleting the request, got %d", username, status)
+		}
+	}
+	if stored, _ := app.db.GetPrintRequest(ctx, request.ID); stored == nil || stored.FileLink != request.FileLink || groupIDOf(stored) != labA.ID {
+		t.Fatalf("Expected the request to be unchanged, got %+v", stored)
+	}
+	if status, _ := app.do(t, clients["owner"], http.MethodPut, path, update); status != http.StatusForbidden {
+		t.Errorf("Expected the owner to be refused moving the request into a lab they aren't in, got %d", status)
+	}
+	update.GroupID = nil
+	if status, _ := app.do(t, clients["owner"], http.MethodPut, path, update); status != http.StatusOK {
+		t.Errorf("Failed to edit own request: %d", status)
+	}
+	if stored, _ := app.db.GetPrintRequest(ctx, request.ID); stored.UserID != "owner-id" || stored.FileLink != update.FileLink {
+		t.Errorf("Expected the owner's edit to be saved, got %+v", stored)
+	}
+	if status, _ := app.do(t, clients["owner"], http.MethodDelete, path, nil); status != http.StatusOK {
+		t.Errorf("Failed to delete own request: %d", status)
+	}
+	if status, _ := app.do(t, clients["owner"], http.MethodDelete, path, nil); status != http.StatusNotFound {
+		t.Errorf("Expected deleting a missing request to be not found, got %d", status)
+	}
+}
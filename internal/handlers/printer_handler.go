@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/validation"
+)
+
+// PrinterHandler handles HTTP requests for printers
+type PrinterHandler struct {
+	service *services.PrinterService
+	logger  *slog.Logger
+}
+
+// NewPrinterHandler creates a new printer handler
+func NewPrinterHandler(service *services.PrinterService) *PrinterHandler {
+	return &PrinterHandler{
+		service: service,
+		logger:  slog.Default(),
+	}
+}
+
+// PrinterRequest represents the request body for creating or updating a printer
+type PrinterRequest struct {
+	Name       string           `json:"name"`
+	Dimensions models.Dimension `json:"dimensions"`
+	Url        string           `json:"url"`
+}
+
+// Validate validates the printer data
+func (r *PrinterRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Name = validation.SanitizeString(r.Name)
+	r.Url = validation.SanitizeString(r.Url)
+
+	validator.ValidateRequired("name", r.Name)
+	validator.ValidateLength("name", r.Name, 1, 100)
+	validator.ValidateNoHTML("name", r.Name)
+	validator.ValidateURL("url", r.Url)
+
+	if r.Dimensions.X < 0 || r.Dimensions.Y < 0 || r.Dimensions.Z < 0 {
+		validator.AddError("dimensions", "must not be negative")
+	}
+
+	return validator.Errors()
+}
+
+// ListPrinters handles GET /api/printers
+func (h *PrinterHandler) ListPrinters(w http.ResponseWriter, r *http.Request) {
+	printers, err := h.service.ListPrinters(r.Context())
+	if err != nil {
+		response.WriteInternalError(w, "Failed to list printers", "")
+		return
+	}
+
+	response.WriteSuccessResponse(w, printers, "")
+}
+
+// CreatePrinter handles POST /api/admin/printers
+func (h *PrinterHandler) CreatePrinter(w http.ResponseWriter, r *http.Request) {
+	var req PrinterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error("failed to decode printer request body", "error", err)
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	printer := &models.Printer{
+		Name:       req.Name,
+		Dimensions: req.Dimensions,
+		Url:        req.Url,
+	}
+	if err := h.service.CreatePrinter(r.Context(), printer); err != nil {
+		response.WriteInternalError(w, "Failed to create printer", "")
+		return
+	}
+
+	response.WriteCreatedResponse(w, printer, "Printer created successfully")
+}
+
+// UpdatePrinter handles PUT /api/admin/printers?id=
+func (h *PrinterHandler) UpdatePrinter(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.printerID(w, r)
+	if !ok {
+		return
+	}
+
+	var req PrinterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.logger.Error("failed to decode printer request body", "error", err, "id", id)
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	existing, err := h.service.GetPrinter(r.Context(), id)
+	if err != nil {
+		response.WriteInternalError(w, "Failed to get printer", "")
+		return
+	}
+	if existing == nil {
+		response.WriteNotFoundError(w, "Printer not found")
+		return
+	}
+
+	existing.Name = req.Name
+	existing.Dimensions = req.Dimensions
+	existing.Url = req.Url
+	if err := h.service.UpdatePrinter(r.Context(), existing); err != nil {
+		response.WriteInternalError(w, "Failed to update printer", "")
+		return
+	}
+
+	response.WriteSuccessResponse(w, existing, "Printer updated successfully")
+}
+
+// DeletePrinter handles DELETE /api/admin/printers?id=
+func (h *PrinterHandler) DeletePrinter(w http.ResponseWriter, r *http.Request) {
+	id, ok := h.printerID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.service.DeletePrinter(r.Context(), id); err != nil {
+		response.WriteInternalError(w, "Failed to delete printer", "")
+		return
+	}
+
+	response.WriteSuccessResponse(w, nil, "Printer deleted successfully")
+}
+
+// printerID parses the printer ID query parameter, writing an error response if it is invalid
+func (h *PrinterHandler) printerID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	idStr := r.URL.Query().Get("id")
+	if idStr == "" {
+		response.WriteBadRequestError(w, "Printer ID is required", "")
+		return 0, false
+	}
+
+	id, err := strconv.Atoi(idStr)
+	if err != nil || id <= 0 {
+		h.logger.Warn("invalid printer ID", "id", validation.SanitizeLogString(idStr))
+		response.WriteBadRequestError(w, "Invalid printer ID", "")
+		return 0, false
+	}
+	return id, true
+}
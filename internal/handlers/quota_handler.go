@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/validation"
+)
+
+// QuotaHandler handles HTTP requests for managing quota overrides
+type QuotaHandler struct {
+	quotas      *services.QuotaService
+	userService *services.UserService
+	logger      *slog.Logger
+}
+
+// NewQuotaHandler creates a new quota handler
+func NewQuotaHandler(quotas *services.QuotaService, userService *services.UserService) *QuotaHandler {
+	return &QuotaHandler{
+		quotas:      quotas,
+		userService: userService,
+		logger:      slog.Default(),
+	}
+}
+
+// SetQuotaOverrideRequest represents the request body for setting a quota override
+type SetQuotaOverrideRequest struct {
+	Scope   models.QuotaScope `json:"scope"`
+	Subject string            `json:"subject"`
+	models.QuotaLimits
+}
+
+// Validate validates the set quota override request
+func (r *SetQuotaOverrideRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	switch r.Scope {
+	case models.QuotaScopeUser:
+		validator.ValidateRequired("subject", r.Subject)
+		validator.ValidateUUID("subject", r.Subject)
+	case models.QuotaScopeRole:
+		if !models.Role(r.Subject).IsValid() {
+			validator.AddError("subject", "must be a valid role")
+		}
+	default:
+		validator.AddError("scope", "must be one of: user, role")
+	}
+
+	if r.MaxOpenRequests != nil && (*r.MaxOpenRequests < 0 || *r.MaxOpenRequests > 10000) {
+		validator.AddError("max_open_requests", "must be between 0 and 10000")
+	}
+	validator.ValidateRange("monthly_grams", r.MonthlyGrams, 0, maxPrintGrams)
+	validator.ValidateRange("monthly_hours", r.MonthlyHours, 0, maxPrintHours)
+
+	return validator.Errors()
+}
+
+// ListOverrides handles GET /api/admin/quotas
+func (h *QuotaHandler) ListOverrides(w http.ResponseWriter, r *http.Request) {
+	overrides, err := h.quotas.ListOverrides(r.Context())
+	if err != nil {
+		h.logger.Error("failed to list quota overrides", "error", err)
+		response.WriteInternalError(w, "Failed to list quota overrides", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, overrides, "")
+}
+
+// SetOverride handles PUT /api/admin/quotas
+func (h *QuotaHandler) SetOverride(w http.ResponseWriter, r *http.Request) {
+	var req SetQuotaOverrideRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	override, err := h.quotas.SetOverride(r.Context(), req.Scope, req.Subject, req.QuotaLimits)
+	if err != nil {
+		response.WriteInternalError(w, "Failed to set quota override", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, override, "Quota override saved successfully")
+}
+
+// DeleteOverride handles DELETE /api/admin/quotas?id=
+func (h *QuotaHandler) DeleteOverride(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id <= 0 {
+		response.WriteBadRequestError(w, "Invalid quota override ID", "")
+		return
+	}
+
+	if err := h.quotas.DeleteOverride(r.Context(), id); err != nil {
+		response.WriteInternalError(w, "Failed to delete quota override", err.Error())
+		return
+	}
+
+	response.WriteNoContentResponse(w)
+}
+
+// GetUserStatus handles GET /api/admin/quotas/status?user_id=
+func (h *QuotaHandler) GetUserStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("user_id")
+	if userID == "" {
+		response.WriteBadRequestError(w, "User ID is required", "")
+		return
+	}
+
+	user, err := h.userService.GetUser(r.Context(), userID)
+	if err != nil || user == nil {
+		response.WriteNotFoundError(w, "User not found")
+		return
+	}
+
+	status, err := h.quotas.Status(r.Context(), user)
+	if err != nil {
+		h.logger.Error("failed to get quota status", "error", err, "user_id", validation.SanitizeLogString(userID))
+		response.WriteInternalError(w, "Failed to get quota status", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, status, "")
+}
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/validation"
+)
+
+// roleNameRegex matches valid role names, e.g. "operator" or "lab-tech"
+var roleNameRegex = regexp.MustCompile(`^[a-z][a-z0-9_-]{1,49}$`)
+
+// RoleHandler handles HTTP requests for managing roles and their permissions
+type RoleHandler struct {
+	roles  *services.RoleService
+	audit  *services.AuditService
+	logger *slog.Logger
+}
+
+// NewRoleHandler creates a new role handler
+func NewRoleHandler(roles *services.RoleService) *RoleHandler {
+	return &RoleHandler{
+		roles:  roles,
+		logger: slog.Default(),
+	}
+}
+
+// SetAudit records roles being created, changed and deleted in the audit log
+func (h *RoleHandler) SetAudit(audit *services.AuditService) {
+	h.audit = audit
+}
+
+// RoleRequest represents the request body for creating or updating a role
+type RoleRequest struct {
+	Name        models.Role         `json:"name"` // Only used when creating a role
+	Description string              `json:"description"`
+	Permissions []models.Permission `json:"permissions"`
+}
+
+// Validate validates the role request
+func (r *RoleRequest) Validate(creating bool) validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Description = validation.SanitizeString(r.Description)
+
+	if creating && !roleNameRegex.MatchString(string(r.Name)) {
+		validator.AddError("name", "must be 2-50 lowercase letters, digits, underscores or dashes, starting with a letter")
+	}
+	validator.ValidateLength("description", r.Description, 0, 500)
+	validator.ValidateNoHTML("description", r.Description)
+
+	for _, permission := range r.Permissions {
+		if !permission.IsValid() {
+			validator.AddError("permissions", "unknown permission: "+validation.SanitizeLogString(string(permission)))
+		}
+	}
+
+	return validator.Errors()
+}
+
+// ListRoles handles GET /api/admin/roles
+func (h *RoleHandler) ListRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := h.roles.ListRoles(r.Context())
+	if err != nil {
+		h.logger.Error("failed to list roles", "error", err)
+		response.WriteInternalError(w, "Failed to list roles", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, roles, "")
+}
+
+// ListPermissions handles GET /api/admin/roles/permissions
+func (h *RoleHandler) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	response.WriteSuccessResponse(w, models.AllPermissions(), "")
+}
+
+// CreateRole handles POST /api/admin/roles
+func (h *RoleHandler) CreateRole(w http.ResponseWriter, r *http.Request) {
+	var req RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	if validationErrors := req.Validate(true); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+	if !canGrantPermissions(w, r, req.Permissions) {
+		return
+	}
+
+	role := &models.RoleDefinition{
+		Name:        req.Name,
+		Description: req.Description,
+		Permissions: req.Permissions,
+	}
+	if err := h.roles.CreateRole(r.Context(), role); err != nil {
+		writeRoleError(w, "Failed to create role", err)
+		return
+	}
+
+	recordAudit(r, h.audit, &models.AuditEvent{
+		Action:     models.AuditRoleCreated,
+		TargetType: models.AuditTargetRole,
+		TargetID:   string(role.Name),
+		Changes: models.AuditChanges{
+			"description": {After: role.Description},
+			"permissions": {After: role.Permissions},
+		},
+	})
+
+	response.WriteCreatedResponse(w, role, "Role created successfully")
+}
+
+// UpdateRole handles PUT /api/admin/roles?name=
+func (h *RoleHandler) UpdateRole(w http.ResponseWriter, r *http.Request) {
+	name := models.Role(r.URL.Query().Get("name"))
+	if name == "" {
+		response.WriteBadRequestError(w, "Role name is required", "")
+		return
+	}
+
+	var req RoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	if validationErrors := req.Validate(false); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+	if !canGrantPermissions(w, r, req.Permissions) {
+		return
+	}
+
+	// The role before the change is kept for the audit log
+	previous, err := h.roles.GetRole(r.Context(), name)
+	if err != nil {
+		writeRoleError(w, "Failed to update role", err)
+		return
+	}
+	if previous == nil {
+		response.WriteNotFoundError(w, "Role not found")
+		return
+	}
+
+	role, err := h.roles.UpdateRole(r.Context(), name, req.Description, req.Permissions)
+	if err != nil {
+		writeRoleError(w, "Failed to update role", err)
+		return
+	}
+
+	recordAudit(r, h.audit, &models.AuditEvent{
+		Action:     models.AuditRoleUpdated,
+		TargetType: models.AuditTargetRole,
+		TargetID:   string(role.Name),
+		Changes: models.AuditChanges{
+			"description": {Before: previous.Description, After: role.Description},
+			"permissions": {Before: previous.Permissions, After: role.Permissions},
+		},
+	})
+
+	response.WriteSuccessResponse(w, role, "Role updated successfully")
+}
+
+// DeleteRole handles DELETE /api/admin/roles?name=
+func (h *RoleHandler) DeleteRole(w http.ResponseWriter, r *http.Request) {
+	name := models.Role(r.URL.Query().Get("name"))
+	if name == "" {
+		response.WriteBadRequestError(w, "Role name is required", "")
+		return
+	}
+
+	// The role is also kept for the audit log
+	deleted, err := h.roles.GetRole(r.Context(), name)
+	if err != nil {
+		writeRoleError(w, "Failed to delete role", err)
+		return
+	}
+	if deleted == nil {
+		response.WriteNotFoundError(w, "Role not found")
+		return
+	}
+
+	if err := h.roles.DeleteRole(r.Context(), name); err != nil {
+		writeRoleError(w, "Failed to delete role", err)
+		return
+	}
+
+	recordAudit(r, h.audit, &models.AuditEvent{
+		Action:     models.AuditRoleDeleted,
+		TargetType: models.AuditTargetRole,
+		TargetID:   string(deleted.Name),
+		Changes: models.AuditChanges{
+			"description": {Before: deleted.Description},
+			"permissions": {Before: deleted.Permissions},
+		},
+	})
+
+	response.WriteNoContentResponse(w)
+}
+
+// canGrantPermissions checks that the current user has every permission a
+// role is to grant, so that nobody can give themselves or others more access
+// through a role, and writes an error response otherwise
+func canGrantPermissions(w http.ResponseWriter, r *http.Request, permissions []models.Permission) bool {
+	currentUser := middleware.GetUser(r)
+	if currentUser == nil || currentUser.CanGrantPermissions(permissions) {
+		return true
+	}
+	response.WriteForbiddenError(w, "Cannot grant permissions you do not have")
+	return false
+}
+
+// writeRoleError writes the response for an error returned by the role service
+func writeRoleError(w http.ResponseWriter, message string, err error) {
+	switch {
+	case errors.Is(err, services.ErrRoleNotFound):
+		response.WriteNotFoundError(w, "Role not found")
+	case errors.Is(err, services.ErrRoleExists), errors.Is(err, services.ErrRoleProtected), errors.Is(err, services.ErrRoleInUse):
+		response.WriteConflictError(w, message, err.Error())
+	default:
+		response.WriteInternalError(w, message, err.Error())
+	}
+}
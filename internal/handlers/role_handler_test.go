@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+func TestRoleEscalation(t *testing.T) {
+	ctx := context.Background()
+	app := newAdminTestApp(t)
+	t.Cleanup(func() { models.SetRoles(models.BuiltInRoles()) })
+
+	// Promoters can manage users and roles, but not billing
+	roles := services.NewRoleService(app.db)
+	for _, role := range []*models.RoleDefinition{
+		{Name: "promoter", Permissions: []models.Permission{
+			models.PermissionCreatePrintRequests, models.PermissionViewOwnPrintRequests, models.PermissionViewUsers,
+			models.PermissionManageUsers, models.PermissionPromoteUsers, models.PermissionManageRoles,
+		}},
+		{Name: "treasurer", Permissions: []models.Permission{models.PermissionManageBilling}},
+	} {
+		if err := roles.CreateRole(ctx, role); err != nil {
+			t.Fatalf("Failed to create role: %v", err)
+		}
+	}
+
+	promoter := models.NewUser("promoter", nil)
+	promoter.ID = "promoter-id"
+	promoter.Role = "promoter"
+	if err := promoter.SetPassword("promoter-password"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	target := models.NewUser("target", nil)
+	target.ID = "target-id"
+	for _, user := range []*models.User{promoter, target} {
+		if err := app.db.CreateUser(ctx, user); err != nil {
+			t.Fatalf("Failed to create user: %v", err)
+		}
+	}
+	client, status := app.login(t, "promoter", "promoter-password")
+	if status != http.StatusOK {
+		t.Fatalf("Failed to log in: %d", status)
+	}
+
+	// Roles can only grant permissions their creator has
+	if status, data := app.do(t, client, http.MethodPost, "/api/admin/roles", RoleRequest{
+		Name: "sneaky", Permissions: []models.Permission{models.PermissionViewUsers, models.PermissionManageBilling},
+	}); status != http.StatusForbidden {
+		t.Errorf("Expected creating a role with more permissions to be refused, got %d %s", status, data)
+	}
+	if status, data := app.do(t, client, http.MethodPost, "/api/admin/roles", RoleRequest{
+		Name: "viewer", Permissions: []models.Permission{models.PermissionViewUsers},
+	}); status != http.StatusCreated {
+		t.Fatalf("Failed to create role: %d %s", status, data)
+	}
+	for _, name := range []string{"viewer", "promoter"} {
+		if status, data := app.do(t, client, http.MethodPut, "/api/admin/roles?name="+name, RoleRequest{
+			Permissions: []models.Permission{models.PermissionManageBilling},
+		}); status != http.StatusForbidden {
+			t.Errorf("Expected adding permissions to %s to be refused, got %d %s", name, status, data)
+		}
+	}
+	if models.Role("promoter").HasPermission(models.PermissionManageBilling) {
+		t.Error("Expected the promoter role to be unchanged")
+	}
+
+	// Nor can roles with more permissions be given to anyone
+	for _, role := range []models.Role{"treasurer", models.RoleModerator, models.RoleAdmin} {
+		if status, data := app.do(t, client, http.MethodPost, "/api/admin/users", CreateUserRequest{
+			Username: "new-" + string(role), Role: role,
+		}); status != http.StatusForbidden {
+			t.Errorf("Expected creating a %s to be refused, got %d %s", role, status, data)
+		}
+		if status, data := app.do(t, client, http.MethodPut, "/api/admin/users/role?id="+target.ID, map[string]models.Role{
+			"role": role,
+		}); status != http.StatusForbidden {
+			t.Errorf("Expected promoting to %s to be refused, got %d %s", role, status, data)
+		}
+
+		status, data := app.do(t, client, http.MethodPost, "/api/admin/users/import?dry_run=true", []services.UserRecord{
+			{Username: "imported-" + string(role), Role: role},
+		})
+		var report services.ImportReport
+		if err := json.Unmarshal(data, &report); status != http.StatusOK || err != nil || len(report.Rows) != 1 {
+			t.Fatalf("Failed to dry run import: %d %s", status, data)
+		}
+		if row := report.Rows[0]; row.Status != services.ImportRowInvalid || len(row.Errors) != 1 || row.Errors[0].Field != "role" {
+			t.Errorf("Expected importing a %s to be refused, got %+v", role, report.Rows[0])
+		}
+	}
+	if user, _ := app.db.GetUser(ctx, target.ID); user == nil || user.Role != models.RoleUser {
+		t.Errorf("Expected the target's role to be unchanged, got %+v", user)
+	}
+
+	// Roles within the promoter's permissions can be given
+	if status, data := app.do(t, client, http.MethodPut, "/api/admin/users/role?id="+target.ID, map[string]models.Role{
+		"role": "viewer",
+	}); status != http.StatusOK {
+		t.Errorf("Failed to give role: %d %s", status, data)
+	}
+}
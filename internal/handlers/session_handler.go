@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+// SessionHandler handles HTTP requests for a user's active login sessions
+type SessionHandler struct {
+	sessions     *services.SessionService
+	sessionStore *middleware.SessionStore
+	logger       *slog.Logger
+}
+
+// NewSessionHandler creates a new session handler
+func NewSessionHandler(sessions *services.SessionService, sessionStore *middleware.SessionStore) *SessionHandler {
+	return &SessionHandler{
+		sessions:     sessions,
+		sessionStore: sessionStore,
+		logger:       slog.Default(),
+	}
+}
+
+// SessionResponse represents one of the user's sessions
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	UserAgent  string    `json:"user_agent"`
+	IPAddress  string    `json:"ip_address"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"` // Whether this is the session making the request
+}
+
+// ListSessions handles GET /api/auth/sessions
+func (h *SessionHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.sessions.ListSessions(r.Context(), user.ID)
+	if err != nil {
+		h.logger.Error("failed to list sessions", "error", err, "user_id", user.ID)
+		response.WriteInternalError(w, "Failed to list sessions", err.Error())
+		return
+	}
+
+	currentID := h.sessionStore.CurrentSessionID(r)
+	responses := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		responses = append(responses, SessionResponse{
+			ID:         session.ID,
+			Device:     describeDevice(session.UserAgent),
+			UserAgent:  session.UserAgent,
+			IPAddress:  session.IPAddress,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentID,
+		})
+	}
+
+	response.WriteSuccessResponse(w, responses, "")
+}
+
+// RevokeSession handles DELETE /api/auth/sessions?id=
+func (h *SessionHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		response.WriteBadRequestError(w, "Session ID is required", "")
+		return
+	}
+
+	if err := h.sessions.RevokeSession(r.Context(), user.ID, id); err != nil {
+		if errors.Is(err, services.ErrSessionNotFound) {
+			response.WriteNotFoundError(w, "Session not found")
+			return
+		}
+		h.logger.Error("failed to revoke session", "error", err, "user_id", user.ID)
+		response.WriteInternalError(w, "Failed to revoke session", err.Error())
+		return
+	}
+
+	response.WriteNoContentResponse(w)
+}
+
+// RevokeOtherSessions handles POST /api/auth/sessions/logout-others
+func (h *SessionHandler) RevokeOtherSessions(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.sessions.RevokeOtherSessions(r.Context(), user.ID, h.sessionStore.CurrentSessionID(r)); err != nil {
+		h.logger.Error("failed to revoke other sessions", "error", err, "user_id", user.ID)
+		response.WriteInternalError(w, "Failed to log out other sessions", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, nil, "Logged out of all other sessions")
+}
+
+// sessionUser returns the current user, refusing requests authenticated with
+// an API token, so that a leaked token cannot be used to take over the
+// account by managing its sessions, tokens, passkeys or two-factor
+// authentication
+func sessionUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user := middleware.GetUser(r)
+	if user == nil {
+		response.WriteUnauthorizedError(w, "Authentication required")
+		return nil, false
+	}
+	if user.Token != nil {
+		response.WriteForbiddenError(w, "API tokens cannot be used to manage the account's security")
+		return nil, false
+	}
+	return user, true
+}
+
+// describeDevice summarises a user agent as e.g. "Firefox on Linux"
+func describeDevice(userAgent string) string {
+	browsers := []struct{ token, name string }{
+		// Order matters, as most browsers also claim to be the ones they are
+		// based on
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+		{"curl/", "curl"},
+	}
+	systems := []struct{ token, name string }{
+		{"Android", "Android"},
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	}
+
+	browser := ""
+	for _, b := range browsers {
+		if strings.Contains(userAgent, b.token) {
+			browser = b.name
+			break
+		}
+	}
+	system := ""
+	for _, s := range systems {
+		if strings.Contains(userAgent, s.token) {
+			system = s.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+func TestUserSessions(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	user := models.NewUser("roamer", nil)
+	user.ID = "roamer-id"
+	if err := user.SetPassword("correct-horse-battery"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{Host: "localhost", Port: "8080"},
+		Auth: config.AuthConfig{
+			Enabled:        true,
+			SessionSecret:  "test-session-secret-that-is-long-enough",
+			SessionTimeout: time.Hour,
+		},
+	}
+	sessionStore := middleware.NewSessionStore(cfg, db)
+	authHandler := NewAuthHandler(services.NewUserService(db), services.NewTwoFactorService(db, cfg.Auth.LocalAuth.TOTP), sessionStore, cfg)
+	sessionHandler := NewSessionHandler(services.NewSessionService(db), sessionStore)
+	sessionMW := sessionStore.SessionMiddleware()
+	authMW := sessionStore.AuthMiddleware(cfg)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/auth/login", sessionMW(http.HandlerFunc(authHandler.Login)))
+	mux.Handle("/api/auth/me", sessionMW(authMW(http.HandlerFunc(authHandler.GetCurrentUser))))
+	mux.Handle("/api/auth/change-password", sessionMW(authMW(http.HandlerFunc(authHandler.ChangePassword))))
+	mux.Handle("GET /api/auth/sessions", sessionMW(authMW(http.HandlerFunc(sessionHandler.ListSessions))))
+	mux.Handle("DELETE /api/auth/sessions", sessionMW(authMW(http.HandlerFunc(sessionHandler.RevokeSession))))
+	mux.Handle("POST /api/auth/sessions/logout-others", sessionMW(authMW(http.HandlerFunc(sessionHandler.RevokeOtherSessions))))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	do := func(client *http.Client, method, path, userAgent string, body any) (int, json.RawMessage) {
+		t.Helper()
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		if userAgent != "" {
+			req.Header.Set("User-Agent", userAgent)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var envelope struct {
+			Data json.RawMessage `json:"data"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&envelope)
+		return resp.StatusCode, envelope.Data
+	}
+	login := func(userAgent, password string) *http.Client {
+		t.Helper()
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+		if status, _ := do(client, http.MethodPost, "/api/auth/login", userAgent, LoginRequest{Username: "roamer", Password: password}); status != http.StatusOK {
+			t.Fatalf("Failed to log in: %d", status)
+		}
+		return client
+	}
+
+	const firefox = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	const phone = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+	laptop := login(firefox, "correct-horse-battery")
+	mobile := login(phone, "correct-horse-battery")
+	tablet := login("", "correct-horse-battery")
+
+	status, data := do(laptop, http.MethodGet, "/api/auth/sessions", firefox, nil)
+	var sessions []SessionResponse
+	if err := json.Unmarshal(data, &sessions); status != http.StatusOK || err != nil || len(sessions) != 3 {
+		t.Fatalf("Expected three sessions, got %d %s", status, data)
+	}
+	var current *SessionResponse
+	for i := range sessions {
+		if sessions[i].Current {
+			if current != nil {
+				t.Fatalf("Expected one current session, got %+v", sessions)
+			}
+			current = &sessions[i]
+		}
+	}
+	if current == nil || current.Device != "Firefox on Linux" || current.IPAddress == "" {
+		t.Errorf("Expected the current session to be the laptop, got %+v", current)
+	}
+
+	// Revoking a single session logs that device out
+	var tabletID string
+	for _, session := range sessions {
+		if session.Device == "Unknown device" {
+			tabletID = session.ID
+		}
+	}
+	if tabletID == "" {
+		t.Fatalf("Expected to find the tablet's session in %+v", sessions)
+	}
+	if status, _ := do(mobile, http.MethodDelete, "/api/auth/sessions?id="+tabletID, phone, nil); status != http.StatusNoContent {
+		t.Fatalf("Failed to revoke session: %d", status)
+	}
+	if status, _ := do(tablet, http.MethodGet, "/api/auth/me", "", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected revoked session to be logged out, got %d", status)
+	}
+	if status, _ := do(mobile, http.MethodDelete, "/api/auth/sessions?id=not-a-session", phone, nil); status != http.StatusNotFound {
+		t.Errorf("Expected 404 for an unknown session, got %d", status)
+	}
+
+	// Logging out other sessions keeps the current one
+	if status, _ := do(laptop, http.MethodPost, "/api/auth/sessions/logout-others", firefox, nil); status != http.StatusOK {
+		t.Fatalf("Failed to log out other sessions: %d", status)
+	}
+	if status, _ := do(mobile, http.MethodGet, "/api/auth/me", phone, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected other session to be logged out, got %d", status)
+	}
+	if status, _ := do(laptop, http.MethodGet, "/api/auth/me", firefox, nil); status != http.StatusOK {
+		t.Errorf("Expected current session to stay logged in, got %d", status)
+	}
+
+	// Changing the password logs out everywhere else, but not here
+	mobile = login(phone, "correct-horse-battery")
+	status, _ = do(laptop, http.MethodPost, "/api/auth/change-password", firefox, ChangePasswordRequest{
+		CurrentPassword: "correct-horse-battery",
+		NewPassword:     "battery-staple-horse",
+	})
+	if status != http.StatusOK {
+		t.Fatalf("Failed to change password: %d", status)
+	}
+	if status, _ := do(mobile, http.MethodGet, "/api/auth/me", phone, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected sessions to be revoked after a password change, got %d", status)
+	}
+	if status, _ := do(laptop, http.MethodGet, "/api/auth/me", firefox, nil); status != http.StatusOK {
+		t.Errorf("Expected to stay logged in after changing password, got %d", status)
+	}
+}
+
+func TestDescribeDevice(t *testing.T) {
+	tests := []struct {
+		userAgent string
+		want      string
+	}{
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0", "Edge on Windows"},
+		{"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15", "Safari on macOS"},
+		{"Mozilla/5.0 (Linux; Android 14) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Mobile Safari/537.36", "Chrome on Android"},
+		{"curl/8.8.0", "curl"},
+		{"", "Unknown device"},
+	}
+
+	for _, tt := range tests {
+		if got := describeDevice(tt.userAgent); got != tt.want {
+			t.Errorf("describeDevice(%q) = %q, want %q", tt.userAgent, got, tt.want)
+		}
+	}
+}
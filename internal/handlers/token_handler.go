@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/validation"
+)
+
+// TokenHandler handles HTTP requests for managing a user's personal API tokens
+type TokenHandler struct {
+	tokens *services.TokenService
+	logger *slog.Logger
+}
+
+// NewTokenHandler creates a new API token handler
+func NewTokenHandler(tokens *services.TokenService) *TokenHandler {
+	return &TokenHandler{
+		tokens: tokens,
+		logger: slog.Default(),
+	}
+}
+
+// CreateTokenRequest represents the request body for creating an API token
+type CreateTokenRequest struct {
+	Name      string              `json:"name"`
+	Scopes    []models.Permission `json:"scopes"`
+	ExpiresAt *time.Time          `json:"expires_at"` // Omit for a token that does not expire
+}
+
+// Validate validates the create token request
+func (r *CreateTokenRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Name = validation.SanitizeString(r.Name)
+
+	validator.ValidateRequired("name", r.Name)
+	validator.ValidateLength("name", r.Name, 1, 100)
+	validator.ValidateNoHTML("name", r.Name)
+
+	if len(r.Scopes) == 0 {
+		validator.AddError("scopes", "at least one scope is required")
+	}
+	for _, scope := range r.Scopes {
+		if !scope.IsValid() {
+			validator.AddError("scopes", "unknown scope: "+validation.SanitizeLogString(string(scope)))
+		}
+	}
+
+	if r.ExpiresAt != nil && !r.ExpiresAt.After(time.Now()) {
+		validator.AddError("expires_at", "must be in the future")
+	}
+
+	return validator.Errors()
+}
+
+// CreateTokenResponse is a newly created API token with its secret, which is
+// only ever returned here
+type CreateTokenResponse struct {
+	*models.APIToken
+	Token string `json:"token"`
+}
+
+// ListTokens handles GET /api/auth/tokens
+func (h *TokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	tokens, err := h.tokens.ListTokens(r.Context(), user.ID)
+	if err != nil {
+		h.logger.Error("failed to list API tokens", "error", err, "user_id", user.ID)
+		response.WriteInternalError(w, "Failed to list API tokens", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, tokens, "")
+}
+
+// CreateToken handles POST /api/auth/tokens
+func (h *TokenHandler) CreateToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return
+	}
+
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return
+	}
+
+	token, secret, err := h.tokens.CreateToken(r.Context(), user, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, services.ErrTokenScopeNotGranted) {
+			response.WriteForbiddenError(w, "You cannot create a token with permissions you do not have")
+			return
+		}
+		response.WriteInternalError(w, "Failed to create API token", err.Error())
+		return
+	}
+
+	response.WriteCreatedResponse(w, CreateTokenResponse{APIToken: token, Token: secret}, "API token created. Copy it now, it will not be shown again.")
+}
+
+// RevokeToken handles DELETE /api/auth/tokens?id=
+func (h *TokenHandler) RevokeToken(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		response.WriteBadRequestError(w, "Token ID is required", "")
+		return
+	}
+
+	if err := h.tokens.RevokeToken(r.Context(), user.ID, id); err != nil {
+		if errors.Is(err, services.ErrTokenNotFound) {
+			response.WriteNotFoundError(w, "API token not found")
+			return
+		}
+		h.logger.Error("failed to revoke API token", "error", err, "user_id", user.ID)
+		response.WriteInternalError(w, "Failed to revoke API token", err.Error())
+		return
+	}
+
+	response.WriteNoContentResponse(w)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+func TestAPITokens(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	user := models.NewUser("scripter", nil)
+	user.ID = "scripter-id"
+	if err := user.SetPassword("correct-horse-battery"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{Host: "localhost", Port: "8080"},
+		Auth: config.AuthConfig{
+			Enabled:        true,
+			SessionSecret:  "test-session-secret-that-is-long-enough",
+			SessionTimeout: time.Hour,
+		},
+	}
+	sessionStore := middleware.NewSessionStore(cfg, db)
+	authHandler := NewAuthHandler(services.NewUserService(db), services.NewTwoFactorService(db, cfg.Auth.LocalAuth.TOTP), sessionStore, cfg)
+	tokenHandler := NewTokenHandler(services.NewTokenService(db))
+	sessionMW := sessionStore.SessionMiddleware()
+	authMW := sessionStore.AuthMiddleware(cfg)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/auth/login", sessionMW(http.HandlerFunc(authHandler.Login)))
+	mux.Handle("/api/auth/me", sessionMW(authMW(http.HandlerFunc(authHandler.GetCurrentUser))))
+	mux.Handle("GET /api/auth/tokens", sessionMW(authMW(http.HandlerFunc(tokenHandler.ListTokens))))
+	mux.Handle("POST /api/auth/tokens", sessionMW(authMW(http.HandlerFunc(tokenHandler.CreateToken))))
+	mux.Handle("DELETE /api/auth/tokens", sessionMW(authMW(http.HandlerFunc(tokenHandler.RevokeToken))))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	jar, _ := cookiejar.New(nil)
+	browser := &http.Client{Jar: jar}
+	script := &http.Client{}
+
+	do := func(client *http.Client, method, path, bearer string, body any) (int, json.RawMessage) {
+		t.Helper()
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var envelope struct {
+			Data json.RawMessage `json:"data"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&envelope)
+		return resp.StatusCode, envelope.Data
+	}
+
+	if status, _ := do(browser, http.MethodPost, "/api/auth/login", "", LoginRequest{Username: "scripter", Password: "correct-horse-battery"}); status != http.StatusOK {
+		t.Fatalf("Failed to log in: %d", status)
+	}
+
+	// Tokens cannot have permissions the user does not have
+	status, _ := do(browser, http.MethodPost, "/api/auth/tokens", "", CreateTokenRequest{Name: "too much", Scopes: []models.Permission{models.PermissionManageUsers}})
+	if status != http.StatusForbidden {
+		t.Errorf("Expected 403 for an ungranted scope, got %d", status)
+	}
+
+	status, data := do(browser, http.MethodPost, "/api/auth/tokens", "", CreateTokenRequest{Name: "slicer", Scopes: []models.Permission{models.PermissionCreatePrintRequests}})
+	if status != http.StatusCreated {
+		t.Fatalf("Failed to create token: %d", status)
+	}
+	var created struct {
+		ID    string `json:"id"`
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(data, &created); err != nil || created.Token == "" {
+		t.Fatalf("Expected the token in the response, got %s", data)
+	}
+
+	// The token authenticates as the user, limited to its scopes
+	status, data = do(script, http.MethodGet, "/api/auth/me", created.Token, nil)
+	if status != http.StatusOK {
+		t.Fatalf("Expected token to authenticate, got %d", status)
+	}
+	var me UserResponse
+	if err := json.Unmarshal(data, &me); err != nil {
+		t.Fatalf("Failed to decode current user: %v", err)
+	}
+	if me.ID != user.ID || !slices.Equal(me.Permissions, []models.Permission{models.PermissionCreatePrintRequests}) {
+		t.Errorf("Expected scoped permissions, got %+v", me)
+	}
+
+	// Tokens cannot be used to manage tokens
+	if status, _ := do(script, http.MethodPost, "/api/auth/tokens", created.Token, CreateTokenRequest{Name: "more", Scopes: []models.Permission{models.PermissionCreatePrintRequests}}); status != http.StatusForbidden {
+		t.Errorf("Expected 403 when creating a token with a token, got %d", status)
+	}
+
+	// A bad token is refused even alongside a valid session cookie
+	if status, _ := do(browser, http.MethodGet, "/api/auth/me", "pdis_not-a-real-token", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for an unknown token, got %d", status)
+	}
+
+	status, data = do(browser, http.MethodGet, "/api/auth/tokens", "", nil)
+	var tokens []models.APIToken
+	if err := json.Unmarshal(data, &tokens); status != http.StatusOK || err != nil || len(tokens) != 1 {
+		t.Fatalf("Expected one token, got %d %s", status, data)
+	}
+	if tokens[0].LastUsedAt == nil {
+		t.Error("Expected the token's last use to be recorded")
+	}
+	if bytes.Contains(data, []byte(created.Token)) {
+		t.Error("Token secret must not be listed")
+	}
+
+	if status, _ := do(browser, http.MethodDelete, "/api/auth/tokens?id="+created.ID, "", nil); status != http.StatusNoContent {
+		t.Fatalf("Failed to revoke token: %d", status)
+	}
+	if status, _ := do(script, http.MethodGet, "/api/auth/me", created.Token, nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected revoked token to be refused, got %d", status)
+	}
+}
+
+func TestExpiredAPIToken(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+	tokens := services.NewTokenService(db)
+
+	user := models.NewUser("expired", nil)
+	user.ID = "expired-id"
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	token, secret, err := tokens.CreateToken(ctx, user, "short-lived", []models.Permission{models.PermissionViewOwnPrintRequests}, &expiresAt)
+	if err != nil {
+		t.Fatalf("Failed to create token: %v", err)
+	}
+	if got, err := tokens.Authenticate(ctx, secret); err != nil || got == nil || got.ID != token.ID {
+		t.Fatalf("Expected token to authenticate, got %+v, %v", got, err)
+	}
+
+	// Expire the token by recreating it with a past expiry
+	past := time.Now().Add(-time.Minute)
+	token.ExpiresAt = &past
+	if err := db.DeleteAPIToken(ctx, token.ID); err != nil {
+		t.Fatalf("Failed to delete token: %v", err)
+	}
+	if err := db.CreateAPIToken(ctx, token); err != nil {
+		t.Fatalf("Failed to recreate token: %v", err)
+	}
+	if got, err := tokens.Authenticate(ctx, secret); err != nil || got != nil {
+		t.Errorf("Expected expired token to be refused, got %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/validation"
+)
+
+// TwoFactorHandler handles HTTP requests for setting up two-factor
+// authentication with an authenticator app
+type TwoFactorHandler struct {
+	twoFactor   *services.TwoFactorService
+	userService *services.UserService
+	logger      *slog.Logger
+}
+
+// NewTwoFactorHandler creates a new two-factor authentication handler
+func NewTwoFactorHandler(twoFactor *services.TwoFactorService, userService *services.UserService) *TwoFactorHandler {
+	return &TwoFactorHandler{
+		twoFactor:   twoFactor,
+		userService: userService,
+		logger:      slog.Default(),
+	}
+}
+
+// TwoFactorCodeRequest represents a request confirmed with a code from the
+// user's authenticator app
+type TwoFactorCodeRequest struct {
+	Code string `json:"code"`
+}
+
+// Validate validates the two-factor code request
+func (r *TwoFactorCodeRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Code = validation.SanitizeString(r.Code)
+
+	validator.ValidateRequired("code", r.Code)
+	validator.ValidateLength("code", r.Code, 1, 10)
+
+	return validator.Errors()
+}
+
+// DisableTwoFactorRequest represents a request to turn off two-factor
+// authentication, confirmed with the user's password
+type DisableTwoFactorRequest struct {
+	Password string `json:"password"`
+}
+
+// Validate validates the disable two-factor request
+func (r *DisableTwoFactorRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	validator.ValidateRequired("password", r.Password)
+	validator.ValidateLength("password", r.Password, 1, 500)
+
+	return validator.Errors()
+}
+
+// RecoveryCodesResponse lists newly generated recovery codes, which are only
+// ever returned here
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// GetStatus handles GET /api/auth/2fa
+func (h *TwoFactorHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.localUser(w, r)
+	if !ok {
+		return
+	}
+
+	status, err := h.twoFactor.Status(r.Context(), user)
+	if err != nil {
+		h.logger.Error("failed to get two-factor status", "error", err, "user_id", user.ID)
+		response.WriteInternalError(w, "Failed to get two-factor status", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, status, "")
+}
+
+// Enroll handles POST /api/auth/2fa/enroll
+func (h *TwoFactorHandler) Enroll(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.localUser(w, r)
+	if !ok {
+		return
+	}
+
+	enrolment, err := h.twoFactor.BeginEnrolment(r.Context(), user)
+	if err != nil {
+		if errors.Is(err, services.ErrTwoFactorAlreadyEnabled) {
+			response.WriteConflictError(w, "Two-factor authentication is already enabled", "")
+			return
+		}
+		h.logger.Error("failed to begin two-factor enrolment", "error", err, "user_id", user.ID)
+		response.WriteInternalError(w, "Failed to set up two-factor authentication", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, enrolment, "Add this to your authenticator app, then confirm with a code from it")
+}
+
+// Confirm handles POST /api/auth/2fa/confirm
+func (h *TwoFactorHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.localUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	codes, err := h.twoFactor.ConfirmEnrolment(r.Context(), user.ID, req.Code)
+	if err != nil {
+		h.writeError(w, err, user.ID)
+		return
+	}
+
+	response.WriteSuccessResponse(w, RecoveryCodesResponse{RecoveryCodes: codes}, "Two-factor authentication enabled. Store these recovery codes somewhere safe, they will not be shown again.")
+}
+
+// RegenerateRecoveryCodes handles POST /api/auth/2fa/recovery-codes
+func (h *TwoFactorHandler) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.localUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req TwoFactorCodeRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	codes, err := h.twoFactor.RegenerateRecoveryCodes(r.Context(), user.ID, req.Code)
+	if err != nil {
+		h.writeError(w, err, user.ID)
+		return
+	}
+
+	response.WriteSuccessResponse(w, RecoveryCodesResponse{RecoveryCodes: codes}, "New recovery codes generated. The old ones no longer work.")
+}
+
+// Disable handles POST /api/auth/2fa/disable
+func (h *TwoFactorHandler) Disable(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.localUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req DisableTwoFactorRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	if !user.CheckPassword(req.Password) {
+		response.WriteBadRequestError(w, "Password is incorrect", "")
+		return
+	}
+
+	if err := h.twoFactor.Disable(r.Context(), user); err != nil {
+		h.writeError(w, err, user.ID)
+		return
+	}
+
+	response.WriteSuccessResponse(w, nil, "Two-factor authentication disabled")
+}
+
+// ResetUser handles DELETE /api/admin/users/2fa?id=, for users who have lost
+// their authenticator app and recovery codes
+func (h *TwoFactorHandler) ResetUser(w http.ResponseWriter, r *http.Request) {
+	userID := r.URL.Query().Get("id")
+	if userID == "" {
+		response.WriteBadRequestError(w, "User ID is required", "")
+		return
+	}
+
+	targetUser, err := h.userService.GetUser(r.Context(), userID)
+	if err != nil || targetUser == nil {
+		response.WriteNotFoundError(w, "User not found")
+		return
+	}
+
+	// Check if current user can manage the target user
+	if currentUser := middleware.GetUser(r); currentUser != nil && !currentUser.CanManageUser(targetUser) {
+		response.WriteForbiddenError(w, "Cannot manage this user")
+		return
+	}
+
+	if err := h.twoFactor.Reset(r.Context(), targetUser.ID); err != nil {
+		h.logger.Error("failed to reset two-factor authentication", "error", err, "user_id", targetUser.ID)
+		response.WriteInternalError(w, "Failed to reset two-factor authentication", err.Error())
+		return
+	}
+
+	h.logger.Info("admin reset two-factor authentication", "user_id", targetUser.ID, "admin_id", middleware.GetUserID(r))
+	response.WriteNoContentResponse(w)
+}
+
+// writeError writes the response for a two-factor service error
+func (h *TwoFactorHandler) writeError(w http.ResponseWriter, err error, userID string) {
+	switch {
+	case errors.Is(err, services.ErrInvalidTwoFactorCode):
+		response.WriteBadRequestError(w, "Invalid code", "")
+	case errors.Is(err, services.ErrTwoFactorNotEnabled):
+		response.WriteBadRequestError(w, "Two-factor authentication is not set up", "")
+	case errors.Is(err, services.ErrTwoFactorAlreadyEnabled):
+		response.WriteConflictError(w, "Two-factor authentication is already enabled", "")
+	case errors.Is(err, services.ErrTwoFactorRequired):
+		response.WriteForbiddenError(w, "Two-factor authentication is required for your role")
+	default:
+		h.logger.Error("two-factor authentication failed", "error", err, "user_id", userID)
+		response.WriteInternalError(w, "Two-factor authentication failed", err.Error())
+	}
+}
+
+// localUser returns the current user, refusing API tokens and accounts
+// without a password, which log in elsewhere
+func (h *TwoFactorHandler) localUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return nil, false
+	}
+	if !user.HasPassword() {
+		response.WriteBadRequestError(w, "Two-factor authentication is only available for accounts with a password", "")
+		return nil, false
+	}
+	return user, true
+}
+
+// decodeAndValidate decodes a JSON request body and validates it, writing the
+// error response if either fails
+func decodeAndValidate(w http.ResponseWriter, r *http.Request, req interface {
+	Validate() validation.ValidationErrors
+}) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		response.WriteBadRequestError(w, "Invalid request body", err.Error())
+		return false
+	}
+	if validationErrors := req.Validate(); len(validationErrors) > 0 {
+		validation.WriteValidationError(w, validationErrors)
+		return false
+	}
+	return true
+}
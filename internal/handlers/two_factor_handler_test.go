@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/totp"
+)
+
+func TestTwoFactorLogin(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	admin := models.NewUser("careful", nil)
+	admin.ID = "careful-id"
+	admin.Role = models.RoleAdmin
+	if err := admin.SetPassword("correct-horse-battery"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := db.CreateUser(ctx, admin); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{Host: "localhost", Port: "8080"},
+		Auth: config.AuthConfig{
+			Enabled:        true,
+			SessionSecret:  "test-session-secret-that-is-long-enough",
+			SessionTimeout: time.Hour,
+			LocalAuth: config.LocalAuthConfig{
+				Enabled: true,
+				TOTP:    config.TOTPConfig{Issuer: "print-dis", RequiredRoles: []string{"admin"}},
+			},
+		},
+	}
+	userService := services.NewUserService(db)
+	twoFactor := services.NewTwoFactorService(db, cfg.Auth.LocalAuth.TOTP)
+	sessionStore := middleware.NewSessionStore(cfg, db)
+	authHandler := NewAuthHandler(userService, twoFactor, sessionStore, cfg)
+	twoFactorHandler := NewTwoFactorHandler(twoFactor, userService)
+	sessionMW := sessionStore.SessionMiddleware()
+	authMW := sessionStore.AuthMiddleware(cfg)
+
+	mux := http.NewServeMux()
+	mux.Handle("/api/auth/login", sessionMW(http.HandlerFunc(authHandler.Login)))
+	mux.Handle("/api/auth/login/2fa", sessionMW(http.HandlerFunc(authHandler.LoginTwoFactor)))
+	mux.Handle("/api/auth/me", sessionMW(authMW(http.HandlerFunc(authHandler.GetCurrentUser))))
+	mux.Handle("/api/auth/2fa/enroll", sessionMW(authMW(http.HandlerFunc(twoFactorHandler.Enroll))))
+	mux.Handle("/api/auth/2fa/confirm", sessionMW(authMW(http.HandlerFunc(twoFactorHandler.Confirm))))
+	mux.Handle("/api/auth/2fa/disable", sessionMW(authMW(http.HandlerFunc(twoFactorHandler.Disable))))
+	mux.Handle("/api/protected", sessionMW(authMW(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	do := func(client *http.Client, method, path string, body any) (int, json.RawMessage) {
+		t.Helper()
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var envelope struct {
+			Data json.RawMessage `json:"data"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&envelope)
+		return resp.StatusCode, envelope.Data
+	}
+	login := func() (*http.Client, json.RawMessage) {
+		t.Helper()
+		jar, _ := cookiejar.New(nil)
+		client := &http.Client{Jar: jar}
+		status, data := do(client, http.MethodPost, "/api/auth/login", LoginRequest{Username: "careful", Password: "correct-horse-battery"})
+		if status != http.StatusOK {
+			t.Fatalf("Failed to log in: %d", status)
+		}
+		return client, data
+	}
+
+	// Admins must set up two-factor authentication before doing anything else
+	browser, _ := login()
+	if status, _ := do(browser, http.MethodGet, "/api/protected", nil); status != http.StatusForbidden {
+		t.Errorf("Expected 403 before two-factor setup, got %d", status)
+	}
+	status, data := do(browser, http.MethodGet, "/api/auth/me", nil)
+	var me UserResponse
+	if err := json.Unmarshal(data, &me); status != http.StatusOK || err != nil {
+		t.Fatalf("Expected current user, got %d %s", status, data)
+	}
+	if me.TwoFactor == nil || !me.TwoFactor.Required || me.TwoFactor.Enabled {
+		t.Errorf("Expected two-factor setup to be required, got %+v", me.TwoFactor)
+	}
+
+	status, data = do(browser, http.MethodPost, "/api/auth/2fa/enroll", nil)
+	var enrolment services.TOTPEnrolment
+	if err := json.Unmarshal(data, &enrolment); status != http.StatusOK || err != nil {
+		t.Fatalf("Failed to enrol: %d %s", status, data)
+	}
+	if !strings.HasPrefix(enrolment.URI, "otpauth://totp/") || !strings.HasPrefix(enrolment.QRCode, "data:image/png;base64,") {
+		t.Errorf("Unexpected enrolment %+v", enrolment)
+	}
+
+	if status, _ := do(browser, http.MethodPost, "/api/auth/2fa/confirm", TwoFactorCodeRequest{Code: "000000"}); status != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a wrong code, got %d", status)
+	}
+	code, _ := totp.Code(enrolment.Secret, time.Now())
+	status, data = do(browser, http.MethodPost, "/api/auth/2fa/confirm", TwoFactorCodeRequest{Code: code})
+	var recovery RecoveryCodesResponse
+	if err := json.Unmarshal(data, &recovery); status != http.StatusOK || err != nil || len(recovery.RecoveryCodes) != 10 {
+		t.Fatalf("Failed to confirm enrolment: %d %s", status, data)
+	}
+	if status, _ := do(browser, http.MethodGet, "/api/protected", nil); status != http.StatusOK {
+		t.Errorf("Expected access after two-factor setup, got %d", status)
+	}
+
+	// Logging in now needs a code as well as the password
+	phone, data := login()
+	var challenge TwoFactorChallengeResponse
+	if err := json.Unmarshal(data, &challenge); err != nil || !challenge.TwoFactorRequired {
+		t.Fatalf("Expected a two-factor challenge, got %s", data)
+	}
+	if status, _ := do(phone, http.MethodGet, "/api/auth/me", nil); status != http.StatusUnauthorized {
+		t.Errorf("Expected partial session to be unauthenticated, got %d", status)
+	}
+	if status, _ := do(phone, http.MethodPost, "/api/auth/login/2fa", TwoFactorLoginRequest{Code: "000000"}); status != http.StatusUnauthorized {
+		t.Errorf("Expected 401 for a wrong code, got %d", status)
+	}
+	// The code used to confirm enrolment cannot be used again, so use the next
+	// one, which is accepted for clock drift
+	next, _ := totp.Code(enrolment.Secret, time.Now().Add(totp.Period))
+	if status, _ := do(phone, http.MethodPost, "/api/auth/login/2fa", TwoFactorLoginRequest{Code: next}); status != http.StatusOK {
+		t.Fatalf("Expected two-factor login to succeed, got %d", status)
+	}
+	if status, _ := do(phone, http.MethodGet, "/api/auth/me", nil); status != http.StatusOK {
+		t.Errorf("Expected to be logged in, got %d", status)
+	}
+
+	// Codes and recovery codes work once
+	laptop, _ := login()
+	if status, _ := do(laptop, http.MethodPost, "/api/auth/login/2fa", TwoFactorLoginRequest{Code: next}); status != http.StatusUnauthorized {
+		t.Errorf("Expected a reused code to be refused, got %d", status)
+	}
+	if status, _ := do(laptop, http.MethodPost, "/api/auth/login/2fa", TwoFactorLoginRequest{RecoveryCode: recovery.RecoveryCodes[0]}); status != http.StatusOK {
+		t.Fatalf("Expected recovery code to log in, got %d", status)
+	}
+	tablet, _ := login()
+	if status, _ := do(tablet, http.MethodPost, "/api/auth/login/2fa", TwoFactorLoginRequest{RecoveryCode: recovery.RecoveryCodes[0]}); status != http.StatusUnauthorized {
+		t.Errorf("Expected a used recovery code to be refused, got %d", status)
+	}
+
+	// Too many wrong codes and the password has to be entered again
+	for i := 0; i < 4; i++ {
+		do(tablet, http.MethodPost, "/api/auth/login/2fa", TwoFactorLoginRequest{Code: "000000"})
+	}
+	if status, _ := do(tablet, http.MethodPost, "/api/auth/login/2fa", TwoFactorLoginRequest{RecoveryCode: recovery.RecoveryCodes[1]}); status != http.StatusUnauthorized {
+		t.Errorf("Expected partial login to end after too many attempts, got %d", status)
+	}
+
+	// Admins cannot turn it off, as their role requires it
+	if status, _ := do(phone, http.MethodPost, "/api/auth/2fa/disable", DisableTwoFactorRequest{Password: "correct-horse-battery"}); status != http.StatusForbidden {
+		t.Errorf("Expected 403 when disabling required two-factor, got %d", status)
+	}
+}
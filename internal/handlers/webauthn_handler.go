@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/response"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/validation"
+	"github.com/bjschafer/print-dis/internal/webauthn"
+)
+
+// Session values that carry a WebAuthn challenge from the options sent to the
+// browser to the credential it sends back
+const (
+	webAuthnRegistrationKey = "webauthn_registration_challenge"
+	webAuthnLoginKey        = "webauthn_login_challenge"
+)
+
+// WebAuthnHandler handles HTTP requests for managing a user's security keys
+// and passkeys
+type WebAuthnHandler struct {
+	webAuthn *services.WebAuthnService
+	logger   *slog.Logger
+}
+
+// NewWebAuthnHandler creates a new WebAuthn handler
+func NewWebAuthnHandler(webAuthn *services.WebAuthnService) *WebAuthnHandler {
+	return &WebAuthnHandler{
+		webAuthn: webAuthn,
+		logger:   slog.Default(),
+	}
+}
+
+// RegisterWebAuthnRequest represents a new credential created by the browser
+type RegisterWebAuthnRequest struct {
+	Name       string                        `json:"name"` // e.g. "YubiKey"
+	Credential webauthn.RegistrationResponse `json:"credential"`
+}
+
+// Validate validates the register credential request
+func (r *RegisterWebAuthnRequest) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Name = validation.SanitizeString(r.Name)
+
+	validator.ValidateLength("name", r.Name, 0, 100)
+
+	return validator.Errors()
+}
+
+// ListCredentials handles GET /api/auth/webauthn/credentials
+func (h *WebAuthnHandler) ListCredentials(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	credentials, err := h.webAuthn.ListCredentials(r.Context(), user.ID)
+	if err != nil {
+		h.logger.Error("failed to list WebAuthn credentials", "error", err, "user_id", user.ID)
+		response.WriteInternalError(w, "Failed to list passkeys", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, credentials, "")
+}
+
+// BeginRegistration handles POST /api/auth/webauthn/register/options, which
+// returns the options to pass to navigator.credentials.create()
+func (h *WebAuthnHandler) BeginRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	options, err := h.webAuthn.BeginRegistration(r.Context(), user)
+	if err != nil {
+		h.logger.Error("failed to begin WebAuthn registration", "error", err, "user_id", user.ID)
+		response.WriteInternalError(w, "Failed to register passkey", err.Error())
+		return
+	}
+	if err := saveChallenge(w, r, webAuthnRegistrationKey, options.Challenge); err != nil {
+		h.logger.Error("failed to save session", "error", err)
+		response.WriteInternalError(w, "Failed to register passkey", err.Error())
+		return
+	}
+
+	response.WriteSuccessResponse(w, options, "")
+}
+
+// FinishRegistration handles POST /api/auth/webauthn/credentials with the
+// credential created by the browser
+func (h *WebAuthnHandler) FinishRegistration(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	var req RegisterWebAuthnRequest
+	if !decodeAndValidate(w, r, &req) {
+		return
+	}
+
+	challenge := takeChallenge(w, r, webAuthnRegistrationKey)
+	if challenge == nil {
+		response.WriteBadRequestError(w, "Start registering the passkey again", "")
+		return
+	}
+
+	credential, err := h.webAuthn.FinishRegistration(r.Context(), user.ID, req.Name, challenge, &req.Credential)
+	if err != nil {
+		switch {
+		case errors.Is(err, webauthn.ErrInvalidResponse):
+			h.logger.Info("WebAuthn registration failed", "error", err, "user_id", user.ID)
+			response.WriteBadRequestError(w, "Passkey could not be verified", err.Error())
+		case errors.Is(err, services.ErrWebAuthnCredentialExists):
+			response.WriteConflictError(w, "This passkey is already registered", "")
+		default:
+			h.logger.Error("failed to register WebAuthn credential", "error", err, "user_id", user.ID)
+			response.WriteInternalError(w, "Failed to register passkey", err.Error())
+		}
+		return
+	}
+
+	response.WriteCreatedResponse(w, credential, "Passkey registered")
+}
+
+// DeleteCredential handles DELETE /api/auth/webauthn/credentials?id=
+func (h *WebAuthnHandler) DeleteCredential(w http.ResponseWriter, r *http.Request) {
+	user, ok := sessionUser(w, r)
+	if !ok {
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		response.WriteBadRequestError(w, "Passkey ID is required", "")
+		return
+	}
+
+	if err := h.webAuthn.DeleteCredential(r.Context(), user.ID, id); err != nil {
+		if errors.Is(err, services.ErrWebAuthnCredentialNotFound) {
+			response.WriteNotFoundError(w, "Passkey not found")
+			return
+		}
+		h.logger.Error("failed to delete WebAuthn credential", "error", err, "user_id", user.ID)
+		response.WriteInternalError(w, "Failed to delete passkey", err.Error())
+		return
+	}
+
+	response.WriteNoContentResponse(w)
+}
+
+// saveChallenge keeps a WebAuthn challenge in the session until the browser
+// responds to it
+func saveChallenge(w http.ResponseWriter, r *http.Request, key string, challenge []byte) error {
+	session := middleware.GetSession(r)
+	if session == nil {
+		return errors.New("session not found")
+	}
+	session.Values[key] = base64.RawURLEncoding.EncodeToString(challenge)
+	return session.Save(r, w)
+}
+
+// takeChallenge removes a WebAuthn challenge from the session, so that it can
+// only be answered once. It returns nil if there is none.
+func takeChallenge(w http.ResponseWriter, r *http.Request, key string) []byte {
+	session := middleware.GetSession(r)
+	if session == nil {
+		return nil
+	}
+	encoded, _ := session.Values[key].(string)
+	if encoded == "" {
+		return nil
+	}
+	delete(session.Values, key)
+	if err := session.Save(r, w); err != nil {
+		slog.Error("failed to save session", "error", err)
+		return nil
+	}
+
+	challenge, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil
+	}
+	return challenge
+}
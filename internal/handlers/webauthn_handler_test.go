@@ -0,0 +1,191 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+	"github.com/bjschafer/print-dis/internal/webauthn"
+	"github.com/bjschafer/print-dis/internal/webauthn/webauthntest"
+)
+
+func TestPasskeyLogin(t *testing.T) {
+	ctx := context.Background()
+	db := newTestDB(t)
+
+	user := models.NewUser("keyholder", nil)
+	user.ID = "keyholder-id"
+	if err := user.SetPassword("correct-horse-battery"); err != nil {
+		t.Fatalf("Failed to set password: %v", err)
+	}
+	if err := db.CreateUser(ctx, user); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Passkeys are bound to the server's own address
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{Host: "localhost", Port: "8080"},
+		Auth: config.AuthConfig{
+			Enabled:        true,
+			SessionSecret:  "test-session-secret-that-is-long-enough",
+			SessionTimeout: time.Hour,
+			LocalAuth:      config.LocalAuthConfig{Enabled: true},
+			WebAuthn:       config.WebAuthnConfig{Enabled: true, RPName: "print-dis", RPID: "127.0.0.1", Origins: []string{server.URL}},
+		},
+	}
+	userService := services.NewUserService(db)
+	webAuthnService := services.NewWebAuthnService(db, cfg.Auth.WebAuthn)
+	sessionStore := middleware.NewSessionStore(cfg, db)
+	authHandler := NewAuthHandler(userService, services.NewTwoFactorService(db, cfg.Auth.LocalAuth.TOTP), sessionStore, cfg)
+	authHandler.SetWebAuthn(webAuthnService)
+	webAuthnHandler := NewWebAuthnHandler(webAuthnService)
+	sessionMW := sessionStore.SessionMiddleware()
+	authMW := sessionStore.AuthMiddleware(cfg)
+
+	mux.Handle("/api/auth/login", sessionMW(http.HandlerFunc(authHandler.Login)))
+	mux.Handle("/api/auth/login/passkey/options", sessionMW(http.HandlerFunc(authHandler.BeginPasskeyLogin)))
+	mux.Handle("/api/auth/login/passkey", sessionMW(http.HandlerFunc(authHandler.LoginPasskey)))
+	mux.Handle("/api/auth/me", sessionMW(authMW(http.HandlerFunc(authHandler.GetCurrentUser))))
+	mux.Handle("/api/auth/webauthn/register/options", sessionMW(authMW(http.HandlerFunc(webAuthnHandler.BeginRegistration))))
+	mux.Handle("POST /api/auth/webauthn/credentials", sessionMW(authMW(http.HandlerFunc(webAuthnHandler.FinishRegistration))))
+	mux.Handle("GET /api/auth/webauthn/credentials", sessionMW(authMW(http.HandlerFunc(webAuthnHandler.ListCredentials))))
+	mux.Handle("DELETE /api/auth/webauthn/credentials", sessionMW(authMW(http.HandlerFunc(webAuthnHandler.DeleteCredential))))
+
+	do := func(client *http.Client, method, path string, body any) (int, json.RawMessage) {
+		t.Helper()
+		var payload []byte
+		if body != nil {
+			payload, _ = json.Marshal(body)
+		}
+		req, _ := http.NewRequest(method, server.URL+path, bytes.NewReader(payload))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s failed: %v", method, path, err)
+		}
+		defer func() { _ = resp.Body.Close() }()
+		var envelope struct {
+			Data json.RawMessage `json:"data"`
+		}
+		_ = json.NewDecoder(resp.Body).Decode(&envelope)
+		return resp.StatusCode, envelope.Data
+	}
+	newClient := func() *http.Client {
+		jar, _ := cookiejar.New(nil)
+		return &http.Client{Jar: jar}
+	}
+	authenticator := webauthntest.NewAuthenticator(server.URL)
+
+	// Register a passkey while logged in with the password
+	browser := newClient()
+	if status, _ := do(browser, http.MethodPost, "/api/auth/login", LoginRequest{Username: "keyholder", Password: "correct-horse-battery"}); status != http.StatusOK {
+		t.Fatalf("Failed to log in: %d", status)
+	}
+
+	// The relying party doesn't follow the Host header
+	req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/auth/webauthn/register/options", nil)
+	req.Host = "attacker.example"
+	for _, cookie := range browser.Jar.Cookies(req.URL) {
+		req.AddCookie(cookie)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to get registration options: %v", err)
+	}
+	var spoofed struct {
+		Data webauthn.CreationOptions `json:"data"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&spoofed)
+	_ = resp.Body.Close()
+	if err != nil || spoofed.Data.RelyingParty.ID != "127.0.0.1" {
+		t.Errorf("Expected the configured relying party, got %+v (%v)", spoofed.Data.RelyingParty, err)
+	}
+
+	status, data := do(browser, http.MethodPost, "/api/auth/webauthn/register/options", nil)
+	var creation webauthn.CreationOptions
+	if err := json.Unmarshal(data, &creation); status != http.StatusOK || err != nil {
+		t.Fatalf("Failed to get registration options: %d %s", status, data)
+	}
+	if creation.RelyingParty.ID != "127.0.0.1" || string(creation.User.ID) != user.ID {
+		t.Errorf("Unexpected registration options %+v", creation)
+	}
+	registration, err := authenticator.Register(&creation)
+	if err != nil {
+		t.Fatalf("Failed to create credential: %v", err)
+	}
+	status, data = do(browser, http.MethodPost, "/api/auth/webauthn/credentials", RegisterWebAuthnRequest{Name: "YubiKey", Credential: *registration})
+	var credential models.WebAuthnCredential
+	if err := json.Unmarshal(data, &credential); status != http.StatusCreated || err != nil {
+		t.Fatalf("Failed to register credential: %d %s", status, data)
+	}
+	// Each challenge can only be answered once
+	if status, _ := do(browser, http.MethodPost, "/api/auth/webauthn/credentials", RegisterWebAuthnRequest{Credential: *registration}); status != http.StatusBadRequest {
+		t.Errorf("Expected reused registration to be refused, got %d", status)
+	}
+
+	status, data = do(browser, http.MethodGet, "/api/auth/webauthn/credentials", nil)
+	var credentials []models.WebAuthnCredential
+	if err := json.Unmarshal(data, &credentials); status != http.StatusOK || err != nil || len(credentials) != 1 || credentials[0].Name != "YubiKey" {
+		t.Fatalf("Expected the registered credential, got %d %s", status, data)
+	}
+
+	// Log in on another device with the passkey alone
+	login := func(client *http.Client) (*webauthn.AssertionResponse, int) {
+		t.Helper()
+		status, data := do(client, http.MethodPost, "/api/auth/login/passkey/options", nil)
+		var request webauthn.RequestOptions
+		if err := json.Unmarshal(data, &request); status != http.StatusOK || err != nil {
+			t.Fatalf("Failed to get login options: %d %s", status, data)
+		}
+		assertion, err := authenticator.Login(&request)
+		if err != nil {
+			t.Fatalf("Failed to sign in with credential: %v", err)
+		}
+		status, _ = do(client, http.MethodPost, "/api/auth/login/passkey", assertion)
+		return assertion, status
+	}
+
+	phone := newClient()
+	if status, _ := do(phone, http.MethodPost, "/api/auth/login/passkey", webauthn.AssertionResponse{}); status != http.StatusUnauthorized {
+		t.Errorf("Expected login without a challenge to be refused, got %d", status)
+	}
+	assertion, status := login(phone)
+	if status != http.StatusOK {
+		t.Fatalf("Expected passkey login to succeed, got %d", status)
+	}
+	status, data = do(phone, http.MethodGet, "/api/auth/me", nil)
+	var me UserResponse
+	if err := json.Unmarshal(data, &me); status != http.StatusOK || err != nil || me.ID != user.ID {
+		t.Errorf("Expected to be logged in as %s, got %d %s", user.ID, status, data)
+	}
+
+	// A captured login cannot be replayed against a new challenge
+	laptop := newClient()
+	if status, _ := do(laptop, http.MethodPost, "/api/auth/login/passkey/options", nil); status != http.StatusOK {
+		t.Fatalf("Failed to get login options: %d", status)
+	}
+	if status, _ := do(laptop, http.MethodPost, "/api/auth/login/passkey", assertion); status != http.StatusUnauthorized {
+		t.Errorf("Expected replayed login to be refused, got %d", status)
+	}
+
+	// Removed passkeys no longer log in
+	if status, _ := do(browser, http.MethodDelete, "/api/auth/webauthn/credentials?id="+credential.ID, nil); status != http.StatusNoContent {
+		t.Fatalf("Failed to delete credential: %d", status)
+	}
+	if _, status := login(newClient()); status != http.StatusUnauthorized {
+		t.Errorf("Expected deleted passkey to be refused, got %d", status)
+	}
+}
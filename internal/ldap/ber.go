@@ -0,0 +1,262 @@
+package ldap
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// BER classes
+const (
+	ClassUniversal   byte = 0x00
+	ClassApplication byte = 0x40
+	ClassContext     byte = 0x80
+)
+
+// Universal BER tags
+const (
+	TagBoolean     byte = 0x01
+	TagInteger     byte = 0x02
+	TagOctetString byte = 0x04
+	TagNull        byte = 0x05
+	TagEnumerated  byte = 0x0a
+	TagSequence    byte = 0x10
+	TagSet         byte = 0x11
+)
+
+const (
+	// maxPacketSize limits the size of a message read from the network
+	maxPacketSize = 16 << 20
+	// maxPacketDepth limits how deeply constructed elements may be nested
+	maxPacketDepth = 32
+)
+
+// Packet is a BER (X.690) element: either a primitive value or a constructed
+// element with children. Only the subset of BER that LDAP uses is supported:
+// tags below 31 and definite lengths.
+type Packet struct {
+	Class       byte
+	Constructed bool
+	Tag         byte
+	Value       []byte    // Contents of primitive elements
+	Children    []*Packet // Children of constructed elements
+}
+
+// NewConstructed creates a constructed element
+func NewConstructed(class, tag byte, children ...*Packet) *Packet {
+	return &Packet{Class: class, Constructed: true, Tag: tag, Children: children}
+}
+
+// NewSequence creates a universal SEQUENCE
+func NewSequence(children ...*Packet) *Packet {
+	return NewConstructed(ClassUniversal, TagSequence, children...)
+}
+
+// NewPrimitive creates a primitive element
+func NewPrimitive(class, tag byte, value []byte) *Packet {
+	return &Packet{Class: class, Tag: tag, Value: value}
+}
+
+// NewString creates a universal OCTET STRING
+func NewString(s string) *Packet {
+	return NewPrimitive(ClassUniversal, TagOctetString, []byte(s))
+}
+
+// NewInteger creates a primitive integer element, e.g. a universal INTEGER or
+// ENUMERATED
+func NewInteger(class, tag byte, n int64) *Packet {
+	// Minimal two's complement, big-endian
+	var value []byte
+	for {
+		value = append([]byte{byte(n)}, value...)
+		n >>= 8
+		if (n == 0 && value[0]&0x80 == 0) || (n == -1 && value[0]&0x80 != 0) {
+			break
+		}
+	}
+	return NewPrimitive(class, tag, value)
+}
+
+// NewBoolean creates a universal BOOLEAN
+func NewBoolean(b bool) *Packet {
+	if b {
+		return NewPrimitive(ClassUniversal, TagBoolean, []byte{0xff})
+	}
+	return NewPrimitive(ClassUniversal, TagBoolean, []byte{0x00})
+}
+
+// Is checks the element's class and tag
+func (p *Packet) Is(class, tag byte) bool {
+	return p.Class == class && p.Tag == tag
+}
+
+// Text returns the element's contents as a string
+func (p *Packet) Text() string {
+	return string(p.Value)
+}
+
+// Int returns the element's contents as an integer
+func (p *Packet) Int() (int64, error) {
+	if p.Constructed || len(p.Value) == 0 || len(p.Value) > 8 {
+		return 0, errors.New("ber: invalid integer")
+	}
+	n := int64(int8(p.Value[0]))
+	for _, b := range p.Value[1:] {
+		n = n<<8 | int64(b)
+	}
+	return n, nil
+}
+
+// Bool returns the element's contents as a boolean
+func (p *Packet) Bool() (bool, error) {
+	if p.Constructed || len(p.Value) != 1 {
+		return false, errors.New("ber: invalid boolean")
+	}
+	return p.Value[0] != 0, nil
+}
+
+// Bytes encodes the element
+func (p *Packet) Bytes() []byte {
+	contents := p.Value
+	if p.Constructed {
+		contents = nil
+		for _, child := range p.Children {
+			contents = append(contents, child.Bytes()...)
+		}
+	}
+
+	identifier := p.Class | p.Tag
+	if p.Constructed {
+		identifier |= 0x20
+	}
+	out := []byte{identifier}
+	if len(contents) < 0x80 {
+		out = append(out, byte(len(contents)))
+	} else {
+		var length []byte
+		for n := len(contents); n > 0; n >>= 8 {
+			length = append([]byte{byte(n)}, length...)
+		}
+		out = append(out, 0x80|byte(len(length)))
+		out = append(out, length...)
+	}
+	return append(out, contents...)
+}
+
+// ReadPacket reads one element from r
+func ReadPacket(r *bufio.Reader) (*Packet, error) {
+	identifier, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length, err := readLength(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > maxPacketSize {
+		return nil, fmt.Errorf("ber: element of %d bytes is too large", length)
+	}
+
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return parsePacket(identifier, data, 0)
+}
+
+// parsePacket parses an element's contents, and its children if it is
+// constructed
+func parsePacket(identifier byte, data []byte, depth int) (*Packet, error) {
+	if identifier&0x1f == 0x1f {
+		return nil, errors.New("ber: high tag numbers are not supported")
+	}
+	p := &Packet{
+		Class:       identifier & 0xc0,
+		Constructed: identifier&0x20 != 0,
+		Tag:         identifier & 0x1f,
+	}
+	if !p.Constructed {
+		p.Value = data
+		return p, nil
+	}
+	if depth >= maxPacketDepth {
+		return nil, errors.New("ber: nested too deeply")
+	}
+
+	for len(data) > 0 {
+		childIdentifier := data[0]
+		rest := &byteSliceReader{data: data[1:]}
+		length, err := readLength(rest)
+		if err != nil {
+			return nil, err
+		}
+		start := len(data) - rest.Len()
+		if length > len(data)-start {
+			return nil, io.ErrUnexpectedEOF
+		}
+		child, err := parsePacket(childIdentifier, data[start:start+length], depth+1)
+		if err != nil {
+			return nil, err
+		}
+		p.Children = append(p.Children, child)
+		data = data[start+length:]
+	}
+	return p, nil
+}
+
+// readLength reads a definite length
+func readLength(br io.ByteReader) (int, error) {
+	first, err := br.ReadByte()
+	if err != nil {
+		return 0, unexpectedEOF(err)
+	}
+	if first < 0x80 {
+		return int(first), nil
+	}
+	if first == 0x80 {
+		return 0, errors.New("ber: indefinite lengths are not supported")
+	}
+
+	octets := int(first & 0x7f)
+	if octets > 4 {
+		return 0, errors.New("ber: length is too large")
+	}
+	length := 0
+	for range octets {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, unexpectedEOF(err)
+		}
+		length = length<<8 | int(b)
+	}
+	return length, nil
+}
+
+// byteSliceReader reads bytes from a slice, tracking what is left
+type byteSliceReader struct {
+	data []byte
+}
+
+func (r *byteSliceReader) ReadByte() (byte, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	b := r.data[0]
+	r.data = r.data[1:]
+	return b, nil
+}
+
+// Len returns the number of unread bytes
+func (r *byteSliceReader) Len() int {
+	return len(r.data)
+}
+
+// unexpectedEOF turns EOF in the middle of an element into
+// io.ErrUnexpectedEOF
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
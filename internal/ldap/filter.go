@@ -0,0 +1,211 @@
+package ldap
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// Filter choices (RFC 4511 section 4.5.1.7), which are context-specific tags
+const (
+	FilterAnd            byte = 0
+	FilterOr             byte = 1
+	FilterNot            byte = 2
+	FilterEqualityMatch  byte = 3
+	FilterSubstrings     byte = 4
+	FilterGreaterOrEqual byte = 5
+	FilterLessOrEqual    byte = 6
+	FilterPresent        byte = 7
+	FilterApproxMatch    byte = 8
+)
+
+// Substring filter parts
+const (
+	SubstringInitial byte = 0
+	SubstringAny     byte = 1
+	SubstringFinal   byte = 2
+)
+
+// EscapeFilter escapes a value, such as a username, to be used in a filter
+// (RFC 4515)
+func EscapeFilter(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch c := value[i]; c {
+		case '\\', '*', '(', ')', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// CompileFilter compiles a filter in its string form (RFC 4515), such as
+// "(&(objectClass=person)(uid=alice))". Extensible match filters are not
+// supported.
+func CompileFilter(filter string) (*Packet, error) {
+	p := &filterParser{filter: filter}
+	packet, err := p.parse(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid filter %q: %w", filter, err)
+	}
+	if p.pos != len(filter) {
+		return nil, fmt.Errorf("invalid filter %q: unexpected %q after the filter", filter, filter[p.pos:])
+	}
+	return packet, nil
+}
+
+// filterParser parses a filter string
+type filterParser struct {
+	filter string
+	pos    int
+}
+
+func (p *filterParser) parse(depth int) (*Packet, error) {
+	if depth > maxPacketDepth {
+		return nil, fmt.Errorf("nested too deeply")
+	}
+	if p.pos >= len(p.filter) || p.filter[p.pos] != '(' {
+		return nil, fmt.Errorf("expected ( at position %d", p.pos)
+	}
+	p.pos++
+	if p.pos >= len(p.filter) {
+		return nil, fmt.Errorf("unexpected end")
+	}
+
+	var packet *Packet
+	switch p.filter[p.pos] {
+	case '&', '|':
+		choice := FilterAnd
+		if p.filter[p.pos] == '|' {
+			choice = FilterOr
+		}
+		p.pos++
+		packet = NewConstructed(ClassContext, choice)
+		for p.pos < len(p.filter) && p.filter[p.pos] == '(' {
+			child, err := p.parse(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			packet.Children = append(packet.Children, child)
+		}
+	case '!':
+		p.pos++
+		child, err := p.parse(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		packet = NewConstructed(ClassContext, FilterNot, child)
+	default:
+		var err error
+		if packet, err = p.parseItem(); err != nil {
+			return nil, err
+		}
+	}
+
+	if p.pos >= len(p.filter) || p.filter[p.pos] != ')' {
+		return nil, fmt.Errorf("expected ) at position %d", p.pos)
+	}
+	p.pos++
+	return packet, nil
+}
+
+// parseItem parses a comparison, such as uid=alice, up to its closing
+// parenthesis
+func (p *filterParser) parseItem() (*Packet, error) {
+	end := strings.IndexByte(p.filter[p.pos:], ')')
+	if end < 0 {
+		return nil, fmt.Errorf("unexpected end")
+	}
+	item := p.filter[p.pos : p.pos+end]
+	p.pos += end
+
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, fmt.Errorf("expected attribute=value in %q", item)
+	}
+	attribute, value := item[:eq], item[eq+1:]
+	choice := FilterEqualityMatch
+	switch attribute[len(attribute)-1] {
+	case '>':
+		choice = FilterGreaterOrEqual
+	case '<':
+		choice = FilterLessOrEqual
+	case '~':
+		choice = FilterApproxMatch
+	case ':':
+		return nil, fmt.Errorf("extensible match filters are not supported")
+	}
+	if choice != FilterEqualityMatch {
+		attribute = attribute[:len(attribute)-1]
+	}
+	if attribute == "" || strings.ContainsAny(attribute, "(&|!*\\") {
+		return nil, fmt.Errorf("invalid attribute %q", attribute)
+	}
+
+	if choice == FilterEqualityMatch && value == "*" {
+		return NewPrimitive(ClassContext, FilterPresent, []byte(attribute)), nil
+	}
+	if choice == FilterEqualityMatch && strings.Contains(value, "*") {
+		return substringsFilter(attribute, value)
+	}
+
+	unescaped, err := unescapeFilterValue(value)
+	if err != nil {
+		return nil, err
+	}
+	return NewConstructed(ClassContext, choice, NewString(attribute), NewString(unescaped)), nil
+}
+
+// substringsFilter creates a substrings filter from a value with wildcards,
+// such as "ali*ce*"
+func substringsFilter(attribute, value string) (*Packet, error) {
+	parts := strings.Split(value, "*")
+	substrings := NewSequence()
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		unescaped, err := unescapeFilterValue(part)
+		if err != nil {
+			return nil, err
+		}
+		kind := SubstringAny
+		switch i {
+		case 0:
+			kind = SubstringInitial
+		case len(parts) - 1:
+			kind = SubstringFinal
+		}
+		substrings.Children = append(substrings.Children, NewPrimitive(ClassContext, kind, []byte(unescaped)))
+	}
+	if len(substrings.Children) == 0 {
+		return nil, fmt.Errorf("substring filter for %s has no substrings", attribute)
+	}
+	return NewConstructed(ClassContext, FilterSubstrings, NewString(attribute), substrings), nil
+}
+
+// unescapeFilterValue decodes the \XX escapes in a filter value
+func unescapeFilterValue(value string) (string, error) {
+	if !strings.Contains(value, "\\") {
+		return value, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			b.WriteByte(value[i])
+			continue
+		}
+		if i+3 > len(value) {
+			return "", fmt.Errorf("truncated escape in %q", value)
+		}
+		decoded, err := hex.DecodeString(value[i+1 : i+3])
+		if err != nil {
+			return "", fmt.Errorf("invalid escape in %q", value)
+		}
+		b.Write(decoded)
+		i += 2
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,99 @@
+package ldap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		hex    string
+	}{
+		// (uid=alice): equalityMatch [3] { "uid", "alice" }
+		{"(uid=alice)", "a30c04037569640405616c696365"},
+		// (objectClass=*): present [7] "objectClass"
+		{"(objectClass=*)", "870b6f626a656374436c617373"},
+		// (&(a=1)(!(b=2)))
+		{"(&(a=1)(!(b=2)))", "a012a306040161040131a208a306040162040132"},
+		// (cn=al*c*e): substrings [4] { "cn", { initial "al", any "c", final "e" } }
+		{"(cn=al*c*e)", "a4100402636e300a8002616c810163820165"},
+		// Escaped parentheses and asterisks are values, not syntax
+		{`(cn=a\28\2a\29)`, "a30a0402636e040461282a29"},
+	}
+	for _, tt := range tests {
+		packet, err := CompileFilter(tt.filter)
+		if err != nil {
+			t.Errorf("CompileFilter(%q) failed: %v", tt.filter, err)
+			continue
+		}
+		want, _ := hex.DecodeString(tt.hex)
+		if got := packet.Bytes(); !bytes.Equal(got, want) {
+			t.Errorf("CompileFilter(%q) = %x, want %x", tt.filter, got, want)
+		}
+	}
+}
+
+func TestCompileFilterRejectsInvalidFilters(t *testing.T) {
+	for _, filter := range []string{
+		"",
+		"uid=alice",
+		"(uid=alice",
+		"(uid=alice))",
+		"(=alice)",
+		"(uid)",
+		`(uid=\2)`,
+		`(uid=\zz)`,
+		"(memberOf:1.2.840.113556.1.4.1941:=cn=admins)",
+	} {
+		if _, err := CompileFilter(filter); err == nil {
+			t.Errorf("Expected %q to be rejected", filter)
+		}
+	}
+}
+
+func TestEscapeFilter(t *testing.T) {
+	escaped := EscapeFilter("*)(uid=*))(|(uid=*")
+	if escaped != `\2a\29\28uid=\2a\29\29\28|\28uid=\2a` {
+		t.Errorf("Unexpected escaping %q", escaped)
+	}
+
+	// Escaped values compile back to themselves
+	packet, err := CompileFilter("(uid=" + EscapeFilter(`a*b(c)\d`) + ")")
+	if err != nil {
+		t.Fatalf("Failed to compile escaped filter: %v", err)
+	}
+	if value := packet.Children[1].Text(); value != `a*b(c)\d` {
+		t.Errorf("Expected the value to round trip, got %q", value)
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	for _, n := range []int64{0, 1, 127, 128, 255, 256, -1, -128, -129, 1 << 40} {
+		packet := NewInteger(ClassUniversal, TagInteger, n)
+		read, err := ReadPacket(bufio.NewReader(bytes.NewReader(packet.Bytes())))
+		if err != nil {
+			t.Fatalf("Failed to read %d: %v", n, err)
+		}
+		if got, err := read.Int(); err != nil || got != n {
+			t.Errorf("Expected %d, got %d (%v)", n, got, err)
+		}
+	}
+
+	// Long lengths
+	long := NewSequence(NewString(string(make([]byte, 300))))
+	read, err := ReadPacket(bufio.NewReader(bytes.NewReader(long.Bytes())))
+	if err != nil {
+		t.Fatalf("Failed to read long packet: %v", err)
+	}
+	if len(read.Children) != 1 || len(read.Children[0].Value) != 300 {
+		t.Errorf("Unexpected long packet %+v", read)
+	}
+
+	// Indefinite lengths are refused
+	if _, err := ReadPacket(bufio.NewReader(bytes.NewReader([]byte{0x30, 0x80, 0x00, 0x00}))); err == nil {
+		t.Error("Expected indefinite length to be refused")
+	}
+}
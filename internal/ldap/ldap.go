@@ -0,0 +1,394 @@
+// Package ldap implements the parts of an LDAPv3 (RFC 4511) client needed to
+// check passwords against a directory such as OpenLDAP or Active Directory:
+// simple binds, searches and StartTLS.
+package ldap
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Protocol operations, which are application-specific tags
+const (
+	OpBindRequest           byte = 0
+	OpBindResponse          byte = 1
+	OpUnbindRequest         byte = 2
+	OpSearchRequest         byte = 3
+	OpSearchResultEntry     byte = 4
+	OpSearchResultDone      byte = 5
+	OpSearchResultReference byte = 19
+	OpExtendedRequest       byte = 23
+	OpExtendedResponse      byte = 24
+)
+
+// Result codes
+const (
+	ResultSuccess                  = 0
+	ResultProtocolError            = 2
+	ResultSizeLimitExceeded        = 4
+	ResultNoSuchObject             = 32
+	ResultInvalidCredentials       = 49
+	ResultInsufficientAccessRights = 50
+	ResultUnwillingToPerform       = 53
+)
+
+// Search scopes
+const (
+	ScopeBaseObject   = 0
+	ScopeSingleLevel  = 1
+	ScopeWholeSubtree = 2
+)
+
+// startTLSOID names the StartTLS extended operation (RFC 4511 section 4.14)
+const startTLSOID = "1.3.6.1.4.1.1466.20037"
+
+// ErrEmptyPassword is returned when binding as a user with an empty password,
+// which directories treat as an unauthenticated bind that always succeeds
+var ErrEmptyPassword = errors.New("ldap: empty password")
+
+// Error is a result other than success from the directory
+type Error struct {
+	ResultCode int
+	MatchedDN  string
+	Message    string // Diagnostic message from the directory
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("ldap: result code %d", e.ResultCode)
+	}
+	return fmt.Sprintf("ldap: result code %d: %s", e.ResultCode, e.Message)
+}
+
+// IsResult checks if err is an Error with the result code
+func IsResult(err error, code int) bool {
+	var ldapErr *Error
+	return errors.As(err, &ldapErr) && ldapErr.ResultCode == code
+}
+
+// Conn is a connection to a directory. Operations are sent one at a time.
+type Conn struct {
+	conn      net.Conn
+	r         *bufio.Reader
+	host      string // Host name certificates are verified for
+	messageID int64
+	stop      func() bool
+}
+
+// Dial connects to the directory at an ldap:// or ldaps:// URL. The
+// context's deadline applies to the connection's operations, which are
+// abandoned if it is cancelled.
+func Dial(ctx context.Context, rawURL string, tlsConfig *tls.Config) (*Conn, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: invalid URL: %w", err)
+	}
+	host := u.Host
+	var useTLS bool
+	switch strings.ToLower(u.Scheme) {
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+	case "ldaps":
+		useTLS = true
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+	default:
+		return nil, fmt.Errorf("ldap: unsupported URL scheme %q", u.Scheme)
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return nil, fmt.Errorf("ldap: failed to connect: %w", err)
+	}
+	if useTLS {
+		tlsConn := tls.Client(conn, withServerName(tlsConfig, u.Hostname()))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap: TLS handshake failed: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	c := &Conn{conn: conn, r: bufio.NewReader(conn), host: u.Hostname()}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	c.stop = context.AfterFunc(ctx, func() {
+		// Unblock whatever operation is waiting
+		_ = c.conn.SetDeadline(time.Unix(1, 0))
+	})
+	return c, nil
+}
+
+// withServerName returns the TLS configuration, verifying certificates for
+// host unless it names another server
+func withServerName(tlsConfig *tls.Config, host string) *tls.Config {
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	if tlsConfig.ServerName == "" {
+		tlsConfig = tlsConfig.Clone()
+		tlsConfig.ServerName = host
+	}
+	return tlsConfig
+}
+
+// Close unbinds and closes the connection
+func (c *Conn) Close() error {
+	c.stop()
+	// The directory does not answer unbind requests
+	_ = c.send(NewPrimitive(ClassApplication, OpUnbindRequest, nil))
+	return c.conn.Close()
+}
+
+// StartTLS upgrades the connection to TLS. It must be called before binding.
+func (c *Conn) StartTLS(tlsConfig *tls.Config) error {
+	request := NewConstructed(ClassApplication, OpExtendedRequest,
+		NewPrimitive(ClassContext, 0, []byte(startTLSOID)))
+	if _, err := c.request(request, OpExtendedResponse); err != nil {
+		return fmt.Errorf("ldap: StartTLS failed: %w", err)
+	}
+
+	tlsConn := tls.Client(c.conn, withServerName(tlsConfig, c.host))
+	if err := tlsConn.Handshake(); err != nil {
+		return fmt.Errorf("ldap: TLS handshake failed: %w", err)
+	}
+	c.conn = tlsConn
+	c.r = bufio.NewReader(tlsConn)
+	return nil
+}
+
+// Bind authenticates the connection as dn with a password. It returns an
+// Error with ResultInvalidCredentials if the password is wrong. An empty dn
+// and password bind anonymously.
+func (c *Conn) Bind(dn, password string) error {
+	if password == "" && dn != "" {
+		return ErrEmptyPassword
+	}
+	request := NewConstructed(ClassApplication, OpBindRequest,
+		NewInteger(ClassUniversal, TagInteger, 3),
+		NewString(dn),
+		NewPrimitive(ClassContext, 0, []byte(password)))
+	_, err := c.request(request, OpBindResponse)
+	return err
+}
+
+// SearchRequest describes a search of the directory
+type SearchRequest struct {
+	BaseDN     string
+	Scope      int
+	Filter     string   // e.g. "(uid=alice)", with values escaped with EscapeFilter
+	Attributes []string // Attributes to return, or all of them if empty
+	SizeLimit  int      // Maximum number of entries to return, or 0 for the directory's limit
+}
+
+// Entry is an entry found by a search
+type Entry struct {
+	DN         string
+	Attributes []*Attribute
+}
+
+// Attribute is an attribute of an entry, with its values
+type Attribute struct {
+	Name   string
+	Values [][]byte
+}
+
+// Values returns the values of an attribute as strings. Attribute names are
+// case-insensitive.
+func (e *Entry) Values(name string) []string {
+	for _, attribute := range e.Attributes {
+		if strings.EqualFold(attribute.Name, name) {
+			values := make([]string, len(attribute.Values))
+			for i, value := range attribute.Values {
+				values[i] = string(value)
+			}
+			return values
+		}
+	}
+	return nil
+}
+
+// RawValue returns the first value of an attribute, or nil if it has none
+func (e *Entry) RawValue(name string) []byte {
+	for _, attribute := range e.Attributes {
+		if strings.EqualFold(attribute.Name, name) && len(attribute.Values) > 0 {
+			return attribute.Values[0]
+		}
+	}
+	return nil
+}
+
+// Value returns the first value of an attribute, or an empty string if it has
+// none
+func (e *Entry) Value(name string) string {
+	return string(e.RawValue(name))
+}
+
+// Search searches the directory. Hitting the size limit is not an error; the
+// entries found up to the limit are returned.
+func (c *Conn) Search(req *SearchRequest) ([]*Entry, error) {
+	filter, err := CompileFilter(req.Filter)
+	if err != nil {
+		return nil, err
+	}
+	attributes := NewSequence()
+	for _, attribute := range req.Attributes {
+		attributes.Children = append(attributes.Children, NewString(attribute))
+	}
+	request := NewConstructed(ClassApplication, OpSearchRequest,
+		NewString(req.BaseDN),
+		NewInteger(ClassUniversal, TagEnumerated, int64(req.Scope)),
+		NewInteger(ClassUniversal, TagEnumerated, 0), // Never dereference aliases
+		NewInteger(ClassUniversal, TagInteger, int64(req.SizeLimit)),
+		NewInteger(ClassUniversal, TagInteger, 0),
+		NewBoolean(false),
+		filter,
+		attributes)
+
+	id, err := c.sendRequest(request)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for {
+		op, err := c.readResponse(id)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case op.Is(ClassApplication, OpSearchResultEntry):
+			entry, err := parseEntry(op)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case op.Is(ClassApplication, OpSearchResultReference):
+			// Referrals to other directories are not followed
+		case op.Is(ClassApplication, OpSearchResultDone):
+			if err := parseResult(op); err != nil && !IsResult(err, ResultSizeLimitExceeded) {
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, fmt.Errorf("ldap: unexpected response %d to search", op.Tag)
+		}
+	}
+}
+
+// parseEntry parses a SearchResultEntry
+func parseEntry(op *Packet) (*Entry, error) {
+	if len(op.Children) != 2 {
+		return nil, errors.New("ldap: malformed search result entry")
+	}
+	entry := &Entry{DN: op.Children[0].Text()}
+	for _, attribute := range op.Children[1].Children {
+		if len(attribute.Children) != 2 {
+			return nil, errors.New("ldap: malformed attribute")
+		}
+		parsed := &Attribute{Name: attribute.Children[0].Text()}
+		for _, value := range attribute.Children[1].Children {
+			parsed.Values = append(parsed.Values, value.Value)
+		}
+		entry.Attributes = append(entry.Attributes, parsed)
+	}
+	return entry, nil
+}
+
+// request sends a request and reads its single response, which must be the
+// expected operation and succeed
+func (c *Conn) request(request *Packet, expected byte) (*Packet, error) {
+	id, err := c.sendRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	op, err := c.readResponse(id)
+	if err != nil {
+		return nil, err
+	}
+	if !op.Is(ClassApplication, expected) {
+		return nil, fmt.Errorf("ldap: unexpected response %d", op.Tag)
+	}
+	return op, parseResult(op)
+}
+
+// sendRequest sends a request in a new message, returning the message's ID
+func (c *Conn) sendRequest(op *Packet) (int64, error) {
+	c.messageID++
+	if err := c.send(op); err != nil {
+		return 0, err
+	}
+	return c.messageID, nil
+}
+
+// send sends an operation in a message with the current message ID
+func (c *Conn) send(op *Packet) error {
+	message := NewSequence(NewInteger(ClassUniversal, TagInteger, c.messageID), op)
+	if _, err := c.conn.Write(message.Bytes()); err != nil {
+		return fmt.Errorf("ldap: failed to send request: %w", err)
+	}
+	return nil
+}
+
+// readResponse reads the next message for the request with the ID, and
+// returns its operation
+func (c *Conn) readResponse(id int64) (*Packet, error) {
+	for {
+		message, err := ReadPacket(c.r)
+		if err != nil {
+			return nil, fmt.Errorf("ldap: failed to read response: %w", err)
+		}
+		if !message.Is(ClassUniversal, TagSequence) || len(message.Children) < 2 {
+			return nil, errors.New("ldap: malformed message")
+		}
+		messageID, err := message.Children[0].Int()
+		if err != nil {
+			return nil, err
+		}
+		op := message.Children[1]
+
+		switch messageID {
+		case id:
+			return op, nil
+		case 0:
+			// Unsolicited notification, e.g. that the directory is
+			// disconnecting
+			if err := parseResult(op); err != nil {
+				return nil, err
+			}
+			return nil, errors.New("ldap: unexpected notification")
+		}
+		// Ignore responses to requests that were given up on
+	}
+}
+
+// parseResult returns the error in an LDAPResult, or nil if it succeeded
+func parseResult(op *Packet) error {
+	if len(op.Children) < 3 {
+		return errors.New("ldap: malformed result")
+	}
+	code, err := op.Children[0].Int()
+	if err != nil {
+		return err
+	}
+	if code == ResultSuccess {
+		return nil
+	}
+	return &Error{
+		ResultCode: int(code),
+		MatchedDN:  op.Children[1].Text(),
+		Message:    op.Children[2].Text(),
+	}
+}
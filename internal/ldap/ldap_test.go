@@ -0,0 +1,123 @@
+package ldap_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/ldap"
+	"github.com/bjschafer/print-dis/internal/ldap/ldaptest"
+)
+
+func newDirectory(t *testing.T) *ldaptest.Server {
+	t.Helper()
+	directory := ldaptest.NewServer(t)
+	directory.AddEntry(&ldaptest.Entry{
+		DN:       "cn=reader,dc=example,dc=com",
+		Password: "reader-secret",
+	})
+	for _, uid := range []string{"alice", "alan"} {
+		directory.AddEntry(&ldaptest.Entry{
+			DN: "uid=" + uid + ",ou=people,dc=example,dc=com",
+			Attributes: map[string][]string{
+				"objectClass": {"person"},
+				"uid":         {uid},
+				"mail":        {uid + "@example.com"},
+			},
+			Password: uid + "-secret",
+		})
+	}
+	return directory
+}
+
+func dial(t *testing.T, directory *ldaptest.Server) *ldap.Conn {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	t.Cleanup(cancel)
+	conn, err := ldap.Dial(ctx, directory.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestBind(t *testing.T) {
+	conn := dial(t, newDirectory(t))
+
+	if err := conn.Bind("uid=alice,ou=people,dc=example,dc=com", "wrong"); !ldap.IsResult(err, ldap.ResultInvalidCredentials) {
+		t.Errorf("Expected invalid credentials, got %v", err)
+	}
+	// Empty passwords would be unauthenticated binds, which succeed
+	if err := conn.Bind("uid=alice,ou=people,dc=example,dc=com", ""); !errors.Is(err, ldap.ErrEmptyPassword) {
+		t.Errorf("Expected empty password to be refused, got %v", err)
+	}
+	if err := conn.Bind("uid=alice,ou=people,dc=example,dc=com", "alice-secret"); err != nil {
+		t.Errorf("Expected bind to succeed, got %v", err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	conn := dial(t, newDirectory(t))
+	search := func(filter string, sizeLimit int) ([]*ldap.Entry, error) {
+		return conn.Search(&ldap.SearchRequest{
+			BaseDN:     "ou=people,dc=example,dc=com",
+			Scope:      ldap.ScopeWholeSubtree,
+			Filter:     filter,
+			Attributes: []string{"uid", "mail"},
+			SizeLimit:  sizeLimit,
+		})
+	}
+
+	if _, err := search("(uid=alice)", 0); !ldap.IsResult(err, ldap.ResultInsufficientAccessRights) {
+		t.Fatalf("Expected anonymous search to be refused, got %v", err)
+	}
+	if err := conn.Bind("cn=reader,dc=example,dc=com", "reader-secret"); err != nil {
+		t.Fatalf("Failed to bind: %v", err)
+	}
+
+	entries, err := search("(&(objectClass=person)(uid="+ldap.EscapeFilter("alice")+"))", 0)
+	if err != nil {
+		t.Fatalf("Search failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].DN != "uid=alice,ou=people,dc=example,dc=com" {
+		t.Fatalf("Expected alice, got %+v", entries)
+	}
+	if mail := entries[0].Value("MAIL"); mail != "alice@example.com" {
+		t.Errorf("Expected alice's mail, got %q", mail)
+	}
+	if values := entries[0].Values("objectClass"); values != nil {
+		t.Errorf("Expected only requested attributes, got objectClass %v", values)
+	}
+
+	// Usernames with filter syntax in them match nothing rather than everyone
+	if entries, err := search("(uid="+ldap.EscapeFilter("*")+")", 0); err != nil || len(entries) != 0 {
+		t.Errorf("Expected escaped wildcard to match nothing, got %+v %v", entries, err)
+	}
+
+	// Hitting the size limit returns what was found
+	entries, err = search("(uid=al*)", 1)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected one entry at the size limit, got %+v %v", entries, err)
+	}
+}
+
+func TestDialHonoursContext(t *testing.T) {
+	directory := newDirectory(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	conn, err := ldap.Dial(ctx, directory.URL, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v", err)
+	}
+	defer conn.Close()
+
+	cancel()
+	if err := conn.Bind("cn=reader,dc=example,dc=com", "reader-secret"); err == nil {
+		t.Error("Expected bind on a cancelled connection to fail")
+	}
+
+	if _, err := ldap.Dial(context.Background(), "http://example.com", nil); err == nil {
+		t.Error("Expected non-LDAP URL to be refused")
+	}
+}
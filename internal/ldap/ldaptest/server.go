@@ -0,0 +1,336 @@
+// Package ldaptest provides an in-process LDAP directory for tests
+package ldaptest
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bjschafer/print-dis/internal/ldap"
+)
+
+// Entry is an entry in the directory
+type Entry struct {
+	DN         string
+	Attributes map[string][]string
+	// Password is checked by simple binds as the entry's DN. Entries without
+	// one cannot bind.
+	Password string
+}
+
+// values returns the values of an attribute, matching its name
+// case-insensitively
+func (e *Entry) values(name string) []string {
+	for attribute, values := range e.Attributes {
+		if strings.EqualFold(attribute, name) {
+			return values
+		}
+	}
+	return nil
+}
+
+// Server is a directory that answers simple binds and searches. Searches
+// need a bound connection, like most real directories. It speaks just enough
+// LDAP for the ldap package, without TLS.
+type Server struct {
+	// URL is the ldap:// URL the server listens on
+	URL string
+
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	entries  []*Entry
+	binds    []string
+}
+
+// NewServer starts a server on localhost, which is stopped when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ldaptest: failed to listen: %v", err)
+	}
+	s := &Server{URL: "ldap://" + listener.Addr().String(), listener: listener}
+
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close stops the server and waits for open connections to finish
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.wg.Wait()
+}
+
+// AddEntry adds an entry to the directory
+func (s *Server) AddEntry(entry *Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = append(s.entries, entry)
+}
+
+// SetPassword changes an entry's password
+func (s *Server) SetPassword(dn, password string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.DN, dn) {
+			entry.Password = password
+		}
+	}
+}
+
+// Binds returns the DNs of the successful binds so far
+func (s *Server) Binds() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.binds...)
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() { _ = conn.Close() }()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle answers the requests on a connection until it is closed or unbound
+func (s *Server) handle(conn net.Conn) {
+	r := bufio.NewReader(conn)
+	var boundDN string
+	for {
+		message, err := ldap.ReadPacket(r)
+		if err != nil || len(message.Children) < 2 {
+			return
+		}
+		id, err := message.Children[0].Int()
+		if err != nil {
+			return
+		}
+		op := message.Children[1]
+		send := func(response *ldap.Packet) bool {
+			reply := ldap.NewSequence(ldap.NewInteger(ldap.ClassUniversal, ldap.TagInteger, id), response)
+			_, err := conn.Write(reply.Bytes())
+			return err == nil
+		}
+
+		var ok bool
+		switch {
+		case op.Is(ldap.ClassApplication, ldap.OpBindRequest):
+			var code int
+			code, boundDN = s.bind(op)
+			ok = send(result(ldap.OpBindResponse, code, ""))
+		case op.Is(ldap.ClassApplication, ldap.OpSearchRequest):
+			if boundDN == "" {
+				ok = send(result(ldap.OpSearchResultDone, ldap.ResultInsufficientAccessRights, "bind required"))
+				break
+			}
+			ok = s.search(op, send)
+		case op.Is(ldap.ClassApplication, ldap.OpUnbindRequest):
+			return
+		default:
+			ok = send(result(ldap.OpExtendedResponse, ldap.ResultProtocolError, "unsupported operation"))
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// bind checks a simple bind, returning the result code and the DN the
+// connection is now bound as
+func (s *Server) bind(op *ldap.Packet) (int, string) {
+	if len(op.Children) != 3 {
+		return ldap.ResultProtocolError, ""
+	}
+	dn, password := op.Children[1].Text(), op.Children[2].Text()
+	if dn == "" && password == "" {
+		return ldap.ResultSuccess, ""
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range s.entries {
+		if strings.EqualFold(entry.DN, dn) && entry.Password != "" && entry.Password == password {
+			s.binds = append(s.binds, entry.DN)
+			return ldap.ResultSuccess, entry.DN
+		}
+	}
+	return ldap.ResultInvalidCredentials, ""
+}
+
+// search sends the entries matching a search request, then the result
+func (s *Server) search(op *ldap.Packet, send func(*ldap.Packet) bool) bool {
+	if len(op.Children) != 8 {
+		return send(result(ldap.OpSearchResultDone, ldap.ResultProtocolError, "malformed search"))
+	}
+	baseDN := strings.ToLower(op.Children[0].Text())
+	scope, _ := op.Children[1].Int()
+	sizeLimit, _ := op.Children[3].Int()
+	filter := op.Children[6]
+	var attributes []string
+	for _, attribute := range op.Children[7].Children {
+		attributes = append(attributes, attribute.Text())
+	}
+
+	s.mu.Lock()
+	var matches []*Entry
+	for _, entry := range s.entries {
+		if inScope(strings.ToLower(entry.DN), baseDN, scope) && matchFilter(entry, filter) {
+			matches = append(matches, entry)
+		}
+	}
+	s.mu.Unlock()
+
+	for i, entry := range matches {
+		if sizeLimit > 0 && int64(i) >= sizeLimit {
+			return send(result(ldap.OpSearchResultDone, ldap.ResultSizeLimitExceeded, ""))
+		}
+		if !send(resultEntry(entry, attributes)) {
+			return false
+		}
+	}
+	return send(result(ldap.OpSearchResultDone, ldap.ResultSuccess, ""))
+}
+
+// inScope checks if a DN is within a search's base and scope
+func inScope(dn, baseDN string, scope int64) bool {
+	switch scope {
+	case ldap.ScopeBaseObject:
+		return dn == baseDN
+	case ldap.ScopeSingleLevel:
+		_, parent, ok := strings.Cut(dn, ",")
+		return ok && parent == baseDN
+	default:
+		return dn == baseDN || strings.HasSuffix(dn, ","+baseDN)
+	}
+}
+
+// matchFilter checks an entry against a compiled filter. Approximate matches
+// are treated as equality matches.
+func matchFilter(entry *Entry, filter *ldap.Packet) bool {
+	if filter.Class != ldap.ClassContext {
+		return false
+	}
+	switch filter.Tag {
+	case ldap.FilterAnd:
+		for _, child := range filter.Children {
+			if !matchFilter(entry, child) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, child := range filter.Children {
+			if matchFilter(entry, child) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(filter.Children) == 1 && !matchFilter(entry, filter.Children[0])
+	case ldap.FilterPresent:
+		return len(entry.values(filter.Text())) > 0
+	}
+
+	if len(filter.Children) != 2 {
+		return false
+	}
+	attribute := filter.Children[0].Text()
+	for _, value := range entry.values(attribute) {
+		value = strings.ToLower(value)
+		switch filter.Tag {
+		case ldap.FilterEqualityMatch, ldap.FilterApproxMatch:
+			if value == strings.ToLower(filter.Children[1].Text()) {
+				return true
+			}
+		case ldap.FilterGreaterOrEqual:
+			if value >= strings.ToLower(filter.Children[1].Text()) {
+				return true
+			}
+		case ldap.FilterLessOrEqual:
+			if value <= strings.ToLower(filter.Children[1].Text()) {
+				return true
+			}
+		case ldap.FilterSubstrings:
+			if matchSubstrings(value, filter.Children[1].Children) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchSubstrings checks a lowercased value against the parts of a
+// substrings filter
+func matchSubstrings(value string, parts []*ldap.Packet) bool {
+	for _, part := range parts {
+		substring := strings.ToLower(part.Text())
+		switch part.Tag {
+		case ldap.SubstringInitial:
+			if !strings.HasPrefix(value, substring) {
+				return false
+			}
+			value = value[len(substring):]
+		case ldap.SubstringAny:
+			i := strings.Index(value, substring)
+			if i < 0 {
+				return false
+			}
+			value = value[i+len(substring):]
+		case ldap.SubstringFinal:
+			if !strings.HasSuffix(value, substring) {
+				return false
+			}
+			value = ""
+		}
+	}
+	return true
+}
+
+// resultEntry creates a SearchResultEntry with the requested attributes, or
+// all of them if none were requested
+func resultEntry(entry *Entry, requested []string) *ldap.Packet {
+	attributes := ldap.NewSequence()
+	for name, values := range entry.Attributes {
+		if len(requested) > 0 && !containsFold(requested, name) {
+			continue
+		}
+		set := ldap.NewConstructed(ldap.ClassUniversal, ldap.TagSet)
+		for _, value := range values {
+			set.Children = append(set.Children, ldap.NewString(value))
+		}
+		attributes.Children = append(attributes.Children, ldap.NewSequence(ldap.NewString(name), set))
+	}
+	return ldap.NewConstructed(ldap.ClassApplication, ldap.OpSearchResultEntry, ldap.NewString(entry.DN), attributes)
+}
+
+// result creates an LDAPResult for an operation
+func result(op byte, code int, message string) *ldap.Packet {
+	return ldap.NewConstructed(ldap.ClassApplication, op,
+		ldap.NewInteger(ldap.ClassUniversal, ldap.TagEnumerated, int64(code)),
+		ldap.NewString(""),
+		ldap.NewString(message))
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
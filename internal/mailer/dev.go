@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// FileMailer writes each message to a .eml file in a directory instead of
+// sending it, for development and testing
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+// NewFileMailer creates a mailer that writes messages into dir, creating it
+// if needed
+func NewFileMailer(dir, from string) (*FileMailer, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &FileMailer{dir: dir, from: from}, nil
+}
+
+// Send writes the message to a new file
+func (m *FileMailer) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	data, _, _, err := format(m.from, msg, now)
+	if err != nil {
+		return err
+	}
+
+	// Name files so they sort in the order they were sent
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), strings.ToLower(rand.Text()[:8]))
+	if err := os.WriteFile(filepath.Join(m.dir, name), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+	return nil
+}
+
+// LogMailer logs messages instead of sending them, so that links in them can
+// be copied from the log while developing
+type LogMailer struct {
+	from   string
+	logger *slog.Logger
+}
+
+// NewLogMailer creates a mailer that logs messages
+func NewLogMailer(from string) *LogMailer {
+	return &LogMailer{from: from, logger: slog.Default()}
+}
+
+// Send logs the message
+func (m *LogMailer) Send(ctx context.Context, msg Message) error {
+	// Refuse the same messages as the other mailers
+	if _, _, _, err := format(m.from, msg, time.Now()); err != nil {
+		return err
+	}
+	m.logger.Info("email not sent, logging it instead", "from", m.from, "to", msg.To, "subject", msg.Subject, "body", msg.Body)
+	return nil
+}
@@ -0,0 +1,95 @@
+// Package mailer sends plain text email over SMTP, or to files or the log
+// while developing
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+)
+
+// ErrInvalidMessage is returned for messages that cannot be sent as they are,
+// e.g. because a header contains a line break
+var ErrInvalidMessage = errors.New("invalid message")
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends email
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// format returns the message from the sender as it is sent over SMTP, and
+// the envelope sender and recipient
+func format(from string, msg Message, now time.Time) (data []byte, sender, recipient string, err error) {
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, "", "", fmt.Errorf("%w: subject contains a line break", ErrInvalidMessage)
+	}
+	fromAddr, err := mail.ParseAddress(from)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("%w: sender %q: %v", ErrInvalidMessage, from, err)
+	}
+	toAddr, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, "", "", fmt.Errorf("%w: recipient %q: %v", ErrInvalidMessage, msg.To, err)
+	}
+
+	domain := fromAddr.Address[strings.LastIndex(fromAddr.Address, "@")+1:]
+	var buf bytes.Buffer
+	// ParseAddress refuses line breaks, and String quotes and encodes names
+	fmt.Fprintf(&buf, "From: %s\r\n", fromAddr)
+	fmt.Fprintf(&buf, "To: %s\r\n", toAddr)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: <%s@%s>\r\n", strings.ToLower(rand.Text()), domain)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+	buf.WriteString("\r\n")
+
+	body := quotedprintable.NewWriter(&buf)
+	if _, err := body.Write([]byte(msg.Body)); err != nil {
+		return nil, "", "", err
+	}
+	if err := body.Close(); err != nil {
+		return nil, "", "", err
+	}
+	if !strings.HasSuffix(msg.Body, "\n") {
+		buf.WriteString("\r\n")
+	}
+
+	return buf.Bytes(), fromAddr.Address, toAddr.Address, nil
+}
+
+// FromConfig creates the mailer for the configured backend
+func FromConfig(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Backend {
+	case "smtp":
+		return NewSMTPMailer(SMTPConfig{
+			Host:     cfg.SMTP.Host,
+			Port:     cfg.SMTP.Port,
+			Username: cfg.SMTP.Username,
+			Password: cfg.SMTP.Password,
+			TLS:      cfg.SMTP.TLS,
+			From:     cfg.From,
+		}), nil
+	case "file":
+		return NewFileMailer(cfg.FileDir, cfg.From)
+	default:
+		return NewLogMailer(cfg.From), nil
+	}
+}
@@ -0,0 +1,135 @@
+package mailer_test
+
+import (
+	"context"
+	"errors"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bjschafer/print-dis/internal/mailer"
+	"github.com/bjschafer/print-dis/internal/mailer/mailertest"
+)
+
+func TestSMTPMailer(t *testing.T) {
+	ctx := context.Background()
+	server := mailertest.NewServer(t)
+	server.Username = "print-dis"
+	server.Password = "smtp-password"
+
+	m := mailer.NewSMTPMailer(mailer.SMTPConfig{
+		Host:     server.Host,
+		Port:     server.Port,
+		Username: "print-dis",
+		Password: "smtp-password",
+		TLS:      mailer.TLSNone,
+		From:     "Print Queue <print@example.com>",
+	})
+	body := "Your print is ready. Café opens at 9.\n\n" + strings.Repeat("long line ", 20) + "\n.\nThe end\n"
+	err := m.Send(ctx, mailer.Message{
+		To:      "maker@example.com",
+		Subject: "Print ready ✓",
+		Body:    body,
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(messages))
+	}
+	msg := messages[0]
+	if msg.From != "print@example.com" || len(msg.To) != 1 || msg.To[0] != "maker@example.com" {
+		t.Errorf("Unexpected envelope from %q to %q", msg.From, msg.To)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || subject != "Print ready ✓" {
+		t.Errorf("Expected subject to survive encoding, got %q, %v", subject, err)
+	}
+	if got := strings.ReplaceAll(msg.Body, "\r\n", "\n"); got != body {
+		t.Errorf("Expected body to survive encoding, got %q", got)
+	}
+	if msg.Header.Get("Message-Id") == "" || msg.Header.Get("Date") == "" {
+		t.Errorf("Expected Message-ID and Date headers, got %v", msg.Header)
+	}
+
+	t.Run("wrong password", func(t *testing.T) {
+		m := mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host:     server.Host,
+			Port:     server.Port,
+			Username: "print-dis",
+			Password: "wrong",
+			TLS:      mailer.TLSNone,
+			From:     "print@example.com",
+		})
+		if err := m.Send(ctx, mailer.Message{To: "maker@example.com", Subject: "Hi"}); err == nil {
+			t.Error("Expected sending with the wrong password to fail")
+		}
+	})
+
+	t.Run("STARTTLS required", func(t *testing.T) {
+		m := mailer.NewSMTPMailer(mailer.SMTPConfig{
+			Host: server.Host,
+			Port: server.Port,
+			TLS:  mailer.TLSStartTLS,
+			From: "print@example.com",
+		})
+		if err := m.Send(ctx, mailer.Message{To: "maker@example.com", Subject: "Hi"}); err == nil {
+			t.Error("Expected sending without STARTTLS to fail")
+		}
+	})
+
+	if len(server.Messages()) != 1 {
+		t.Errorf("Expected no more messages, got %d", len(server.Messages()))
+	}
+}
+
+func TestInvalidMessages(t *testing.T) {
+	m := mailer.NewLogMailer("print@example.com")
+
+	tests := []struct {
+		name string
+		msg  mailer.Message
+	}{
+		{"line break in subject", mailer.Message{To: "maker@example.com", Subject: "Hi\r\nBcc: victim@example.com"}},
+		{"line break in recipient", mailer.Message{To: "maker@example.com\r\nBcc: victim@example.com", Subject: "Hi"}},
+		{"several recipients", mailer.Message{To: "maker@example.com, victim@example.com", Subject: "Hi"}},
+		{"no recipient", mailer.Message{Subject: "Hi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := m.Send(context.Background(), tt.msg); !errors.Is(err, mailer.ErrInvalidMessage) {
+				t.Errorf("Expected ErrInvalidMessage, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m, err := mailer.NewFileMailer(dir, "print@example.com")
+	if err != nil {
+		t.Fatalf("Failed to create mailer: %v", err)
+	}
+
+	for _, subject := range []string{"First", "Second"} {
+		if err := m.Send(context.Background(), mailer.Message{To: "maker@example.com", Subject: subject, Body: "Hello"}); err != nil {
+			t.Fatalf("Failed to send: %v", err)
+		}
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 2 {
+		t.Fatalf("Expected 2 messages, got %v, %v", files, err)
+	}
+	data, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("Failed to read message: %v", err)
+	}
+	if !strings.Contains(string(data), "Subject: First\r\n") || !strings.Contains(string(data), "To: <maker@example.com>\r\n") {
+		t.Errorf("Unexpected message:\n%s", data)
+	}
+}
@@ -0,0 +1,244 @@
+// Package mailertest provides an in-process SMTP server for tests
+package mailertest
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Message is a message delivered to the server
+type Message struct {
+	From   string   // Envelope sender
+	To     []string // Envelope recipients
+	Header mail.Header
+	Body   string // Decoded from quoted-printable if need be
+	Data   []byte // As sent
+}
+
+// Server is an SMTP server that accepts every message and remembers it. It
+// speaks just enough SMTP for net/smtp, without TLS.
+type Server struct {
+	// Host and Port are the address the server listens on
+	Host string
+	Port int
+	// Username and Password are required with AUTH PLAIN before sending
+	// when Username is set
+	Username string
+	Password string
+
+	listener net.Listener
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewServer starts a server on localhost, which is stopped when the test ends
+func NewServer(t testing.TB) *Server {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("mailertest: failed to listen: %v", err)
+	}
+	addr := listener.Addr().(*net.TCPAddr)
+	s := &Server{Host: addr.IP.String(), Port: addr.Port, listener: listener}
+
+	s.wg.Add(1)
+	go s.serve()
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Close stops the server and waits for open connections to finish
+func (s *Server) Close() {
+	_ = s.listener.Close()
+	s.wg.Wait()
+}
+
+// Addr returns the host and port the server listens on
+func (s *Server) Addr() string {
+	return net.JoinHostPort(s.Host, strconv.Itoa(s.Port))
+}
+
+// Messages returns the messages delivered so far
+func (s *Server) Messages() []Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Message(nil), s.messages...)
+}
+
+// WaitForMessages waits for at least n messages to be delivered, for mail
+// sent in the background, and returns them
+func (s *Server) WaitForMessages(t testing.TB, n int) []Message {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		messages := s.Messages()
+		if len(messages) >= n {
+			return messages
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("mailertest: expected %d messages, got %d", n, len(messages))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			defer func() { _ = conn.Close() }()
+			s.handle(textproto.NewConn(conn))
+		}()
+	}
+}
+
+// handle runs an SMTP session
+func (s *Server) handle(conn *textproto.Conn) {
+	reply := func(code int, text string) bool {
+		return conn.PrintfLine("%d %s", code, text) == nil
+	}
+
+	if !reply(220, "mailertest ESMTP") {
+		return
+	}
+	authenticated := s.Username == ""
+	var from string
+	var to []string
+	for {
+		line, err := conn.ReadLine()
+		if err != nil {
+			return
+		}
+		verb, arg, _ := strings.Cut(line, " ")
+
+		var ok bool
+		switch strings.ToUpper(verb) {
+		case "EHLO":
+			if s.Username != "" {
+				ok = conn.PrintfLine("250-mailertest") == nil && reply(250, "AUTH PLAIN")
+			} else {
+				ok = reply(250, "mailertest")
+			}
+		case "HELO":
+			ok = reply(250, "mailertest")
+		case "AUTH":
+			mechanism, initial, _ := strings.Cut(arg, " ")
+			if !strings.EqualFold(mechanism, "PLAIN") {
+				ok = reply(504, "Unrecognized authentication type")
+				break
+			}
+			if initial == "" {
+				if !reply(334, "") {
+					return
+				}
+				if initial, err = conn.ReadLine(); err != nil {
+					return
+				}
+			}
+			if s.checkPlain(initial) {
+				authenticated = true
+				ok = reply(235, "Authentication successful")
+			} else {
+				ok = reply(535, "Authentication credentials invalid")
+			}
+		case "MAIL":
+			if !authenticated {
+				ok = reply(530, "Authentication required")
+				break
+			}
+			from, to = parsePath(arg, "FROM:"), nil
+			ok = reply(250, "OK")
+		case "RCPT":
+			if from == "" {
+				ok = reply(503, "Need MAIL first")
+				break
+			}
+			to = append(to, parsePath(arg, "TO:"))
+			ok = reply(250, "OK")
+		case "DATA":
+			if len(to) == 0 {
+				ok = reply(503, "Need RCPT first")
+				break
+			}
+			if !reply(354, "End data with <CR><LF>.<CR><LF>") {
+				return
+			}
+			data, err := conn.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.deliver(from, to, data)
+			from, to = "", nil
+			ok = reply(250, "OK")
+		case "RSET":
+			from, to = "", nil
+			ok = reply(250, "OK")
+		case "NOOP":
+			ok = reply(250, "OK")
+		case "QUIT":
+			reply(221, "Bye")
+			return
+		default:
+			ok = reply(502, "Command not implemented")
+		}
+		if !ok {
+			return
+		}
+	}
+}
+
+// checkPlain checks an AUTH PLAIN response against the credentials
+func (s *Server) checkPlain(response string) bool {
+	decoded, err := base64.StdEncoding.DecodeString(response)
+	if err != nil {
+		return false
+	}
+	parts := strings.Split(string(decoded), "\x00")
+	return len(parts) == 3 && parts[1] == s.Username && parts[2] == s.Password
+}
+
+// deliver records a message
+func (s *Server) deliver(from string, to []string, data []byte) {
+	msg := Message{From: from, To: to, Data: data}
+	if parsed, err := mail.ReadMessage(bytes.NewReader(data)); err == nil {
+		msg.Header = parsed.Header
+		var body io.Reader = parsed.Body
+		if strings.EqualFold(parsed.Header.Get("Content-Transfer-Encoding"), "quoted-printable") {
+			body = quotedprintable.NewReader(body)
+		}
+		if decoded, err := io.ReadAll(body); err == nil {
+			msg.Body = string(decoded)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, msg)
+}
+
+// parsePath returns the address in a MAIL FROM:<address> or RCPT
+// TO:<address> argument
+func parsePath(arg, prefix string) string {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return ""
+	}
+	path, _, _ := strings.Cut(strings.TrimSpace(arg[len(prefix):]), " ")
+	return strings.TrimSuffix(strings.TrimPrefix(path, "<"), ">")
+}
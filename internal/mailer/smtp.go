@@ -0,0 +1,131 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/smtp"
+	"strconv"
+	"time"
+)
+
+// How an SMTP connection is secured
+const (
+	TLSStartTLS = "starttls" // Upgrade a plain connection, usually on port 587
+	TLSImplicit = "tls"      // Connect with TLS, usually on port 465
+	TLSNone     = "none"     // Only for servers on localhost or a trusted network
+)
+
+// sendTimeout limits how long sending a message may take when the context
+// has no deadline
+const sendTimeout = time.Minute
+
+// SMTPConfig holds the settings for sending email through an SMTP server
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string // Authenticates with AUTH PLAIN when set
+	Password string
+	TLS      string // TLSStartTLS, TLSImplicit or TLSNone
+	From     string // Sender address, e.g. "print-dis <print@example.com>"
+
+	// TLSConfig overrides the TLS settings, e.g. to trust a private CA
+	TLSConfig *tls.Config
+}
+
+// SMTPMailer sends email through an SMTP server, with a new connection for
+// each message
+type SMTPMailer struct {
+	config SMTPConfig
+}
+
+// NewSMTPMailer creates a mailer that sends through an SMTP server
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{config: cfg}
+}
+
+// Send sends the message
+func (m *SMTPMailer) Send(ctx context.Context, msg Message) error {
+	data, sender, recipient, err := format(m.config.From, msg, time.Now())
+	if err != nil {
+		return err
+	}
+
+	client, err := m.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = client.Close() }()
+
+	if m.config.Username != "" {
+		// PlainAuth refuses to send the password over an unencrypted
+		// connection to anywhere but localhost
+		auth := smtp.PlainAuth("", m.config.Username, m.config.Password, m.config.Host)
+		if err := client.Auth(auth); err != nil {
+			return fmt.Errorf("failed to authenticate with SMTP server: %w", err)
+		}
+	}
+	if err := client.Mail(sender); err != nil {
+		return fmt.Errorf("SMTP server refused sender: %w", err)
+	}
+	if err := client.Rcpt(recipient); err != nil {
+		return fmt.Errorf("SMTP server refused recipient: %w", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP server refused message: %w", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to send message: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("SMTP server refused message: %w", err)
+	}
+	return client.Quit()
+}
+
+// dial connects to the SMTP server, securing the connection as configured
+func (m *SMTPMailer) dial(ctx context.Context) (*smtp.Client, error) {
+	tlsConfig := m.config.TLSConfig
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{}
+	}
+	tlsConfig = tlsConfig.Clone()
+	if tlsConfig.ServerName == "" {
+		tlsConfig.ServerName = m.config.Host
+	}
+
+	addr := net.JoinHostPort(m.config.Host, strconv.Itoa(m.config.Port))
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(sendTimeout)
+	}
+	_ = conn.SetDeadline(deadline)
+
+	if m.config.TLS == TLSImplicit {
+		conn = tls.Client(conn, tlsConfig)
+	}
+	client, err := smtp.NewClient(conn, m.config.Host)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("failed to connect to SMTP server: %w", err)
+	}
+
+	if m.config.TLS == TLSStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			_ = client.Close()
+			return nil, fmt.Errorf("SMTP server %s does not support STARTTLS", addr)
+		}
+		if err := client.StartTLS(tlsConfig); err != nil {
+			_ = client.Close()
+			return nil, fmt.Errorf("failed to start TLS with SMTP server: %w", err)
+		}
+	}
+	return client, nil
+}
@@ -0,0 +1,92 @@
+package middleware
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ClientIPKey is the context key for the client address worked out from a
+// trusted proxy's forwarding headers
+const ClientIPKey SessionContextKey = "client_ip"
+
+// ForwardedFor takes the client's address from the X-Forwarded-For or
+// X-Real-IP headers of requests sent by the given proxies, for ClientIP.
+// The headers are ignored on requests from anywhere else, since anyone can
+// set them.
+func ForwardedFor(trustedProxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if peer, ok := peerAddr(r); ok && inPrefixes(peer, trustedProxies) {
+				if client, ok := forwardedClient(r, trustedProxies); ok {
+					r = r.WithContext(context.WithValue(r.Context(), ClientIPKey, client.String()))
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the address the request came from: the client named by a
+// trusted proxy, if ForwardedFor found one, or otherwise the connection's peer
+func ClientIP(r *http.Request) string {
+	if ip, ok := r.Context().Value(ClientIPKey).(string); ok {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// forwardedClient returns the client named in the forwarding headers. Each
+// proxy appends the address it got the request from to X-Forwarded-For, so
+// the client is the last address that is not one of the trusted proxies;
+// anything before it may have been made up by the client.
+func forwardedClient(r *http.Request, trustedProxies []netip.Prefix) (netip.Addr, bool) {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	var client netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr.Unmap()
+		if !inPrefixes(client, trustedProxies) {
+			return client, true
+		}
+	}
+	if client.IsValid() {
+		return client, true
+	}
+
+	addr, err := netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP")))
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+// peerAddr returns the address of the connection the request came over
+func peerAddr(r *http.Request) (netip.Addr, bool) {
+	addrPort, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addrPort.Addr().Unmap(), true
+}
+
+// inPrefixes reports whether addr is in any of the prefixes
+func inPrefixes(addr netip.Addr, prefixes []netip.Prefix) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
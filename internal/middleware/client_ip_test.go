@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestForwardedFor(t *testing.T) {
+	proxies := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"direct request", "203.0.113.7:4321", nil, "203.0.113.7"},
+		{"spoofed forwarded for", "203.0.113.7:4321", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "203.0.113.7"},
+		{"spoofed real IP", "203.0.113.7:4321", map[string]string{"X-Real-IP": "198.51.100.1"}, "203.0.113.7"},
+		{"through proxy", "10.0.0.2:4321", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "198.51.100.1"},
+		{"client prepended an address", "10.0.0.2:4321", map[string]string{"X-Forwarded-For": "192.0.2.9, 198.51.100.1"}, "198.51.100.1"},
+		{"through two proxies", "10.0.0.2:4321", map[string]string{"X-Forwarded-For": "198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"real IP through proxy", "10.0.0.2:4321", map[string]string{"X-Real-IP": "198.51.100.1"}, "198.51.100.1"},
+		{"garbage through proxy", "10.0.0.2:4321", map[string]string{"X-Forwarded-For": "not-an-ip"}, "10.0.0.2"},
+		{"IPv6 peer", "[2001:db8::1]:4321", map[string]string{"X-Forwarded-For": "198.51.100.1"}, "2001:db8::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := ForwardedFor(proxies)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = ClientIP(r)
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for name, value := range tt.headers {
+				req.Header.Set(name, value)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.expected {
+				t.Errorf("Expected client IP %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+)
+
+// sessionTouchInterval limits how often a session's last activity is
+// recorded, so that every request does not write to the database
+const sessionTouchInterval = time.Minute
+
+// maxUserAgentLength limits the user agent stored with a session
+const maxUserAgentLength = 512
+
+// DBStore is a sessions.Store that keeps sessions in the user_sessions table,
+// so that they can be listed and revoked. The session cookie only holds a
+// random token, and only a hash of the token is stored.
+type DBStore struct {
+	db      database.DBClient
+	Options *sessions.Options
+}
+
+// NewDBStore creates a new database session store
+func NewDBStore(db database.DBClient, options *sessions.Options) *DBStore {
+	return &DBStore{
+		db:      db,
+		Options: options,
+	}
+}
+
+// Get returns the request's session, which is cached for the rest of the
+// request
+func (s *DBStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New loads the session whose token is in the request's cookie. If there is
+// none, or it has expired or been revoked, it returns a new empty session.
+func (s *DBStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := s.newSession(name)
+
+	cookie, err := r.Cookie(name)
+	if err != nil || cookie.Value == "" {
+		return session, nil
+	}
+
+	row, err := s.db.GetUserSessionByToken(r.Context(), hashSessionToken(cookie.Value))
+	if err != nil {
+		return session, err
+	}
+	if row == nil || time.Now().After(row.ExpiresAt) {
+		return session, nil
+	}
+	if err := decodeSessionValues(row.Data, &session.Values); err != nil {
+		return s.newSession(name), fmt.Errorf("failed to decode session: %w", err)
+	}
+	session.ID = cookie.Value
+	session.IsNew = false
+
+	if now := time.Now(); now.Sub(row.LastSeenAt) >= sessionTouchInterval {
+		if err := s.db.TouchUserSession(r.Context(), row.ID, now, ClientIP(r)); err != nil {
+			slog.Error("failed to record session activity", "error", err)
+		}
+	}
+
+	return session, nil
+}
+
+// Save stores the session and sets its cookie. A session whose MaxAge is
+// negative is deleted.
+func (s *DBStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	ctx := r.Context()
+
+	if session.Options.MaxAge < 0 {
+		if err := s.delete(r, session); err != nil {
+			return err
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	data, err := encodeSessionValues(session.Values)
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+	userID, _ := session.Values["user_id"].(string)
+	now := time.Now()
+	row := &models.UserSession{
+		UserID:     userID,
+		Data:       data,
+		ExpiresAt:  now.Add(time.Duration(session.Options.MaxAge) * time.Second),
+		LastSeenAt: now,
+	}
+
+	if session.ID == "" {
+		token := rand.Text()
+		userAgent := r.UserAgent()
+		if len(userAgent) > maxUserAgentLength {
+			userAgent = userAgent[:maxUserAgentLength]
+		}
+
+		row.ID = uuid.New().String()
+		row.SessionToken = hashSessionToken(token)
+		row.UserAgent = userAgent
+		row.IPAddress = ClientIP(r)
+		row.CreatedAt = now
+		if err := s.db.CreateUserSession(ctx, row); err != nil {
+			return err
+		}
+		session.ID = token
+	} else {
+		row.SessionToken = hashSessionToken(session.ID)
+		if err := s.db.UpdateUserSession(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	http.SetCookie(w, sessions.NewCookie(session.Name(), session.ID, session.Options))
+	return nil
+}
+
+// Current returns the stored session of the request, or nil if it has none
+func (s *DBStore) Current(r *http.Request, session *sessions.Session) (*models.UserSession, error) {
+	if session == nil || session.ID == "" {
+		return nil, nil
+	}
+	return s.db.GetUserSessionByToken(r.Context(), hashSessionToken(session.ID))
+}
+
+// newSession creates a new empty session that is not yet stored
+func (s *DBStore) newSession(name string) *sessions.Session {
+	session := sessions.NewSession(s, name)
+	options := *s.Options
+	session.Options = &options
+	session.IsNew = true
+	return session
+}
+
+// delete deletes a stored session
+func (s *DBStore) delete(r *http.Request, session *sessions.Session) error {
+	row, err := s.Current(r, session)
+	if err != nil || row == nil {
+		return err
+	}
+	return s.db.DeleteUserSession(r.Context(), row.ID)
+}
+
+// hashSessionToken hashes a session cookie's token for storage
+func hashSessionToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// encodeSessionValues encodes session values for storage. Values of types
+// other than basic ones must be registered with gob.
+func encodeSessionValues(values map[interface{}]interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(values); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// decodeSessionValues decodes stored session values
+func decodeSessionValues(data string, values *map[interface{}]interface{}) error {
+	if data == "" {
+		return nil
+	}
+	raw, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return err
+	}
+	return gob.NewDecoder(bytes.NewReader(raw)).Decode(values)
+}
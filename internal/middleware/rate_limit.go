@@ -104,7 +104,7 @@ func RateLimitByIP(maxRequests int, window time.Duration) func(http.Handler) htt
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Get client IP
-			ip := getClientIP(r)
+			ip := ClientIP(r)
 			
 			if !limiter.Allow(ip) {
 				response.WriteErrorResponse(w, http.StatusTooManyRequests, response.BadRequest, 
@@ -128,30 +128,3 @@ func APIRateLimit() func(http.Handler) http.Handler {
 	// General API: 100 requests per minute
 	return RateLimitByIP(100, time.Minute)
 }
-
-// getClientIP extracts the client IP from the request
-func getClientIP(r *http.Request) string {
-	// Check X-Forwarded-For header (for proxies)
-	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
-		// Take the first IP in the chain
-		return xff
-	}
-	
-	// Check X-Real-IP header (for proxies)
-	if xri := r.Header.Get("X-Real-IP"); xri != "" {
-		return xri
-	}
-	
-	// Fall back to RemoteAddr
-	ip := r.RemoteAddr
-	// Remove port if present
-	if colonIndex := len(ip) - 1; colonIndex > 0 {
-		for i := colonIndex; i >= 0; i-- {
-			if ip[i] == ':' {
-				return ip[:i]
-			}
-		}
-	}
-	
-	return ip
-}
\ No newline at end of file
@@ -10,6 +10,8 @@ import (
 
 	"github.com/bjschafer/print-dis/internal/config"
 	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
 	"github.com/gorilla/sessions"
 )
 
@@ -25,21 +27,30 @@ const (
 	SessionKey SessionContextKey = "session"
 )
 
+const (
+	// twoFactorLoginTimeout is how long a user has to enter their two-factor
+	// code after their password
+	twoFactorLoginTimeout = 5 * time.Minute
+	// maxTwoFactorAttempts is the number of wrong two-factor codes allowed
+	// before the user has to enter their password again
+	maxTwoFactorAttempts = 5
+)
+
 // SessionStore holds the session store for the application
 type SessionStore struct {
-	store sessions.Store
-	db    database.DBClient
+	store         *DBStore
+	db            database.DBClient
+	tokens        *services.TokenService
+	twoFactor     *services.TwoFactorService
+	trustedHeader *TrustedHeaderAuth
 }
 
 // NewSessionStore creates a new session store
 func NewSessionStore(cfg *config.Config, db database.DBClient) *SessionStore {
-	// Create session store with secret key
-	store := sessions.NewCookieStore([]byte(cfg.Auth.SessionSecret))
-
 	// Determine if we're in development mode (localhost)
 	isDev := cfg.Server.Host == "localhost" || cfg.Server.Host == "127.0.0.1" || cfg.Server.Host == "0.0.0.0"
 
-	store.Options = &sessions.Options{
+	options := &sessions.Options{
 		Path:     "/",
 		MaxAge:   int(cfg.Auth.SessionTimeout.Seconds()),
 		HttpOnly: true,
@@ -49,15 +60,26 @@ func NewSessionStore(cfg *config.Config, db database.DBClient) *SessionStore {
 
 	// In development, don't set a specific domain to allow both localhost and 127.0.0.1
 	if !isDev {
-		store.Options.Domain = cfg.Server.Host
+		options.Domain = cfg.Server.Host
 	}
 
+	// Sessions are stored in the database so that they can be revoked
+	store := NewDBStore(db, options)
+
 	return &SessionStore{
-		store: store,
-		db:    db,
+		store:     store,
+		db:        db,
+		tokens:    services.NewTokenService(db),
+		twoFactor: services.NewTwoFactorService(db, cfg.Auth.LocalAuth.TOTP),
 	}
 }
 
+// SetTrustedHeaderAuth makes AuthMiddleware accept users authenticated by a
+// trusted reverse proxy as well as logged-in users
+func (s *SessionStore) SetTrustedHeaderAuth(auth *TrustedHeaderAuth) {
+	s.trustedHeader = auth
+}
+
 // SessionMiddleware creates a middleware that handles session management
 func (s *SessionStore) SessionMiddleware() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
@@ -72,6 +94,14 @@ func (s *SessionStore) SessionMiddleware() func(http.Handler) http.Handler {
 				// so we can continue. The old invalid cookie will be overwritten on save.
 			}
 
+			// Requests with an API token are authenticated by the token alone,
+			// so they get an empty session rather than one from their cookies
+			if _, ok := bearerToken(r); ok {
+				withoutCookies := r.Clone(r.Context())
+				withoutCookies.Header.Del("Cookie")
+				session, _ = s.store.New(withoutCookies, "print-dis-session")
+			}
+
 			// Add session to context
 			ctx := context.WithValue(r.Context(), SessionKey, session)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -89,40 +119,49 @@ func (s *SessionStore) AuthMiddleware(cfg *config.Config) func(http.Handler) htt
 				return
 			}
 
-			// Get session from context
-			session, ok := r.Context().Value(SessionKey).(*sessions.Session)
-			if !ok {
-				slog.Error("session not found in context")
-				http.Error(w, "Session error", http.StatusInternalServerError)
+			user, status := s.authenticate(r)
+			if user == nil {
+				http.Error(w, http.StatusText(status), status)
 				return
 			}
+			userID := user.ID
 
-			// Check if user is authenticated
-			userID, ok := session.Values["user_id"].(string)
-			if !ok || userID == "" {
-				slog.Debug("user not authenticated", "path", r.URL.Path)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			if !user.Enabled {
+				slog.Info("disabled user attempted access", "user_id", userID)
+				http.Error(w, "Account disabled", http.StatusForbidden)
 				return
 			}
 
-			// Fetch the full user object
-			user, err := s.db.GetUser(r.Context(), userID)
-			if err != nil {
-				slog.Error("failed to get user", "error", err, "user_id", userID)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			// Users given a temporary password by an admin must choose their
+			// own before doing anything else, including with API tokens
+			if user.MustChangePassword && !allowedBeforePasswordChange(r.URL.Path) {
+				http.Error(w, "Password must be changed", http.StatusForbidden)
 				return
 			}
 
-			if user == nil {
-				slog.Warn("user not found", "user_id", userID)
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
-				return
+			// Users whose role requires two-factor authentication can only
+			// set it up until they have
+			if user.Token == nil && s.twoFactor.IsRequired(user) && !allowedBeforeTwoFactorSetup(r.URL.Path) {
+				enabled, err := s.twoFactor.IsEnabled(r.Context(), userID)
+				if err != nil {
+					slog.Error("failed to check two-factor authentication", "error", err, "user_id", userID)
+					http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+					return
+				}
+				if !enabled {
+					http.Error(w, "Two-factor authentication must be set up", http.StatusForbidden)
+					return
+				}
 			}
 
-			if !user.Enabled {
-				slog.Info("disabled user attempted access", "user_id", userID)
-				http.Error(w, "Account disabled", http.StatusForbidden)
-				return
+			// Load group memberships for group-scoped permission checks. Without
+			// them the user only has the permissions of their global role.
+			memberships, err := s.db.ListGroupMembershipsByUserID(r.Context(), userID)
+			if err != nil {
+				slog.Error("failed to get group memberships", "error", err, "user_id", userID)
+			}
+			for _, membership := range memberships {
+				user.Memberships = append(user.Memberships, *membership)
 			}
 
 			// Add user ID and full user object to context
@@ -133,6 +172,103 @@ func (s *SessionStore) AuthMiddleware(cfg *config.Config) func(http.Handler) htt
 	}
 }
 
+// authenticate finds the user making the request, from their API token, the
+// trusted proxy headers if enabled, or otherwise their session. On failure it returns
+// the status to respond with.
+func (s *SessionStore) authenticate(r *http.Request) (*models.User, int) {
+	if secret, ok := bearerToken(r); ok {
+		return s.authenticateToken(r, secret)
+	}
+
+	if s.trustedHeader != nil {
+		user, err := s.trustedHeader.Authenticate(r)
+		if err != nil {
+			slog.Error("failed to authenticate user from proxy headers", "error", err)
+			return nil, http.StatusInternalServerError
+		}
+		if user != nil {
+			return user, 0
+		}
+	}
+
+	// Get session from context
+	session, ok := r.Context().Value(SessionKey).(*sessions.Session)
+	if !ok {
+		slog.Error("session not found in context")
+		return nil, http.StatusInternalServerError
+	}
+
+	// Check if user is authenticated
+	userID, ok := session.Values["user_id"].(string)
+	if !ok || userID == "" {
+		slog.Debug("user not authenticated", "path", r.URL.Path)
+		return nil, http.StatusUnauthorized
+	}
+
+	// Fetch the full user object
+	user, err := s.db.GetUser(r.Context(), userID)
+	if err != nil {
+		slog.Error("failed to get user", "error", err, "user_id", userID)
+		return nil, http.StatusUnauthorized
+	}
+
+	if user == nil {
+		slog.Warn("user not found", "user_id", userID)
+		return nil, http.StatusUnauthorized
+	}
+
+	return user, 0
+}
+
+// authenticateToken finds the user an API token belongs to, limiting their
+// permissions to the token's scopes
+func (s *SessionStore) authenticateToken(r *http.Request, secret string) (*models.User, int) {
+	token, err := s.tokens.Authenticate(r.Context(), secret)
+	if err != nil {
+		slog.Error("failed to authenticate API token", "error", err)
+		return nil, http.StatusInternalServerError
+	}
+	if token == nil {
+		slog.Debug("invalid or expired API token", "path", r.URL.Path)
+		return nil, http.StatusUnauthorized
+	}
+
+	user, err := s.db.GetUser(r.Context(), token.UserID)
+	if err != nil {
+		slog.Error("failed to get user", "error", err, "user_id", token.UserID)
+		return nil, http.StatusUnauthorized
+	}
+	if user == nil {
+		slog.Warn("API token for missing user", "token_id", token.ID, "user_id", token.UserID)
+		return nil, http.StatusUnauthorized
+	}
+
+	user.Token = token
+	return user, 0
+}
+
+// allowedBeforeTwoFactorSetup reports whether a path can be used by users who
+// must set up two-factor authentication but have not yet
+func allowedBeforeTwoFactorSetup(path string) bool {
+	return path == "/api/auth/me" || path == "/api/auth/2fa" || strings.HasPrefix(path, "/api/auth/2fa/")
+}
+
+// allowedBeforePasswordChange reports whether a path can be used by users who
+// must change their temporary password but have not yet
+func allowedBeforePasswordChange(path string) bool {
+	return path == "/api/auth/me" || path == "/api/auth/change-password"
+}
+
+// bearerToken returns the token from the request's Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
 // GetUserID retrieves the user ID from the request context
 func GetUserID(r *http.Request) string {
 	if userID, ok := r.Context().Value(UserIDKey).(string); ok {
@@ -141,6 +277,15 @@ func GetUserID(r *http.Request) string {
 	return ""
 }
 
+// GetUser retrieves the authenticated user from the request context. It
+// returns nil when authentication is disabled.
+func GetUser(r *http.Request) *models.User {
+	if user, ok := r.Context().Value(UserKey).(*models.User); ok {
+		return user
+	}
+	return nil
+}
+
 // GetSession retrieves the session from the request context
 func GetSession(r *http.Request) *sessions.Session {
 	if session, ok := r.Context().Value(SessionKey).(*sessions.Session); ok {
@@ -174,16 +319,68 @@ func (s *SessionStore) LogoutUser(w http.ResponseWriter, r *http.Request) error
 
 // RegenerateSession regenerates the session ID to prevent session fixation attacks
 func (s *SessionStore) RegenerateSession(w http.ResponseWriter, r *http.Request, userID string) error {
-	// Create a completely new session - don't try to invalidate old one as that
-	// can cause issues with shared Options objects in gorilla/sessions
-	newSession, err := s.store.New(r, "print-dis-session")
-	if err != nil {
-		return fmt.Errorf("failed to create new session: %w", err)
+	return s.replaceSession(w, r, map[string]interface{}{
+		"user_id":    userID,
+		"created_at": time.Now(),
+	})
+}
+
+// BeginTwoFactorLogin replaces the session with a partial one, recording
+// that the user has entered their password but not yet their two-factor code
+func (s *SessionStore) BeginTwoFactorLogin(w http.ResponseWriter, r *http.Request, userID string) error {
+	return s.replaceSession(w, r, map[string]interface{}{
+		"two_factor_user_id":  userID,
+		"two_factor_started":  time.Now(),
+		"two_factor_attempts": 0,
+	})
+}
+
+// PendingTwoFactorUser returns the user whose two-factor code the session is
+// waiting for, or "" if there is none or it has timed out
+func (s *SessionStore) PendingTwoFactorUser(r *http.Request) string {
+	session := GetSession(r)
+	if session == nil {
+		return ""
+	}
+	userID, _ := session.Values["two_factor_user_id"].(string)
+	started, _ := session.Values["two_factor_started"].(time.Time)
+	if userID == "" || time.Since(started) > twoFactorLoginTimeout {
+		return ""
 	}
+	return userID
+}
 
-	// Set user in new session
-	newSession.Values["user_id"] = userID
-	newSession.Values["created_at"] = time.Now()
+// RecordTwoFactorFailure counts a wrong two-factor code, ending the partial
+// login after too many
+func (s *SessionStore) RecordTwoFactorFailure(w http.ResponseWriter, r *http.Request) error {
+	session := GetSession(r)
+	if session == nil {
+		return fmt.Errorf("session not found")
+	}
+
+	attempts, _ := session.Values["two_factor_attempts"].(int)
+	attempts++
+	if attempts >= maxTwoFactorAttempts {
+		delete(session.Values, "two_factor_user_id")
+		delete(session.Values, "two_factor_started")
+	}
+	session.Values["two_factor_attempts"] = attempts
+	return session.Save(r, w)
+}
+
+// replaceSession ends the request's session and starts a new one holding
+// values, so that the new session's token cannot have been planted beforehand
+func (s *SessionStore) replaceSession(w http.ResponseWriter, r *http.Request, values map[string]interface{}) error {
+	// End the old session so that its token cannot be used again
+	if err := s.store.delete(r, GetSession(r)); err != nil {
+		return fmt.Errorf("failed to delete old session: %w", err)
+	}
+
+	// Create a completely new session rather than reusing the old one's ID
+	newSession := s.store.newSession("print-dis-session")
+	for key, value := range values {
+		newSession.Values[key] = value
+	}
 
 	// Save new session - this will overwrite any existing cookie
 	if err := newSession.Save(r, w); err != nil {
@@ -193,6 +390,20 @@ func (s *SessionStore) RegenerateSession(w http.ResponseWriter, r *http.Request,
 	return nil
 }
 
+// CurrentSessionID returns the ID of the request's stored session, or "" if
+// it has none, e.g. because it was authenticated with an API token
+func (s *SessionStore) CurrentSessionID(r *http.Request) string {
+	current, err := s.store.Current(r, GetSession(r))
+	if err != nil {
+		slog.Error("failed to get current session", "error", err)
+		return ""
+	}
+	if current == nil {
+		return ""
+	}
+	return current.ID
+}
+
 // isHTTPS determines if HTTPS should be used based on configuration
 func isHTTPS(cfg *config.Config) bool {
 	// Check if explicitly configured
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+// TrustedHeaderAuth authenticates users from headers set by an authenticating
+// reverse proxy, such as Authelia or oauth2-proxy
+type TrustedHeaderAuth struct {
+	config      config.TrustedHeaderConfig
+	userService *services.UserService
+}
+
+// NewTrustedHeaderAuth creates a new trusted header authenticator
+func NewTrustedHeaderAuth(cfg config.TrustedHeaderConfig, userService *services.UserService) *TrustedHeaderAuth {
+	return &TrustedHeaderAuth{
+		config:      cfg,
+		userService: userService,
+	}
+}
+
+// Authenticate returns the user asserted by the proxy's headers, creating them
+// on their first request. It returns nil if the request did not come through a
+// trusted proxy or carries no user header, so that anyone who can reach the
+// server directly cannot log in by setting the headers themselves.
+func (a *TrustedHeaderAuth) Authenticate(r *http.Request) (*models.User, error) {
+	username := strings.TrimSpace(r.Header.Get(a.config.UserHeader))
+	if username == "" || !a.fromTrustedProxy(r) {
+		return nil, nil
+	}
+
+	profile := services.ProxyProfile{
+		Username:    username,
+		Email:       strings.TrimSpace(r.Header.Get(a.config.EmailHeader)),
+		DisplayName: strings.TrimSpace(r.Header.Get(a.config.NameHeader)),
+	}
+	if len(a.config.RoleMap) > 0 {
+		profile.Role = services.RoleFromGroups(a.config.RoleMap, splitGroups(r.Header.Get(a.config.GroupsHeader)))
+	}
+
+	return a.userService.FindOrCreateUserFromProxy(r.Context(), profile)
+}
+
+// fromTrustedProxy reports whether the request's peer is a configured proxy
+func (a *TrustedHeaderAuth) fromTrustedProxy(r *http.Request) bool {
+	peer, ok := peerAddr(r)
+	return ok && inPrefixes(peer, a.config.TrustedProxies)
+}
+
+// splitGroups splits a comma-separated groups header
+func splitGroups(header string) []string {
+	var groups []string
+	for _, group := range strings.Split(header, ",") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
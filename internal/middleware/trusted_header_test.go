@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/migrations"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/services"
+)
+
+func TestTrustedHeaderAuth(t *testing.T) {
+	db, err := database.NewDBClient(&database.Config{Type: "sqlite", Database: filepath.Join(t.TempDir(), "test.db")})
+	if err != nil {
+		t.Fatalf("Failed to create database: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	if err := migrations.NewMigrator(db.GetDB(), "sqlite").Up(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	cfg := &config.Config{
+		Server: config.ServerConfig{Host: "localhost", Port: "8080"},
+		Auth: config.AuthConfig{
+			Enabled:        true,
+			SessionSecret:  "test-session-secret-that-is-long-enough",
+			SessionTimeout: time.Hour,
+			TrustedHeader: config.TrustedHeaderConfig{
+				Enabled:        true,
+				UserHeader:     "Remote-User",
+				EmailHeader:    "Remote-Email",
+				NameHeader:     "Remote-Name",
+				GroupsHeader:   "Remote-Groups",
+				TrustedProxies: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")},
+				RoleMap:        []config.RoleMappingConfig{{Group: "print-admins", Role: "admin"}},
+			},
+		},
+	}
+
+	store := NewSessionStore(cfg, db)
+	store.SetTrustedHeaderAuth(NewTrustedHeaderAuth(cfg.Auth.TrustedHeader, services.NewUserService(db)))
+	handler := store.SessionMiddleware()(store.AuthMiddleware(cfg)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(GetUser(r).Role))
+	})))
+
+	request := func(remoteAddr string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/auth/me", nil)
+		req.RemoteAddr = remoteAddr
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("headers from an untrusted address are ignored", func(t *testing.T) {
+		rec := request("192.168.1.5:40000", map[string]string{"Remote-User": "mallory", "Remote-Groups": "print-admins"})
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", rec.Code)
+		}
+		if user, _ := db.GetUserByUsername(context.Background(), "mallory"); user != nil {
+			t.Error("Expected no user to be created")
+		}
+	})
+
+	t.Run("request from a trusted proxy without a user header", func(t *testing.T) {
+		if rec := request("10.1.2.3:40000", nil); rec.Code != http.StatusUnauthorized {
+			t.Errorf("Expected 401, got %d", rec.Code)
+		}
+	})
+
+	t.Run("user is created on their first request", func(t *testing.T) {
+		rec := request("10.1.2.3:40000", map[string]string{
+			"Remote-User":   "alice",
+			"Remote-Email":  "alice@example.com",
+			"Remote-Name":   "Alice",
+			"Remote-Groups": "staff, print-admins",
+		})
+		if rec.Code != http.StatusOK || rec.Body.String() != string(models.RoleAdmin) {
+			t.Fatalf("Expected admin to be authenticated, got %d %q", rec.Code, rec.Body.String())
+		}
+
+		user, err := db.GetUserByUsername(context.Background(), "alice")
+		if err != nil || user == nil {
+			t.Fatalf("Expected user to be created, got %v", err)
+		}
+		if user.Email == nil || *user.Email != "alice@example.com" || user.DisplayName == nil || *user.DisplayName != "Alice" {
+			t.Errorf("Unexpected user %+v", user)
+		}
+	})
+
+	t.Run("role follows the user's groups", func(t *testing.T) {
+		rec := request("[::ffff:10.1.2.3]:40000", map[string]string{"Remote-User": "alice", "Remote-Groups": "staff"})
+		if rec.Code != http.StatusOK || rec.Body.String() != string(models.RoleUser) {
+			t.Errorf("Expected role to be synced to user, got %d %q", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("disabled users are refused", func(t *testing.T) {
+		user, _ := db.GetUserByUsername(context.Background(), "alice")
+		user.Enabled = false
+		if err := db.UpdateUser(context.Background(), user); err != nil {
+			t.Fatalf("Failed to disable user: %v", err)
+		}
+		if rec := request("10.1.2.3:40000", map[string]string{"Remote-User": "alice"}); rec.Code != http.StatusForbidden {
+			t.Errorf("Expected 403, got %d", rec.Code)
+		}
+	})
+}
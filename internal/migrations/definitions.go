@@ -7,7 +7,28 @@ func getAllMigrations(dbType string) []Migration {
 	migration002Up, migration002Down := getMigration002SQL(dbType)
 	migration003Up, migration003Down := getMigration003SQL(dbType)
 	migration004Up, migration004Down := GetMigration004SQL(dbType)
-	
+	migration005Up, migration005Down := getMigration005SQL(dbType)
+	migration006Up, migration006Down := getMigration006SQL(dbType)
+	migration007Up, migration007Down := getMigration007SQL(dbType)
+	migration008Up, migration008Down := getMigration008SQL(dbType)
+	migration009Up, migration009Down := getMigration009SQL(dbType)
+	migration010Up, migration010Down := getMigration010SQL(dbType)
+	migration011Up, migration011Down := getMigration011SQL(dbType)
+	migration012Up, migration012Down := getMigration012SQL(dbType)
+	migration013Up, migration013Down := getMigration013SQL(dbType)
+	migration014Up, migration014Down := getMigration014SQL(dbType)
+	migration015Up, migration015Down := getMigration015SQL(dbType)
+	migration016Up, migration016Down := getMigration016SQL(dbType)
+	migration017Up, migration017Down := getMigration017SQL(dbType)
+	migration018Up, migration018Down := getMigration018SQL(dbType)
+	migration019Up, migration019Down := getMigration019SQL(dbType)
+	migration020Up, migration020Down := getMigration020SQL(dbType)
+	migration021Up, migration021Down := getMigration021SQL(dbType)
+	migration022Up, migration022Down := getMigration022SQL(dbType)
+	migration023Up, migration023Down := getMigration023SQL(dbType)
+	migration024Up, migration024Down := getMigration024SQL(dbType)
+	migration025Up, migration025Down := getMigration025SQL(dbType)
+
 	return []Migration{
 		{
 			Version:     1,
@@ -33,6 +54,132 @@ func getAllMigrations(dbType string) []Migration {
 			UpSQL:       migration004Up,
 			DownSQL:     migration004Down,
 		},
+		{
+			Version:     5,
+			Description: "Align print_requests columns with the PrintRequest model",
+			UpSQL:       migration005Up,
+			DownSQL:     migration005Down,
+		},
+		{
+			Version:     6,
+			Description: "Add spool_needs_replacement to print_requests",
+			UpSQL:       migration006Up,
+			DownSQL:     migration006Down,
+		},
+		{
+			Version:     7,
+			Description: "Add printer_id to print_requests",
+			UpSQL:       migration007Up,
+			DownSQL:     migration007Down,
+		},
+		{
+			Version:     8,
+			Description: "Add local filament inventory",
+			UpSQL:       migration008Up,
+			DownSQL:     migration008Down,
+		},
+		{
+			Version:     9,
+			Description: "Add usage and cost estimates to print_requests",
+			UpSQL:       migration009Up,
+			DownSQL:     migration009Down,
+		},
+		{
+			Version:     10,
+			Description: "Create charges and payments tables for billing",
+			UpSQL:       migration010Up,
+			DownSQL:     migration010Down,
+		},
+		{
+			Version:     11,
+			Description: "Create quota_overrides table for per-user and per-role quotas",
+			UpSQL:       migration011Up,
+			DownSQL:     migration011Down,
+		},
+		{
+			Version:     12,
+			Description: "Create groups and group_memberships tables and add group_id to print_requests",
+			UpSQL:       migration012Up,
+			DownSQL:     migration012Down,
+		},
+		{
+			Version:     13,
+			Description: "Create roles and role_permissions tables seeded with the built-in roles",
+			UpSQL:       migration013Up,
+			DownSQL:     migration013Down,
+		},
+		{
+			Version:     14,
+			Description: "Create api_tokens table for personal access tokens",
+			UpSQL:       migration014Up,
+			DownSQL:     migration014Down,
+		},
+		{
+			Version:     15,
+			Description: "Recreate user_sessions for database-backed sessions",
+			UpSQL:       migration015Up,
+			DownSQL:     migration015Down,
+		},
+		{
+			Version:     16,
+			Description: "Create user_totp and user_recovery_codes tables for two-factor authentication",
+			UpSQL:       migration016Up,
+			DownSQL:     migration016Down,
+		},
+		{
+			Version:     17,
+			Description: "Create user_webauthn_credentials table for security keys and passkeys",
+			UpSQL:       migration017Up,
+			DownSQL:     migration017Down,
+		},
+		{
+			Version:     18,
+			Description: "Add email tokens and email verification",
+			UpSQL:       migration018Up,
+			DownSQL:     migration018Down,
+		},
+		{
+			Version:     19,
+			Description: "Create login_attempts table for account lockout",
+			UpSQL:       migration019Up,
+			DownSQL:     migration019Down,
+		},
+		{
+			Version:     20,
+			Description: "Create invitations table for invite-only registration",
+			UpSQL:       migration020Up,
+			DownSQL:     migration020Down,
+		},
+		{
+			Version:     21,
+			Description: "Create user_ldap_identities table for LDAP logins",
+			UpSQL:       migration021Up,
+			DownSQL:     migration021Down,
+		},
+		{
+			Version:     22,
+			Description: "Add must_change_password to users and a placeholder for deleted users",
+			UpSQL:       migration022Up,
+			DownSQL:     migration022Down,
+		},
+		{
+			Version:     23,
+			Description: "Create audit_events table and grant view_audit_log to admins",
+			UpSQL:       migration023Up,
+			DownSQL:     migration023Down,
+		},
+		{
+			Version:     24,
+			Description: "Create print_request_status_events table",
+			UpSQL:       migration024Up,
+			DownSQL:     migration024Down,
+		},
+		{
+			Version:     25,
+			Description: "Store ledger amounts in integer cents",
+			UpSQL:       migration025Up,
+			DownSQL:     migration025Down,
+		},
 	}
 }
 
@@ -74,4 +221,164 @@ func GetMigration004SQL(dbType string) (string, string) {
 	default: // sqlite
 		return migration004Up_SQLite, migration004Down_SQLite
 	}
-}
\ No newline at end of file
+}
+
+// getMigration005SQL returns database-specific SQL for migration 005
+func getMigration005SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration005Up_Postgres, migration005Down_Postgres
+	default: // sqlite
+		return migration005Up_SQLite, migration005Down_SQLite
+	}
+}
+
+// getMigration006SQL returns SQL for migration 006, which is the same for both databases
+func getMigration006SQL(dbType string) (string, string) {
+	return migration006Up, migration006Down
+}
+
+// getMigration007SQL returns SQL for migration 007, which is the same for both databases
+func getMigration007SQL(dbType string) (string, string) {
+	return migration007Up, migration007Down
+}
+
+// getMigration008SQL returns database-specific SQL for migration 008
+func getMigration008SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration008Up_Postgres, migration008Down
+	default: // sqlite
+		return migration008Up_SQLite, migration008Down
+	}
+}
+
+// getMigration009SQL returns database-specific SQL for migration 009
+func getMigration009SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration009Up_Postgres, migration009Down
+	default: // sqlite
+		return migration009Up_SQLite, migration009Down
+	}
+}
+
+// getMigration010SQL returns database-specific SQL for migration 010
+func getMigration010SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration010Up_Postgres, migration010Down
+	default: // sqlite
+		return migration010Up_SQLite, migration010Down
+	}
+}
+
+// getMigration011SQL returns database-specific SQL for migration 011
+func getMigration011SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration011Up_Postgres, migration011Down
+	default: // sqlite
+		return migration011Up_SQLite, migration011Down
+	}
+}
+
+// getMigration012SQL returns database-specific SQL for migration 012
+func getMigration012SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration012Up_Postgres, migration012Down
+	default: // sqlite
+		return migration012Up_SQLite, migration012Down
+	}
+}
+
+// getMigration013SQL returns database-specific SQL for migration 013
+func getMigration013SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration013Up_Postgres, migration013Down
+	default: // sqlite
+		return migration013Up_SQLite, migration013Down
+	}
+}
+
+// getMigration014SQL returns database-specific SQL for migration 014
+func getMigration014SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration014Up_Postgres, migration014Down
+	default: // sqlite
+		return migration014Up_SQLite, migration014Down
+	}
+}
+
+// getMigration015SQL returns database-specific SQL for migration 015
+func getMigration015SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration015Up_Postgres, migration015Down
+	default: // sqlite
+		return migration015Up_SQLite, migration015Down
+	}
+}
+
+// getMigration016SQL returns database-specific SQL for migration 016
+func getMigration016SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration016Up_Postgres, migration016Down
+	default: // sqlite
+		return migration016Up_SQLite, migration016Down
+	}
+}
+
+// getMigration017SQL returns database-specific SQL for migration 017
+func getMigration017SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration017Up_Postgres, migration017Down
+	default: // sqlite
+		return migration017Up_SQLite, migration017Down
+	}
+}
+
+// getMigration018SQL returns database-specific SQL for migration 018
+func getMigration018SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration018Up_Postgres, migration018Down
+	default: // sqlite
+		return migration018Up_SQLite, migration018Down
+	}
+}
+
+// getMigration019SQL returns database-specific SQL for migration 019
+func getMigration019SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration019Up_Postgres, migration019Down
+	default: // sqlite
+		return migration019Up_SQLite, migration019Down
+	}
+}
+
+// getMigration020SQL returns database-specific SQL for migration 020
+func getMigration020SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration020Up_Postgres, migration020Down
+	default: // sqlite
+		return migration020Up_SQLite, migration020Down
+	}
+}
+
+// getMigration021SQL returns database-specific SQL for migration 021
+func getMigration021SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration021Up_Postgres, migration021Down
+	default: // sqlite
+		return migration021Up_SQLite, migration021Down
+	}
+}
@@ -372,4 +372,1119 @@ END;
 
 -- Drop the spool_id index
 DROP INDEX IF EXISTS idx_print_requests_spool_id;
-`
\ No newline at end of file
+`
+
+// Migration 005: Align print_requests with the PrintRequest model - SQLite version
+const migration005Up_SQLite = `
+-- The original table had submitter/description/comments columns that the
+-- application never wrote, and no notes column that it does
+CREATE TABLE print_requests_new (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users(id),
+	file_link TEXT,
+	notes TEXT,
+	status INTEGER NOT NULL DEFAULT 0,
+	material TEXT,
+	color TEXT,
+	spool_id INTEGER,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Copy data, converting status names to their numeric values
+INSERT INTO print_requests_new (id, user_id, file_link, notes, status, material, color, spool_id, created_at, updated_at)
+SELECT
+	id, user_id, file_link,
+	COALESCE(comments, description) as notes,
+	CASE status
+		WHEN 'StatusPendingApproval' THEN 0
+		WHEN 'StatusEnqueued' THEN 1
+		WHEN 'StatusInProgress' THEN 2
+		WHEN 'StatusDone' THEN 3
+		ELSE CAST(status AS INTEGER)
+	END as status,
+	material, color, spool_id, created_at, updated_at
+FROM print_requests;
+
+-- Drop old table and rename new one
+DROP TABLE print_requests;
+ALTER TABLE print_requests_new RENAME TO print_requests;
+
+-- Recreate indexes
+CREATE INDEX IF NOT EXISTS idx_print_requests_user_id ON print_requests(user_id);
+CREATE INDEX IF NOT EXISTS idx_print_requests_status ON print_requests(status);
+CREATE INDEX IF NOT EXISTS idx_print_requests_created_at ON print_requests(created_at);
+CREATE INDEX IF NOT EXISTS idx_print_requests_spool_id ON print_requests(spool_id);
+`
+
+// Migration 005: Align print_requests with the PrintRequest model - PostgreSQL version
+const migration005Up_Postgres = `
+ALTER TABLE print_requests ADD COLUMN notes TEXT;
+UPDATE print_requests SET notes = COALESCE(comments, description);
+ALTER TABLE print_requests DROP COLUMN submitter;
+ALTER TABLE print_requests DROP COLUMN description;
+ALTER TABLE print_requests DROP COLUMN comments;
+
+-- Convert status names to their numeric values
+ALTER TABLE print_requests ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE print_requests
+ALTER COLUMN status TYPE INTEGER
+USING CASE status
+	WHEN 'StatusPendingApproval' THEN 0
+	WHEN 'StatusEnqueued' THEN 1
+	WHEN 'StatusInProgress' THEN 2
+	WHEN 'StatusDone' THEN 3
+	ELSE status::INTEGER
+END;
+ALTER TABLE print_requests ALTER COLUMN status SET DEFAULT 0;
+`
+
+// Migration 005 rollback - SQLite version
+const migration005Down_SQLite = `
+CREATE TABLE print_requests_new (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users(id),
+	submitter TEXT NOT NULL,
+	description TEXT,
+	file_link TEXT,
+	status TEXT NOT NULL DEFAULT 'StatusPendingApproval',
+	material TEXT,
+	color TEXT,
+	spool_id INTEGER,
+	comments TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO print_requests_new (id, user_id, submitter, file_link, status, material, color, spool_id, comments, created_at, updated_at)
+SELECT
+	id, user_id, user_id as submitter, file_link,
+	CASE status
+		WHEN 0 THEN 'StatusPendingApproval'
+		WHEN 1 THEN 'StatusEnqueued'
+		WHEN 2 THEN 'StatusInProgress'
+		WHEN 3 THEN 'StatusDone'
+		ELSE CAST(status AS TEXT)
+	END as status,
+	material, color, spool_id, notes as comments, created_at, updated_at
+FROM print_requests;
+
+DROP TABLE print_requests;
+ALTER TABLE print_requests_new RENAME TO print_requests;
+
+CREATE INDEX IF NOT EXISTS idx_print_requests_user_id ON print_requests(user_id);
+CREATE INDEX IF NOT EXISTS idx_print_requests_status ON print_requests(status);
+CREATE INDEX IF NOT EXISTS idx_print_requests_created_at ON print_requests(created_at);
+CREATE INDEX IF NOT EXISTS idx_print_requests_spool_id ON print_requests(spool_id);
+`
+
+// Migration 005 rollback - PostgreSQL version
+const migration005Down_Postgres = `
+ALTER TABLE print_requests ALTER COLUMN status DROP DEFAULT;
+ALTER TABLE print_requests
+ALTER COLUMN status TYPE TEXT
+USING CASE status
+	WHEN 0 THEN 'StatusPendingApproval'
+	WHEN 1 THEN 'StatusEnqueued'
+	WHEN 2 THEN 'StatusInProgress'
+	WHEN 3 THEN 'StatusDone'
+	ELSE status::TEXT
+END;
+ALTER TABLE print_requests ALTER COLUMN status SET DEFAULT 'StatusPendingApproval';
+
+ALTER TABLE print_requests ADD COLUMN submitter TEXT;
+UPDATE print_requests SET submitter = user_id;
+ALTER TABLE print_requests ALTER COLUMN submitter SET NOT NULL;
+ALTER TABLE print_requests ADD COLUMN description TEXT;
+ALTER TABLE print_requests ADD COLUMN comments TEXT;
+UPDATE print_requests SET comments = notes;
+ALTER TABLE print_requests DROP COLUMN notes;
+`
+
+// Migration 006: Track print requests whose spool became unavailable - shared SQL
+const migration006Up = `
+ALTER TABLE print_requests ADD COLUMN spool_needs_replacement BOOLEAN NOT NULL DEFAULT FALSE;
+`
+
+// Migration 006 rollback - shared SQL (SQLite supports DROP COLUMN since 3.35)
+const migration006Down = `
+ALTER TABLE print_requests DROP COLUMN spool_needs_replacement;
+`
+
+// Migration 007: Assign print requests to printers - shared SQL
+const migration007Up = `
+ALTER TABLE print_requests ADD COLUMN printer_id INTEGER;
+`
+
+// Migration 007 rollback - shared SQL
+const migration007Down = `
+ALTER TABLE print_requests DROP COLUMN printer_id;
+`
+
+// Migration 008: Local filament inventory - SQLite version
+const migration008Up_SQLite = `
+-- Filament details needed to describe spools without Spoolman
+ALTER TABLE filaments ADD COLUMN vendor TEXT NOT NULL DEFAULT '';
+ALTER TABLE filaments ADD COLUMN color_hex TEXT NOT NULL DEFAULT '';
+ALTER TABLE filaments ADD COLUMN weight REAL NOT NULL DEFAULT 0;
+ALTER TABLE filaments ADD COLUMN price REAL NOT NULL DEFAULT 0;
+ALTER TABLE filaments ADD COLUMN settings_extruder_temp INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE filaments ADD COLUMN settings_bed_temp INTEGER NOT NULL DEFAULT 0;
+
+-- Spools of filament in the local inventory
+CREATE TABLE IF NOT EXISTS spools (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	filament_id INTEGER NOT NULL,
+	initial_weight REAL NOT NULL DEFAULT 0,
+	remaining_weight REAL NOT NULL DEFAULT 0,
+	location TEXT NOT NULL DEFAULT '',
+	lot_nr TEXT NOT NULL DEFAULT '',
+	comment TEXT NOT NULL DEFAULT '',
+	archived BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (filament_id) REFERENCES filaments(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_spools_filament_id ON spools(filament_id);
+`
+
+// Migration 008: Local filament inventory - PostgreSQL version
+const migration008Up_Postgres = `
+-- Filament details needed to describe spools without Spoolman
+ALTER TABLE filaments ADD COLUMN vendor TEXT NOT NULL DEFAULT '';
+ALTER TABLE filaments ADD COLUMN color_hex TEXT NOT NULL DEFAULT '';
+ALTER TABLE filaments ADD COLUMN weight REAL NOT NULL DEFAULT 0;
+ALTER TABLE filaments ADD COLUMN price REAL NOT NULL DEFAULT 0;
+ALTER TABLE filaments ADD COLUMN settings_extruder_temp INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE filaments ADD COLUMN settings_bed_temp INTEGER NOT NULL DEFAULT 0;
+
+-- Spools of filament in the local inventory
+CREATE TABLE IF NOT EXISTS spools (
+	id SERIAL PRIMARY KEY,
+	filament_id INTEGER NOT NULL,
+	initial_weight REAL NOT NULL DEFAULT 0,
+	remaining_weight REAL NOT NULL DEFAULT 0,
+	location TEXT NOT NULL DEFAULT '',
+	lot_nr TEXT NOT NULL DEFAULT '',
+	comment TEXT NOT NULL DEFAULT '',
+	archived BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	FOREIGN KEY (filament_id) REFERENCES filaments(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_spools_filament_id ON spools(filament_id);
+`
+
+// Migration 008 rollback - shared SQL
+const migration008Down = `
+DROP INDEX IF EXISTS idx_spools_filament_id;
+DROP TABLE IF EXISTS spools;
+
+ALTER TABLE filaments DROP COLUMN settings_bed_temp;
+ALTER TABLE filaments DROP COLUMN settings_extruder_temp;
+ALTER TABLE filaments DROP COLUMN price;
+ALTER TABLE filaments DROP COLUMN weight;
+ALTER TABLE filaments DROP COLUMN color_hex;
+ALTER TABLE filaments DROP COLUMN vendor;
+`
+
+// Migration 009: Estimated and actual usage and cost of print requests - SQLite version
+const migration009Up_SQLite = `
+ALTER TABLE print_requests ADD COLUMN estimated_grams REAL;
+ALTER TABLE print_requests ADD COLUMN estimated_hours REAL;
+ALTER TABLE print_requests ADD COLUMN estimated_cost REAL;
+ALTER TABLE print_requests ADD COLUMN actual_grams REAL;
+ALTER TABLE print_requests ADD COLUMN actual_hours REAL;
+ALTER TABLE print_requests ADD COLUMN actual_cost REAL;
+`
+
+// Migration 009: Estimated and actual usage and cost of print requests - PostgreSQL version
+const migration009Up_Postgres = `
+ALTER TABLE print_requests ADD COLUMN estimated_grams DOUBLE PRECISION;
+ALTER TABLE print_requests ADD COLUMN estimated_hours DOUBLE PRECISION;
+ALTER TABLE print_requests ADD COLUMN estimated_cost DOUBLE PRECISION;
+ALTER TABLE print_requests ADD COLUMN actual_grams DOUBLE PRECISION;
+ALTER TABLE print_requests ADD COLUMN actual_hours DOUBLE PRECISION;
+ALTER TABLE print_requests ADD COLUMN actual_cost DOUBLE PRECISION;
+`
+
+// Migration 009 rollback - shared SQL
+const migration009Down = `
+ALTER TABLE print_requests DROP COLUMN actual_cost;
+ALTER TABLE print_requests DROP COLUMN actual_hours;
+ALTER TABLE print_requests DROP COLUMN actual_grams;
+ALTER TABLE print_requests DROP COLUMN estimated_cost;
+ALTER TABLE print_requests DROP COLUMN estimated_hours;
+ALTER TABLE print_requests DROP COLUMN estimated_grams;
+`
+
+// Migration 010: Billing ledger - SQLite version
+const migration010Up_SQLite = `
+-- Amounts owed by users, usually for completed print requests
+CREATE TABLE IF NOT EXISTS charges (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id TEXT NOT NULL,
+	print_request_id TEXT,
+	amount REAL NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	waived BOOLEAN NOT NULL DEFAULT FALSE,
+	waived_reason TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Payments received from users
+CREATE TABLE IF NOT EXISTS payments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	user_id TEXT NOT NULL,
+	amount REAL NOT NULL,
+	method TEXT NOT NULL DEFAULT '',
+	reference TEXT NOT NULL DEFAULT '',
+	note TEXT NOT NULL DEFAULT '',
+	recorded_by TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_charges_print_request_id ON charges(print_request_id);
+CREATE INDEX IF NOT EXISTS idx_charges_user_id ON charges(user_id);
+CREATE INDEX IF NOT EXISTS idx_payments_user_id ON payments(user_id);
+`
+
+// Migration 010: Billing ledger - PostgreSQL version
+const migration010Up_Postgres = `
+-- Amounts owed by users, usually for completed print requests
+CREATE TABLE IF NOT EXISTS charges (
+	id SERIAL PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	print_request_id TEXT,
+	amount DOUBLE PRECISION NOT NULL,
+	description TEXT NOT NULL DEFAULT '',
+	waived BOOLEAN NOT NULL DEFAULT FALSE,
+	waived_reason TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Payments received from users
+CREATE TABLE IF NOT EXISTS payments (
+	id SERIAL PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	amount DOUBLE PRECISION NOT NULL,
+	method TEXT NOT NULL DEFAULT '',
+	reference TEXT NOT NULL DEFAULT '',
+	note TEXT NOT NULL DEFAULT '',
+	recorded_by TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_charges_print_request_id ON charges(print_request_id);
+CREATE INDEX IF NOT EXISTS idx_charges_user_id ON charges(user_id);
+CREATE INDEX IF NOT EXISTS idx_payments_user_id ON payments(user_id);
+`
+
+// Migration 010 rollback - shared SQL
+const migration010Down = `
+DROP INDEX IF EXISTS idx_payments_user_id;
+DROP INDEX IF EXISTS idx_charges_user_id;
+DROP INDEX IF EXISTS idx_charges_print_request_id;
+DROP TABLE IF EXISTS payments;
+DROP TABLE IF EXISTS charges;
+`
+
+// Migration 011: Quota overrides - SQLite version
+const migration011Up_SQLite = `
+-- Per-user and per-role overrides of the configured quotas. A NULL limit
+-- inherits the configured one and zero means unlimited.
+CREATE TABLE IF NOT EXISTS quota_overrides (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	scope TEXT NOT NULL CHECK (scope IN ('user', 'role')),
+	subject TEXT NOT NULL,
+	max_open_requests INTEGER,
+	monthly_grams REAL,
+	monthly_hours REAL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quota_overrides_scope_subject ON quota_overrides(scope, subject);
+`
+
+// Migration 011: Quota overrides - PostgreSQL version
+const migration011Up_Postgres = `
+-- Per-user and per-role overrides of the configured quotas. A NULL limit
+-- inherits the configured one and zero means unlimited.
+CREATE TABLE IF NOT EXISTS quota_overrides (
+	id SERIAL PRIMARY KEY,
+	scope TEXT NOT NULL CHECK (scope IN ('user', 'role')),
+	subject TEXT NOT NULL,
+	max_open_requests INTEGER,
+	monthly_grams DOUBLE PRECISION,
+	monthly_hours DOUBLE PRECISION,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_quota_overrides_scope_subject ON quota_overrides(scope, subject);
+`
+
+// Migration 011 rollback - shared SQL
+const migration011Down = `
+DROP INDEX IF EXISTS idx_quota_overrides_scope_subject;
+DROP TABLE IF EXISTS quota_overrides;
+`
+
+// Migration 012: Groups - SQLite version
+const migration012Up_SQLite = `
+-- Groups of users, e.g. labs sharing one instance
+CREATE TABLE IF NOT EXISTS groups (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Members of groups, who are either regular members or group moderators
+CREATE TABLE IF NOT EXISTS group_memberships (
+	group_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('member', 'moderator')),
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (group_id, user_id),
+	FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_memberships_user_id ON group_memberships(user_id);
+
+-- The group a print request was submitted to
+ALTER TABLE print_requests ADD COLUMN group_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_print_requests_group_id ON print_requests(group_id);
+`
+
+// Migration 012: Groups - PostgreSQL version
+const migration012Up_Postgres = `
+-- Groups of users, e.g. labs sharing one instance
+CREATE TABLE IF NOT EXISTS groups (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL UNIQUE,
+	description TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Members of groups, who are either regular members or group moderators
+CREATE TABLE IF NOT EXISTS group_memberships (
+	group_id TEXT NOT NULL,
+	user_id TEXT NOT NULL,
+	role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('member', 'moderator')),
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	PRIMARY KEY (group_id, user_id),
+	FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_group_memberships_user_id ON group_memberships(user_id);
+
+-- The group a print request was submitted to
+ALTER TABLE print_requests ADD COLUMN group_id TEXT;
+
+CREATE INDEX IF NOT EXISTS idx_print_requests_group_id ON print_requests(group_id);
+`
+
+// Migration 012 rollback - shared SQL
+const migration012Down = `
+DROP INDEX IF EXISTS idx_print_requests_group_id;
+ALTER TABLE print_requests DROP COLUMN group_id;
+DROP INDEX IF EXISTS idx_group_memberships_user_id;
+DROP TABLE IF EXISTS group_memberships;
+DROP TABLE IF EXISTS groups;
+`
+
+// Migration 013: Roles and permissions - SQLite version
+const migration013Up_SQLite = `
+-- Roles users can be assigned, including custom ones created by admins
+CREATE TABLE IF NOT EXISTS roles (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT '',
+	built_in BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Permissions granted by each role
+CREATE TABLE IF NOT EXISTS role_permissions (
+	role TEXT NOT NULL,
+	permission TEXT NOT NULL,
+	PRIMARY KEY (role, permission),
+	FOREIGN KEY (role) REFERENCES roles(name) ON DELETE CASCADE
+);
+` + migration013Seed
+
+// Migration 013: Roles and permissions - PostgreSQL version
+const migration013Up_Postgres = `
+-- Roles users can be assigned, including custom ones created by admins
+CREATE TABLE IF NOT EXISTS roles (
+	name TEXT PRIMARY KEY,
+	description TEXT NOT NULL DEFAULT '',
+	built_in BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Permissions granted by each role
+CREATE TABLE IF NOT EXISTS role_permissions (
+	role TEXT NOT NULL,
+	permission TEXT NOT NULL,
+	PRIMARY KEY (role, permission),
+	FOREIGN KEY (role) REFERENCES roles(name) ON DELETE CASCADE
+);
+` + migration013Seed
+
+// Migration 013 seed data - shared SQL. Grants the built-in roles the
+// permissions they had when roles were hardcoded.
+const migration013Seed = `
+INSERT INTO roles (name, description, built_in) VALUES
+	('user', 'Can submit and follow their own print requests', TRUE),
+	('moderator', 'Can manage print requests, printers, inventory and regular users', TRUE),
+	('admin', 'Has full system access', TRUE);
+
+INSERT INTO role_permissions (role, permission) VALUES
+	('user', 'create_print_requests'),
+	('user', 'view_own_print_requests'),
+	('moderator', 'create_print_requests'),
+	('moderator', 'view_own_print_requests'),
+	('moderator', 'view_group_print_requests'),
+	('moderator', 'manage_print_requests'),
+	('moderator', 'approve_print_requests'),
+	('moderator', 'view_users'),
+	('moderator', 'manage_users'),
+	('moderator', 'access_admin'),
+	('moderator', 'view_system_stats'),
+	('moderator', 'manage_printers'),
+	('moderator', 'manage_inventory'),
+	('admin', 'create_print_requests'),
+	('admin', 'view_own_print_requests'),
+	('admin', 'view_group_print_requests'),
+	('admin', 'manage_print_requests'),
+	('admin', 'approve_print_requests'),
+	('admin', 'view_users'),
+	('admin', 'manage_users'),
+	('admin', 'promote_users'),
+	('admin', 'access_admin'),
+	('admin', 'view_system_stats'),
+	('admin', 'manage_printers'),
+	('admin', 'manage_inventory'),
+	('admin', 'manage_billing'),
+	('admin', 'manage_quotas'),
+	('admin', 'manage_groups'),
+	('admin', 'manage_roles');
+`
+
+// Migration 013 rollback - shared SQL
+const migration013Down = `
+DROP TABLE IF EXISTS role_permissions;
+DROP TABLE IF EXISTS roles;
+`
+
+// Migration 014: API tokens - SQLite version
+const migration014Up_SQLite = `
+-- Personal access tokens. Only a SHA-256 hash of each token is stored, and
+-- scopes are the space-separated permissions the token is limited to.
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	prefix TEXT NOT NULL,
+	scopes TEXT NOT NULL DEFAULT '',
+	expires_at DATETIME,
+	last_used_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+`
+
+// Migration 014: API tokens - PostgreSQL version
+const migration014Up_Postgres = `
+-- Personal access tokens. Only a SHA-256 hash of each token is stored, and
+-- scopes are the space-separated permissions the token is limited to.
+CREATE TABLE IF NOT EXISTS api_tokens (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	token_hash TEXT NOT NULL UNIQUE,
+	prefix TEXT NOT NULL,
+	scopes TEXT NOT NULL DEFAULT '',
+	expires_at TIMESTAMP WITH TIME ZONE,
+	last_used_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_tokens_user_id ON api_tokens(user_id);
+`
+
+// Migration 014 rollback - shared SQL
+const migration014Down = `
+DROP INDEX IF EXISTS idx_api_tokens_user_id;
+DROP TABLE IF EXISTS api_tokens;
+`
+
+// Migration 015: Database sessions - SQLite version. The original
+// user_sessions table was never written to, so it is recreated rather than
+// copied.
+const migration015Up_SQLite = `
+DROP TABLE IF EXISTS user_sessions;
+
+-- Browser sessions. session_token is a SHA-256 hash of the token in the
+-- session cookie, and user_id is NULL until the session logs in.
+CREATE TABLE user_sessions (
+	id TEXT PRIMARY KEY,
+	user_id TEXT,
+	session_token TEXT UNIQUE NOT NULL,
+	data TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	expires_at DATETIME NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_seen_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_expires_at ON user_sessions(expires_at);
+`
+
+// Migration 015: Database sessions - PostgreSQL version
+const migration015Up_Postgres = `
+DROP TABLE IF EXISTS user_sessions;
+
+-- Browser sessions. session_token is a SHA-256 hash of the token in the
+-- session cookie, and user_id is NULL until the session logs in.
+CREATE TABLE user_sessions (
+	id TEXT PRIMARY KEY,
+	user_id TEXT REFERENCES users(id) ON DELETE CASCADE,
+	session_token TEXT UNIQUE NOT NULL,
+	data TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	last_seen_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user_id ON user_sessions(user_id);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_expires_at ON user_sessions(expires_at);
+`
+
+// Migration 015 rollback - shared SQL. Restores the original, unused table.
+const migration015Down = `
+DROP INDEX IF EXISTS idx_user_sessions_expires_at;
+DROP INDEX IF EXISTS idx_user_sessions_user_id;
+DROP TABLE IF EXISTS user_sessions;
+
+CREATE TABLE user_sessions (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	session_token TEXT UNIQUE NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// Migration 016: Two-factor authentication - SQLite version
+const migration016Up_SQLite = `
+-- Authenticator app enrolments. A row is written when enrolment starts and
+-- enabled once the user confirms a code. last_counter is the time step of
+-- the last code accepted, so that codes cannot be replayed.
+CREATE TABLE IF NOT EXISTS user_totp (
+	user_id TEXT PRIMARY KEY,
+	secret TEXT NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	last_counter INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	enabled_at DATETIME,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- One-time recovery codes. Only a SHA-256 hash of each code is stored.
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	code_hash TEXT NOT NULL,
+	used_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes(user_id);
+`
+
+// Migration 016: Two-factor authentication - PostgreSQL version
+const migration016Up_Postgres = `
+-- Authenticator app enrolments. A row is written when enrolment starts and
+-- enabled once the user confirms a code. last_counter is the time step of
+-- the last code accepted, so that codes cannot be replayed.
+CREATE TABLE IF NOT EXISTS user_totp (
+	user_id TEXT PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+	secret TEXT NOT NULL,
+	enabled BOOLEAN NOT NULL DEFAULT FALSE,
+	last_counter BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	enabled_at TIMESTAMP WITH TIME ZONE
+);
+
+-- One-time recovery codes. Only a SHA-256 hash of each code is stored.
+CREATE TABLE IF NOT EXISTS user_recovery_codes (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash TEXT NOT NULL,
+	used_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_recovery_codes_user_id ON user_recovery_codes(user_id);
+`
+
+// Migration 016 rollback - shared SQL
+const migration016Down = `
+DROP INDEX IF EXISTS idx_user_recovery_codes_user_id;
+DROP TABLE IF EXISTS user_recovery_codes;
+DROP TABLE IF EXISTS user_totp;
+`
+
+// Migration 017: WebAuthn credentials - SQLite version
+const migration017Up_SQLite = `
+-- Security keys and passkeys registered for logging in. credential_id is the
+-- base64url credential ID, and public_key the credential's COSE_Key.
+CREATE TABLE IF NOT EXISTS user_webauthn_credentials (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	name TEXT NOT NULL,
+	credential_id TEXT UNIQUE NOT NULL,
+	public_key BLOB NOT NULL,
+	sign_count INTEGER NOT NULL DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	last_used_at DATETIME,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_webauthn_credentials_user_id ON user_webauthn_credentials(user_id);
+`
+
+// Migration 017: WebAuthn credentials - PostgreSQL version
+const migration017Up_Postgres = `
+-- Security keys and passkeys registered for logging in. credential_id is the
+-- base64url credential ID, and public_key the credential's COSE_Key.
+CREATE TABLE IF NOT EXISTS user_webauthn_credentials (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	name TEXT NOT NULL,
+	credential_id TEXT UNIQUE NOT NULL,
+	public_key BYTEA NOT NULL,
+	sign_count BIGINT NOT NULL DEFAULT 0,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	last_used_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_webauthn_credentials_user_id ON user_webauthn_credentials(user_id);
+`
+
+// Migration 017 rollback - shared SQL
+const migration017Down = `
+DROP INDEX IF EXISTS idx_user_webauthn_credentials_user_id;
+DROP TABLE IF EXISTS user_webauthn_credentials;
+`
+
+// Migration 018: Email tokens and verification - SQLite version
+const migration018Up_SQLite = `
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME;
+
+-- Accounts that predate verification keep working if it is turned on
+UPDATE users SET email_verified_at = CURRENT_TIMESTAMP WHERE email IS NOT NULL;
+
+-- Single-use tokens emailed to users, e.g. for password resets. Only a
+-- SHA-256 hash of each token is stored.
+CREATE TABLE IF NOT EXISTS email_tokens (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	purpose TEXT NOT NULL,
+	token_hash TEXT UNIQUE NOT NULL,
+	email TEXT NOT NULL,
+	expires_at DATETIME NOT NULL,
+	used_at DATETIME,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_tokens_user_id ON email_tokens(user_id);
+`
+
+// Migration 018: Email tokens and verification - PostgreSQL version
+const migration018Up_Postgres = `
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP WITH TIME ZONE;
+
+-- Accounts that predate verification keep working if it is turned on
+UPDATE users SET email_verified_at = NOW() WHERE email IS NOT NULL;
+
+-- Single-use tokens emailed to users, e.g. for password resets. Only a
+-- SHA-256 hash of each token is stored.
+CREATE TABLE IF NOT EXISTS email_tokens (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	purpose TEXT NOT NULL,
+	token_hash TEXT UNIQUE NOT NULL,
+	email TEXT NOT NULL,
+	expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	used_at TIMESTAMP WITH TIME ZONE,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_tokens_user_id ON email_tokens(user_id);
+`
+
+// Migration 018 rollback - shared SQL
+const migration018Down = `
+DROP INDEX IF EXISTS idx_email_tokens_user_id;
+DROP TABLE IF EXISTS email_tokens;
+ALTER TABLE users DROP COLUMN email_verified_at;
+`
+
+// Migration 019: Failed login tracking - SQLite version
+const migration019Up_SQLite = `
+-- Failed password logins per lowercased username, including usernames no
+-- account has, so that responses do not reveal which exist
+CREATE TABLE IF NOT EXISTS login_attempts (
+	username TEXT PRIMARY KEY,
+	failed_count INTEGER NOT NULL DEFAULT 0,
+	last_failed_at DATETIME NOT NULL,
+	locked_until DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failed_at ON login_attempts(last_failed_at);
+`
+
+// Migration 019: Failed login tracking - PostgreSQL version
+const migration019Up_Postgres = `
+-- Failed password logins per lowercased username, including usernames no
+-- account has, so that responses do not reveal which exist
+CREATE TABLE IF NOT EXISTS login_attempts (
+	username TEXT PRIMARY KEY,
+	failed_count INTEGER NOT NULL DEFAULT 0,
+	last_failed_at TIMESTAMP WITH TIME ZONE NOT NULL,
+	locked_until TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failed_at ON login_attempts(last_failed_at);
+`
+
+// Migration 019 rollback - shared SQL
+const migration019Down = `
+DROP INDEX IF EXISTS idx_login_attempts_last_failed_at;
+DROP TABLE IF EXISTS login_attempts;
+`
+
+// Migration 020: Invitations - SQLite version
+const migration020Up_SQLite = `
+-- Codes admins and moderators hand out to let people register. Only a
+-- SHA-256 hash of each code is stored.
+CREATE TABLE IF NOT EXISTS invitations (
+	id TEXT PRIMARY KEY,
+	code_hash TEXT UNIQUE NOT NULL,
+	prefix TEXT NOT NULL,
+	email TEXT,
+	role TEXT NOT NULL DEFAULT 'user',
+	group_id TEXT,
+	max_uses INTEGER NOT NULL DEFAULT 1,
+	uses INTEGER NOT NULL DEFAULT 0,
+	expires_at DATETIME,
+	revoked_at DATETIME,
+	created_by TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE,
+	FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+);
+`
+
+// Migration 020: Invitations - PostgreSQL version
+const migration020Up_Postgres = `
+-- Codes admins and moderators hand out to let people register. Only a
+-- SHA-256 hash of each code is stored.
+CREATE TABLE IF NOT EXISTS invitations (
+	id TEXT PRIMARY KEY,
+	code_hash TEXT UNIQUE NOT NULL,
+	prefix TEXT NOT NULL,
+	email TEXT,
+	role TEXT NOT NULL DEFAULT 'user',
+	group_id TEXT REFERENCES groups(id) ON DELETE CASCADE,
+	max_uses INTEGER NOT NULL DEFAULT 1,
+	uses INTEGER NOT NULL DEFAULT 0,
+	expires_at TIMESTAMP WITH TIME ZONE,
+	revoked_at TIMESTAMP WITH TIME ZONE,
+	created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+`
+
+// Migration 020 rollback - shared SQL
+const migration020Down = `
+DROP TABLE IF EXISTS invitations;
+`
+
+// Migration 021: LDAP identities - SQLite version
+const migration021Up_SQLite = `
+-- Links directory users to the accounts created when they first log in,
+-- by the directory's name and the user's ID there
+CREATE TABLE IF NOT EXISTS user_ldap_identities (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL,
+	provider_name TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+	UNIQUE(provider_name, subject)
+);
+`
+
+// Migration 021: LDAP identities - PostgreSQL version
+const migration021Up_Postgres = `
+-- Links directory users to the accounts created when they first log in,
+-- by the directory's name and the user's ID there
+CREATE TABLE IF NOT EXISTS user_ldap_identities (
+	id TEXT PRIMARY KEY,
+	user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	provider_name TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+	UNIQUE(provider_name, subject)
+);
+`
+
+// Migration 021 rollback - shared SQL
+const migration021Down = `
+DROP TABLE IF EXISTS user_ldap_identities;
+`
+
+// Migration 022: Forced password changes and deleted users - SQLite version
+const migration022Up_SQLite = `
+-- Set when an admin gives a user a temporary password, until they choose
+-- their own
+ALTER TABLE users ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Print requests of deleted users are anonymised by moving them to this
+-- account, which is disabled and has no password. Its username cannot be
+-- registered.
+INSERT INTO users (id, username, role, enabled) VALUES ('deleted-user', '[deleted]', 'user', FALSE)
+ON CONFLICT DO NOTHING;
+`
+
+// Migration 022: Forced password changes and deleted users - PostgreSQL version
+const migration022Up_Postgres = `
+-- Set when an admin gives a user a temporary password, until they choose
+-- their own
+ALTER TABLE users ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Print requests of deleted users are anonymised by moving them to this
+-- account, which is disabled and has no password. Its username cannot be
+-- registered.
+INSERT INTO users (id, username, role, enabled) VALUES ('deleted-user', '[deleted]', 'user', FALSE)
+ON CONFLICT DO NOTHING;
+`
+
+// Migration 022 rollback - shared SQL
+const migration022Down = `
+DELETE FROM users WHERE id = 'deleted-user';
+ALTER TABLE users DROP COLUMN must_change_password;
+`
+
+// getMigration022SQL returns database-specific SQL for migration 022
+func getMigration022SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration022Up_Postgres, migration022Down
+	default: // sqlite
+		return migration022Up_SQLite, migration022Down
+	}
+}
+
+// Migration 023: Audit log - SQLite version
+const migration023Up_SQLite = `
+-- Administrative and security events. Actors and targets are not foreign
+-- keys, so that the log outlives the users and print requests in it.
+CREATE TABLE IF NOT EXISTS audit_events (
+	id TEXT PRIMARY KEY,
+	actor_id TEXT,
+	actor_name TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	target_type TEXT NOT NULL DEFAULT '',
+	target_id TEXT NOT NULL DEFAULT '',
+	changes TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+` + migration023Shared
+
+// Migration 023: Audit log - PostgreSQL version
+const migration023Up_Postgres = `
+-- Administrative and security events. Actors and targets are not foreign
+-- keys, so that the log outlives the users and print requests in it.
+CREATE TABLE IF NOT EXISTS audit_events (
+	id TEXT PRIMARY KEY,
+	actor_id TEXT,
+	actor_name TEXT NOT NULL DEFAULT '',
+	action TEXT NOT NULL,
+	target_type TEXT NOT NULL DEFAULT '',
+	target_id TEXT NOT NULL DEFAULT '',
+	changes TEXT NOT NULL DEFAULT '',
+	ip_address TEXT NOT NULL DEFAULT '',
+	user_agent TEXT NOT NULL DEFAULT '',
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+` + migration023Shared
+
+// Migration 023 indexes and grants - shared SQL. Only admins can read the
+// audit log until they grant it to other roles.
+const migration023Shared = `
+CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON audit_events(created_at);
+CREATE INDEX IF NOT EXISTS idx_audit_events_actor_id ON audit_events(actor_id);
+CREATE INDEX IF NOT EXISTS idx_audit_events_target ON audit_events(target_type, target_id);
+
+INSERT INTO role_permissions (role, permission) VALUES ('admin', 'view_audit_log')
+ON CONFLICT DO NOTHING;
+`
+
+// Migration 023 rollback - shared SQL
+const migration023Down = `
+DELETE FROM role_permissions WHERE permission = 'view_audit_log';
+DROP INDEX IF EXISTS idx_audit_events_target;
+DROP INDEX IF EXISTS idx_audit_events_actor_id;
+DROP INDEX IF EXISTS idx_audit_events_created_at;
+DROP TABLE IF EXISTS audit_events;
+`
+
+// getMigration023SQL returns database-specific SQL for migration 023
+func getMigration023SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration023Up_Postgres, migration023Down
+	default: // sqlite
+		return migration023Up_SQLite, migration023Down
+	}
+}
+
+// Migration 024: Print request status history - SQLite version
+const migration024Up_SQLite = `
+-- Every status change of a print request, for turnaround and throughput
+-- analytics
+CREATE TABLE IF NOT EXISTS print_request_status_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	print_request_id TEXT NOT NULL,
+	from_status INTEGER,
+	to_status INTEGER NOT NULL,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (print_request_id) REFERENCES print_requests(id) ON DELETE CASCADE
+);
+` + migration024Shared
+
+// Migration 024: Print request status history - PostgreSQL version
+const migration024Up_Postgres = `
+-- Every status change of a print request, for turnaround and throughput
+-- analytics
+CREATE TABLE IF NOT EXISTS print_request_status_events (
+	id SERIAL PRIMARY KEY,
+	print_request_id TEXT NOT NULL REFERENCES print_requests(id) ON DELETE CASCADE,
+	from_status INTEGER,
+	to_status INTEGER NOT NULL,
+	created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+` + migration024Shared
+
+// Migration 024 indexes and history - shared SQL. Only when requests were
+// completed is known for those completed before the history was kept, and
+// their last update is the best guess.
+const migration024Shared = `
+CREATE INDEX IF NOT EXISTS idx_print_request_status_events_request ON print_request_status_events(print_request_id);
+CREATE INDEX IF NOT EXISTS idx_print_request_status_events_created_at ON print_request_status_events(created_at);
+
+INSERT INTO print_request_status_events (print_request_id, to_status, created_at)
+SELECT id, status, updated_at FROM print_requests WHERE status = 3;
+`
+
+// Migration 024 rollback - shared SQL
+const migration024Down = `
+DROP INDEX IF EXISTS idx_print_request_status_events_created_at;
+DROP INDEX IF EXISTS idx_print_request_status_events_request;
+DROP TABLE IF EXISTS print_request_status_events;
+`
+
+// getMigration024SQL returns database-specific SQL for migration 024
+func getMigration024SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration024Up_Postgres, migration024Down
+	default: // sqlite
+		return migration024Up_SQLite, migration024Down
+	}
+}
+
+// Migration 025: Ledger amounts in integer cents - SQLite version
+const migration025Up_SQLite = `
+-- Sums of amounts stored as REAL are not exact, so store whole cents instead
+ALTER TABLE charges ADD COLUMN amount_cents INTEGER NOT NULL DEFAULT 0;
+UPDATE charges SET amount_cents = CAST(ROUND(amount * 100) AS INTEGER);
+ALTER TABLE charges DROP COLUMN amount;
+
+ALTER TABLE payments ADD COLUMN amount_cents INTEGER NOT NULL DEFAULT 0;
+UPDATE payments SET amount_cents = CAST(ROUND(amount * 100) AS INTEGER);
+ALTER TABLE payments DROP COLUMN amount;
+`
+
+// Migration 025: Ledger amounts in integer cents - PostgreSQL version
+const migration025Up_Postgres = `
+-- Sums of amounts stored as DOUBLE PRECISION are not exact, so store whole
+-- cents instead
+ALTER TABLE charges ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT;
+ALTER TABLE charges RENAME COLUMN amount TO amount_cents;
+
+ALTER TABLE payments ALTER COLUMN amount TYPE BIGINT USING ROUND(amount * 100)::BIGINT;
+ALTER TABLE payments RENAME COLUMN amount TO amount_cents;
+`
+
+// Migration 025 rollback - SQLite version
+const migration025Down_SQLite = `
+ALTER TABLE payments ADD COLUMN amount REAL NOT NULL DEFAULT 0;
+UPDATE payments SET amount = amount_cents / 100.0;
+ALTER TABLE payments DROP COLUMN amount_cents;
+
+ALTER TABLE charges ADD COLUMN amount REAL NOT NULL DEFAULT 0;
+UPDATE charges SET amount = amount_cents / 100.0;
+ALTER TABLE charges DROP COLUMN amount_cents;
+`
+
+// Migration 025 rollback - PostgreSQL version
+const migration025Down_Postgres = `
+ALTER TABLE payments RENAME COLUMN amount_cents TO amount;
+ALTER TABLE payments ALTER COLUMN amount TYPE DOUBLE PRECISION USING amount / 100.0;
+
+ALTER TABLE charges RENAME COLUMN amount_cents TO amount;
+ALTER TABLE charges ALTER COLUMN amount TYPE DOUBLE PRECISION USING amount / 100.0;
+`
+
+// getMigration025SQL returns database-specific SQL for migration 025
+func getMigration025SQL(dbType string) (string, string) {
+	switch dbType {
+	case "postgres":
+		return migration025Up_Postgres, migration025Down_Postgres
+	default: // sqlite
+		return migration025Up_SQLite, migration025Down_SQLite
+	}
+}
@@ -0,0 +1,160 @@
+package models
+
+import "time"
+
+// AnalyticsBucket is the period print request analytics are grouped by
+type AnalyticsBucket string
+
+const (
+	AnalyticsBucketDay  AnalyticsBucket = "day"
+	AnalyticsBucketWeek AnalyticsBucket = "week" // Weeks start on Monday
+)
+
+// IsValid reports whether the bucket is one analytics can be grouped by
+func (b AnalyticsBucket) IsValid() bool {
+	return b == AnalyticsBucketDay || b == AnalyticsBucketWeek
+}
+
+// Start returns the start of the bucket containing t, in UTC
+func (b AnalyticsBucket) Start(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	if b == AnalyticsBucketWeek {
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	}
+	return day
+}
+
+// Next returns the start of the bucket after the one starting at start
+func (b AnalyticsBucket) Next(start time.Time) time.Time {
+	if b == AnalyticsBucketWeek {
+		return start.AddDate(0, 0, 7)
+	}
+	return start.AddDate(0, 0, 1)
+}
+
+// AnalyticsRange is the period analytics cover, from From up to but not
+// including To
+type AnalyticsRange struct {
+	From time.Time
+	To   time.Time
+}
+
+// StatusCount is how many print requests reached a status in a bucket.
+// Requests reach the pending approval status when they are submitted.
+type StatusCount struct {
+	Bucket string             `db:"bucket"` // Start of the bucket, as YYYY-MM-DD in UTC
+	Status PrintRequestStatus `db:"status"`
+	Count  int                `db:"count"`
+}
+
+// Turnaround is how long a print request took to be approved and then
+// completed, in seconds. Each is nil unless that step happened within the
+// range asked for.
+type Turnaround struct {
+	ApprovalSeconds   *float64 `db:"approval_seconds"`
+	CompletionSeconds *float64 `db:"completion_seconds"`
+}
+
+// MaterialUsage is the filament used by print requests completed in a
+// period, by material and color. Actual usage is counted where it was
+// recorded, and the estimate otherwise.
+type MaterialUsage struct {
+	Material string  `json:"material" db:"material"`
+	Color    string  `json:"color" db:"color"`
+	Requests int     `json:"requests" db:"requests"`
+	Grams    float64 `json:"grams" db:"grams"`
+}
+
+// PrinterUsage is the printing time of print requests completed on a
+// printer in a period. Actual time is counted where it was recorded, and the
+// estimate otherwise.
+type PrinterUsage struct {
+	PrinterID int     `json:"printer_id" db:"printer_id"`
+	Name      string  `json:"name" db:"name"`
+	Requests  int     `json:"requests" db:"requests"`
+	Hours     float64 `json:"hours" db:"hours"`
+
+	// Utilization is the fraction of the period spent printing
+	Utilization float64 `json:"utilization" db:"-"`
+}
+
+// RequesterUsage is how many print requests a user submitted in a period,
+// how many of those are done, and the filament they used
+type RequesterUsage struct {
+	UserID      string  `json:"user_id" db:"user_id"`
+	Username    string  `json:"username" db:"username"`
+	DisplayName *string `json:"display_name,omitempty" db:"display_name"`
+	Requests    int     `json:"requests" db:"requests"`
+	Completed   int     `json:"completed" db:"completed"`
+	Grams       float64 `json:"grams" db:"grams"`
+}
+
+// ThroughputBucket is how many print requests reached each status in a
+// bucket, keyed by status name
+type ThroughputBucket struct {
+	Start  string         `json:"start"` // YYYY-MM-DD in UTC
+	Counts map[string]int `json:"counts"`
+}
+
+// TurnaroundStats summarizes how long a step of print requests took, in
+// seconds. The median and 90th percentile are nil when no requests took it.
+type TurnaroundStats struct {
+	Count         int      `json:"count"`
+	MedianSeconds *float64 `json:"median_seconds"`
+	P90Seconds    *float64 `json:"p90_seconds"`
+}
+
+// AnalyticsReport summarizes print requests over a period
+type AnalyticsReport struct {
+	From   time.Time       `json:"from"`
+	To     time.Time       `json:"to"` // Exclusive
+	Bucket AnalyticsBucket `json:"bucket"`
+
+	Throughput []*ThroughputBucket `json:"throughput"`
+
+	// Time from submission to approval, and from approval to completion
+	Approval   TurnaroundStats `json:"approval"`
+	Completion TurnaroundStats `json:"completion"`
+
+	Materials     []*MaterialUsage  `json:"materials"`
+	Printers      []*PrinterUsage   `json:"printers"`
+	TopRequesters []*RequesterUsage `json:"top_requesters"`
+}
+
+// UserPrintTotals sums up a user's print requests. Filament and spend count
+// completed requests, using actual amounts where they were recorded and
+// estimates otherwise.
+type UserPrintTotals struct {
+	Pending    int     `db:"pending"`
+	Enqueued   int     `db:"enqueued"`
+	InProgress int     `db:"in_progress"`
+	Done       int     `db:"done"`
+	Grams      float64 `db:"grams"`
+	Spend      float64 `db:"spend"`
+
+	// AverageTurnaroundSeconds is the average time from submission to
+	// completion, or nil if nothing has been completed
+	AverageTurnaroundSeconds *float64 `db:"average_turnaround_seconds"`
+}
+
+// UserMonthStats is how many print requests a user submitted and completed in
+// a month, and the filament and spend of those completed
+type UserMonthStats struct {
+	Month     string  `json:"month" db:"month"` // YYYY-MM in UTC
+	Submitted int     `json:"submitted" db:"submitted"`
+	Completed int     `json:"completed" db:"completed"`
+	Grams     float64 `json:"grams" db:"grams"`
+	Spend     float64 `json:"spend" db:"spend"`
+}
+
+// UserStats are a user's personal print request statistics
+type UserStats struct {
+	Counts                   map[string]int    `json:"counts"` // By status name
+	Total                    int               `json:"total"`
+	Grams                    float64           `json:"grams"`
+	Spend                    float64           `json:"spend"`
+	AverageTurnaroundSeconds *float64          `json:"average_turnaround_seconds"`
+	Quota                    *QuotaStatus      `json:"quota,omitempty"` // Only when quotas are enabled
+	History                  []*UserMonthStats `json:"history"`         // Oldest month first, ending with this one
+}
@@ -0,0 +1,33 @@
+package models
+
+import (
+	"slices"
+	"time"
+)
+
+// APIToken is a personal access token that lets scripts act as a user
+// without a browser session. Only a hash of the token is stored.
+type APIToken struct {
+	ID        string `json:"id" db:"id"`
+	UserID    string `json:"user_id" db:"user_id"`
+	Name      string `json:"name" db:"name"`
+	TokenHash string `json:"-" db:"token_hash"` // Never serialize the token hash
+	// Prefix is the start of the token, shown so users can tell tokens apart
+	Prefix string `json:"prefix" db:"prefix"`
+	// Scopes are the permissions the token is limited to. The token never
+	// grants more than the user's own permissions.
+	Scopes     []Permission `json:"scopes" db:"-"`
+	ExpiresAt  *time.Time   `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt *time.Time   `json:"last_used_at,omitempty" db:"last_used_at"`
+	CreatedAt  time.Time    `json:"created_at" db:"created_at"`
+}
+
+// IsExpired returns true if the token has expired
+func (t *APIToken) IsExpired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// HasScope checks if the token allows the specified permission
+func (t *APIToken) HasScope(permission Permission) bool {
+	return slices.Contains(t.Scopes, permission)
+}
@@ -0,0 +1,90 @@
+package models
+
+import "time"
+
+// AuditAction is something done that is recorded in the audit log
+type AuditAction string
+
+const (
+	AuditLogin       AuditAction = "auth.login"
+	AuditLoginFailed AuditAction = "auth.login_failed"
+
+	AuditUserCreated       AuditAction = "user.created"
+	AuditUserUpdated       AuditAction = "user.updated"
+	AuditUserRoleChanged   AuditAction = "user.role_changed"
+	AuditUserStatusChanged AuditAction = "user.status_changed"
+	AuditUserPasswordReset AuditAction = "user.password_reset"
+	AuditUserUnlocked      AuditAction = "user.unlocked"
+	AuditUserDeleted       AuditAction = "user.deleted"
+	AuditUsersImported     AuditAction = "user.imported"
+
+	AuditPrintRequestStatusChanged AuditAction = "print_request.status_changed"
+	AuditPrintRequestDeleted       AuditAction = "print_request.deleted"
+
+	AuditRoleCreated AuditAction = "role.created"
+	AuditRoleUpdated AuditAction = "role.updated"
+	AuditRoleDeleted AuditAction = "role.deleted"
+
+	AuditGroupMemberSet     AuditAction = "group.member_set"
+	AuditGroupMemberRemoved AuditAction = "group.member_removed"
+
+	AuditInvitationCreated AuditAction = "invitation.created"
+	AuditInvitationRevoked AuditAction = "invitation.revoked"
+
+	AuditPaymentRecorded AuditAction = "billing.payment_recorded"
+	AuditChargeWaived    AuditAction = "billing.charge_waived"
+)
+
+// What audit events are about
+const (
+	AuditTargetUser         = "user"
+	AuditTargetPrintRequest = "print_request"
+	AuditTargetRole         = "role"
+	AuditTargetGroup        = "group"
+	AuditTargetInvitation   = "invitation"
+	AuditTargetPayment      = "payment"
+	AuditTargetCharge       = "charge"
+)
+
+// AuditChange is a field's value before and after a change. Before is nil
+// for things created, and After for things deleted.
+type AuditChange struct {
+	Before any `json:"before"`
+	After  any `json:"after"`
+}
+
+// AuditChanges are the fields changed by an audited action, by name
+type AuditChanges map[string]AuditChange
+
+// AuditEvent is an entry in the audit log of administrative and security
+// events. Events keep the actor's username, so they still say who it was
+// after the user is deleted.
+type AuditEvent struct {
+	ID string `json:"id" db:"id"`
+	// ActorID is the user who did it, if anyone was logged in
+	ActorID *string `json:"actor_id,omitempty" db:"actor_id"`
+	// ActorName is the actor's username, or the username tried for failed
+	// logins
+	ActorName  string       `json:"actor_name" db:"actor_name"`
+	Action     AuditAction  `json:"action" db:"action"`
+	TargetType string       `json:"target_type" db:"target_type"`
+	TargetID   string       `json:"target_id" db:"target_id"`
+	Changes    AuditChanges `json:"changes,omitempty" db:"-"`
+	IPAddress  string       `json:"ip_address" db:"ip_address"`
+	UserAgent  string       `json:"user_agent" db:"user_agent"`
+	CreatedAt  time.Time    `json:"created_at" db:"created_at"`
+}
+
+// AuditEventFilter selects audit events, newest first. Empty fields match
+// everything.
+type AuditEventFilter struct {
+	// Actor matches the actor's ID or username
+	Actor      string
+	Action     AuditAction
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+	Limit      int // No limit if zero
+	Offset     int
+}
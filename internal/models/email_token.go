@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// EmailTokenPurpose is what an emailed token lets its holder do
+type EmailTokenPurpose string
+
+const (
+	EmailTokenPasswordReset EmailTokenPurpose = "password_reset"
+	EmailTokenVerifyEmail   EmailTokenPurpose = "verify_email"
+)
+
+// EmailToken is a single-use token sent to a user's email address, e.g. in a
+// password reset link
+type EmailToken struct {
+	ID        string            `json:"id" db:"id"`
+	UserID    string            `json:"user_id" db:"user_id"`
+	Purpose   EmailTokenPurpose `json:"purpose" db:"purpose"`
+	TokenHash string            `json:"-" db:"token_hash"` // SHA-256 of the token; never serialize it
+	// Email is the address the token was sent to. Verifying it only counts
+	// while the user still has that address.
+	Email     string     `json:"email" db:"email"`
+	ExpiresAt time.Time  `json:"expires_at" db:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
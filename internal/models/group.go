@@ -0,0 +1,57 @@
+package models
+
+import "time"
+
+// Group is a set of users, such as a lab, whose print requests are handled by
+// the group's own moderators
+type Group struct {
+	ID          string    `json:"id" db:"id"`
+	Name        string    `json:"name" db:"name"`
+	Description string    `json:"description" db:"description"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// GroupRole is a user's role within a group
+type GroupRole string
+
+const (
+	// GroupRoleMember can submit requests to the group and see its queue
+	GroupRoleMember GroupRole = "member"
+	// GroupRoleModerator can also manage the group's print requests and members
+	GroupRoleModerator GroupRole = "moderator"
+)
+
+// IsValid checks if the group role is a valid group role value
+func (r GroupRole) IsValid() bool {
+	return r == GroupRoleMember || r == GroupRoleModerator
+}
+
+// HasPermission checks if the group role grants the specified permission
+// within its group
+func (r GroupRole) HasPermission(permission Permission) bool {
+	switch r {
+	case GroupRoleModerator:
+		return permission == PermissionManagePrintRequests ||
+			permission == PermissionApprovePrintRequests ||
+			permission == PermissionViewGroupPrintRequests ||
+			permission == PermissionViewOwnPrintRequests ||
+			permission == PermissionCreatePrintRequests
+	case GroupRoleMember:
+		return permission == PermissionViewGroupPrintRequests ||
+			permission == PermissionViewOwnPrintRequests ||
+			permission == PermissionCreatePrintRequests
+	default:
+		return false
+	}
+}
+
+// GroupMembership is a user's membership of a group
+type GroupMembership struct {
+	GroupID   string    `json:"group_id" db:"group_id"`
+	GroupName string    `json:"group_name" db:"group_name"`
+	UserID    string    `json:"user_id" db:"user_id"`
+	Username  string    `json:"username" db:"username"`
+	Role      GroupRole `json:"role" db:"role"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
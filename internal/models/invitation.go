@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Invitation lets people register with a code, even when open registration is
+// disabled. Only a hash of the code is stored.
+type Invitation struct {
+	ID       string `json:"id" db:"id"`
+	CodeHash string `json:"-" db:"code_hash"` // Never serialize the code hash
+	// Prefix is the start of the code, shown so admins can tell codes apart
+	Prefix string `json:"prefix" db:"prefix"`
+	// Email, if set, is the only address that can register with the code
+	Email *string `json:"email,omitempty" db:"email"`
+	// Role is the role users who register with the code get
+	Role Role `json:"role" db:"role"`
+	// GroupID, if set, is a group users who register with the code join as
+	// members
+	GroupID   *string    `json:"group_id,omitempty" db:"group_id"`
+	MaxUses   int        `json:"max_uses" db:"max_uses"`
+	Uses      int        `json:"uses" db:"uses"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedBy *string    `json:"created_by,omitempty" db:"created_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
+
+// IsUsable returns true if the code can still be registered with
+func (i *Invitation) IsUsable(now time.Time) bool {
+	return i.RevokedAt == nil && i.Uses < i.MaxUses && (i.ExpiresAt == nil || now.Before(*i.ExpiresAt))
+}
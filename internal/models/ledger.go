@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Charge is an amount owed by a user, usually for a completed print request
+type Charge struct {
+	ID             int       `json:"id" db:"id"`
+	UserID         string    `json:"user_id" db:"user_id"`
+	PrintRequestID *string   `json:"print_request_id,omitempty" db:"print_request_id"`
+	Amount         Money     `json:"amount" db:"amount_cents"`
+	Description    string    `json:"description" db:"description"`
+	Waived         bool      `json:"waived" db:"waived"`
+	WaivedReason   string    `json:"waived_reason,omitempty" db:"waived_reason"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// Payment is an amount received from a user
+type Payment struct {
+	ID         int       `json:"id" db:"id"`
+	UserID     string    `json:"user_id" db:"user_id"`
+	Amount     Money     `json:"amount" db:"amount_cents"`
+	Method     string    `json:"method" db:"method"`       // e.g. cash, card, transfer
+	Reference  string    `json:"reference" db:"reference"` // e.g. a receipt or transaction number
+	Note       string    `json:"note" db:"note"`
+	RecordedBy string    `json:"recorded_by" db:"recorded_by"` // ID of the admin who recorded the payment
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`
+}
+
+// Balance summarises a user's charges and payments. Waived charges are not
+// counted, and a negative balance means the user owes money.
+type Balance struct {
+	UserID   string `json:"user_id" db:"user_id"`
+	Username string `json:"username" db:"username"`
+	Charged  Money  `json:"charged" db:"charged"`
+	Paid     Money  `json:"paid" db:"paid"`
+	Balance  Money  `json:"balance" db:"-"`
+}
+
+// StatementEntry is a charge or payment on a statement. Charges have
+// negative amounts and payments positive ones.
+type StatementEntry struct {
+	Date        time.Time `json:"date"`
+	Kind        string    `json:"kind"` // "charge" or "payment"
+	Description string    `json:"description"`
+	Amount      Money     `json:"amount"`
+	Balance     Money     `json:"balance"` // Running balance after this entry
+}
+
+// Statement lists a user's charges and payments over a period
+type Statement struct {
+	UserID         string           `json:"user_id"`
+	Username       string           `json:"username"`
+	Currency       string           `json:"currency"`
+	PeriodStart    time.Time        `json:"period_start"`
+	PeriodEnd      time.Time        `json:"period_end"` // Exclusive
+	OpeningBalance Money            `json:"opening_balance"`
+	Entries        []StatementEntry `json:"entries"`
+	ClosingBalance Money            `json:"closing_balance"`
+	GeneratedAt    time.Time        `json:"generated_at"`
+}
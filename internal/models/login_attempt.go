@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// LoginAttempts counts failed password logins to a username, whether or not
+// an account has it, so that guessing passwords can be slowed and stopped
+type LoginAttempts struct {
+	// Username is lowercased, so that changing case does not get more guesses
+	Username     string    `json:"username" db:"username"`
+	FailedCount  int       `json:"failed_count" db:"failed_count"`
+	LastFailedAt time.Time `json:"last_failed_at" db:"last_failed_at"`
+	// LockedUntil is set when too many logins fail, and password logins are
+	// refused until then
+	LockedUntil *time.Time `json:"locked_until,omitempty" db:"locked_until"`
+}
+
+// IsLocked returns true if password logins are refused at the time
+func (a *LoginAttempts) IsLocked(now time.Time) bool {
+	return a.LockedUntil != nil && now.Before(*a.LockedUntil)
+}
@@ -0,0 +1,76 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// Money is an amount in cents, or the hundredth of whatever the currency is.
+// It is stored as an integer so sums are exact, and written to JSON as a
+// number with two decimal places.
+type Money int64
+
+// MoneyFromFloat converts an amount such as a cost estimate to the nearest cent
+func MoneyFromFloat(amount float64) Money {
+	return Money(math.Round(amount * 100))
+}
+
+// ParseMoney parses a decimal amount, such as "12.5", exactly. Amounts with
+// fractions of a cent are rejected.
+func ParseMoney(s string) (Money, error) {
+	amount, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	cents := amount.Mul(amount, big.NewRat(100, 1))
+	if !cents.IsInt() {
+		return 0, errors.New("amount must not have more than two decimal places")
+	}
+	if !cents.Num().IsInt64() {
+		return 0, errors.New("amount is too large")
+	}
+	return Money(cents.Num().Int64()), nil
+}
+
+// Float64 returns the amount in whole units, for display and arithmetic with
+// rates
+func (m Money) Float64() float64 {
+	return float64(m) / 100
+}
+
+// String formats the amount with two decimal places, e.g. "-12.50"
+func (m Money) String() string {
+	sign := ""
+	cents := int64(m)
+	if cents < 0 {
+		sign = "-"
+	}
+	// Negating math.MinInt64 overflows, so divide before taking the absolute value
+	units, remainder := cents/100, cents%100
+	if units < 0 {
+		units = -units
+	}
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, units, remainder)
+}
+
+// MarshalJSON writes the amount as a number with two decimal places
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON reads the amount from a number, without rounding through a
+// float
+func (m *Money) UnmarshalJSON(data []byte) error {
+	amount, err := ParseMoney(string(data))
+	if err != nil {
+		return err
+	}
+	*m = amount
+	return nil
+}
@@ -0,0 +1,57 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestMoney(t *testing.T) {
+	for _, tt := range []struct {
+		money Money
+		text  string
+	}{
+		{0, "0.00"},
+		{5, "0.05"},
+		{1250, "12.50"},
+		{-5, "-0.05"},
+		{-1250, "-12.50"},
+		{math.MinInt64, "-92233720368547758.08"},
+	} {
+		if got := tt.money.String(); got != tt.text {
+			t.Errorf("Expected %d cents to be %q, got %q", tt.money, tt.text, got)
+		}
+	}
+
+	// Amounts that are not exact in binary floating point add up exactly
+	var total Money
+	for range 10 {
+		amount, err := ParseMoney("0.1")
+		if err != nil {
+			t.Fatalf("Failed to parse amount: %v", err)
+		}
+		total += amount
+	}
+	if total != 100 {
+		t.Errorf("Expected ten 0.10 to be 1.00, got %s", total)
+	}
+
+	var payment struct {
+		Amount Money `json:"amount"`
+	}
+	if err := json.Unmarshal([]byte(`{"amount": 19.99}`), &payment); err != nil || payment.Amount != 1999 {
+		t.Errorf("Expected 1999 cents, got %d, %v", payment.Amount, err)
+	}
+	if data, err := json.Marshal(payment); err != nil || string(data) != `{"amount":19.99}` {
+		t.Errorf("Expected the amount to be written with two decimal places, got %s, %v", data, err)
+	}
+	for _, invalid := range []string{`{"amount": 1.005}`, `{"amount": "1"}`, `{"amount": 1e30}`} {
+		if err := json.Unmarshal([]byte(invalid), &payment); err == nil {
+			t.Errorf("Expected %s to be rejected", invalid)
+		}
+	}
+
+	if got := MoneyFromFloat(0.1 + 0.2); got != 30 {
+		t.Errorf("Expected 0.1 + 0.2 to round to 30 cents, got %d", got)
+	}
+}
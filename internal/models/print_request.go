@@ -19,14 +19,29 @@ const (
 type PrintRequest struct {
 	ID        string             `json:"id" db:"id"`
 	UserID    string             `json:"user_id" db:"user_id"`
+	GroupID   *string            `json:"group_id,omitempty" db:"group_id"` // Group whose moderators handle the request
 	FileLink  string             `json:"file_link" db:"file_link"`
 	Notes     string             `json:"notes" db:"notes"`
-	SpoolID   *int               `json:"spool_id,omitempty" db:"spool_id"` // Optional Spoolman spool ID
-	Color     *string            `json:"color,omitempty" db:"color"`       // Optional color preference
-	Material  *string            `json:"material,omitempty" db:"material"` // Optional material preference
+	SpoolID   *int               `json:"spool_id,omitempty" db:"spool_id"`     // Optional Spoolman spool ID
+	PrinterID *int               `json:"printer_id,omitempty" db:"printer_id"` // Printer the request is assigned to
+	Color     *string            `json:"color,omitempty" db:"color"`           // Optional color preference
+	Material  *string            `json:"material,omitempty" db:"material"`     // Optional material preference
 	Status    PrintRequestStatus `json:"status" db:"status"`
 	CreatedAt time.Time          `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time          `json:"updated_at" db:"updated_at"`
+
+	// SpoolNeedsReplacement is set when the selected spool was archived or
+	// emptied, so a moderator knows to pick another one
+	SpoolNeedsReplacement bool `json:"spool_needs_replacement" db:"spool_needs_replacement"`
+
+	// Filament usage, print time and cost estimated at submission, and
+	// recorded once the request is done
+	EstimatedGrams *float64 `json:"estimated_grams,omitempty" db:"estimated_grams"`
+	EstimatedHours *float64 `json:"estimated_hours,omitempty" db:"estimated_hours"`
+	EstimatedCost  *float64 `json:"estimated_cost,omitempty" db:"estimated_cost"`
+	ActualGrams    *float64 `json:"actual_grams,omitempty" db:"actual_grams"`
+	ActualHours    *float64 `json:"actual_hours,omitempty" db:"actual_hours"`
+	ActualCost     *float64 `json:"actual_cost,omitempty" db:"actual_cost"`
 }
 
 // NewPrintRequest creates a new print request with default values
@@ -41,3 +56,13 @@ func NewPrintRequest(userID, fileLink, notes string) *PrintRequest {
 		UpdatedAt: now,
 	}
 }
+
+// PrintRequestStatusEvent records a print request changing status, so that
+// how long requests wait at each stage can be measured
+type PrintRequestStatusEvent struct {
+	ID             int                 `json:"id" db:"id"`
+	PrintRequestID string              `json:"print_request_id" db:"print_request_id"`
+	FromStatus     *PrintRequestStatus `json:"from_status,omitempty" db:"from_status"` // Unknown for events from before they were recorded
+	ToStatus       PrintRequestStatus  `json:"to_status" db:"to_status"`
+	CreatedAt      time.Time           `json:"created_at" db:"created_at"`
+}
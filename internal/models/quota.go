@@ -0,0 +1,50 @@
+package models
+
+import "time"
+
+// QuotaScope is what a quota override applies to
+type QuotaScope string
+
+const (
+	QuotaScopeUser QuotaScope = "user" // Subject is a user ID
+	QuotaScopeRole QuotaScope = "role" // Subject is a role name
+)
+
+// IsValid checks if the quota scope is valid
+func (s QuotaScope) IsValid() bool {
+	return s == QuotaScopeUser || s == QuotaScopeRole
+}
+
+// QuotaLimits are the limits on what a user may request. A nil limit inherits
+// the configured one and zero means unlimited.
+type QuotaLimits struct {
+	MaxOpenRequests *int     `json:"max_open_requests" db:"max_open_requests"`
+	MonthlyGrams    *float64 `json:"monthly_grams" db:"monthly_grams"`
+	MonthlyHours    *float64 `json:"monthly_hours" db:"monthly_hours"`
+}
+
+// QuotaOverride overrides the configured quotas for a user or a role. User
+// overrides take precedence over role overrides.
+type QuotaOverride struct {
+	ID      int        `json:"id" db:"id"`
+	Scope   QuotaScope `json:"scope" db:"scope"`
+	Subject string     `json:"subject" db:"subject"`
+	QuotaLimits
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// QuotaAllowance is how much of a single quota has been used
+type QuotaAllowance struct {
+	Limit     float64  `json:"limit"` // Zero means unlimited
+	Used      float64  `json:"used"`
+	Remaining *float64 `json:"remaining"` // Nil when unlimited
+}
+
+// QuotaStatus is a user's usage of each of their quotas
+type QuotaStatus struct {
+	OpenRequests QuotaAllowance `json:"open_requests"`
+	MonthlyGrams QuotaAllowance `json:"monthly_grams"`
+	MonthlyHours QuotaAllowance `json:"monthly_hours"`
+	ResetsAt     time.Time      `json:"resets_at"` // When the monthly quotas reset
+}
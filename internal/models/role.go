@@ -1,5 +1,12 @@
 package models
 
+import (
+	"maps"
+	"slices"
+	"sync"
+	"time"
+)
+
 // Role represents the different user roles in the system
 type Role string
 
@@ -12,14 +19,12 @@ const (
 	RoleAdmin Role = "admin"
 )
 
-// IsValid checks if the role is a valid role value
+// IsValid checks if the role is a known role
 func (r Role) IsValid() bool {
-	switch r {
-	case RoleUser, RoleModerator, RoleAdmin:
-		return true
-	default:
-		return false
-	}
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	_, ok := registry.grants[r]
+	return ok
 }
 
 // String returns the string representation of the role
@@ -27,25 +32,24 @@ func (r Role) String() string {
 	return string(r)
 }
 
-// HasPermission checks if the role has the specified permission
+// HasPermission checks if the role grants the specified permission
 func (r Role) HasPermission(permission Permission) bool {
-	switch r {
-	case RoleAdmin:
-		// Admin has all permissions
-		return true
-	case RoleModerator:
-		// Moderator can manage print requests and view users
-		return permission == PermissionViewUsers ||
-			permission == PermissionManagePrintRequests ||
-			permission == PermissionViewOwnPrintRequests ||
-			permission == PermissionCreatePrintRequests
-	case RoleUser:
-		// User can only manage their own print requests
-		return permission == PermissionViewOwnPrintRequests ||
-			permission == PermissionCreatePrintRequests
-	default:
-		return false
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return registry.grants[r][permission]
+}
+
+// Permissions returns the permissions the role grants
+func (r Role) Permissions() []Permission {
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	permissions := []Permission{}
+	for _, permission := range AllPermissions() {
+		if registry.grants[r][permission] {
+			permissions = append(permissions, permission)
+		}
 	}
+	return permissions
 }
 
 // Permission represents specific system permissions
@@ -56,6 +60,11 @@ const (
 	PermissionCreatePrintRequests  Permission = "create_print_requests"
 	PermissionViewOwnPrintRequests Permission = "view_own_print_requests"
 	PermissionManagePrintRequests  Permission = "manage_print_requests"
+	// PermissionApprovePrintRequests allows moving requests out of pending approval
+	PermissionApprovePrintRequests Permission = "approve_print_requests"
+
+	// PermissionViewGroupPrintRequests allows seeing every request in a group
+	PermissionViewGroupPrintRequests Permission = "view_group_print_requests"
 
 	// User management permissions
 	PermissionViewUsers    Permission = "view_users"
@@ -65,14 +74,117 @@ const (
 	// System permissions
 	PermissionAccessAdmin     Permission = "access_admin"
 	PermissionViewSystemStats Permission = "view_system_stats"
+	PermissionViewAuditLog    Permission = "view_audit_log"
+
+	// Resource management permissions
+	PermissionManagePrinters  Permission = "manage_printers"
+	PermissionManageInventory Permission = "manage_inventory"
+	PermissionManageBilling   Permission = "manage_billing"
+	PermissionManageQuotas    Permission = "manage_quotas"
+	PermissionManageGroups    Permission = "manage_groups"
+	PermissionManageRoles     Permission = "manage_roles"
 )
 
+// AllPermissions returns every permission a role can grant
+func AllPermissions() []Permission {
+	return []Permission{
+		PermissionCreatePrintRequests,
+		PermissionViewOwnPrintRequests,
+		PermissionViewGroupPrintRequests,
+		PermissionManagePrintRequests,
+		PermissionApprovePrintRequests,
+		PermissionViewUsers,
+		PermissionManageUsers,
+		PermissionPromoteUsers,
+		PermissionAccessAdmin,
+		PermissionViewSystemStats,
+		PermissionViewAuditLog,
+		PermissionManagePrinters,
+		PermissionManageInventory,
+		PermissionManageBilling,
+		PermissionManageQuotas,
+		PermissionManageGroups,
+		PermissionManageRoles,
+	}
+}
+
+// IsValid checks if the permission is a known permission
+func (p Permission) IsValid() bool {
+	return slices.Contains(AllPermissions(), p)
+}
+
+// RoleDefinition is a role together with the permissions it grants
+type RoleDefinition struct {
+	Name        Role         `json:"name" db:"name"`
+	Description string       `json:"description" db:"description"`
+	BuiltIn     bool         `json:"built_in" db:"built_in"`
+	Permissions []Permission `json:"permissions" db:"-"`
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+// BuiltInRoles returns the built-in roles with the permissions they are
+// seeded with. They apply until roles are loaded from the database.
+func BuiltInRoles() []*RoleDefinition {
+	userPermissions := []Permission{
+		PermissionCreatePrintRequests,
+		PermissionViewOwnPrintRequests,
+	}
+	moderatorPermissions := append(slices.Clone(userPermissions),
+		PermissionViewGroupPrintRequests,
+		PermissionManagePrintRequests,
+		PermissionApprovePrintRequests,
+		PermissionViewUsers,
+		PermissionManageUsers,
+		PermissionAccessAdmin,
+		PermissionViewSystemStats,
+		PermissionManagePrinters,
+		PermissionManageInventory,
+	)
+
+	return []*RoleDefinition{
+		{Name: RoleUser, BuiltIn: true, Permissions: userPermissions},
+		{Name: RoleModerator, BuiltIn: true, Permissions: moderatorPermissions},
+		{Name: RoleAdmin, BuiltIn: true, Permissions: AllPermissions()},
+	}
+}
+
+// registry holds the permissions granted by each known role
+var registry = struct {
+	mu     sync.RWMutex
+	grants map[Role]map[Permission]bool
+}{grants: grantsOf(BuiltInRoles())}
+
+// SetRoles replaces the known roles and their permissions, e.g. after loading
+// them from the database
+func SetRoles(roles []*RoleDefinition) {
+	grants := grantsOf(roles)
+
+	registry.mu.Lock()
+	defer registry.mu.Unlock()
+	registry.grants = grants
+}
+
+// grantsOf indexes the permissions granted by each role
+func grantsOf(roles []*RoleDefinition) map[Role]map[Permission]bool {
+	grants := make(map[Role]map[Permission]bool, len(roles))
+	for _, role := range roles {
+		grants[role.Name] = make(map[Permission]bool, len(role.Permissions))
+		for _, permission := range role.Permissions {
+			grants[role.Name][permission] = true
+		}
+	}
+	return grants
+}
+
 // DefaultRole returns the default role for new users
 func DefaultRole() Role {
 	return RoleUser
 }
 
-// AllRoles returns all available roles
+// AllRoles returns all known roles, sorted by name
 func AllRoles() []Role {
-	return []Role{RoleUser, RoleModerator, RoleAdmin}
+	registry.mu.RLock()
+	defer registry.mu.RUnlock()
+	return slices.Sorted(maps.Keys(registry.grants))
 }
@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+// UserTOTP is a user's authenticator app enrolment. It is stored when
+// enrolment starts, and only enabled once the user has confirmed a code.
+type UserTOTP struct {
+	UserID  string `json:"user_id" db:"user_id"`
+	Secret  string `json:"-" db:"secret"` // Never serialize the secret
+	Enabled bool   `json:"enabled" db:"enabled"`
+	// LastCounter is the time step of the last code accepted, so that a code
+	// cannot be used twice
+	LastCounter int64      `json:"-" db:"last_counter"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	EnabledAt   *time.Time `json:"enabled_at,omitempty" db:"enabled_at"`
+}
+
+// RecoveryCode is a one-time code for logging in without the authenticator
+// app. Only a hash of the code is stored.
+type RecoveryCode struct {
+	ID        string     `json:"id" db:"id"`
+	UserID    string     `json:"user_id" db:"user_id"`
+	CodeHash  string     `json:"-" db:"code_hash"`
+	UsedAt    *time.Time `json:"used_at,omitempty" db:"used_at"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
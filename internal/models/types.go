@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Printer struct {
 	Id         int       `db:"id" json:"id"`
 	Name       string    `db:"name" json:"name"`
@@ -14,14 +16,35 @@ type Dimension struct {
 }
 
 type Material struct {
-	Id   int    `db:"id" json:"id"`
-	Name string `db:"name" json:"name"`
+	Id       int     `db:"id" json:"id"`
+	Name     string  `db:"name" json:"name"`
+	Density  float64 `db:"density" json:"density"`   // g/cm³
+	Diameter float64 `db:"diameter" json:"diameter"` // mm
 }
 
 type Filament struct {
-	Id       int      `db:"id" json:"id"`
-	Name     string   `db:"name" json:"name"`
-	Material Material `db:"material" json:"material"`
+	Id           int      `db:"id" json:"id"`
+	Name         string   `db:"name" json:"name"`
+	Material     Material `db:"material" json:"material"`
+	Vendor       string   `db:"vendor" json:"vendor"`
+	ColorHex     string   `db:"color_hex" json:"color_hex"`
+	Weight       float64  `db:"weight" json:"weight"` // Net filament weight of a full spool in grams
+	Price        float64  `db:"price" json:"price"`   // Price of a full spool
+	ExtruderTemp int      `db:"settings_extruder_temp" json:"settings_extruder_temp"`
+	BedTemp      int      `db:"settings_bed_temp" json:"settings_bed_temp"`
+}
+
+// Spool is a physical spool of filament in the local inventory
+type Spool struct {
+	Id              int       `db:"id" json:"id"`
+	Filament        Filament  `db:"filament" json:"filament"`
+	InitialWeight   float64   `db:"initial_weight" json:"initial_weight"`
+	RemainingWeight float64   `db:"remaining_weight" json:"remaining_weight"`
+	Location        string    `db:"location" json:"location"`
+	LotNr           string    `db:"lot_nr" json:"lot_nr"`
+	Comment         string    `db:"comment" json:"comment"`
+	Archived        bool      `db:"archived" json:"archived"`
+	CreatedAt       time.Time `db:"created_at" json:"created_at"`
 }
 
 type Job struct {
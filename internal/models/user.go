@@ -17,8 +17,25 @@ type User struct {
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt    time.Time `json:"updated_at" db:"updated_at"`
 	Enabled      bool      `json:"enabled" db:"enabled"`
+	// EmailVerifiedAt is when the user proved they receive mail at Email
+	EmailVerifiedAt *time.Time `json:"email_verified_at,omitempty" db:"email_verified_at"`
+	// MustChangePassword is set when an admin gives the user a temporary
+	// password, which they must change before doing anything else
+	MustChangePassword bool `json:"must_change_password" db:"must_change_password"`
+
+	// Memberships lists the groups the user belongs to. It is only loaded
+	// where group-scoped permissions are checked.
+	Memberships []GroupMembership `json:"groups,omitempty" db:"-"`
+
+	// Token is the API token the request was authenticated with, if any. The
+	// user's permissions are limited to the token's scopes.
+	Token *APIToken `json:"-" db:"-"`
 }
 
+// DeletedUserID is the ID of the disabled account that owns the print
+// requests of deleted users who chose to anonymise them
+const DeletedUserID = "deleted-user"
+
 // UserOIDCIdentity represents a user's OIDC identity mapping
 type UserOIDCIdentity struct {
 	ID           string    `json:"id" db:"id"`
@@ -28,13 +45,27 @@ type UserOIDCIdentity struct {
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
 }
 
-// UserSession represents an active user session
+// UserLDAPIdentity links a user to their entry in an LDAP directory
+type UserLDAPIdentity struct {
+	ID           string    `json:"id" db:"id"`
+	UserID       string    `json:"user_id" db:"user_id"`
+	ProviderName string    `json:"provider_name" db:"provider_name"`
+	Subject      string    `json:"subject" db:"subject"` // The user's ID attribute in the directory
+	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+}
+
+// UserSession represents a browser session stored in the database. Sessions
+// exist before login, e.g. while logging in with OIDC, so UserID may be empty.
 type UserSession struct {
 	ID           string    `json:"id" db:"id"`
 	UserID       string    `json:"user_id" db:"user_id"`
-	SessionToken string    `json:"-" db:"session_token"` // Never serialize session token
+	SessionToken string    `json:"-" db:"session_token"` // Hash of the cookie's token; never serialize it
+	Data         string    `json:"-" db:"data"`          // Encoded session values
+	UserAgent    string    `json:"user_agent" db:"user_agent"`
+	IPAddress    string    `json:"ip_address" db:"ip_address"`
 	ExpiresAt    time.Time `json:"expires_at" db:"expires_at"`
 	CreatedAt    time.Time `json:"created_at" db:"created_at"`
+	LastSeenAt   time.Time `json:"last_seen_at" db:"last_seen_at"`
 }
 
 // NewUser creates a new user with default values
@@ -81,12 +112,104 @@ func (s *UserSession) IsExpired() bool {
 
 // HasPermission checks if the user has the specified permission
 func (u *User) HasPermission(permission Permission) bool {
-	if !u.Enabled {
+	if !u.Enabled || !u.scopeAllows(permission) {
 		return false
 	}
 	return u.Role.HasPermission(permission)
 }
 
+// scopeAllows checks if the token the user authenticated with, if any, allows
+// the specified permission
+func (u *User) scopeAllows(permission Permission) bool {
+	return u.Token == nil || u.Token.HasScope(permission)
+}
+
+// GrantedPermissions returns the permissions the user has through their role
+func (u *User) GrantedPermissions() []Permission {
+	permissions := []Permission{}
+	for _, permission := range AllPermissions() {
+		if u.HasPermission(permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	return permissions
+}
+
+// CanGrantPermissions returns true if the user has every one of the
+// permissions, so that granting them to a role can't give anyone more access
+// than the user has
+func (u *User) CanGrantPermissions(permissions []Permission) bool {
+	for _, permission := range permissions {
+		if !u.HasPermission(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// CanGrantRole returns true if the user can give the role to others. Roles
+// other than the default need users who can promote others, only admins can
+// make admins, and nobody can give a role granting permissions they lack.
+func (u *User) CanGrantRole(role Role) bool {
+	if role != DefaultRole() && !u.HasPermission(PermissionPromoteUsers) {
+		return false
+	}
+	if role == RoleAdmin && !u.IsAdmin() {
+		return false
+	}
+	return u.CanGrantPermissions(role.Permissions())
+}
+
+// GroupRole returns the user's role in a group, and false if they are not a member
+func (u *User) GroupRole(groupID string) (GroupRole, bool) {
+	for _, membership := range u.Memberships {
+		if membership.GroupID == groupID {
+			return membership.Role, true
+		}
+	}
+	return "", false
+}
+
+// HasGroupPermission checks if the user has the specified permission within a
+// group, either through their global role or their role in the group. An
+// empty group ID only checks the global role.
+func (u *User) HasGroupPermission(permission Permission, groupID string) bool {
+	if u.HasPermission(permission) {
+		return true
+	}
+	if !u.Enabled || groupID == "" || !u.scopeAllows(permission) {
+		return false
+	}
+	role, ok := u.GroupRole(groupID)
+	return ok && role.HasPermission(permission)
+}
+
+// HasPermissionInAnyScope checks if the user has the specified permission
+// globally or within at least one of their groups
+func (u *User) HasPermissionInAnyScope(permission Permission) bool {
+	if u.HasPermission(permission) {
+		return true
+	}
+	for _, membership := range u.Memberships {
+		if u.HasGroupPermission(permission, membership.GroupID) {
+			return true
+		}
+	}
+	return false
+}
+
+// GroupIDsWithPermission returns the groups in which the user has the
+// specified permission through their group role
+func (u *User) GroupIDsWithPermission(permission Permission) []string {
+	var groupIDs []string
+	for _, membership := range u.Memberships {
+		if u.HasGroupPermission(permission, membership.GroupID) {
+			groupIDs = append(groupIDs, membership.GroupID)
+		}
+	}
+	return groupIDs
+}
+
 // IsAdmin returns true if the user has admin role
 func (u *User) IsAdmin() bool {
 	return u.Role == RoleAdmin
@@ -97,22 +220,38 @@ func (u *User) IsModerator() bool {
 	return u.Role == RoleModerator || u.Role == RoleAdmin
 }
 
-// CanManageUser returns true if this user can manage the target user
+// CanManageUser returns true if this user can manage the target user. Group
+// moderators are only considered if the target's memberships are loaded.
 func (u *User) CanManageUser(targetUser *User) bool {
 	// Can't manage yourself (for role changes)
 	if u.ID == targetUser.ID {
 		return false
 	}
 
-	// Admin can manage anyone
-	if u.Role == RoleAdmin {
+	// Users who can promote others (admins) can manage anyone
+	if u.HasPermission(PermissionPromoteUsers) {
 		return true
 	}
 
-	// Moderators can manage regular users but not other moderators or admins
-	if u.Role == RoleModerator && targetUser.Role == RoleUser {
+	// Users who can manage users (moderators) can manage those who cannot,
+	// but not other moderators or admins
+	regularUser := !targetUser.Role.HasPermission(PermissionManageUsers)
+	if u.HasPermission(PermissionManageUsers) && regularUser {
 		return true
 	}
 
+	// Group moderators can manage regular users who are plain members of a
+	// group they moderate
+	if regularUser && u.scopeAllows(PermissionManageUsers) {
+		for _, membership := range targetUser.Memberships {
+			if membership.Role != GroupRoleMember {
+				continue
+			}
+			if role, ok := u.GroupRole(membership.GroupID); ok && role == GroupRoleModerator {
+				return true
+			}
+		}
+	}
+
 	return false
 }
@@ -0,0 +1,150 @@
+package models
+
+import "testing"
+
+func TestGroupScopedPermissions(t *testing.T) {
+	labModerator := &User{ID: "mod", Role: RoleUser, Enabled: true, Memberships: []GroupMembership{
+		{GroupID: "lab", Role: GroupRoleModerator},
+		{GroupID: "club", Role: GroupRoleMember},
+	}}
+
+	tests := []struct {
+		name       string
+		permission Permission
+		groupID    string
+		want       bool
+	}{
+		{"manage own group", PermissionManagePrintRequests, "lab", true},
+		{"manage group as member", PermissionManagePrintRequests, "club", false},
+		{"manage other group", PermissionManagePrintRequests, "other", false},
+		{"manage without group", PermissionManagePrintRequests, "", false},
+		{"view group as member", PermissionViewGroupPrintRequests, "club", true},
+		{"group roles never grant user management", PermissionManageUsers, "lab", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := labModerator.HasGroupPermission(tt.permission, tt.groupID); got != tt.want {
+				t.Errorf("HasGroupPermission(%s, %q) = %v, want %v", tt.permission, tt.groupID, got, tt.want)
+			}
+		})
+	}
+
+	if !labModerator.HasPermissionInAnyScope(PermissionManagePrintRequests) {
+		t.Error("Expected group moderator to manage print requests in some scope")
+	}
+	if got := labModerator.GroupIDsWithPermission(PermissionManagePrintRequests); len(got) != 1 || got[0] != "lab" {
+		t.Errorf("Expected to manage only the lab's requests, got %v", got)
+	}
+
+	globalModerator := &User{ID: "global", Role: RoleModerator, Enabled: true}
+	if !globalModerator.HasGroupPermission(PermissionManagePrintRequests, "lab") {
+		t.Error("Expected global moderator to manage any group's requests")
+	}
+
+	labModerator.Enabled = false
+	if labModerator.HasGroupPermission(PermissionManagePrintRequests, "lab") {
+		t.Error("Expected disabled user to have no group permissions")
+	}
+}
+
+func TestCanManageUserInGroup(t *testing.T) {
+	labModerator := &User{ID: "mod", Role: RoleUser, Memberships: []GroupMembership{
+		{GroupID: "lab", Role: GroupRoleModerator},
+	}}
+
+	tests := []struct {
+		name   string
+		target *User
+		want   bool
+	}{
+		{"member of moderated group", &User{ID: "a", Role: RoleUser, Memberships: []GroupMembership{{GroupID: "lab", Role: GroupRoleMember}}}, true},
+		{"co-moderator", &User{ID: "b", Role: RoleUser, Memberships: []GroupMembership{{GroupID: "lab", Role: GroupRoleModerator}}}, false},
+		{"member of other group", &User{ID: "c", Role: RoleUser, Memberships: []GroupMembership{{GroupID: "club", Role: GroupRoleMember}}}, false},
+		{"global moderator in group", &User{ID: "d", Role: RoleModerator, Memberships: []GroupMembership{{GroupID: "lab", Role: GroupRoleMember}}}, false},
+		{"user without groups", &User{ID: "e", Role: RoleUser}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := labModerator.CanManageUser(tt.target); got != tt.want {
+				t.Errorf("CanManageUser() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTokenScopesLimitPermissions(t *testing.T) {
+	admin := &User{ID: "admin", Role: RoleAdmin, Enabled: true, Memberships: []GroupMembership{
+		{GroupID: "lab", Role: GroupRoleModerator},
+	}}
+	admin.Token = &APIToken{Scopes: []Permission{PermissionCreatePrintRequests, PermissionViewGroupPrintRequests}}
+
+	if !admin.HasPermission(PermissionCreatePrintRequests) {
+		t.Error("Expected scoped permission to be granted")
+	}
+	if admin.HasPermission(PermissionManageUsers) {
+		t.Error("Expected permission outside the token's scopes to be refused")
+	}
+	if admin.HasGroupPermission(PermissionManagePrintRequests, "lab") {
+		t.Error("Expected group permission outside the token's scopes to be refused")
+	}
+	if !admin.HasGroupPermission(PermissionViewGroupPrintRequests, "lab") {
+		t.Error("Expected scoped group permission to be granted")
+	}
+	if admin.CanManageUser(&User{ID: "other", Role: RoleUser}) {
+		t.Error("Expected a token without user management scope not to manage users")
+	}
+
+	// Scopes never add permissions the user's role does not have
+	user := &User{ID: "user", Role: RoleUser, Enabled: true, Token: &APIToken{Scopes: []Permission{PermissionManageUsers}}}
+	if user.HasPermission(PermissionManageUsers) {
+		t.Error("Expected scope not to grant permissions beyond the user's role")
+	}
+}
+
+func TestCanGrantRole(t *testing.T) {
+	t.Cleanup(func() { SetRoles(BuiltInRoles()) })
+	SetRoles(append(BuiltInRoles(),
+		&RoleDefinition{Name: "promoter", Permissions: []Permission{
+			PermissionCreatePrintRequests, PermissionViewOwnPrintRequests, PermissionManageUsers, PermissionPromoteUsers,
+		}},
+		&RoleDefinition{Name: "helper", Permissions: []Permission{PermissionCreatePrintRequests, PermissionManageUsers}},
+		&RoleDefinition{Name: "treasurer", Permissions: []Permission{PermissionManageBilling}},
+	))
+
+	admin := &User{ID: "admin", Role: RoleAdmin, Enabled: true}
+	moderator := &User{ID: "mod", Role: RoleModerator, Enabled: true}
+	promoter := &User{ID: "promoter", Role: "promoter", Enabled: true}
+
+	tests := []struct {
+		name  string
+		actor *User
+		role  Role
+		want  bool
+	}{
+		{"admin grants admin", admin, RoleAdmin, true},
+		{"admin grants custom role", admin, "treasurer", true},
+		{"moderator grants default role", moderator, RoleUser, true},
+		{"moderator cannot promote", moderator, "helper", false},
+		{"promoter grants role within their permissions", promoter, "helper", true},
+		{"promoter grants own role", promoter, "promoter", true},
+		{"promoter cannot grant permissions they lack", promoter, "treasurer", false},
+		{"promoter cannot grant moderator", promoter, RoleModerator, false},
+		{"promoter cannot grant admin", promoter, RoleAdmin, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.actor.CanGrantRole(tt.role); got != tt.want {
+				t.Errorf("CanGrantRole(%s) = %v, want %v", tt.role, got, tt.want)
+			}
+		})
+	}
+
+	// Token scopes limit what can be granted too
+	scoped := &User{ID: "scoped", Role: RoleAdmin, Enabled: true, Token: &APIToken{Scopes: []Permission{PermissionPromoteUsers}}}
+	if scoped.CanGrantRole(RoleModerator) {
+		t.Error("Expected a token without the moderator's permissions not to grant the role")
+	}
+}
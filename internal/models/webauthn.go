@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// WebAuthnCredential is a security key or passkey registered for logging in
+type WebAuthnCredential struct {
+	ID     string `json:"id" db:"id"`
+	UserID string `json:"user_id" db:"user_id"`
+	Name   string `json:"name" db:"name"`
+	// CredentialID is the authenticator's ID for the credential, base64url
+	// encoded
+	CredentialID string `json:"credential_id" db:"credential_id"`
+	PublicKey    []byte `json:"-" db:"public_key"` // COSE_Key
+	// SignCount is the authenticator's signature counter at its last use,
+	// which helps detect cloned authenticators
+	SignCount  int64      `json:"-" db:"sign_count"`
+	CreatedAt  time.Time  `json:"created_at" db:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+}
@@ -0,0 +1,71 @@
+package oidc_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/oidc"
+	"github.com/bjschafer/print-dis/internal/oidc/oidctest"
+)
+
+func TestVerify(t *testing.T) {
+	ctx := context.Background()
+	issuer := oidctest.NewIssuer(t, "print-dis", "secret")
+	provider := oidc.NewProvider(oidc.Config{
+		Name:      "test",
+		IssuerURL: issuer.URL(),
+		ClientID:  "print-dis",
+	}, nil)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %v", err)
+	}
+
+	valid := issuer.SignToken(map[string]any{"sub": "alice", "nonce": "n", "email": "alice@example.com", "email_verified": true})
+	header, payload, _ := strings.Cut(valid, ".")
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + strings.Split(payload, ".")[0] + "."
+
+	tests := []struct {
+		name  string
+		token string
+		nonce string
+	}{
+		{"wrong nonce", valid, "other"},
+		{"missing nonce", valid, ""},
+		{"expired", issuer.SignToken(map[string]any{"sub": "alice", "nonce": "n", "exp": time.Now().Add(-time.Hour).Unix()}), "n"},
+		{"issued in the future", issuer.SignToken(map[string]any{"sub": "alice", "nonce": "n", "iat": time.Now().Add(time.Hour).Unix()}), "n"},
+		{"other audience", issuer.SignToken(map[string]any{"sub": "alice", "nonce": "n", "aud": "someone-else"}), "n"},
+		{"other authorized party", issuer.SignToken(map[string]any{"sub": "alice", "nonce": "n", "aud": []string{"print-dis", "x"}, "azp": "x"}), "n"},
+		{"other issuer", issuer.SignToken(map[string]any{"sub": "alice", "nonce": "n", "iss": "https://evil.example.com"}), "n"},
+		{"missing subject", issuer.SignToken(map[string]any{"nonce": "n"}), "n"},
+		{"unsigned", unsigned, "n"},
+		{"tampered header", header + "x." + strings.SplitN(valid, ".", 2)[1], "n"},
+		{"signed with another key", oidctest.SignToken(otherKey, "test-key", map[string]any{"iss": issuer.URL(), "aud": "print-dis", "sub": "alice", "nonce": "n", "exp": time.Now().Add(time.Hour).Unix()}), "n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := provider.Verify(ctx, tt.token, tt.nonce); !errors.Is(err, oidc.ErrInvalidToken) {
+				t.Errorf("Expected ErrInvalidToken, got %v", err)
+			}
+		})
+	}
+
+	claims, err := provider.Verify(ctx, valid, "n")
+	if err != nil {
+		t.Fatalf("Failed to verify valid token: %v", err)
+	}
+	if claims.Subject != "alice" || claims.Email != "alice@example.com" || !claims.EmailVerified {
+		t.Errorf("Unexpected claims %+v", claims)
+	}
+	if claims.Raw["email"] != "alice@example.com" {
+		t.Errorf("Expected raw claims to include email, got %v", claims.Raw)
+	}
+}
@@ -0,0 +1,513 @@
+// Package qrcode encodes short text, such as otpauth:// URIs, as QR codes.
+//
+// It supports byte mode at error correction level M for versions 1 to 10,
+// which holds up to 213 bytes. That is enough for authenticator enrolment
+// links without pulling in a dependency for the whole specification.
+package qrcode
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+// ErrTooLong is returned when the text does not fit in the largest supported
+// version
+var ErrTooLong = errors.New("text too long for QR code")
+
+// quietZone is the light border, in modules, that scanners need around a code
+const quietZone = 4
+
+// Code is an encoded QR code
+type Code struct {
+	// Size is the width and height in modules
+	Size int
+
+	version    int
+	mask       int
+	modules    [][]bool // Indexed [y][x]; true is dark
+	isFunction [][]bool // Modules that are part of the fixed patterns
+}
+
+// versionInfo describes the error correction blocks of a version at level M
+type versionInfo struct {
+	ecPerBlock  int
+	blocks      []int // Data codewords in each block
+	alignment   []int // Alignment pattern centre coordinates
+	countLength int   // Bits in the byte mode character count
+}
+
+// versions are the supported versions at level M, indexed by version - 1
+var versions = []versionInfo{
+	{10, []int{16}, nil, 8},
+	{16, []int{28}, []int{6, 18}, 8},
+	{26, []int{44}, []int{6, 22}, 8},
+	{18, []int{32, 32}, []int{6, 26}, 8},
+	{24, []int{43, 43}, []int{6, 30}, 8},
+	{16, []int{27, 27, 27, 27}, []int{6, 34}, 8},
+	{18, []int{31, 31, 31, 31}, []int{6, 22, 38}, 8},
+	{22, []int{38, 38, 39, 39}, []int{6, 24, 42}, 8},
+	{22, []int{36, 36, 36, 37, 37}, []int{6, 26, 46}, 8},
+	{26, []int{43, 43, 43, 43, 44}, []int{6, 28, 50}, 16},
+}
+
+// dataCapacity returns the number of data codewords in a version
+func (v versionInfo) dataCapacity() int {
+	total := 0
+	for _, n := range v.blocks {
+		total += n
+	}
+	return total
+}
+
+// Encode encodes text as a QR code, using the smallest version it fits in
+func Encode(text string) (*Code, error) {
+	data := []byte(text)
+
+	version := 0
+	for i, info := range versions {
+		if 4+info.countLength+8*len(data) <= 8*info.dataCapacity() {
+			version = i + 1
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+	info := versions[version-1]
+
+	codewords := interleave(info, encodeData(info, data))
+
+	size := 4*version + 17
+	code := &Code{
+		Size:       size,
+		version:    version,
+		modules:    newGrid(size),
+		isFunction: newGrid(size),
+	}
+	code.drawFunctionPatterns(info)
+	code.drawCodewords(codewords)
+
+	// Use the mask that is easiest to scan
+	bestPenalty := -1
+	for mask := 0; mask < 8; mask++ {
+		code.applyMask(mask)
+		code.drawFormatBits(mask)
+		if penalty := code.penalty(); bestPenalty < 0 || penalty < bestPenalty {
+			bestPenalty = penalty
+			code.mask = mask
+		}
+		code.applyMask(mask) // Masks are XORs, so this undoes it
+	}
+	code.applyMask(code.mask)
+	code.drawFormatBits(code.mask)
+
+	return code, nil
+}
+
+// Dark reports whether the module at x, y is dark
+func (c *Code) Dark(x, y int) bool {
+	return c.modules[y][x]
+}
+
+// PNG renders the code as a PNG image, with each module scale pixels wide
+// and a quiet zone around it
+func (c *Code) PNG(scale int) ([]byte, error) {
+	if scale < 1 {
+		scale = 1
+	}
+	width := (c.Size + 2*quietZone) * scale
+	img := image.NewPaletted(image.Rect(0, 0, width, width), color.Palette{color.White, color.Black})
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if !c.modules[y][x] {
+				continue
+			}
+			for dy := 0; dy < scale; dy++ {
+				for dx := 0; dx < scale; dx++ {
+					img.SetColorIndex((x+quietZone)*scale+dx, (y+quietZone)*scale+dy, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// encodeData encodes data in byte mode and pads it to the version's capacity
+func encodeData(info versionInfo, data []byte) []byte {
+	capacity := 8 * info.dataCapacity()
+	var bits bitBuffer
+	bits.append(0b0100, 4) // Byte mode
+	bits.append(len(data), info.countLength)
+	for _, b := range data {
+		bits.append(int(b), 8)
+	}
+	bits.append(0, min(4, capacity-len(bits))) // Terminator
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xEC; len(bits) < capacity; pad ^= 0xEC ^ 0x11 {
+		bits.append(pad, 8)
+	}
+	return bits.bytes()
+}
+
+// interleave splits data into the version's blocks, adds error correction to
+// each, and interleaves the blocks' codewords
+func interleave(info versionInfo, data []byte) []byte {
+	divisor := reedSolomonDivisor(info.ecPerBlock)
+	dataBlocks := make([][]byte, len(info.blocks))
+	ecBlocks := make([][]byte, len(info.blocks))
+	maxLength := 0
+	for i, n := range info.blocks {
+		dataBlocks[i], data = data[:n], data[n:]
+		ecBlocks[i] = reedSolomonRemainder(dataBlocks[i], divisor)
+		maxLength = max(maxLength, n)
+	}
+
+	var result []byte
+	for i := 0; i < maxLength; i++ {
+		for _, block := range dataBlocks {
+			if i < len(block) {
+				result = append(result, block[i])
+			}
+		}
+	}
+	for i := 0; i < info.ecPerBlock; i++ {
+		for _, block := range ecBlocks {
+			result = append(result, block[i])
+		}
+	}
+	return result
+}
+
+// drawFunctionPatterns draws the finder, timing and alignment patterns, and
+// reserves the format and version information areas
+func (c *Code) drawFunctionPatterns(info versionInfo) {
+	for i := 0; i < c.Size; i++ {
+		c.setFunction(6, i, i%2 == 0)
+		c.setFunction(i, 6, i%2 == 0)
+	}
+
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	last := len(info.alignment) - 1
+	for i, x := range info.alignment {
+		for j, y := range info.alignment {
+			// Skip those that would overlap the finder patterns
+			if (i == 0 && j == 0) || (i == 0 && j == last) || (i == last && j == 0) {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.setFunction(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	c.drawFormatBits(0)
+	c.drawVersionBits()
+}
+
+// drawFinder draws a finder pattern and its separator centred on x, y
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || xx >= c.Size || yy < 0 || yy >= c.Size {
+				continue
+			}
+			dist := max(abs(dx), abs(dy))
+			c.setFunction(xx, yy, dist != 2 && dist != 4)
+		}
+	}
+}
+
+// drawFormatBits draws both copies of the error correction level and mask
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatBits(mask)
+
+	for i := 0; i <= 5; i++ {
+		c.setFunction(8, i, bit(bits, i))
+	}
+	c.setFunction(8, 7, bit(bits, 6))
+	c.setFunction(8, 8, bit(bits, 7))
+	c.setFunction(7, 8, bit(bits, 8))
+	for i := 9; i < 15; i++ {
+		c.setFunction(14-i, 8, bit(bits, i))
+	}
+
+	for i := 0; i < 8; i++ {
+		c.setFunction(c.Size-1-i, 8, bit(bits, i))
+	}
+	for i := 8; i < 15; i++ {
+		c.setFunction(8, c.Size-15+i, bit(bits, i))
+	}
+	c.setFunction(8, c.Size-8, true) // Always dark
+}
+
+// drawVersionBits draws both copies of the version, which versions 7 and up
+// carry
+func (c *Code) drawVersionBits() {
+	if c.version < 7 {
+		return
+	}
+	bits := versionBits(c.version)
+	for i := 0; i < 18; i++ {
+		a, b := c.Size-11+i%3, i/3
+		c.setFunction(a, b, bit(bits, i))
+		c.setFunction(b, a, bit(bits, i))
+	}
+}
+
+// drawCodewords fills the modules that are not part of a function pattern
+// with the codewords, in the zigzag order of the specification
+func (c *Code) drawCodewords(codewords []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5 // Skip the vertical timing pattern
+		}
+		upward := (right+1)&2 == 0
+		for vert := 0; vert < c.Size; vert++ {
+			y := vert
+			if upward {
+				y = c.Size - 1 - vert
+			}
+			for j := 0; j < 2; j++ {
+				x := right - j
+				if c.isFunction[y][x] || i >= len(codewords)*8 {
+					continue
+				}
+				c.modules[y][x] = bit(int(codewords[i>>3]), 7-i&7)
+				i++
+			}
+		}
+	}
+}
+
+// applyMask inverts the data modules selected by the mask pattern
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			if c.isFunction[y][x] {
+				continue
+			}
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// penalty scores how hard the code is to scan, using the rules of the
+// specification
+func (c *Code) penalty() int {
+	penalty := 0
+
+	// Runs of five or more modules of the same colour, and patterns that
+	// look like finders
+	finderLike := [][]bool{
+		{true, false, true, true, true, false, true, false, false, false, false},
+		{false, false, false, false, true, false, true, true, true, false, true},
+	}
+	for _, vertical := range []bool{false, true} {
+		for a := 0; a < c.Size; a++ {
+			run := 0
+			for b := 0; b < c.Size; b++ {
+				if b > 0 && c.at(a, b, vertical) == c.at(a, b-1, vertical) {
+					run++
+				} else {
+					run = 1
+				}
+				if run == 5 {
+					penalty += 3
+				} else if run > 5 {
+					penalty++
+				}
+
+				for _, pattern := range finderLike {
+					if b+len(pattern) > c.Size {
+						continue
+					}
+					matches := true
+					for k, dark := range pattern {
+						if c.at(a, b+k, vertical) != dark {
+							matches = false
+							break
+						}
+					}
+					if matches {
+						penalty += 40
+					}
+				}
+			}
+		}
+	}
+
+	// 2x2 blocks of the same colour
+	for y := 0; y < c.Size-1; y++ {
+		for x := 0; x < c.Size-1; x++ {
+			dark := c.modules[y][x]
+			if dark == c.modules[y][x+1] && dark == c.modules[y+1][x] && dark == c.modules[y+1][x+1] {
+				penalty += 3
+			}
+		}
+	}
+
+	// Imbalance between dark and light modules
+	dark := 0
+	for _, row := range c.modules {
+		for _, module := range row {
+			if module {
+				dark++
+			}
+		}
+	}
+	total := c.Size * c.Size
+	penalty += abs(dark*20-total*10) / total * 10
+
+	return penalty
+}
+
+// at returns the module b along row a, or column a when vertical
+func (c *Code) at(a, b int, vertical bool) bool {
+	if vertical {
+		return c.modules[b][a]
+	}
+	return c.modules[a][b]
+}
+
+// setFunction sets a module that is part of a function pattern
+func (c *Code) setFunction(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.isFunction[y][x] = true
+}
+
+// formatBits returns the 15 format information bits for level M and a mask
+func formatBits(mask int) int {
+	data := 0b00<<3 | mask // 00 is level M
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+// versionBits returns the 18 version information bits
+func versionBits(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1F25
+	}
+	return version<<12 | rem
+}
+
+// reedSolomonDivisor returns the generator polynomial of the given degree,
+// without its leading term, with coefficients from highest to lowest power
+func reedSolomonDivisor(degree int) []byte {
+	result := make([]byte, degree)
+	result[degree-1] = 1
+	root := byte(1)
+	for i := 0; i < degree; i++ {
+		for j := range result {
+			result[j] = gfMultiply(result[j], root)
+			if j+1 < len(result) {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMultiply(root, 0x02)
+	}
+	return result
+}
+
+// reedSolomonRemainder returns the error correction codewords for data
+func reedSolomonRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coefficient := range divisor {
+			result[i] ^= gfMultiply(coefficient, factor)
+		}
+	}
+	return result
+}
+
+// gfMultiply multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1
+func gfMultiply(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11D
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+// bitBuffer accumulates bits, most significant first
+type bitBuffer []bool
+
+// append appends the low n bits of value
+func (b *bitBuffer) append(value, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, bit(value, i))
+	}
+}
+
+// bytes packs the bits into bytes
+func (b bitBuffer) bytes() []byte {
+	result := make([]byte, (len(b)+7)/8)
+	for i, set := range b {
+		if set {
+			result[i>>3] |= 0x80 >> (i & 7)
+		}
+	}
+	return result
+}
+
+func newGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+func bit(value, i int) bool {
+	return value>>i&1 != 0
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
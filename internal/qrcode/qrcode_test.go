@@ -0,0 +1,130 @@
+package qrcode
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestReedSolomon(t *testing.T) {
+	// Version 1-M "HELLO WORLD" example from the specification's annex
+	data := []byte{32, 91, 11, 120, 209, 114, 220, 77, 67, 64, 236, 17, 236, 17, 236, 17}
+	want := []byte{196, 35, 39, 119, 235, 215, 231, 226, 93, 23}
+
+	got := reedSolomonRemainder(data, reedSolomonDivisor(10))
+	if !bytes.Equal(got, want) {
+		t.Errorf("reedSolomonRemainder() = %v, want %v", got, want)
+	}
+}
+
+func TestFormatAndVersionBits(t *testing.T) {
+	formats := map[int]int{
+		0: 0b101010000010010,
+		5: 0b100000011001110,
+		7: 0b100101010100000,
+	}
+	for mask, want := range formats {
+		if got := formatBits(mask); got != want {
+			t.Errorf("formatBits(%d) = %015b, want %015b", mask, got, want)
+		}
+	}
+
+	if got, want := versionBits(7), 0b000111110010010100; got != want {
+		t.Errorf("versionBits(7) = %018b, want %018b", got, want)
+	}
+	if got, want := versionBits(10), 0b001010010011010011; got != want {
+		t.Errorf("versionBits(10) = %018b, want %018b", got, want)
+	}
+}
+
+func TestEncodeData(t *testing.T) {
+	got := encodeData(versions[0], []byte("hi"))
+	want := []byte{0x40, 0x26, 0x86, 0x90, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11, 0xEC, 0x11}
+	if !bytes.Equal(got, want) {
+		t.Errorf("encodeData() = %x, want %x", got, want)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		length  int
+		version int
+	}{
+		{1, 1},
+		{14, 1},
+		{15, 2},
+		{106, 6},
+		{154, 9},
+		{213, 10},
+	}
+
+	for _, tt := range tests {
+		code, err := Encode(strings.Repeat("a", tt.length))
+		if err != nil {
+			t.Fatalf("Encode(%d bytes) failed: %v", tt.length, err)
+		}
+		if code.version != tt.version || code.Size != 4*tt.version+17 {
+			t.Errorf("Encode(%d bytes) gave version %d, size %d, want version %d", tt.length, code.version, code.Size, tt.version)
+		}
+
+		// Finder patterns in three corners, and the module that is always dark
+		for _, corner := range [][2]int{{0, 0}, {code.Size - 7, 0}, {0, code.Size - 7}} {
+			x, y := corner[0], corner[1]
+			if !code.Dark(x, y) || !code.Dark(x+6, y+6) || code.Dark(x+1, y+1) || !code.Dark(x+3, y+3) {
+				t.Errorf("Encode(%d bytes) has no finder pattern at %v", tt.length, corner)
+			}
+		}
+		if !code.Dark(8, code.Size-8) {
+			t.Errorf("Encode(%d bytes) is missing the dark module", tt.length)
+		}
+
+		// The format information records the chosen mask
+		format := 0
+		for i := 0; i < 8; i++ {
+			if code.Dark(code.Size-1-i, 8) {
+				format |= 1 << i
+			}
+		}
+		for i := 8; i < 15; i++ {
+			if code.Dark(8, code.Size-15+i) {
+				format |= 1 << i
+			}
+		}
+		if format != formatBits(code.mask) {
+			t.Errorf("Encode(%d bytes) format bits %015b do not match mask %d", tt.length, format, code.mask)
+		}
+	}
+
+	if _, err := Encode(strings.Repeat("a", 214)); err != ErrTooLong {
+		t.Errorf("Expected ErrTooLong, got %v", err)
+	}
+}
+
+func TestPNG(t *testing.T) {
+	code, err := Encode("otpauth://totp/print-dis:alice?secret=JBSWY3DPEHPK3PXP&issuer=print-dis")
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	data, err := code.PNG(4)
+	if err != nil {
+		t.Fatalf("PNG failed: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Failed to decode PNG: %v", err)
+	}
+
+	width := (code.Size + 2*quietZone) * 4
+	if bounds := img.Bounds(); bounds.Dx() != width || bounds.Dy() != width {
+		t.Errorf("Expected %dx%d image, got %v", width, width, bounds)
+	}
+	// Top-left finder pattern, inside the quiet zone
+	if r, _, _, _ := img.At(quietZone*4, quietZone*4).RGBA(); r != 0 {
+		t.Error("Expected the finder pattern to be black")
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r == 0 {
+		t.Error("Expected the quiet zone to be white")
+	}
+}
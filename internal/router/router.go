@@ -8,17 +8,33 @@ import (
 	"github.com/bjschafer/print-dis/internal/config"
 	"github.com/bjschafer/print-dis/internal/handlers"
 	"github.com/bjschafer/print-dis/internal/middleware"
+	"github.com/bjschafer/print-dis/internal/models"
 	"github.com/bjschafer/print-dis/internal/response"
 )
 
 // Dependencies holds all the dependencies needed for route setup
 type Dependencies struct {
-	Config               *config.Config
-	SessionStore         *middleware.SessionStore
-	PrintRequestHandler  *handlers.PrintRequestHandler
-	AuthHandler          *handlers.AuthHandler
-	AdminHandler         *handlers.AdminHandler
-	SpoolmanHandler      *api.SpoolmanHandler
+	Config                *config.Config
+	SessionStore          *middleware.SessionStore
+	PrintRequestHandler   *handlers.PrintRequestHandler
+	AuthHandler           *handlers.AuthHandler
+	OIDCHandler           *handlers.OIDCHandler
+	TokenHandler          *handlers.TokenHandler
+	SessionHandler        *handlers.SessionHandler
+	TwoFactorHandler      *handlers.TwoFactorHandler
+	WebAuthnHandler       *handlers.WebAuthnHandler // Only set when WebAuthn is enabled
+	AdminHandler          *handlers.AdminHandler
+	InvitationHandler     *handlers.InvitationHandler
+	InventoryHandler      *api.InventoryHandler
+	LocalInventoryHandler *handlers.LocalInventoryHandler // Only set when the built-in inventory is used
+	PrinterHandler        *handlers.PrinterHandler
+	PricingHandler        *handlers.PricingHandler // Only set when pricing is enabled
+	BillingHandler        *handlers.BillingHandler // Only set when billing is enabled
+	QuotaHandler          *handlers.QuotaHandler   // Only set when quotas are enabled
+	GroupHandler          *handlers.GroupHandler
+	RoleHandler           *handlers.RoleHandler
+	AuditHandler          *handlers.AuditHandler
+	AnalyticsHandler      *handlers.AnalyticsHandler
 }
 
 // SetupRoutes configures all application routes
@@ -32,7 +48,13 @@ func SetupRoutes(mux *http.ServeMux, deps *Dependencies) {
 	setupPrintRequestRoutes(mux, deps)
 	setupUserRoutes(mux, deps)
 	setupAdminRoutes(mux, deps)
-	setupSpoolmanRoutes(mux, deps)
+	setupInventoryRoutes(mux, deps)
+	setupPrinterRoutes(mux, deps)
+	setupPricingRoutes(mux, deps)
+	setupBillingRoutes(mux, deps)
+	setupQuotaRoutes(mux, deps)
+	setupGroupRoutes(mux, deps)
+	setupRoleRoutes(mux, deps)
 }
 
 // setupAuthRoutes configures authentication-related routes
@@ -40,15 +62,51 @@ func setupAuthRoutes(mux *http.ServeMux, deps *Dependencies) {
 	sessionMW := deps.SessionStore.SessionMiddleware()
 	authMW := deps.SessionStore.AuthMiddleware(deps.Config)
 	authRateLimit := middleware.AuthRateLimit() // Strict rate limiting for auth endpoints
+	apiRateLimit := middleware.APIRateLimit()   // General API rate limiting
 
 	// Public auth endpoints (no auth required, but rate limited)
 	mux.Handle("/api/auth/login", authRateLimit(sessionMW(http.HandlerFunc(deps.AuthHandler.Login))))
 	mux.Handle("/api/auth/logout", sessionMW(http.HandlerFunc(deps.AuthHandler.Logout)))
 	mux.Handle("/api/auth/register", authRateLimit(sessionMW(http.HandlerFunc(deps.AuthHandler.Register))))
+	mux.Handle("/api/auth/login/2fa", authRateLimit(sessionMW(http.HandlerFunc(deps.AuthHandler.LoginTwoFactor))))
+	mux.Handle("GET /api/auth/oidc/providers", apiRateLimit(http.HandlerFunc(deps.OIDCHandler.ListProviders)))
+	mux.Handle("GET /api/auth/oidc/{provider}/login", authRateLimit(sessionMW(http.HandlerFunc(deps.OIDCHandler.Login))))
+	mux.Handle("GET /api/auth/oidc/{provider}/callback", authRateLimit(sessionMW(http.HandlerFunc(deps.OIDCHandler.Callback))))
+
+	// Links emailed to users to reset forgotten passwords and verify addresses
+	mux.Handle("/api/auth/forgot-password", authRateLimit(createMethodHandler(http.MethodPost, deps.AuthHandler.ForgotPassword)))
+	mux.Handle("/api/auth/reset-password", authRateLimit(createMethodHandler(http.MethodPost, deps.AuthHandler.ResetPassword)))
+	mux.Handle("/api/auth/verify-email", authRateLimit(createMethodHandler(http.MethodPost, deps.AuthHandler.VerifyEmail)))
+	mux.Handle("/api/auth/verify-email/resend", authRateLimit(createMethodHandler(http.MethodPost, deps.AuthHandler.ResendVerification)))
 
 	// Protected auth endpoints (auth required)
 	mux.Handle("/api/auth/me", sessionMW(authMW(http.HandlerFunc(deps.AuthHandler.GetCurrentUser))))
 	mux.Handle("/api/auth/change-password", sessionMW(authMW(http.HandlerFunc(deps.AuthHandler.ChangePassword))))
+
+	// Personal API tokens
+	apiTokensHandler := createAPITokensHandler(deps.TokenHandler)
+	mux.Handle("/api/auth/tokens", apiRateLimit(sessionMW(authMW(apiTokensHandler))))
+
+	// Active login sessions
+	sessionsHandler := createSessionsHandler(deps.SessionHandler)
+	mux.Handle("/api/auth/sessions", apiRateLimit(sessionMW(authMW(sessionsHandler))))
+	mux.Handle("/api/auth/sessions/logout-others", apiRateLimit(sessionMW(authMW(createMethodHandler(http.MethodPost, deps.SessionHandler.RevokeOtherSessions)))))
+
+	// Two-factor authentication setup. Confirming codes is rate limited like
+	// logging in, as it would otherwise allow guessing them.
+	mux.Handle("/api/auth/2fa", apiRateLimit(sessionMW(authMW(createMethodHandler(http.MethodGet, deps.TwoFactorHandler.GetStatus)))))
+	mux.Handle("/api/auth/2fa/enroll", apiRateLimit(sessionMW(authMW(createMethodHandler(http.MethodPost, deps.TwoFactorHandler.Enroll)))))
+	mux.Handle("/api/auth/2fa/confirm", authRateLimit(sessionMW(authMW(createMethodHandler(http.MethodPost, deps.TwoFactorHandler.Confirm)))))
+	mux.Handle("/api/auth/2fa/recovery-codes", authRateLimit(sessionMW(authMW(createMethodHandler(http.MethodPost, deps.TwoFactorHandler.RegenerateRecoveryCodes)))))
+	mux.Handle("/api/auth/2fa/disable", authRateLimit(sessionMW(authMW(createMethodHandler(http.MethodPost, deps.TwoFactorHandler.Disable)))))
+
+	// Security keys and passkeys
+	if deps.WebAuthnHandler != nil {
+		mux.Handle("/api/auth/login/passkey/options", authRateLimit(sessionMW(createMethodHandler(http.MethodPost, deps.AuthHandler.BeginPasskeyLogin))))
+		mux.Handle("/api/auth/login/passkey", authRateLimit(sessionMW(createMethodHandler(http.MethodPost, deps.AuthHandler.LoginPasskey))))
+		mux.Handle("/api/auth/webauthn/register/options", apiRateLimit(sessionMW(authMW(createMethodHandler(http.MethodPost, deps.WebAuthnHandler.BeginRegistration)))))
+		mux.Handle("/api/auth/webauthn/credentials", apiRateLimit(sessionMW(authMW(createWebAuthnCredentialsHandler(deps.WebAuthnHandler)))))
+	}
 }
 
 // setupPrintRequestRoutes configures print request-related routes
@@ -75,44 +133,123 @@ func setupUserRoutes(mux *http.ServeMux, deps *Dependencies) {
 	// User-specific print requests
 	userRequestsHandler := createUserRequestsHandler(deps.PrintRequestHandler)
 	mux.Handle("/api/user/print-requests", apiRateLimit(sessionMW(authMW(userRequestsHandler))))
+
+	// User's own print request statistics, for the dashboard
+	mux.Handle("/api/user/stats", apiRateLimit(sessionMW(authMW(createMethodHandler(http.MethodGet, deps.AnalyticsHandler.GetUserStats)))))
 }
 
 // setupAdminRoutes configures admin-only routes
 func setupAdminRoutes(mux *http.ServeMux, deps *Dependencies) {
 	sessionMW := deps.SessionStore.SessionMiddleware()
 	authMW := deps.SessionStore.AuthMiddleware(deps.Config)
-	modMW := middleware.RequireModerator(deps.SessionStore, deps.Config)
-	adminMW := middleware.RequireAdmin(deps.SessionStore, deps.Config)
+	viewUsersMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionViewUsers)
+	manageUsersMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionManageUsers)
+	promoteUsersMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionPromoteUsers)
+	viewStatsMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionViewSystemStats)
+	manageRequestsMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionManagePrintRequests)
+	accessAdminMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionAccessAdmin)
 	apiRateLimit := middleware.APIRateLimit() // General API rate limiting
 
-	// Admin user management
-	adminUsersHandler := createAdminUsersHandler(deps.AdminHandler)
-	mux.Handle("/api/admin/users", apiRateLimit(sessionMW(authMW(modMW(adminUsersHandler)))))
+	// Admin user management. Listing users needs view_users, and creating,
+	// editing and deleting them manage_users.
+	adminUsersHandler := createAdminUsersHandler(deps.AdminHandler, manageUsersMW)
+	mux.Handle("/api/admin/users", apiRateLimit(sessionMW(authMW(viewUsersMW(adminUsersHandler)))))
+
+	// Admin bulk import and export of users, e.g. a class each semester
+	mux.Handle("/api/admin/users/import", apiRateLimit(sessionMW(authMW(manageUsersMW(createMethodHandler(http.MethodPost, deps.AdminHandler.ImportUsers))))))
+	mux.Handle("/api/admin/users/export", apiRateLimit(sessionMW(authMW(viewUsersMW(createMethodHandler(http.MethodGet, deps.AdminHandler.ExportUsers))))))
 
-	// Admin user role updates (admin only)
+	// Admin password resets, giving users a temporary password
+	mux.Handle("/api/admin/users/password", apiRateLimit(sessionMW(authMW(manageUsersMW(createMethodHandler(http.MethodPost, deps.AdminHandler.ResetUserPassword))))))
+
+	// Admin user role updates
 	adminUserRoleHandler := createAdminUserRoleHandler(deps.AdminHandler)
-	mux.Handle("/api/admin/users/role", apiRateLimit(sessionMW(authMW(adminMW(adminUserRoleHandler)))))
+	mux.Handle("/api/admin/users/role", apiRateLimit(sessionMW(authMW(promoteUsersMW(adminUserRoleHandler)))))
 
-	// Admin user status updates (moderator+)
+	// Admin user status updates
 	adminUserStatusHandler := createAdminUserStatusHandler(deps.AdminHandler)
-	mux.Handle("/api/admin/users/status", apiRateLimit(sessionMW(authMW(modMW(adminUserStatusHandler)))))
+	mux.Handle("/api/admin/users/status", apiRateLimit(sessionMW(authMW(manageUsersMW(adminUserStatusHandler)))))
+
+	// Admin two-factor authentication reset, for users who lost their device
+	mux.Handle("/api/admin/users/2fa", apiRateLimit(sessionMW(authMW(manageUsersMW(createMethodHandler(http.MethodDelete, deps.TwoFactorHandler.ResetUser))))))
+
+	// Admin view and unlock of users locked out after failed logins
+	adminUserLockoutHandler := createAdminUserLockoutHandler(deps.AdminHandler)
+	mux.Handle("/api/admin/users/lockout", apiRateLimit(sessionMW(authMW(manageUsersMW(adminUserLockoutHandler)))))
+
+	// Admin invitation codes for registering when open registration is off
+	adminInvitationsHandler := createAdminInvitationsHandler(deps.InvitationHandler)
+	mux.Handle("/api/admin/invitations", apiRateLimit(sessionMW(authMW(manageUsersMW(adminInvitationsHandler)))))
 
-	// Admin stats (moderator+)
+	// Admin stats
 	adminStatsHandler := createAdminStatsHandler(deps.AdminHandler)
-	mux.Handle("/api/admin/stats", apiRateLimit(sessionMW(authMW(modMW(adminStatsHandler)))))
+	mux.Handle("/api/admin/stats", apiRateLimit(sessionMW(authMW(viewStatsMW(adminStatsHandler)))))
 
-	// Admin print requests with enhanced details (moderator+)
+	// Admin print request analytics: throughput, turnaround and usage
+	mux.Handle("/api/admin/analytics", apiRateLimit(sessionMW(authMW(viewStatsMW(createMethodHandler(http.MethodGet, deps.AnalyticsHandler.GetReport))))))
+
+	// Admin print requests with enhanced details, including for group moderators
 	adminPrintRequestsHandler := createAdminPrintRequestsHandler(deps.PrintRequestHandler)
-	mux.Handle("/api/admin/print-requests", apiRateLimit(sessionMW(authMW(modMW(adminPrintRequestsHandler)))))
+	mux.Handle("/api/admin/print-requests", apiRateLimit(sessionMW(authMW(manageRequestsMW(adminPrintRequestsHandler)))))
 
-	// Admin spoolman config (moderator+)
+	// Admin spoolman config
 	adminSpoolmanConfigHandler := createAdminSpoolmanConfigHandler(deps.AdminHandler)
-	mux.Handle("/api/admin/spoolman-config", apiRateLimit(sessionMW(authMW(modMW(adminSpoolmanConfigHandler)))))
+	mux.Handle("/api/admin/spoolman-config", apiRateLimit(sessionMW(authMW(accessAdminMW(adminSpoolmanConfigHandler)))))
+
+	// Audit log
+	viewAuditLogMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionViewAuditLog)
+	mux.Handle("/api/admin/audit", apiRateLimit(sessionMW(authMW(viewAuditLogMW(createMethodHandler(http.MethodGet, deps.AuditHandler.ListEvents))))))
+	mux.Handle("/api/admin/audit/export", apiRateLimit(sessionMW(authMW(viewAuditLogMW(createMethodHandler(http.MethodGet, deps.AuditHandler.ExportEvents))))))
+}
+
+// setupInventoryRoutes configures spool, filament and material routes
+func setupInventoryRoutes(mux *http.ServeMux, deps *Dependencies) {
+	if deps.InventoryHandler == nil {
+		return
+	}
+
+	sessionMW := deps.SessionStore.SessionMiddleware()
+	authMW := deps.SessionStore.AuthMiddleware(deps.Config)
+	manageInventoryMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionManageInventory)
+	apiRateLimit := middleware.APIRateLimit() // General API rate limiting
+
+	// Inventory read endpoints, also served under /api/spoolman for existing clients
+	for _, prefix := range []string{"/api/inventory", "/api/spoolman"} {
+		spoolsHandler := createSpoolsHandler(deps.InventoryHandler)
+		mux.Handle(prefix+"/spools", apiRateLimit(sessionMW(authMW(spoolsHandler))))
+
+		spoolHandler := createSpoolHandler(deps.InventoryHandler)
+		mux.Handle(prefix+"/spool", apiRateLimit(sessionMW(authMW(spoolHandler))))
+
+		materialsHandler := createMaterialsHandler(deps.InventoryHandler)
+		mux.Handle(prefix+"/materials", apiRateLimit(sessionMW(authMW(materialsHandler))))
+
+		vendorsHandler := createVendorsHandler(deps.InventoryHandler)
+		mux.Handle(prefix+"/vendors", apiRateLimit(sessionMW(authMW(vendorsHandler))))
+
+		filamentsHandler := createFilamentsHandler(deps.InventoryHandler)
+		mux.Handle(prefix+"/filaments", apiRateLimit(sessionMW(authMW(filamentsHandler))))
+
+		locationsHandler := createLocationsHandler(deps.InventoryHandler)
+		mux.Handle(prefix+"/locations", apiRateLimit(sessionMW(authMW(locationsHandler))))
+	}
+
+	// Local inventory management
+	if deps.LocalInventoryHandler != nil {
+		adminMaterialsHandler := createAdminMaterialsHandler(deps.LocalInventoryHandler)
+		mux.Handle("/api/admin/inventory/materials", apiRateLimit(sessionMW(authMW(manageInventoryMW(adminMaterialsHandler)))))
+
+		adminFilamentsHandler := createAdminFilamentsHandler(deps.LocalInventoryHandler)
+		mux.Handle("/api/admin/inventory/filaments", apiRateLimit(sessionMW(authMW(manageInventoryMW(adminFilamentsHandler)))))
+
+		adminSpoolsHandler := createAdminSpoolsHandler(deps.LocalInventoryHandler)
+		mux.Handle("/api/admin/inventory/spools", apiRateLimit(sessionMW(authMW(manageInventoryMW(adminSpoolsHandler)))))
+	}
 }
 
-// setupSpoolmanRoutes configures Spoolman integration routes (if enabled)
-func setupSpoolmanRoutes(mux *http.ServeMux, deps *Dependencies) {
-	if deps.SpoolmanHandler == nil {
+// setupPricingRoutes configures print pricing routes
+func setupPricingRoutes(mux *http.ServeMux, deps *Dependencies) {
+	if deps.PricingHandler == nil {
 		return
 	}
 
@@ -120,15 +257,94 @@ func setupSpoolmanRoutes(mux *http.ServeMux, deps *Dependencies) {
 	authMW := deps.SessionStore.AuthMiddleware(deps.Config)
 	apiRateLimit := middleware.APIRateLimit() // General API rate limiting
 
-	// Spoolman spools endpoints
-	spoolsHandler := createSpoolsHandler(deps.SpoolmanHandler)
-	mux.Handle("/api/spoolman/spools", apiRateLimit(sessionMW(authMW(spoolsHandler))))
+	quoteHandler := createQuoteHandler(deps.PricingHandler)
+	mux.Handle("/api/pricing/quote", apiRateLimit(sessionMW(authMW(quoteHandler))))
+}
+
+// setupBillingRoutes configures balance, payment and statement routes
+func setupBillingRoutes(mux *http.ServeMux, deps *Dependencies) {
+	if deps.BillingHandler == nil {
+		return
+	}
+
+	sessionMW := deps.SessionStore.SessionMiddleware()
+	authMW := deps.SessionStore.AuthMiddleware(deps.Config)
+	manageBillingMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionManageBilling)
+	apiRateLimit := middleware.APIRateLimit() // General API rate limiting
+
+	// A user's own balance and statements
+	mux.Handle("/api/billing/balance", apiRateLimit(sessionMW(authMW(createMethodHandler(http.MethodGet, deps.BillingHandler.GetBalance)))))
+	mux.Handle("/api/billing/statement", apiRateLimit(sessionMW(authMW(createMethodHandler(http.MethodGet, deps.BillingHandler.GetStatement)))))
+
+	// Ledger management
+	mux.Handle("/api/admin/billing/balances", apiRateLimit(sessionMW(authMW(manageBillingMW(createMethodHandler(http.MethodGet, deps.BillingHandler.ListBalances))))))
+	mux.Handle("/api/admin/billing/ledger", apiRateLimit(sessionMW(authMW(manageBillingMW(createMethodHandler(http.MethodGet, deps.BillingHandler.GetLedger))))))
+	mux.Handle("/api/admin/billing/statement", apiRateLimit(sessionMW(authMW(manageBillingMW(createMethodHandler(http.MethodGet, deps.BillingHandler.GetUserStatement))))))
+	mux.Handle("/api/admin/billing/payments", apiRateLimit(sessionMW(authMW(manageBillingMW(createMethodHandler(http.MethodPost, deps.BillingHandler.RecordPayment))))))
+	mux.Handle("/api/admin/billing/charges/waive", apiRateLimit(sessionMW(authMW(manageBillingMW(createMethodHandler(http.MethodPost, deps.BillingHandler.WaiveCharge))))))
+}
+
+// setupQuotaRoutes configures quota override routes
+func setupQuotaRoutes(mux *http.ServeMux, deps *Dependencies) {
+	if deps.QuotaHandler == nil {
+		return
+	}
+
+	sessionMW := deps.SessionStore.SessionMiddleware()
+	authMW := deps.SessionStore.AuthMiddleware(deps.Config)
+	manageQuotasMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionManageQuotas)
+	apiRateLimit := middleware.APIRateLimit() // General API rate limiting
+
+	// Quota management
+	quotasHandler := createQuotasHandler(deps.QuotaHandler)
+	mux.Handle("/api/admin/quotas", apiRateLimit(sessionMW(authMW(manageQuotasMW(quotasHandler)))))
+	mux.Handle("/api/admin/quotas/status", apiRateLimit(sessionMW(authMW(manageQuotasMW(createMethodHandler(http.MethodGet, deps.QuotaHandler.GetUserStatus))))))
+}
+
+// setupGroupRoutes configures group and group membership routes
+func setupGroupRoutes(mux *http.ServeMux, deps *Dependencies) {
+	sessionMW := deps.SessionStore.SessionMiddleware()
+	authMW := deps.SessionStore.AuthMiddleware(deps.Config)
+	manageGroupsMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionManageGroups)
+	apiRateLimit := middleware.APIRateLimit() // General API rate limiting
+
+	// Groups of the current user, and their members and queues
+	mux.Handle("/api/groups", apiRateLimit(sessionMW(authMW(createMethodHandler(http.MethodGet, deps.GroupHandler.ListMyGroups)))))
+	groupMembersHandler := createGroupMembersHandler(deps.GroupHandler)
+	mux.Handle("/api/groups/members", apiRateLimit(sessionMW(authMW(groupMembersHandler))))
+	mux.Handle("/api/groups/print-requests", apiRateLimit(sessionMW(authMW(createMethodHandler(http.MethodGet, deps.PrintRequestHandler.ListGroupPrintRequests)))))
+
+	// Group management
+	adminGroupsHandler := createAdminGroupsHandler(deps.GroupHandler)
+	mux.Handle("/api/admin/groups", apiRateLimit(sessionMW(authMW(manageGroupsMW(adminGroupsHandler)))))
+}
+
+// setupRoleRoutes configures role and permission management routes
+func setupRoleRoutes(mux *http.ServeMux, deps *Dependencies) {
+	sessionMW := deps.SessionStore.SessionMiddleware()
+	authMW := deps.SessionStore.AuthMiddleware(deps.Config)
+	manageRolesMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionManageRoles)
+	apiRateLimit := middleware.APIRateLimit() // General API rate limiting
+
+	adminRolesHandler := createAdminRolesHandler(deps.RoleHandler)
+	mux.Handle("/api/admin/roles", apiRateLimit(sessionMW(authMW(manageRolesMW(adminRolesHandler)))))
+	mux.Handle("/api/admin/roles/permissions", apiRateLimit(sessionMW(authMW(manageRolesMW(createMethodHandler(http.MethodGet, deps.RoleHandler.ListPermissions))))))
+}
+
+// setupPrinterRoutes configures printer routes
+func setupPrinterRoutes(mux *http.ServeMux, deps *Dependencies) {
+	sessionMW := deps.SessionStore.SessionMiddleware()
+	authMW := deps.SessionStore.AuthMiddleware(deps.Config)
+	managePrintersMW := middleware.RequirePermission(deps.SessionStore, deps.Config, models.PermissionManagePrinters)
+	apiRateLimit := middleware.APIRateLimit() // General API rate limiting
 
-	spoolHandler := createSpoolHandler(deps.SpoolmanHandler)
-	mux.Handle("/api/spoolman/spool", apiRateLimit(sessionMW(authMW(spoolHandler))))
+	// Printer list for assigning requests
+	printersHandler := createPrintersHandler(deps.PrinterHandler)
+	mux.Handle("/api/printers", apiRateLimit(sessionMW(authMW(printersHandler))))
 
-	materialsHandler := createMaterialsHandler(deps.SpoolmanHandler)
-	mux.Handle("/api/spoolman/materials", apiRateLimit(sessionMW(authMW(materialsHandler))))
+	// Printer management
+	adminPrintersHandler := createAdminPrintersHandler(deps.PrinterHandler)
+	mux.Handle("/api/admin/printers", apiRateLimit(sessionMW(authMW(managePrintersMW(adminPrintersHandler)))))
 }
 
 // Handler creation functions with proper method routing and error handling
@@ -182,11 +398,20 @@ func createUserRequestsHandler(handler *handlers.PrintRequestHandler) http.Handl
 	})
 }
 
-func createAdminUsersHandler(handler *handlers.AdminHandler) http.Handler {
+func createAdminUsersHandler(handler *handlers.AdminHandler, manageUsersMW func(http.Handler) http.Handler) http.Handler {
+	createUser := manageUsersMW(http.HandlerFunc(handler.CreateUser))
+	updateUser := manageUsersMW(http.HandlerFunc(handler.UpdateUser))
+	deleteUser := manageUsersMW(http.HandlerFunc(handler.DeleteUser))
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
 			handler.ListUsers(w, r)
+		case http.MethodPost:
+			createUser.ServeHTTP(w, r)
+		case http.MethodPut:
+			updateUser.ServeHTTP(w, r)
+		case http.MethodDelete:
+			deleteUser.ServeHTTP(w, r)
 		default:
 			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
 		}
@@ -215,6 +440,34 @@ func createAdminUserStatusHandler(handler *handlers.AdminHandler) http.Handler {
 	})
 }
 
+func createAdminUserLockoutHandler(handler *handlers.AdminHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.GetUserLockout(w, r)
+		case http.MethodDelete:
+			handler.UnlockUser(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createAdminInvitationsHandler(handler *handlers.InvitationHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.ListInvitations(w, r)
+		case http.MethodPost:
+			handler.CreateInvitation(w, r)
+		case http.MethodDelete:
+			handler.RevokeInvitation(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
 func createAdminStatsHandler(handler *handlers.AdminHandler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -246,7 +499,7 @@ func createAdminSpoolmanConfigHandler(handler *handlers.AdminHandler) http.Handl
 	})
 }
 
-func createSpoolsHandler(handler *api.SpoolmanHandler) http.Handler {
+func createSpoolsHandler(handler *api.InventoryHandler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			handler.GetSpools(w, r)
@@ -256,7 +509,7 @@ func createSpoolsHandler(handler *api.SpoolmanHandler) http.Handler {
 	})
 }
 
-func createSpoolHandler(handler *api.SpoolmanHandler) http.Handler {
+func createSpoolHandler(handler *api.InventoryHandler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			handler.GetSpool(w, r)
@@ -266,7 +519,7 @@ func createSpoolHandler(handler *api.SpoolmanHandler) http.Handler {
 	})
 }
 
-func createMaterialsHandler(handler *api.SpoolmanHandler) http.Handler {
+func createMaterialsHandler(handler *api.InventoryHandler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == http.MethodGet {
 			handler.GetMaterials(w, r)
@@ -274,4 +527,240 @@ func createMaterialsHandler(handler *api.SpoolmanHandler) http.Handler {
 			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
 		}
 	})
-}
\ No newline at end of file
+}
+
+func createVendorsHandler(handler *api.InventoryHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handler.GetVendors(w, r)
+		} else {
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createFilamentsHandler(handler *api.InventoryHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handler.GetFilaments(w, r)
+		} else {
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createLocationsHandler(handler *api.InventoryHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handler.GetLocations(w, r)
+		} else {
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createPrintersHandler(handler *handlers.PrinterHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handler.ListPrinters(w, r)
+		} else {
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createAdminPrintersHandler(handler *handlers.PrinterHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.ListPrinters(w, r)
+		case http.MethodPost:
+			handler.CreatePrinter(w, r)
+		case http.MethodPut:
+			handler.UpdatePrinter(w, r)
+		case http.MethodDelete:
+			handler.DeletePrinter(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createAdminMaterialsHandler(handler *handlers.LocalInventoryHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.ListMaterials(w, r)
+		case http.MethodPost:
+			handler.CreateMaterial(w, r)
+		case http.MethodPut:
+			handler.UpdateMaterial(w, r)
+		case http.MethodDelete:
+			handler.DeleteMaterial(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createAdminFilamentsHandler(handler *handlers.LocalInventoryHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.ListFilaments(w, r)
+		case http.MethodPost:
+			handler.CreateFilament(w, r)
+		case http.MethodPut:
+			handler.UpdateFilament(w, r)
+		case http.MethodDelete:
+			handler.DeleteFilament(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createAdminSpoolsHandler(handler *handlers.LocalInventoryHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.ListSpools(w, r)
+		case http.MethodPost:
+			handler.CreateSpool(w, r)
+		case http.MethodPut:
+			handler.UpdateSpool(w, r)
+		case http.MethodDelete:
+			handler.DeleteSpool(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createQuoteHandler(handler *handlers.PricingHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			handler.GetQuote(w, r)
+		} else {
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createQuotasHandler(handler *handlers.QuotaHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.ListOverrides(w, r)
+		case http.MethodPut:
+			handler.SetOverride(w, r)
+		case http.MethodDelete:
+			handler.DeleteOverride(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createGroupMembersHandler(handler *handlers.GroupHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.ListMembers(w, r)
+		case http.MethodPut:
+			handler.SetMember(w, r)
+		case http.MethodDelete:
+			handler.RemoveMember(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createAdminGroupsHandler(handler *handlers.GroupHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.ListGroups(w, r)
+		case http.MethodPost:
+			handler.CreateGroup(w, r)
+		case http.MethodPut:
+			handler.UpdateGroup(w, r)
+		case http.MethodDelete:
+			handler.DeleteGroup(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createAPITokensHandler(handler *handlers.TokenHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.ListTokens(w, r)
+		case http.MethodPost:
+			handler.CreateToken(w, r)
+		case http.MethodDelete:
+			handler.RevokeToken(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createSessionsHandler(handler *handlers.SessionHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.ListSessions(w, r)
+		case http.MethodDelete:
+			handler.RevokeSession(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createWebAuthnCredentialsHandler(handler *handlers.WebAuthnHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.ListCredentials(w, r)
+		case http.MethodPost:
+			handler.FinishRegistration(w, r)
+		case http.MethodDelete:
+			handler.DeleteCredential(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+func createAdminRolesHandler(handler *handlers.RoleHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			handler.ListRoles(w, r)
+		case http.MethodPost:
+			handler.CreateRole(w, r)
+		case http.MethodPut:
+			handler.UpdateRole(w, r)
+		case http.MethodDelete:
+			handler.DeleteRole(w, r)
+		default:
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
+
+// createMethodHandler creates a handler that only accepts a single method
+func createMethodHandler(method string, handler http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == method {
+			handler(w, r)
+		} else {
+			response.WriteErrorResponse(w, http.StatusMethodNotAllowed, response.BadRequest, "Method not allowed", "")
+		}
+	})
+}
@@ -0,0 +1,188 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+)
+
+// AnalyticsService reports on print request throughput, turnaround and
+// usage. Aggregation is done in the database, apart from percentiles.
+type AnalyticsService struct {
+	db     database.DBClient
+	quotas *QuotaService // Optional; set when quotas are enabled
+	now    func() time.Time
+}
+
+// NewAnalyticsService creates a new analytics service
+func NewAnalyticsService(db database.DBClient) *AnalyticsService {
+	return &AnalyticsService{db: db, now: time.Now}
+}
+
+// SetQuotas includes users' quota usage in their statistics
+func (s *AnalyticsService) SetQuotas(quotas *QuotaService) {
+	s.quotas = quotas
+}
+
+// Report summarizes print requests over the range, with throughput grouped
+// by bucket and the top requesters limited to top
+func (s *AnalyticsService) Report(ctx context.Context, r models.AnalyticsRange, bucket models.AnalyticsBucket, top int) (*models.AnalyticsReport, error) {
+	if !bucket.IsValid() {
+		return nil, fmt.Errorf("invalid analytics bucket %q", bucket)
+	}
+	if !r.From.Before(r.To) {
+		return nil, fmt.Errorf("analytics range must end after it starts")
+	}
+
+	counts, err := s.db.CountPrintRequestStatuses(ctx, r, bucket)
+	if err != nil {
+		return nil, err
+	}
+	turnarounds, err := s.db.ListTurnarounds(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	materials, err := s.db.SumMaterialUsage(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	printers, err := s.db.SumPrinterUsage(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	requesters, err := s.db.ListTopRequesters(ctx, r, top)
+	if err != nil {
+		return nil, err
+	}
+
+	rangeHours := r.To.Sub(r.From).Hours()
+	for _, printer := range printers {
+		printer.Utilization = printer.Hours / rangeHours
+	}
+
+	var approvals, completions []float64
+	for _, turnaround := range turnarounds {
+		if turnaround.ApprovalSeconds != nil {
+			approvals = append(approvals, *turnaround.ApprovalSeconds)
+		}
+		if turnaround.CompletionSeconds != nil {
+			completions = append(completions, *turnaround.CompletionSeconds)
+		}
+	}
+
+	return &models.AnalyticsReport{
+		From:          r.From,
+		To:            r.To,
+		Bucket:        bucket,
+		Throughput:    throughput(r, bucket, counts),
+		Approval:      turnaroundStats(approvals),
+		Completion:    turnaroundStats(completions),
+		Materials:     materials,
+		Printers:      printers,
+		TopRequesters: requesters,
+	}, nil
+}
+
+// throughput lays status counts out over every bucket in the range, so that
+// buckets without any changes are reported as zero
+func throughput(r models.AnalyticsRange, bucket models.AnalyticsBucket, counts []*models.StatusCount) []*models.ThroughputBucket {
+	buckets := []*models.ThroughputBucket{}
+	byStart := make(map[string]*models.ThroughputBucket)
+	for start := bucket.Start(r.From); start.Before(r.To); start = bucket.Next(start) {
+		b := &models.ThroughputBucket{Start: start.Format("2006-01-02"), Counts: make(map[string]int)}
+		for _, status := range models.PrintRequestStatusValues() {
+			b.Counts[status.String()] = 0
+		}
+		buckets = append(buckets, b)
+		byStart[b.Start] = b
+	}
+
+	for _, count := range counts {
+		if b, ok := byStart[count.Bucket]; ok {
+			b.Counts[count.Status.String()] += count.Count
+		}
+	}
+	return buckets
+}
+
+// turnaroundStats summarizes durations with the nearest-rank median and
+// 90th percentile
+func turnaroundStats(seconds []float64) models.TurnaroundStats {
+	stats := models.TurnaroundStats{Count: len(seconds)}
+	if len(seconds) == 0 {
+		return stats
+	}
+	sort.Float64s(seconds)
+	percentile := func(p float64) *float64 {
+		rank := int(math.Ceil(p * float64(len(seconds))))
+		value := seconds[max(rank, 1)-1]
+		return &value
+	}
+	stats.MedianSeconds = percentile(0.5)
+	stats.P90Seconds = percentile(0.9)
+	return stats
+}
+
+// UserStats reports a user's own print request statistics, with a history of
+// the given number of months ending with this one
+func (s *AnalyticsService) UserStats(ctx context.Context, user *models.User, months int) (*models.UserStats, error) {
+	totals, err := s.db.GetUserPrintTotals(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now().UTC()
+	thisMonth := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	since := thisMonth.AddDate(0, 1-months, 0)
+	history, err := s.db.ListUserMonthlyHistory(ctx, user.ID, since)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.UserStats{
+		Counts: map[string]int{
+			models.StatusPendingApproval.String(): totals.Pending,
+			models.StatusEnqueued.String():        totals.Enqueued,
+			models.StatusInProgress.String():      totals.InProgress,
+			models.StatusDone.String():            totals.Done,
+		},
+		Total:                    totals.Pending + totals.Enqueued + totals.InProgress + totals.Done,
+		Grams:                    totals.Grams,
+		Spend:                    totals.Spend,
+		AverageTurnaroundSeconds: totals.AverageTurnaroundSeconds,
+		History:                  monthlyHistory(since, months, history),
+	}
+
+	if s.quotas != nil {
+		if stats.Quota, err = s.quotas.Status(ctx, user); err != nil {
+			return nil, err
+		}
+	}
+
+	return stats, nil
+}
+
+// monthlyHistory lays monthly stats out over every month from since, so that
+// months without any requests are reported as zero
+func monthlyHistory(since time.Time, months int, stats []*models.UserMonthStats) []*models.UserMonthStats {
+	byMonth := make(map[string]*models.UserMonthStats, len(stats))
+	for _, month := range stats {
+		byMonth[month.Month] = month
+	}
+
+	history := make([]*models.UserMonthStats, 0, months)
+	for i := range months {
+		month := since.AddDate(0, i, 0).Format("2006-01")
+		if stat, ok := byMonth[month]; ok {
+			history = append(history, stat)
+		} else {
+			history = append(history, &models.UserMonthStats{Month: month})
+		}
+	}
+	return history
+}
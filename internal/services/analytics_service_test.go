@@ -0,0 +1,121 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnalyticsReport(t *testing.T) {
+	ctx := context.Background()
+	// Wednesday to the following Wednesday
+	r := models.AnalyticsRange{
+		From: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, time.May, 8, 0, 0, 0, 0, time.UTC),
+	}
+	seconds := func(s float64) *float64 { return &s }
+
+	mockDB := new(MockDBClient)
+	mockDB.On("CountPrintRequestStatuses", ctx, r, models.AnalyticsBucketWeek).Return([]*models.StatusCount{
+		{Bucket: "2024-04-29", Status: models.StatusPendingApproval, Count: 3},
+		{Bucket: "2024-05-06", Status: models.StatusDone, Count: 2},
+	}, nil)
+	mockDB.On("ListTurnarounds", ctx, r).Return([]*models.Turnaround{
+		{ApprovalSeconds: seconds(50), CompletionSeconds: seconds(1000)},
+		{ApprovalSeconds: seconds(10)},
+		{ApprovalSeconds: seconds(40)},
+		{ApprovalSeconds: seconds(30)},
+		{ApprovalSeconds: seconds(20)},
+	}, nil)
+	mockDB.On("SumMaterialUsage", ctx, r).Return([]*models.MaterialUsage{{Material: "PLA", Color: "red", Requests: 2, Grams: 80}}, nil)
+	mockDB.On("SumPrinterUsage", ctx, r).Return([]*models.PrinterUsage{{PrinterID: 1, Name: "Prusa", Requests: 2, Hours: 42}}, nil)
+	mockDB.On("ListTopRequesters", ctx, r, 5).Return([]*models.RequesterUsage{{UserID: "user", Username: "ana", Requests: 3}}, nil)
+
+	report, err := NewAnalyticsService(mockDB).Report(ctx, r, models.AnalyticsBucketWeek, 5)
+	require.NoError(t, err)
+	mockDB.AssertExpectations(t)
+
+	// Weeks that start before the range are still reported, with every status
+	require.Len(t, report.Throughput, 2)
+	assert.Equal(t, "2024-04-29", report.Throughput[0].Start)
+	assert.Equal(t, map[string]int{"StatusPendingApproval": 3, "StatusEnqueued": 0, "StatusInProgress": 0, "StatusDone": 0}, report.Throughput[0].Counts)
+	assert.Equal(t, "2024-05-06", report.Throughput[1].Start)
+	assert.Equal(t, 2, report.Throughput[1].Counts["StatusDone"])
+
+	assert.Equal(t, 5, report.Approval.Count)
+	assert.Equal(t, 30.0, *report.Approval.MedianSeconds)
+	assert.Equal(t, 50.0, *report.Approval.P90Seconds)
+	assert.Equal(t, 1, report.Completion.Count)
+	assert.Equal(t, 1000.0, *report.Completion.MedianSeconds)
+
+	// 42 hours printing in a week
+	assert.InDelta(t, 0.25, report.Printers[0].Utilization, 1e-9)
+	assert.Len(t, report.Materials, 1)
+	assert.Len(t, report.TopRequesters, 1)
+}
+
+func TestAnalyticsReportWithoutTurnarounds(t *testing.T) {
+	ctx := context.Background()
+	r := models.AnalyticsRange{
+		From: time.Date(2024, time.May, 1, 0, 0, 0, 0, time.UTC),
+		To:   time.Date(2024, time.May, 3, 0, 0, 0, 0, time.UTC),
+	}
+
+	mockDB := new(MockDBClient)
+	mockDB.On("CountPrintRequestStatuses", ctx, r, models.AnalyticsBucketDay).Return([]*models.StatusCount{}, nil)
+	mockDB.On("ListTurnarounds", ctx, r).Return([]*models.Turnaround{}, nil)
+	mockDB.On("SumMaterialUsage", ctx, r).Return([]*models.MaterialUsage{}, nil)
+	mockDB.On("SumPrinterUsage", ctx, r).Return([]*models.PrinterUsage{}, nil)
+	mockDB.On("ListTopRequesters", ctx, r, 10).Return([]*models.RequesterUsage{}, nil)
+
+	report, err := NewAnalyticsService(mockDB).Report(ctx, r, models.AnalyticsBucketDay, 10)
+	require.NoError(t, err)
+	assert.Len(t, report.Throughput, 2)
+	assert.Equal(t, 0, report.Approval.Count)
+	assert.Nil(t, report.Approval.MedianSeconds)
+	assert.Nil(t, report.Completion.P90Seconds)
+
+	_, err = NewAnalyticsService(mockDB).Report(ctx, models.AnalyticsRange{From: r.To, To: r.From}, models.AnalyticsBucketDay, 10)
+	assert.Error(t, err)
+	_, err = NewAnalyticsService(mockDB).Report(ctx, r, "month", 10)
+	assert.Error(t, err)
+}
+
+func TestUserStats(t *testing.T) {
+	ctx := context.Background()
+	user := &models.User{ID: "user"}
+	turnaround := 3600.0
+
+	mockDB := new(MockDBClient)
+	mockDB.On("GetUserPrintTotals", ctx, "user").Return(&models.UserPrintTotals{
+		Pending: 1, InProgress: 2, Done: 3, Grams: 120, Spend: 4.5, AverageTurnaroundSeconds: &turnaround,
+	}, nil)
+	since := time.Date(2024, time.November, 1, 0, 0, 0, 0, time.UTC)
+	mockDB.On("ListUserMonthlyHistory", ctx, "user", since).Return([]*models.UserMonthStats{
+		{Month: "2024-12", Submitted: 2, Completed: 1, Grams: 40, Spend: 1.5},
+	}, nil)
+
+	analytics := NewAnalyticsService(mockDB)
+	analytics.now = func() time.Time { return time.Date(2025, time.January, 15, 9, 0, 0, 0, time.UTC) }
+	stats, err := analytics.UserStats(ctx, user, 3)
+	require.NoError(t, err)
+	mockDB.AssertExpectations(t)
+
+	assert.Equal(t, map[string]int{"StatusPendingApproval": 1, "StatusEnqueued": 0, "StatusInProgress": 2, "StatusDone": 3}, stats.Counts)
+	assert.Equal(t, 6, stats.Total)
+	assert.Equal(t, 120.0, stats.Grams)
+	assert.Equal(t, 4.5, stats.Spend)
+	assert.Equal(t, &turnaround, stats.AverageTurnaroundSeconds)
+	assert.Nil(t, stats.Quota)
+
+	// Months without requests are filled in, up to this one
+	assert.Equal(t, []*models.UserMonthStats{
+		{Month: "2024-11"},
+		{Month: "2024-12", Submitted: 2, Completed: 1, Grams: 40, Spend: 1.5},
+		{Month: "2025-01"},
+	}, stats.History)
+}
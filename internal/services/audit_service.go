@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/google/uuid"
+)
+
+// maxAuditUserAgentLength limits the user agent stored with an audit event
+const maxAuditUserAgentLength = 512
+
+// AuditService keeps the audit log of administrative and security events
+type AuditService struct {
+	db     database.DBClient
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+// NewAuditService creates a new audit service
+func NewAuditService(db database.DBClient) *AuditService {
+	return &AuditService{
+		db:     db,
+		now:    time.Now,
+		logger: slog.Default(),
+	}
+}
+
+// Record adds an event to the audit log. Failures are logged rather than
+// returned, since what was done cannot be undone by then.
+func (s *AuditService) Record(ctx context.Context, event *models.AuditEvent) {
+	event.ID = uuid.New().String()
+	event.CreatedAt = s.now()
+	if len(event.UserAgent) > maxAuditUserAgentLength {
+		event.UserAgent = event.UserAgent[:maxAuditUserAgentLength]
+	}
+
+	if err := s.db.CreateAuditEvent(context.WithoutCancel(ctx), event); err != nil {
+		s.logger.Error("failed to record audit event", "error", err, "action", event.Action,
+			"actor_id", event.ActorID, "target_type", event.TargetType, "target_id", event.TargetID)
+	}
+}
+
+// ListEvents lists the audit events matching the filter, newest first, and
+// returns how many match in total
+func (s *AuditService) ListEvents(ctx context.Context, filter models.AuditEventFilter) ([]*models.AuditEvent, int, error) {
+	return s.db.ListAuditEvents(ctx, filter)
+}
+
+// WriteAuditEventsCSV writes audit events as CSV, with their changes as JSON
+func WriteAuditEventsCSV(w io.Writer, events []*models.AuditEvent) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"created_at", "actor_id", "actor_name", "action", "target_type", "target_id", "changes", "ip_address", "user_agent"}); err != nil {
+		return err
+	}
+	for _, event := range events {
+		actorID := ""
+		if event.ActorID != nil {
+			actorID = *event.ActorID
+		}
+		changes := ""
+		if len(event.Changes) > 0 {
+			data, err := json.Marshal(event.Changes)
+			if err != nil {
+				return err
+			}
+			changes = string(data)
+		}
+		if err := writer.Write([]string{
+			event.CreatedAt.UTC().Format(time.RFC3339),
+			actorID,
+			event.ActorName,
+			string(event.Action),
+			event.TargetType,
+			event.TargetID,
+			changes,
+			event.IPAddress,
+			event.UserAgent,
+		}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/mailer"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/google/uuid"
+)
+
+// How long links sent by email work for
+const (
+	passwordResetTTL     = time.Hour
+	emailVerificationTTL = 48 * time.Hour
+)
+
+var (
+	// ErrInvalidEmailToken is returned for links that are unknown, used,
+	// expired, or sent to an address the user no longer has
+	ErrInvalidEmailToken = errors.New("link is invalid or has expired")
+	// ErrEmailNotVerified is returned when logging in before verifying the
+	// account's email address
+	ErrEmailNotVerified = errors.New("email address is not verified")
+	// ErrNoPublicURL is returned when there is no URL to link to in an email
+	ErrNoPublicURL = errors.New("public URL is not known, set server.base_url")
+)
+
+// publicURLKey is the context key for the server's public URL
+type publicURLKey struct{}
+
+// WithPublicURL returns a context carrying the server's public URL, which
+// links in emails sent while handling a request point at
+func WithPublicURL(ctx context.Context, publicURL string) context.Context {
+	return context.WithValue(ctx, publicURLKey{}, publicURL)
+}
+
+// publicURLFrom returns the public URL carried by the context, if any
+func publicURLFrom(ctx context.Context) string {
+	publicURL, _ := ctx.Value(publicURLKey{}).(string)
+	return publicURL
+}
+
+// EmailService emails users links to reset their password and verify their
+// email address
+type EmailService struct {
+	db     database.DBClient
+	mailer mailer.Mailer
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+// NewEmailService creates a new email service
+func NewEmailService(db database.DBClient, m mailer.Mailer) *EmailService {
+	return &EmailService{
+		db:     db,
+		mailer: m,
+		now:    time.Now,
+		logger: slog.Default(),
+	}
+}
+
+// RequestPasswordReset emails a password reset link to the account with the
+// address. Nothing is sent for unknown addresses, or disabled accounts or
+// accounts without a password, and the email is sent in the background, so
+// that callers cannot tell whether an address has an account.
+func (s *EmailService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.Enabled || !user.HasPassword() {
+		s.logger.Info("not sending password reset", "reason", "no enabled local account with this email")
+		return nil
+	}
+
+	link, err := s.newTokenLink(ctx, user, models.EmailTokenPasswordReset, passwordResetTTL, "reset_token")
+	if err != nil {
+		return err
+	}
+	s.sendInBackground(ctx, user.ID, mailer.Message{
+		To:      *user.Email,
+		Subject: "Reset your print-dis password",
+		Body: fmt.Sprintf(`Hi %s,
+
+Someone asked to reset the password of your print-dis account, %s. To choose a new password, open this link within an hour:
+
+%s
+
+If it wasn't you, you can ignore this email and your password will stay the same.
+`, userDisplayName(user), user.Username, link),
+	})
+	return nil
+}
+
+// ResetPassword sets a new password with the token from a password reset
+// link, and logs the user out everywhere. Receiving the link also verifies
+// the user's email address.
+func (s *EmailService) ResetPassword(ctx context.Context, token, password string) (*models.User, error) {
+	user, err := s.useToken(ctx, models.EmailTokenPasswordReset, token)
+	if err != nil {
+		return nil, err
+	}
+	if !user.Enabled {
+		return nil, ErrInvalidEmailToken
+	}
+
+	if err := user.SetPassword(password); err != nil {
+		return nil, fmt.Errorf("failed to set new password: %w", err)
+	}
+	user.MustChangePassword = false
+	now := s.now()
+	if user.EmailVerifiedAt == nil {
+		user.EmailVerifiedAt = &now
+	}
+	user.UpdatedAt = now
+	if err := s.db.UpdateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	// Other reset links stop working, and anyone who knew the old password
+	// is logged out and loses their API tokens
+	if err := s.db.DeleteEmailTokensByUserID(ctx, user.ID, models.EmailTokenPasswordReset); err != nil {
+		return nil, err
+	}
+	if err := s.db.DeleteUserSessionsByUserID(ctx, user.ID, ""); err != nil {
+		return nil, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	if err := s.db.DeleteAPITokensByUserID(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("failed to revoke API tokens: %w", err)
+	}
+	// Proving they have the address unlocks the account, if it was locked
+	// after failed logins
+	if err := s.db.DeleteLoginAttempts(ctx, lockoutKey(user.Username)); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("reset password", "user_id", user.ID)
+	return user, nil
+}
+
+// SendVerification emails the user a link to verify their email address
+func (s *EmailService) SendVerification(ctx context.Context, user *models.User) error {
+	msg, err := s.verificationMessage(ctx, user)
+	if err != nil {
+		return err
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send verification email: %w", err)
+	}
+	s.logger.Info("sent verification email", "user_id", user.ID)
+	return nil
+}
+
+// ResendVerification emails a new verification link to the account with the
+// address, if it has not been verified. Like RequestPasswordReset, it does
+// not reveal whether the address has an account.
+func (s *EmailService) ResendVerification(ctx context.Context, email string) error {
+	user, err := s.db.GetUserByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil || !user.Enabled || user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	msg, err := s.verificationMessage(ctx, user)
+	if err != nil {
+		return err
+	}
+	s.sendInBackground(ctx, user.ID, msg)
+	return nil
+}
+
+// verificationMessage creates a verification link for the user and returns
+// the email to send it in
+func (s *EmailService) verificationMessage(ctx context.Context, user *models.User) (mailer.Message, error) {
+	if user.Email == nil || *user.Email == "" {
+		return mailer.Message{}, fmt.Errorf("user %s has no email address", user.ID)
+	}
+	link, err := s.newTokenLink(ctx, user, models.EmailTokenVerifyEmail, emailVerificationTTL, "verify_token")
+	if err != nil {
+		return mailer.Message{}, err
+	}
+
+	return mailer.Message{
+		To:      *user.Email,
+		Subject: "Verify your email address for print-dis",
+		Body: fmt.Sprintf(`Hi %s,
+
+To finish setting up your print-dis account, %s, verify your email address by opening this link within two days:
+
+%s
+
+If you didn't create an account, you can ignore this email.
+`, userDisplayName(user), user.Username, link),
+	}, nil
+}
+
+// VerifyEmail marks the address a verification link was sent to as verified
+func (s *EmailService) VerifyEmail(ctx context.Context, token string) (*models.User, error) {
+	user, err := s.useToken(ctx, models.EmailTokenVerifyEmail, token)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.EmailVerifiedAt == nil {
+		now := s.now()
+		user.EmailVerifiedAt = &now
+		user.UpdatedAt = now
+		if err := s.db.UpdateUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to update user: %w", err)
+		}
+	}
+	if err := s.db.DeleteEmailTokensByUserID(ctx, user.ID, models.EmailTokenVerifyEmail); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("verified email address", "user_id", user.ID)
+	return user, nil
+}
+
+// SendLockoutNotice tells the user that their account was locked after
+// failed logins
+func (s *EmailService) SendLockoutNotice(ctx context.Context, user *models.User, failures int, until time.Time) error {
+	err := s.mailer.Send(ctx, mailer.Message{
+		To:      *user.Email,
+		Subject: "Your print-dis account has been locked",
+		Body: fmt.Sprintf(`Hi %s,
+
+There were %d failed attempts in a row to log in to your print-dis account, %s, so logging in with its password is blocked until %s.
+
+If this wasn't you, someone may be trying to guess your password. You can choose a new one with "Forgot your password?" on the login page, which also unlocks your account, or ask an administrator to unlock it.
+`, userDisplayName(user), failures, user.Username, until.UTC().Format("15:04 UTC on 2 January 2006")),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send lockout email: %w", err)
+	}
+	s.logger.Info("sent lockout email", "user_id", user.ID)
+	return nil
+}
+
+// SendInvitation emails someone a link to register with an invitation code,
+// which fills in the code, their address and the username chosen for them
+func (s *EmailService) SendInvitation(ctx context.Context, record UserRecord, code string, expiresAt time.Time) error {
+	publicURL := publicURLFrom(ctx)
+	if publicURL == "" {
+		return ErrNoPublicURL
+	}
+	params := url.Values{"invitation_code": {code}, "email": {record.Email}}
+	if record.Username != "" {
+		params.Set("username", record.Username)
+	}
+	name := record.DisplayName
+	if name == "" {
+		name = record.Username
+	}
+
+	err := s.mailer.Send(ctx, mailer.Message{
+		To:      record.Email,
+		Subject: "You're invited to print-dis",
+		Body: fmt.Sprintf(`Hi %s,
+
+You've been given an account on print-dis, where you can ask for things to be 3D printed. To set it up, open this link and choose a password before %s:
+
+%s
+
+The link only works for this email address, and only once.
+`, name, expiresAt.UTC().Format("2 January 2006"), publicURL+"/auth.html?"+params.Encode()),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send invitation email: %w", err)
+	}
+	s.logger.Info("sent invitation email", "username", record.Username)
+	return nil
+}
+
+// newTokenLink creates a token for the user, replacing any they have for the
+// same purpose, and returns a link to the login page with the token in the
+// query parameter
+func (s *EmailService) newTokenLink(ctx context.Context, user *models.User, purpose models.EmailTokenPurpose, ttl time.Duration, param string) (string, error) {
+	publicURL := publicURLFrom(ctx)
+	if publicURL == "" {
+		return "", ErrNoPublicURL
+	}
+
+	if err := s.db.DeleteEmailTokensByUserID(ctx, user.ID, purpose); err != nil {
+		return "", err
+	}
+	secret := rand.Text()
+	now := s.now()
+	token := &models.EmailToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: hashToken(secret),
+		Email:     *user.Email,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	}
+	if err := s.db.CreateEmailToken(ctx, token); err != nil {
+		return "", err
+	}
+
+	return publicURL + "/auth.html?" + url.Values{param: {secret}}.Encode(), nil
+}
+
+// useToken uses up a token and returns the user it was sent to, as long as
+// they still have the address it was sent to
+func (s *EmailService) useToken(ctx context.Context, purpose models.EmailTokenPurpose, secret string) (*models.User, error) {
+	token, err := s.db.UseEmailToken(ctx, purpose, hashToken(secret), s.now())
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrInvalidEmailToken
+	}
+
+	user, err := s.db.GetUser(ctx, token.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil || user.Email == nil || *user.Email != token.Email {
+		return nil, ErrInvalidEmailToken
+	}
+	return user, nil
+}
+
+// sendInBackground sends a message without making the caller wait, so that
+// how long a request takes does not reveal whether an email was sent
+func (s *EmailService) sendInBackground(ctx context.Context, userID string, msg mailer.Message) {
+	go func() {
+		if err := s.mailer.Send(context.WithoutCancel(ctx), msg); err != nil {
+			s.logger.Error("failed to send email", "error", err, "user_id", userID, "subject", msg.Subject)
+			return
+		}
+		s.logger.Info("sent email", "user_id", userID, "subject", msg.Subject)
+	}()
+}
+
+// userDisplayName returns the name to greet the user by
+func userDisplayName(user *models.User) string {
+	if user.DisplayName != nil && *user.DisplayName != "" {
+		return *user.DisplayName
+	}
+	return user.Username
+}
@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/mailer"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestPasswordResetIgnoresAccountsWithoutPasswords(t *testing.T) {
+	ctx := WithPublicURL(context.Background(), "https://print.example.com")
+	mockDB := new(MockDBClient)
+	service := NewEmailService(mockDB, mailer.NewLogMailer("print@example.com"))
+
+	disabled := newTestUser(t, "disabled@example.com")
+	disabled.Enabled = false
+	oidcOnly := newTestUser(t, "oidc@example.com")
+	oidcOnly.PasswordHash = nil
+	mockDB.On("GetUserByEmail", ctx, "nobody@example.com").Return(nil, nil)
+	mockDB.On("GetUserByEmail", ctx, "disabled@example.com").Return(disabled, nil)
+	mockDB.On("GetUserByEmail", ctx, "oidc@example.com").Return(oidcOnly, nil)
+
+	for _, email := range []string{"nobody@example.com", "disabled@example.com", "oidc@example.com"} {
+		assert.NoError(t, service.RequestPasswordReset(ctx, email), email)
+	}
+	mockDB.AssertNotCalled(t, "CreateEmailToken", mock.Anything, mock.Anything)
+}
+
+func TestRequestPasswordResetNeedsPublicURL(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	service := NewEmailService(mockDB, mailer.NewLogMailer("print@example.com"))
+
+	mockDB.On("GetUserByEmail", ctx, "alice@example.com").Return(newTestUser(t, "alice@example.com"), nil)
+	assert.ErrorIs(t, service.RequestPasswordReset(ctx, "alice@example.com"), ErrNoPublicURL)
+	mockDB.AssertNotCalled(t, "CreateEmailToken", mock.Anything, mock.Anything)
+}
+
+func TestResetPasswordRefusesChangedEmail(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	service := NewEmailService(mockDB, mailer.NewLogMailer("print@example.com"))
+	now := time.Now()
+	service.now = func() time.Time { return now }
+
+	// The link was sent before the user changed their address
+	user := newTestUser(t, "new@example.com")
+	mockDB.On("UseEmailToken", ctx, models.EmailTokenPasswordReset, hashToken("secret"), now).Return(&models.EmailToken{
+		UserID: user.ID,
+		Email:  "old@example.com",
+	}, nil)
+	mockDB.On("GetUser", ctx, user.ID).Return(user, nil)
+
+	_, err := service.ResetPassword(ctx, "secret", "new-password")
+	assert.ErrorIs(t, err, ErrInvalidEmailToken)
+	mockDB.AssertNotCalled(t, "UpdateUser", mock.Anything, mock.Anything)
+}
+
+func TestEmailVerificationRequired(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	service := NewUserService(mockDB)
+	service.SetEmailVerification(NewEmailService(mockDB, mailer.NewLogMailer("print@example.com")))
+
+	// Users must give an address to verify
+	_, err := service.RegisterUser(ctx, "alice", "", "password123")
+	assert.EqualError(t, err, "email is required")
+	mockDB.AssertNotCalled(t, "BeginTx", mock.Anything)
+
+	unverified := newTestUser(t, "alice@example.com")
+	mockDB.On("GetUserByUsername", ctx, "alice").Return(unverified, nil)
+	_, err = service.AuthenticateUser(ctx, "alice", "password123")
+	assert.ErrorIs(t, err, ErrEmailNotVerified)
+
+	// Accounts without an address, e.g. created by an admin, can log in
+	noEmail := newTestUser(t, "")
+	noEmail.Email = nil
+	mockDB.On("GetUserByUsername", ctx, "bob").Return(noEmail, nil)
+	user, err := service.AuthenticateUser(ctx, "bob", "password123")
+	require.NoError(t, err)
+	assert.Equal(t, noEmail.ID, user.ID)
+}
+
+// newTestUser returns an enabled user with the address and the password
+// "password123"
+func newTestUser(t *testing.T, email string) *models.User {
+	t.Helper()
+	user := models.NewUser("user-"+email, &email)
+	user.ID = "id-" + email
+	require.NoError(t, user.SetPassword("password123"))
+	return user
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/google/uuid"
+)
+
+// GroupService handles business logic for groups and their memberships
+type GroupService struct {
+	db     database.DBClient
+	logger *slog.Logger
+}
+
+// NewGroupService creates a new group service
+func NewGroupService(db database.DBClient) *GroupService {
+	return &GroupService{
+		db:     db,
+		logger: slog.Default(),
+	}
+}
+
+// CreateGroup creates a new group
+func (s *GroupService) CreateGroup(ctx context.Context, group *models.Group) error {
+	group.ID = uuid.New().String()
+	if err := s.db.CreateGroup(ctx, group); err != nil {
+		s.logger.Error("failed to create group", "error", err, "name", group.Name)
+		return err
+	}
+	s.logger.Info("created group", "id", group.ID, "name", group.Name)
+	return nil
+}
+
+// GetGroup retrieves a group by ID, returning nil if it does not exist
+func (s *GroupService) GetGroup(ctx context.Context, id string) (*models.Group, error) {
+	return s.db.GetGroup(ctx, id)
+}
+
+// UpdateGroup updates a group's name and description
+func (s *GroupService) UpdateGroup(ctx context.Context, group *models.Group) error {
+	if err := s.db.UpdateGroup(ctx, group); err != nil {
+		s.logger.Error("failed to update group", "error", err, "id", group.ID)
+		return err
+	}
+	return nil
+}
+
+// DeleteGroup deletes a group. Its print requests are kept without a group.
+func (s *GroupService) DeleteGroup(ctx context.Context, id string) error {
+	if err := s.db.DeleteGroup(ctx, id); err != nil {
+		s.logger.Error("failed to delete group", "error", err, "id", id)
+		return err
+	}
+	s.logger.Info("deleted group", "id", id)
+	return nil
+}
+
+// ListGroups retrieves all groups
+func (s *GroupService) ListGroups(ctx context.Context) ([]*models.Group, error) {
+	return s.db.ListGroups(ctx)
+}
+
+// ListMembers retrieves the members of a group
+func (s *GroupService) ListMembers(ctx context.Context, groupID string) ([]*models.GroupMembership, error) {
+	return s.db.ListGroupMembers(ctx, groupID)
+}
+
+// SetMember adds a user to a group with the given role, or changes their role
+// if they are already a member
+func (s *GroupService) SetMember(ctx context.Context, groupID, userID string, role models.GroupRole) error {
+	user, err := s.db.GetUser(ctx, userID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return fmt.Errorf("user not found: %s", userID)
+	}
+
+	membership := &models.GroupMembership{GroupID: groupID, UserID: userID, Role: role}
+	if err := s.db.SetGroupMembership(ctx, membership); err != nil {
+		s.logger.Error("failed to set group membership", "error", err, "group_id", groupID, "user_id", userID)
+		return err
+	}
+	s.logger.Info("set group membership", "group_id", groupID, "user_id", userID, "role", role)
+	return nil
+}
+
+// RemoveMember removes a user from a group
+func (s *GroupService) RemoveMember(ctx context.Context, groupID, userID string) error {
+	if err := s.db.DeleteGroupMembership(ctx, groupID, userID); err != nil {
+		s.logger.Error("failed to remove group member", "error", err, "group_id", groupID, "user_id", userID)
+		return err
+	}
+	s.logger.Info("removed group member", "group_id", groupID, "user_id", userID)
+	return nil
+}
+
+// LoadMemberships loads the groups a user belongs to into user.Memberships
+func (s *GroupService) LoadMemberships(ctx context.Context, user *models.User) error {
+	memberships, err := s.db.ListGroupMembershipsByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	user.Memberships = make([]models.GroupMembership, len(memberships))
+	for i, membership := range memberships {
+		user.Memberships[i] = *membership
+	}
+	return nil
+}
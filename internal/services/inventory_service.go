@@ -0,0 +1,413 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/spoolman"
+)
+
+// InventoryProvider is a source of spools, filaments and materials. It is
+// implemented by spoolman.Service and by LocalInventoryService, so handlers
+// work the same whichever backend is configured.
+type InventoryProvider interface {
+	GetSpool(ctx context.Context, id int) (*spoolman.Spool, error)
+	GetSpools(ctx context.Context) ([]spoolman.Spool, error)
+	GetFilament(ctx context.Context, id int) (*spoolman.Filament, error)
+	GetFilaments(ctx context.Context) ([]spoolman.Filament, error)
+	GetMaterials(ctx context.Context) ([]string, error)
+	GetVendors(ctx context.Context) ([]spoolman.Vendor, error)
+	GetLocations(ctx context.Context) ([]string, error)
+}
+
+var _ InventoryProvider = (*spoolman.Service)(nil)
+var _ InventoryProvider = (*LocalInventoryService)(nil)
+
+// LocalInventoryService is the built-in inventory used when Spoolman is disabled
+type LocalInventoryService struct {
+	db     database.DBClient
+	logger *slog.Logger
+
+	onSpoolUnavailable func(ctx context.Context, spoolID int)
+}
+
+// NewLocalInventoryService creates a new local inventory service
+func NewLocalInventoryService(db database.DBClient) *LocalInventoryService {
+	return &LocalInventoryService{
+		db:     db,
+		logger: slog.Default(),
+	}
+}
+
+// OnSpoolUnavailable registers a callback for spools that were archived, emptied or deleted
+func (s *LocalInventoryService) OnSpoolUnavailable(fn func(ctx context.Context, spoolID int)) {
+	s.onSpoolUnavailable = fn
+}
+
+// GetSpool retrieves a spool by ID
+func (s *LocalInventoryService) GetSpool(ctx context.Context, id int) (*spoolman.Spool, error) {
+	spool, err := s.db.GetSpool(ctx, id)
+	if err != nil {
+		s.logger.Error("failed to get spool", "error", err, "id", id)
+		return nil, err
+	}
+	if spool == nil {
+		return nil, fmt.Errorf("spool not found: %d", id)
+	}
+
+	converted := toSpoolmanSpool(spool)
+	return &converted, nil
+}
+
+// GetSpools retrieves all spools that have not been archived
+func (s *LocalInventoryService) GetSpools(ctx context.Context) ([]spoolman.Spool, error) {
+	spools, err := s.db.ListSpools(ctx)
+	if err != nil {
+		s.logger.Error("failed to list spools", "error", err)
+		return nil, err
+	}
+
+	result := make([]spoolman.Spool, 0, len(spools))
+	for _, spool := range spools {
+		if spool.Archived {
+			continue
+		}
+		result = append(result, toSpoolmanSpool(spool))
+	}
+	return result, nil
+}
+
+// GetFilament retrieves a filament by ID
+func (s *LocalInventoryService) GetFilament(ctx context.Context, id int) (*spoolman.Filament, error) {
+	filament, err := s.db.GetFilament(ctx, id)
+	if err != nil {
+		s.logger.Error("failed to get filament", "error", err, "id", id)
+		return nil, err
+	}
+	if filament == nil {
+		return nil, fmt.Errorf("filament not found: %d", id)
+	}
+
+	converted := toSpoolmanFilament(filament)
+	return &converted, nil
+}
+
+// GetFilaments retrieves the filament catalogue
+func (s *LocalInventoryService) GetFilaments(ctx context.Context) ([]spoolman.Filament, error) {
+	filaments, err := s.db.ListFilaments(ctx)
+	if err != nil {
+		s.logger.Error("failed to list filaments", "error", err)
+		return nil, err
+	}
+
+	result := make([]spoolman.Filament, 0, len(filaments))
+	for _, filament := range filaments {
+		result = append(result, toSpoolmanFilament(filament))
+	}
+	return result, nil
+}
+
+// GetMaterials retrieves the names of all materials
+func (s *LocalInventoryService) GetMaterials(ctx context.Context) ([]string, error) {
+	materials, err := s.db.ListMaterials(ctx)
+	if err != nil {
+		s.logger.Error("failed to list materials", "error", err)
+		return nil, err
+	}
+
+	result := make([]string, 0, len(materials))
+	for _, material := range materials {
+		result = append(result, material.Name)
+	}
+	return result, nil
+}
+
+// GetVendors retrieves the distinct vendors of all filaments. Vendors are
+// not stored separately, so their IDs are only stable while the set of
+// vendors does not change.
+func (s *LocalInventoryService) GetVendors(ctx context.Context) ([]spoolman.Vendor, error) {
+	filaments, err := s.db.ListFilaments(ctx)
+	if err != nil {
+		s.logger.Error("failed to list filaments", "error", err)
+		return nil, err
+	}
+
+	names := make([]string, 0)
+	for _, filament := range filaments {
+		names = append(names, filament.Vendor)
+	}
+
+	vendors := make([]spoolman.Vendor, 0)
+	for i, name := range distinctSorted(names) {
+		vendors = append(vendors, spoolman.Vendor{Id: i + 1, Name: name})
+	}
+	return vendors, nil
+}
+
+// GetLocations retrieves the distinct locations of all spools
+func (s *LocalInventoryService) GetLocations(ctx context.Context) ([]string, error) {
+	spools, err := s.db.ListSpools(ctx)
+	if err != nil {
+		s.logger.Error("failed to list spools", "error", err)
+		return nil, err
+	}
+
+	locations := make([]string, 0, len(spools))
+	for _, spool := range spools {
+		locations = append(locations, spool.Location)
+	}
+	return distinctSorted(locations), nil
+}
+
+// ListMaterials retrieves all material records for administration
+func (s *LocalInventoryService) ListMaterials(ctx context.Context) ([]*models.Material, error) {
+	return s.db.ListMaterials(ctx)
+}
+
+// CreateMaterial adds a material
+func (s *LocalInventoryService) CreateMaterial(ctx context.Context, material *models.Material) error {
+	if err := s.db.CreateMaterial(ctx, material); err != nil {
+		s.logger.Error("failed to create material", "error", err, "name", material.Name)
+		return err
+	}
+	s.logger.Info("created material", "id", material.Id, "name", material.Name)
+	return nil
+}
+
+// UpdateMaterial updates an existing material
+func (s *LocalInventoryService) UpdateMaterial(ctx context.Context, material *models.Material) error {
+	existing, err := s.db.GetMaterial(ctx, material.Id)
+	if err != nil {
+		return fmt.Errorf("failed to get material: %w", err)
+	}
+	if existing == nil {
+		return fmt.Errorf("material not found: %d", material.Id)
+	}
+
+	if err := s.db.UpdateMaterial(ctx, material); err != nil {
+		s.logger.Error("failed to update material", "error", err, "id", material.Id)
+		return err
+	}
+	s.logger.Info("updated material", "id", material.Id, "name", material.Name)
+	return nil
+}
+
+// DeleteMaterial removes a material
+func (s *LocalInventoryService) DeleteMaterial(ctx context.Context, id int) error {
+	if err := s.db.DeleteMaterial(ctx, id); err != nil {
+		s.logger.Error("failed to delete material", "error", err, "id", id)
+		return err
+	}
+	s.logger.Info("deleted material", "id", id)
+	return nil
+}
+
+// ListFilamentRecords retrieves all filament records for administration
+func (s *LocalInventoryService) ListFilamentRecords(ctx context.Context) ([]*models.Filament, error) {
+	return s.db.ListFilaments(ctx)
+}
+
+// CreateFilament adds a filament of an existing material
+func (s *LocalInventoryService) CreateFilament(ctx context.Context, filament *models.Filament) error {
+	if err := s.resolveMaterial(ctx, filament); err != nil {
+		return err
+	}
+	if err := s.db.CreateFilament(ctx, filament); err != nil {
+		s.logger.Error("failed to create filament", "error", err, "name", filament.Name)
+		return err
+	}
+	s.logger.Info("created filament", "id", filament.Id, "name", filament.Name)
+	return nil
+}
+
+// UpdateFilament updates an existing filament
+func (s *LocalInventoryService) UpdateFilament(ctx context.Context, filament *models.Filament) error {
+	existing, err := s.db.GetFilament(ctx, filament.Id)
+	if err != nil {
+		return fmt.Errorf("failed to get filament: %w", err)
+	}
+	if existing == nil {
+		return fmt.Errorf("filament not found: %d", filament.Id)
+	}
+	if err := s.resolveMaterial(ctx, filament); err != nil {
+		return err
+	}
+
+	if err := s.db.UpdateFilament(ctx, filament); err != nil {
+		s.logger.Error("failed to update filament", "error", err, "id", filament.Id)
+		return err
+	}
+	s.logger.Info("updated filament", "id", filament.Id, "name", filament.Name)
+	return nil
+}
+
+// DeleteFilament removes a filament
+func (s *LocalInventoryService) DeleteFilament(ctx context.Context, id int) error {
+	if err := s.db.DeleteFilament(ctx, id); err != nil {
+		s.logger.Error("failed to delete filament", "error", err, "id", id)
+		return err
+	}
+	s.logger.Info("deleted filament", "id", id)
+	return nil
+}
+
+// ListSpoolRecords retrieves all spool records, including archived ones, for administration
+func (s *LocalInventoryService) ListSpoolRecords(ctx context.Context) ([]*models.Spool, error) {
+	return s.db.ListSpools(ctx)
+}
+
+// CreateSpool adds a spool of an existing filament. A spool without an
+// initial weight is assumed to be a full spool.
+func (s *LocalInventoryService) CreateSpool(ctx context.Context, spool *models.Spool) error {
+	if err := s.resolveFilament(ctx, spool); err != nil {
+		return err
+	}
+	if spool.InitialWeight == 0 {
+		spool.InitialWeight = spool.Filament.Weight
+	}
+	if spool.RemainingWeight == 0 {
+		spool.RemainingWeight = spool.InitialWeight
+	}
+	spool.CreatedAt = time.Now()
+
+	if err := s.db.CreateSpool(ctx, spool); err != nil {
+		s.logger.Error("failed to create spool", "error", err, "filament_id", spool.Filament.Id)
+		return err
+	}
+	s.logger.Info("created spool", "id", spool.Id, "filament_id", spool.Filament.Id)
+	return nil
+}
+
+// UpdateSpool updates an existing spool
+func (s *LocalInventoryService) UpdateSpool(ctx context.Context, spool *models.Spool) error {
+	existing, err := s.db.GetSpool(ctx, spool.Id)
+	if err != nil {
+		return fmt.Errorf("failed to get spool: %w", err)
+	}
+	if existing == nil {
+		return fmt.Errorf("spool not found: %d", spool.Id)
+	}
+	if err := s.resolveFilament(ctx, spool); err != nil {
+		return err
+	}
+	spool.CreatedAt = existing.CreatedAt
+
+	if err := s.db.UpdateSpool(ctx, spool); err != nil {
+		s.logger.Error("failed to update spool", "error", err, "id", spool.Id)
+		return err
+	}
+	s.logger.Info("updated spool", "id", spool.Id, "archived", spool.Archived)
+
+	if !isLocalSpoolUnavailable(existing) && isLocalSpoolUnavailable(spool) {
+		s.spoolUnavailable(ctx, spool.Id)
+	}
+	return nil
+}
+
+// DeleteSpool removes a spool
+func (s *LocalInventoryService) DeleteSpool(ctx context.Context, id int) error {
+	if err := s.db.DeleteSpool(ctx, id); err != nil {
+		s.logger.Error("failed to delete spool", "error", err, "id", id)
+		return err
+	}
+	s.logger.Info("deleted spool", "id", id)
+
+	s.spoolUnavailable(ctx, id)
+	return nil
+}
+
+// spoolUnavailable reports a spool to the registered callback, if any
+func (s *LocalInventoryService) spoolUnavailable(ctx context.Context, spoolID int) {
+	if s.onSpoolUnavailable == nil {
+		return
+	}
+	s.logger.Info("spool is no longer available", "spool_id", spoolID)
+	s.onSpoolUnavailable(ctx, spoolID)
+}
+
+// isLocalSpoolUnavailable reports whether a spool is archived or has run out of filament
+func isLocalSpoolUnavailable(spool *models.Spool) bool {
+	return spool.Archived || (spool.InitialWeight > 0 && spool.RemainingWeight <= 0)
+}
+
+// resolveMaterial replaces the filament's material reference with the stored material
+func (s *LocalInventoryService) resolveMaterial(ctx context.Context, filament *models.Filament) error {
+	material, err := s.db.GetMaterial(ctx, filament.Material.Id)
+	if err != nil {
+		return fmt.Errorf("failed to get material: %w", err)
+	}
+	if material == nil {
+		return fmt.Errorf("material not found: %d", filament.Material.Id)
+	}
+	filament.Material = *material
+	return nil
+}
+
+// resolveFilament replaces the spool's filament reference with the stored filament
+func (s *LocalInventoryService) resolveFilament(ctx context.Context, spool *models.Spool) error {
+	filament, err := s.db.GetFilament(ctx, spool.Filament.Id)
+	if err != nil {
+		return fmt.Errorf("failed to get filament: %w", err)
+	}
+	if filament == nil {
+		return fmt.Errorf("filament not found: %d", spool.Filament.Id)
+	}
+	spool.Filament = *filament
+	return nil
+}
+
+// toSpoolmanFilament converts a local filament to the shape used by Spoolman
+func toSpoolmanFilament(filament *models.Filament) spoolman.Filament {
+	return spoolman.Filament{
+		Id:                   filament.Id,
+		Name:                 filament.Name,
+		Vendor:               spoolman.Vendor{Name: filament.Vendor},
+		Material:             filament.Material.Name,
+		Price:                float32(filament.Price),
+		Density:              float32(filament.Material.Density),
+		Diameter:             float32(filament.Material.Diameter),
+		Weight:               float32(filament.Weight),
+		SettingsExtruderTemp: filament.ExtruderTemp,
+		SettingsBedTemp:      filament.BedTemp,
+		ColorHex:             filament.ColorHex,
+	}
+}
+
+// toSpoolmanSpool converts a local spool to the shape used by Spoolman
+func toSpoolmanSpool(spool *models.Spool) spoolman.Spool {
+	return spoolman.Spool{
+		Id:              spool.Id,
+		Registered:      spool.CreatedAt.UTC().Format(time.RFC3339),
+		Filament:        toSpoolmanFilament(&spool.Filament),
+		RemainingWeight: float32(spool.RemainingWeight),
+		InitialWeight:   float32(spool.InitialWeight),
+		UsedWeight:      float32(spool.InitialWeight - spool.RemainingWeight),
+		Location:        spool.Location,
+		LotNr:           spool.LotNr,
+		Comment:         spool.Comment,
+		Archived:        spool.Archived,
+	}
+}
+
+// distinctSorted returns the non-empty values without duplicates, in order
+func distinctSorted(values []string) []string {
+	seen := make(map[string]struct{}, len(values))
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if value == "" {
+			continue
+		}
+		if _, ok := seen[value]; ok {
+			continue
+		}
+		seen[value] = struct{}{}
+		result = append(result, value)
+	}
+	sort.Strings(result)
+	return result
+}
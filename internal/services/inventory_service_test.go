@@ -0,0 +1,136 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalInventoryGetSpools(t *testing.T) {
+	ctx := context.Background()
+	pla := models.Material{Id: 1, Name: "PLA", Density: 1.24, Diameter: 1.75}
+	red := models.Filament{Id: 2, Name: "Red", Material: pla, Vendor: "Prusament", ColorHex: "ff0000", Weight: 1000}
+
+	mockDB := new(MockDBClient)
+	service := NewLocalInventoryService(mockDB)
+
+	mockDB.On("ListSpools", ctx).Return([]*models.Spool{
+		{Id: 1, Filament: red, InitialWeight: 1000, RemainingWeight: 250, Location: "Shelf"},
+		{Id: 2, Filament: red, InitialWeight: 1000, Archived: true},
+	}, nil)
+
+	spools, err := service.GetSpools(ctx)
+	require.NoError(t, err)
+	require.Len(t, spools, 1, "archived spools are not offered")
+
+	spool := spools[0]
+	assert.Equal(t, 1, spool.Id)
+	assert.Equal(t, float32(750), spool.UsedWeight)
+	assert.Equal(t, "PLA", spool.Filament.Material)
+	assert.Equal(t, "Prusament", spool.Filament.Vendor.Name)
+	assert.Equal(t, "ff0000", spool.Filament.ColorHex)
+	assert.Equal(t, float32(1.75), spool.Filament.Diameter)
+	mockDB.AssertExpectations(t)
+}
+
+func TestLocalInventoryGetVendors(t *testing.T) {
+	ctx := context.Background()
+
+	mockDB := new(MockDBClient)
+	service := NewLocalInventoryService(mockDB)
+
+	mockDB.On("ListFilaments", ctx).Return([]*models.Filament{
+		{Id: 1, Vendor: "Polymaker"},
+		{Id: 2, Vendor: "Elegoo"},
+		{Id: 3, Vendor: "Polymaker"},
+		{Id: 4},
+	}, nil)
+
+	vendors, err := service.GetVendors(ctx)
+	require.NoError(t, err)
+	require.Len(t, vendors, 2)
+	assert.Equal(t, "Elegoo", vendors[0].Name)
+	assert.Equal(t, "Polymaker", vendors[1].Name)
+}
+
+func TestLocalInventoryUpdateSpoolUnavailable(t *testing.T) {
+	ctx := context.Background()
+	filament := &models.Filament{Id: 2, Name: "Red"}
+
+	tests := []struct {
+		name     string
+		existing models.Spool
+		updated  models.Spool
+		notified bool
+	}{
+		{
+			name:     "archived",
+			existing: models.Spool{Id: 1, InitialWeight: 1000, RemainingWeight: 500},
+			updated:  models.Spool{Id: 1, InitialWeight: 1000, RemainingWeight: 500, Archived: true},
+			notified: true,
+		},
+		{
+			name:     "emptied",
+			existing: models.Spool{Id: 1, InitialWeight: 1000, RemainingWeight: 500},
+			updated:  models.Spool{Id: 1, InitialWeight: 1000, RemainingWeight: 0},
+			notified: true,
+		},
+		{
+			name:     "partially used",
+			existing: models.Spool{Id: 1, InitialWeight: 1000, RemainingWeight: 500},
+			updated:  models.Spool{Id: 1, InitialWeight: 1000, RemainingWeight: 100},
+		},
+		{
+			name:     "already archived",
+			existing: models.Spool{Id: 1, InitialWeight: 1000, Archived: true},
+			updated:  models.Spool{Id: 1, InitialWeight: 1000, Archived: true, Comment: "empty"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDBClient)
+			service := NewLocalInventoryService(mockDB)
+
+			var notified []int
+			service.OnSpoolUnavailable(func(ctx context.Context, spoolID int) {
+				notified = append(notified, spoolID)
+			})
+
+			existing := tt.existing
+			updated := tt.updated
+			updated.Filament.Id = filament.Id
+			mockDB.On("GetSpool", ctx, 1).Return(&existing, nil)
+			mockDB.On("GetFilament", ctx, filament.Id).Return(filament, nil)
+			mockDB.On("UpdateSpool", ctx, mock.AnythingOfType("*models.Spool")).Return(nil)
+
+			require.NoError(t, service.UpdateSpool(ctx, &updated))
+			assert.Equal(t, "Red", updated.Filament.Name)
+			if tt.notified {
+				assert.Equal(t, []int{1}, notified)
+			} else {
+				assert.Empty(t, notified)
+			}
+		})
+	}
+}
+
+func TestLocalInventoryCreateSpoolDefaultsWeights(t *testing.T) {
+	ctx := context.Background()
+
+	mockDB := new(MockDBClient)
+	service := NewLocalInventoryService(mockDB)
+
+	mockDB.On("GetFilament", ctx, 2).Return(&models.Filament{Id: 2, Weight: 1000}, nil)
+	mockDB.On("CreateSpool", ctx, mock.AnythingOfType("*models.Spool")).Return(nil)
+
+	spool := &models.Spool{Filament: models.Filament{Id: 2}}
+	require.NoError(t, service.CreateSpool(ctx, spool))
+	assert.Equal(t, 1000.0, spool.InitialWeight)
+	assert.Equal(t, 1000.0, spool.RemainingWeight)
+	assert.False(t, spool.CreatedAt.IsZero())
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/google/uuid"
+)
+
+// MaxInvitationUses caps how many people can register with one code
+const MaxInvitationUses = 1000
+
+var (
+	// ErrInvalidInvitation is returned when registering with a code that is
+	// unknown, revoked, used up, expired or for another email address
+	ErrInvalidInvitation = errors.New("invitation code is invalid, used up or expired")
+	// ErrInvitationNotFound is returned when revoking an invitation that does
+	// not exist or was already revoked
+	ErrInvitationNotFound = errors.New("invitation not found")
+	// ErrInvitationRequest is returned when creating an invitation with an
+	// unknown role or group
+	ErrInvitationRequest = errors.New("invalid invitation")
+	// ErrInvitationForbidden is returned when creating an invitation with a
+	// role or group the creator cannot give
+	ErrInvitationForbidden = errors.New("not allowed to create this invitation")
+)
+
+// InvitationService manages the codes people register with when open
+// registration is disabled
+type InvitationService struct {
+	db     database.DBClient
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+// NewInvitationService creates a new invitation service
+func NewInvitationService(db database.DBClient) *InvitationService {
+	return &InvitationService{
+		db:     db,
+		now:    time.Now,
+		logger: slog.Default(),
+	}
+}
+
+// CreateInvitation creates the invitation on behalf of creator, who is nil
+// when authentication is disabled. It returns the invitation's code, which is
+// not stored and cannot be shown again.
+func (s *InvitationService) CreateInvitation(ctx context.Context, creator *models.User, invitation *models.Invitation) (string, error) {
+	if invitation.Role == "" {
+		invitation.Role = models.RoleUser
+	}
+	if !invitation.Role.IsValid() {
+		return "", fmt.Errorf("%w: unknown role %q", ErrInvitationRequest, invitation.Role)
+	}
+	// Invitations can't give anyone more access than their creator could
+	if creator != nil && !creator.CanGrantRole(invitation.Role) {
+		return "", fmt.Errorf("%w: cannot give the %s role", ErrInvitationForbidden, invitation.Role)
+	}
+
+	if invitation.GroupID != nil {
+		group, err := s.db.GetGroup(ctx, *invitation.GroupID)
+		if err != nil {
+			return "", err
+		}
+		if group == nil {
+			return "", fmt.Errorf("%w: unknown group %q", ErrInvitationRequest, *invitation.GroupID)
+		}
+		canInvite, err := s.canInviteToGroup(ctx, creator, group.ID)
+		if err != nil {
+			return "", err
+		}
+		if !canInvite {
+			return "", fmt.Errorf("%w: cannot add members to group %s", ErrInvitationForbidden, group.Name)
+		}
+	}
+
+	code := rand.Text()
+	invitation.ID = uuid.New().String()
+	invitation.CodeHash = hashToken(code)
+	invitation.Prefix = code[:6]
+	invitation.Uses = 0
+	invitation.RevokedAt = nil
+	invitation.CreatedBy = nil
+	if creator != nil {
+		invitation.CreatedBy = &creator.ID
+	}
+	invitation.CreatedAt = s.now()
+	if err := s.db.CreateInvitation(ctx, invitation); err != nil {
+		return "", err
+	}
+
+	s.logger.Info("created invitation", "invitation_id", invitation.ID, "role", invitation.Role, "max_uses", invitation.MaxUses)
+	return code, nil
+}
+
+// ListInvitations retrieves every invitation, newest first
+func (s *InvitationService) ListInvitations(ctx context.Context) ([]*models.Invitation, error) {
+	return s.db.ListInvitations(ctx)
+}
+
+// RevokeInvitation stops an invitation's code from being registered with
+func (s *InvitationService) RevokeInvitation(ctx context.Context, id string) error {
+	revoked, err := s.db.RevokeInvitation(ctx, id, s.now())
+	if err != nil {
+		return err
+	}
+	if !revoked {
+		return ErrInvitationNotFound
+	}
+	s.logger.Info("revoked invitation", "invitation_id", id)
+	return nil
+}
+
+// canInviteToGroup checks if the user may invite people into a group: users
+// who manage groups may invite to any, and group moderators to their own
+func (s *InvitationService) canInviteToGroup(ctx context.Context, user *models.User, groupID string) (bool, error) {
+	if user == nil || user.HasPermission(models.PermissionManageGroups) {
+		return true, nil
+	}
+
+	memberships, err := s.db.ListGroupMembershipsByUserID(ctx, user.ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to load group memberships: %w", err)
+	}
+	for _, membership := range memberships {
+		if membership.GroupID == groupID && membership.Role == models.GroupRoleModerator {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// normalizeInvitationCode undoes the changes people make copying a code
+func normalizeInvitationCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
@@ -0,0 +1,85 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateInvitationPermissions(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	service := NewInvitationService(mockDB)
+
+	moderator := &models.User{ID: "mod-id", Username: "mod", Role: models.RoleModerator, Enabled: true}
+	mockDB.On("GetGroup", ctx, "own-lab").Return(&models.Group{ID: "own-lab", Name: "Own lab"}, nil)
+	mockDB.On("GetGroup", ctx, "other-lab").Return(&models.Group{ID: "other-lab", Name: "Other lab"}, nil)
+	mockDB.On("ListGroupMembershipsByUserID", ctx, moderator.ID).Return([]*models.GroupMembership{
+		{GroupID: "own-lab", UserID: moderator.ID, Role: models.GroupRoleModerator},
+	}, nil)
+	mockDB.On("CreateInvitation", ctx, mock.Anything).Return(nil)
+
+	// Moderators cannot invite people into roles they cannot promote to
+	_, err := service.CreateInvitation(ctx, moderator, &models.Invitation{Role: models.RoleAdmin, MaxUses: 1})
+	assert.ErrorIs(t, err, ErrInvitationForbidden)
+
+	// or into groups they do not moderate
+	otherLab := "other-lab"
+	_, err = service.CreateInvitation(ctx, moderator, &models.Invitation{GroupID: &otherLab, MaxUses: 1})
+	assert.ErrorIs(t, err, ErrInvitationForbidden)
+
+	ownLab := "own-lab"
+	invitation := &models.Invitation{GroupID: &ownLab, MaxUses: 1}
+	code, err := service.CreateInvitation(ctx, moderator, invitation)
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleUser, invitation.Role)
+	assert.Equal(t, hashToken(code), invitation.CodeHash)
+	assert.Equal(t, moderator.ID, *invitation.CreatedBy)
+	mockDB.AssertNumberOfCalls(t, "CreateInvitation", 1)
+
+	// Users who can promote others can only invite people into roles with
+	// permissions they have, and only admins can invite admins
+	t.Cleanup(func() { models.SetRoles(models.BuiltInRoles()) })
+	models.SetRoles(append(models.BuiltInRoles(), &models.RoleDefinition{Name: "promoter", Permissions: []models.Permission{
+		models.PermissionCreatePrintRequests, models.PermissionViewOwnPrintRequests, models.PermissionManageUsers, models.PermissionPromoteUsers,
+	}}))
+	promoter := &models.User{ID: "promoter-id", Username: "promoter", Role: "promoter", Enabled: true}
+	for _, role := range []models.Role{models.RoleAdmin, models.RoleModerator} {
+		_, err = service.CreateInvitation(ctx, promoter, &models.Invitation{Role: role, MaxUses: 1})
+		assert.ErrorIs(t, err, ErrInvitationForbidden, role)
+	}
+	_, err = service.CreateInvitation(ctx, promoter, &models.Invitation{Role: "promoter", MaxUses: 1})
+	assert.NoError(t, err)
+	mockDB.AssertNumberOfCalls(t, "CreateInvitation", 2)
+
+	// Admins can do both
+	admin := &models.User{ID: "admin-id", Username: "admin", Role: models.RoleAdmin, Enabled: true}
+	_, err = service.CreateInvitation(ctx, admin, &models.Invitation{Role: models.RoleAdmin, GroupID: &otherLab, MaxUses: 1})
+	assert.NoError(t, err)
+}
+
+func TestRegisterInvitedUserRollsBack(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	mockTx := new(MockTx)
+	service := NewUserService(mockDB)
+
+	// The invitation is for someone else, so the transaction that used it is
+	// rolled back
+	email := "invited@example.com"
+	mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+	mockTx.On("GetUserByUsername", ctx, "intruder").Return(nil, nil)
+	mockTx.On("GetUserByEmail", ctx, "intruder@example.com").Return(nil, nil)
+	mockTx.On("UseInvitation", ctx, hashToken("CODE"), mock.Anything).Return(&models.Invitation{ID: "inv", Email: &email, Role: models.RoleUser, MaxUses: 1, Uses: 1}, nil)
+	mockTx.On("Rollback").Return(nil)
+
+	_, err := service.RegisterInvitedUser(ctx, "code", "intruder", "intruder@example.com", "password123")
+	assert.ErrorIs(t, err, ErrInvalidInvitation)
+	mockTx.AssertCalled(t, "Rollback")
+	mockTx.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+	mockTx.AssertNotCalled(t, "Commit")
+}
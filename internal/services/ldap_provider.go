@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/ldap"
+)
+
+var _ AuthProvider = (*LDAPProvider)(nil)
+
+// LDAPProvider checks passwords against an LDAP directory, such as OpenLDAP or
+// Active Directory. It finds the user with a service account, then binds as
+// them with their password.
+type LDAPProvider struct {
+	cfg       config.LDAPProviderConfig
+	tlsConfig *tls.Config
+	// roleMap is the configured role mapping with lowercased group names,
+	// since DNs and cns are case-insensitive
+	roleMap []config.RoleMappingConfig
+}
+
+// NewLDAPProvider creates an LDAPProvider, loading its CA certificates if it
+// has any
+func NewLDAPProvider(cfg config.LDAPProviderConfig) (*LDAPProvider, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+	}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in CA file %s", cfg.CAFile)
+		}
+	}
+
+	roleMap := make([]config.RoleMappingConfig, len(cfg.RoleMap))
+	for i, mapping := range cfg.RoleMap {
+		roleMap[i] = config.RoleMappingConfig{Group: strings.ToLower(mapping.Group), Role: mapping.Role}
+	}
+
+	return &LDAPProvider{cfg: cfg, tlsConfig: tlsConfig, roleMap: roleMap}, nil
+}
+
+// Name returns the directory's configured name
+func (p *LDAPProvider) Name() string {
+	return p.cfg.Name
+}
+
+// Authenticate finds the user in the directory and checks their password by
+// binding as them
+func (p *LDAPProvider) Authenticate(ctx context.Context, username, password string) (*DirectoryProfile, error) {
+	if strings.TrimSpace(username) == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.cfg.Timeout)
+	defer cancel()
+	conn, err := p.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = conn.Close() }()
+
+	entries, err := conn.Search(&ldap.SearchRequest{
+		BaseDN:     p.cfg.UserBaseDN,
+		Scope:      ldap.ScopeWholeSubtree,
+		Filter:     strings.ReplaceAll(p.cfg.UserFilter, "{username}", ldap.EscapeFilter(username)),
+		Attributes: p.userAttributes(),
+		SizeLimit:  2,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to search for user: %w", err)
+	}
+	switch len(entries) {
+	case 0:
+		return nil, ErrInvalidCredentials
+	case 1:
+	default:
+		// Logging in as whichever matched first could be the wrong person
+		return nil, fmt.Errorf("more than one directory entry matches the username")
+	}
+	entry := entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsResult(err, ldap.ResultInvalidCredentials) || errors.Is(err, ldap.ErrEmptyPassword) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to bind as user: %w", err)
+	}
+
+	profile := &DirectoryProfile{
+		Provider:    p.cfg.Name,
+		Username:    entry.Value(p.cfg.Attributes.Username),
+		Email:       entry.Value(p.cfg.Attributes.Email),
+		DisplayName: entry.Value(p.cfg.Attributes.DisplayName),
+	}
+	if profile.Username == "" {
+		profile.Username = username
+	}
+	if profile.Subject, err = p.subject(entry); err != nil {
+		return nil, err
+	}
+
+	if len(p.roleMap) > 0 {
+		groups, err := p.groups(conn, entry, username)
+		if err != nil {
+			return nil, err
+		}
+		profile.Role = RoleFromGroups(p.roleMap, groups)
+	}
+	return profile, nil
+}
+
+// connect connects to the directory and binds as the service account
+func (p *LDAPProvider) connect(ctx context.Context) (*ldap.Conn, error) {
+	conn, err := ldap.Dial(ctx, p.cfg.URL, p.tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	if p.cfg.StartTLS {
+		if err := conn.StartTLS(p.tlsConfig); err != nil {
+			_ = conn.Close()
+			return nil, err
+		}
+	}
+	if err := p.bindServiceAccount(conn); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// bindServiceAccount binds as the service account, or anonymously if there
+// is none
+func (p *LDAPProvider) bindServiceAccount(conn *ldap.Conn) error {
+	if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+		return fmt.Errorf("failed to bind as service account: %w", err)
+	}
+	return nil
+}
+
+// userAttributes lists the attributes read from users' entries
+func (p *LDAPProvider) userAttributes() []string {
+	attributes := []string{
+		p.cfg.Attributes.Username,
+		p.cfg.Attributes.Email,
+		p.cfg.Attributes.DisplayName,
+		p.cfg.Attributes.Groups,
+	}
+	if p.cfg.Attributes.ID != "" {
+		attributes = append(attributes, p.cfg.Attributes.ID)
+	}
+	return attributes
+}
+
+// subject returns the ID users are linked to their accounts by: the ID
+// attribute if one is configured, hex-encoded if it is binary like Active
+// Directory's objectGUID, or else the lowercased username attribute
+func (p *LDAPProvider) subject(entry *ldap.Entry) (string, error) {
+	if p.cfg.Attributes.ID != "" {
+		id := entry.RawValue(p.cfg.Attributes.ID)
+		if len(id) == 0 {
+			return "", fmt.Errorf("directory entry has no %s attribute", p.cfg.Attributes.ID)
+		}
+		if !utf8.Valid(id) {
+			return hex.EncodeToString(id), nil
+		}
+		return string(id), nil
+	}
+
+	username := entry.Value(p.cfg.Attributes.Username)
+	if username == "" {
+		return "", fmt.Errorf("directory entry has no %s attribute", p.cfg.Attributes.Username)
+	}
+	return strings.ToLower(username), nil
+}
+
+// groups returns the lowercased DNs and cns of the user's groups, from the
+// groups attribute and a group search if one is configured
+func (p *LDAPProvider) groups(conn *ldap.Conn, entry *ldap.Entry, username string) ([]string, error) {
+	dns := entry.Values(p.cfg.Attributes.Groups)
+
+	if p.cfg.GroupFilter != "" {
+		// Users may not be allowed to search for groups themselves
+		if err := p.bindServiceAccount(conn); err != nil {
+			return nil, err
+		}
+		filter := strings.NewReplacer(
+			"{dn}", ldap.EscapeFilter(entry.DN),
+			"{username}", ldap.EscapeFilter(username),
+		).Replace(p.cfg.GroupFilter)
+		groupEntries, err := conn.Search(&ldap.SearchRequest{
+			BaseDN: p.cfg.GroupBaseDN,
+			Scope:  ldap.ScopeWholeSubtree,
+			Filter: filter,
+			// Only the DNs are needed
+			Attributes: []string{"1.1"},
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to search for groups: %w", err)
+		}
+		for _, group := range groupEntries {
+			dns = append(dns, group.DN)
+		}
+	}
+
+	var groups []string
+	for _, dn := range dns {
+		dn = strings.ToLower(dn)
+		groups = append(groups, dn)
+		// Also match the group's cn, e.g. print-admins for
+		// cn=print-admins,ou=groups,dc=example,dc=com
+		rdn, _, _ := strings.Cut(dn, ",")
+		if attribute, value, ok := strings.Cut(rdn, "="); ok && strings.TrimSpace(attribute) == "cn" {
+			groups = append(groups, strings.TrimSpace(value))
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/ldap/ldaptest"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestDirectory starts a directory with a service account, alice, who is
+// in the print-admins group, and bob, who is in no groups
+func newTestDirectory(t *testing.T) *ldaptest.Server {
+	t.Helper()
+	directory := ldaptest.NewServer(t)
+	directory.AddEntry(&ldaptest.Entry{
+		DN:       "cn=print-dis,ou=services,dc=example,dc=edu",
+		Password: "service-secret",
+	})
+	directory.AddEntry(&ldaptest.Entry{
+		DN: "uid=alice,ou=people,dc=example,dc=edu",
+		Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"alice"},
+			"mail":        {"alice@example.edu"},
+			"cn":          {"Alice Liddell"},
+			"memberOf":    {"cn=Print-Admins,ou=groups,dc=example,dc=edu"},
+		},
+		Password: "alice-secret",
+	})
+	directory.AddEntry(&ldaptest.Entry{
+		DN: "uid=bob,ou=people,dc=example,dc=edu",
+		Attributes: map[string][]string{
+			"objectClass": {"person"},
+			"uid":         {"bob"},
+			"cn":          {"Bob"},
+		},
+		Password: "bob-secret",
+	})
+	directory.AddEntry(&ldaptest.Entry{
+		DN: "cn=lab-moderators,ou=groups,dc=example,dc=edu",
+		Attributes: map[string][]string{
+			"objectClass": {"groupOfNames"},
+			"member":      {"uid=bob,ou=people,dc=example,dc=edu"},
+		},
+	})
+	return directory
+}
+
+func newTestLDAPProvider(t *testing.T, directory *ldaptest.Server, modify func(*config.LDAPProviderConfig)) *LDAPProvider {
+	t.Helper()
+	cfg := config.LDAPProviderConfig{
+		Name:         "campus",
+		Enabled:      true,
+		URL:          directory.URL,
+		Timeout:      5 * time.Second,
+		BindDN:       "cn=print-dis,ou=services,dc=example,dc=edu",
+		BindPassword: "service-secret",
+		UserBaseDN:   "ou=people,dc=example,dc=edu",
+		UserFilter:   "(&(objectClass=person)(uid={username}))",
+		Attributes: config.LDAPAttributesConfig{
+			Username:    "uid",
+			Email:       "mail",
+			DisplayName: "cn",
+			Groups:      "memberOf",
+		},
+		RoleMap: []config.RoleMappingConfig{
+			{Group: "cn=print-admins,ou=groups,dc=example,dc=edu", Role: "admin"},
+			{Group: "lab-moderators", Role: "moderator"},
+		},
+	}
+	if modify != nil {
+		modify(&cfg)
+	}
+	provider, err := NewLDAPProvider(cfg)
+	require.NoError(t, err)
+	return provider
+}
+
+func TestLDAPProviderAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	directory := newTestDirectory(t)
+	provider := newTestLDAPProvider(t, directory, nil)
+
+	profile, err := provider.Authenticate(ctx, "alice", "alice-secret")
+	require.NoError(t, err)
+	assert.Equal(t, DirectoryProfile{
+		Provider:    "campus",
+		Subject:     "alice",
+		Username:    "alice",
+		Email:       "alice@example.edu",
+		DisplayName: "Alice Liddell",
+		Role:        models.RoleAdmin,
+	}, *profile)
+	assert.Contains(t, directory.Binds(), "uid=alice,ou=people,dc=example,dc=edu")
+
+	// Bob is in no groups listed in his entry, so gets the user role
+	profile, err = provider.Authenticate(ctx, "bob", "bob-secret")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleUser, profile.Role)
+	assert.Empty(t, profile.Email)
+
+	for _, tt := range []struct{ username, password string }{
+		{"alice", "wrong"},
+		{"alice", ""},
+		{"carol", "carol-secret"},
+		// Filter syntax in usernames matches nothing rather than everyone
+		{"*", "alice-secret"},
+		{"alice)(uid=*", "alice-secret"},
+	} {
+		_, err := provider.Authenticate(ctx, tt.username, tt.password)
+		assert.ErrorIs(t, err, ErrInvalidCredentials, "username %q", tt.username)
+	}
+}
+
+func TestLDAPProviderGroupSearch(t *testing.T) {
+	provider := newTestLDAPProvider(t, newTestDirectory(t), func(cfg *config.LDAPProviderConfig) {
+		cfg.GroupBaseDN = "ou=groups,dc=example,dc=edu"
+		cfg.GroupFilter = "(&(objectClass=groupOfNames)(member={dn}))"
+	})
+
+	// Groups found by searching are mapped by their cn
+	profile, err := provider.Authenticate(context.Background(), "bob", "bob-secret")
+	require.NoError(t, err)
+	assert.Equal(t, models.RoleModerator, profile.Role)
+}
+
+func TestLDAPProviderErrors(t *testing.T) {
+	ctx := context.Background()
+	directory := newTestDirectory(t)
+
+	// Directory problems are errors, not wrong passwords, so that they are
+	// logged
+	provider := newTestLDAPProvider(t, directory, func(cfg *config.LDAPProviderConfig) {
+		cfg.BindPassword = "wrong"
+	})
+	_, err := provider.Authenticate(ctx, "alice", "alice-secret")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidCredentials)
+
+	// Ambiguous usernames are refused
+	provider = newTestLDAPProvider(t, directory, func(cfg *config.LDAPProviderConfig) {
+		cfg.UserFilter = "(|(uid={username})(objectClass=person))"
+	})
+	_, err = provider.Authenticate(ctx, "alice", "alice-secret")
+	assert.ErrorContains(t, err, "more than one")
+
+	_, err = NewLDAPProvider(config.LDAPProviderConfig{CAFile: "/nonexistent/ca.pem"})
+	assert.Error(t, err)
+}
+
+func TestAuthenticateUserWithLDAP(t *testing.T) {
+	ctx := context.Background()
+	empty := ldaptest.NewServer(t)
+	empty.AddEntry(&ldaptest.Entry{DN: "cn=print-dis,ou=services,dc=example,dc=edu", Password: "service-secret"})
+	first := newTestLDAPProvider(t, empty, func(cfg *config.LDAPProviderConfig) { cfg.Name = "first" })
+	campus := newTestLDAPProvider(t, newTestDirectory(t), nil)
+
+	mockDB := new(MockDBClient)
+	mockTx := new(MockTx)
+	service := NewUserService(mockDB)
+	service.SetAuthProviders(first, campus)
+
+	// The first login creates a user linked to the second directory, which
+	// has alice
+	mockDB.On("GetUserByUsername", ctx, "alice").Return(nil, nil)
+	mockDB.On("GetLDAPIdentity", ctx, "campus", "alice").Return(nil, nil).Once()
+	mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+	mockTx.On("GetUserByUsername", ctx, "alice").Return(nil, sql.ErrNoRows)
+	mockTx.On("GetUserByEmail", ctx, "alice@example.edu").Return(nil, sql.ErrNoRows)
+	mockTx.On("CreateUser", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+	mockTx.On("CreateLDAPIdentity", ctx, mock.MatchedBy(func(identity *models.UserLDAPIdentity) bool {
+		return identity.ProviderName == "campus" && identity.Subject == "alice"
+	})).Return(nil)
+	mockTx.On("Commit").Return(nil)
+
+	user, err := service.AuthenticateUser(ctx, "alice", "alice-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Username)
+	assert.Equal(t, models.RoleAdmin, user.Role)
+	require.NotNil(t, user.Email)
+	assert.Equal(t, "alice@example.edu", *user.Email)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.False(t, user.HasPassword())
+	mockTx.AssertExpectations(t)
+
+	// Later logins find the linked user and sync their details
+	user.DisplayName = nil
+	user.Role = models.RoleUser
+	mockDB.On("GetLDAPIdentity", ctx, "campus", "alice").Return(&models.UserLDAPIdentity{UserID: user.ID}, nil)
+	mockDB.On("GetUser", ctx, user.ID).Return(user, nil)
+	mockDB.On("UpdateUser", ctx, user).Return(nil).Once()
+	got, err := service.AuthenticateUser(ctx, "alice", "alice-secret")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+	require.NotNil(t, got.DisplayName)
+	assert.Equal(t, "Alice Liddell", *got.DisplayName)
+	assert.Equal(t, models.RoleAdmin, got.Role)
+	mockDB.AssertNumberOfCalls(t, "BeginTx", 1)
+
+	// Wrong passwords are refused by every directory
+	_, err = service.AuthenticateUser(ctx, "alice", "wrong")
+	assert.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// Disabled users cannot log in with the directory either
+	user.Enabled = false
+	_, err = service.AuthenticateUser(ctx, "alice", "alice-secret")
+	assert.EqualError(t, err, "account is disabled")
+}
+
+func TestAuthenticateUserPrefersLocalAccounts(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	service := NewUserService(mockDB)
+	service.SetAuthProviders(newTestLDAPProvider(t, newTestDirectory(t), nil))
+
+	local := newTestUser(t, "alice@example.com")
+	local.Username = "alice"
+	mockDB.On("GetUserByUsername", ctx, "alice").Return(local, nil)
+
+	user, err := service.AuthenticateUser(ctx, "alice", "password123")
+	require.NoError(t, err)
+	assert.Equal(t, local.ID, user.ID)
+	mockDB.AssertNotCalled(t, "GetLDAPIdentity", mock.Anything, mock.Anything, mock.Anything)
+}
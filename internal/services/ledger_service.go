@@ -0,0 +1,288 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+)
+
+var (
+	// ErrOutstandingBalance is returned when a request cannot be approved
+	// because its owner owes money
+	ErrOutstandingBalance = errors.New("user has an outstanding balance")
+	// ErrChargeWaived is returned when waiving a charge that was already
+	// waived, which would replace the reason it was waived for
+	ErrChargeWaived = errors.New("charge is already waived")
+)
+
+// LedgerService tracks what users are charged for their prints and what they
+// have paid
+type LedgerService struct {
+	db       database.DBClient
+	config   config.BillingConfig
+	currency string
+	logger   *slog.Logger
+}
+
+// NewLedgerService creates a new ledger service. Amounts are in the given currency.
+func NewLedgerService(db database.DBClient, cfg config.BillingConfig, currency string) *LedgerService {
+	return &LedgerService{
+		db:       db,
+		config:   cfg,
+		currency: currency,
+		logger:   slog.Default(),
+	}
+}
+
+// ChargeRequest records the actual cost of a completed request as a charge to
+// its owner, updating the existing charge if the request was charged before.
+// It runs in the transaction that updates the request, so that a request is
+// never done without its charge.
+func (s *LedgerService) ChargeRequest(ctx context.Context, tx database.Tx, request *models.PrintRequest) error {
+	if request.ActualCost == nil {
+		return nil
+	}
+
+	// Costs are estimated from rates, so are rounded to cents on the ledger
+	amount := models.MoneyFromFloat(*request.ActualCost)
+
+	existing, err := tx.GetChargeByPrintRequestID(ctx, request.ID)
+	if err != nil {
+		return fmt.Errorf("failed to get charge: %w", err)
+	}
+
+	if existing != nil {
+		if existing.Amount == amount {
+			return nil
+		}
+		existing.Amount = amount
+		if err := tx.UpdateCharge(ctx, existing); err != nil {
+			return err
+		}
+		s.logger.Info("updated charge for print request", "id", existing.ID, "print_request_id", request.ID, "amount", existing.Amount)
+		return nil
+	}
+
+	requestID := request.ID
+	charge := &models.Charge{
+		UserID:         request.UserID,
+		PrintRequestID: &requestID,
+		Amount:         amount,
+		Description:    chargeDescription(request),
+	}
+	if err := tx.CreateCharge(ctx, charge); err != nil {
+		return err
+	}
+	s.logger.Info("charged print request", "id", charge.ID, "print_request_id", request.ID, "user_id", request.UserID, "amount", charge.Amount)
+	return nil
+}
+
+// CheckApproval returns ErrOutstandingBalance if requests of the given user
+// are held until they have paid what they owe
+func (s *LedgerService) CheckApproval(ctx context.Context, userID string) error {
+	if !s.config.HoldNegativeBalance {
+		return nil
+	}
+
+	balance, err := s.GetBalance(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if balance != nil && balance.Balance < 0 {
+		return fmt.Errorf("%w of %s %s", ErrOutstandingBalance, -balance.Balance, s.currency)
+	}
+	return nil
+}
+
+// RecordPayment records a payment received from a user
+func (s *LedgerService) RecordPayment(ctx context.Context, payment *models.Payment) error {
+	user, err := s.db.GetUser(ctx, payment.UserID)
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return fmt.Errorf("user not found: %s", payment.UserID)
+	}
+
+	if err := s.db.CreatePayment(ctx, payment); err != nil {
+		s.logger.Error("failed to record payment", "error", err, "user_id", payment.UserID)
+		return err
+	}
+	s.logger.Info("recorded payment", "id", payment.ID, "user_id", payment.UserID, "amount", payment.Amount, "recorded_by", payment.RecordedBy)
+	return nil
+}
+
+// WaiveCharge waives a charge so it no longer counts towards the user's
+// balance. It returns nil if the charge does not exist, and ErrChargeWaived
+// if it was already waived.
+func (s *LedgerService) WaiveCharge(ctx context.Context, id int, reason string) (*models.Charge, error) {
+	charge, err := s.db.GetCharge(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get charge: %w", err)
+	}
+	if charge == nil {
+		return nil, nil
+	}
+	if charge.Waived {
+		return nil, ErrChargeWaived
+	}
+
+	charge.Waived = true
+	charge.WaivedReason = reason
+	if err := s.db.UpdateCharge(ctx, charge); err != nil {
+		s.logger.Error("failed to waive charge", "error", err, "id", id)
+		return nil, err
+	}
+	s.logger.Info("waived charge", "id", id, "user_id", charge.UserID, "amount", charge.Amount)
+	return charge, nil
+}
+
+// GetBalance retrieves a user's balance, returning nil if the user does not exist
+func (s *LedgerService) GetBalance(ctx context.Context, userID string) (*models.Balance, error) {
+	balance, err := s.db.GetBalance(ctx, userID)
+	if err != nil {
+		s.logger.Error("failed to get balance", "error", err, "user_id", userID)
+		return nil, err
+	}
+	if balance != nil {
+		balance.Balance = balance.Paid - balance.Charged
+	}
+	return balance, nil
+}
+
+// ListBalances retrieves the balance of every user
+func (s *LedgerService) ListBalances(ctx context.Context) ([]*models.Balance, error) {
+	balances, err := s.db.ListBalances(ctx)
+	if err != nil {
+		s.logger.Error("failed to list balances", "error", err)
+		return nil, err
+	}
+	for _, balance := range balances {
+		balance.Balance = balance.Paid - balance.Charged
+	}
+	return balances, nil
+}
+
+// ListCharges retrieves all charges of a user, including waived ones
+func (s *LedgerService) ListCharges(ctx context.Context, userID string) ([]*models.Charge, error) {
+	return s.db.ListChargesByUserID(ctx, userID)
+}
+
+// ListPayments retrieves all payments of a user
+func (s *LedgerService) ListPayments(ctx context.Context, userID string) ([]*models.Payment, error) {
+	return s.db.ListPaymentsByUserID(ctx, userID)
+}
+
+// Statement builds a user's statement for a calendar month. It returns nil if
+// the user does not exist.
+func (s *LedgerService) Statement(ctx context.Context, userID string, year int, month time.Month) (*models.Statement, error) {
+	user, err := s.db.GetUser(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return nil, nil
+	}
+
+	charges, err := s.db.ListChargesByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	payments, err := s.db.ListPaymentsByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	start := time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, 0)
+
+	entries := make([]models.StatementEntry, 0, len(charges)+len(payments))
+	for _, charge := range charges {
+		if charge.Waived {
+			continue
+		}
+		entries = append(entries, models.StatementEntry{
+			Date:        charge.CreatedAt,
+			Kind:        "charge",
+			Description: charge.Description,
+			Amount:      -charge.Amount,
+		})
+	}
+	for _, payment := range payments {
+		entries = append(entries, models.StatementEntry{
+			Date:        payment.CreatedAt,
+			Kind:        "payment",
+			Description: paymentDescription(payment),
+			Amount:      payment.Amount,
+		})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+
+	statement := &models.Statement{
+		UserID:      user.ID,
+		Username:    user.Username,
+		Currency:    s.currency,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Entries:     make([]models.StatementEntry, 0),
+		GeneratedAt: time.Now(),
+	}
+
+	var balance models.Money
+	for _, entry := range entries {
+		if !entry.Date.Before(end) {
+			break
+		}
+		balance += entry.Amount
+		if entry.Date.Before(start) {
+			statement.OpeningBalance = balance
+			continue
+		}
+		entry.Balance = balance
+		statement.Entries = append(statement.Entries, entry)
+	}
+	statement.ClosingBalance = balance
+
+	return statement, nil
+}
+
+// chargeDescription describes the charge for a print request
+func chargeDescription(request *models.PrintRequest) string {
+	description := "Print request " + shortID(request.ID)
+	if request.ActualGrams != nil {
+		description += fmt.Sprintf(", %.0fg", *request.ActualGrams)
+	}
+	if request.ActualHours != nil {
+		description += fmt.Sprintf(", %.1fh", *request.ActualHours)
+	}
+	return description
+}
+
+// paymentDescription describes a payment on a statement
+func paymentDescription(payment *models.Payment) string {
+	description := "Payment"
+	if payment.Method != "" {
+		description += " (" + payment.Method + ")"
+	}
+	if payment.Reference != "" {
+		description += " " + payment.Reference
+	}
+	return description
+}
+
+// shortID abbreviates a UUID for display
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChargeRequest(t *testing.T) {
+	ctx := context.Background()
+	cost, grams := 4.0, 150.0
+	request := &models.PrintRequest{ID: "0123456789abcdef", UserID: "user", ActualCost: &cost, ActualGrams: &grams}
+	ledger := NewLedgerService(new(MockDBClient), config.BillingConfig{Enabled: true}, "EUR")
+
+	t.Run("creates a charge", func(t *testing.T) {
+		mockTx := new(MockTx)
+		mockTx.On("GetChargeByPrintRequestID", ctx, request.ID).Return(nil, nil)
+		mockTx.On("CreateCharge", ctx, mock.MatchedBy(func(charge *models.Charge) bool {
+			return charge.UserID == "user" && charge.Amount == 400 &&
+				charge.PrintRequestID != nil && *charge.PrintRequestID == request.ID &&
+				charge.Description == "Print request 01234567, 150g"
+		})).Return(nil)
+
+		require.NoError(t, ledger.ChargeRequest(ctx, mockTx, request))
+		mockTx.AssertExpectations(t)
+	})
+
+	t.Run("updates an existing charge", func(t *testing.T) {
+		mockTx := new(MockTx)
+		existing := &models.Charge{ID: 7, UserID: "user", Amount: 300}
+		mockTx.On("GetChargeByPrintRequestID", ctx, request.ID).Return(existing, nil)
+		mockTx.On("UpdateCharge", ctx, existing).Return(nil)
+
+		require.NoError(t, ledger.ChargeRequest(ctx, mockTx, request))
+		assert.Equal(t, models.Money(400), existing.Amount)
+		mockTx.AssertExpectations(t)
+	})
+
+	t.Run("unchanged charge", func(t *testing.T) {
+		mockTx := new(MockTx)
+		mockTx.On("GetChargeByPrintRequestID", ctx, request.ID).Return(&models.Charge{ID: 7, Amount: 400}, nil)
+
+		require.NoError(t, ledger.ChargeRequest(ctx, mockTx, request))
+		mockTx.AssertNotCalled(t, "UpdateCharge", mock.Anything, mock.Anything)
+	})
+}
+
+func TestCheckApproval(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		hold    bool
+		balance *models.Balance
+		wantErr bool
+	}{
+		{name: "hold disabled", hold: false, wantErr: false},
+		{name: "settled", hold: true, balance: &models.Balance{Charged: 1000, Paid: 1000}, wantErr: false},
+		{name: "in credit", hold: true, balance: &models.Balance{Charged: 500, Paid: 1000}, wantErr: false},
+		{name: "owes money", hold: true, balance: &models.Balance{Charged: 1050, Paid: 1000}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDBClient)
+			ledger := NewLedgerService(mockDB, config.BillingConfig{Enabled: true, HoldNegativeBalance: tt.hold}, "EUR")
+			if tt.hold {
+				mockDB.On("GetBalance", ctx, "user").Return(tt.balance, nil)
+			}
+
+			err := ledger.CheckApproval(ctx, "user")
+			if tt.wantErr {
+				assert.ErrorIs(t, err, ErrOutstandingBalance)
+				assert.Contains(t, err.Error(), "0.50 EUR")
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+func TestWaiveCharge(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	ledger := NewLedgerService(mockDB, config.BillingConfig{Enabled: true}, "EUR")
+
+	mockDB.On("GetCharge", ctx, 1).Return(&models.Charge{ID: 1, UserID: "user", Amount: 400}, nil)
+	mockDB.On("UpdateCharge", ctx, mock.MatchedBy(func(charge *models.Charge) bool {
+		return charge.ID == 1 && charge.Waived && charge.WaivedReason == "Failed print"
+	})).Return(nil).Once()
+	charge, err := ledger.WaiveCharge(ctx, 1, "Failed print")
+	require.NoError(t, err)
+	assert.True(t, charge.Waived)
+
+	// Waiving it again would replace the reason
+	mockDB.On("GetCharge", ctx, 2).Return(&models.Charge{ID: 2, UserID: "user", Amount: 400, Waived: true, WaivedReason: "Failed print"}, nil)
+	_, err = ledger.WaiveCharge(ctx, 2, "Changed my mind")
+	assert.ErrorIs(t, err, ErrChargeWaived)
+
+	mockDB.On("GetCharge", ctx, 3).Return(nil, nil)
+	charge, err = ledger.WaiveCharge(ctx, 3, "Failed print")
+	assert.NoError(t, err)
+	assert.Nil(t, charge)
+	mockDB.AssertExpectations(t)
+}
+
+func TestStatement(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	ledger := NewLedgerService(mockDB, config.BillingConfig{Enabled: true}, "EUR")
+
+	day := func(month time.Month, day int) time.Time {
+		return time.Date(2026, month, day, 12, 0, 0, 0, time.UTC)
+	}
+
+	mockDB.On("GetUser", ctx, "user").Return(&models.User{ID: "user", Username: "ada"}, nil)
+	mockDB.On("ListChargesByUserID", ctx, "user").Return([]*models.Charge{
+		{ID: 1, Amount: 500, Description: "August print", CreatedAt: day(time.August, 20)},
+		{ID: 2, Amount: 325, Description: "September print", CreatedAt: day(time.September, 10)},
+		{ID: 3, Amount: 10000, Description: "Waived print", Waived: true, CreatedAt: day(time.September, 11)},
+		{ID: 4, Amount: 200, Description: "October print", CreatedAt: day(time.October, 1)},
+	}, nil)
+	mockDB.On("ListPaymentsByUserID", ctx, "user").Return([]*models.Payment{
+		{ID: 1, Amount: 100, Method: "cash", CreatedAt: day(time.August, 21)},
+		{ID: 2, Amount: 600, Method: "card", Reference: "R-1", CreatedAt: day(time.September, 15)},
+	}, nil)
+
+	statement, err := ledger.Statement(ctx, "user", 2026, time.September)
+	require.NoError(t, err)
+	require.NotNil(t, statement)
+
+	assert.Equal(t, "ada", statement.Username)
+	assert.Equal(t, "EUR", statement.Currency)
+	assert.Equal(t, models.Money(-400), statement.OpeningBalance)
+	assert.Equal(t, models.Money(-125), statement.ClosingBalance)
+
+	require.Len(t, statement.Entries, 2)
+	assert.Equal(t, models.StatementEntry{
+		Date: day(time.September, 10), Kind: "charge", Description: "September print", Amount: -325, Balance: -725,
+	}, statement.Entries[0])
+	assert.Equal(t, models.StatementEntry{
+		Date: day(time.September, 15), Kind: "payment", Description: "Payment (card) R-1", Amount: 600, Balance: -125,
+	}, statement.Entries[1])
+}
+
+func TestUpdatePrintRequestHeldForOutstandingBalance(t *testing.T) {
+	ctx := context.Background()
+
+	current := &models.PrintRequest{ID: "req", UserID: "user", Status: models.StatusPendingApproval}
+	updated := *current
+	updated.UserID = ""
+	updated.Status = models.StatusEnqueued
+
+	mockDB := new(MockDBClient)
+	mockTx := new(MockTx)
+	service := NewPrintRequestService(mockDB)
+	service.SetLedger(NewLedgerService(mockDB, config.BillingConfig{Enabled: true, HoldNegativeBalance: true}, "EUR"))
+
+	mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+	mockTx.On("GetPrintRequest", ctx, "req").Return(current, nil)
+	mockDB.On("GetBalance", ctx, "user").Return(&models.Balance{UserID: "user", Charged: 1200}, nil)
+	mockTx.On("Rollback").Return(nil)
+
+	err := service.UpdatePrintRequest(ctx, &updated)
+	assert.True(t, errors.Is(err, ErrOutstandingBalance))
+	mockTx.AssertCalled(t, "Rollback")
+	mockTx.AssertNotCalled(t, "UpdatePrintRequest", mock.Anything, mock.Anything)
+}
+
+func TestUpdatePrintRequestChargesCompletedRequest(t *testing.T) {
+	ctx := context.Background()
+	grams := 100.0
+
+	current := &models.PrintRequest{ID: "req", UserID: "user", Status: models.StatusInProgress, EstimatedGrams: &grams}
+	updated := *current
+	updated.Status = models.StatusDone
+
+	mockDB := new(MockDBClient)
+	mockTx := new(MockTx)
+	service := NewPrintRequestService(mockDB)
+	service.SetPricing(NewPricingService(testPricing, nil))
+	service.SetLedger(NewLedgerService(mockDB, config.BillingConfig{Enabled: true}, "EUR"))
+
+	mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+	mockTx.On("GetPrintRequest", ctx, "req").Return(current, nil)
+	mockTx.On("UpdatePrintRequest", ctx, mock.Anything).Return(nil)
+	mockTx.On("CreatePrintRequestStatusEvent", ctx, mock.Anything).Return(nil)
+	mockTx.On("GetChargeByPrintRequestID", ctx, "req").Return(nil, nil)
+	mockTx.On("CreateCharge", ctx, mock.MatchedBy(func(charge *models.Charge) bool {
+		return charge.UserID == "user" && charge.Amount == 300 // 100g × 0.02 + 1
+	})).Return(nil)
+	mockTx.On("Commit").Return(nil)
+
+	require.NoError(t, service.UpdatePrintRequest(ctx, &updated))
+	mockTx.AssertExpectations(t)
+}
+
+func TestUpdatePrintRequestFailsWithoutCharge(t *testing.T) {
+	ctx := context.Background()
+	grams := 100.0
+
+	current := &models.PrintRequest{ID: "req", UserID: "user", Status: models.StatusInProgress, EstimatedGrams: &grams}
+	updated := *current
+	updated.Status = models.StatusDone
+
+	mockDB := new(MockDBClient)
+	mockTx := new(MockTx)
+	service := NewPrintRequestService(mockDB)
+	service.SetPricing(NewPricingService(testPricing, nil))
+	service.SetLedger(NewLedgerService(mockDB, config.BillingConfig{Enabled: true}, "EUR"))
+
+	mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+	mockTx.On("GetPrintRequest", ctx, "req").Return(current, nil)
+	mockTx.On("UpdatePrintRequest", ctx, mock.Anything).Return(nil)
+	mockTx.On("CreatePrintRequestStatusEvent", ctx, mock.Anything).Return(nil)
+	mockTx.On("GetChargeByPrintRequestID", ctx, "req").Return(nil, nil)
+	mockTx.On("CreateCharge", ctx, mock.Anything).Return(errors.New("disk full"))
+	mockTx.On("Rollback").Return(nil)
+
+	// The request isn't done until its owner is charged for it
+	require.Error(t, service.UpdatePrintRequest(ctx, &updated))
+	mockTx.AssertCalled(t, "Rollback")
+	mockTx.AssertNotCalled(t, "Commit")
+}
@@ -0,0 +1,199 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// lockoutNoticeTimeout limits how long emailing a user that their account
+// was locked may take
+const lockoutNoticeTimeout = time.Minute
+
+// ErrAccountLocked is returned when logging in with a password to a username
+// that has had too many failed logins
+var ErrAccountLocked = errors.New("too many failed logins")
+
+// dummyPasswordHash is compared against when there is no password to check,
+// so that logging in takes as long whether or not the account exists
+var dummyPasswordHash = sync.OnceValue(func() []byte {
+	hash, err := bcrypt.GenerateFromPassword([]byte("not a real password"), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+	return hash
+})
+
+// checkDummyPassword takes as long as checking a real password, and fails
+func checkDummyPassword(password string) {
+	_ = bcrypt.CompareHashAndPassword(dummyPasswordHash(), []byte(password))
+}
+
+// LockoutService counts failed password logins to each username, delays
+// answering more of them, and locks the username after too many. Usernames
+// without accounts are treated the same, so responses do not reveal which
+// exist.
+type LockoutService struct {
+	db     database.DBClient
+	cfg    config.LockoutConfig
+	emails *EmailService
+	now    func() time.Time
+	sleep  func(ctx context.Context, d time.Duration)
+	logger *slog.Logger
+}
+
+// NewLockoutService creates a new lockout service
+func NewLockoutService(db database.DBClient, cfg config.LockoutConfig) *LockoutService {
+	return &LockoutService{
+		db:     db,
+		cfg:    cfg,
+		now:    time.Now,
+		sleep:  sleepContext,
+		logger: slog.Default(),
+	}
+}
+
+// SetNotifier emails users when their account is locked
+func (s *LockoutService) SetNotifier(emails *EmailService) {
+	s.emails = emails
+}
+
+// Check returns ErrAccountLocked if password logins to the username are
+// refused
+func (s *LockoutService) Check(ctx context.Context, username string) error {
+	attempts, err := s.db.GetLoginAttempts(ctx, lockoutKey(username))
+	if err != nil {
+		return err
+	}
+	if attempts != nil && attempts.IsLocked(s.now()) {
+		return ErrAccountLocked
+	}
+	return nil
+}
+
+// RecordFailure counts a failed login to the username, which belongs to the
+// user or, if it is nil, to no account. It locks the username after too many
+// failures, emailing the user, and otherwise waits longer the more logins
+// have failed before returning.
+func (s *LockoutService) RecordFailure(ctx context.Context, username string, user *models.User) error {
+	now := s.now()
+	attempts, err := s.db.RecordLoginFailure(ctx, lockoutKey(username), now, now.Add(-s.cfg.Duration))
+	if err != nil {
+		return err
+	}
+
+	if attempts.FailedCount < s.cfg.MaxAttempts {
+		s.sleep(ctx, s.delay(attempts.FailedCount))
+		return nil
+	}
+
+	until := now.Add(s.cfg.Duration)
+	locked, err := s.db.LockLogin(ctx, attempts.Username, until, now)
+	if err != nil {
+		return err
+	}
+	// Only the failure that locks the username sends an email
+	if locked && user != nil {
+		s.logger.Warn("locked account after failed logins", "user_id", user.ID, "failures", attempts.FailedCount, "until", until)
+		if s.emails != nil && user.Email != nil && *user.Email != "" {
+			s.notifyLocked(ctx, user, attempts.FailedCount, until)
+		}
+	}
+	return ErrAccountLocked
+}
+
+// notifyLocked emails the user that their account was locked. The email is
+// sent in the background, with its own deadline rather than the request's,
+// so that failed logins take as long whether or not the account exists and
+// the email is still sent once the response has been written.
+func (s *LockoutService) notifyLocked(ctx context.Context, user *models.User, failures int, until time.Time) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), lockoutNoticeTimeout)
+	go func() {
+		defer cancel()
+		if err := s.emails.SendLockoutNotice(ctx, user, failures, until); err != nil {
+			s.logger.Error("failed to send lockout email", "error", err, "user_id", user.ID)
+		}
+	}()
+}
+
+// RecordSuccess forgets failed logins to the username
+func (s *LockoutService) RecordSuccess(ctx context.Context, username string) error {
+	return s.db.DeleteLoginAttempts(ctx, lockoutKey(username))
+}
+
+// Status returns the failed logins to the username, or nil if there are none
+func (s *LockoutService) Status(ctx context.Context, username string) (*models.LoginAttempts, error) {
+	return s.db.GetLoginAttempts(ctx, lockoutKey(username))
+}
+
+// Unlock lets the user log in with their password again, e.g. when an admin
+// has confirmed who they are
+func (s *LockoutService) Unlock(ctx context.Context, username string) error {
+	return s.db.DeleteLoginAttempts(ctx, lockoutKey(username))
+}
+
+// SweepStale forgets usernames that have not failed to log in for longer than
+// failures are counted for
+func (s *LockoutService) SweepStale(ctx context.Context) (int64, error) {
+	return s.db.DeleteStaleLoginAttempts(ctx, s.now().Add(-s.cfg.Duration))
+}
+
+// RunSweeper forgets stale usernames every interval until ctx is done
+func (s *LockoutService) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.SweepStale(ctx)
+			if err != nil {
+				s.logger.Error("failed to delete stale login attempts", "error", err)
+				continue
+			}
+			if deleted > 0 {
+				s.logger.Info("deleted stale login attempts", "count", deleted)
+			}
+		}
+	}
+}
+
+// delay returns how long to wait before answering a failed login: nothing
+// after the first, then a second, doubling up to MaxDelay
+func (s *LockoutService) delay(failures int) time.Duration {
+	if failures <= 1 {
+		return 0
+	}
+	if failures-2 >= 30 {
+		return s.cfg.MaxDelay
+	}
+	return min(time.Second<<(failures-2), s.cfg.MaxDelay)
+}
+
+// lockoutKey returns the username failures are counted under
+func lockoutKey(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+// sleepContext waits for the duration, or until ctx is done
+func sleepContext(ctx context.Context, d time.Duration) {
+	if d <= 0 {
+		return
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
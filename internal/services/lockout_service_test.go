@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/mailer"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// channelMailer passes sent messages to a channel
+type channelMailer chan mailer.Message
+
+func (m channelMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m <- msg
+	return nil
+}
+
+// blockingMailer passes the context of each message sent to a channel, then
+// waits until it is closed
+type blockingMailer struct {
+	sending chan context.Context
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(ctx context.Context, msg mailer.Message) error {
+	m.sending <- ctx
+	<-m.release
+	return nil
+}
+
+func newTestLockoutService(db *MockDBClient) (*LockoutService, *[]time.Duration) {
+	service := NewLockoutService(db, config.LockoutConfig{
+		Enabled:     true,
+		MaxAttempts: 5,
+		Duration:    15 * time.Minute,
+		MaxDelay:    8 * time.Second,
+	})
+	now := time.Now()
+	service.now = func() time.Time { return now }
+	var slept []time.Duration
+	service.sleep = func(ctx context.Context, d time.Duration) { slept = append(slept, d) }
+	return service, &slept
+}
+
+func TestLockoutDelay(t *testing.T) {
+	service, _ := newTestLockoutService(new(MockDBClient))
+
+	expected := map[int]time.Duration{
+		1:  0,
+		2:  time.Second,
+		3:  2 * time.Second,
+		4:  4 * time.Second,
+		5:  8 * time.Second,
+		6:  8 * time.Second,
+		64: 8 * time.Second,
+	}
+	for failures, delay := range expected {
+		assert.Equal(t, delay, service.delay(failures), "after %d failures", failures)
+	}
+}
+
+func TestLockoutRecordFailure(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	service, slept := newTestLockoutService(mockDB)
+	sent := make(channelMailer, 1)
+	service.SetNotifier(NewEmailService(mockDB, sent))
+	now := service.now()
+	since := now.Add(-15 * time.Minute)
+	until := now.Add(15 * time.Minute)
+	user := newTestUser(t, "alice@example.com")
+
+	// Failures before the limit are delayed
+	mockDB.On("RecordLoginFailure", ctx, "alice", now, since).Return(&models.LoginAttempts{Username: "alice", FailedCount: 3}, nil).Once()
+	assert.NoError(t, service.RecordFailure(ctx, " Alice", user))
+	assert.Equal(t, []time.Duration{2 * time.Second}, *slept)
+
+	// Reaching the limit locks the username and tells the user, once
+	mockDB.On("RecordLoginFailure", ctx, "alice", now, since).Return(&models.LoginAttempts{Username: "alice", FailedCount: 5}, nil)
+	mockDB.On("LockLogin", ctx, "alice", until, now).Return(true, nil).Once()
+	assert.ErrorIs(t, service.RecordFailure(ctx, "alice", user), ErrAccountLocked)
+	select {
+	case msg := <-sent:
+		assert.Equal(t, "alice@example.com", msg.To)
+		assert.Contains(t, msg.Body, "5 failed attempts")
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a lockout email")
+	}
+
+	mockDB.On("LockLogin", ctx, "alice", until, now).Return(false, nil)
+	assert.ErrorIs(t, service.RecordFailure(ctx, "alice", user), ErrAccountLocked)
+	select {
+	case msg := <-sent:
+		t.Errorf("Expected one lockout email, got another: %+v", msg)
+	case <-time.After(50 * time.Millisecond):
+	}
+	assert.Len(t, *slept, 1)
+}
+
+func TestLockoutNoticeDoesNotDelayResponse(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	mockDB := new(MockDBClient)
+	service, _ := newTestLockoutService(mockDB)
+	m := &blockingMailer{sending: make(chan context.Context, 1), release: make(chan struct{})}
+	defer close(m.release)
+	service.SetNotifier(NewEmailService(mockDB, m))
+	now := service.now()
+	user := newTestUser(t, "alice@example.com")
+
+	mockDB.On("RecordLoginFailure", ctx, "alice", now, now.Add(-15*time.Minute)).Return(&models.LoginAttempts{Username: "alice", FailedCount: 5}, nil)
+	mockDB.On("LockLogin", ctx, "alice", now.Add(15*time.Minute), now).Return(true, nil)
+
+	// The failed login is answered while the email is still being sent
+	done := make(chan error, 1)
+	go func() { done <- service.RecordFailure(ctx, "alice", user) }()
+	select {
+	case err := <-done:
+		assert.ErrorIs(t, err, ErrAccountLocked)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the failed login to be answered without waiting for the email")
+	}
+
+	// and the email outlives the request, but not forever
+	var sendCtx context.Context
+	select {
+	case sendCtx = <-m.sending:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected a lockout email")
+	}
+	cancel()
+	assert.NoError(t, sendCtx.Err())
+	deadline, ok := sendCtx.Deadline()
+	require.True(t, ok, "Expected the email to have a deadline")
+	assert.WithinDuration(t, time.Now().Add(lockoutNoticeTimeout), deadline, 5*time.Second)
+}
+
+func TestAuthenticateUserLockout(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	lockout, _ := newTestLockoutService(mockDB)
+	service := NewUserService(mockDB)
+	service.SetLockout(lockout)
+	now := lockout.now()
+	user := newTestUser(t, "bob@example.com")
+	user.Username = "bob"
+
+	// Locked usernames are refused even with the right password
+	lockedUntil := now.Add(time.Minute)
+	mockDB.On("GetLoginAttempts", ctx, "bob").Return(&models.LoginAttempts{Username: "bob", FailedCount: 5, LockedUntil: &lockedUntil}, nil).Once()
+	_, err := service.AuthenticateUser(ctx, "bob", "password123")
+	assert.ErrorIs(t, err, ErrAccountLocked)
+	mockDB.AssertNotCalled(t, "GetUserByUsername", mock.Anything, mock.Anything)
+
+	// Unknown usernames are counted like known ones
+	mockDB.On("GetLoginAttempts", ctx, "nobody").Return(nil, nil)
+	mockDB.On("GetUserByUsername", ctx, "nobody").Return(nil, nil)
+	mockDB.On("RecordLoginFailure", ctx, "nobody", now, mock.Anything).Return(&models.LoginAttempts{Username: "nobody", FailedCount: 1}, nil)
+	_, err = service.AuthenticateUser(ctx, "nobody", "password123")
+	assert.EqualError(t, err, "invalid credentials")
+
+	// Logging in forgets failures
+	mockDB.On("GetLoginAttempts", ctx, "bob").Return(&models.LoginAttempts{Username: "bob", FailedCount: 2}, nil)
+	mockDB.On("GetUserByUsername", ctx, "bob").Return(user, nil)
+	mockDB.On("DeleteLoginAttempts", ctx, "bob").Return(nil)
+	got, err := service.AuthenticateUser(ctx, "bob", "password123")
+	require.NoError(t, err)
+	assert.Equal(t, user.ID, got.ID)
+	mockDB.AssertCalled(t, "DeleteLoginAttempts", ctx, "bob")
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"math"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/models"
+)
+
+// Quote is the cost breakdown of a print
+type Quote struct {
+	Currency     string  `json:"currency"`
+	Grams        float64 `json:"grams"`
+	Hours        float64 `json:"hours"`
+	PricePerGram float64 `json:"price_per_gram"`
+	MaterialCost float64 `json:"material_cost"`
+	MachineCost  float64 `json:"machine_cost"`
+	HandlingFee  float64 `json:"handling_fee"`
+	Total        float64 `json:"total"`
+}
+
+// PricingService prices print requests from filament usage and print time
+type PricingService struct {
+	config    config.PricingConfig
+	inventory InventoryProvider
+	logger    *slog.Logger
+}
+
+// NewPricingService creates a new pricing service. The inventory is used to
+// look up filament prices and may be nil.
+func NewPricingService(cfg config.PricingConfig, inventory InventoryProvider) *PricingService {
+	return &PricingService{
+		config:    cfg,
+		inventory: inventory,
+		logger:    slog.Default(),
+	}
+}
+
+// Quote prices a print using the given spool's filament
+func (s *PricingService) Quote(ctx context.Context, spoolID *int, grams, hours float64) Quote {
+	pricePerGram := s.PricePerGram(ctx, spoolID)
+
+	quote := Quote{
+		Currency:     s.config.Currency,
+		Grams:        grams,
+		Hours:        hours,
+		PricePerGram: pricePerGram,
+		MaterialCost: roundCents(grams * pricePerGram),
+		MachineCost:  roundCents(hours * s.config.MachineHourRate),
+		HandlingFee:  roundCents(s.config.HandlingFee),
+	}
+	quote.Total = roundCents(quote.MaterialCost + quote.MachineCost + quote.HandlingFee)
+	return quote
+}
+
+// PricePerGram returns the filament price per gram of a spool. The spool's own
+// price is preferred, then its filament's, then the configured default.
+func (s *PricingService) PricePerGram(ctx context.Context, spoolID *int) float64 {
+	fallback := s.config.DefaultPricePerKg / 1000
+	if spoolID == nil || s.inventory == nil {
+		return fallback
+	}
+
+	spool, err := s.inventory.GetSpool(ctx, *spoolID)
+	if err != nil {
+		s.logger.Warn("failed to get spool for pricing, using default price", "spool_id", *spoolID, "error", err)
+		return fallback
+	}
+
+	if spool.Price > 0 && spool.InitialWeight > 0 {
+		return float64(spool.Price) / float64(spool.InitialWeight)
+	}
+	if spool.Filament.Price > 0 && spool.Filament.Weight > 0 {
+		return float64(spool.Filament.Price) / float64(spool.Filament.Weight)
+	}
+	return fallback
+}
+
+// Estimate sets the estimated cost of a request from its estimated usage.
+// Requests without any estimate are left unpriced.
+func (s *PricingService) Estimate(ctx context.Context, request *models.PrintRequest) {
+	if request.EstimatedGrams == nil && request.EstimatedHours == nil {
+		request.EstimatedCost = nil
+		return
+	}
+
+	quote := s.Quote(ctx, request.SpoolID, valueOrZero(request.EstimatedGrams), valueOrZero(request.EstimatedHours))
+	request.EstimatedCost = &quote.Total
+}
+
+// Finalize sets the actual cost of a completed request from its recorded
+// usage. Usage that was not recorded is taken from the estimate.
+func (s *PricingService) Finalize(ctx context.Context, request *models.PrintRequest) {
+	if request.ActualGrams == nil && request.EstimatedGrams != nil {
+		grams := *request.EstimatedGrams
+		request.ActualGrams = &grams
+	}
+	if request.ActualHours == nil && request.EstimatedHours != nil {
+		hours := *request.EstimatedHours
+		request.ActualHours = &hours
+	}
+	if request.ActualGrams == nil && request.ActualHours == nil {
+		request.ActualCost = nil
+		return
+	}
+
+	quote := s.Quote(ctx, request.SpoolID, valueOrZero(request.ActualGrams), valueOrZero(request.ActualHours))
+	request.ActualCost = &quote.Total
+}
+
+// roundCents rounds an amount to two decimal places
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// valueOrZero dereferences an optional number
+func valueOrZero(value *float64) float64 {
+	if value == nil {
+		return 0
+	}
+	return *value
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/spoolman"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockInventoryProvider is a mock implementation of InventoryProvider
+type MockInventoryProvider struct {
+	mock.Mock
+}
+
+func (m *MockInventoryProvider) GetSpool(ctx context.Context, id int) (*spoolman.Spool, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*spoolman.Spool), args.Error(1)
+}
+func (m *MockInventoryProvider) GetSpools(ctx context.Context) ([]spoolman.Spool, error) {
+	return nil, nil
+}
+func (m *MockInventoryProvider) GetFilament(ctx context.Context, id int) (*spoolman.Filament, error) {
+	return nil, nil
+}
+func (m *MockInventoryProvider) GetFilaments(ctx context.Context) ([]spoolman.Filament, error) {
+	return nil, nil
+}
+func (m *MockInventoryProvider) GetMaterials(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+func (m *MockInventoryProvider) GetVendors(ctx context.Context) ([]spoolman.Vendor, error) {
+	return nil, nil
+}
+func (m *MockInventoryProvider) GetLocations(ctx context.Context) ([]string, error) {
+	return nil, nil
+}
+
+var testPricing = config.PricingConfig{
+	Currency:          "EUR",
+	MachineHourRate:   0.5,
+	HandlingFee:       1,
+	DefaultPricePerKg: 20,
+}
+
+func TestQuote(t *testing.T) {
+	ctx := context.Background()
+
+	inventory := new(MockInventoryProvider)
+	inventory.On("GetSpool", ctx, 1).Return(&spoolman.Spool{Id: 1, Price: 30, InitialWeight: 1000}, nil)
+	inventory.On("GetSpool", ctx, 2).Return(&spoolman.Spool{Id: 2, Filament: spoolman.Filament{Price: 25, Weight: 500}}, nil)
+	inventory.On("GetSpool", ctx, 3).Return(&spoolman.Spool{Id: 3}, nil)
+	inventory.On("GetSpool", ctx, 4).Return(nil, errors.New("spoolman unavailable"))
+	service := NewPricingService(testPricing, inventory)
+
+	tests := []struct {
+		name         string
+		spoolID      *int
+		pricePerGram float64
+		total        float64
+	}{
+		{name: "spool price", spoolID: intPtr(1), pricePerGram: 0.03, total: 6},       // 100g × 0.03 + 4h × 0.5 + 1
+		{name: "filament price", spoolID: intPtr(2), pricePerGram: 0.05, total: 8},    // 100g × 0.05 + 2 + 1
+		{name: "unpriced spool", spoolID: intPtr(3), pricePerGram: 0.02, total: 5},    // 100g × 0.02 + 2 + 1
+		{name: "inventory failure", spoolID: intPtr(4), pricePerGram: 0.02, total: 5}, // falls back to the default
+		{name: "no spool", spoolID: nil, pricePerGram: 0.02, total: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			quote := service.Quote(ctx, tt.spoolID, 100, 4)
+			assert.Equal(t, "EUR", quote.Currency)
+			assert.InDelta(t, tt.pricePerGram, quote.PricePerGram, 1e-9)
+			assert.Equal(t, 2.0, quote.MachineCost)
+			assert.Equal(t, 1.0, quote.HandlingFee)
+			assert.Equal(t, tt.total, quote.Total)
+		})
+	}
+}
+
+func TestEstimateAndFinalize(t *testing.T) {
+	ctx := context.Background()
+	service := NewPricingService(testPricing, nil)
+
+	// Requests without estimates are not priced
+	request := &models.PrintRequest{ID: "req"}
+	service.Estimate(ctx, request)
+	assert.Nil(t, request.EstimatedCost)
+
+	grams, hours := 250.0, 10.0
+	request.EstimatedGrams = &grams
+	request.EstimatedHours = &hours
+	service.Estimate(ctx, request)
+	require.NotNil(t, request.EstimatedCost)
+	assert.Equal(t, 11.0, *request.EstimatedCost) // 250g × 0.02 + 10h × 0.5 + 1
+
+	// Recorded usage is used where available, the estimate otherwise
+	used := 300.0
+	request.ActualGrams = &used
+	service.Finalize(ctx, request)
+	require.NotNil(t, request.ActualCost)
+	require.NotNil(t, request.ActualHours)
+	assert.Equal(t, 10.0, *request.ActualHours)
+	assert.Equal(t, 12.0, *request.ActualCost)
+}
+
+func TestUpdatePrintRequestRecordsActualCost(t *testing.T) {
+	ctx := context.Background()
+	grams, used := 100.0, 150.0
+
+	current := &models.PrintRequest{ID: "req", Status: models.StatusInProgress, EstimatedGrams: &grams}
+	updated := *current
+	updated.Status = models.StatusDone
+	updated.ActualGrams = &used
+
+	mockDB := new(MockDBClient)
+	mockTx := new(MockTx)
+	service := NewPrintRequestService(mockDB)
+	service.SetPricing(NewPricingService(testPricing, nil))
+
+	mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+	mockTx.On("GetPrintRequest", ctx, "req").Return(current, nil)
+	mockTx.On("UpdatePrintRequest", ctx, mock.MatchedBy(func(req *models.PrintRequest) bool {
+		return req.ActualCost != nil && *req.ActualCost == 4 // 150g × 0.02 + 1
+	})).Return(nil)
+	mockTx.On("CreatePrintRequestStatusEvent", ctx, mock.Anything).Return(nil)
+	mockTx.On("Commit").Return(nil)
+
+	assert.NoError(t, service.UpdatePrintRequest(ctx, &updated))
+	mockTx.AssertExpectations(t)
+}
+
+func intPtr(i int) *int {
+	return &i
+}
@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"time"
@@ -10,10 +11,20 @@ import (
 	"github.com/bjschafer/print-dis/internal/models"
 )
 
+// SpoolUsageRecorder records which printer and print requests used a spool,
+// e.g. in Spoolman
+type SpoolUsageRecorder interface {
+	RecordSpoolUsage(ctx context.Context, spoolID int, printerName, requestID string) error
+}
+
 // PrintRequestService handles business logic for print requests
 type PrintRequestService struct {
-	db     database.DBClient
-	logger *slog.Logger
+	db            database.DBClient
+	logger        *slog.Logger
+	spoolRecorder SpoolUsageRecorder
+	pricing       *PricingService
+	ledger        *LedgerService
+	quotas        *QuotaService
 }
 
 // NewPrintRequestService creates a new print request service
@@ -24,6 +35,30 @@ func NewPrintRequestService(db database.DBClient) *PrintRequestService {
 	}
 }
 
+// SetSpoolUsageRecorder registers where spool usage is recorded when requests
+// start printing or complete
+func (s *PrintRequestService) SetSpoolUsageRecorder(recorder SpoolUsageRecorder) {
+	s.spoolRecorder = recorder
+}
+
+// SetPricing enables estimating the cost of requests when they are submitted
+// and recording their actual cost once they are done
+func (s *PrintRequestService) SetPricing(pricing *PricingService) {
+	s.pricing = pricing
+}
+
+// SetLedger enables charging users for completed requests, and holding their
+// requests while they owe money if the ledger is configured to
+func (s *PrintRequestService) SetLedger(ledger *LedgerService) {
+	s.ledger = ledger
+}
+
+// SetQuotas enables rejecting submissions that would take their owner over
+// their quotas
+func (s *PrintRequestService) SetQuotas(quotas *QuotaService) {
+	s.quotas = quotas
+}
+
 // CreatePrintRequest creates a new print request
 func (s *PrintRequestService) CreatePrintRequest(ctx context.Context, request *models.PrintRequest) error {
 	// Set timestamps
@@ -36,20 +71,54 @@ func (s *PrintRequestService) CreatePrintRequest(ctx context.Context, request *m
 		request.Status = models.StatusPendingApproval
 	}
 
+	if s.pricing != nil {
+		s.pricing.Estimate(ctx, request)
+	}
+
 	s.logger.Info("creating print request in database",
 		"id", request.ID,
 		"user_id", request.UserID,
 		"status", request.Status.String(),
 	)
 
-	if err := s.db.CreatePrintRequest(ctx, request); err != nil {
+	var err error
+	if s.quotas != nil {
+		err = s.createWithinQuota(ctx, request)
+	} else {
+		err = s.db.CreatePrintRequest(ctx, request)
+	}
+	if err != nil && !errors.Is(err, ErrQuotaExceeded) {
 		s.logger.Error("failed to create print request in database",
 			"error", err,
 			"id", request.ID,
 		)
-		return err
 	}
+	return err
+}
 
+// createWithinQuota creates a print request in the same transaction that
+// checks it against its owner's quotas, so that concurrent submissions can't
+// all pass the check
+func (s *PrintRequestService) createWithinQuota(ctx context.Context, request *models.PrintRequest) (err error) {
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = s.quotas.Check(ctx, tx, request); err != nil {
+		return err
+	}
+	if err = tx.CreatePrintRequest(ctx, request); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
 	return nil
 }
 
@@ -130,12 +199,13 @@ func (s *PrintRequestService) UpdatePrintRequest(ctx context.Context, request *m
 		return fmt.Errorf("failed to get current print request: %w", err)
 	}
 	if currentRequest == nil {
-		return fmt.Errorf("print request not found: %s", request.ID)
+		err = fmt.Errorf("print request not found: %s", request.ID)
+		return err
 	}
 
 	// Validate status transition if status is being changed
 	if currentRequest.Status != request.Status {
-		if err := s.validateStatusTransition(currentRequest.Status, request.Status); err != nil {
+		if err = s.validateStatusTransition(currentRequest.Status, request.Status); err != nil {
 			s.logger.Warn("invalid status transition",
 				"id", request.ID,
 				"current_status", currentRequest.Status.String(),
@@ -146,6 +216,44 @@ func (s *PrintRequestService) UpdatePrintRequest(ctx context.Context, request *m
 		}
 	}
 
+	// The owner of a request never changes
+	request.UserID = currentRequest.UserID
+
+	// Raising the estimates of a request uses more of its owner's quotas
+	if s.quotas != nil {
+		if err = s.quotas.CheckUpdate(ctx, tx, currentRequest, request); err != nil {
+			return err
+		}
+	}
+
+	// Requests may be held until their owner has paid what they owe
+	if s.ledger != nil && currentRequest.Status == models.StatusPendingApproval && request.Status == models.StatusEnqueued {
+		if err = s.ledger.CheckApproval(ctx, request.UserID); err != nil {
+			s.logger.Info("holding print request until balance is paid", "id", request.ID, "user_id", request.UserID)
+			return err
+		}
+	}
+
+	// Picking a different spool resolves an earlier "spool unavailable" flag
+	if !sameID(currentRequest.SpoolID, request.SpoolID) {
+		request.SpoolNeedsReplacement = false
+	}
+
+	// Make sure a newly assigned printer exists
+	var printer *models.Printer
+	if request.PrinterID != nil {
+		printer, err = tx.GetPrinter(ctx, *request.PrinterID)
+		if err != nil {
+			return fmt.Errorf("failed to get printer: %w", err)
+		}
+		if printer == nil {
+			err = fmt.Errorf("printer not found: %d", *request.PrinterID)
+			return err
+		}
+	}
+
+	s.updateCost(ctx, currentRequest, request)
+
 	// Update timestamp
 	request.UpdatedAt = time.Now()
 
@@ -157,7 +265,7 @@ func (s *PrintRequestService) UpdatePrintRequest(ctx context.Context, request *m
 	)
 
 	// Update within the transaction
-	if err := tx.UpdatePrintRequest(ctx, request); err != nil {
+	if err = tx.UpdatePrintRequest(ctx, request); err != nil {
 		s.logger.Error("failed to update print request in database",
 			"error", err,
 			"id", request.ID,
@@ -165,14 +273,111 @@ func (s *PrintRequestService) UpdatePrintRequest(ctx context.Context, request *m
 		return err
 	}
 
+	// Keep the status history for analytics
+	if currentRequest.Status != request.Status {
+		if err = tx.CreatePrintRequestStatusEvent(ctx, &models.PrintRequestStatusEvent{
+			PrintRequestID: request.ID,
+			FromStatus:     &currentRequest.Status,
+			ToStatus:       request.Status,
+			CreatedAt:      request.UpdatedAt,
+		}); err != nil {
+			s.logger.Error("failed to record print request status change",
+				"error", err,
+				"id", request.ID,
+			)
+			return err
+		}
+	}
+
+	if err = s.chargeRequest(ctx, tx, currentRequest, request); err != nil {
+		return err
+	}
+
 	// Commit the transaction
-	if err := tx.Commit(); err != nil {
+	if err = tx.Commit(); err != nil {
 		return fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	s.recordSpoolUsage(ctx, currentRequest, request, printer)
+
 	return nil
 }
 
+// updateCost re-estimates a request whose spool or estimated usage changed,
+// and records its actual cost once it is done
+func (s *PrintRequestService) updateCost(ctx context.Context, previous, request *models.PrintRequest) {
+	if s.pricing == nil {
+		return
+	}
+
+	if !sameID(previous.SpoolID, request.SpoolID) ||
+		!sameAmount(previous.EstimatedGrams, request.EstimatedGrams) ||
+		!sameAmount(previous.EstimatedHours, request.EstimatedHours) {
+		s.pricing.Estimate(ctx, request)
+	}
+
+	if request.Status != models.StatusDone {
+		return
+	}
+	if previous.Status != models.StatusDone ||
+		!sameID(previous.SpoolID, request.SpoolID) ||
+		!sameAmount(previous.ActualGrams, request.ActualGrams) ||
+		!sameAmount(previous.ActualHours, request.ActualHours) {
+		s.pricing.Finalize(ctx, request)
+	}
+}
+
+// chargeRequest charges the owner of a request that was completed or whose
+// actual cost changed, within the transaction updating the request
+func (s *PrintRequestService) chargeRequest(ctx context.Context, tx database.Tx, previous, request *models.PrintRequest) error {
+	if s.ledger == nil || request.Status != models.StatusDone || request.ActualCost == nil {
+		return nil
+	}
+	if previous.Status == models.StatusDone && sameAmount(previous.ActualCost, request.ActualCost) {
+		return nil
+	}
+
+	if err := s.ledger.ChargeRequest(ctx, tx, request); err != nil {
+		s.logger.Error("failed to charge print request",
+			"error", err,
+			"id", request.ID,
+			"user_id", request.UserID,
+		)
+		return fmt.Errorf("failed to charge print request: %w", err)
+	}
+	return nil
+}
+
+// recordSpoolUsage reports the spool of a request that started printing or
+// completed, or whose spool or printer changed while printing. Failures are
+// only logged, since the request itself was already updated.
+func (s *PrintRequestService) recordSpoolUsage(ctx context.Context, previous, request *models.PrintRequest, printer *models.Printer) {
+	if s.spoolRecorder == nil || request.SpoolID == nil {
+		return
+	}
+	if request.Status != models.StatusInProgress && request.Status != models.StatusDone {
+		return
+	}
+	if previous.Status == request.Status &&
+		sameID(previous.SpoolID, request.SpoolID) &&
+		sameID(previous.PrinterID, request.PrinterID) {
+		return
+	}
+
+	printerName := ""
+	if printer != nil {
+		printerName = printer.Name
+	}
+
+	if err := s.spoolRecorder.RecordSpoolUsage(ctx, *request.SpoolID, printerName, request.ID); err != nil {
+		s.logger.Warn("failed to record spool usage",
+			"error", err,
+			"id", request.ID,
+			"spool_id", *request.SpoolID,
+		)
+	}
+}
+
 // DeletePrintRequest deletes a print request
 func (s *PrintRequestService) DeletePrintRequest(ctx context.Context, id string) error {
 	s.logger.Info("deleting print request from database", "id", id)
@@ -227,3 +432,74 @@ func (s *PrintRequestService) ListPrintRequestsByUserID(ctx context.Context, use
 
 	return requests, nil
 }
+
+// ListPrintRequestsByGroupID retrieves all print requests submitted to a group
+func (s *PrintRequestService) ListPrintRequestsByGroupID(ctx context.Context, groupID string) ([]*models.PrintRequest, error) {
+	requests, err := s.db.ListPrintRequestsByGroupID(ctx, groupID)
+	if err != nil {
+		s.logger.Error("failed to retrieve print requests for group",
+			"error", err,
+			"group_id", groupID,
+		)
+		return nil, err
+	}
+
+	return requests, nil
+}
+
+// FlagSpoolUnavailable marks every open print request using the given spool as
+// needing a replacement spool. It returns the number of requests flagged.
+func (s *PrintRequestService) FlagSpoolUnavailable(ctx context.Context, spoolID int) (int, error) {
+	requests, err := s.db.ListPrintRequestsBySpoolID(ctx, spoolID)
+	if err != nil {
+		s.logger.Error("failed to retrieve print requests for spool",
+			"error", err,
+			"spool_id", spoolID,
+		)
+		return 0, err
+	}
+
+	flagged := 0
+	for _, request := range requests {
+		if request.Status == models.StatusDone || request.SpoolNeedsReplacement {
+			continue
+		}
+
+		request.SpoolNeedsReplacement = true
+		request.UpdatedAt = time.Now()
+		if err := s.db.UpdatePrintRequest(ctx, request); err != nil {
+			s.logger.Error("failed to flag print request for spool replacement",
+				"error", err,
+				"id", request.ID,
+				"spool_id", spoolID,
+			)
+			return flagged, err
+		}
+		flagged++
+	}
+
+	if flagged > 0 {
+		s.logger.Info("flagged print requests for spool replacement",
+			"spool_id", spoolID,
+			"count", flagged,
+		)
+	}
+
+	return flagged, nil
+}
+
+// sameID reports whether two optional IDs refer to the same record
+func sameID(a, b *int) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// sameAmount reports whether two optional amounts are equal
+func sameAmount(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
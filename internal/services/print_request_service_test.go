@@ -48,6 +48,14 @@ func (m *MockTx) GetUser(ctx context.Context, id string) (*models.User, error) {
 	return args.Get(0).(*models.User), args.Error(1)
 }
 
+func (m *MockTx) LockUser(ctx context.Context, id string) (*models.User, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.User), args.Error(1)
+}
+
 func (m *MockTx) GetUserByUsername(ctx context.Context, username string) (*models.User, error) {
 	args := m.Called(ctx, username)
 	if args.Get(0) == nil {
@@ -69,6 +77,43 @@ func (m *MockTx) UpdateUser(ctx context.Context, user *models.User) error {
 	return args.Error(0)
 }
 
+func (m *MockTx) ReassignUserRecords(ctx context.Context, fromUserID, toUserID string) (int64, error) {
+	args := m.Called(ctx, fromUserID, toUserID)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockTx) DeleteUser(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+// OIDC identity operations
+func (m *MockTx) CreateOIDCIdentity(ctx context.Context, identity *models.UserOIDCIdentity) error {
+	args := m.Called(ctx, identity)
+	return args.Error(0)
+}
+
+// LDAP identity operations
+func (m *MockTx) CreateLDAPIdentity(ctx context.Context, identity *models.UserLDAPIdentity) error {
+	args := m.Called(ctx, identity)
+	return args.Error(0)
+}
+
+// Group operations
+func (m *MockTx) SetGroupMembership(ctx context.Context, membership *models.GroupMembership) error {
+	args := m.Called(ctx, membership)
+	return args.Error(0)
+}
+
+// Invitation operations
+func (m *MockTx) UseInvitation(ctx context.Context, codeHash string, now time.Time) (*models.Invitation, error) {
+	args := m.Called(ctx, codeHash, now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Invitation), args.Error(1)
+}
+
 // PrintRequest operations
 func (m *MockTx) CreatePrintRequest(ctx context.Context, request *models.PrintRequest) error {
 	args := m.Called(ctx, request)
@@ -83,11 +128,50 @@ func (m *MockTx) GetPrintRequest(ctx context.Context, id string) (*models.PrintR
 	return args.Get(0).(*models.PrintRequest), args.Error(1)
 }
 
+func (m *MockTx) ListPrintRequestsByUserID(ctx context.Context, userID string) ([]*models.PrintRequest, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.PrintRequest), args.Error(1)
+}
+
 func (m *MockTx) UpdatePrintRequest(ctx context.Context, request *models.PrintRequest) error {
 	args := m.Called(ctx, request)
 	return args.Error(0)
 }
 
+func (m *MockTx) CreatePrintRequestStatusEvent(ctx context.Context, event *models.PrintRequestStatusEvent) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+func (m *MockTx) GetPrinter(ctx context.Context, id int) (*models.Printer, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Printer), args.Error(1)
+}
+
+func (m *MockTx) CreateCharge(ctx context.Context, charge *models.Charge) error {
+	args := m.Called(ctx, charge)
+	return args.Error(0)
+}
+
+func (m *MockTx) GetChargeByPrintRequestID(ctx context.Context, printRequestID string) (*models.Charge, error) {
+	args := m.Called(ctx, printRequestID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Charge), args.Error(1)
+}
+
+func (m *MockTx) UpdateCharge(ctx context.Context, charge *models.Charge) error {
+	args := m.Called(ctx, charge)
+	return args.Error(0)
+}
+
 func (m *MockDBClient) CreatePrintRequest(ctx context.Context, request *models.PrintRequest) error {
 	args := m.Called(ctx, request)
 	return args.Error(0)
@@ -124,6 +208,14 @@ func (m *MockDBClient) ListPrintRequestsByUserID(ctx context.Context, userID str
 	return args.Get(0).([]*models.PrintRequest), args.Error(1)
 }
 
+func (m *MockDBClient) ListPrintRequestsBySpoolID(ctx context.Context, spoolID int) ([]*models.PrintRequest, error) {
+	args := m.Called(ctx, spoolID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.PrintRequest), args.Error(1)
+}
+
 // Implement other required interface methods...
 func (m *MockDBClient) CreatePrinter(ctx context.Context, printer *models.Printer) error {
 	return nil
@@ -141,10 +233,15 @@ func (m *MockDBClient) ListPrinters(ctx context.Context) ([]*models.Printer, err
 	return nil, nil
 }
 func (m *MockDBClient) CreateFilament(ctx context.Context, filament *models.Filament) error {
-	return nil
+	args := m.Called(ctx, filament)
+	return args.Error(0)
 }
 func (m *MockDBClient) GetFilament(ctx context.Context, id int) (*models.Filament, error) {
-	return nil, nil
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Filament), args.Error(1)
 }
 func (m *MockDBClient) UpdateFilament(ctx context.Context, filament *models.Filament) error {
 	return nil
@@ -153,7 +250,37 @@ func (m *MockDBClient) DeleteFilament(ctx context.Context, id int) error {
 	return nil
 }
 func (m *MockDBClient) ListFilaments(ctx context.Context) ([]*models.Filament, error) {
-	return nil, nil
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Filament), args.Error(1)
+}
+func (m *MockDBClient) CreateSpool(ctx context.Context, spool *models.Spool) error {
+	args := m.Called(ctx, spool)
+	return args.Error(0)
+}
+func (m *MockDBClient) GetSpool(ctx context.Context, id int) (*models.Spool, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Spool), args.Error(1)
+}
+func (m *MockDBClient) UpdateSpool(ctx context.Context, spool *models.Spool) error {
+	args := m.Called(ctx, spool)
+	return args.Error(0)
+}
+func (m *MockDBClient) DeleteSpool(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+func (m *MockDBClient) ListSpools(ctx context.Context) ([]*models.Spool, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Spool), args.Error(1)
 }
 func (m *MockDBClient) CreateJob(ctx context.Context, job *models.Job) error {
 	return nil
@@ -174,7 +301,11 @@ func (m *MockDBClient) CreateMaterial(ctx context.Context, material *models.Mate
 	return nil
 }
 func (m *MockDBClient) GetMaterial(ctx context.Context, id int) (*models.Material, error) {
-	return nil, nil
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Material), args.Error(1)
 }
 func (m *MockDBClient) UpdateMaterial(ctx context.Context, material *models.Material) error {
 	return nil
@@ -183,7 +314,11 @@ func (m *MockDBClient) DeleteMaterial(ctx context.Context, id int) error {
 	return nil
 }
 func (m *MockDBClient) ListMaterials(ctx context.Context) ([]*models.Material, error) {
-	return nil, nil
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Material), args.Error(1)
 }
 
 // User operations
@@ -232,6 +367,491 @@ func (m *MockDBClient) Close() error {
 	return nil
 }
 
+// Billing operations
+func (m *MockDBClient) CreateCharge(ctx context.Context, charge *models.Charge) error {
+	args := m.Called(ctx, charge)
+	return args.Error(0)
+}
+func (m *MockDBClient) GetCharge(ctx context.Context, id int) (*models.Charge, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Charge), args.Error(1)
+}
+func (m *MockDBClient) GetChargeByPrintRequestID(ctx context.Context, printRequestID string) (*models.Charge, error) {
+	args := m.Called(ctx, printRequestID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Charge), args.Error(1)
+}
+func (m *MockDBClient) UpdateCharge(ctx context.Context, charge *models.Charge) error {
+	args := m.Called(ctx, charge)
+	return args.Error(0)
+}
+func (m *MockDBClient) ListChargesByUserID(ctx context.Context, userID string) ([]*models.Charge, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Charge), args.Error(1)
+}
+func (m *MockDBClient) CreatePayment(ctx context.Context, payment *models.Payment) error {
+	args := m.Called(ctx, payment)
+	return args.Error(0)
+}
+func (m *MockDBClient) ListPaymentsByUserID(ctx context.Context, userID string) ([]*models.Payment, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Payment), args.Error(1)
+}
+func (m *MockDBClient) GetBalance(ctx context.Context, userID string) (*models.Balance, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Balance), args.Error(1)
+}
+func (m *MockDBClient) ListBalances(ctx context.Context) ([]*models.Balance, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Balance), args.Error(1)
+}
+
+func (m *MockDBClient) CreateQuotaOverride(ctx context.Context, override *models.QuotaOverride) error {
+	args := m.Called(ctx, override)
+	return args.Error(0)
+}
+func (m *MockDBClient) GetQuotaOverride(ctx context.Context, scope models.QuotaScope, subject string) (*models.QuotaOverride, error) {
+	args := m.Called(ctx, scope, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.QuotaOverride), args.Error(1)
+}
+func (m *MockDBClient) UpdateQuotaOverride(ctx context.Context, override *models.QuotaOverride) error {
+	args := m.Called(ctx, override)
+	return args.Error(0)
+}
+func (m *MockDBClient) DeleteQuotaOverride(ctx context.Context, id int) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+func (m *MockDBClient) ListQuotaOverrides(ctx context.Context) ([]*models.QuotaOverride, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.QuotaOverride), args.Error(1)
+}
+
+func (m *MockDBClient) CreateGroup(ctx context.Context, group *models.Group) error {
+	args := m.Called(ctx, group)
+	return args.Error(0)
+}
+func (m *MockDBClient) GetGroup(ctx context.Context, id string) (*models.Group, error) {
+	args := m.Called(ctx, id)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.Group), args.Error(1)
+}
+func (m *MockDBClient) UpdateGroup(ctx context.Context, group *models.Group) error {
+	args := m.Called(ctx, group)
+	return args.Error(0)
+}
+func (m *MockDBClient) DeleteGroup(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+func (m *MockDBClient) ListGroups(ctx context.Context) ([]*models.Group, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Group), args.Error(1)
+}
+func (m *MockDBClient) SetGroupMembership(ctx context.Context, membership *models.GroupMembership) error {
+	args := m.Called(ctx, membership)
+	return args.Error(0)
+}
+func (m *MockDBClient) DeleteGroupMembership(ctx context.Context, groupID, userID string) error {
+	args := m.Called(ctx, groupID, userID)
+	return args.Error(0)
+}
+func (m *MockDBClient) ListGroupMembers(ctx context.Context, groupID string) ([]*models.GroupMembership, error) {
+	args := m.Called(ctx, groupID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.GroupMembership), args.Error(1)
+}
+func (m *MockDBClient) ListGroupMembershipsByUserID(ctx context.Context, userID string) ([]*models.GroupMembership, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.GroupMembership), args.Error(1)
+}
+func (m *MockDBClient) ListPrintRequestsByGroupID(ctx context.Context, groupID string) ([]*models.PrintRequest, error) {
+	args := m.Called(ctx, groupID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.PrintRequest), args.Error(1)
+}
+
+func (m *MockDBClient) CreateRole(ctx context.Context, role *models.RoleDefinition) error {
+	args := m.Called(ctx, role)
+	return args.Error(0)
+}
+func (m *MockDBClient) GetRole(ctx context.Context, name models.Role) (*models.RoleDefinition, error) {
+	args := m.Called(ctx, name)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.RoleDefinition), args.Error(1)
+}
+func (m *MockDBClient) UpdateRole(ctx context.Context, role *models.RoleDefinition) error {
+	args := m.Called(ctx, role)
+	return args.Error(0)
+}
+func (m *MockDBClient) DeleteRole(ctx context.Context, name models.Role) error {
+	args := m.Called(ctx, name)
+	return args.Error(0)
+}
+func (m *MockDBClient) ListRoles(ctx context.Context) ([]*models.RoleDefinition, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.RoleDefinition), args.Error(1)
+}
+
+// OIDC identity operations
+func (m *MockDBClient) CreateOIDCIdentity(ctx context.Context, identity *models.UserOIDCIdentity) error {
+	args := m.Called(ctx, identity)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) GetOIDCIdentity(ctx context.Context, providerName, subject string) (*models.UserOIDCIdentity, error) {
+	args := m.Called(ctx, providerName, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserOIDCIdentity), args.Error(1)
+}
+
+// LDAP identity operations
+func (m *MockDBClient) CreateLDAPIdentity(ctx context.Context, identity *models.UserLDAPIdentity) error {
+	args := m.Called(ctx, identity)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) GetLDAPIdentity(ctx context.Context, providerName, subject string) (*models.UserLDAPIdentity, error) {
+	args := m.Called(ctx, providerName, subject)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserLDAPIdentity), args.Error(1)
+}
+
+// API token operations
+func (m *MockDBClient) CreateAPIToken(ctx context.Context, token *models.APIToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) GetAPITokenByHash(ctx context.Context, tokenHash string) (*models.APIToken, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.APIToken), args.Error(1)
+}
+
+func (m *MockDBClient) ListAPITokensByUserID(ctx context.Context, userID string) ([]*models.APIToken, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.APIToken), args.Error(1)
+}
+
+func (m *MockDBClient) UpdateAPITokenLastUsed(ctx context.Context, id string, lastUsedAt time.Time) error {
+	args := m.Called(ctx, id, lastUsedAt)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) DeleteAPIToken(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) DeleteAPITokensByUserID(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+// User session operations
+func (m *MockDBClient) CreateUserSession(ctx context.Context, session *models.UserSession) error {
+	args := m.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) GetUserSessionByToken(ctx context.Context, tokenHash string) (*models.UserSession, error) {
+	args := m.Called(ctx, tokenHash)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserSession), args.Error(1)
+}
+
+func (m *MockDBClient) UpdateUserSession(ctx context.Context, session *models.UserSession) error {
+	args := m.Called(ctx, session)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) TouchUserSession(ctx context.Context, id string, lastSeenAt time.Time, ipAddress string) error {
+	args := m.Called(ctx, id, lastSeenAt, ipAddress)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) ListUserSessionsByUserID(ctx context.Context, userID string, now time.Time) ([]*models.UserSession, error) {
+	args := m.Called(ctx, userID, now)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.UserSession), args.Error(1)
+}
+
+func (m *MockDBClient) DeleteUserSession(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) DeleteUserSessionsByUserID(ctx context.Context, userID, exceptID string) error {
+	args := m.Called(ctx, userID, exceptID)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) DeleteExpiredUserSessions(ctx context.Context, now time.Time) (int64, error) {
+	args := m.Called(ctx, now)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+// Two-factor authentication operations
+func (m *MockDBClient) SaveUserTOTP(ctx context.Context, totp *models.UserTOTP) error {
+	args := m.Called(ctx, totp)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) GetUserTOTP(ctx context.Context, userID string) (*models.UserTOTP, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserTOTP), args.Error(1)
+}
+
+func (m *MockDBClient) UpdateUserTOTPCounter(ctx context.Context, userID string, counter int64) (bool, error) {
+	args := m.Called(ctx, userID, counter)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDBClient) DeleteUserTOTP(ctx context.Context, userID string) error {
+	args := m.Called(ctx, userID)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) ReplaceRecoveryCodes(ctx context.Context, userID string, codes []*models.RecoveryCode) error {
+	args := m.Called(ctx, userID, codes)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) UseRecoveryCode(ctx context.Context, userID, codeHash string, usedAt time.Time) (bool, error) {
+	args := m.Called(ctx, userID, codeHash, usedAt)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDBClient) CountUnusedRecoveryCodes(ctx context.Context, userID string) (int, error) {
+	args := m.Called(ctx, userID)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockDBClient) CreateWebAuthnCredential(ctx context.Context, credential *models.WebAuthnCredential) error {
+	args := m.Called(ctx, credential)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) GetWebAuthnCredential(ctx context.Context, credentialID string) (*models.WebAuthnCredential, error) {
+	args := m.Called(ctx, credentialID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.WebAuthnCredential), args.Error(1)
+}
+
+func (m *MockDBClient) ListWebAuthnCredentialsByUserID(ctx context.Context, userID string) ([]*models.WebAuthnCredential, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.WebAuthnCredential), args.Error(1)
+}
+
+func (m *MockDBClient) UpdateWebAuthnCredentialUsage(ctx context.Context, id string, signCount int64, lastUsedAt time.Time) error {
+	args := m.Called(ctx, id, signCount, lastUsedAt)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) DeleteWebAuthnCredential(ctx context.Context, id string) error {
+	args := m.Called(ctx, id)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) CreateEmailToken(ctx context.Context, token *models.EmailToken) error {
+	args := m.Called(ctx, token)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) UseEmailToken(ctx context.Context, purpose models.EmailTokenPurpose, tokenHash string, usedAt time.Time) (*models.EmailToken, error) {
+	args := m.Called(ctx, purpose, tokenHash, usedAt)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.EmailToken), args.Error(1)
+}
+
+func (m *MockDBClient) DeleteEmailTokensByUserID(ctx context.Context, userID string, purpose models.EmailTokenPurpose) error {
+	args := m.Called(ctx, userID, purpose)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) GetLoginAttempts(ctx context.Context, username string) (*models.LoginAttempts, error) {
+	args := m.Called(ctx, username)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.LoginAttempts), args.Error(1)
+}
+
+func (m *MockDBClient) RecordLoginFailure(ctx context.Context, username string, failedAt, since time.Time) (*models.LoginAttempts, error) {
+	args := m.Called(ctx, username, failedAt, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.LoginAttempts), args.Error(1)
+}
+
+func (m *MockDBClient) LockLogin(ctx context.Context, username string, until, now time.Time) (bool, error) {
+	args := m.Called(ctx, username, until, now)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDBClient) DeleteLoginAttempts(ctx context.Context, username string) error {
+	args := m.Called(ctx, username)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) DeleteStaleLoginAttempts(ctx context.Context, before time.Time) (int64, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockDBClient) CreateInvitation(ctx context.Context, invitation *models.Invitation) error {
+	args := m.Called(ctx, invitation)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) ListInvitations(ctx context.Context) ([]*models.Invitation, error) {
+	args := m.Called(ctx)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Invitation), args.Error(1)
+}
+
+func (m *MockDBClient) RevokeInvitation(ctx context.Context, id string, revokedAt time.Time) (bool, error) {
+	args := m.Called(ctx, id, revokedAt)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockDBClient) CreateAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+func (m *MockDBClient) ListAuditEvents(ctx context.Context, filter models.AuditEventFilter) ([]*models.AuditEvent, int, error) {
+	args := m.Called(ctx, filter)
+	if args.Get(0) == nil {
+		return nil, args.Int(1), args.Error(2)
+	}
+	return args.Get(0).([]*models.AuditEvent), args.Int(1), args.Error(2)
+}
+
+// Print request analytics
+func (m *MockDBClient) CountPrintRequestStatuses(ctx context.Context, r models.AnalyticsRange, bucket models.AnalyticsBucket) ([]*models.StatusCount, error) {
+	args := m.Called(ctx, r, bucket)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.StatusCount), args.Error(1)
+}
+
+func (m *MockDBClient) ListTurnarounds(ctx context.Context, r models.AnalyticsRange) ([]*models.Turnaround, error) {
+	args := m.Called(ctx, r)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.Turnaround), args.Error(1)
+}
+
+func (m *MockDBClient) SumMaterialUsage(ctx context.Context, r models.AnalyticsRange) ([]*models.MaterialUsage, error) {
+	args := m.Called(ctx, r)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.MaterialUsage), args.Error(1)
+}
+
+func (m *MockDBClient) SumPrinterUsage(ctx context.Context, r models.AnalyticsRange) ([]*models.PrinterUsage, error) {
+	args := m.Called(ctx, r)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.PrinterUsage), args.Error(1)
+}
+
+func (m *MockDBClient) ListTopRequesters(ctx context.Context, r models.AnalyticsRange, limit int) ([]*models.RequesterUsage, error) {
+	args := m.Called(ctx, r, limit)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.RequesterUsage), args.Error(1)
+}
+
+func (m *MockDBClient) GetUserPrintTotals(ctx context.Context, userID string) (*models.UserPrintTotals, error) {
+	args := m.Called(ctx, userID)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).(*models.UserPrintTotals), args.Error(1)
+}
+
+func (m *MockDBClient) ListUserMonthlyHistory(ctx context.Context, userID string, since time.Time) ([]*models.UserMonthStats, error) {
+	args := m.Called(ctx, userID, since)
+	if args.Get(0) == nil {
+		return nil, args.Error(1)
+	}
+	return args.Get(0).([]*models.UserMonthStats), args.Error(1)
+}
+
 // BeginTx starts a new transaction
 func (m *MockDBClient) BeginTx(ctx context.Context) (database.Tx, error) {
 	args := m.Called(ctx)
@@ -334,6 +954,12 @@ func TestPrintRequestStatusValidation(t *testing.T) {
 					return req.ID == testRequest.ID && req.Status == tt.newStatus
 				})).Return(nil)
 
+				// The status change is kept in the request's history
+				mockTx.On("CreatePrintRequestStatusEvent", ctx, mock.MatchedBy(func(event *models.PrintRequestStatusEvent) bool {
+					return event.PrintRequestID == testRequest.ID && event.FromStatus != nil &&
+						*event.FromStatus == tt.currentStatus && event.ToStatus == tt.newStatus
+				})).Return(nil)
+
 				// Set up transaction commit for valid transitions
 				mockTx.On("Commit").Return(nil)
 			}
@@ -393,3 +1019,132 @@ func TestPrintRequestStatusEnum(t *testing.T) {
 		})
 	}
 }
+
+func TestFlagSpoolUnavailable(t *testing.T) {
+	ctx := context.Background()
+	spoolID := 7
+
+	pending := &models.PrintRequest{ID: "pending", SpoolID: &spoolID, Status: models.StatusPendingApproval}
+	done := &models.PrintRequest{ID: "done", SpoolID: &spoolID, Status: models.StatusDone}
+	alreadyFlagged := &models.PrintRequest{ID: "flagged", SpoolID: &spoolID, Status: models.StatusEnqueued, SpoolNeedsReplacement: true}
+
+	mockDB := new(MockDBClient)
+	service := NewPrintRequestService(mockDB)
+
+	mockDB.On("ListPrintRequestsBySpoolID", ctx, spoolID).Return([]*models.PrintRequest{pending, done, alreadyFlagged}, nil)
+	mockDB.On("UpdatePrintRequest", ctx, mock.MatchedBy(func(req *models.PrintRequest) bool {
+		return req.ID == "pending" && req.SpoolNeedsReplacement
+	})).Return(nil).Once()
+
+	flagged, err := service.FlagSpoolUnavailable(ctx, spoolID)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, flagged)
+	assert.False(t, done.SpoolNeedsReplacement)
+	mockDB.AssertExpectations(t)
+}
+
+func TestUpdatePrintRequestClearsSpoolReplacement(t *testing.T) {
+	ctx := context.Background()
+	oldSpool, newSpool := 7, 8
+
+	current := &models.PrintRequest{ID: "req", SpoolID: &oldSpool, Status: models.StatusEnqueued, SpoolNeedsReplacement: true}
+	updated := *current
+	updated.SpoolID = &newSpool
+
+	mockDB := new(MockDBClient)
+	mockTx := new(MockTx)
+	service := NewPrintRequestService(mockDB)
+
+	mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+	mockTx.On("GetPrintRequest", ctx, "req").Return(current, nil)
+	mockTx.On("UpdatePrintRequest", ctx, mock.MatchedBy(func(req *models.PrintRequest) bool {
+		return *req.SpoolID == newSpool && !req.SpoolNeedsReplacement
+	})).Return(nil)
+	mockTx.On("Commit").Return(nil)
+
+	assert.NoError(t, service.UpdatePrintRequest(ctx, &updated))
+	mockDB.AssertExpectations(t)
+	mockTx.AssertExpectations(t)
+}
+
+// MockSpoolUsageRecorder is a mock implementation of SpoolUsageRecorder
+type MockSpoolUsageRecorder struct {
+	mock.Mock
+}
+
+func (m *MockSpoolUsageRecorder) RecordSpoolUsage(ctx context.Context, spoolID int, printerName, requestID string) error {
+	args := m.Called(ctx, spoolID, printerName, requestID)
+	return args.Error(0)
+}
+
+func TestUpdatePrintRequestRecordsSpoolUsage(t *testing.T) {
+	ctx := context.Background()
+	spoolID, printerID := 7, 3
+
+	tests := []struct {
+		name        string
+		current     models.PrintRequestStatus
+		next        models.PrintRequestStatus
+		expectCalls bool
+	}{
+		{name: "start printing", current: models.StatusEnqueued, next: models.StatusInProgress, expectCalls: true},
+		{name: "complete", current: models.StatusInProgress, next: models.StatusDone, expectCalls: true},
+		{name: "unchanged while printing", current: models.StatusInProgress, next: models.StatusInProgress, expectCalls: false},
+		{name: "approve", current: models.StatusPendingApproval, next: models.StatusEnqueued, expectCalls: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := &models.PrintRequest{ID: "req", SpoolID: &spoolID, PrinterID: &printerID, Status: tt.current}
+			updated := *current
+			updated.Status = tt.next
+
+			mockDB := new(MockDBClient)
+			mockTx := new(MockTx)
+			recorder := new(MockSpoolUsageRecorder)
+			service := NewPrintRequestService(mockDB)
+			service.SetSpoolUsageRecorder(recorder)
+
+			mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+			mockTx.On("GetPrintRequest", ctx, "req").Return(current, nil)
+			mockTx.On("GetPrinter", ctx, printerID).Return(&models.Printer{Id: printerID, Name: "Voron"}, nil)
+			mockTx.On("UpdatePrintRequest", ctx, mock.Anything).Return(nil)
+			if tt.current != tt.next {
+				mockTx.On("CreatePrintRequestStatusEvent", ctx, mock.Anything).Return(nil)
+			}
+			mockTx.On("Commit").Return(nil)
+			if tt.expectCalls {
+				recorder.On("RecordSpoolUsage", ctx, spoolID, "Voron", "req").Return(nil)
+			}
+
+			assert.NoError(t, service.UpdatePrintRequest(ctx, &updated))
+			recorder.AssertExpectations(t)
+			if !tt.expectCalls {
+				recorder.AssertNotCalled(t, "RecordSpoolUsage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestUpdatePrintRequestUnknownPrinter(t *testing.T) {
+	ctx := context.Background()
+	printerID := 99
+
+	current := &models.PrintRequest{ID: "req", Status: models.StatusEnqueued}
+	updated := *current
+	updated.PrinterID = &printerID
+
+	mockDB := new(MockDBClient)
+	mockTx := new(MockTx)
+	service := NewPrintRequestService(mockDB)
+
+	mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+	mockTx.On("GetPrintRequest", ctx, "req").Return(current, nil)
+	mockTx.On("GetPrinter", ctx, printerID).Return(nil, nil)
+	mockTx.On("Rollback").Return(nil)
+
+	err := service.UpdatePrintRequest(ctx, &updated)
+	assert.ErrorContains(t, err, "printer not found")
+	mockTx.AssertNotCalled(t, "UpdatePrintRequest", mock.Anything, mock.Anything)
+	mockTx.AssertExpectations(t)
+}
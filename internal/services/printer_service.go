@@ -0,0 +1,82 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+)
+
+// PrinterService handles business logic for printers
+type PrinterService struct {
+	db     database.DBClient
+	logger *slog.Logger
+}
+
+// NewPrinterService creates a new printer service
+func NewPrinterService(db database.DBClient) *PrinterService {
+	return &PrinterService{
+		db:     db,
+		logger: slog.Default(),
+	}
+}
+
+// ListPrinters retrieves all printers
+func (s *PrinterService) ListPrinters(ctx context.Context) ([]*models.Printer, error) {
+	printers, err := s.db.ListPrinters(ctx)
+	if err != nil {
+		s.logger.Error("failed to list printers", "error", err)
+		return nil, err
+	}
+	return printers, nil
+}
+
+// GetPrinter retrieves a printer by ID, returning nil if it does not exist
+func (s *PrinterService) GetPrinter(ctx context.Context, id int) (*models.Printer, error) {
+	printer, err := s.db.GetPrinter(ctx, id)
+	if err != nil {
+		s.logger.Error("failed to get printer", "error", err, "id", id)
+		return nil, err
+	}
+	return printer, nil
+}
+
+// CreatePrinter adds a new printer
+func (s *PrinterService) CreatePrinter(ctx context.Context, printer *models.Printer) error {
+	if err := s.db.CreatePrinter(ctx, printer); err != nil {
+		s.logger.Error("failed to create printer", "error", err, "name", printer.Name)
+		return err
+	}
+	s.logger.Info("created printer", "id", printer.Id, "name", printer.Name)
+	return nil
+}
+
+// UpdatePrinter updates an existing printer
+func (s *PrinterService) UpdatePrinter(ctx context.Context, printer *models.Printer) error {
+	existing, err := s.db.GetPrinter(ctx, printer.Id)
+	if err != nil {
+		return fmt.Errorf("failed to get printer: %w", err)
+	}
+	if existing == nil {
+		return fmt.Errorf("printer not found: %d", printer.Id)
+	}
+
+	if err := s.db.UpdatePrinter(ctx, printer); err != nil {
+		s.logger.Error("failed to update printer", "error", err, "id", printer.Id)
+		return err
+	}
+	s.logger.Info("updated printer", "id", printer.Id, "name", printer.Name)
+	return nil
+}
+
+// DeletePrinter removes a printer
+func (s *PrinterService) DeletePrinter(ctx context.Context, id int) error {
+	if err := s.db.DeletePrinter(ctx, id); err != nil {
+		s.logger.Error("failed to delete printer", "error", err, "id", id)
+		return err
+	}
+	s.logger.Info("deleted printer", "id", id)
+	return nil
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+)
+
+// ErrQuotaExceeded is matched by errors returned when a submission would
+// exceed one of its owner's quotas
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// QuotaViolation describes a single quota a submission would exceed
+type QuotaViolation struct {
+	Quota   string // "open_requests", "monthly_grams" or "monthly_hours"
+	Message string
+}
+
+// QuotaExceededError is returned when a submission would exceed one or more quotas
+type QuotaExceededError struct {
+	Violations []QuotaViolation
+}
+
+func (e *QuotaExceededError) Error() string {
+	messages := make([]string, len(e.Violations))
+	for i, violation := range e.Violations {
+		messages[i] = violation.Quota + " " + violation.Message
+	}
+	return fmt.Sprintf("%s: %s", ErrQuotaExceeded, strings.Join(messages, "; "))
+}
+
+// Is makes QuotaExceededError match ErrQuotaExceeded
+func (e *QuotaExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+// QuotaService limits how much each user may request
+type QuotaService struct {
+	db     database.DBClient
+	config config.QuotaConfig
+	logger *slog.Logger
+}
+
+// NewQuotaService creates a new quota service with the given default limits
+func NewQuotaService(db database.DBClient, cfg config.QuotaConfig) *QuotaService {
+	return &QuotaService{
+		db:     db,
+		config: cfg,
+		logger: slog.Default(),
+	}
+}
+
+// Limits resolves the limits that apply to a user: the configured ones,
+// overridden by their role's and then by their own. The returned limits are
+// never nil, and zero means unlimited.
+func (s *QuotaService) Limits(ctx context.Context, user *models.User) (models.QuotaLimits, error) {
+	maxOpen := s.config.MaxOpenRequests
+	grams := s.config.MonthlyGrams
+	hours := s.config.MonthlyHours
+	limits := models.QuotaLimits{MaxOpenRequests: &maxOpen, MonthlyGrams: &grams, MonthlyHours: &hours}
+
+	for _, key := range []struct {
+		scope   models.QuotaScope
+		subject string
+	}{
+		{models.QuotaScopeRole, string(user.Role)},
+		{models.QuotaScopeUser, user.ID},
+	} {
+		override, err := s.db.GetQuotaOverride(ctx, key.scope, key.subject)
+		if err != nil {
+			return limits, fmt.Errorf("failed to get quota override: %w", err)
+		}
+		if override == nil {
+			continue
+		}
+		if override.MaxOpenRequests != nil {
+			limits.MaxOpenRequests = override.MaxOpenRequests
+		}
+		if override.MonthlyGrams != nil {
+			limits.MonthlyGrams = override.MonthlyGrams
+		}
+		if override.MonthlyHours != nil {
+			limits.MonthlyHours = override.MonthlyHours
+		}
+	}
+
+	return limits, nil
+}
+
+// Status reports how much of each quota a user has used
+func (s *QuotaService) Status(ctx context.Context, user *models.User) (*models.QuotaStatus, error) {
+	limits, err := s.Limits(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	requests, err := s.db.ListPrintRequestsByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list print requests: %w", err)
+	}
+
+	return quotaStatus(limits, requests, time.Now()), nil
+}
+
+// Check returns a QuotaExceededError if submitting the request would take its
+// owner over any of their quotas. The owner is locked within tx, so that
+// their concurrent submissions are checked one after another; the request
+// must be created in the same transaction.
+func (s *QuotaService) Check(ctx context.Context, tx database.Tx, request *models.PrintRequest) error {
+	return s.check(ctx, tx, nil, request)
+}
+
+// CheckUpdate returns a QuotaExceededError if raising the estimated usage of
+// a request would take its owner over their monthly quotas. What the request
+// used before is not counted against it.
+func (s *QuotaService) CheckUpdate(ctx context.Context, tx database.Tx, previous, request *models.PrintRequest) error {
+	if !raisesEstimate(previous.EstimatedGrams, request.EstimatedGrams, request.ActualGrams) &&
+		!raisesEstimate(previous.EstimatedHours, request.EstimatedHours, request.ActualHours) {
+		return nil
+	}
+	return s.check(ctx, tx, previous, request)
+}
+
+// check checks a new request, or the update of a previous one, against its
+// owner's quotas
+func (s *QuotaService) check(ctx context.Context, tx database.Tx, previous, request *models.PrintRequest) error {
+	now := time.Now()
+	if previous != nil && previous.CreatedAt.Before(monthStart(now)) {
+		// Usage counts towards the month a request was submitted in, which
+		// is no longer limited
+		return nil
+	}
+
+	user, err := tx.LockUser(ctx, request.UserID)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return fmt.Errorf("user not found: %s", request.UserID)
+	}
+
+	limits, err := s.Limits(ctx, user)
+	if err != nil {
+		return err
+	}
+	requests, err := tx.ListPrintRequestsByUserID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	checkGrams, checkHours := true, true
+	if previous != nil {
+		requests = slices.DeleteFunc(requests, func(r *models.PrintRequest) bool { return r.ID == previous.ID })
+		checkGrams = raisesEstimate(previous.EstimatedGrams, request.EstimatedGrams, request.ActualGrams)
+		checkHours = raisesEstimate(previous.EstimatedHours, request.EstimatedHours, request.ActualHours)
+	}
+	status := quotaStatus(limits, requests, now)
+
+	var violations []QuotaViolation
+	if previous == nil && exceeds(status.OpenRequests, 1) {
+		violations = append(violations, QuotaViolation{
+			Quota: "open_requests",
+			Message: fmt.Sprintf("limit of %.0f open requests reached, wait for one to be done before submitting another",
+				status.OpenRequests.Limit),
+		})
+	}
+	if grams := valueOrZero(request.EstimatedGrams); checkGrams && exceeds(status.MonthlyGrams, grams) {
+		violations = append(violations, QuotaViolation{
+			Quota:   "monthly_grams",
+			Message: monthlyMessage(status.MonthlyGrams, grams, "%.0fg"),
+		})
+	}
+	if hours := valueOrZero(request.EstimatedHours); checkHours && exceeds(status.MonthlyHours, hours) {
+		violations = append(violations, QuotaViolation{
+			Quota:   "monthly_hours",
+			Message: monthlyMessage(status.MonthlyHours, hours, "%.1fh"),
+		})
+	}
+
+	if len(violations) > 0 {
+		s.logger.Info("print request over quota", "user_id", user.ID, "quotas", len(violations))
+		return &QuotaExceededError{Violations: violations}
+	}
+	return nil
+}
+
+// quotaStatus adds up a user's usage of their quotas from their requests
+func quotaStatus(limits models.QuotaLimits, requests []*models.PrintRequest, now time.Time) *models.QuotaStatus {
+	monthStart := monthStart(now)
+
+	var open, grams, hours float64
+	for _, request := range requests {
+		if request.Status != models.StatusDone {
+			open++
+		}
+		if request.CreatedAt.Before(monthStart) {
+			continue
+		}
+		grams += usedAmount(request.ActualGrams, request.EstimatedGrams)
+		hours += usedAmount(request.ActualHours, request.EstimatedHours)
+	}
+
+	return &models.QuotaStatus{
+		OpenRequests: allowance(float64(*limits.MaxOpenRequests), open),
+		MonthlyGrams: allowance(*limits.MonthlyGrams, grams),
+		MonthlyHours: allowance(*limits.MonthlyHours, hours),
+		ResetsAt:     monthStart.AddDate(0, 1, 0),
+	}
+}
+
+// ListOverrides retrieves all quota overrides
+func (s *QuotaService) ListOverrides(ctx context.Context) ([]*models.QuotaOverride, error) {
+	return s.db.ListQuotaOverrides(ctx)
+}
+
+// SetOverride creates or replaces the quota override of a user or role
+func (s *QuotaService) SetOverride(ctx context.Context, scope models.QuotaScope, subject string, limits models.QuotaLimits) (*models.QuotaOverride, error) {
+	if scope == models.QuotaScopeUser {
+		user, err := s.db.GetUser(ctx, subject)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		if user == nil {
+			return nil, fmt.Errorf("user not found: %s", subject)
+		}
+	}
+
+	override, err := s.db.GetQuotaOverride(ctx, scope, subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get quota override: %w", err)
+	}
+
+	if override != nil {
+		override.QuotaLimits = limits
+		if err := s.db.UpdateQuotaOverride(ctx, override); err != nil {
+			s.logger.Error("failed to update quota override", "error", err, "scope", scope, "subject", subject)
+			return nil, err
+		}
+	} else {
+		override = &models.QuotaOverride{Scope: scope, Subject: subject, QuotaLimits: limits}
+		if err := s.db.CreateQuotaOverride(ctx, override); err != nil {
+			s.logger.Error("failed to create quota override", "error", err, "scope", scope, "subject", subject)
+			return nil, err
+		}
+	}
+
+	s.logger.Info("set quota override", "id", override.ID, "scope", scope, "subject", subject)
+	return override, nil
+}
+
+// DeleteOverride removes a quota override
+func (s *QuotaService) DeleteOverride(ctx context.Context, id int) error {
+	if err := s.db.DeleteQuotaOverride(ctx, id); err != nil {
+		s.logger.Error("failed to delete quota override", "error", err, "id", id)
+		return err
+	}
+	s.logger.Info("deleted quota override", "id", id)
+	return nil
+}
+
+// allowance reports the usage of a quota, where a zero limit is unlimited
+func allowance(limit, used float64) models.QuotaAllowance {
+	a := models.QuotaAllowance{Limit: limit, Used: used}
+	if limit > 0 {
+		remaining := max(limit-used, 0)
+		a.Remaining = &remaining
+	}
+	return a
+}
+
+// exceeds reports whether using amount more would exceed a quota. A quota
+// that is used up is exceeded even by requests without an estimate.
+func exceeds(a models.QuotaAllowance, amount float64) bool {
+	return a.Remaining != nil && (*a.Remaining <= 0 || amount > *a.Remaining)
+}
+
+// monthlyMessage explains why a request exceeds a monthly quota, formatting
+// amounts with the given verb
+func monthlyMessage(a models.QuotaAllowance, amount float64, format string) string {
+	limit := fmt.Sprintf(format, a.Limit)
+	if *a.Remaining <= 0 {
+		return "monthly limit of " + limit + " has been used up"
+	}
+	return fmt.Sprintf("request needs "+format+" but only "+format+" of the monthly %s remain",
+		amount, *a.Remaining, limit)
+}
+
+// monthStart returns the start of the month monthly quotas are counted for
+func monthStart(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// raisesEstimate reports whether an estimate has been raised from what it
+// was. Estimates no longer count once the actual amount is known.
+func raisesEstimate(previous, estimated, actual *float64) bool {
+	return actual == nil && valueOrZero(estimated) > valueOrZero(previous)
+}
+
+// usedAmount is the actual amount used by a request, or its estimate if it
+// has not been recorded yet
+func usedAmount(actual, estimated *float64) float64 {
+	if actual != nil {
+		return *actual
+	}
+	return valueOrZero(estimated)
+}
@@ -0,0 +1,304 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+var testQuotas = config.QuotaConfig{
+	Enabled:         true,
+	MaxOpenRequests: 2,
+	MonthlyGrams:    500,
+	MonthlyHours:    0, // Unlimited
+}
+
+func floatPtr(f float64) *float64 {
+	return &f
+}
+
+func TestQuotaLimits(t *testing.T) {
+	ctx := context.Background()
+	user := &models.User{ID: "user", Role: models.RoleUser}
+
+	tests := []struct {
+		name         string
+		roleOverride *models.QuotaOverride
+		userOverride *models.QuotaOverride
+		wantOpen     int
+		wantGrams    float64
+		wantHours    float64
+	}{
+		{
+			name:      "configured defaults",
+			wantOpen:  2,
+			wantGrams: 500,
+			wantHours: 0,
+		},
+		{
+			name:         "role override",
+			roleOverride: &models.QuotaOverride{QuotaLimits: models.QuotaLimits{MaxOpenRequests: intPtr(5)}},
+			wantOpen:     5,
+			wantGrams:    500,
+			wantHours:    0,
+		},
+		{
+			name:         "user override takes precedence",
+			roleOverride: &models.QuotaOverride{QuotaLimits: models.QuotaLimits{MaxOpenRequests: intPtr(5), MonthlyHours: floatPtr(10)}},
+			userOverride: &models.QuotaOverride{QuotaLimits: models.QuotaLimits{MaxOpenRequests: intPtr(0), MonthlyGrams: floatPtr(1000)}},
+			wantOpen:     0,
+			wantGrams:    1000,
+			wantHours:    10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDBClient)
+			quotas := NewQuotaService(mockDB, testQuotas)
+
+			mockDB.On("GetQuotaOverride", ctx, models.QuotaScopeRole, "user").Return(tt.roleOverride, nil)
+			mockDB.On("GetQuotaOverride", ctx, models.QuotaScopeUser, "user").Return(tt.userOverride, nil)
+
+			limits, err := quotas.Limits(ctx, user)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantOpen, *limits.MaxOpenRequests)
+			assert.Equal(t, tt.wantGrams, *limits.MonthlyGrams)
+			assert.Equal(t, tt.wantHours, *limits.MonthlyHours)
+		})
+	}
+}
+
+func TestQuotaCheck(t *testing.T) {
+	ctx := context.Background()
+	user := &models.User{ID: "user", Role: models.RoleUser}
+	now := time.Now()
+	lastMonth := now.AddDate(0, -1, -1)
+
+	tests := []struct {
+		name     string
+		existing []*models.PrintRequest
+		grams    *float64
+		want     []string
+	}{
+		{
+			name: "within quota",
+			existing: []*models.PrintRequest{
+				{Status: models.StatusEnqueued, EstimatedGrams: floatPtr(100), CreatedAt: now},
+				{Status: models.StatusDone, ActualGrams: floatPtr(150), EstimatedGrams: floatPtr(400), CreatedAt: now},
+			},
+			grams: floatPtr(250),
+		},
+		{
+			name: "too many open requests",
+			existing: []*models.PrintRequest{
+				{Status: models.StatusPendingApproval, CreatedAt: now},
+				{Status: models.StatusInProgress, CreatedAt: now},
+				{Status: models.StatusDone, CreatedAt: now},
+			},
+			want: []string{"open_requests"},
+		},
+		{
+			name: "over monthly grams",
+			existing: []*models.PrintRequest{
+				{Status: models.StatusDone, ActualGrams: floatPtr(400), CreatedAt: now},
+				{Status: models.StatusDone, ActualGrams: floatPtr(400), CreatedAt: lastMonth},
+			},
+			grams: floatPtr(150),
+			want:  []string{"monthly_grams"},
+		},
+		{
+			name: "monthly grams used up",
+			existing: []*models.PrintRequest{
+				{Status: models.StatusEnqueued, EstimatedGrams: floatPtr(300), CreatedAt: now},
+				{Status: models.StatusEnqueued, EstimatedGrams: floatPtr(200), CreatedAt: now},
+			},
+			want: []string{"open_requests", "monthly_grams"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDBClient)
+			mockTx := new(MockTx)
+			quotas := NewQuotaService(mockDB, testQuotas)
+
+			mockTx.On("LockUser", ctx, "user").Return(user, nil)
+			mockDB.On("GetQuotaOverride", ctx, mock.Anything, mock.Anything).Return(nil, nil)
+			mockTx.On("ListPrintRequestsByUserID", ctx, "user").Return(tt.existing, nil)
+
+			err := quotas.Check(ctx, mockTx, &models.PrintRequest{UserID: "user", EstimatedGrams: tt.grams})
+			if len(tt.want) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var quotaErr *QuotaExceededError
+			require.True(t, errors.As(err, &quotaErr))
+			assert.ErrorIs(t, err, ErrQuotaExceeded)
+
+			exceeded := make([]string, len(quotaErr.Violations))
+			for i, violation := range quotaErr.Violations {
+				exceeded[i] = violation.Quota
+			}
+			assert.Equal(t, tt.want, exceeded)
+		})
+	}
+}
+
+func TestQuotaStatusRemaining(t *testing.T) {
+	ctx := context.Background()
+	user := &models.User{ID: "user", Role: models.RoleUser}
+
+	mockDB := new(MockDBClient)
+	quotas := NewQuotaService(mockDB, testQuotas)
+
+	mockDB.On("GetQuotaOverride", ctx, mock.Anything, mock.Anything).Return(nil, nil)
+	mockDB.On("ListPrintRequestsByUserID", ctx, "user").Return([]*models.PrintRequest{
+		{Status: models.StatusEnqueued, EstimatedGrams: floatPtr(120), EstimatedHours: floatPtr(3), CreatedAt: time.Now()},
+	}, nil)
+
+	status, err := quotas.Status(ctx, user)
+	require.NoError(t, err)
+
+	assert.Equal(t, 1.0, status.OpenRequests.Used)
+	require.NotNil(t, status.OpenRequests.Remaining)
+	assert.Equal(t, 1.0, *status.OpenRequests.Remaining)
+	require.NotNil(t, status.MonthlyGrams.Remaining)
+	assert.Equal(t, 380.0, *status.MonthlyGrams.Remaining)
+	assert.Equal(t, 3.0, status.MonthlyHours.Used)
+	assert.Nil(t, status.MonthlyHours.Remaining, "unlimited quotas have no remaining allowance")
+	assert.True(t, status.ResetsAt.After(time.Now()))
+}
+
+func TestQuotaCheckUpdate(t *testing.T) {
+	ctx := context.Background()
+	user := &models.User{ID: "user", Role: models.RoleUser}
+	now := time.Now()
+
+	previous := &models.PrintRequest{ID: "req", UserID: "user", Status: models.StatusPendingApproval, EstimatedGrams: floatPtr(100), CreatedAt: now}
+	existing := []*models.PrintRequest{
+		previous,
+		{ID: "other", Status: models.StatusEnqueued, EstimatedGrams: floatPtr(300), CreatedAt: now},
+	}
+
+	tests := []struct {
+		name     string
+		previous *models.PrintRequest
+		grams    float64
+		actual   *float64
+		want     []string
+	}{
+		{
+			name:     "lowered estimate",
+			previous: previous,
+			grams:    50,
+		},
+		{
+			name:     "raised within quota",
+			previous: previous,
+			grams:    200,
+		},
+		{
+			name:     "raised over quota",
+			previous: previous,
+			grams:    250,
+			want:     []string{"monthly_grams"},
+		},
+		{
+			name:     "actual usage known",
+			previous: previous,
+			grams:    250,
+			actual:   floatPtr(90),
+		},
+		{
+			name: "submitted in an earlier month",
+			previous: &models.PrintRequest{ID: "req", UserID: "user", EstimatedGrams: floatPtr(100),
+				CreatedAt: now.AddDate(0, -1, -1)},
+			grams: 1000,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockDB := new(MockDBClient)
+			mockTx := new(MockTx)
+			quotas := NewQuotaService(mockDB, testQuotas)
+
+			mockTx.On("LockUser", ctx, "user").Return(user, nil)
+			mockDB.On("GetQuotaOverride", ctx, mock.Anything, mock.Anything).Return(nil, nil)
+			mockTx.On("ListPrintRequestsByUserID", ctx, "user").Return(slices.Clone(existing), nil)
+
+			request := *tt.previous
+			request.EstimatedGrams = floatPtr(tt.grams)
+			request.ActualGrams = tt.actual
+
+			// The open requests quota is full, but updates don't open requests
+			err := quotas.CheckUpdate(ctx, mockTx, tt.previous, &request)
+			if len(tt.want) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			var quotaErr *QuotaExceededError
+			require.True(t, errors.As(err, &quotaErr))
+			exceeded := make([]string, len(quotaErr.Violations))
+			for i, violation := range quotaErr.Violations {
+				exceeded[i] = violation.Quota
+			}
+			assert.Equal(t, tt.want, exceeded)
+		})
+	}
+}
+
+func TestCreatePrintRequestOverQuota(t *testing.T) {
+	ctx := context.Background()
+
+	mockDB := new(MockDBClient)
+	mockTx := new(MockTx)
+	service := NewPrintRequestService(mockDB)
+	service.SetQuotas(NewQuotaService(mockDB, config.QuotaConfig{Enabled: true, MaxOpenRequests: 1}))
+
+	mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+	mockTx.On("LockUser", ctx, "user").Return(&models.User{ID: "user", Role: models.RoleUser}, nil)
+	mockDB.On("GetQuotaOverride", ctx, mock.Anything, mock.Anything).Return(nil, nil)
+	mockTx.On("ListPrintRequestsByUserID", ctx, "user").Return([]*models.PrintRequest{
+		{Status: models.StatusPendingApproval},
+	}, nil)
+	mockTx.On("Rollback").Return(nil)
+
+	err := service.CreatePrintRequest(ctx, &models.PrintRequest{ID: "req", UserID: "user"})
+	assert.ErrorIs(t, err, ErrQuotaExceeded)
+	mockTx.AssertNotCalled(t, "CreatePrintRequest", mock.Anything, mock.Anything)
+	mockTx.AssertCalled(t, "Rollback")
+}
+
+func TestCreatePrintRequestWithinQuota(t *testing.T) {
+	ctx := context.Background()
+
+	mockDB := new(MockDBClient)
+	mockTx := new(MockTx)
+	service := NewPrintRequestService(mockDB)
+	service.SetQuotas(NewQuotaService(mockDB, config.QuotaConfig{Enabled: true, MaxOpenRequests: 1}))
+
+	request := &models.PrintRequest{ID: "req", UserID: "user"}
+	mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+	mockTx.On("LockUser", ctx, "user").Return(&models.User{ID: "user", Role: models.RoleUser}, nil)
+	mockDB.On("GetQuotaOverride", ctx, mock.Anything, mock.Anything).Return(nil, nil)
+	mockTx.On("ListPrintRequestsByUserID", ctx, "user").Return([]*models.PrintRequest{}, nil)
+	mockTx.On("CreatePrintRequest", ctx, request).Return(nil)
+	mockTx.On("Commit").Return(nil)
+
+	// The request is created in the transaction that checked it
+	require.NoError(t, service.CreatePrintRequest(ctx, request))
+	mockTx.AssertExpectations(t)
+	mockDB.AssertNotCalled(t, "CreatePrintRequest", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,133 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+)
+
+var (
+	// ErrRoleNotFound is returned when a role does not exist
+	ErrRoleNotFound = errors.New("role not found")
+	// ErrRoleExists is returned when creating a role whose name is taken
+	ErrRoleExists = errors.New("role already exists")
+	// ErrRoleProtected is returned when changing a role that must not change:
+	// built-in roles cannot be deleted, and the admin role always has every
+	// permission so admins cannot lock themselves out
+	ErrRoleProtected = errors.New("role cannot be changed")
+	// ErrRoleInUse is returned when deleting a role that users still have
+	ErrRoleInUse = errors.New("role is assigned to users")
+)
+
+// RoleService manages roles and the permissions they grant
+type RoleService struct {
+	db     database.DBClient
+	logger *slog.Logger
+}
+
+// NewRoleService creates a new role service
+func NewRoleService(db database.DBClient) *RoleService {
+	return &RoleService{
+		db:     db,
+		logger: slog.Default(),
+	}
+}
+
+// Load loads the roles from the database so that permission checks use them
+func (s *RoleService) Load(ctx context.Context) error {
+	roles, err := s.db.ListRoles(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load roles: %w", err)
+	}
+	models.SetRoles(roles)
+	s.logger.Info("loaded roles", "count", len(roles))
+	return nil
+}
+
+// ListRoles retrieves all roles with their permissions
+func (s *RoleService) ListRoles(ctx context.Context) ([]*models.RoleDefinition, error) {
+	return s.db.ListRoles(ctx)
+}
+
+// GetRole retrieves a role with its permissions, returning nil if it does
+// not exist
+func (s *RoleService) GetRole(ctx context.Context, name models.Role) (*models.RoleDefinition, error) {
+	return s.db.GetRole(ctx, name)
+}
+
+// CreateRole creates a custom role
+func (s *RoleService) CreateRole(ctx context.Context, role *models.RoleDefinition) error {
+	existing, err := s.db.GetRole(ctx, role.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+	if existing != nil {
+		return fmt.Errorf("%w: %s", ErrRoleExists, role.Name)
+	}
+
+	role.BuiltIn = false
+	if err := s.db.CreateRole(ctx, role); err != nil {
+		s.logger.Error("failed to create role", "error", err, "name", role.Name)
+		return err
+	}
+	s.logger.Info("created role", "name", role.Name, "permissions", role.Permissions)
+	return s.Load(ctx)
+}
+
+// UpdateRole changes a role's description and the permissions it grants
+func (s *RoleService) UpdateRole(ctx context.Context, name models.Role, description string, permissions []models.Permission) (*models.RoleDefinition, error) {
+	role, err := s.db.GetRole(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get role: %w", err)
+	}
+	if role == nil {
+		return nil, fmt.Errorf("%w: %s", ErrRoleNotFound, name)
+	}
+	if role.Name == models.RoleAdmin {
+		return nil, fmt.Errorf("%w: the admin role always has every permission", ErrRoleProtected)
+	}
+
+	role.Description = description
+	role.Permissions = permissions
+	if err := s.db.UpdateRole(ctx, role); err != nil {
+		s.logger.Error("failed to update role", "error", err, "name", name)
+		return nil, err
+	}
+	s.logger.Info("updated role", "name", name, "permissions", permissions)
+	return role, s.Load(ctx)
+}
+
+// DeleteRole deletes a custom role that no user has
+func (s *RoleService) DeleteRole(ctx context.Context, name models.Role) error {
+	role, err := s.db.GetRole(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to get role: %w", err)
+	}
+	if role == nil {
+		return fmt.Errorf("%w: %s", ErrRoleNotFound, name)
+	}
+	if role.BuiltIn {
+		return fmt.Errorf("%w: built-in roles cannot be deleted", ErrRoleProtected)
+	}
+
+	users, err := s.db.ListUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list users: %w", err)
+	}
+	for _, user := range users {
+		if user.Role == name {
+			return fmt.Errorf("%w: %s", ErrRoleInUse, name)
+		}
+	}
+
+	if err := s.db.DeleteRole(ctx, name); err != nil {
+		s.logger.Error("failed to delete role", "error", err, "name", name)
+		return err
+	}
+	s.logger.Info("deleted role", "name", name)
+	return s.Load(ctx)
+}
@@ -0,0 +1,60 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateCustomRole(t *testing.T) {
+	ctx := context.Background()
+	t.Cleanup(func() { models.SetRoles(models.BuiltInRoles()) })
+
+	operator := &models.RoleDefinition{
+		Name:        "operator",
+		Permissions: []models.Permission{models.PermissionManagePrintRequests},
+	}
+
+	mockDB := new(MockDBClient)
+	roles := NewRoleService(mockDB)
+
+	mockDB.On("GetRole", ctx, models.Role("operator")).Return(nil, nil)
+	mockDB.On("CreateRole", ctx, operator).Return(nil)
+	mockDB.On("ListRoles", ctx).Return(append(models.BuiltInRoles(), operator), nil)
+
+	require.NoError(t, roles.CreateRole(ctx, operator))
+
+	// Permission checks use the new role once it is created
+	user := &models.User{ID: "op", Role: "operator", Enabled: true}
+	assert.True(t, models.Role("operator").IsValid())
+	assert.True(t, user.HasPermission(models.PermissionManagePrintRequests))
+	assert.False(t, user.HasPermission(models.PermissionApprovePrintRequests), "operators may not approve")
+}
+
+func TestProtectedRoles(t *testing.T) {
+	ctx := context.Background()
+
+	mockDB := new(MockDBClient)
+	roles := NewRoleService(mockDB)
+
+	for _, role := range models.BuiltInRoles() {
+		mockDB.On("GetRole", ctx, role.Name).Return(role, nil)
+	}
+	mockDB.On("GetRole", ctx, models.Role("operator")).Return(&models.RoleDefinition{Name: "operator"}, nil)
+	mockDB.On("GetRole", ctx, models.Role("missing")).Return(nil, nil)
+	mockDB.On("ListUsers", ctx).Return([]*models.User{{ID: "op", Role: "operator"}}, nil)
+
+	_, err := roles.UpdateRole(ctx, models.RoleAdmin, "", nil)
+	assert.ErrorIs(t, err, ErrRoleProtected, "admins must keep every permission")
+
+	assert.ErrorIs(t, roles.DeleteRole(ctx, models.RoleModerator), ErrRoleProtected)
+	assert.ErrorIs(t, roles.DeleteRole(ctx, "operator"), ErrRoleInUse)
+	assert.ErrorIs(t, roles.DeleteRole(ctx, "missing"), ErrRoleNotFound)
+
+	mockDB.AssertNotCalled(t, "UpdateRole", mock.Anything, mock.Anything)
+	mockDB.AssertNotCalled(t, "DeleteRole", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+)
+
+// ErrSessionNotFound is returned when a session does not exist or belongs to
+// another user
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionService manages users' browser sessions
+type SessionService struct {
+	db     database.DBClient
+	logger *slog.Logger
+}
+
+// NewSessionService creates a new session service
+func NewSessionService(db database.DBClient) *SessionService {
+	return &SessionService{
+		db:     db,
+		logger: slog.Default(),
+	}
+}
+
+// ListSessions retrieves the user's active sessions, most recently used first
+func (s *SessionService) ListSessions(ctx context.Context, userID string) ([]*models.UserSession, error) {
+	return s.db.ListUserSessionsByUserID(ctx, userID, time.Now())
+}
+
+// RevokeSession logs out one of the user's sessions
+func (s *SessionService) RevokeSession(ctx context.Context, userID, id string) error {
+	sessions, err := s.ListSessions(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		if session.ID != id {
+			continue
+		}
+		if err := s.db.DeleteUserSession(ctx, id); err != nil {
+			return err
+		}
+		s.logger.Info("revoked session", "session_id", id, "user_id", userID)
+		return nil
+	}
+	return ErrSessionNotFound
+}
+
+// RevokeOtherSessions logs out all of the user's sessions except the current
+// one
+func (s *SessionService) RevokeOtherSessions(ctx context.Context, userID, currentID string) error {
+	if err := s.db.DeleteUserSessionsByUserID(ctx, userID, currentID); err != nil {
+		return err
+	}
+	s.logger.Info("revoked other sessions", "user_id", userID)
+	return nil
+}
+
+// SweepExpired deletes expired sessions
+func (s *SessionService) SweepExpired(ctx context.Context) (int64, error) {
+	return s.db.DeleteExpiredUserSessions(ctx, time.Now())
+}
+
+// RunSweeper deletes expired sessions every interval until ctx is done
+func (s *SessionService) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.SweepExpired(ctx)
+			if err != nil {
+				s.logger.Error("failed to delete expired sessions", "error", err)
+				continue
+			}
+			if deleted > 0 {
+				s.logger.Info("deleted expired sessions", "count", deleted)
+			}
+		}
+	}
+}
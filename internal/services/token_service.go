@@ -0,0 +1,137 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/google/uuid"
+)
+
+// APITokenPrefix starts every API token, so that leaked tokens are easy to
+// recognise and search for
+const APITokenPrefix = "pdis_"
+
+// tokenLastUsedInterval limits how often a token's last use is recorded, so
+// that scripts polling the API do not write to the database on every request
+const tokenLastUsedInterval = time.Minute
+
+var (
+	// ErrTokenNotFound is returned when a token does not exist or belongs to
+	// another user
+	ErrTokenNotFound = errors.New("API token not found")
+	// ErrTokenScopeNotGranted is returned when creating a token with a scope
+	// the user does not have themselves
+	ErrTokenScopeNotGranted = errors.New("scope not granted to user")
+)
+
+// TokenService manages personal API tokens
+type TokenService struct {
+	db     database.DBClient
+	logger *slog.Logger
+}
+
+// NewTokenService creates a new API token service
+func NewTokenService(db database.DBClient) *TokenService {
+	return &TokenService{
+		db:     db,
+		logger: slog.Default(),
+	}
+}
+
+// CreateToken creates a token for the user limited to the given scopes. It
+// returns the token's secret, which is not stored and cannot be shown again.
+func (s *TokenService) CreateToken(ctx context.Context, user *models.User, name string, scopes []models.Permission, expiresAt *time.Time) (*models.APIToken, string, error) {
+	for _, scope := range scopes {
+		if !user.HasPermissionInAnyScope(scope) {
+			return nil, "", fmt.Errorf("%w: %s", ErrTokenScopeNotGranted, scope)
+		}
+	}
+
+	secret := APITokenPrefix + rand.Text()
+	token := &models.APIToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		Name:      name,
+		TokenHash: hashToken(secret),
+		Prefix:    secret[:len(APITokenPrefix)+6],
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := s.db.CreateAPIToken(ctx, token); err != nil {
+		s.logger.Error("failed to create API token", "error", err, "user_id", user.ID)
+		return nil, "", err
+	}
+
+	s.logger.Info("created API token", "token_id", token.ID, "user_id", user.ID, "scopes", scopes)
+	return token, secret, nil
+}
+
+// ListTokens retrieves the user's tokens
+func (s *TokenService) ListTokens(ctx context.Context, userID string) ([]*models.APIToken, error) {
+	return s.db.ListAPITokensByUserID(ctx, userID)
+}
+
+// RevokeToken deletes one of the user's tokens
+func (s *TokenService) RevokeToken(ctx context.Context, userID, id string) error {
+	tokens, err := s.db.ListAPITokensByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range tokens {
+		if token.ID != id {
+			continue
+		}
+		if err := s.db.DeleteAPIToken(ctx, id); err != nil {
+			return err
+		}
+		s.logger.Info("revoked API token", "token_id", id, "user_id", userID)
+		return nil
+	}
+	return ErrTokenNotFound
+}
+
+// Authenticate finds the token with the given secret and records its use. It
+// returns nil if the token does not exist or has expired.
+func (s *TokenService) Authenticate(ctx context.Context, secret string) (*models.APIToken, error) {
+	if !strings.HasPrefix(secret, APITokenPrefix) {
+		return nil, nil
+	}
+
+	token, err := s.db.GetAPITokenByHash(ctx, hashToken(secret))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API token: %w", err)
+	}
+	if token == nil || token.IsExpired() {
+		return nil, nil
+	}
+
+	now := time.Now()
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= tokenLastUsedInterval {
+		if err := s.db.UpdateAPITokenLastUsed(ctx, token.ID, now); err != nil {
+			// Not worth failing the request over
+			s.logger.Error("failed to record API token use", "error", err, "token_id", token.ID)
+		} else {
+			token.LastUsedAt = &now
+		}
+	}
+
+	return token, nil
+}
+
+// hashToken hashes a token's secret for storage. Secrets are random, so a
+// fast hash is enough to make a leaked database useless for authenticating.
+func hashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/qrcode"
+	"github.com/bjschafer/print-dis/internal/totp"
+	"github.com/google/uuid"
+)
+
+const (
+	// recoveryCodeCount is the number of recovery codes issued at a time
+	recoveryCodeCount = 10
+	// qrCodeScale is the size in pixels of each module of enrolment QR codes
+	qrCodeScale = 6
+)
+
+var (
+	// ErrTwoFactorNotEnabled is returned when a user has not set up
+	// two-factor authentication
+	ErrTwoFactorNotEnabled = errors.New("two-factor authentication is not enabled")
+	// ErrTwoFactorAlreadyEnabled is returned when enrolling a user who has
+	// already set up two-factor authentication
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	// ErrTwoFactorRequired is returned when disabling two-factor
+	// authentication for a user whose role requires it
+	ErrTwoFactorRequired = errors.New("two-factor authentication is required for your role")
+	// ErrInvalidTwoFactorCode is returned for wrong, expired or reused codes
+	ErrInvalidTwoFactorCode = errors.New("invalid two-factor code")
+)
+
+// TwoFactorStatus describes a user's two-factor authentication
+type TwoFactorStatus struct {
+	Enabled bool `json:"enabled"`
+	// Required is true when the user's role requires two-factor authentication
+	Required               bool `json:"required"`
+	RecoveryCodesRemaining int  `json:"recovery_codes_remaining"`
+}
+
+// TOTPEnrolment is the secret a user adds to their authenticator app
+type TOTPEnrolment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`     // otpauth:// URI
+	QRCode string `json:"qr_code"` // PNG of the URI as a data: URL
+}
+
+// TwoFactorService manages two-factor authentication of local accounts with
+// an authenticator app (TOTP) and one-time recovery codes
+type TwoFactorService struct {
+	db            database.DBClient
+	issuer        string
+	requiredRoles []models.Role
+	now           func() time.Time
+	logger        *slog.Logger
+}
+
+// NewTwoFactorService creates a new two-factor authentication service
+func NewTwoFactorService(db database.DBClient, cfg config.TOTPConfig) *TwoFactorService {
+	requiredRoles := make([]models.Role, 0, len(cfg.RequiredRoles))
+	for _, role := range cfg.RequiredRoles {
+		requiredRoles = append(requiredRoles, models.Role(role))
+	}
+	return &TwoFactorService{
+		db:            db,
+		issuer:        cfg.Issuer,
+		requiredRoles: requiredRoles,
+		now:           time.Now,
+		logger:        slog.Default(),
+	}
+}
+
+// IsRequired reports whether the user must set up two-factor authentication.
+// It only applies to local accounts, as other logins are verified elsewhere.
+func (s *TwoFactorService) IsRequired(user *models.User) bool {
+	return user.HasPassword() && slices.Contains(s.requiredRoles, user.Role)
+}
+
+// IsEnabled reports whether the user has set up two-factor authentication
+func (s *TwoFactorService) IsEnabled(ctx context.Context, userID string) (bool, error) {
+	enrolment, err := s.db.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	return enrolment != nil && enrolment.Enabled, nil
+}
+
+// Status returns the user's two-factor authentication status
+func (s *TwoFactorService) Status(ctx context.Context, user *models.User) (*TwoFactorStatus, error) {
+	enabled, err := s.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	status := &TwoFactorStatus{
+		Enabled:  enabled,
+		Required: s.IsRequired(user),
+	}
+	if enabled {
+		if status.RecoveryCodesRemaining, err = s.db.CountUnusedRecoveryCodes(ctx, user.ID); err != nil {
+			return nil, err
+		}
+	}
+	return status, nil
+}
+
+// BeginEnrolment generates a new secret for the user to add to their
+// authenticator app. It is not used until confirmed with ConfirmEnrolment.
+func (s *TwoFactorService) BeginEnrolment(ctx context.Context, user *models.User) (*TOTPEnrolment, error) {
+	enabled, err := s.IsEnabled(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.SaveUserTOTP(ctx, &models.UserTOTP{
+		UserID:    user.ID,
+		Secret:    secret,
+		CreatedAt: s.now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	uri := totp.URI(s.issuer, user.Username, secret)
+	code, err := qrcode.Encode(uri)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode QR code: %w", err)
+	}
+	png, err := code.PNG(qrCodeScale)
+	if err != nil {
+		return nil, fmt.Errorf("failed to render QR code: %w", err)
+	}
+
+	return &TOTPEnrolment{
+		Secret: secret,
+		URI:    uri,
+		QRCode: "data:image/png;base64," + base64.StdEncoding.EncodeToString(png),
+	}, nil
+}
+
+// ConfirmEnrolment enables two-factor authentication once the user has
+// entered a code from their authenticator app. It returns the user's recovery
+// codes, which are not stored and cannot be shown again.
+func (s *TwoFactorService) ConfirmEnrolment(ctx context.Context, userID, code string) ([]string, error) {
+	enrolment, err := s.db.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enrolment == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if enrolment.Enabled {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+
+	now := s.now()
+	step, ok := totp.Validate(enrolment.Secret, code, now)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	enrolment.Enabled = true
+	enrolment.EnabledAt = &now
+	enrolment.LastCounter = step
+	if err := s.db.SaveUserTOTP(ctx, enrolment); err != nil {
+		return nil, err
+	}
+
+	codes, err := s.replaceRecoveryCodes(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	s.logger.Info("two-factor authentication enabled", "user_id", userID)
+	return codes, nil
+}
+
+// Verify checks a code from the user's authenticator app. Each code can only
+// be used once.
+func (s *TwoFactorService) Verify(ctx context.Context, userID, code string) error {
+	enrolment, err := s.db.GetUserTOTP(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if enrolment == nil || !enrolment.Enabled {
+		return ErrTwoFactorNotEnabled
+	}
+
+	step, ok := totp.Validate(enrolment.Secret, code, s.now())
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	advanced, err := s.db.UpdateUserTOTPCounter(ctx, userID, step)
+	if err != nil {
+		return err
+	}
+	if !advanced {
+		s.logger.Warn("refused reused two-factor code", "user_id", userID)
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// UseRecoveryCode checks one of the user's recovery codes and marks it used
+func (s *TwoFactorService) UseRecoveryCode(ctx context.Context, userID, code string) error {
+	used, err := s.db.UseRecoveryCode(ctx, userID, hashToken(normalizeRecoveryCode(code)), s.now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidTwoFactorCode
+	}
+
+	remaining, err := s.db.CountUnusedRecoveryCodes(ctx, userID)
+	if err != nil {
+		s.logger.Error("failed to count recovery codes", "error", err, "user_id", userID)
+	}
+	s.logger.Info("recovery code used", "user_id", userID, "remaining", remaining)
+	return nil
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes, after checking
+// a code from their authenticator app
+func (s *TwoFactorService) RegenerateRecoveryCodes(ctx context.Context, userID, code string) ([]string, error) {
+	if err := s.Verify(ctx, userID, code); err != nil {
+		return nil, err
+	}
+	return s.replaceRecoveryCodes(ctx, userID)
+}
+
+// Disable turns off two-factor authentication for the user, unless their
+// role requires it
+func (s *TwoFactorService) Disable(ctx context.Context, user *models.User) error {
+	if s.IsRequired(user) {
+		return ErrTwoFactorRequired
+	}
+	return s.Reset(ctx, user.ID)
+}
+
+// Reset removes the user's two-factor authentication, e.g. when an admin
+// helps a user who has lost their authenticator app
+func (s *TwoFactorService) Reset(ctx context.Context, userID string) error {
+	if err := s.db.DeleteUserTOTP(ctx, userID); err != nil {
+		return err
+	}
+	s.logger.Info("two-factor authentication disabled", "user_id", userID)
+	return nil
+}
+
+// replaceRecoveryCodes generates and stores a new set of recovery codes
+func (s *TwoFactorService) replaceRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	now := s.now()
+	codes := make([]string, recoveryCodeCount)
+	stored := make([]*models.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		// Ten base32 characters, grouped to be easier to copy down
+		random := rand.Text()
+		codes[i] = random[:5] + "-" + random[5:10]
+		stored[i] = &models.RecoveryCode{
+			ID:        uuid.New().String(),
+			UserID:    userID,
+			CodeHash:  hashToken(normalizeRecoveryCode(codes[i])),
+			CreatedAt: now,
+		}
+	}
+
+	if err := s.db.ReplaceRecoveryCodes(ctx, userID, stored); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes in recovery codes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
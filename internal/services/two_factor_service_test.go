@@ -0,0 +1,124 @@
+package services
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// testTOTPSecret is a fixed secret so that codes can be computed in tests
+const testTOTPSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+func newTestTwoFactorService(db *MockDBClient, now time.Time) *TwoFactorService {
+	service := NewTwoFactorService(db, config.TOTPConfig{Issuer: "print-dis", RequiredRoles: []string{"admin"}})
+	service.now = func() time.Time { return now }
+	return service
+}
+
+func TestTwoFactorEnrolment(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+	step := now.Unix() / 30
+
+	mockDB := new(MockDBClient)
+	service := newTestTwoFactorService(mockDB, now)
+
+	pending := &models.UserTOTP{UserID: "u1", Secret: testTOTPSecret, CreatedAt: now}
+	mockDB.On("GetUserTOTP", ctx, "u1").Return(pending, nil)
+	mockDB.On("SaveUserTOTP", ctx, mock.MatchedBy(func(enrolment *models.UserTOTP) bool {
+		return enrolment.Enabled && enrolment.LastCounter == step && enrolment.EnabledAt.Equal(now)
+	})).Return(nil)
+	mockDB.On("ReplaceRecoveryCodes", ctx, "u1", mock.MatchedBy(func(codes []*models.RecoveryCode) bool {
+		return len(codes) == recoveryCodeCount
+	})).Return(nil)
+
+	// A code from two periods ago is too old to confirm with
+	stale, err := totp.Code(testTOTPSecret, now.Add(-2*totp.Period))
+	require.NoError(t, err)
+	_, err = service.ConfirmEnrolment(ctx, "u1", stale)
+	assert.ErrorIs(t, err, ErrInvalidTwoFactorCode)
+
+	code, err := totp.Code(testTOTPSecret, now)
+	require.NoError(t, err)
+	codes, err := service.ConfirmEnrolment(ctx, "u1", code)
+	require.NoError(t, err)
+
+	assert.Len(t, codes, recoveryCodeCount)
+	format := regexp.MustCompile(`^[A-Z2-7]{5}-[A-Z2-7]{5}$`)
+	for _, recoveryCode := range codes {
+		assert.Regexp(t, format, recoveryCode)
+	}
+	mockDB.AssertExpectations(t)
+}
+
+func TestTwoFactorVerify(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+	step := now.Unix() / 30
+
+	mockDB := new(MockDBClient)
+	service := newTestTwoFactorService(mockDB, now)
+
+	mockDB.On("GetUserTOTP", ctx, "u1").Return(&models.UserTOTP{UserID: "u1", Secret: testTOTPSecret, Enabled: true, LastCounter: step - 5}, nil)
+	mockDB.On("GetUserTOTP", ctx, "pending").Return(&models.UserTOTP{UserID: "pending", Secret: testTOTPSecret}, nil)
+	mockDB.On("UpdateUserTOTPCounter", ctx, "u1", step-1).Return(true, nil).Once()
+	mockDB.On("UpdateUserTOTPCounter", ctx, "u1", step-1).Return(false, nil)
+
+	// A code from the previous period is accepted for clock drift, but only once
+	previous, err := totp.Code(testTOTPSecret, now.Add(-totp.Period))
+	require.NoError(t, err)
+	assert.NoError(t, service.Verify(ctx, "u1", previous))
+	assert.ErrorIs(t, service.Verify(ctx, "u1", previous), ErrInvalidTwoFactorCode, "codes cannot be reused")
+
+	older, err := totp.Code(testTOTPSecret, now.Add(-3*totp.Period))
+	require.NoError(t, err)
+	assert.ErrorIs(t, service.Verify(ctx, "u1", older), ErrInvalidTwoFactorCode)
+
+	// Enrolments are not used until confirmed
+	current, err := totp.Code(testTOTPSecret, now)
+	require.NoError(t, err)
+	assert.ErrorIs(t, service.Verify(ctx, "pending", current), ErrTwoFactorNotEnabled)
+}
+
+func TestUseRecoveryCode(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2025, 3, 14, 15, 9, 26, 0, time.UTC)
+
+	mockDB := new(MockDBClient)
+	service := newTestTwoFactorService(mockDB, now)
+
+	mockDB.On("UseRecoveryCode", ctx, "u1", hashToken("ABCDE23456"), now).Return(true, nil).Once()
+	mockDB.On("UseRecoveryCode", ctx, "u1", hashToken("ABCDE23456"), now).Return(false, nil)
+	mockDB.On("CountUnusedRecoveryCodes", ctx, "u1").Return(9, nil)
+
+	// Case, spaces and dashes are ignored
+	assert.NoError(t, service.UseRecoveryCode(ctx, "u1", " abcde-23456"))
+	assert.ErrorIs(t, service.UseRecoveryCode(ctx, "u1", "ABCDE23456"), ErrInvalidTwoFactorCode, "recovery codes work once")
+}
+
+func TestTwoFactorRequired(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	service := newTestTwoFactorService(mockDB, time.Now())
+
+	admin := &models.User{ID: "admin", Role: models.RoleAdmin}
+	require.NoError(t, admin.SetPassword("correct-horse-battery"))
+	user := &models.User{ID: "user", Role: models.RoleUser}
+	require.NoError(t, user.SetPassword("correct-horse-battery"))
+	oidcAdmin := &models.User{ID: "oidc-admin", Role: models.RoleAdmin}
+
+	assert.True(t, service.IsRequired(admin))
+	assert.False(t, service.IsRequired(user))
+	assert.False(t, service.IsRequired(oidcAdmin), "only local accounts need two-factor authentication")
+
+	assert.ErrorIs(t, service.Disable(ctx, admin), ErrTwoFactorRequired)
+	mockDB.AssertNotCalled(t, "DeleteUserTOTP", mock.Anything, mock.Anything)
+}
@@ -0,0 +1,529 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/validation"
+)
+
+// MaxImportRows caps how many users can be imported at once
+const MaxImportRows = 1000
+
+// importInvitationTTL is how long invitations emailed by an import work for
+const importInvitationTTL = 14 * 24 * time.Hour
+
+var (
+	// ErrInvalidImportFile is returned for import files that cannot be read,
+	// as opposed to rows that are invalid
+	ErrInvalidImportFile = errors.New("invalid import file")
+	// ErrInvitationsUnavailable is returned when importing with invitations
+	// without email being set up
+	ErrInvitationsUnavailable = errors.New("invitations cannot be emailed: email is not set up")
+)
+
+// UserListFormat is the format of an import or export file
+type UserListFormat string
+
+const (
+	// UserListCSV is a CSV file with a header row naming the columns
+	UserListCSV UserListFormat = "csv"
+	// UserListJSON is a JSON array of objects
+	UserListJSON UserListFormat = "json"
+)
+
+// IsValid checks if the format is a known format
+func (f UserListFormat) IsValid() bool {
+	return f == UserListCSV || f == UserListJSON
+}
+
+// ImportMode is how imported users get into their accounts
+type ImportMode string
+
+const (
+	// ImportTemporaryPasswords creates accounts with temporary passwords,
+	// which are returned so they can be handed out
+	ImportTemporaryPasswords ImportMode = "password"
+	// ImportInvitations emails everyone a single-use invitation for their
+	// address instead of creating accounts
+	ImportInvitations ImportMode = "invitation"
+)
+
+// IsValid checks if the mode is a known mode
+func (m ImportMode) IsValid() bool {
+	return m == ImportTemporaryPasswords || m == ImportInvitations
+}
+
+// UserRecord is a row of an import or export file
+type UserRecord struct {
+	Username    string      `json:"username"`
+	Email       string      `json:"email,omitempty"`
+	DisplayName string      `json:"display_name,omitempty"`
+	Role        models.Role `json:"role,omitempty"` // Defaults to user
+	// Group is the names or IDs of groups to join as a member, separated by
+	// semicolons. Exports give names.
+	Group string `json:"group,omitempty"`
+}
+
+// userRecordColumns are the CSV columns, in the order they are exported
+var userRecordColumns = []string{"username", "email", "display_name", "role", "group"}
+
+// Validate checks the row with the same rules as creating a single user
+func (r *UserRecord) Validate() validation.ValidationErrors {
+	validator := validation.NewValidator()
+
+	r.Username = validation.SanitizeString(r.Username)
+	r.Email = validation.SanitizeString(r.Email)
+	r.DisplayName = validation.SanitizeDisplayName(r.DisplayName)
+	r.Group = validation.SanitizeString(r.Group)
+
+	validator.ValidateRequired("username", r.Username)
+	validator.ValidateUsername("username", r.Username)
+	validator.ValidateEmail("email", r.Email)
+	validator.ValidateNoHTML("email", r.Email)
+	validator.ValidateDisplayName("display_name", r.DisplayName)
+
+	r.Role = models.Role(strings.ToLower(strings.TrimSpace(string(r.Role))))
+	if r.Role == "" {
+		r.Role = models.RoleUser
+	}
+	if !r.Role.IsValid() {
+		validator.AddError("role", "unknown role")
+	}
+
+	return validator.Errors()
+}
+
+// groups returns the group names or IDs in the row's group column
+func (r *UserRecord) groups() []string {
+	var groups []string
+	for _, group := range strings.Split(r.Group, ";") {
+		if group = strings.TrimSpace(group); group != "" {
+			groups = append(groups, group)
+		}
+	}
+	return groups
+}
+
+// ReadUserRecords reads the rows of an import file. CSV files need a header
+// row; columns are matched by name and unknown columns are ignored.
+func ReadUserRecords(r io.Reader, format UserListFormat) ([]UserRecord, error) {
+	var records []UserRecord
+	switch format {
+	case UserListJSON:
+		if err := json.NewDecoder(r).Decode(&records); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+	case UserListCSV:
+		var err error
+		if records, err = readCSVRecords(r); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown format %q", ErrInvalidImportFile, format)
+	}
+
+	if len(records) == 0 {
+		return nil, fmt.Errorf("%w: no users", ErrInvalidImportFile)
+	}
+	if len(records) > MaxImportRows {
+		return nil, fmt.Errorf("%w: more than %d users", ErrInvalidImportFile, MaxImportRows)
+	}
+	return records, nil
+}
+
+func readCSVRecords(r io.Reader) ([]UserRecord, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read header row: %v", ErrInvalidImportFile, err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		// Spreadsheets add a byte order mark and people add spaces
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[strings.NewReplacer(" ", "_", "-", "_").Replace(name)] = i
+	}
+	if _, ok := columns["username"]; !ok {
+		return nil, fmt.Errorf("%w: no username column", ErrInvalidImportFile)
+	}
+	field := func(row []string, column string) string {
+		if i, ok := columns[column]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+
+	var records []UserRecord
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidImportFile, err)
+		}
+		records = append(records, UserRecord{
+			Username:    field(row, "username"),
+			Email:       field(row, "email"),
+			DisplayName: field(row, "display_name"),
+			Role:        models.Role(field(row, "role")),
+			Group:       field(row, "group"),
+		})
+		if len(records) > MaxImportRows {
+			break
+		}
+	}
+	return records, nil
+}
+
+// WriteUserRecords writes an export file, which can be imported again
+func WriteUserRecords(w io.Writer, format UserListFormat, records []UserRecord) error {
+	switch format {
+	case UserListJSON:
+		if records == nil {
+			records = []UserRecord{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(records)
+	case UserListCSV:
+		writer := csv.NewWriter(w)
+		if err := writer.Write(userRecordColumns); err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err := writer.Write([]string{record.Username, record.Email, record.DisplayName, string(record.Role), record.Group}); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+// ImportStatus is what happened, or would happen, to a row of an import
+type ImportStatus string
+
+const (
+	// ImportRowValid rows would be imported if it were not a dry run
+	ImportRowValid ImportStatus = "valid"
+	// ImportRowInvalid rows need fixing, and stop anything being imported
+	ImportRowInvalid ImportStatus = "invalid"
+	// ImportRowCreated rows were created with a temporary password
+	ImportRowCreated ImportStatus = "created"
+	// ImportRowInvited rows were emailed an invitation
+	ImportRowInvited ImportStatus = "invited"
+	// ImportRowFailed rows were valid but could not be imported, e.g.
+	// because the invitation could not be emailed
+	ImportRowFailed ImportStatus = "failed"
+)
+
+// ImportRowResult is the outcome of importing a row
+type ImportRowResult struct {
+	Row      int          `json:"row"` // Counting from 1, not counting a CSV header
+	Username string       `json:"username"`
+	Email    string       `json:"email,omitempty"`
+	Role     models.Role  `json:"role"`
+	Groups   []string     `json:"groups,omitempty"` // Names of the groups joined
+	Status   ImportStatus `json:"status"`
+	// Errors are the problems with invalid rows
+	Errors validation.ValidationErrors `json:"errors,omitempty"`
+	// Error is why a valid row failed
+	Error             string `json:"error,omitempty"`
+	UserID            string `json:"user_id,omitempty"`
+	TemporaryPassword string `json:"temporary_password,omitempty"`
+}
+
+// ImportReport is the outcome of an import, row by row
+type ImportReport struct {
+	Mode     ImportMode        `json:"mode"`
+	DryRun   bool              `json:"dry_run"`
+	Invalid  int               `json:"invalid"`
+	Imported int               `json:"imported"` // Users created or invited
+	Failed   int               `json:"failed"`
+	Rows     []ImportRowResult `json:"rows"`
+}
+
+// UserImportService creates users in bulk, such as a class at the start of a
+// semester, and exports them in the same formats
+type UserImportService struct {
+	db          database.DBClient
+	users       *UserService
+	invitations *InvitationService
+	emails      *EmailService
+	now         func() time.Time
+	logger      *slog.Logger
+}
+
+// NewUserImportService creates a new user import service
+func NewUserImportService(db database.DBClient, users *UserService, invitations *InvitationService) *UserImportService {
+	return &UserImportService{
+		db:          db,
+		users:       users,
+		invitations: invitations,
+		now:         time.Now,
+		logger:      slog.Default(),
+	}
+}
+
+// SetEmail lets imports email invitations
+func (s *UserImportService) SetEmail(emails *EmailService) {
+	s.emails = emails
+}
+
+// Import validates every row, then, unless it is a dry run or a row is
+// invalid, creates or invites each user. Nothing is imported if any row is
+// invalid, so a corrected file can be imported again from the start. The
+// creator is nil when authentication is disabled or importing from the
+// command line. Invitations are emailed with links to the public URL carried
+// by the context.
+func (s *UserImportService) Import(ctx context.Context, creator *models.User, records []UserRecord, mode ImportMode, dryRun bool) (*ImportReport, error) {
+	if !mode.IsValid() {
+		return nil, fmt.Errorf("unknown import mode %q", mode)
+	}
+	if mode == ImportInvitations {
+		if s.emails == nil {
+			return nil, ErrInvitationsUnavailable
+		}
+		if publicURLFrom(ctx) == "" {
+			return nil, ErrNoPublicURL
+		}
+	}
+
+	report := &ImportReport{Mode: mode, DryRun: dryRun, Rows: make([]ImportRowResult, len(records))}
+	groupIDs, err := s.validate(ctx, creator, records, mode, report)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun || report.Invalid > 0 {
+		return report, nil
+	}
+
+	for i := range records {
+		result := &report.Rows[i]
+		if err := s.importRecord(ctx, creator, &records[i], groupIDs[i], mode, result); err != nil {
+			s.logger.Error("failed to import user", "error", err, "row", result.Row, "username", result.Username)
+			result.Status = ImportRowFailed
+			result.Error = err.Error()
+			report.Failed++
+			continue
+		}
+		report.Imported++
+	}
+
+	s.logger.Info("imported users", "mode", mode, "imported", report.Imported, "failed", report.Failed)
+	return report, nil
+}
+
+// validate checks every row, filling in the report, and returns the IDs of
+// the groups each row joins
+func (s *UserImportService) validate(ctx context.Context, creator *models.User, records []UserRecord, mode ImportMode, report *ImportReport) ([][]string, error) {
+	groups, err := s.db.ListGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+
+	groupIDs := make([][]string, len(records))
+	usernames := make(map[string]int)
+	emails := make(map[string]int)
+	for i := range records {
+		record := &records[i]
+		errs := record.Validate()
+		validator := validation.NewValidator()
+		if mode == ImportInvitations || s.users.emails != nil {
+			validator.ValidateRequired("email", record.Email)
+		}
+
+		if record.Username != "" {
+			key := strings.ToLower(record.Username)
+			if row, ok := usernames[key]; ok {
+				validator.AddError("username", fmt.Sprintf("also in row %d", row))
+			} else {
+				usernames[key] = i + 1
+				existing, err := s.db.GetUserByUsername(ctx, record.Username)
+				if err != nil {
+					return nil, fmt.Errorf("failed to check username: %w", err)
+				}
+				if existing != nil {
+					validator.AddError("username", ErrUsernameTaken.Error())
+				}
+			}
+		}
+		if record.Email != "" {
+			key := strings.ToLower(record.Email)
+			if row, ok := emails[key]; ok {
+				validator.AddError("email", fmt.Sprintf("also in row %d", row))
+			} else {
+				emails[key] = i + 1
+				existing, err := s.db.GetUserByEmail(ctx, record.Email)
+				if err != nil {
+					return nil, fmt.Errorf("failed to check email: %w", err)
+				}
+				if existing != nil {
+					validator.AddError("email", ErrEmailTaken.Error())
+				}
+			}
+		}
+
+		// The same rules as creating users one at a time
+		if creator != nil && record.Role.IsValid() && !creator.CanGrantRole(record.Role) {
+			validator.AddError("role", "you cannot give the "+string(record.Role)+" role")
+		}
+
+		result := &report.Rows[i]
+		for _, name := range record.groups() {
+			group := findGroup(groups, name)
+			if group == nil {
+				validator.AddError("group", fmt.Sprintf("unknown group %q", name))
+				continue
+			}
+			canAdd, err := s.invitations.canInviteToGroup(ctx, creator, group.ID)
+			if err != nil {
+				return nil, err
+			}
+			if !canAdd {
+				validator.AddError("group", "you cannot add members to group "+group.Name)
+				continue
+			}
+			groupIDs[i] = append(groupIDs[i], group.ID)
+			result.Groups = append(result.Groups, group.Name)
+		}
+		if mode == ImportInvitations && len(groupIDs[i]) > 1 {
+			validator.AddError("group", "invitations can only add people to one group")
+		}
+
+		result.Row = i + 1
+		result.Username = record.Username
+		result.Email = record.Email
+		result.Role = record.Role
+		result.Status = ImportRowValid
+		if errs = append(errs, validator.Errors()...); len(errs) > 0 {
+			result.Status = ImportRowInvalid
+			result.Errors = errs
+			report.Invalid++
+		}
+	}
+	return groupIDs, nil
+}
+
+// importRecord creates or invites the user in a valid row
+func (s *UserImportService) importRecord(ctx context.Context, creator *models.User, record *UserRecord, groupIDs []string, mode ImportMode, result *ImportRowResult) error {
+	if mode == ImportInvitations {
+		expiresAt := s.now().Add(importInvitationTTL)
+		invitation := &models.Invitation{
+			Email:     &record.Email,
+			Role:      record.Role,
+			MaxUses:   1,
+			ExpiresAt: &expiresAt,
+		}
+		if len(groupIDs) == 1 {
+			invitation.GroupID = &groupIDs[0]
+		}
+		code, err := s.invitations.CreateInvitation(ctx, creator, invitation)
+		if err != nil {
+			return err
+		}
+		if err := s.emails.SendInvitation(ctx, *record, code, expiresAt); err != nil {
+			// Revoke the invitation so that importing the row again does not
+			// leave two
+			if revokeErr := s.invitations.RevokeInvitation(ctx, invitation.ID); revokeErr != nil {
+				s.logger.Error("failed to revoke unsent invitation", "error", revokeErr, "invitation_id", invitation.ID)
+			}
+			return err
+		}
+		result.Status = ImportRowInvited
+		return nil
+	}
+
+	user, password, err := s.users.CreateUser(ctx, record.Username, record.Email, record.DisplayName, record.Role)
+	if err != nil {
+		return err
+	}
+	result.Status = ImportRowCreated
+	result.UserID = user.ID
+	result.TemporaryPassword = password
+
+	for _, groupID := range groupIDs {
+		membership := &models.GroupMembership{
+			GroupID:   groupID,
+			UserID:    user.ID,
+			Role:      models.GroupRoleMember,
+			CreatedAt: s.now(),
+		}
+		if err := s.db.SetGroupMembership(ctx, membership); err != nil {
+			// The user exists, so report it with its password
+			result.Error = fmt.Sprintf("created, but failed to add to group: %v", err)
+			s.logger.Error("failed to add imported user to group", "error", err, "user_id", user.ID, "group_id", groupID)
+		}
+	}
+	return nil
+}
+
+// findGroup finds a group by ID, or else by name ignoring case
+func findGroup(groups []*models.Group, nameOrID string) *models.Group {
+	for _, group := range groups {
+		if group.ID == nameOrID {
+			return group
+		}
+	}
+	for _, group := range groups {
+		if strings.EqualFold(group.Name, nameOrID) {
+			return group
+		}
+	}
+	return nil
+}
+
+// ExportUsers lists every user as an import file row, with the names of the
+// groups they are in
+func (s *UserImportService) ExportUsers(ctx context.Context) ([]UserRecord, error) {
+	users, err := s.users.ListUsers(ctx)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := s.db.ListGroups(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list groups: %w", err)
+	}
+	userGroups := make(map[string][]string)
+	for _, group := range groups {
+		members, err := s.db.ListGroupMembers(ctx, group.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list group members: %w", err)
+		}
+		for _, member := range members {
+			userGroups[member.UserID] = append(userGroups[member.UserID], group.Name)
+		}
+	}
+
+	records := make([]UserRecord, 0, len(users))
+	for _, user := range users {
+		record := UserRecord{
+			Username: user.Username,
+			Role:     user.Role,
+			Group:    strings.Join(userGroups[user.ID], ";"),
+		}
+		if user.Email != nil {
+			record.Email = *user.Email
+		}
+		if user.DisplayName != nil {
+			record.DisplayName = *user.DisplayName
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
@@ -0,0 +1,82 @@
+package services
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadUserRecordsCSV(t *testing.T) {
+	// Columns are matched by name, ignoring case, spaces and byte order marks
+	// added by spreadsheets, and unknown columns are ignored
+	csv := "\ufeffGroup,Display Name,Username,Student ID,EMAIL\n" +
+		"Robotics Lab;Chemistry,Ada Lovelace,ada,1234,ada@example.edu\n" +
+		",,bob,,\n"
+	records, err := ReadUserRecords(strings.NewReader(csv), UserListCSV)
+	require.NoError(t, err)
+	assert.Equal(t, []UserRecord{
+		{Username: "ada", Email: "ada@example.edu", DisplayName: "Ada Lovelace", Group: "Robotics Lab;Chemistry"},
+		{Username: "bob"},
+	}, records)
+	assert.Equal(t, []string{"Robotics Lab", "Chemistry"}, records[0].groups())
+
+	for name, csv := range map[string]string{
+		"empty":       "",
+		"no rows":     "username,email\n",
+		"no username": "email\nada@example.edu\n",
+		"ragged":      "username,email\nada\n",
+		"too many":    "username\n" + strings.Repeat("someone\n", MaxImportRows+1),
+	} {
+		_, err := ReadUserRecords(strings.NewReader(csv), UserListCSV)
+		assert.ErrorIs(t, err, ErrInvalidImportFile, name)
+	}
+}
+
+func TestReadUserRecordsJSON(t *testing.T) {
+	records, err := ReadUserRecords(strings.NewReader(`[{"username": "ada", "role": "moderator", "enabled": true}]`), UserListJSON)
+	require.NoError(t, err)
+	assert.Equal(t, []UserRecord{{Username: "ada", Role: models.RoleModerator}}, records)
+
+	_, err = ReadUserRecords(strings.NewReader(`{"username": "ada"}`), UserListJSON)
+	assert.ErrorIs(t, err, ErrInvalidImportFile)
+	_, err = ReadUserRecords(strings.NewReader(`[]`), UserListJSON)
+	assert.ErrorIs(t, err, ErrInvalidImportFile)
+}
+
+func TestUserRecordValidate(t *testing.T) {
+	record := UserRecord{Username: " ada ", Email: "ada@example.edu", Role: " Moderator "}
+	assert.Empty(t, record.Validate())
+	assert.Equal(t, "ada", record.Username)
+	assert.Equal(t, models.RoleModerator, record.Role)
+
+	record = UserRecord{}
+	errs := record.Validate()
+	assert.Equal(t, models.RoleUser, record.Role)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "username", errs[0].Field)
+
+	record = UserRecord{Username: "bob", Email: "not-an-address", DisplayName: strings.Repeat("Bob", 100), Role: "wizard"}
+	fields := make(map[string]bool)
+	for _, e := range record.Validate() {
+		fields[e.Field] = true
+	}
+	assert.Equal(t, map[string]bool{"email": true, "display_name": true, "role": true}, fields)
+}
+
+func TestWriteUserRecordsRoundTrip(t *testing.T) {
+	records := []UserRecord{
+		{Username: "ada", Email: "ada@example.edu", DisplayName: "Lovelace, Ada", Role: models.RoleAdmin, Group: "Robotics Lab;Chemistry"},
+		{Username: "bob", Role: models.RoleUser},
+	}
+	for _, format := range []UserListFormat{UserListCSV, UserListJSON} {
+		var buf bytes.Buffer
+		require.NoError(t, WriteUserRecords(&buf, format, records))
+		read, err := ReadUserRecords(&buf, format)
+		require.NoError(t, err, format)
+		assert.Equal(t, records, read, format)
+	}
+}
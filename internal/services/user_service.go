@@ -4,20 +4,76 @@ import (
 	"context"
 	"crypto/rand"
 	"database/sql"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
 	"strings"
 	"time"
 
+	"github.com/bjschafer/print-dis/internal/config"
 	"github.com/bjschafer/print-dis/internal/database"
 	"github.com/bjschafer/print-dis/internal/models"
 	"github.com/google/uuid"
 )
 
+var (
+	// ErrInvalidCredentials is returned when a username and password do not
+	// match a local account or any directory's user
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrOIDCEmailInUse is returned when an OIDC login asserts the email of an
+	// existing account that the identity is not linked to
+	ErrOIDCEmailInUse = errors.New("email belongs to an existing account")
+	// ErrOIDCIdentityLinked is returned when linking an OIDC identity that is
+	// already linked to another user
+	ErrOIDCIdentityLinked = errors.New("OIDC identity is linked to another user")
+	// ErrUsernameTaken is returned when a username belongs to another account
+	ErrUsernameTaken = errors.New("username already exists")
+	// ErrEmailTaken is returned when an email address belongs to another
+	// account
+	ErrEmailTaken = errors.New("email already exists")
+	// ErrUserNotFound is returned when managing a user that does not exist
+	ErrUserNotFound = errors.New("user not found")
+	// ErrInvalidReassignment is returned when deleting a user and reassigning
+	// their print requests to themselves or a user that does not exist
+	ErrInvalidReassignment = errors.New("cannot reassign print requests to this user")
+)
+
 // UserService provides business logic for user management operations
 type UserService struct {
 	db database.DBClient
+	// emails sends verification links. Only set when users who register
+	// must verify their email address.
+	emails *EmailService
+	// lockout limits failed password logins to each username
+	lockout *LockoutService
+	// providers are the directories checked, in order, for usernames and
+	// passwords that do not match a local account
+	providers []AuthProvider
+}
+
+// AuthProvider checks usernames and passwords against an external directory,
+// such as LDAP
+type AuthProvider interface {
+	// Name identifies the directory users are linked to
+	Name() string
+	// Authenticate checks a password, returning what the directory says about
+	// the user. It returns ErrInvalidCredentials if the directory has no such
+	// user or the password is wrong.
+	Authenticate(ctx context.Context, username, password string) (*DirectoryProfile, error)
+}
+
+// DirectoryProfile is what a directory says about a user who logged in with
+// their password there
+type DirectoryProfile struct {
+	Provider    string
+	Subject     string // The user's ID in the directory
+	Username    string // Preferred username, which may be taken
+	Email       string
+	DisplayName string
+	// Role is set from the user's groups in the directory, or empty to leave
+	// the user's role alone
+	Role models.Role
 }
 
 // NewUserService creates a new UserService
@@ -27,8 +83,42 @@ func NewUserService(db database.DBClient) *UserService {
 	}
 }
 
+// SetEmailVerification makes users who register verify their email address,
+// with a link emailed to them, before they can log in with their password
+func (s *UserService) SetEmailVerification(emails *EmailService) {
+	s.emails = emails
+}
+
+// SetLockout limits failed password logins to each username
+func (s *UserService) SetLockout(lockout *LockoutService) {
+	s.lockout = lockout
+}
+
+// SetAuthProviders makes logins that do not match a local account's password
+// check each directory in turn, creating an account for the directory's user
+// the first time they log in
+func (s *UserService) SetAuthProviders(providers ...AuthProvider) {
+	s.providers = providers
+}
+
 // RegisterUser creates a new user account with local authentication using a transaction to prevent race conditions
-func (s *UserService) RegisterUser(ctx context.Context, username, email, password string) (user *models.User, err error) {
+func (s *UserService) RegisterUser(ctx context.Context, username, email, password string) (*models.User, error) {
+	return s.register(ctx, username, email, password, "")
+}
+
+// RegisterInvitedUser creates a new user account with an invitation code,
+// giving them the invitation's role and group. It returns
+// ErrInvalidInvitation if the code cannot be used, e.g. for this email.
+func (s *UserService) RegisterInvitedUser(ctx context.Context, code, username, email, password string) (*models.User, error) {
+	if normalizeInvitationCode(code) == "" {
+		return nil, ErrInvalidInvitation
+	}
+	return s.register(ctx, username, email, password, normalizeInvitationCode(code))
+}
+
+// register creates a new user account, with the invitation code if it is not
+// empty
+func (s *UserService) register(ctx context.Context, username, email, password, code string) (user *models.User, err error) {
 	// Validate input
 	if strings.TrimSpace(username) == "" {
 		return nil, fmt.Errorf("username is required")
@@ -36,6 +126,9 @@ func (s *UserService) RegisterUser(ctx context.Context, username, email, passwor
 	if strings.TrimSpace(password) == "" {
 		return nil, fmt.Errorf("password is required")
 	}
+	if s.emails != nil && strings.TrimSpace(email) == "" {
+		return nil, fmt.Errorf("email is required")
+	}
 
 	// Start a transaction
 	tx, err := s.db.BeginTx(ctx)
@@ -48,31 +141,34 @@ func (s *UserService) RegisterUser(ctx context.Context, username, email, passwor
 		}
 	}()
 
-	// Check if username already exists within the transaction
-	existingUser, err := tx.GetUserByUsername(ctx, username)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, fmt.Errorf("failed to check existing username: %w", err)
+	// Check the username and email are free within the transaction
+	if err = checkAvailable(ctx, tx, username, email); err != nil {
+		return nil, err
 	}
-	if existingUser != nil {
-		return nil, fmt.Errorf("username already exists")
-	}
-
-	// Check if email already exists (if provided) within the transaction
 	var emailPtr *string
 	if email != "" {
 		emailPtr = &email
-		existingUser, err = tx.GetUserByEmail(ctx, email)
-		if err != nil && err != sql.ErrNoRows {
-			return nil, fmt.Errorf("failed to check existing email: %w", err)
+	}
+
+	// Use up the invitation, if any. If anything else fails the use is
+	// rolled back.
+	var invitation *models.Invitation
+	if code != "" {
+		invitation, err = tx.UseInvitation(ctx, hashToken(code), time.Now())
+		if err != nil {
+			return nil, err
 		}
-		if existingUser != nil {
-			return nil, fmt.Errorf("email already exists")
+		if invitation == nil || (invitation.Email != nil && !strings.EqualFold(*invitation.Email, email)) {
+			return nil, ErrInvalidInvitation
 		}
 	}
 
 	// Create new user
 	user = models.NewUser(username, emailPtr)
 	user.ID = uuid.New().String()
+	if invitation != nil {
+		user.Role = invitation.Role
+	}
 
 	// Set password
 	if err := user.SetPassword(password); err != nil {
@@ -84,42 +180,123 @@ func (s *UserService) RegisterUser(ctx context.Context, username, email, passwor
 		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
 
+	if invitation != nil && invitation.GroupID != nil {
+		membership := &models.GroupMembership{GroupID: *invitation.GroupID, UserID: user.ID, Role: models.GroupRoleMember}
+		if err := tx.SetGroupMembership(ctx, membership); err != nil {
+			return nil, err
+		}
+	}
+
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	slog.Info("user registered", "user_id", user.ID, "username", user.Username)
+	if invitation != nil {
+		slog.Info("user registered with invitation", "user_id", user.ID, "username", user.Username, "invitation_id", invitation.ID)
+	} else {
+		slog.Info("user registered", "user_id", user.ID, "username", user.Username)
+	}
+
+	if s.emails != nil {
+		// The account exists either way; the user can ask for another link
+		if err := s.emails.SendVerification(ctx, user); err != nil {
+			slog.Error("failed to send verification email", "user_id", user.ID, "error", err)
+		}
+	}
 	return user, nil
 }
 
-// AuthenticateUser validates user credentials and returns the user if valid
+// AuthenticateUser validates user credentials and returns the user if valid.
+// The password is checked against the local account first, then against each
+// directory set with SetAuthProviders in turn.
 func (s *UserService) AuthenticateUser(ctx context.Context, username, password string) (*models.User, error) {
-	user, err := s.db.GetUserByUsername(ctx, username)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("invalid credentials")
+	// Locked usernames are refused without checking the password, but take
+	// as long as any other login
+	if s.lockout != nil {
+		if err := s.lockout.Check(ctx, username); err != nil {
+			checkDummyPassword(password)
+			return nil, err
 		}
+	}
+
+	local, err := s.db.GetUserByUsername(ctx, username)
+	if err != nil && err != sql.ErrNoRows {
 		return nil, fmt.Errorf("failed to get user: %w", err)
 	}
 
-	// User not found (database returns nil, nil when not found)
+	// Unknown users (the database returns nil, nil when not found) and users
+	// without passwords take as long to refuse as wrong passwords
+	var user *models.User
+	if local == nil || !local.HasPassword() {
+		checkDummyPassword(password)
+	} else if local.CheckPassword(password) {
+		user = local
+	}
+
 	if user == nil {
-		return nil, fmt.Errorf("invalid credentials")
+		user, err = s.authenticateWithProviders(ctx, username, password)
+		if err != nil {
+			return nil, err
+		}
+		if user == nil {
+			return nil, s.loginFailed(ctx, username, local)
+		}
 	}
 
 	if !user.Enabled {
 		return nil, fmt.Errorf("account is disabled")
 	}
 
-	if !user.CheckPassword(password) {
-		return nil, fmt.Errorf("invalid credentials")
+	if s.emails != nil && user.Email != nil && user.EmailVerifiedAt == nil {
+		return nil, ErrEmailNotVerified
+	}
+
+	if s.lockout != nil {
+		if err := s.lockout.RecordSuccess(ctx, username); err != nil {
+			slog.Error("failed to reset failed logins", "user_id", user.ID, "error", err)
+		}
 	}
 
 	slog.Info("user authenticated", "user_id", user.ID, "username", user.Username)
 	return user, nil
 }
 
+// authenticateWithProviders checks a username and password against each
+// directory in turn, returning the user for the first that accepts them, or
+// nil if none do
+func (s *UserService) authenticateWithProviders(ctx context.Context, username, password string) (*models.User, error) {
+	for _, provider := range s.providers {
+		profile, err := provider.Authenticate(ctx, username, password)
+		if errors.Is(err, ErrInvalidCredentials) {
+			continue
+		}
+		if err != nil {
+			// A directory that is down should not stop users of the others
+			// logging in
+			slog.Error("failed to check password with directory", "provider", provider.Name(), "error", err)
+			continue
+		}
+		return s.FindOrCreateUserFromDirectory(ctx, *profile)
+	}
+	return nil, nil
+}
+
+// loginFailed counts a failed password login to the username, and returns
+// the error to log in with
+func (s *UserService) loginFailed(ctx context.Context, username string, user *models.User) error {
+	if s.lockout == nil {
+		return ErrInvalidCredentials
+	}
+	if err := s.lockout.RecordFailure(ctx, username, user); err != nil {
+		if errors.Is(err, ErrAccountLocked) {
+			return err
+		}
+		slog.Error("failed to record failed login", "error", err)
+	}
+	return ErrInvalidCredentials
+}
+
 // GetUser retrieves a user by ID
 func (s *UserService) GetUser(ctx context.Context, userID string) (*models.User, error) {
 	user, err := s.db.GetUser(ctx, userID)
@@ -155,11 +332,17 @@ func (s *UserService) ChangePassword(ctx context.Context, userID, currentPasswor
 	if err := user.SetPassword(newPassword); err != nil {
 		return fmt.Errorf("failed to set new password: %w", err)
 	}
+	user.MustChangePassword = false
 
-	return s.UpdateUser(ctx, user)
+	if err := s.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	// Log out everywhere, in case the old password was compromised
+	return s.revokeSessions(ctx, userID)
 }
 
-// DisableUser disables a user account
+// DisableUser disables a user account and logs out all of its sessions
 func (s *UserService) DisableUser(ctx context.Context, userID string) error {
 	user, err := s.GetUser(ctx, userID)
 	if err != nil {
@@ -167,7 +350,23 @@ func (s *UserService) DisableUser(ctx context.Context, userID string) error {
 	}
 
 	user.Enabled = false
-	return s.UpdateUser(ctx, user)
+	if err := s.UpdateUser(ctx, user); err != nil {
+		return err
+	}
+
+	return s.revokeSessions(ctx, userID)
+}
+
+// revokeSessions logs out all of a user's sessions and deletes their API
+// tokens, which would otherwise outlive a compromised password
+func (s *UserService) revokeSessions(ctx context.Context, userID string) error {
+	if err := s.db.DeleteUserSessionsByUserID(ctx, userID, ""); err != nil {
+		return fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+	if err := s.db.DeleteAPITokensByUserID(ctx, userID); err != nil {
+		return fmt.Errorf("failed to revoke API tokens: %w", err)
+	}
+	return nil
 }
 
 // EnableUser enables a user account
@@ -181,80 +380,605 @@ func (s *UserService) EnableUser(ctx context.Context, userID string) error {
 	return s.UpdateUser(ctx, user)
 }
 
-// ListUsers returns all users
+// ListUsers returns all users, except the placeholder for deleted users
 func (s *UserService) ListUsers(ctx context.Context) ([]*models.User, error) {
 	users, err := s.db.ListUsers(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list users: %w", err)
 	}
-	return users, nil
+	return slices.DeleteFunc(users, func(user *models.User) bool {
+		return user.ID == models.DeletedUserID
+	}), nil
 }
 
-// CreateSession creates a new session for a user
-func (s *UserService) CreateSession(ctx context.Context, userID string, duration time.Duration) (*models.UserSession, error) {
-	// Generate session token
-	tokenBytes := make([]byte, 32)
-	if _, err := rand.Read(tokenBytes); err != nil {
-		return nil, fmt.Errorf("failed to generate session token: %w", err)
+// CreateUser creates a local account for an admin, with a temporary
+// password that the user must change when they first log in. The password
+// is returned, and cannot be shown again.
+func (s *UserService) CreateUser(ctx context.Context, username, email, displayName string, role models.Role) (user *models.User, password string, err error) {
+	if strings.TrimSpace(username) == "" {
+		return nil, "", fmt.Errorf("username is required")
+	}
+	if s.emails != nil && strings.TrimSpace(email) == "" {
+		return nil, "", fmt.Errorf("email is required")
 	}
-	token := hex.EncodeToString(tokenBytes)
 
-	// Create session
-	session := &models.UserSession{
-		ID:           uuid.New().String(),
-		UserID:       userID,
-		SessionToken: token,
-		ExpiresAt:    time.Now().Add(duration),
-		CreatedAt:    time.Now(),
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	if err = checkAvailable(ctx, tx, username, email); err != nil {
+		return nil, "", err
+	}
+
+	var emailPtr *string
+	if email != "" {
+		emailPtr = &email
+	}
+	user = models.NewUser(username, emailPtr)
+	user.ID = uuid.New().String()
+	if role != "" {
+		user.Role = role
+	}
+	if displayName != "" {
+		user.DisplayName = &displayName
+	}
+	// Admins vouch for the addresses of the accounts they create
+	if emailPtr != nil {
+		verifiedAt := user.CreatedAt
+		user.EmailVerifiedAt = &verifiedAt
+	}
+
+	password = temporaryPassword()
+	if err = user.SetPassword(password); err != nil {
+		return nil, "", fmt.Errorf("failed to set password: %w", err)
+	}
+	user.MustChangePassword = true
+
+	if err = tx.CreateUser(ctx, user); err != nil {
+		return nil, "", fmt.Errorf("failed to create user: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	slog.Info("user created by admin", "user_id", user.ID, "username", user.Username, "role", user.Role)
+	return user, password, nil
+}
+
+// UpdateProfile changes a user's email address and display name. Nil values
+// are left alone, and empty ones are cleared.
+func (s *UserService) UpdateProfile(ctx context.Context, userID string, email, displayName *string) (*models.User, error) {
+	user, err := s.manageableUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	currentEmail := ""
+	if user.Email != nil {
+		currentEmail = *user.Email
+	}
+	if email != nil && *email != currentEmail {
+		if *email == "" {
+			if s.emails != nil {
+				return nil, fmt.Errorf("email is required")
+			}
+			user.Email = nil
+			user.EmailVerifiedAt = nil
+		} else {
+			existing, err := s.db.GetUserByEmail(ctx, *email)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, fmt.Errorf("failed to check existing email: %w", err)
+			}
+			if existing != nil && existing.ID != user.ID {
+				return nil, ErrEmailTaken
+			}
+			// Admins vouch for the addresses they set, as when creating users
+			now := time.Now()
+			user.Email = email
+			user.EmailVerifiedAt = &now
+		}
+	}
+
+	if displayName != nil {
+		if *displayName == "" {
+			user.DisplayName = nil
+		} else {
+			user.DisplayName = displayName
+		}
+	}
+
+	if err := s.UpdateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// ResetPassword gives a user a new temporary password, which they must
+// change when they next log in, and logs them out everywhere. Locked
+// accounts are unlocked. The password is returned, and cannot be shown
+// again.
+func (s *UserService) ResetPassword(ctx context.Context, userID string) (string, error) {
+	user, err := s.manageableUser(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+
+	password := temporaryPassword()
+	if err := user.SetPassword(password); err != nil {
+		return "", fmt.Errorf("failed to set password: %w", err)
+	}
+	user.MustChangePassword = true
+	if err := s.UpdateUser(ctx, user); err != nil {
+		return "", err
+	}
+
+	if err := s.revokeSessions(ctx, userID); err != nil {
+		return "", err
+	}
+	if s.lockout != nil {
+		if err := s.lockout.Unlock(ctx, user.Username); err != nil {
+			return "", err
+		}
+	}
+
+	slog.Info("password reset by admin", "user_id", user.ID)
+	return password, nil
+}
+
+// DeleteUser deletes a user. Their print requests, charges and payments are
+// reassigned to the user with the ID reassignTo, or anonymised by moving them
+// to the placeholder for deleted users if it is empty. It returns the number
+// of print requests moved.
+func (s *UserService) DeleteUser(ctx context.Context, userID, reassignTo string) (moved int64, err error) {
+	if userID == models.DeletedUserID {
+		return 0, ErrUserNotFound
+	}
+	if reassignTo == "" {
+		reassignTo = models.DeletedUserID
+	}
+	if reassignTo == userID {
+		return 0, ErrInvalidReassignment
+	}
+
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	user, err := tx.GetUser(ctx, userID)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to get user: %w", err)
+	}
+	if user == nil {
+		return 0, ErrUserNotFound
+	}
+	target, err := tx.GetUser(ctx, reassignTo)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("failed to get user to reassign print requests to: %w", err)
+	}
+	if target == nil {
+		return 0, ErrInvalidReassignment
+	}
+
+	if moved, err = tx.ReassignUserRecords(ctx, userID, reassignTo); err != nil {
+		return 0, err
+	}
+	if err = tx.DeleteUser(ctx, userID); err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
-	// Note: We'll need to add session management to the database interface
-	// For now, we'll return the session object
-	return session, nil
+	slog.Info("user deleted", "user_id", userID, "username", user.Username, "reassigned_to", reassignTo, "print_requests", moved)
+	return moved, nil
+}
+
+// manageableUser returns the user with the ID, or ErrUserNotFound if there is
+// none or it is the placeholder for deleted users
+func (s *UserService) manageableUser(ctx context.Context, userID string) (*models.User, error) {
+	if userID == models.DeletedUserID {
+		return nil, ErrUserNotFound
+	}
+	user, err := s.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrUserNotFound
+	}
+	return user, nil
 }
 
-// FindOrCreateUserFromOIDC finds an existing user or creates a new one from OIDC identity
-func (s *UserService) FindOrCreateUserFromOIDC(ctx context.Context, providerName, subject, email, displayName string) (*models.User, error) {
-	// First, try to find existing OIDC identity
-	// Note: We'll need to implement OIDC identity management in the database interface
+// checkAvailable checks that a username, and email address if not empty, do
+// not belong to an existing account
+func checkAvailable(ctx context.Context, tx database.Tx, username, email string) error {
+	existingUser, err := tx.GetUserByUsername(ctx, username)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to check existing username: %w", err)
+	}
+	if existingUser != nil {
+		return ErrUsernameTaken
+	}
 
-	// For now, try to find by email if provided
 	if email != "" {
-		user, err := s.db.GetUserByEmail(ctx, email)
+		existingUser, err = tx.GetUserByEmail(ctx, email)
 		if err != nil && err != sql.ErrNoRows {
-			return nil, fmt.Errorf("failed to check existing email: %w", err)
+			return fmt.Errorf("failed to check existing email: %w", err)
 		}
-		if user != nil {
-			// User exists, link OIDC identity if not already linked
-			slog.Info("found existing user for OIDC", "user_id", user.ID, "provider", providerName)
-			return user, nil
+		if existingUser != nil {
+			return ErrEmailTaken
 		}
 	}
+	return nil
+}
+
+// temporaryPassword generates a password for an admin to give to a user
+func temporaryPassword() string {
+	return rand.Text()
+}
+
+// OIDCProfile is what an OIDC provider asserts about a user
+type OIDCProfile struct {
+	Provider    string
+	Subject     string
+	Username    string // Preferred username, which may be taken
+	Email       string // Verified email address, or empty
+	DisplayName string
+	// Role is set from the user's groups at the provider, or empty to leave
+	// the user's role alone
+	Role models.Role
+}
+
+// FindOrCreateUserFromOIDC finds the user linked to an OIDC identity, or
+// creates a new user linked to it. Existing accounts are never matched by
+// email, since a provider may assert any address; users link an identity to
+// their account with LinkOIDCIdentity instead.
+func (s *UserService) FindOrCreateUserFromOIDC(ctx context.Context, profile OIDCProfile) (user *models.User, err error) {
+	identity, err := s.db.GetOIDCIdentity(ctx, profile.Provider, profile.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get OIDC identity: %w", err)
+	}
+	if identity != nil {
+		user, err = s.db.GetUser(ctx, identity.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user for OIDC identity: %w", err)
+		}
+		if user == nil {
+			return nil, fmt.Errorf("user for OIDC identity not found")
+		}
+		if profile.Role != "" && user.Role != profile.Role {
+			slog.Info("updating role from OIDC groups", "user_id", user.ID, "provider", profile.Provider, "old_role", user.Role, "new_role", profile.Role)
+			user.Role = profile.Role
+			if err := s.db.UpdateUser(ctx, user); err != nil {
+				return nil, fmt.Errorf("failed to update role from OIDC groups: %w", err)
+			}
+		}
+		return user, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
 
-	// Create new user from OIDC
 	var emailPtr *string
-	if email != "" {
-		emailPtr = &email
+	if profile.Email != "" {
+		emailPtr = &profile.Email
+		var existingUser *models.User
+		existingUser, err = tx.GetUserByEmail(ctx, profile.Email)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to check existing email: %w", err)
+		}
+		if existingUser != nil {
+			err = ErrOIDCEmailInUse
+			return nil, err
+		}
 	}
 	var displayNamePtr *string
-	if displayName != "" {
-		displayNamePtr = &displayName
+	if profile.DisplayName != "" {
+		displayNamePtr = &profile.DisplayName
 	}
 
-	// Generate username from email or subject
-	username := email
+	// Generate username from the preferred username, email or subject
+	username := profile.Username
+	if username == "" {
+		username = profile.Email
+	}
 	if username == "" {
-		username = fmt.Sprintf("%s_%s", providerName, subject)
+		username = fmt.Sprintf("%s_%s", profile.Provider, profile.Subject)
+	}
+	username, err = uniqueUsername(ctx, tx, username)
+	if err != nil {
+		return nil, err
 	}
 
-	user := models.NewUser(username, emailPtr)
+	user = models.NewUser(username, emailPtr)
 	user.ID = uuid.New().String()
 	user.DisplayName = displayNamePtr
+	if emailPtr != nil {
+		// Providers only assert verified addresses
+		user.EmailVerifiedAt = &user.CreatedAt
+	}
+	if profile.Role != "" {
+		user.Role = profile.Role
+	}
 
-	if err := s.db.CreateUser(ctx, user); err != nil {
+	if err = tx.CreateUser(ctx, user); err != nil {
 		return nil, fmt.Errorf("failed to create user from OIDC: %w", err)
 	}
+	if err = tx.CreateOIDCIdentity(ctx, newOIDCIdentity(user.ID, profile.Provider, profile.Subject)); err != nil {
+		return nil, fmt.Errorf("failed to link OIDC identity: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
 
-	slog.Info("created new user from OIDC", "user_id", user.ID, "provider", providerName, "subject", subject)
+	slog.Info("created new user from OIDC", "user_id", user.ID, "provider", profile.Provider, "subject", profile.Subject, "role", user.Role)
 	return user, nil
 }
+
+// FindOrCreateUserFromDirectory finds the user linked to a directory's user,
+// updating their display name, email and role from the directory, or creates
+// a new user linked to it. Like OIDC identities, existing accounts are never
+// matched by username or email.
+func (s *UserService) FindOrCreateUserFromDirectory(ctx context.Context, profile DirectoryProfile) (user *models.User, err error) {
+	identity, err := s.db.GetLDAPIdentity(ctx, profile.Provider, profile.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get LDAP identity: %w", err)
+	}
+	if identity != nil {
+		user, err = s.db.GetUser(ctx, identity.UserID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user for LDAP identity: %w", err)
+		}
+		if user == nil {
+			return nil, fmt.Errorf("user for LDAP identity not found")
+		}
+		if err := s.syncDirectoryProfile(ctx, user, profile); err != nil {
+			return nil, err
+		}
+		return user, nil
+	}
+
+	tx, err := s.db.BeginTx(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	username := profile.Username
+	if username == "" {
+		username = fmt.Sprintf("%s_%s", profile.Provider, profile.Subject)
+	}
+	username, err = uniqueUsername(ctx, tx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	user = models.NewUser(username, nil)
+	user.ID = uuid.New().String()
+	if profile.DisplayName != "" {
+		user.DisplayName = &profile.DisplayName
+	}
+	if profile.Role != "" {
+		user.Role = profile.Role
+	}
+	if profile.Email != "" {
+		// Leave the email out rather than fail if another account has it
+		var existing *models.User
+		existing, err = tx.GetUserByEmail(ctx, profile.Email)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to check existing email: %w", err)
+		}
+		if existing == nil {
+			user.Email = &profile.Email
+			// Directories only hold addresses their administrators set
+			user.EmailVerifiedAt = &user.CreatedAt
+		}
+	}
+
+	if err = tx.CreateUser(ctx, user); err != nil {
+		return nil, fmt.Errorf("failed to create user from LDAP: %w", err)
+	}
+	identity = &models.UserLDAPIdentity{
+		ID:           uuid.New().String(),
+		UserID:       user.ID,
+		ProviderName: profile.Provider,
+		Subject:      profile.Subject,
+		CreatedAt:    time.Now(),
+	}
+	if err = tx.CreateLDAPIdentity(ctx, identity); err != nil {
+		return nil, fmt.Errorf("failed to link LDAP identity: %w", err)
+	}
+	if err = tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	slog.Info("created new user from LDAP", "user_id", user.ID, "provider", profile.Provider, "subject", profile.Subject, "role", user.Role)
+	return user, nil
+}
+
+// syncDirectoryProfile updates a user's display name, email and role to match
+// the directory
+func (s *UserService) syncDirectoryProfile(ctx context.Context, user *models.User, profile DirectoryProfile) error {
+	changed := false
+	if profile.DisplayName != "" && (user.DisplayName == nil || *user.DisplayName != profile.DisplayName) {
+		user.DisplayName = &profile.DisplayName
+		changed = true
+	}
+	if profile.Email != "" && (user.Email == nil || !strings.EqualFold(*user.Email, profile.Email)) {
+		existing, err := s.db.GetUserByEmail(ctx, profile.Email)
+		if err != nil && err != sql.ErrNoRows {
+			return fmt.Errorf("failed to check existing email: %w", err)
+		}
+		if existing == nil || existing.ID == user.ID {
+			now := time.Now()
+			user.Email = &profile.Email
+			user.EmailVerifiedAt = &now
+			changed = true
+		} else {
+			slog.Warn("not updating email from LDAP, another account has it", "user_id", user.ID, "provider", profile.Provider)
+		}
+	}
+	if profile.Role != "" && user.Role != profile.Role {
+		slog.Info("updating role from LDAP groups", "user_id", user.ID, "provider", profile.Provider, "old_role", user.Role, "new_role", profile.Role)
+		user.Role = profile.Role
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+
+	user.UpdatedAt = time.Now()
+	if err := s.db.UpdateUser(ctx, user); err != nil {
+		return fmt.Errorf("failed to update user from LDAP: %w", err)
+	}
+	return nil
+}
+
+// ProxyProfile is what an authenticating reverse proxy asserts about a user
+type ProxyProfile struct {
+	Username    string
+	Email       string
+	DisplayName string
+	// Role is set from the user's groups at the proxy, or empty to leave the
+	// user's role alone
+	Role models.Role
+}
+
+// FindOrCreateUserFromProxy finds the user with the username asserted by a
+// trusted authenticating proxy, creating them if they do not exist yet
+func (s *UserService) FindOrCreateUserFromProxy(ctx context.Context, profile ProxyProfile) (*models.User, error) {
+	user, err := s.db.GetUserByUsername(ctx, profile.Username)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if user == nil {
+		user = models.NewUser(profile.Username, nil)
+		user.ID = uuid.New().String()
+		if profile.DisplayName != "" {
+			user.DisplayName = &profile.DisplayName
+		}
+		if profile.Role != "" {
+			user.Role = profile.Role
+		}
+		if profile.Email != "" {
+			// Leave the email out rather than fail if another account has it
+			existing, err := s.db.GetUserByEmail(ctx, profile.Email)
+			if err != nil && err != sql.ErrNoRows {
+				return nil, fmt.Errorf("failed to check existing email: %w", err)
+			}
+			if existing == nil {
+				user.Email = &profile.Email
+			}
+		}
+
+		if err := s.db.CreateUser(ctx, user); err != nil {
+			// Another request for the same new user may have won the race
+			existing, getErr := s.db.GetUserByUsername(ctx, profile.Username)
+			if getErr != nil || existing == nil {
+				return nil, fmt.Errorf("failed to create user from proxy: %w", err)
+			}
+			return existing, nil
+		}
+
+		slog.Info("created new user from proxy headers", "user_id", user.ID, "username", user.Username, "role", user.Role)
+		return user, nil
+	}
+
+	if profile.Role != "" && user.Role != profile.Role {
+		slog.Info("updating role from proxy groups", "user_id", user.ID, "old_role", user.Role, "new_role", profile.Role)
+		user.Role = profile.Role
+		if err := s.db.UpdateUser(ctx, user); err != nil {
+			return nil, fmt.Errorf("failed to update role from proxy groups: %w", err)
+		}
+	}
+	return user, nil
+}
+
+// RoleFromGroups returns the role granted by the first mapping whose group the
+// user is in, or the user role if they are in none of the groups
+func RoleFromGroups(mappings []config.RoleMappingConfig, groups []string) models.Role {
+	for _, mapping := range mappings {
+		if !slices.Contains(groups, mapping.Group) {
+			continue
+		}
+		if role := models.Role(mapping.Role); role.IsValid() {
+			return role
+		}
+		slog.Warn("role mapping grants unknown role", "group", mapping.Group, "role", mapping.Role)
+	}
+	return models.RoleUser
+}
+
+// LinkOIDCIdentity links an OIDC identity to an existing user so that they
+// can log in with it
+func (s *UserService) LinkOIDCIdentity(ctx context.Context, userID, providerName, subject string) error {
+	identity, err := s.db.GetOIDCIdentity(ctx, providerName, subject)
+	if err != nil {
+		return fmt.Errorf("failed to get OIDC identity: %w", err)
+	}
+	if identity != nil {
+		if identity.UserID == userID {
+			return nil
+		}
+		return ErrOIDCIdentityLinked
+	}
+
+	if err := s.db.CreateOIDCIdentity(ctx, newOIDCIdentity(userID, providerName, subject)); err != nil {
+		return fmt.Errorf("failed to link OIDC identity: %w", err)
+	}
+
+	slog.Info("linked OIDC identity", "user_id", userID, "provider", providerName, "subject", subject)
+	return nil
+}
+
+// newOIDCIdentity creates the link between a user and an OIDC identity
+func newOIDCIdentity(userID, providerName, subject string) *models.UserOIDCIdentity {
+	return &models.UserOIDCIdentity{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		ProviderName: providerName,
+		Subject:      subject,
+		CreatedAt:    time.Now(),
+	}
+}
+
+// uniqueUsername returns username, or username with a numeric suffix if it is
+// already taken
+func uniqueUsername(ctx context.Context, tx database.Tx, username string) (string, error) {
+	candidate := username
+	for i := 2; i <= 100; i++ {
+		existing, err := tx.GetUserByUsername(ctx, candidate)
+		if err != nil && err != sql.ErrNoRows {
+			return "", fmt.Errorf("failed to check existing username: %w", err)
+		}
+		if existing == nil {
+			return candidate, nil
+		}
+		candidate = fmt.Sprintf("%s_%d", username, i)
+	}
+	return "", fmt.Errorf("no free username for %s", username)
+}
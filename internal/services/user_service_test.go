@@ -5,12 +5,12 @@ import (
 	"database/sql"
 	"errors"
 	"testing"
-	"time"
 
 	"github.com/bjschafer/print-dis/internal/models"
 	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestUserService_RegisterUser(t *testing.T) {
@@ -385,6 +385,8 @@ func TestUserService_ChangePassword(t *testing.T) {
 		// Setup expectations
 		mockDB.On("GetUser", ctx, user.ID).Return(user, nil)
 		mockDB.On("UpdateUser", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+		mockDB.On("DeleteUserSessionsByUserID", ctx, user.ID, "").Return(nil)
+		mockDB.On("DeleteAPITokensByUserID", ctx, user.ID).Return(nil)
 
 		// Execute
 		err = service.ChangePassword(ctx, user.ID, "oldpassword", "newpassword123")
@@ -478,6 +480,8 @@ func TestUserService_DisableUser(t *testing.T) {
 		// Setup expectations
 		mockDB.On("GetUser", ctx, user.ID).Return(user, nil)
 		mockDB.On("UpdateUser", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+		mockDB.On("DeleteUserSessionsByUserID", ctx, user.ID, "").Return(nil)
+		mockDB.On("DeleteAPITokensByUserID", ctx, user.ID).Return(nil)
 
 		// Execute
 		err := service.DisableUser(ctx, user.ID)
@@ -566,6 +570,17 @@ func TestUserService_ListUsers(t *testing.T) {
 		mockDB.AssertExpectations(t)
 	})
 
+	t.Run("placeholder for deleted users is hidden", func(t *testing.T) {
+		mockDB := &MockDBClient{}
+		service := NewUserService(mockDB)
+
+		mockDB.On("ListUsers", ctx).Return([]*models.User{{ID: "user-1"}, {ID: models.DeletedUserID}}, nil)
+
+		users, err := service.ListUsers(ctx)
+		assert.NoError(t, err)
+		assert.Equal(t, []*models.User{{ID: "user-1"}}, users)
+	})
+
 	t.Run("empty user list", func(t *testing.T) {
 		mockDB := &MockDBClient{}
 		service := NewUserService(mockDB)
@@ -600,35 +615,58 @@ func TestUserService_ListUsers(t *testing.T) {
 	})
 }
 
-func TestUserService_CreateSession(t *testing.T) {
+func TestUserService_FindOrCreateUserFromOIDC(t *testing.T) {
 	ctx := context.Background()
 
-	t.Run("successful session creation", func(t *testing.T) {
+	t.Run("find user by linked identity", func(t *testing.T) {
 		mockDB := &MockDBClient{}
 		service := NewUserService(mockDB)
 
-		userID := uuid.New().String()
-		duration := 24 * time.Hour
+		existingUser := &models.User{
+			ID:       uuid.New().String(),
+			Username: "existinguser",
+			Email:    stringPtr("other@example.com"),
+			Enabled:  true,
+		}
+
+		// Setup expectations
+		mockDB.On("GetOIDCIdentity", ctx, "google", "12345").Return(&models.UserOIDCIdentity{UserID: existingUser.ID, ProviderName: "google", Subject: "12345"}, nil)
+		mockDB.On("GetUser", ctx, existingUser.ID).Return(existingUser, nil)
 
 		// Execute
-		session, err := service.CreateSession(ctx, userID, duration)
+		user, err := service.FindOrCreateUserFromOIDC(ctx, OIDCProfile{Provider: "google", Subject: "12345", Email: "test@example.com", DisplayName: "Test User"})
 
 		// Verify
 		assert.NoError(t, err)
-		assert.NotNil(t, session)
-		assert.Equal(t, userID, session.UserID)
-		assert.NotEmpty(t, session.ID)
-		assert.NotEmpty(t, session.SessionToken)
-		assert.True(t, session.ExpiresAt.After(time.Now()))
-		assert.True(t, session.ExpiresAt.Before(time.Now().Add(duration+time.Minute)))
+		assert.NotNil(t, user)
+		assert.Equal(t, existingUser.ID, user.ID)
+		assert.Equal(t, existingUser.Username, user.Username)
+		mockDB.AssertExpectations(t)
 	})
-}
 
-func TestUserService_FindOrCreateUserFromOIDC(t *testing.T) {
-	ctx := context.Background()
+	t.Run("update role of linked user from groups", func(t *testing.T) {
+		mockDB := &MockDBClient{}
+		service := NewUserService(mockDB)
+
+		existingUser := &models.User{ID: uuid.New().String(), Username: "existinguser", Role: models.RoleModerator, Enabled: true}
 
-	t.Run("find existing user by email", func(t *testing.T) {
+		mockDB.On("GetOIDCIdentity", ctx, "authentik", "12345").Return(&models.UserOIDCIdentity{UserID: existingUser.ID}, nil)
+		mockDB.On("GetUser", ctx, existingUser.ID).Return(existingUser, nil)
+		mockDB.On("UpdateUser", ctx, mock.MatchedBy(func(user *models.User) bool {
+			return user.ID == existingUser.ID && user.Role == models.RoleUser
+		})).Return(nil)
+
+		// Removed from the provider's moderators group
+		user, err := service.FindOrCreateUserFromOIDC(ctx, OIDCProfile{Provider: "authentik", Subject: "12345", Role: models.RoleUser})
+
+		assert.NoError(t, err)
+		assert.Equal(t, models.RoleUser, user.Role)
+		mockDB.AssertExpectations(t)
+	})
+
+	t.Run("never link existing user by email", func(t *testing.T) {
 		mockDB := &MockDBClient{}
+		mockTx := &MockTx{}
 		service := NewUserService(mockDB)
 
 		existingUser := &models.User{
@@ -639,29 +677,41 @@ func TestUserService_FindOrCreateUserFromOIDC(t *testing.T) {
 		}
 
 		// Setup expectations
-		mockDB.On("GetUserByEmail", ctx, "test@example.com").Return(existingUser, nil)
+		mockDB.On("GetOIDCIdentity", ctx, "google", "12345").Return(nil, nil)
+		mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+		mockTx.On("GetUserByEmail", ctx, "test@example.com").Return(existingUser, nil)
+		mockTx.On("Rollback").Return(nil)
 
 		// Execute
-		user, err := service.FindOrCreateUserFromOIDC(ctx, "google", "12345", "test@example.com", "Test User")
+		user, err := service.FindOrCreateUserFromOIDC(ctx, OIDCProfile{Provider: "google", Subject: "12345", Email: "test@example.com", DisplayName: "Test User"})
 
 		// Verify
-		assert.NoError(t, err)
-		assert.NotNil(t, user)
-		assert.Equal(t, existingUser.ID, user.ID)
-		assert.Equal(t, existingUser.Username, user.Username)
+		assert.ErrorIs(t, err, ErrOIDCEmailInUse)
+		assert.Nil(t, user)
+		mockTx.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+		mockTx.AssertNotCalled(t, "CreateOIDCIdentity", mock.Anything, mock.Anything)
 		mockDB.AssertExpectations(t)
+		mockTx.AssertExpectations(t)
 	})
 
 	t.Run("create new user from OIDC with email", func(t *testing.T) {
 		mockDB := &MockDBClient{}
+		mockTx := &MockTx{}
 		service := NewUserService(mockDB)
 
 		// Setup expectations
-		mockDB.On("GetUserByEmail", ctx, "new@example.com").Return(nil, sql.ErrNoRows)
-		mockDB.On("CreateUser", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+		mockDB.On("GetOIDCIdentity", ctx, "google", "12345").Return(nil, nil)
+		mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+		mockTx.On("GetUserByEmail", ctx, "new@example.com").Return(nil, sql.ErrNoRows)
+		mockTx.On("GetUserByUsername", ctx, "new@example.com").Return(nil, sql.ErrNoRows)
+		mockTx.On("CreateUser", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+		mockTx.On("CreateOIDCIdentity", ctx, mock.MatchedBy(func(identity *models.UserOIDCIdentity) bool {
+			return identity.ProviderName == "google" && identity.Subject == "12345" && identity.UserID != ""
+		})).Return(nil)
+		mockTx.On("Commit").Return(nil)
 
 		// Execute
-		user, err := service.FindOrCreateUserFromOIDC(ctx, "google", "12345", "new@example.com", "New User")
+		user, err := service.FindOrCreateUserFromOIDC(ctx, OIDCProfile{Provider: "google", Subject: "12345", Email: "new@example.com", DisplayName: "New User"})
 
 		// Verify
 		assert.NoError(t, err)
@@ -671,47 +721,163 @@ func TestUserService_FindOrCreateUserFromOIDC(t *testing.T) {
 		assert.Equal(t, "New User", *user.DisplayName)
 		assert.True(t, user.Enabled)
 		mockDB.AssertExpectations(t)
+		mockTx.AssertExpectations(t)
+	})
+
+	t.Run("create new user from OIDC with preferred username and role", func(t *testing.T) {
+		mockDB := &MockDBClient{}
+		mockTx := &MockTx{}
+		service := NewUserService(mockDB)
+
+		mockDB.On("GetOIDCIdentity", ctx, "authentik", "12345").Return(nil, nil)
+		mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+		mockTx.On("GetUserByEmail", ctx, "alice@example.com").Return(nil, nil)
+		mockTx.On("GetUserByUsername", ctx, "alice").Return(nil, nil)
+		mockTx.On("CreateUser", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+		mockTx.On("CreateOIDCIdentity", ctx, mock.AnythingOfType("*models.UserOIDCIdentity")).Return(nil)
+		mockTx.On("Commit").Return(nil)
+
+		user, err := service.FindOrCreateUserFromOIDC(ctx, OIDCProfile{Provider: "authentik", Subject: "12345", Username: "alice", Email: "alice@example.com", Role: models.RoleAdmin})
+
+		assert.NoError(t, err)
+		assert.Equal(t, "alice", user.Username)
+		assert.Equal(t, models.RoleAdmin, user.Role)
+		mockDB.AssertExpectations(t)
+		mockTx.AssertExpectations(t)
 	})
 
 	t.Run("create new user from OIDC without email", func(t *testing.T) {
 		mockDB := &MockDBClient{}
+		mockTx := &MockTx{}
 		service := NewUserService(mockDB)
 
 		// Setup expectations
-		mockDB.On("CreateUser", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+		mockDB.On("GetOIDCIdentity", ctx, "google", "12345").Return(nil, nil)
+		mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+		mockTx.On("GetUserByUsername", ctx, "google_12345").Return(&models.User{ID: "taken"}, nil)
+		mockTx.On("GetUserByUsername", ctx, "google_12345_2").Return(nil, nil)
+		mockTx.On("CreateUser", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+		mockTx.On("CreateOIDCIdentity", ctx, mock.AnythingOfType("*models.UserOIDCIdentity")).Return(nil)
+		mockTx.On("Commit").Return(nil)
 
 		// Execute
-		user, err := service.FindOrCreateUserFromOIDC(ctx, "google", "12345", "", "New User")
+		user, err := service.FindOrCreateUserFromOIDC(ctx, OIDCProfile{Provider: "google", Subject: "12345", DisplayName: "New User"})
 
 		// Verify
 		assert.NoError(t, err)
 		assert.NotNil(t, user)
-		assert.Equal(t, "google_12345", user.Username)
+		assert.Equal(t, "google_12345_2", user.Username)
 		assert.Nil(t, user.Email)
 		assert.Equal(t, "New User", *user.DisplayName)
 		assert.True(t, user.Enabled)
 		mockDB.AssertExpectations(t)
+		mockTx.AssertExpectations(t)
 	})
 
 	t.Run("database error on create user", func(t *testing.T) {
 		mockDB := &MockDBClient{}
+		mockTx := &MockTx{}
 		service := NewUserService(mockDB)
 
 		dbErr := errors.New("database insert error")
-		mockDB.On("GetUserByEmail", ctx, "test@example.com").Return(nil, sql.ErrNoRows)
-		mockDB.On("CreateUser", ctx, mock.AnythingOfType("*models.User")).Return(dbErr)
+		mockDB.On("GetOIDCIdentity", ctx, "google", "12345").Return(nil, nil)
+		mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+		mockTx.On("GetUserByEmail", ctx, "test@example.com").Return(nil, sql.ErrNoRows)
+		mockTx.On("GetUserByUsername", ctx, "test@example.com").Return(nil, sql.ErrNoRows)
+		mockTx.On("CreateUser", ctx, mock.AnythingOfType("*models.User")).Return(dbErr)
+		mockTx.On("Rollback").Return(nil)
 
 		// Execute
-		user, err := service.FindOrCreateUserFromOIDC(ctx, "google", "12345", "test@example.com", "Test User")
+		user, err := service.FindOrCreateUserFromOIDC(ctx, OIDCProfile{Provider: "google", Subject: "12345", Email: "test@example.com", DisplayName: "Test User"})
 
 		// Verify
 		assert.Error(t, err)
 		assert.Nil(t, user)
 		assert.Contains(t, err.Error(), "failed to create user from OIDC")
 		mockDB.AssertExpectations(t)
+		mockTx.AssertExpectations(t)
 	})
 }
 
+func TestUserService_LinkOIDCIdentity(t *testing.T) {
+	ctx := context.Background()
+
+	mockDB := &MockDBClient{}
+	service := NewUserService(mockDB)
+
+	mockDB.On("GetOIDCIdentity", ctx, "google", "new").Return(nil, nil)
+	mockDB.On("GetOIDCIdentity", ctx, "google", "mine").Return(&models.UserOIDCIdentity{UserID: "user-1"}, nil)
+	mockDB.On("GetOIDCIdentity", ctx, "google", "theirs").Return(&models.UserOIDCIdentity{UserID: "user-2"}, nil)
+	mockDB.On("CreateOIDCIdentity", ctx, mock.MatchedBy(func(identity *models.UserOIDCIdentity) bool {
+		return identity.UserID == "user-1" && identity.Subject == "new"
+	})).Return(nil).Once()
+
+	assert.NoError(t, service.LinkOIDCIdentity(ctx, "user-1", "google", "new"))
+	assert.NoError(t, service.LinkOIDCIdentity(ctx, "user-1", "google", "mine"))
+	assert.ErrorIs(t, service.LinkOIDCIdentity(ctx, "user-1", "google", "theirs"), ErrOIDCIdentityLinked)
+	mockDB.AssertExpectations(t)
+}
+
+func TestUserService_CreateUser(t *testing.T) {
+	ctx := context.Background()
+	mockDB := &MockDBClient{}
+	mockTx := &MockTx{}
+	service := NewUserService(mockDB)
+
+	mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+	mockTx.On("GetUserByUsername", ctx, "newbie").Return(nil, nil)
+	mockTx.On("GetUserByUsername", ctx, "taken").Return(&models.User{ID: "user-1"}, nil)
+	mockTx.On("GetUserByEmail", ctx, "newbie@example.com").Return(nil, nil)
+	mockTx.On("CreateUser", ctx, mock.AnythingOfType("*models.User")).Return(nil)
+	mockTx.On("Commit").Return(nil)
+	mockTx.On("Rollback").Return(nil)
+
+	user, password, err := service.CreateUser(ctx, "newbie", "newbie@example.com", "", models.RoleModerator)
+	require.NoError(t, err)
+	assert.True(t, user.CheckPassword(password))
+	assert.True(t, user.MustChangePassword)
+	assert.Equal(t, models.RoleModerator, user.Role)
+	assert.NotNil(t, user.EmailVerifiedAt)
+	assert.Nil(t, user.DisplayName)
+
+	_, _, err = service.CreateUser(ctx, "taken", "", "", models.RoleUser)
+	assert.ErrorIs(t, err, ErrUsernameTaken)
+	mockTx.AssertCalled(t, "Rollback")
+}
+
+func TestUserService_DeleteUser(t *testing.T) {
+	ctx := context.Background()
+	mockDB := &MockDBClient{}
+	mockTx := &MockTx{}
+	service := NewUserService(mockDB)
+
+	// Invalid deletions are refused without touching the database
+	_, err := service.DeleteUser(ctx, models.DeletedUserID, "")
+	assert.ErrorIs(t, err, ErrUserNotFound)
+	_, err = service.DeleteUser(ctx, "user-1", "user-1")
+	assert.ErrorIs(t, err, ErrInvalidReassignment)
+	mockDB.AssertNotCalled(t, "BeginTx", ctx)
+
+	// Print requests are anonymised unless a user to reassign them to is
+	// given
+	mockDB.On("BeginTx", ctx).Return(mockTx, nil)
+	mockTx.On("GetUser", ctx, "user-1").Return(&models.User{ID: "user-1"}, nil)
+	mockTx.On("GetUser", ctx, models.DeletedUserID).Return(&models.User{ID: models.DeletedUserID}, nil)
+	mockTx.On("GetUser", ctx, "ghost").Return(nil, nil)
+	mockTx.On("ReassignUserRecords", ctx, "user-1", models.DeletedUserID).Return(int64(3), nil)
+	mockTx.On("DeleteUser", ctx, "user-1").Return(nil)
+	mockTx.On("Commit").Return(nil)
+	mockTx.On("Rollback").Return(nil)
+
+	moved, err := service.DeleteUser(ctx, "user-1", "")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), moved)
+
+	_, err = service.DeleteUser(ctx, "user-1", "ghost")
+	assert.ErrorIs(t, err, ErrInvalidReassignment)
+	mockTx.AssertNumberOfCalls(t, "DeleteUser", 1)
+}
+
 // Helper function to create string pointer
 func stringPtr(s string) *string {
 	return &s
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/database"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/webauthn"
+	"github.com/google/uuid"
+)
+
+// defaultCredentialName names credentials registered without a name
+const defaultCredentialName = "Passkey"
+
+var (
+	// ErrWebAuthnCredentialNotFound is returned when a credential does not
+	// exist or belongs to another user
+	ErrWebAuthnCredentialNotFound = errors.New("WebAuthn credential not found")
+	// ErrWebAuthnCredentialExists is returned when registering a credential
+	// that is already registered
+	ErrWebAuthnCredentialExists = errors.New("WebAuthn credential is already registered")
+)
+
+// WebAuthnService manages security keys and passkeys, and logging in with them
+type WebAuthnService struct {
+	db     database.DBClient
+	config config.WebAuthnConfig
+	now    func() time.Time
+	logger *slog.Logger
+}
+
+// NewWebAuthnService creates a new WebAuthn service
+func NewWebAuthnService(db database.DBClient, cfg config.WebAuthnConfig) *WebAuthnService {
+	return &WebAuthnService{
+		db:     db,
+		config: cfg,
+		now:    time.Now,
+		logger: slog.Default(),
+	}
+}
+
+// RelyingParty returns the configured relying party. Its ID and origins are
+// never taken from requests, which could claim to be for any host.
+func (s *WebAuthnService) RelyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:      s.config.RPID,
+		Name:    cmp.Or(s.config.RPName, "print-dis"),
+		Origins: s.config.Origins,
+	}
+}
+
+// ListCredentials returns the user's credentials
+func (s *WebAuthnService) ListCredentials(ctx context.Context, userID string) ([]*models.WebAuthnCredential, error) {
+	return s.db.ListWebAuthnCredentialsByUserID(ctx, userID)
+}
+
+// BeginRegistration returns the options for the user's browser to register a
+// new credential
+func (s *WebAuthnService) BeginRegistration(ctx context.Context, user *models.User) (*webauthn.CreationOptions, error) {
+	credentials, err := s.db.ListWebAuthnCredentialsByUserID(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	existing := make([][]byte, 0, len(credentials))
+	for _, credential := range credentials {
+		if id, err := base64.RawURLEncoding.DecodeString(credential.CredentialID); err == nil {
+			existing = append(existing, id)
+		}
+	}
+
+	displayName := user.Username
+	if user.DisplayName != nil && *user.DisplayName != "" {
+		displayName = *user.DisplayName
+	}
+	return s.RelyingParty().BeginRegistration(webauthn.User{
+		ID:          []byte(user.ID),
+		Name:        user.Username,
+		DisplayName: displayName,
+	}, existing)
+}
+
+// FinishRegistration verifies and stores a new credential for the user
+func (s *WebAuthnService) FinishRegistration(ctx context.Context, userID, name string, challenge []byte, response *webauthn.RegistrationResponse) (*models.WebAuthnCredential, error) {
+	verified, err := s.RelyingParty().FinishRegistration(response, challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialID := base64.RawURLEncoding.EncodeToString(verified.ID)
+	existing, err := s.db.GetWebAuthnCredential(ctx, credentialID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrWebAuthnCredentialExists
+	}
+
+	credential := &models.WebAuthnCredential{
+		ID:           uuid.New().String(),
+		UserID:       userID,
+		Name:         cmp.Or(name, defaultCredentialName),
+		CredentialID: credentialID,
+		PublicKey:    verified.PublicKey,
+		SignCount:    int64(verified.SignCount),
+		CreatedAt:    s.now(),
+	}
+	if err := s.db.CreateWebAuthnCredential(ctx, credential); err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("registered WebAuthn credential", "credential_id", credential.ID, "user_id", userID)
+	return credential, nil
+}
+
+// BeginLogin returns the options for the browser to log in with any passkey
+// registered for the site
+func (s *WebAuthnService) BeginLogin() (*webauthn.RequestOptions, error) {
+	return s.RelyingParty().BeginLogin(nil)
+}
+
+// FinishLogin verifies a login with a registered credential and returns the
+// user it belongs to. Disabled users are returned, for the caller to refuse.
+func (s *WebAuthnService) FinishLogin(ctx context.Context, challenge []byte, response *webauthn.AssertionResponse) (*models.User, error) {
+	credential, err := s.db.GetWebAuthnCredential(ctx, base64.RawURLEncoding.EncodeToString(response.RawID))
+	if err != nil {
+		return nil, err
+	}
+	if credential == nil {
+		return nil, fmt.Errorf("%w: unknown credential", webauthn.ErrInvalidResponse)
+	}
+	// Passkeys name the user they were registered for
+	if len(response.Response.UserHandle) > 0 && string(response.Response.UserHandle) != credential.UserID {
+		return nil, fmt.Errorf("%w: credential belongs to another user", webauthn.ErrInvalidResponse)
+	}
+
+	signCount, err := s.RelyingParty().FinishLogin(response, challenge, &webauthn.Credential{
+		ID:        response.RawID,
+		PublicKey: credential.PublicKey,
+		SignCount: uint32(credential.SignCount),
+	})
+	if err != nil {
+		s.logger.Warn("WebAuthn login failed", "credential_id", credential.ID, "user_id", credential.UserID, "error", err)
+		return nil, err
+	}
+	if err := s.db.UpdateWebAuthnCredentialUsage(ctx, credential.ID, int64(signCount), s.now()); err != nil {
+		return nil, err
+	}
+
+	user, err := s.db.GetUser(ctx, credential.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, fmt.Errorf("%w: unknown user", webauthn.ErrInvalidResponse)
+	}
+	return user, nil
+}
+
+// DeleteCredential removes one of the user's credentials
+func (s *WebAuthnService) DeleteCredential(ctx context.Context, userID, id string) error {
+	credentials, err := s.db.ListWebAuthnCredentialsByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, credential := range credentials {
+		if credential.ID != id {
+			continue
+		}
+		if err := s.db.DeleteWebAuthnCredential(ctx, id); err != nil {
+			return err
+		}
+		s.logger.Info("deleted WebAuthn credential", "credential_id", id, "user_id", userID)
+		return nil
+	}
+	return ErrWebAuthnCredentialNotFound
+}
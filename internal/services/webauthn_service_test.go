@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/bjschafer/print-dis/internal/config"
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/bjschafer/print-dis/internal/webauthn"
+	"github.com/bjschafer/print-dis/internal/webauthn/webauthntest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+const testOrigin = "https://print.example.com"
+
+// testWebAuthnConfig is the relying party the tests' authenticator uses
+var testWebAuthnConfig = config.WebAuthnConfig{RPID: "print.example.com", Origins: []string{testOrigin}}
+
+func TestWebAuthnRelyingParty(t *testing.T) {
+	service := NewWebAuthnService(new(MockDBClient), testWebAuthnConfig)
+	rp := service.RelyingParty()
+	assert.Equal(t, "print.example.com", rp.ID)
+	assert.Equal(t, []string{testOrigin}, rp.Origins)
+}
+
+func TestWebAuthnLoginChecksUserHandle(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	service := NewWebAuthnService(mockDB, testWebAuthnConfig)
+	authenticator := webauthntest.NewAuthenticator(testOrigin)
+
+	// Register a credential for u1
+	mockDB.On("ListWebAuthnCredentialsByUserID", ctx, "u1").Return([]*models.WebAuthnCredential{}, nil)
+	options, err := service.BeginRegistration(ctx, &models.User{ID: "u1", Username: "alice"})
+	require.NoError(t, err)
+	registration, err := authenticator.Register(options)
+	require.NoError(t, err)
+	mockDB.On("GetWebAuthnCredential", ctx, registration.ID).Return(nil, nil).Once()
+	mockDB.On("CreateWebAuthnCredential", ctx, mock.AnythingOfType("*models.WebAuthnCredential")).Return(nil)
+	credential, err := service.FinishRegistration(ctx, "u1", "", options.Challenge, registration)
+	require.NoError(t, err)
+	assert.Equal(t, defaultCredentialName, credential.Name)
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(registration.RawID), credential.CredentialID)
+
+	// The stored credential is claimed by another user's passkey
+	credential.UserID = "u2"
+	mockDB.On("GetWebAuthnCredential", ctx, credential.CredentialID).Return(credential, nil)
+	request, err := service.BeginLogin()
+	require.NoError(t, err)
+	assertion, err := authenticator.Login(request)
+	require.NoError(t, err)
+	_, err = service.FinishLogin(ctx, request.Challenge, assertion)
+	assert.ErrorIs(t, err, webauthn.ErrInvalidResponse)
+	mockDB.AssertNotCalled(t, "UpdateWebAuthnCredentialUsage", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestDeleteWebAuthnCredential(t *testing.T) {
+	ctx := context.Background()
+	mockDB := new(MockDBClient)
+	service := NewWebAuthnService(mockDB, config.WebAuthnConfig{})
+
+	mockDB.On("ListWebAuthnCredentialsByUserID", ctx, "u1").Return([]*models.WebAuthnCredential{{ID: "c1", UserID: "u1"}}, nil)
+	mockDB.On("DeleteWebAuthnCredential", ctx, "c1").Return(nil)
+
+	// Other users' credentials are not found
+	assert.ErrorIs(t, service.DeleteCredential(ctx, "u1", "c2"), ErrWebAuthnCredentialNotFound)
+	assert.NoError(t, service.DeleteCredential(ctx, "u1", "c1"))
+	mockDB.AssertNumberOfCalls(t, "DeleteWebAuthnCredential", 1)
+}
@@ -196,58 +196,152 @@ func (c *Client) GetSpools(ctx context.Context) ([]Spool, error) {
 	return spools, nil
 }
 
+// GetMaterials returns the distinct materials of all filaments known to Spoolman
 func (c *Client) GetMaterials(ctx context.Context) ([]string, error) {
-	u, err := url.JoinPath(c.endpoint, "filament")
-	if err != nil {
-		slog.Error("failed to construct materials URL", "error", err)
+	var materials []string
+	if err := c.getJSON(ctx, "materials", &materials, "material"); err != nil {
+		return nil, err
+	}
+	slog.Debug("successfully retrieved materials", "count", len(materials))
+	return materials, nil
+}
+
+// GetVendors returns all filament vendors
+func (c *Client) GetVendors(ctx context.Context) ([]Vendor, error) {
+	var vendors []Vendor
+	if err := c.getJSON(ctx, "vendors", &vendors, "vendor"); err != nil {
+		return nil, err
+	}
+	slog.Debug("successfully retrieved vendors", "count", len(vendors))
+	return vendors, nil
+}
+
+// GetFilaments returns the filament catalogue
+func (c *Client) GetFilaments(ctx context.Context) ([]Filament, error) {
+	var filaments []Filament
+	if err := c.getJSON(ctx, "filaments", &filaments, "filament"); err != nil {
+		return nil, err
+	}
+	slog.Debug("successfully retrieved filaments", "count", len(filaments))
+	return filaments, nil
+}
+
+// GetLocations returns the names of all spool storage locations
+func (c *Client) GetLocations(ctx context.Context) ([]string, error) {
+	var locations []string
+	if err := c.getJSON(ctx, "locations", &locations, "location"); err != nil {
 		return nil, err
 	}
+	slog.Debug("successfully retrieved locations", "count", len(locations))
+	return locations, nil
+}
 
-	slog.Debug("requesting materials from Spoolman", "url", u)
+// getJSON performs a GET request against the given API path and decodes the JSON response into out.
+// what names the resource in log messages.
+func (c *Client) getJSON(ctx context.Context, what string, out any, path ...string) error {
+	u, err := url.JoinPath(c.endpoint, path...)
+	if err != nil {
+		slog.Error("failed to construct "+what+" URL", "error", err)
+		return err
+	}
+
+	slog.Debug("requesting "+what+" from Spoolman", "url", u)
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
 	if err != nil {
-		slog.Error("failed to create materials request", "url", u, "error", err)
-		return nil, err
+		slog.Error("failed to create "+what+" request", "url", u, "error", err)
+		return err
 	}
 	resp, err := c.client.Do(req)
 	if err != nil {
-		slog.Error("failed to execute materials request", "url", u, "error", err)
-		return nil, err
+		slog.Error("failed to execute "+what+" request", "url", u, "error", err)
+		return err
 	}
 	defer func() { _ = resp.Body.Close() }()
 
 	if resp.StatusCode != http.StatusOK {
 		slog.Error("unexpected status code from Spoolman", "url", u, "status", resp.StatusCode)
-		return nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 	}
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		slog.Error("failed to read materials response body", "url", u, "error", err)
-		return nil, err
+		slog.Error("failed to read "+what+" response body", "url", u, "error", err)
+		return err
 	}
 
-	var filaments []Filament
-	err = json.Unmarshal(body, &filaments)
+	if err := json.Unmarshal(body, out); err != nil {
+		slog.Error("failed to unmarshal "+what+" response", "url", u, "error", err)
+		return err
+	}
+	return nil
+}
+
+// SetExtraField registers an extra field for an entity type ("spool", "filament" or "vendor").
+// Spoolman updates the field if it already exists, so this is safe to call on every startup.
+func (c *Client) SetExtraField(ctx context.Context, entityType, key string, field ExtraField) error {
+	u, err := url.JoinPath(c.endpoint, "field", entityType, key)
 	if err != nil {
-		slog.Error("failed to unmarshal materials response", "url", u, "error", err)
+		slog.Error("failed to construct extra field URL", "entity_type", entityType, "key", key, "error", err)
+		return err
+	}
+
+	if err := c.sendJSON(ctx, http.MethodPost, u, field, nil); err != nil {
+		slog.Error("failed to register extra field", "entity_type", entityType, "key", key, "error", err)
+		return err
+	}
+	slog.Debug("successfully registered extra field", "entity_type", entityType, "key", key)
+	return nil
+}
+
+// UpdateSpoolExtra replaces the extra fields of a spool. Values must already be
+// JSON encoded, as Spoolman stores them verbatim.
+func (c *Client) UpdateSpoolExtra(ctx context.Context, id int, extra map[string]string) (*Spool, error) {
+	u, err := url.JoinPath(c.endpoint, "spool", strconv.Itoa(id))
+	if err != nil {
+		slog.Error("failed to construct spool URL", "id", id, "error", err)
 		return nil, err
 	}
 
-	// Extract unique materials
-	materials := make(map[string]struct{})
-	for _, f := range filaments {
-		if f.Material != "" {
-			materials[f.Material] = struct{}{}
-		}
+	s := new(Spool)
+	body := map[string]any{"extra": extra}
+	if err := c.sendJSON(ctx, http.MethodPatch, u, body, s); err != nil {
+		slog.Error("failed to update spool extra fields", "id", id, "error", err)
+		return nil, err
 	}
+	slog.Debug("successfully updated spool extra fields", "id", id)
+	return s, nil
+}
 
-	// Convert map to slice
-	result := make([]string, 0, len(materials))
-	for m := range materials {
-		result = append(result, m)
+// sendJSON sends body as JSON with the given method and decodes the response into out, if non-nil
+func (c *Client) sendJSON(ctx context.Context, method, u string, body, out any) error {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return err
 	}
 
-	slog.Debug("successfully retrieved materials", "count", len(result))
-	return result, nil
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		slog.Error("unexpected status code from Spoolman", "url", u, "method", method, "status", resp.StatusCode)
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+
+	if out == nil {
+		return nil
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(respBody, out)
 }
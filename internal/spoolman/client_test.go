@@ -69,3 +69,76 @@ func TestGetFilament(t *testing.T) {
 		})
 	}
 }
+
+func TestCatalogueEndpoints(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body any
+		switch r.URL.Path {
+		case "/material":
+			body = []string{"PETG", "PLA"}
+		case "/location":
+			body = []string{"Shelf A", "Dry box"}
+		case "/vendor":
+			body = []Vendor{{Id: 3, Name: "Prusament"}}
+		case "/filament":
+			body = []Filament{{
+				Id:                   7,
+				Name:                 "PETG Galaxy Black",
+				Vendor:               Vendor{Id: 3, Name: "Prusament"},
+				Material:             "PETG",
+				ColorHex:             "1f1f1f",
+				MultiColorHexes:      "1f1f1f,c0c0c0",
+				SettingsExtruderTemp: 250,
+				SettingsBedTemp:      85,
+			}}
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(body); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	c := Client{
+		endpoint: srv.URL,
+		client:   *srv.Client(),
+	}
+	ctx := context.Background()
+
+	materials, err := c.GetMaterials(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"PETG", "PLA"}, materials)
+
+	locations, err := c.GetLocations(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"Shelf A", "Dry box"}, locations)
+
+	vendors, err := c.GetVendors(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []Vendor{{Id: 3, Name: "Prusament"}}, vendors)
+
+	filaments, err := c.GetFilaments(ctx)
+	if assert.NoError(t, err) && assert.Len(t, filaments, 1) {
+		assert.Equal(t, "Prusament", filaments[0].Vendor.Name)
+		assert.Equal(t, "1f1f1f,c0c0c0", filaments[0].MultiColorHexes)
+		assert.Equal(t, 250, filaments[0].SettingsExtruderTemp)
+	}
+}
+
+func TestGetMaterialsUnexpectedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	c := Client{
+		endpoint: srv.URL,
+		client:   *srv.Client(),
+	}
+
+	materials, err := c.GetMaterials(context.Background())
+	assert.Error(t, err)
+	assert.Nil(t, materials)
+}
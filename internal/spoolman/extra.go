@@ -0,0 +1,118 @@
+package spoolman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+)
+
+// Extra fields print-dis maintains on Spoolman spools
+const (
+	ExtraFieldPrinter  = "print_dis_printer"
+	ExtraFieldRequests = "print_dis_requests"
+)
+
+// maxRecordedRequests is how many of the latest print requests are listed on
+// a spool, so that the list does not grow without bound
+const maxRecordedRequests = 50
+
+// spoolExtraFields are registered with Spoolman on startup
+var spoolExtraFields = map[string]ExtraField{
+	ExtraFieldPrinter:  {Name: "print-dis printer", FieldType: "text", Order: 100},
+	ExtraFieldRequests: {Name: "print-dis requests", FieldType: "text", Order: 101},
+}
+
+// RegisterExtraFields makes sure the spool extra fields written by print-dis exist in Spoolman
+func (s *Service) RegisterExtraFields(ctx context.Context) error {
+	for key, field := range spoolExtraFields {
+		if err := s.client.SetExtraField(ctx, "spool", key, field); err != nil {
+			return fmt.Errorf("failed to register spool extra field %s: %w", key, err)
+		}
+	}
+	slog.Info("registered Spoolman extra fields", "count", len(spoolExtraFields))
+	return nil
+}
+
+// RecordSpoolUsage records on the spool which printer it is loaded on and which
+// print request consumed it, keeping the latest maxRecordedRequests requests.
+// Empty values are left untouched.
+func (s *Service) RecordSpoolUsage(ctx context.Context, spoolID int, printerName, requestID string) error {
+	slog.Debug("recording spool usage in Spoolman", "spool_id", spoolID, "printer", printerName, "request_id", requestID)
+
+	// Always start from Spoolman's copy, since the whole extra map is replaced on update
+	spool, err := s.client.GetSpool(ctx, spoolID)
+	if err != nil {
+		return fmt.Errorf("failed to get spool: %w", err)
+	}
+
+	extra, err := encodeExtra(spool.Extra)
+	if err != nil {
+		return err
+	}
+
+	if printerName != "" {
+		extra[ExtraFieldPrinter] = encodeExtraString(printerName)
+	}
+	if requestID != "" {
+		var requests []string
+		if current := decodeExtraString(extra[ExtraFieldRequests]); current != "" {
+			for _, id := range strings.Split(current, ",") {
+				if id != "" && id != requestID && !slices.Contains(requests, id) {
+					requests = append(requests, id)
+				}
+			}
+		}
+		// The request is moved to the end, and only the latest are kept
+		requests = append(requests, requestID)
+		if len(requests) > maxRecordedRequests {
+			requests = requests[len(requests)-maxRecordedRequests:]
+		}
+		extra[ExtraFieldRequests] = encodeExtraString(strings.Join(requests, ","))
+	}
+
+	updated, err := s.client.UpdateSpoolExtra(ctx, spoolID, extra)
+	if err != nil {
+		return fmt.Errorf("failed to update spool: %w", err)
+	}
+	s.storeSpool(*updated)
+
+	slog.Info("recorded spool usage in Spoolman", "spool_id", spoolID, "printer", printerName, "request_id", requestID)
+	return nil
+}
+
+// encodeExtra converts extra fields as received from Spoolman back into the
+// JSON encoded form it expects on update
+func encodeExtra(extra map[string]any) (map[string]string, error) {
+	encoded := make(map[string]string, len(extra))
+	for key, value := range extra {
+		// Spoolman returns values in their encoded form already
+		if str, ok := value.(string); ok {
+			encoded[key] = str
+			continue
+		}
+		data, err := json.Marshal(value)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode extra field %s: %w", key, err)
+		}
+		encoded[key] = string(data)
+	}
+	return encoded, nil
+}
+
+// encodeExtraString encodes a text extra field value
+func encodeExtraString(value string) string {
+	data, _ := json.Marshal(value)
+	return string(data)
+}
+
+// decodeExtraString decodes a text extra field value, returning "" if it is unset or not text
+func decodeExtraString(value string) string {
+	var decoded string
+	if err := json.Unmarshal([]byte(value), &decoded); err != nil {
+		return ""
+	}
+	return decoded
+}
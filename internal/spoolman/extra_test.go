@@ -0,0 +1,169 @@
+package spoolman
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterExtraFields(t *testing.T) {
+	var mu sync.Mutex
+	registered := map[string]ExtraField{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+			return
+		}
+		var field ExtraField
+		if err := json.NewDecoder(r.Body).Decode(&field); err != nil {
+			t.Error(err)
+		}
+		mu.Lock()
+		registered[r.URL.Path] = field
+		mu.Unlock()
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer srv.Close()
+
+	service := NewService(&Client{endpoint: srv.URL, client: *srv.Client()})
+	require.NoError(t, service.RegisterExtraFields(context.Background()))
+
+	assert.Equal(t, "text", registered["/field/spool/"+ExtraFieldPrinter].FieldType)
+	assert.Equal(t, "text", registered["/field/spool/"+ExtraFieldRequests].FieldType)
+}
+
+func TestRecordSpoolUsage(t *testing.T) {
+	var patched map[string]map[string]string
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/spool/7" {
+			http.NotFound(w, r)
+			return
+		}
+
+		spool := Spool{Id: 7, Extra: map[string]any{
+			"nfc_id":           `"04a2"`,
+			ExtraFieldRequests: `"req-1"`,
+		}}
+		switch r.Method {
+		case http.MethodGet:
+		case http.MethodPatch:
+			if err := json.NewDecoder(r.Body).Decode(&patched); err != nil {
+				t.Error(err)
+			}
+			spool.Extra = map[string]any{}
+			for key, value := range patched["extra"] {
+				spool.Extra[key] = value
+			}
+		default:
+			http.Error(w, "unexpected method", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(spool); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	service := NewService(&Client{endpoint: srv.URL, client: *srv.Client()})
+	require.NoError(t, service.RecordSpoolUsage(context.Background(), 7, "Voron 2.4", "req-2"))
+
+	// Unrelated fields survive, the printer is set and the request is appended
+	assert.Equal(t, map[string]string{
+		"nfc_id":           `"04a2"`,
+		ExtraFieldPrinter:  `"Voron 2.4"`,
+		ExtraFieldRequests: `"req-1,req-2"`,
+	}, patched["extra"])
+
+	// Recording the same request again does not duplicate it
+	require.NoError(t, service.RecordSpoolUsage(context.Background(), 7, "", "req-1"))
+	assert.Equal(t, `"req-1"`, patched["extra"][ExtraFieldRequests])
+	assert.NotContains(t, patched["extra"], ExtraFieldPrinter)
+}
+
+func TestRecordSpoolUsageKeepsLatestRequests(t *testing.T) {
+	var patched map[string]map[string]string
+	existing := make([]string, 0, maxRecordedRequests+1)
+	for i := range maxRecordedRequests {
+		existing = append(existing, fmt.Sprintf("req-%d", i))
+	}
+	existing = append(existing, "req-0")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		spool := Spool{Id: 7, Extra: map[string]any{ExtraFieldRequests: encodeExtraString(strings.Join(existing, ","))}}
+		if r.Method == http.MethodPatch {
+			if err := json.NewDecoder(r.Body).Decode(&patched); err != nil {
+				t.Error(err)
+			}
+		}
+		if err := json.NewEncoder(w).Encode(spool); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	service := NewService(&Client{endpoint: srv.URL, client: *srv.Client()})
+	require.NoError(t, service.RecordSpoolUsage(context.Background(), 7, "", "req-new"))
+
+	// Duplicates are dropped and the oldest requests make way for the new one
+	requests := strings.Split(decodeExtraString(patched["extra"][ExtraFieldRequests]), ",")
+	assert.Len(t, requests, maxRecordedRequests)
+	assert.Equal(t, "req-1", requests[0])
+	assert.Equal(t, "req-new", requests[len(requests)-1])
+}
+
+func TestUsageRecorderRetries(t *testing.T) {
+	var mu sync.Mutex
+	registrations, patches := 0, 0
+	recorded := make(chan string, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/field/"):
+			// Spoolman is down when print-dis starts
+			if registrations++; registrations <= 2 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte("[]"))
+		case r.Method == http.MethodGet:
+			_ = json.NewEncoder(w).Encode(Spool{Id: 7})
+		case r.Method == http.MethodPatch:
+			if patches++; patches == 1 {
+				http.Error(w, "unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			var body map[string]map[string]string
+			_ = json.NewDecoder(r.Body).Decode(&body)
+			_ = json.NewEncoder(w).Encode(Spool{Id: 7})
+			recorded <- body["extra"][ExtraFieldRequests]
+		}
+	}))
+	defer srv.Close()
+
+	recorder := NewUsageRecorder(NewService(&Client{endpoint: srv.URL, client: *srv.Client()}))
+	recorder.minBackoff = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go recorder.Run(ctx)
+
+	require.NoError(t, recorder.RecordSpoolUsage(ctx, 7, "", "req-1"))
+	select {
+	case requests := <-recorded:
+		assert.Equal(t, `"req-1"`, requests)
+	case <-time.After(5 * time.Second):
+		t.Fatal("spool usage was not recorded")
+	}
+}
@@ -3,13 +3,22 @@ package spoolman
 import (
 	"context"
 	"log/slog"
+	"sort"
 	"sync"
 )
 
 // Service handles Spoolman integration
+//
+// Spools and filaments are cached while a Subscriber is connected to
+// Spoolman's change feed, since every change is then pushed to us. Without a
+// live feed, reads always go straight to Spoolman.
 type Service struct {
 	client *Client
 	mu     sync.RWMutex
+
+	live      bool
+	spools    map[int]Spool
+	filaments map[int]Filament
 }
 
 // NewService creates a new Spoolman service
@@ -22,14 +31,29 @@ func NewService(client *Client) *Service {
 // GetSpool retrieves a spool by ID
 func (s *Service) GetSpool(ctx context.Context, id int) (*Spool, error) {
 	slog.Debug("getting spool from Spoolman", "id", id)
+
 	s.mu.RLock()
-	defer s.mu.RUnlock()
+	if s.live && s.spools != nil {
+		if spool, ok := s.spools[id]; ok {
+			s.mu.RUnlock()
+			slog.Debug("serving spool from cache", "id", id)
+			return &spool, nil
+		}
+	}
+	s.mu.RUnlock()
 
 	spool, err := s.client.GetSpool(ctx, id)
 	if err != nil {
 		slog.Error("failed to get spool from Spoolman", "id", id, "error", err)
 		return nil, err
 	}
+
+	s.mu.Lock()
+	if s.live && s.spools != nil {
+		s.spools[spool.Id] = *spool
+	}
+	s.mu.Unlock()
+
 	slog.Debug("successfully retrieved spool from Spoolman", "id", id)
 	return spool, nil
 }
@@ -37,14 +61,31 @@ func (s *Service) GetSpool(ctx context.Context, id int) (*Spool, error) {
 // GetSpools retrieves all available spools
 func (s *Service) GetSpools(ctx context.Context) ([]Spool, error) {
 	slog.Debug("getting all spools from Spoolman")
+
 	s.mu.RLock()
-	defer s.mu.RUnlock()
+	if s.live && s.spools != nil {
+		spools := sortedSpools(s.spools)
+		s.mu.RUnlock()
+		slog.Debug("serving spools from cache", "count", len(spools))
+		return spools, nil
+	}
+	s.mu.RUnlock()
 
 	spools, err := s.client.GetSpools(ctx)
 	if err != nil {
 		slog.Error("failed to get spools from Spoolman", "error", err)
 		return nil, err
 	}
+
+	s.mu.Lock()
+	if s.live {
+		s.spools = make(map[int]Spool, len(spools))
+		for _, spool := range spools {
+			s.spools[spool.Id] = spool
+		}
+	}
+	s.mu.Unlock()
+
 	slog.Debug("successfully retrieved spools from Spoolman", "count", len(spools))
 	return spools, nil
 }
@@ -52,8 +93,6 @@ func (s *Service) GetSpools(ctx context.Context) ([]Spool, error) {
 // GetMaterials retrieves all unique materials from Spoolman
 func (s *Service) GetMaterials(ctx context.Context) ([]string, error) {
 	slog.Debug("getting materials from Spoolman")
-	s.mu.RLock()
-	defer s.mu.RUnlock()
 
 	materials, err := s.client.GetMaterials(ctx)
 	if err != nil {
@@ -64,17 +103,161 @@ func (s *Service) GetMaterials(ctx context.Context) ([]string, error) {
 	return materials, nil
 }
 
+// GetVendors retrieves all filament vendors from Spoolman
+func (s *Service) GetVendors(ctx context.Context) ([]Vendor, error) {
+	slog.Debug("getting vendors from Spoolman")
+
+	vendors, err := s.client.GetVendors(ctx)
+	if err != nil {
+		slog.Error("failed to get vendors from Spoolman", "error", err)
+		return nil, err
+	}
+	slog.Debug("successfully retrieved vendors from Spoolman", "count", len(vendors))
+	return vendors, nil
+}
+
+// GetFilaments retrieves the filament catalogue from Spoolman
+func (s *Service) GetFilaments(ctx context.Context) ([]Filament, error) {
+	slog.Debug("getting filaments from Spoolman")
+
+	filaments, err := s.client.GetFilaments(ctx)
+	if err != nil {
+		slog.Error("failed to get filaments from Spoolman", "error", err)
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.live {
+		s.filaments = make(map[int]Filament, len(filaments))
+		for _, filament := range filaments {
+			s.filaments[filament.Id] = filament
+		}
+	}
+	s.mu.Unlock()
+
+	slog.Debug("successfully retrieved filaments from Spoolman", "count", len(filaments))
+	return filaments, nil
+}
+
+// GetLocations retrieves all spool storage locations from Spoolman
+func (s *Service) GetLocations(ctx context.Context) ([]string, error) {
+	slog.Debug("getting locations from Spoolman")
+
+	locations, err := s.client.GetLocations(ctx)
+	if err != nil {
+		slog.Error("failed to get locations from Spoolman", "error", err)
+		return nil, err
+	}
+	slog.Debug("successfully retrieved locations from Spoolman", "count", len(locations))
+	return locations, nil
+}
+
 // GetFilament retrieves filament information by ID
 func (s *Service) GetFilament(ctx context.Context, id int) (*Filament, error) {
 	slog.Debug("getting filament from Spoolman", "id", id)
+
 	s.mu.RLock()
-	defer s.mu.RUnlock()
+	if s.live && s.filaments != nil {
+		if filament, ok := s.filaments[id]; ok {
+			s.mu.RUnlock()
+			slog.Debug("serving filament from cache", "id", id)
+			return &filament, nil
+		}
+	}
+	s.mu.RUnlock()
 
 	filament, err := s.client.GetFilament(ctx, id)
 	if err != nil {
 		slog.Error("failed to get filament from Spoolman", "id", id, "error", err)
 		return nil, err
 	}
+
+	s.mu.Lock()
+	if s.live {
+		if s.filaments == nil {
+			s.filaments = make(map[int]Filament)
+		}
+		s.filaments[filament.Id] = *filament
+	}
+	s.mu.Unlock()
+
 	slog.Debug("successfully retrieved filament from Spoolman", "id", id)
 	return filament, nil
 }
+
+// setLive marks whether a change feed is currently keeping the cache up to date.
+// The cache is always dropped on a transition since events may have been missed.
+func (s *Service) setLive(live bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.live = live
+	s.spools = nil
+	s.filaments = nil
+}
+
+// Invalidate drops all cached spools and filaments
+func (s *Service) Invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spools = nil
+	s.filaments = nil
+}
+
+// storeSpool updates a spool in the cache, if the spool list is cached
+func (s *Service) storeSpool(spool Spool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.live && s.spools != nil {
+		s.spools[spool.Id] = spool
+	}
+}
+
+// evictSpool removes a spool from the cache
+func (s *Service) evictSpool(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.spools, id)
+}
+
+// storeFilament updates a filament in the cache, including the copies embedded in cached spools
+func (s *Service) storeFilament(filament Filament) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.live {
+		return
+	}
+	if s.filaments != nil {
+		s.filaments[filament.Id] = filament
+	}
+	for id, spool := range s.spools {
+		if spool.Filament.Id == filament.Id {
+			spool.Filament = filament
+			s.spools[id] = spool
+		}
+	}
+}
+
+// evictFilament removes a filament from the cache
+func (s *Service) evictFilament(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.filaments, id)
+}
+
+// sortedSpools returns the cached spools ordered by ID
+func sortedSpools(cache map[int]Spool) []Spool {
+	spools := make([]Spool, 0, len(cache))
+	for _, spool := range cache {
+		spools = append(spools, spool)
+	}
+	sort.Slice(spools, func(i, j int) bool {
+		return spools[i].Id < spools[j].Id
+	})
+	return spools
+}
@@ -0,0 +1,201 @@
+package spoolman
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"time"
+)
+
+// Spoolman event types
+const (
+	EventAdded   = "added"
+	EventUpdated = "updated"
+	EventDeleted = "deleted"
+)
+
+// SpoolUnavailableFunc is called when a spool is archived, emptied or deleted in Spoolman
+type SpoolUnavailableFunc func(ctx context.Context, spool Spool)
+
+// Subscriber consumes Spoolman's websocket change feed, keeping the Service
+// cache current and reporting spools that can no longer be printed with.
+type Subscriber struct {
+	url     string
+	service *Service
+
+	onSpoolUnavailable SpoolUnavailableFunc
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+
+	// Pings keep traffic flowing, so a connection that goes quiet for
+	// readTimeout has been lost without being closed
+	pingInterval time.Duration
+	readTimeout  time.Duration
+}
+
+// NewSubscriber creates a subscriber for the change feed of the given client's Spoolman instance
+func NewSubscriber(client *Client, service *Service) *Subscriber {
+	return &Subscriber{
+		// Connecting to the API root subscribes to events for every resource
+		url:          strings.TrimRight(client.endpoint, "/") + "/",
+		service:      service,
+		minBackoff:   time.Second,
+		maxBackoff:   time.Minute,
+		pingInterval: 30 * time.Second,
+		readTimeout:  time.Minute,
+	}
+}
+
+// OnSpoolUnavailable registers a callback for spools that were archived, emptied or deleted
+func (s *Subscriber) OnSpoolUnavailable(fn SpoolUnavailableFunc) {
+	s.onSpoolUnavailable = fn
+}
+
+// Run connects to the change feed and processes events until the context is
+// cancelled, reconnecting with exponential backoff whenever the connection drops
+func (s *Subscriber) Run(ctx context.Context) {
+	backoff := s.minBackoff
+	for {
+		connected, err := s.consume(ctx)
+		if ctx.Err() != nil {
+			slog.Info("Spoolman change feed stopped")
+			return
+		}
+		if connected {
+			backoff = s.minBackoff
+		}
+
+		slog.Warn("Spoolman change feed disconnected, reconnecting", "error", err, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			slog.Info("Spoolman change feed stopped")
+			return
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+// consume holds a single connection open and processes its events. It reports
+// whether the connection was established at all.
+func (s *Subscriber) consume(ctx context.Context) (bool, error) {
+	conn, err := dialWebsocket(ctx, s.url)
+	if err != nil {
+		return false, err
+	}
+
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+	defer func() { _ = conn.Close() }()
+
+	// A half-open connection never returns from reading, which would leave
+	// the cache marked live while it goes stale
+	conn.readTimeout = s.readTimeout
+	pingCtx, stopPings := context.WithCancel(ctx)
+	defer stopPings()
+	go s.ping(pingCtx, conn)
+
+	slog.Info("connected to Spoolman change feed", "url", s.url)
+	s.service.setLive(true)
+	defer s.service.setLive(false)
+
+	for {
+		message, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+
+		var event Event
+		if err := json.Unmarshal(message, &event); err != nil {
+			slog.Warn("failed to decode Spoolman event", "error", err)
+			continue
+		}
+		s.handleEvent(ctx, event)
+	}
+}
+
+// ping pings the server until the context is cancelled, so that the server's
+// pongs show the connection is still up
+func (s *Subscriber) ping(ctx context.Context, conn *wsConn) {
+	ticker := time.NewTicker(s.pingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := conn.Ping(); err != nil {
+				slog.Debug("failed to ping Spoolman change feed", "error", err)
+				return
+			}
+		}
+	}
+}
+
+// handleEvent applies a single change event to the cache
+func (s *Subscriber) handleEvent(ctx context.Context, event Event) {
+	slog.Debug("received Spoolman event", "type", event.Type, "resource", event.Resource)
+
+	switch event.Resource {
+	case "spool":
+		var spool Spool
+		if err := json.Unmarshal(event.Payload, &spool); err != nil {
+			slog.Warn("failed to decode Spoolman spool event", "error", err)
+			return
+		}
+
+		if event.Type == EventDeleted {
+			s.service.evictSpool(spool.Id)
+			s.spoolUnavailable(ctx, spool)
+			return
+		}
+
+		s.service.storeSpool(spool)
+		if isSpoolUnavailable(spool) {
+			s.spoolUnavailable(ctx, spool)
+		}
+
+	case "filament":
+		var filament Filament
+		if err := json.Unmarshal(event.Payload, &filament); err != nil {
+			slog.Warn("failed to decode Spoolman filament event", "error", err)
+			return
+		}
+
+		if event.Type == EventDeleted {
+			s.service.evictFilament(filament.Id)
+			return
+		}
+		s.service.storeFilament(filament)
+
+	default:
+		// Vendors and other resources are embedded in cached filaments and
+		// spools, so start over rather than patching every copy
+		s.service.Invalidate()
+	}
+}
+
+// spoolUnavailable reports a spool to the registered callback, if any
+func (s *Subscriber) spoolUnavailable(ctx context.Context, spool Spool) {
+	if s.onSpoolUnavailable == nil {
+		return
+	}
+	slog.Info("Spoolman spool is no longer available", "spool_id", spool.Id, "archived", spool.Archived)
+	s.onSpoolUnavailable(ctx, spool)
+}
+
+// isSpoolUnavailable reports whether a spool is archived or has run out of filament
+func isSpoolUnavailable(spool Spool) bool {
+	if spool.Archived {
+		return true
+	}
+	// Spoolman leaves remaining_weight unset when the spool's weight is unknown
+	hasWeight := spool.InitialWeight > 0 || spool.Filament.Weight > 0
+	return hasWeight && spool.RemainingWeight <= 0
+}
@@ -0,0 +1,274 @@
+package spoolman
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeFeed is an in-process stand-in for Spoolman's websocket change feed.
+// Each accepted connection is handed to the next session function.
+type fakeFeed struct {
+	srv         *httptest.Server
+	sessions    chan func(conn net.Conn, rw *bufio.ReadWriter)
+	connections atomic.Int32
+	closed      chan struct{}
+}
+
+func newFakeFeed(t *testing.T) *fakeFeed {
+	f := &fakeFeed{
+		sessions: make(chan func(net.Conn, *bufio.ReadWriter), 8),
+		closed:   make(chan struct{}),
+	}
+	f.srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			http.Error(w, "expected websocket upgrade", http.StatusBadRequest)
+			return
+		}
+
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		_, _ = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+			"Upgrade: websocket\r\n" +
+			"Connection: Upgrade\r\n" +
+			"Sec-WebSocket-Accept: " + websocketAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n")
+		_ = rw.Flush()
+		f.connections.Add(1)
+
+		select {
+		case session := <-f.sessions:
+			session(conn, rw)
+		case <-f.closed:
+		}
+	}))
+	t.Cleanup(f.srv.Close)
+	t.Cleanup(func() { close(f.closed) })
+	return f
+}
+
+// sendEvent writes an unmasked server-to-client text frame carrying the event
+func sendEvent(t *testing.T, rw *bufio.ReadWriter, eventType, resource string, payload any) {
+	data, err := json.Marshal(payload)
+	require.NoError(t, err)
+	message, err := json.Marshal(Event{Type: eventType, Resource: resource, Date: "2025-01-01T00:00:00Z", Payload: data})
+	require.NoError(t, err)
+
+	frame := []byte{0x80 | opText}
+	if len(message) < 126 {
+		frame = append(frame, byte(len(message)))
+	} else {
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(message)))
+	}
+	frame = append(frame, message...)
+	_, err = rw.Write(frame)
+	require.NoError(t, err)
+	require.NoError(t, rw.Flush())
+}
+
+// holdOpen blocks until the client goes away
+func holdOpen(conn net.Conn) {
+	buf := make([]byte, 512)
+	for {
+		if _, err := conn.Read(buf); err != nil {
+			return
+		}
+	}
+}
+
+func newTestSubscriber(feed *fakeFeed) (*Subscriber, *Service) {
+	client := &Client{endpoint: feed.srv.URL, client: *feed.srv.Client()}
+	service := NewService(client)
+	sub := NewSubscriber(client, service)
+	sub.minBackoff = 10 * time.Millisecond
+	sub.maxBackoff = 20 * time.Millisecond
+	return sub, service
+}
+
+func TestSubscriberUpdatesCacheAndReportsUnavailableSpools(t *testing.T) {
+	feed := newFakeFeed(t)
+	sub, service := newTestSubscriber(feed)
+
+	var mu sync.Mutex
+	var unavailable []int
+	sub.OnSpoolUnavailable(func(ctx context.Context, spool Spool) {
+		mu.Lock()
+		defer mu.Unlock()
+		unavailable = append(unavailable, spool.Id)
+	})
+
+	delivered := make(chan struct{})
+	feed.sessions <- func(conn net.Conn, rw *bufio.ReadWriter) {
+		sendEvent(t, rw, EventUpdated, "spool", Spool{Id: 1, RemainingWeight: 500, InitialWeight: 1000})
+		sendEvent(t, rw, EventUpdated, "spool", Spool{Id: 2, Archived: true})
+		sendEvent(t, rw, EventUpdated, "spool", Spool{Id: 3, RemainingWeight: 0, InitialWeight: 1000})
+		sendEvent(t, rw, EventDeleted, "spool", Spool{Id: 4})
+		close(delivered)
+		holdOpen(conn)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		sub.Run(ctx)
+		close(done)
+	}()
+
+	<-delivered
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(unavailable) == 3
+	}, time.Second, 10*time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, []int{2, 3, 4}, unavailable)
+	mu.Unlock()
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("subscriber did not stop after context cancellation")
+	}
+
+	// The cache is dropped once the feed is no longer live
+	service.mu.RLock()
+	assert.False(t, service.live)
+	assert.Nil(t, service.spools)
+	service.mu.RUnlock()
+}
+
+func TestSubscriberServesCachedSpoolsWhileLive(t *testing.T) {
+	feed := newFakeFeed(t)
+	sub, service := newTestSubscriber(feed)
+
+	// Seed the cache as if the spool list had already been fetched
+	ready := make(chan struct{})
+	feed.sessions <- func(conn net.Conn, rw *bufio.ReadWriter) {
+		assert.Eventually(t, func() bool {
+			service.mu.RLock()
+			defer service.mu.RUnlock()
+			return service.live
+		}, time.Second, 5*time.Millisecond)
+
+		service.mu.Lock()
+		service.spools = map[int]Spool{1: {Id: 1, RemainingWeight: 800, Filament: Filament{Id: 5}}}
+		service.mu.Unlock()
+
+		sendEvent(t, rw, EventUpdated, "spool", Spool{Id: 1, RemainingWeight: 640, Filament: Filament{Id: 5}})
+		sendEvent(t, rw, EventUpdated, "filament", Filament{Id: 5, Name: "Galaxy Black"})
+		close(ready)
+		holdOpen(conn)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sub.Run(ctx)
+
+	<-ready
+	assert.Eventually(t, func() bool {
+		spools, err := service.GetSpools(ctx)
+		return err == nil && len(spools) == 1 &&
+			spools[0].RemainingWeight == 640 && spools[0].Filament.Name == "Galaxy Black"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSubscriberReconnectsAfterDisconnect(t *testing.T) {
+	feed := newFakeFeed(t)
+	sub, _ := newTestSubscriber(feed)
+
+	received := make(chan int, 1)
+	sub.OnSpoolUnavailable(func(ctx context.Context, spool Spool) {
+		received <- spool.Id
+	})
+
+	// First connection drops immediately, the second delivers an event
+	feed.sessions <- func(conn net.Conn, rw *bufio.ReadWriter) {}
+	feed.sessions <- func(conn net.Conn, rw *bufio.ReadWriter) {
+		sendEvent(t, rw, EventUpdated, "spool", Spool{Id: 9, Archived: true})
+		holdOpen(conn)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sub.Run(ctx)
+
+	select {
+	case id := <-received:
+		assert.Equal(t, 9, id)
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber did not reconnect")
+	}
+	assert.GreaterOrEqual(t, feed.connections.Load(), int32(2))
+}
+
+func TestSubscriberReconnectsWhenServerStopsResponding(t *testing.T) {
+	feed := newFakeFeed(t)
+	sub, service := newTestSubscriber(feed)
+	sub.pingInterval = 10 * time.Millisecond
+	sub.readTimeout = 50 * time.Millisecond
+	// Wait long enough between connections to see the cache stop being live
+	sub.minBackoff = 200 * time.Millisecond
+	sub.maxBackoff = 200 * time.Millisecond
+
+	received := make(chan int, 1)
+	sub.OnSpoolUnavailable(func(ctx context.Context, spool Spool) {
+		received <- spool.Id
+	})
+
+	// The first server reads the client's ping but never answers, as if the
+	// network between them had gone away
+	pinged := make(chan byte, 1)
+	feed.sessions <- func(conn net.Conn, rw *bufio.ReadWriter) {
+		header, err := rw.ReadByte()
+		if err == nil {
+			pinged <- header & 0x0F
+		}
+		holdOpen(conn)
+	}
+	feed.sessions <- func(conn net.Conn, rw *bufio.ReadWriter) {
+		sendEvent(t, rw, EventUpdated, "spool", Spool{Id: 7, Archived: true})
+		holdOpen(conn)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go sub.Run(ctx)
+
+	select {
+	case opcode := <-pinged:
+		assert.Equal(t, byte(opPing), opcode)
+	case <-time.After(time.Second):
+		t.Fatal("subscriber did not ping the server")
+	}
+	assert.Eventually(t, func() bool {
+		service.mu.RLock()
+		defer service.mu.RUnlock()
+		return !service.live
+	}, time.Second, 5*time.Millisecond, "the silent connection should stop the cache being live")
+
+	select {
+	case id := <-received:
+		assert.Equal(t, 7, id)
+	case <-time.After(2 * time.Second):
+		t.Fatal("subscriber did not reconnect after the server stopped responding")
+	}
+	assert.GreaterOrEqual(t, feed.connections.Load(), int32(2))
+}
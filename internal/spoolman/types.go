@@ -1,5 +1,7 @@
 package spoolman
 
+import "encoding/json"
+
 type Filament struct {
 	Id                   int            `json:"id"`
 	Registered           string         `json:"registered"`
@@ -69,3 +71,18 @@ type CommonRequest struct {
 	Limit  int    `json:"limit"`
 	Offset int    `json:"offset"`
 }
+
+// Event is a change notification published on Spoolman's websocket feed
+type Event struct {
+	Type     string          `json:"type"`     // "added", "updated" or "deleted"
+	Resource string          `json:"resource"` // "spool", "filament", "vendor", ...
+	Date     string          `json:"date"`
+	Payload  json.RawMessage `json:"payload"`
+}
+
+// ExtraField describes a custom field registered through Spoolman's field API
+type ExtraField struct {
+	Name      string `json:"name"`
+	FieldType string `json:"field_type"` // "text", "integer", "float", "datetime", "boolean", ...
+	Order     int    `json:"order,omitempty"`
+}
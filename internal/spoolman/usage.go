@@ -0,0 +1,126 @@
+package spoolman
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+)
+
+const (
+	// usageQueueSize is how much spool usage can wait to be recorded before
+	// more is dropped
+	usageQueueSize = 256
+	// usageAttempts is how many times recording spool usage is tried
+	usageAttempts = 5
+	// usageTimeout limits each attempt to record spool usage
+	usageTimeout = 30 * time.Second
+)
+
+// ErrUsageQueueFull is returned when spool usage is reported faster than
+// Spoolman can record it
+var ErrUsageQueueFull = errors.New("spool usage queue is full")
+
+// spoolUsage is spool usage waiting to be recorded
+type spoolUsage struct {
+	spoolID     int
+	printerName string
+	requestID   string
+}
+
+// UsageRecorder records spool usage in Spoolman in the background, so that a
+// slow or unavailable Spoolman does not hold up updating print requests.
+// The extra fields are registered before the first usage is recorded, and
+// registration is retried until it succeeds.
+type UsageRecorder struct {
+	service *Service
+	queue   chan spoolUsage
+
+	registered bool // Only used by Run's goroutine
+
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+// NewUsageRecorder creates a recorder of spool usage in the given service's
+// Spoolman instance. Usage is only recorded while Run is running.
+func NewUsageRecorder(service *Service) *UsageRecorder {
+	return &UsageRecorder{
+		service:    service,
+		queue:      make(chan spoolUsage, usageQueueSize),
+		minBackoff: time.Second,
+		maxBackoff: time.Minute,
+	}
+}
+
+// RecordSpoolUsage queues spool usage to be recorded, only failing if too
+// much is already waiting
+func (r *UsageRecorder) RecordSpoolUsage(_ context.Context, spoolID int, printerName, requestID string) error {
+	select {
+	case r.queue <- spoolUsage{spoolID: spoolID, printerName: printerName, requestID: requestID}:
+		return nil
+	default:
+		return ErrUsageQueueFull
+	}
+}
+
+// Run registers the extra fields and then records queued spool usage in
+// order until the context is cancelled
+func (r *UsageRecorder) Run(ctx context.Context) {
+	if err := r.register(ctx); err != nil {
+		slog.Warn("failed to register Spoolman extra fields, will retry before recording spool usage", "error", err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case usage := <-r.queue:
+			r.record(ctx, usage)
+		}
+	}
+}
+
+// record records spool usage, retrying with exponential backoff
+func (r *UsageRecorder) record(ctx context.Context, usage spoolUsage) {
+	backoff := r.minBackoff
+	for attempt := 1; ; attempt++ {
+		err := r.register(ctx)
+		if err == nil {
+			attemptCtx, cancel := context.WithTimeout(ctx, usageTimeout)
+			err = r.service.RecordSpoolUsage(attemptCtx, usage.spoolID, usage.printerName, usage.requestID)
+			cancel()
+		}
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		if attempt == usageAttempts {
+			slog.Error("giving up recording spool usage in Spoolman", "error", err,
+				"spool_id", usage.spoolID, "request_id", usage.requestID, "attempts", attempt)
+			return
+		}
+
+		slog.Warn("failed to record spool usage in Spoolman, retrying", "error", err,
+			"spool_id", usage.spoolID, "request_id", usage.requestID, "backoff", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, r.maxBackoff)
+	}
+}
+
+// register registers the extra fields if they have not been yet
+func (r *UsageRecorder) register(ctx context.Context) error {
+	if r.registered {
+		return nil
+	}
+	attemptCtx, cancel := context.WithTimeout(ctx, usageTimeout)
+	defer cancel()
+	if err := r.service.RegisterExtraFields(attemptCtx); err != nil {
+		return err
+	}
+	r.registered = true
+	return nil
+}
@@ -0,0 +1,56 @@
+package statement
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bjschafer/print-dis/internal/models"
+)
+
+const dateFormat = "2006-01-02"
+
+// WriteCSV writes a statement as CSV, with the opening and closing balances
+// as the first and last rows
+func WriteCSV(w io.Writer, statement *models.Statement) error {
+	writer := csv.NewWriter(w)
+
+	rows := [][]string{
+		{"date", "kind", "description", "amount", "balance"},
+		{statement.PeriodStart.Format(dateFormat), "opening", "Opening balance", "", formatAmount(statement.OpeningBalance)},
+	}
+	for _, entry := range statement.Entries {
+		rows = append(rows, []string{
+			entry.Date.Format(dateFormat),
+			entry.Kind,
+			entry.Description,
+			formatAmount(entry.Amount),
+			formatAmount(entry.Balance),
+		})
+	}
+	rows = append(rows, []string{
+		statement.PeriodEnd.AddDate(0, 0, -1).Format(dateFormat), "closing", "Closing balance", "", formatAmount(statement.ClosingBalance),
+	})
+
+	if err := writer.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to write statement CSV: %w", err)
+	}
+	return nil
+}
+
+// Filename returns a download filename for a statement with the given extension
+func Filename(statement *models.Statement, ext string) string {
+	username := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, statement.Username)
+	return fmt.Sprintf("statement-%s-%s.%s", username, statement.PeriodStart.Format("2006-01"), ext)
+}
+
+// formatAmount formats an amount with two decimal places
+func formatAmount(amount models.Money) string {
+	return amount.String()
+}
@@ -0,0 +1,214 @@
+package statement
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bjschafer/print-dis/internal/models"
+)
+
+// Page layout of PDF statements, in points on an A4 page
+const (
+	pageWidth    = 595
+	pageHeight   = 842
+	marginLeft   = 50
+	marginRight  = 545
+	marginTop    = 792
+	marginBottom = 60
+	lineHeight   = 14
+	fontSize     = 9
+
+	// Courier glyphs are 0.6 em wide, which makes right-aligning numbers easy
+	courierWidth = 0.6 * fontSize
+
+	descriptionWidth = 52 // Characters of description that fit between the date and amount columns
+)
+
+// Fonts used by the content streams, all standard PDF fonts
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+	fontMono    = "F3"
+)
+
+// WritePDF writes a statement as a PDF document. Only the standard PDF fonts
+// are used, so no font files are embedded.
+func WritePDF(w io.Writer, statement *models.Statement) error {
+	pages := layoutPages(statement)
+
+	doc := &pdfDocument{}
+	doc.addObject("<< /Type /Catalog /Pages 2 0 R >>")
+
+	// The page tree is object 2 and the fonts 3 to 5, followed by a page
+	// object and a content stream for each page
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+	doc.addObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	doc.addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	doc.addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	doc.addObject("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, content := range pages {
+		doc.addObject(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /%s 3 0 R /%s 4 0 R /%s 5 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontRegular, fontBold, fontMono, 7+2*i,
+		))
+		doc.addObject(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(content), content))
+	}
+
+	_, err := w.Write(doc.bytes())
+	if err != nil {
+		return fmt.Errorf("failed to write statement PDF: %w", err)
+	}
+	return nil
+}
+
+// layoutPages renders the statement into one content stream per page
+func layoutPages(statement *models.Statement) []string {
+	var pages []string
+	page := &pdfPage{y: marginTop}
+
+	// Heading
+	page.text(fontBold, 16, marginLeft, "Statement")
+	page.y -= 10
+	page.text(fontRegular, 10, marginLeft, "Account: "+statement.Username)
+	page.text(fontRegular, 10, marginLeft, fmt.Sprintf("Period: %s to %s",
+		statement.PeriodStart.Format(dateFormat), statement.PeriodEnd.AddDate(0, 0, -1).Format(dateFormat)))
+	page.text(fontRegular, 10, marginLeft, "Currency: "+statement.Currency)
+	page.y -= 10
+
+	header := func(p *pdfPage) {
+		p.row(fontBold, "Date", "Description", "Amount", "Balance")
+		p.rule()
+	}
+	header(page)
+	page.row(fontMono, statement.PeriodStart.Format(dateFormat), "Opening balance", "", formatAmount(statement.OpeningBalance))
+
+	for _, entry := range statement.Entries {
+		if page.y < marginBottom+lineHeight {
+			pages = append(pages, page.String())
+			page = &pdfPage{y: marginTop}
+			header(page)
+		}
+		page.row(fontMono, entry.Date.Format(dateFormat), truncate(entry.Description, descriptionWidth),
+			formatAmount(entry.Amount), formatAmount(entry.Balance))
+	}
+
+	if page.y < marginBottom+3*lineHeight {
+		pages = append(pages, page.String())
+		page = &pdfPage{y: marginTop}
+	}
+	page.rule()
+	page.row(fontBold, "", "Closing balance", "", formatAmount(statement.ClosingBalance))
+	page.y -= 10
+	page.text(fontRegular, 8, marginLeft, "Generated "+statement.GeneratedAt.Format("2006-01-02 15:04 MST"))
+
+	return append(pages, page.String())
+}
+
+// pdfPage builds the content stream of a single page from the top down
+type pdfPage struct {
+	buf bytes.Buffer
+	y   float64
+}
+
+// text writes a line of text at the current position and moves down a line
+func (p *pdfPage) text(font string, size float64, x float64, s string) {
+	fmt.Fprintf(&p.buf, "BT /%s %g Tf %g %g Td (%s) Tj ET\n", font, size, x, p.y, escapeText(s))
+	p.y -= size + lineHeight - fontSize
+}
+
+// row writes a table row with a date, a description and two right-aligned amounts
+func (p *pdfPage) row(font, date, description, amount, balance string) {
+	p.cell(font, marginLeft, date)
+	p.cell(font, marginLeft+75, description)
+	p.cell(font, 470-float64(len(amount))*courierWidth, amount)
+	p.cell(font, marginRight-float64(len(balance))*courierWidth, balance)
+	p.y -= lineHeight
+}
+
+// cell writes text at the given horizontal position on the current line
+func (p *pdfPage) cell(font string, x float64, s string) {
+	if s == "" {
+		return
+	}
+	fmt.Fprintf(&p.buf, "BT /%s %d Tf %g %g Td (%s) Tj ET\n", font, fontSize, x, p.y, escapeText(s))
+}
+
+// rule draws a horizontal line just above the current line
+func (p *pdfPage) rule() {
+	y := p.y + lineHeight - 3
+	fmt.Fprintf(&p.buf, "0.5 w %d %g m %d %g l S\n", marginLeft, y, marginRight, y)
+	p.y -= 4
+}
+
+// String returns the page's content stream
+func (p *pdfPage) String() string {
+	return strings.TrimSuffix(p.buf.String(), "\n")
+}
+
+// pdfDocument assembles numbered objects into a PDF file with a cross-reference table
+type pdfDocument struct {
+	objects []string
+}
+
+// addObject appends an object, numbered from 1 in the order they are added
+func (d *pdfDocument) addObject(body string) {
+	d.objects = append(d.objects, body)
+}
+
+// bytes serialises the document
+func (d *pdfDocument) bytes() []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+
+	offsets := make([]int, len(d.objects))
+	for i, body := range d.objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, body)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(d.objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(d.objects)+1, xref)
+
+	return buf.Bytes()
+}
+
+// escapeText encodes a string for a PDF literal string in WinAnsiEncoding.
+// Characters outside Latin-1 are replaced with a question mark.
+func escapeText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32:
+			b.WriteByte(' ')
+		case r < 127:
+			b.WriteRune(r)
+		case r >= 160 && r <= 255:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+// truncate shortens a string to at most n characters
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-3]) + "..."
+}
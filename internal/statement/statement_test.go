@@ -0,0 +1,102 @@
+package statement
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/bjschafer/print-dis/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testStatement(entries int) *models.Statement {
+	start := time.Date(2026, time.September, 1, 0, 0, 0, 0, time.UTC)
+	statement := &models.Statement{
+		UserID:         "user-1",
+		Username:       "ada",
+		Currency:       "EUR",
+		PeriodStart:    start,
+		PeriodEnd:      start.AddDate(0, 1, 0),
+		OpeningBalance: -250,
+		GeneratedAt:    start.AddDate(0, 1, 1),
+	}
+	balance := statement.OpeningBalance
+	for i := 0; i < entries; i++ {
+		balance -= 125
+		statement.Entries = append(statement.Entries, models.StatementEntry{
+			Date:        start.AddDate(0, 0, i%28),
+			Kind:        "charge",
+			Description: fmt.Sprintf("Print request %d (PLA, \"Benchy\")", i),
+			Amount:      -125,
+			Balance:     balance,
+		})
+	}
+	statement.ClosingBalance = balance
+	return statement
+}
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteCSV(&buf, testStatement(2)))
+
+	rows, err := csv.NewReader(&buf).ReadAll()
+	require.NoError(t, err)
+	require.Len(t, rows, 5)
+
+	assert.Equal(t, []string{"date", "kind", "description", "amount", "balance"}, rows[0])
+	assert.Equal(t, []string{"2026-09-01", "opening", "Opening balance", "", "-2.50"}, rows[1])
+	assert.Equal(t, []string{"2026-09-02", "charge", "Print request 1 (PLA, \"Benchy\")", "-1.25", "-5.00"}, rows[3])
+	assert.Equal(t, []string{"2026-09-30", "closing", "Closing balance", "", "-5.00"}, rows[4])
+}
+
+func TestWritePDF(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries int
+		pages   int
+	}{
+		{name: "empty", entries: 0, pages: 1},
+		{name: "single page", entries: 10, pages: 1},
+		{name: "multiple pages", entries: 120, pages: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			require.NoError(t, WritePDF(&buf, testStatement(tt.entries)))
+			pdf := buf.Bytes()
+
+			assert.True(t, bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")))
+			assert.True(t, bytes.HasSuffix(pdf, []byte("%%EOF\n")))
+			assert.Contains(t, string(pdf), fmt.Sprintf("/Count %d", tt.pages))
+			if tt.entries > 0 {
+				assert.Contains(t, string(pdf), `(Print request 0 \(PLA, "Benchy"\)) Tj`, "parentheses are escaped")
+			}
+
+			// Every cross-reference entry points at the start of its object
+			startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(pdf)
+			require.NotNil(t, startxref)
+			xref, err := strconv.Atoi(string(startxref[1]))
+			require.NoError(t, err)
+			require.True(t, bytes.HasPrefix(pdf[xref:], []byte("xref\n")))
+
+			offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+			require.Len(t, offsets, 5+2*tt.pages)
+			for i, match := range offsets {
+				offset, err := strconv.Atoi(string(match[1]))
+				require.NoError(t, err)
+				assert.True(t, bytes.HasPrefix(pdf[offset:], []byte(fmt.Sprintf("%d 0 obj\n", i+1))), "object %d", i+1)
+			}
+		})
+	}
+}
+
+func TestEscapeText(t *testing.T) {
+	assert.Equal(t, `a\(b\)\\c`, escapeText(`a(b)\c`))
+	assert.Equal(t, `caf\351 ?`, escapeText("café €"))
+}
@@ -0,0 +1,117 @@
+package totp
+
+import (
+	"encoding/base32"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcKey is the SHA-1 key used in the test vectors of RFC 4226 and RFC 6238
+var rfcKey = []byte("12345678901234567890")
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 appendix D
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range want {
+		if got := hotp(rfcKey, uint64(counter), 6); got != code {
+			t.Errorf("hotp(%d) = %s, want %s", counter, got, code)
+		}
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238 appendix B, SHA-1
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		if got := hotp(rfcKey, counterAt(time.Unix(tt.unix, 0)), 8); got != tt.code {
+			t.Errorf("TOTP at %d = %s, want %s", tt.unix, got, tt.code)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString(rfcKey)
+	now := time.Unix(1111111111, 0)
+
+	code, err := Code(secret, now)
+	if err != nil {
+		t.Fatalf("Code failed: %v", err)
+	}
+	if code != "050471" {
+		t.Errorf("Code() = %s, want 050471", code)
+	}
+
+	step, ok := Validate(secret, code, now)
+	if !ok || step != int64(counterAt(now)) {
+		t.Errorf("Expected code to be valid in step %d, got %d, %v", counterAt(now), step, ok)
+	}
+
+	// Codes from the neighbouring periods are accepted for clock drift
+	if _, ok := Validate(secret, code, now.Add(Period)); !ok {
+		t.Error("Expected code to be valid one period later")
+	}
+	if _, ok := Validate(secret, code, now.Add(-Period)); !ok {
+		t.Error("Expected code to be valid one period earlier")
+	}
+	if _, ok := Validate(secret, code, now.Add(2*Period)); ok {
+		t.Error("Expected code to be invalid two periods later")
+	}
+
+	// Secrets are accepted however people type them
+	lower := strings.ToLower(secret[:8] + " " + secret[8:])
+	if _, ok := Validate(lower, "050 471", now); !ok {
+		t.Error("Expected lowercase secret and spaced code to be accepted")
+	}
+
+	for _, bad := range []string{"", "12345", "1234567", "abcdef", "050472"} {
+		if _, ok := Validate(secret, bad, now); ok {
+			t.Errorf("Expected %q to be invalid", bad)
+		}
+	}
+	if _, ok := Validate("not base32!", code, now); ok {
+		t.Error("Expected an invalid secret to be refused")
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	a, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret failed: %v", err)
+	}
+	b, _ := GenerateSecret()
+	if a == b {
+		t.Error("Expected secrets to differ")
+	}
+	if key, err := decodeSecret(a); err != nil || len(key) != secretSize {
+		t.Errorf("Expected a %d byte secret, got %d bytes, %v", secretSize, len(key), err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("print-dis", "alice@example.com", "JBSWY3DPEHPK3PXP")
+
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		t.Fatalf("Failed to parse URI: %v", err)
+	}
+	if parsed.Scheme != "otpauth" || parsed.Host != "totp" || parsed.Path != "/print-dis:alice@example.com" {
+		t.Errorf("Unexpected URI %s", uri)
+	}
+	query := parsed.Query()
+	if query.Get("secret") != "JBSWY3DPEHPK3PXP" || query.Get("issuer") != "print-dis" || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("Unexpected URI parameters %v", query)
+	}
+}
@@ -2,6 +2,7 @@ package validation
 
 import (
 	"fmt"
+	"math"
 	"net/http"
 	"net/url"
 	"regexp"
@@ -372,6 +373,16 @@ func (v *Validator) ValidateRequestSize(field, value string, maxSize int) {
 	}
 }
 
+// ValidateRange validates that an optional number lies between min and max inclusive
+func (v *Validator) ValidateRange(field string, value *float64, min, max float64) {
+	if value == nil {
+		return
+	}
+	if math.IsNaN(*value) || *value < min || *value > max {
+		v.AddError(field, fmt.Sprintf("must be between %g and %g", min, max))
+	}
+}
+
 // ValidateJSONField validates JSON field content with size limits
 func (v *Validator) ValidateJSONField(field, value string, maxSize int) {
 	if value == "" {
@@ -1,6 +1,7 @@
 package validation
 
 import (
+	"math"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -414,6 +415,61 @@ func TestValidateRequestSize(t *testing.T) {
 	}
 }
 
+func TestValidateRange(t *testing.T) {
+	value := func(f float64) *float64 { return &f }
+
+	tests := []struct {
+		name        string
+		input       *float64
+		shouldError bool
+	}{
+		{
+			name:        "not set",
+			input:       nil,
+			shouldError: false,
+		},
+		{
+			name:        "within range",
+			input:       value(12.5),
+			shouldError: false,
+		},
+		{
+			name:        "at bounds",
+			input:       value(0),
+			shouldError: false,
+		},
+		{
+			name:        "below range",
+			input:       value(-1),
+			shouldError: true,
+		},
+		{
+			name:        "above range",
+			input:       value(1001),
+			shouldError: true,
+		},
+		{
+			name:        "not a number",
+			input:       value(math.NaN()),
+			shouldError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			validator := NewValidator()
+			validator.ValidateRange("field", tt.input, 0, 1000)
+			errors := validator.Errors()
+
+			if tt.shouldError {
+				assert.NotEmpty(t, errors)
+			} else {
+				assert.Empty(t, errors)
+			}
+		})
+	}
+}
+
 func TestValidateJSONField(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -0,0 +1,207 @@
+package webauthn
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// maxCBORDepth limits how deeply arrays and maps may be nested
+const maxCBORDepth = 16
+
+var errCBORTruncated = errors.New("cbor: unexpected end of data")
+
+// decodeCBOR decodes the first CBOR (RFC 8949) data item in data and returns
+// it with the bytes that follow it. It handles the subset of CBOR that
+// authenticators produce: integers are returned as int64, byte strings as
+// []byte, text as string, arrays as []any and maps as map[any]any with int64
+// or string keys. Indefinite lengths are not supported.
+func decodeCBOR(data []byte) (any, []byte, error) {
+	d := &cborDecoder{data: data}
+	value, err := d.decode(0)
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, d.data[d.pos:], nil
+}
+
+// cborDecoder reads data items from a buffer
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+func (d *cborDecoder) decode(depth int) (any, error) {
+	if depth > maxCBORDepth {
+		return nil, errors.New("cbor: nested too deeply")
+	}
+	if d.pos >= len(d.data) {
+		return nil, errCBORTruncated
+	}
+	initial := d.data[d.pos]
+	d.pos++
+	major, info := initial>>5, initial&0x1f
+
+	// Floats and simple values use the argument bits differently
+	if major == 7 {
+		return d.decodeSimple(info)
+	}
+
+	argument, err := d.argument(info)
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0: // Unsigned integer
+		if argument > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflows int64")
+		}
+		return int64(argument), nil
+	case 1: // Negative integer
+		if argument > math.MaxInt64 {
+			return nil, errors.New("cbor: integer overflows int64")
+		}
+		return -1 - int64(argument), nil
+	case 2: // Byte string
+		value, err := d.bytes(argument)
+		if err != nil {
+			return nil, err
+		}
+		return append([]byte(nil), value...), nil
+	case 3: // Text string
+		value, err := d.bytes(argument)
+		if err != nil {
+			return nil, err
+		}
+		return string(value), nil
+	case 4: // Array
+		// Every item is at least a byte, which bounds the allocation
+		if argument > uint64(len(d.data)-d.pos) {
+			return nil, errCBORTruncated
+		}
+		items := make([]any, 0, argument)
+		for i := uint64(0); i < argument; i++ {
+			item, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	case 5: // Map
+		if argument > uint64(len(d.data)-d.pos)/2 {
+			return nil, errCBORTruncated
+		}
+		entries := make(map[any]any, argument)
+		for i := uint64(0); i < argument; i++ {
+			key, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch key.(type) {
+			case int64, string:
+			default:
+				return nil, fmt.Errorf("cbor: unsupported map key type %T", key)
+			}
+			if _, ok := entries[key]; ok {
+				return nil, fmt.Errorf("cbor: duplicate map key %v", key)
+			}
+			value, err := d.decode(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			entries[key] = value
+		}
+		return entries, nil
+	default: // Tag, which is ignored in favour of the tagged item
+		return d.decode(depth + 1)
+	}
+}
+
+// argument reads the argument that follows the initial byte of a data item
+func (d *cborDecoder) argument(info byte) (uint64, error) {
+	switch {
+	case info < 24:
+		return uint64(info), nil
+	case info <= 27:
+		size := 1 << (info - 24)
+		value, err := d.bytes(uint64(size))
+		if err != nil {
+			return 0, err
+		}
+		var padded [8]byte
+		copy(padded[8-size:], value)
+		return binary.BigEndian.Uint64(padded[:]), nil
+	case info == 31:
+		return 0, errors.New("cbor: indefinite lengths are not supported")
+	default:
+		return 0, fmt.Errorf("cbor: invalid additional information %d", info)
+	}
+}
+
+// decodeSimple decodes booleans, null, undefined and floats
+func (d *cborDecoder) decodeSimple(info byte) (any, error) {
+	switch info {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23:
+		return nil, nil
+	case 25:
+		value, err := d.bytes(2)
+		if err != nil {
+			return nil, err
+		}
+		return halfToFloat(binary.BigEndian.Uint16(value)), nil
+	case 26:
+		value, err := d.bytes(4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(value))), nil
+	case 27:
+		value, err := d.bytes(8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(value)), nil
+	default:
+		return nil, fmt.Errorf("cbor: unsupported simple value %d", info)
+	}
+}
+
+// bytes consumes the next n bytes
+func (d *cborDecoder) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, errCBORTruncated
+	}
+	value := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return value, nil
+}
+
+// halfToFloat converts an IEEE 754 half-precision float
+func halfToFloat(half uint16) float64 {
+	exponent := int(half>>10) & 0x1f
+	mantissa := float64(half & 0x3ff)
+	var value float64
+	switch exponent {
+	case 0:
+		value = math.Ldexp(mantissa, -24)
+	case 31:
+		if mantissa == 0 {
+			value = math.Inf(1)
+		} else {
+			value = math.NaN()
+		}
+	default:
+		value = math.Ldexp(mantissa+1024, exponent-25)
+	}
+	if half&0x8000 != 0 {
+		return -value
+	}
+	return value
+}
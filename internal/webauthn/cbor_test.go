@@ -0,0 +1,85 @@
+package webauthn
+
+import (
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeCBOR(t *testing.T) {
+	// Examples from RFC 8949 appendix A
+	tests := []struct {
+		hex  string
+		want any
+	}{
+		{"00", int64(0)},
+		{"17", int64(23)},
+		{"1903e8", int64(1000)},
+		{"1b000000e8d4a51000", int64(1000000000000)},
+		{"20", int64(-1)},
+		{"3863", int64(-100)},
+		{"4401020304", []byte{1, 2, 3, 4}},
+		{"6449455446", "IETF"},
+		{"83010203", []any{int64(1), int64(2), int64(3)}},
+		{"a201020304", map[any]any{int64(1): int64(2), int64(3): int64(4)}},
+		{"a26161016162820203", map[any]any{"a": int64(1), "b": []any{int64(2), int64(3)}}},
+		{"f4", false},
+		{"f5", true},
+		{"f6", nil},
+		{"f93c00", 1.0},
+		{"f9c400", -4.0},
+		{"fb3ff199999999999a", 1.1},
+		{"c11a514b67b0", int64(1363896240)},
+	}
+
+	for _, tt := range tests {
+		data, _ := hex.DecodeString(tt.hex)
+		got, rest, err := decodeCBOR(data)
+		if err != nil {
+			t.Errorf("decodeCBOR(%s) failed: %v", tt.hex, err)
+			continue
+		}
+		if len(rest) != 0 {
+			t.Errorf("decodeCBOR(%s) left %d bytes", tt.hex, len(rest))
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("decodeCBOR(%s) = %#v, want %#v", tt.hex, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeCBORRest(t *testing.T) {
+	data, _ := hex.DecodeString("0102")
+	got, rest, err := decodeCBOR(data)
+	if err != nil || got != int64(1) || len(rest) != 1 || rest[0] != 2 {
+		t.Errorf("decodeCBOR = %v, %v, %v", got, rest, err)
+	}
+}
+
+func TestDecodeCBORInvalid(t *testing.T) {
+	for _, input := range []string{
+		"",                   // Empty
+		"1903",               // Truncated argument
+		"5804010203",         // Byte string longer than the data
+		"9bffffffffffffffff", // Array longer than the data
+		"5f42010243030405ff", // Indefinite length
+		"a2010201",           // Map missing a value
+		"a201020103",         // Duplicate key
+		"a1410102",           // Byte string key
+		"1bffffffffffffffff", // Overflows int64
+	} {
+		data, _ := hex.DecodeString(input)
+		if _, _, err := decodeCBOR(data); err == nil {
+			t.Errorf("decodeCBOR(%s) succeeded, want error", input)
+		}
+	}
+
+	// Deep nesting is refused rather than recursing without limit
+	deep := make([]byte, 100)
+	for i := range deep {
+		deep[i] = 0x81
+	}
+	if _, _, err := decodeCBOR(deep); err == nil {
+		t.Error("decodeCBOR of deeply nested arrays succeeded, want error")
+	}
+}
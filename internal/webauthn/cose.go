@@ -0,0 +1,118 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// COSE algorithms (RFC 9053) that credentials can use, in order of preference
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// supportedAlgorithms are offered to authenticators when registering
+var supportedAlgorithms = []int{AlgES256, AlgEdDSA, AlgRS256}
+
+// COSE key parameters
+const (
+	coseKeyType   = 1
+	coseAlgorithm = 3
+	coseCurve     = -1 // Also the RSA modulus
+	coseX         = -2 // Also the RSA exponent
+	coseY         = -3
+)
+
+// COSE key types and curves
+const (
+	coseKeyTypeOKP = 1
+	coseKeyTypeEC2 = 2
+	coseKeyTypeRSA = 3
+	coseCurveP256  = 1
+	coseEd25519    = 6
+)
+
+// minRSABits is the smallest RSA key accepted
+const minRSABits = 2048
+
+// publicKey is a credential public key decoded from COSE_Key form
+type publicKey struct {
+	algorithm int64
+	key       crypto.PublicKey
+}
+
+// parsePublicKey decodes a COSE_Key and returns the bytes that follow it
+func parsePublicKey(data []byte) (*publicKey, []byte, error) {
+	value, rest, err := decodeCBOR(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	params, ok := value.(map[any]any)
+	if !ok {
+		return nil, nil, errors.New("invalid public key: not a map")
+	}
+
+	keyType, _ := params[int64(coseKeyType)].(int64)
+	algorithm, _ := params[int64(coseAlgorithm)].(int64)
+	curve, _ := params[int64(coseCurve)].(int64)
+	switch {
+	case algorithm == AlgES256 && keyType == coseKeyTypeEC2 && curve == coseCurveP256:
+		x, _ := params[int64(coseX)].([]byte)
+		y, _ := params[int64(coseY)].([]byte)
+		if len(x) != 32 || len(y) != 32 {
+			return nil, nil, errors.New("invalid public key: wrong P-256 coordinate size")
+		}
+		// crypto/ecdh checks that the point is on the curve
+		point := append(append([]byte{4}, x...), y...)
+		if _, err := ecdh.P256().NewPublicKey(point); err != nil {
+			return nil, nil, fmt.Errorf("invalid public key: %w", err)
+		}
+		return &publicKey{algorithm: algorithm, key: &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}}, rest, nil
+	case algorithm == AlgEdDSA && keyType == coseKeyTypeOKP && curve == coseEd25519:
+		x, _ := params[int64(coseX)].([]byte)
+		if len(x) != ed25519.PublicKeySize {
+			return nil, nil, errors.New("invalid public key: wrong Ed25519 key size")
+		}
+		return &publicKey{algorithm: algorithm, key: ed25519.PublicKey(x)}, rest, nil
+	case algorithm == AlgRS256 && keyType == coseKeyTypeRSA:
+		n, _ := params[int64(coseCurve)].([]byte)
+		e, _ := params[int64(coseX)].([]byte)
+		modulus := new(big.Int).SetBytes(n)
+		exponent := new(big.Int).SetBytes(e)
+		if modulus.BitLen() < minRSABits || !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+			return nil, nil, errors.New("invalid public key: unsupported RSA key")
+		}
+		return &publicKey{algorithm: algorithm, key: &rsa.PublicKey{N: modulus, E: int(exponent.Int64())}}, rest, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported public key algorithm %d", algorithm)
+	}
+}
+
+// verify checks a signature over data
+func (k *publicKey) verify(data, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
@@ -0,0 +1,411 @@
+// Package webauthn implements the relying party side of Web Authentication
+// (W3C WebAuthn Level 2), for logging in with security keys and passkeys.
+// Attestation statements are not checked, so any authenticator can be
+// registered; user verification, such as a PIN or fingerprint, is required.
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Timeout is how long the browser waits for the user to use their
+// authenticator
+const Timeout = 5 * time.Minute
+
+const (
+	// challengeSize is the length of challenges in bytes
+	challengeSize = 32
+	// maxCredentialIDSize is the longest credential ID the spec allows
+	maxCredentialIDSize = 1023
+)
+
+// Authenticator data flags
+const (
+	flagUserPresent   = 0x01
+	flagUserVerified  = 0x04
+	flagAttestedData  = 0x40
+	flagExtensionData = 0x80
+)
+
+// ErrInvalidResponse is returned when an authenticator response fails
+// verification
+var ErrInvalidResponse = errors.New("invalid WebAuthn response")
+
+// Bytes is binary data, encoded in JSON as unpadded base64url as the WebAuthn
+// JSON serialization uses
+type Bytes []byte
+
+// MarshalJSON encodes the bytes as base64url
+func (b Bytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+// UnmarshalJSON decodes base64url, with or without padding
+func (b *Bytes) UnmarshalJSON(data []byte) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return err
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(string(bytes.TrimRight([]byte(encoded), "=")))
+	if err != nil {
+		return err
+	}
+	*b = decoded
+	return nil
+}
+
+// String returns the bytes as base64url
+func (b Bytes) String() string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// RelyingParty is the site credentials are registered with
+type RelyingParty struct {
+	// ID is the domain credentials are scoped to, e.g. print.example.com
+	ID string
+	// Name is shown by authenticators
+	Name string
+	// Origins are the origins ceremonies may come from, e.g.
+	// https://print.example.com
+	Origins []string
+}
+
+// User identifies the account a credential is registered for
+type User struct {
+	ID          Bytes  `json:"id"` // Returned as the user handle when logging in
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+// CredentialDescriptor identifies a registered credential
+type CredentialDescriptor struct {
+	Type string `json:"type"`
+	ID   Bytes  `json:"id"`
+}
+
+// CredentialParameter is a key algorithm the relying party accepts
+type CredentialParameter struct {
+	Type      string `json:"type"`
+	Algorithm int    `json:"alg"`
+}
+
+// AuthenticatorSelection states which authenticators may be registered
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions are passed to navigator.credentials.create() to register a
+// credential. Field names follow the WebAuthn API, with binary fields as
+// base64url.
+type CreationOptions struct {
+	Challenge              Bytes                  `json:"challenge"`
+	RelyingParty           relyingPartyEntity     `json:"rp"`
+	User                   User                   `json:"user"`
+	Parameters             []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// relyingPartyEntity describes the relying party to the authenticator
+type relyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// RequestOptions are passed to navigator.credentials.get() to log in. With
+// no allowed credentials, the user picks one of their passkeys for the site.
+type RequestOptions struct {
+	Challenge        Bytes                  `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RelyingPartyID   string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// RegistrationResponse is the credential returned by
+// navigator.credentials.create()
+type RegistrationResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AttestationObject Bytes `json:"attestationObject"`
+	} `json:"response"`
+}
+
+// AssertionResponse is the credential returned by navigator.credentials.get()
+type AssertionResponse struct {
+	ID       string `json:"id"`
+	RawID    Bytes  `json:"rawId"`
+	Type     string `json:"type"`
+	Response struct {
+		ClientDataJSON    Bytes `json:"clientDataJSON"`
+		AuthenticatorData Bytes `json:"authenticatorData"`
+		Signature         Bytes `json:"signature"`
+		UserHandle        Bytes `json:"userHandle"`
+	} `json:"response"`
+}
+
+// Credential is a registered credential to store for the user
+type Credential struct {
+	ID        []byte
+	PublicKey []byte // COSE_Key
+	SignCount uint32
+}
+
+// clientData is the data the browser signs over, from clientDataJSON
+type clientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin"`
+}
+
+// authenticatorData is the data the authenticator signs over
+type authenticatorData struct {
+	rpIDHash     []byte
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte // COSE_Key, only when registering
+}
+
+// BeginRegistration returns the options to register a new credential for the
+// user. Credentials they already have are excluded so that an authenticator is
+// not registered twice. The challenge must be kept to finish registration.
+func (rp *RelyingParty) BeginRegistration(user User, existing [][]byte) (*CreationOptions, error) {
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	parameters := make([]CredentialParameter, 0, len(supportedAlgorithms))
+	for _, algorithm := range supportedAlgorithms {
+		parameters = append(parameters, CredentialParameter{Type: "public-key", Algorithm: algorithm})
+	}
+
+	return &CreationOptions{
+		Challenge:          challenge,
+		RelyingParty:       relyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:               user,
+		Parameters:         parameters,
+		Timeout:            Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(existing),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: "required",
+		},
+		Attestation: "none",
+	}, nil
+}
+
+// BeginLogin returns the options to log in with one of the allowed
+// credentials, or any passkey for the site when none are given. The challenge
+// must be kept to finish logging in.
+func (rp *RelyingParty) BeginLogin(allowed [][]byte) (*RequestOptions, error) {
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          Timeout.Milliseconds(),
+		RelyingPartyID:   rp.ID,
+		AllowCredentials: descriptors(allowed),
+		UserVerification: "required",
+	}, nil
+}
+
+// FinishRegistration verifies a new credential against the challenge it was
+// created for
+func (rp *RelyingParty) FinishRegistration(response *RegistrationResponse, challenge []byte) (*Credential, error) {
+	if response.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type %q", ErrInvalidResponse, response.Type)
+	}
+	if err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.create", challenge); err != nil {
+		return nil, err
+	}
+
+	value, _, err := decodeCBOR(response.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid attestation object: %v", ErrInvalidResponse, err)
+	}
+	attestation, ok := value.(map[any]any)
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid attestation object", ErrInvalidResponse)
+	}
+	// Only "none" attestation is requested, and the statement of any other
+	// format is ignored, as the authenticator model is not restricted
+	if _, ok := attestation["fmt"].(string); !ok {
+		return nil, fmt.Errorf("%w: attestation format missing", ErrInvalidResponse)
+	}
+	rawAuthData, _ := attestation["authData"].([]byte)
+
+	authData, err := rp.parseAuthenticatorData(rawAuthData)
+	if err != nil {
+		return nil, err
+	}
+	if authData.flags&flagAttestedData == 0 {
+		return nil, fmt.Errorf("%w: no credential in authenticator data", ErrInvalidResponse)
+	}
+	if !bytes.Equal(authData.credentialID, response.RawID) {
+		return nil, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+	}, nil
+}
+
+// FinishLogin verifies a login with a stored credential against the
+// challenge it was for. It returns the authenticator's new signature count
+// to store.
+func (rp *RelyingParty) FinishLogin(response *AssertionResponse, challenge []byte, credential *Credential) (uint32, error) {
+	if response.Type != "public-key" {
+		return 0, fmt.Errorf("%w: unexpected credential type %q", ErrInvalidResponse, response.Type)
+	}
+	if !bytes.Equal(response.RawID, credential.ID) {
+		return 0, fmt.Errorf("%w: credential ID mismatch", ErrInvalidResponse)
+	}
+	if err := rp.verifyClientData(response.Response.ClientDataJSON, "webauthn.get", challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.parseAuthenticatorData(response.Response.AuthenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, _, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+	clientDataHash := sha256.Sum256(response.Response.ClientDataJSON)
+	signed := append(append([]byte(nil), response.Response.AuthenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, response.Response.Signature) {
+		return 0, fmt.Errorf("%w: bad signature", ErrInvalidResponse)
+	}
+
+	// Authenticators that count signatures always increase the count, so a
+	// count that goes backwards suggests the credential was cloned
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, fmt.Errorf("%w: signature count did not increase, the authenticator may have been cloned", ErrInvalidResponse)
+	}
+
+	return authData.signCount, nil
+}
+
+// verifyClientData checks the type, challenge and origin the browser signed
+func (rp *RelyingParty) verifyClientData(raw []byte, ceremony string, challenge []byte) error {
+	var data clientData
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return fmt.Errorf("%w: invalid client data: %v", ErrInvalidResponse, err)
+	}
+	if data.Type != ceremony {
+		return fmt.Errorf("%w: unexpected client data type %q", ErrInvalidResponse, data.Type)
+	}
+	if len(challenge) == 0 || subtle.ConstantTimeCompare([]byte(data.Challenge), []byte(base64.RawURLEncoding.EncodeToString(challenge))) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidResponse)
+	}
+	if !slices.Contains(rp.Origins, data.Origin) {
+		return fmt.Errorf("%w: origin %q is not allowed", ErrInvalidResponse, data.Origin)
+	}
+	if data.CrossOrigin {
+		return fmt.Errorf("%w: cross-origin requests are not allowed", ErrInvalidResponse)
+	}
+	return nil
+}
+
+// parseAuthenticatorData parses authenticator data and checks it is for this
+// relying party and that the user was present and verified
+func (rp *RelyingParty) parseAuthenticatorData(data []byte) (*authenticatorData, error) {
+	// RP ID hash, flags and signature count
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data too short", ErrInvalidResponse)
+	}
+	authData := &authenticatorData{
+		rpIDHash:  data[:32],
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if subtle.ConstantTimeCompare(authData.rpIDHash, rpIDHash[:]) != 1 {
+		return nil, fmt.Errorf("%w: credential is for a different site", ErrInvalidResponse)
+	}
+	if authData.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user was not present", ErrInvalidResponse)
+	}
+	if authData.flags&flagUserVerified == 0 {
+		return nil, fmt.Errorf("%w: user was not verified", ErrInvalidResponse)
+	}
+
+	rest := data[37:]
+	if authData.flags&flagAttestedData != 0 {
+		// AAGUID, credential ID length, credential ID and public key
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data too short", ErrInvalidResponse)
+		}
+		length := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if length == 0 || length > maxCredentialIDSize || length > len(rest) {
+			return nil, fmt.Errorf("%w: invalid credential ID length", ErrInvalidResponse)
+		}
+		authData.credentialID = rest[:length]
+		rest = rest[length:]
+
+		_, remaining, err := parsePublicKey(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidResponse, err)
+		}
+		authData.publicKey = rest[:len(rest)-len(remaining)]
+		rest = remaining
+	}
+	if authData.flags&flagExtensionData != 0 {
+		_, remaining, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid extension data: %v", ErrInvalidResponse, err)
+		}
+		rest = remaining
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: unexpected trailing authenticator data", ErrInvalidResponse)
+	}
+
+	return authData, nil
+}
+
+// newChallenge generates a random challenge
+func newChallenge() (Bytes, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	return challenge, nil
+}
+
+// descriptors describes credentials by their IDs
+func descriptors(ids [][]byte) []CredentialDescriptor {
+	list := make([]CredentialDescriptor, 0, len(ids))
+	for _, id := range ids {
+		list = append(list, CredentialDescriptor{Type: "public-key", ID: id})
+	}
+	return list
+}
@@ -0,0 +1,148 @@
+package webauthn_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/bjschafer/print-dis/internal/webauthn"
+	"github.com/bjschafer/print-dis/internal/webauthn/webauthntest"
+)
+
+var relyingParty = &webauthn.RelyingParty{
+	ID:      "print.example.com",
+	Name:    "print-dis",
+	Origins: []string{"https://print.example.com"},
+}
+
+// register registers a new credential with the authenticator
+func register(t *testing.T, authenticator *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+	options, err := relyingParty.BeginRegistration(webauthn.User{ID: []byte("user-1"), Name: "alice", DisplayName: "Alice"}, nil)
+	if err != nil {
+		t.Fatalf("BeginRegistration failed: %v", err)
+	}
+	response, err := authenticator.Register(options)
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	credential, err := relyingParty.FinishRegistration(response, options.Challenge)
+	if err != nil {
+		t.Fatalf("FinishRegistration failed: %v", err)
+	}
+	return credential
+}
+
+func TestRegistrationAndLogin(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator("https://print.example.com")
+	credential := register(t, authenticator)
+
+	// The registered credential is excluded from registering again
+	options, err := relyingParty.BeginRegistration(webauthn.User{ID: []byte("user-1"), Name: "alice"}, [][]byte{credential.ID})
+	if err != nil {
+		t.Fatalf("BeginRegistration failed: %v", err)
+	}
+	if _, err := authenticator.Register(options); err == nil {
+		t.Error("Expected an excluded authenticator to refuse to register")
+	}
+
+	login, err := relyingParty.BeginLogin(nil)
+	if err != nil {
+		t.Fatalf("BeginLogin failed: %v", err)
+	}
+	assertion, err := authenticator.Login(login)
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	if string(assertion.Response.UserHandle) != "user-1" {
+		t.Errorf("Expected user handle user-1, got %q", assertion.Response.UserHandle)
+	}
+	signCount, err := relyingParty.FinishLogin(assertion, login.Challenge, credential)
+	if err != nil {
+		t.Fatalf("FinishLogin failed: %v", err)
+	}
+	if signCount != 1 {
+		t.Errorf("Expected sign count 1, got %d", signCount)
+	}
+
+	// A signature count that does not increase suggests a cloned credential
+	credential.SignCount = signCount
+	if _, err := relyingParty.FinishLogin(assertion, login.Challenge, credential); !errors.Is(err, webauthn.ErrInvalidResponse) {
+		t.Errorf("Expected replayed assertion to fail, got %v", err)
+	}
+}
+
+func TestFinishLoginRejects(t *testing.T) {
+	authenticator := webauthntest.NewAuthenticator("https://print.example.com")
+	credential := register(t, authenticator)
+	other := register(t, webauthntest.NewAuthenticator("https://print.example.com"))
+
+	tests := []struct {
+		name   string
+		modify func(assertion *webauthn.AssertionResponse, challenge *[]byte, credential *webauthn.Credential)
+	}{
+		{"wrong challenge", func(_ *webauthn.AssertionResponse, challenge *[]byte, _ *webauthn.Credential) {
+			*challenge = []byte("some other challenge")
+		}},
+		{"tampered signature", func(assertion *webauthn.AssertionResponse, _ *[]byte, _ *webauthn.Credential) {
+			assertion.Response.Signature[len(assertion.Response.Signature)-1] ^= 1
+		}},
+		{"tampered client data", func(assertion *webauthn.AssertionResponse, _ *[]byte, _ *webauthn.Credential) {
+			assertion.Response.ClientDataJSON = append(assertion.Response.ClientDataJSON[:len(assertion.Response.ClientDataJSON)-1], ' ', '}')
+		}},
+		{"different credential's key", func(_ *webauthn.AssertionResponse, _ *[]byte, credential *webauthn.Credential) {
+			credential.PublicKey = other.PublicKey
+		}},
+		{"wrong credential type", func(assertion *webauthn.AssertionResponse, _ *[]byte, _ *webauthn.Credential) {
+			assertion.Type = "other"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			login, err := relyingParty.BeginLogin([][]byte{credential.ID})
+			if err != nil {
+				t.Fatalf("BeginLogin failed: %v", err)
+			}
+			assertion, err := authenticator.Login(login)
+			if err != nil {
+				t.Fatalf("Login failed: %v", err)
+			}
+			challenge := []byte(login.Challenge)
+			stored := *credential
+			tt.modify(assertion, &challenge, &stored)
+			if _, err := relyingParty.FinishLogin(assertion, challenge, &stored); !errors.Is(err, webauthn.ErrInvalidResponse) {
+				t.Errorf("Expected ErrInvalidResponse, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFinishRegistrationRejects(t *testing.T) {
+	tests := []struct {
+		name          string
+		authenticator *webauthntest.Authenticator
+		rp            *webauthn.RelyingParty
+	}{
+		{"other origin", webauthntest.NewAuthenticator("https://evil.example.com"), relyingParty},
+		{"other site", webauthntest.NewAuthenticator("https://print.example.com"), &webauthn.RelyingParty{
+			ID:      "example.com",
+			Origins: relyingParty.Origins,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := relyingParty.BeginRegistration(webauthn.User{ID: []byte("user-1"), Name: "alice"}, nil)
+			if err != nil {
+				t.Fatalf("BeginRegistration failed: %v", err)
+			}
+			response, err := tt.authenticator.Register(options)
+			if err != nil {
+				t.Fatalf("Register failed: %v", err)
+			}
+			if _, err := tt.rp.FinishRegistration(response, options.Challenge); !errors.Is(err, webauthn.ErrInvalidResponse) {
+				t.Errorf("Expected ErrInvalidResponse, got %v", err)
+			}
+		})
+	}
+}
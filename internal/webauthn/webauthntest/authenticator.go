@@ -0,0 +1,244 @@
+// Package webauthntest provides a software authenticator for tests
+package webauthntest
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+
+	"github.com/bjschafer/print-dis/internal/webauthn"
+)
+
+// Authenticator data flags set by the authenticator: user present, user
+// verified and attested credential data
+const (
+	flagsLogin    = 0x01 | 0x04
+	flagsRegister = flagsLogin | 0x40
+)
+
+// Authenticator plays the part of a browser and a passkey provider. It creates
+// ES256 credentials that can be used without naming them, as passkeys can.
+type Authenticator struct {
+	// Origin is the origin the browser reports ceremonies coming from
+	Origin string
+
+	mu          sync.Mutex
+	credentials []*credential
+}
+
+// credential is a credential the authenticator holds
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+// NewAuthenticator creates an authenticator with no credentials
+func NewAuthenticator(origin string) *Authenticator {
+	return &Authenticator{Origin: origin}
+}
+
+// Register creates a credential as navigator.credentials.create() would
+func (a *Authenticator) Register(options *webauthn.CreationOptions) (*webauthn.RegistrationResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if !slices.ContainsFunc(options.Parameters, func(p webauthn.CredentialParameter) bool {
+		return p.Algorithm == webauthn.AlgES256
+	}) {
+		return nil, errors.New("ES256 is not offered")
+	}
+	for _, excluded := range options.ExcludeCredentials {
+		if a.find(options.RelyingParty.ID, excluded.ID) != nil {
+			return nil, errors.New("authenticator is already registered")
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	cred := &credential{
+		id:         []byte(rand.Text()),
+		rpID:       options.RelyingParty.ID,
+		userHandle: options.User.ID,
+		key:        key,
+	}
+	a.credentials = append(a.credentials, cred)
+
+	authData := authenticatorData(cred.rpID, flagsRegister, cred.signCount)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(cred.id)))
+	authData = append(authData, cred.id...)
+	authData = append(authData, encodeCBOR(map[int]any{
+		1:  2,  // EC2 key
+		3:  -7, // ES256
+		-1: 1,  // P-256
+		-2: key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})...)
+
+	response := &webauthn.RegistrationResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(cred.id),
+		RawID: cred.id,
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = a.clientData("webauthn.create", options.Challenge)
+	response.Response.AttestationObject = encodeCBOR(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	return response, nil
+}
+
+// Login signs in as navigator.credentials.get() would, with the first of the
+// allowed credentials it holds, or any of its credentials for the site when
+// none are listed
+func (a *Authenticator) Login(options *webauthn.RequestOptions) (*webauthn.AssertionResponse, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var cred *credential
+	if len(options.AllowCredentials) == 0 {
+		cred = a.find(options.RelyingPartyID, nil)
+	}
+	for _, allowed := range options.AllowCredentials {
+		if cred = a.find(options.RelyingPartyID, allowed.ID); cred != nil {
+			break
+		}
+	}
+	if cred == nil {
+		return nil, errors.New("no credential for this site")
+	}
+
+	cred.signCount++
+	authData := authenticatorData(cred.rpID, flagsLogin, cred.signCount)
+	clientData := a.clientData("webauthn.get", options.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, cred.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	response := &webauthn.AssertionResponse{
+		ID:    base64.RawURLEncoding.EncodeToString(cred.id),
+		RawID: cred.id,
+		Type:  "public-key",
+	}
+	response.Response.ClientDataJSON = clientData
+	response.Response.AuthenticatorData = authData
+	response.Response.Signature = signature
+	response.Response.UserHandle = cred.userHandle
+	return response, nil
+}
+
+// find returns the credential with the ID for the site, or the first for the
+// site when id is nil
+func (a *Authenticator) find(rpID string, id []byte) *credential {
+	for _, cred := range a.credentials {
+		if cred.rpID == rpID && (id == nil || bytes.Equal(cred.id, id)) {
+			return cred
+		}
+	}
+	return nil
+}
+
+// clientData returns the clientDataJSON the browser would create
+func (a *Authenticator) clientData(ceremony string, challenge []byte) []byte {
+	data, _ := json.Marshal(map[string]any{
+		"type":        ceremony,
+		"challenge":   base64.RawURLEncoding.EncodeToString(challenge),
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+	return data
+}
+
+// authenticatorData returns the RP ID hash, flags and signature count
+func authenticatorData(rpID string, flags byte, signCount uint32) []byte {
+	rpIDHash := sha256.Sum256([]byte(rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, signCount)
+}
+
+// encodeCBOR encodes integers, byte and text strings, and maps with integer
+// or string keys, which are sorted so the output is deterministic
+func encodeCBOR(value any) []byte {
+	var buf bytes.Buffer
+	writeCBOR(&buf, value)
+	return buf.Bytes()
+}
+
+func writeCBOR(buf *bytes.Buffer, value any) {
+	switch value := value.(type) {
+	case int:
+		if value >= 0 {
+			writeCBORHead(buf, 0, uint64(value))
+		} else {
+			writeCBORHead(buf, 1, uint64(-1-value))
+		}
+	case []byte:
+		writeCBORHead(buf, 2, uint64(len(value)))
+		buf.Write(value)
+	case string:
+		writeCBORHead(buf, 3, uint64(len(value)))
+		buf.WriteString(value)
+	case map[int]any:
+		keys := make([]int, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Ints(keys)
+		writeCBORHead(buf, 5, uint64(len(value)))
+		for _, key := range keys {
+			writeCBOR(buf, key)
+			writeCBOR(buf, value[key])
+		}
+	case map[string]any:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		writeCBORHead(buf, 5, uint64(len(value)))
+		for _, key := range keys {
+			writeCBOR(buf, key)
+			writeCBOR(buf, value[key])
+		}
+	default:
+		panic(fmt.Sprintf("webauthntest: cannot encode %T", value))
+	}
+}
+
+// writeCBORHead writes the initial byte and argument of a data item
+func writeCBORHead(buf *bytes.Buffer, major byte, argument uint64) {
+	switch {
+	case argument < 24:
+		buf.WriteByte(major<<5 | byte(argument))
+	case argument <= 0xff:
+		buf.Write([]byte{major<<5 | 24, byte(argument)})
+	case argument <= 0xffff:
+		buf.WriteByte(major<<5 | 25)
+		buf.Write(binary.BigEndian.AppendUint16(nil, uint16(argument)))
+	case argument <= 0xffffffff:
+		buf.WriteByte(major<<5 | 26)
+		buf.Write(binary.BigEndian.AppendUint32(nil, uint32(argument)))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		buf.Write(binary.BigEndian.AppendUint64(nil, argument))
+	}
+}
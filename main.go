@@ -15,6 +15,7 @@ import (
 	"github.com/bjschafer/print-dis/internal/config"
 	"github.com/bjschafer/print-dis/internal/database"
 	"github.com/bjschafer/print-dis/internal/handlers"
+	"github.com/bjschafer/print-dis/internal/mailer"
 	"github.com/bjschafer/print-dis/internal/middleware"
 	"github.com/bjschafer/print-dis/internal/migrations"
 	"github.com/bjschafer/print-dis/internal/router"
@@ -91,27 +92,196 @@ func main() {
 	// Create service layer
 	printRequestService := services.NewPrintRequestService(db)
 	userService := services.NewUserService(db)
+	printerService := services.NewPrinterService(db)
+	groupService := services.NewGroupService(db)
+	roleService := services.NewRoleService(db)
 
-	// Initialize Spoolman if enabled
-	var spoolmanService *spoolman.Service
+	// Background workers are stopped through this context on shutdown
+	ctx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	// Permission checks use the roles stored in the database
+	if err := roleService.Load(ctx); err != nil {
+		slog.Error("failed to load roles", "error", err)
+		os.Exit(1)
+	}
+
+	// Initialize Spoolman if enabled, otherwise fall back to the built-in inventory
+	var inventory services.InventoryProvider
+	var localInventoryHandler *handlers.LocalInventoryHandler
 	if cfg.Spoolman.Enabled {
 		spoolmanClient := spoolman.New(cfg.Spoolman.Endpoint)
-		spoolmanService = spoolman.NewService(spoolmanClient)
+		spoolmanService := spoolman.NewService(spoolmanClient)
+		inventory = spoolmanService
 		slog.Info("Spoolman integration enabled", "endpoint", cfg.Spoolman.Endpoint)
+
+		if cfg.Spoolman.ExtraFields {
+			// Spool usage is recorded in the background, registering the
+			// extra fields first, so Spoolman being down does not hold up
+			// moderators
+			usageRecorder := spoolman.NewUsageRecorder(spoolmanService)
+			printRequestService.SetSpoolUsageRecorder(usageRecorder)
+			go usageRecorder.Run(ctx)
+		}
+
+		if cfg.Spoolman.Realtime {
+			subscriber := spoolman.NewSubscriber(spoolmanClient, spoolmanService)
+			subscriber.OnSpoolUnavailable(func(ctx context.Context, spool spoolman.Spool) {
+				if _, err := printRequestService.FlagSpoolUnavailable(ctx, spool.Id); err != nil {
+					slog.Error("failed to flag print requests for unavailable spool", "spool_id", spool.Id, "error", err)
+				}
+			})
+			go subscriber.Run(ctx)
+		}
 	} else {
-		slog.Info("Spoolman integration disabled")
+		localInventory := services.NewLocalInventoryService(db)
+		localInventory.OnSpoolUnavailable(func(ctx context.Context, spoolID int) {
+			if _, err := printRequestService.FlagSpoolUnavailable(ctx, spoolID); err != nil {
+				slog.Error("failed to flag print requests for unavailable spool", "spool_id", spoolID, "error", err)
+			}
+		})
+		inventory = localInventory
+		localInventoryHandler = handlers.NewLocalInventoryHandler(localInventory)
+		slog.Info("Spoolman integration disabled, using the built-in inventory")
+	}
+
+	// Price requests from filament usage and print time if enabled
+	var pricingHandler *handlers.PricingHandler
+	if cfg.Pricing.Enabled {
+		pricingService := services.NewPricingService(cfg.Pricing, inventory)
+		printRequestService.SetPricing(pricingService)
+		pricingHandler = handlers.NewPricingHandler(pricingService)
+		slog.Info("print request pricing enabled", "currency", cfg.Pricing.Currency)
+	}
+
+	var billingHandler *handlers.BillingHandler
+	if cfg.Billing.Enabled {
+		if !cfg.Pricing.Enabled {
+			slog.Warn("billing is enabled but pricing is not, so completed requests will not be charged")
+		}
+		ledgerService := services.NewLedgerService(db, cfg.Billing, cfg.Pricing.Currency)
+		printRequestService.SetLedger(ledgerService)
+		billingHandler = handlers.NewBillingHandler(ledgerService)
+		slog.Info("billing ledger enabled", "hold_negative_balance", cfg.Billing.HoldNegativeBalance)
+	}
+
+	var quotaService *services.QuotaService
+	if cfg.Quotas.Enabled {
+		quotaService = services.NewQuotaService(db, cfg.Quotas)
+		printRequestService.SetQuotas(quotaService)
+		slog.Info("print request quotas enabled",
+			"max_open_requests", cfg.Quotas.MaxOpenRequests,
+			"monthly_grams", cfg.Quotas.MonthlyGrams,
+			"monthly_hours", cfg.Quotas.MonthlyHours)
 	}
 
 	// Create session store for authentication
 	sessionStore := middleware.NewSessionStore(cfg, db)
+	sessionService := services.NewSessionService(db)
+	go sessionService.RunSweeper(ctx, time.Hour)
+	if cfg.Auth.TrustedHeader.Enabled {
+		sessionStore.SetTrustedHeaderAuth(middleware.NewTrustedHeaderAuth(cfg.Auth.TrustedHeader, userService))
+		slog.Info("trusted header authentication enabled",
+			"user_header", cfg.Auth.TrustedHeader.UserHeader,
+			"trusted_proxies", cfg.Auth.TrustedHeader.TrustedProxies)
+	}
+
+	// Check passwords that are not a local account's against LDAP directories
+	var ldapProviders []services.AuthProvider
+	for _, providerCfg := range cfg.Auth.LDAP.Providers {
+		if !providerCfg.Enabled {
+			continue
+		}
+		provider, err := services.NewLDAPProvider(providerCfg)
+		if err != nil {
+			slog.Error("failed to set up LDAP provider", "provider", providerCfg.Name, "error", err)
+			os.Exit(1)
+		}
+		ldapProviders = append(ldapProviders, provider)
+		slog.Info("LDAP authentication enabled", "provider", providerCfg.Name, "url", providerCfg.URL)
+	}
+	userService.SetAuthProviders(ldapProviders...)
 
 	// Create handlers
-	printRequestHandler := handlers.NewPrintRequestHandler(printRequestService, spoolmanService)
-	authHandler := handlers.NewAuthHandler(userService, sessionStore, cfg)
+	printRequestHandler := handlers.NewPrintRequestHandler(printRequestService, inventory)
+	twoFactorService := services.NewTwoFactorService(db, cfg.Auth.LocalAuth.TOTP)
+	authHandler := handlers.NewAuthHandler(userService, twoFactorService, sessionStore, cfg)
+	twoFactorHandler := handlers.NewTwoFactorHandler(twoFactorService, userService)
+	oidcHandler := handlers.NewOIDCHandler(userService, sessionStore, cfg)
+	tokenHandler := handlers.NewTokenHandler(services.NewTokenService(db))
+	sessionHandler := handlers.NewSessionHandler(sessionService, sessionStore)
 	adminHandler := handlers.NewAdminHandler(userService, cfg)
-	var spoolmanHandler *api.SpoolmanHandler
-	if spoolmanService != nil {
-		spoolmanHandler = api.NewSpoolmanHandler(spoolmanService)
+	invitationService := services.NewInvitationService(db)
+	invitationHandler := handlers.NewInvitationHandler(invitationService, cfg)
+	userImportService := services.NewUserImportService(db, userService, invitationService)
+	adminHandler.SetUserImport(userImportService)
+	printerHandler := handlers.NewPrinterHandler(printerService)
+	groupHandler := handlers.NewGroupHandler(groupService, userService)
+	roleHandler := handlers.NewRoleHandler(roleService)
+
+	// Record administrative and security events in the audit log
+	auditService := services.NewAuditService(db)
+	auditHandler := handlers.NewAuditHandler(auditService)
+	adminHandler.SetAudit(auditService)
+	authHandler.SetAudit(auditService)
+	oidcHandler.SetAudit(auditService)
+	printRequestHandler.SetAudit(auditService)
+	roleHandler.SetAudit(auditService)
+	groupHandler.SetAudit(auditService)
+	invitationHandler.SetAudit(auditService)
+	if billingHandler != nil {
+		billingHandler.SetAudit(auditService)
+	}
+	analyticsService := services.NewAnalyticsService(db)
+	analyticsHandler := handlers.NewAnalyticsHandler(analyticsService)
+	inventoryHandler := api.NewInventoryHandler(inventory)
+
+	var quotaHandler *handlers.QuotaHandler
+	if quotaService != nil {
+		authHandler.SetQuotas(quotaService)
+		analyticsService.SetQuotas(quotaService)
+		quotaHandler = handlers.NewQuotaHandler(quotaService, userService)
+	}
+
+	// Passkeys belong to the configured site, which requests can't choose
+	var webAuthnHandler *handlers.WebAuthnHandler
+	switch {
+	case !cfg.Auth.WebAuthn.Enabled:
+	case cfg.Auth.WebAuthn.RPID == "" || len(cfg.Auth.WebAuthn.Origins) == 0:
+		slog.Warn("passkeys are disabled until server.base_url, or auth.webauthn.rp_id and origins, are set")
+	default:
+		webAuthnService := services.NewWebAuthnService(db, cfg.Auth.WebAuthn)
+		authHandler.SetWebAuthn(webAuthnService)
+		webAuthnHandler = handlers.NewWebAuthnHandler(webAuthnService)
+	}
+
+	// Email local accounts links to reset forgotten passwords and verify
+	// their address
+	if cfg.Auth.LocalAuth.Enabled {
+		m, err := mailer.FromConfig(cfg.Mail)
+		if err != nil {
+			slog.Error("failed to set up mail", "error", err)
+			os.Exit(1)
+		}
+		emailService := services.NewEmailService(db, m)
+		authHandler.SetEmail(emailService)
+		userImportService.SetEmail(emailService)
+		if cfg.Auth.LocalAuth.RequireEmailVerification {
+			userService.SetEmailVerification(emailService)
+		}
+		slog.Info("email enabled", "backend", cfg.Mail.Backend, "require_email_verification", cfg.Auth.LocalAuth.RequireEmailVerification)
+
+		// Slow down and stop password guessing against each username
+		if cfg.Auth.LocalAuth.Lockout.Enabled {
+			lockoutService := services.NewLockoutService(db, cfg.Auth.LocalAuth.Lockout)
+			lockoutService.SetNotifier(emailService)
+			userService.SetLockout(lockoutService)
+			adminHandler.SetLockout(lockoutService)
+			go lockoutService.RunSweeper(ctx, time.Hour)
+			slog.Info("account lockout enabled",
+				"max_attempts", cfg.Auth.LocalAuth.Lockout.MaxAttempts,
+				"duration", cfg.Auth.LocalAuth.Lockout.Duration)
+		}
 	}
 
 	// Create a new server
@@ -124,18 +294,33 @@ func main() {
 	mux := http.NewServeMux()
 
 	deps := &router.Dependencies{
-		Config:              cfg,
-		SessionStore:        sessionStore,
-		PrintRequestHandler: printRequestHandler,
-		AuthHandler:         authHandler,
-		AdminHandler:        adminHandler,
-		SpoolmanHandler:     spoolmanHandler,
+		Config:                cfg,
+		SessionStore:          sessionStore,
+		PrintRequestHandler:   printRequestHandler,
+		AuthHandler:           authHandler,
+		OIDCHandler:           oidcHandler,
+		TokenHandler:          tokenHandler,
+		SessionHandler:        sessionHandler,
+		TwoFactorHandler:      twoFactorHandler,
+		WebAuthnHandler:       webAuthnHandler,
+		AdminHandler:          adminHandler,
+		InvitationHandler:     invitationHandler,
+		InventoryHandler:      inventoryHandler,
+		LocalInventoryHandler: localInventoryHandler,
+		PrinterHandler:        printerHandler,
+		PricingHandler:        pricingHandler,
+		BillingHandler:        billingHandler,
+		QuotaHandler:          quotaHandler,
+		GroupHandler:          groupHandler,
+		RoleHandler:           roleHandler,
+		AuditHandler:          auditHandler,
+		AnalyticsHandler:      analyticsHandler,
 	}
 
 	router.SetupRoutes(mux, deps)
 
 	// Set the server's handler with security middleware
-	server.Handler = middleware.SecurityHeaders()(mux)
+	server.Handler = middleware.SecurityHeaders()(middleware.ForwardedFor(cfg.Auth.TrustedHeader.TrustedProxies)(mux))
 
 	// Create a channel to listen for errors coming from the server
 	serverErrors := make(chan error, 1)
@@ -158,6 +343,7 @@ func main() {
 	case sig := <-shutdown:
 		slog.Info("received signal", "signal", sig)
 		slog.Info("shutting down server...")
+		stopBackground()
 
 		// Create a deadline for server shutdown
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
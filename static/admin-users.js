@@ -11,6 +11,7 @@ class UserManagement {
     await this.checkAuth();
     await this.loadUsers();
     await this.loadStats();
+    await this.loadRoles();
     this.setupEventListeners();
   }
 
@@ -25,13 +26,35 @@ class UserManagement {
     this.currentUser = user;
 
     // Check if user has admin/moderator permissions
-    if (!window.authModule.hasRole('moderator')) {
-      alert("Access denied. Admin or moderator role required.");
+    if (!window.authModule.hasPermission('view_users')) {
+      alert("Access denied. Permission to view users required.");
       window.location.href = "/";
       return;
     }
   }
 
+  // Offer custom roles alongside the built-in ones
+  async loadRoles() {
+    if (!window.authModule.hasPermission("manage_roles")) return;
+
+    try {
+      const response = await fetch("/api/admin/roles");
+      if (!response.ok) return;
+      const result = await response.json();
+
+      const select = document.getElementById("newRoleSelect");
+      select.innerHTML = "";
+      result.data.forEach((role) => {
+        const option = document.createElement("option");
+        option.value = role.name;
+        option.textContent = role.name.charAt(0).toUpperCase() + role.name.slice(1);
+        select.appendChild(option);
+      });
+    } catch (error) {
+      console.error("Failed to load roles:", error);
+    }
+  }
+
   async loadUsers() {
     try {
       const response = await fetch("/api/admin/users");
@@ -152,8 +175,8 @@ class UserManagement {
     // Can't manage yourself
     if (user.id === this.currentUser.id) return false;
 
-    // Admin can manage anyone
-    if (this.currentUser.role === "admin") return true;
+    // Users who can promote others can manage anyone
+    if (window.authModule.hasPermission("promote_users")) return true;
 
     // Moderator can manage regular users
     if (this.currentUser.role === "moderator" && user.role === "user")
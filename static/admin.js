@@ -173,6 +173,13 @@ function displayPrintRequests(printRequests) {
       filamentInfo = parts.join(", ");
     }
 
+    // Show the actual cost of completed requests, the estimate otherwise
+    if (request.actual_cost != null) {
+      filamentInfo += `<br><small>Cost: ${request.actual_cost.toFixed(2)}</small>`;
+    } else if (request.estimated_cost != null) {
+      filamentInfo += `<br><small>Estimated cost: ${request.estimated_cost.toFixed(2)}</small>`;
+    }
+
     // Format notes with truncation
     let notesDisplay = "No notes";
     if (request.notes && request.notes.trim()) {
@@ -249,6 +256,7 @@ async function loadPrintRequests() {
 
     // Extract data from response wrapper (API returns {success, data, message})
     const printRequests = responseData.data || responseData;
+    window.printRequests = printRequests;
     displayPrintRequests(printRequests);
   } catch (error) {
     console.error("Error loading print requests:", error);
@@ -264,7 +272,7 @@ document.addEventListener("DOMContentLoaded", async () => {
     return;
   }
   
-  if (!window.authModule.hasRole('moderator')) {
+  if (!window.authModule.hasPermission('manage_print_requests') && !window.authModule.moderatesGroup()) {
     window.location.href = "/dashboard.html";
     return;
   }
@@ -363,6 +371,19 @@ document.addEventListener("DOMContentLoaded", async () => {
   confirmButton.addEventListener("click", async () => {
     const select = document.getElementById("newStatusSelect");
     const newStatus = select.value;
+    const printerId = document.getElementById("printerSelect").value;
+    const body = { status: newStatus };
+    if (printerId) {
+      body.printer_id = parseInt(printerId, 10);
+    }
+    const actualGrams = parseFloat(document.getElementById("actualGrams").value);
+    if (!isNaN(actualGrams)) {
+      body.actual_grams = actualGrams;
+    }
+    const actualHours = parseFloat(document.getElementById("actualHours").value);
+    if (!isNaN(actualHours)) {
+      body.actual_hours = actualHours;
+    }
 
     try {
       const response = await fetch(
@@ -373,9 +394,7 @@ document.addEventListener("DOMContentLoaded", async () => {
             "Content-Type": "application/json",
             "Accept": "application/json",
           },
-          body: JSON.stringify({
-            status: newStatus,
-          }),
+          body: JSON.stringify(body),
         },
       );
 
@@ -412,10 +431,47 @@ document.addEventListener("DOMContentLoaded", async () => {
   });
 });
 
-function showStatusUpdateModal(requestId, currentStatus) {
+// Function to load printers for the status update modal
+async function loadPrinters() {
+  const printerSelect = document.getElementById("printerSelect");
+  try {
+    const response = await fetch("/api/printers", {
+      credentials: "include",
+      headers: {
+        Accept: "application/json",
+      },
+    });
+    if (!response.ok) {
+      throw new Error("Failed to fetch printers");
+    }
+    const responseData = await response.json();
+    const printers = responseData.data || [];
+
+    printerSelect.innerHTML = '<option value="">No printer assigned</option>';
+    printers.forEach((printer) => {
+      const option = document.createElement("option");
+      option.value = printer.id;
+      option.textContent = printer.name;
+      printerSelect.appendChild(option);
+    });
+  } catch (error) {
+    console.error("Error loading printers:", error);
+  }
+}
+
+async function showStatusUpdateModal(requestId, currentStatus) {
   const modal = document.getElementById("statusUpdateModal");
   const select = document.getElementById("newStatusSelect");
 
+  await loadPrinters();
+  const request = (window.printRequests || []).find((r) => r.id === requestId);
+  document.getElementById("printerSelect").value =
+    request && request.printer_id ? String(request.printer_id) : "";
+  document.getElementById("actualGrams").value =
+    request && request.actual_grams != null ? request.actual_grams : "";
+  document.getElementById("actualHours").value =
+    request && request.actual_hours != null ? request.actual_hours : "";
+
   // Define valid status transitions based on backend logic
   const validTransitions = {
     "StatusPendingApproval": ["StatusEnqueued", "StatusPendingApproval"],
@@ -51,25 +51,90 @@ document.addEventListener("DOMContentLoaded", () => {
 
     // Store user info globally for compatibility (keep existing code working)
     window.currentUser = user;
+
+    populateGroups(user.groups || []);
     
     // Check if spoolman is available
     await checkSpoolmanAvailability();
   }
 
+  // Let users in several groups choose which one to submit to
+  function populateGroups(groups) {
+    if (groups.length < 2) {
+      return;
+    }
+    const groupSelect = document.getElementById("group");
+    groups.forEach((group) => {
+      const option = document.createElement("option");
+      option.value = group.group_id;
+      option.textContent = group.group_name;
+      groupSelect.appendChild(option);
+    });
+    document.getElementById("groupField").style.display = "block";
+  }
+
   // Check if spoolman is available and hide button if not
   async function checkSpoolmanAvailability() {
     try {
-      const response = await fetch("/api/spoolman/spools");
+      const response = await fetch("/api/inventory/spools");
       if (!response.ok) {
         // Spoolman is not available, hide the button
         hideSpoolmanButton();
+        return;
       }
+      await loadFilamentCatalogue();
     } catch (error) {
       // Network error or spoolman not available
       hideSpoolmanButton();
     }
   }
 
+  // Load the Spoolman filament catalogue so manual entry can be filled from a known filament
+  async function loadFilamentCatalogue() {
+    const catalogueGroup = document.getElementById("filamentCatalogueGroup");
+    const catalogue = document.getElementById("filamentCatalogue");
+    try {
+      const response = await fetch("/api/inventory/filaments");
+      if (!response.ok) {
+        return;
+      }
+      const filaments = await response.json();
+      window.filamentCatalogue = filaments;
+
+      filaments
+        .slice()
+        .sort((a, b) => filamentLabel(a).localeCompare(filamentLabel(b)))
+        .forEach((filament) => {
+          const option = document.createElement("option");
+          option.value = filament.id;
+          option.textContent = `${filamentLabel(filament)} (${filament.material})`;
+          catalogue.appendChild(option);
+        });
+
+      catalogue.addEventListener("change", () => {
+        const filament = window.filamentCatalogue.find(
+          (f) => String(f.id) === catalogue.value,
+        );
+        if (!filament) {
+          return;
+        }
+        document.getElementById("color").value = filamentLabel(filament);
+        document.getElementById("material").value = filament.material || "";
+      });
+
+      catalogueGroup.style.display = "block";
+    } catch (error) {
+      // The catalogue is a convenience, manual entry still works without it
+      console.error("Error loading filament catalogue:", error);
+    }
+  }
+
+  // Human readable filament name, e.g. "Prusament PETG Galaxy Black"
+  function filamentLabel(filament) {
+    const vendor = filament.vendor && filament.vendor.name;
+    return vendor ? `${vendor} ${filament.name}` : filament.name;
+  }
+
   // Hide the spoolman button and show manual only
   function hideSpoolmanButton() {
     const spoolmanSection = spoolmanEnabled.closest(".selection-option");
@@ -143,10 +208,10 @@ document.addEventListener("DOMContentLoaded", () => {
   async function loadSpoolmanData() {
     try {
       // Load spools
-      const spoolsResponse = await fetch("/api/spoolman/spools");
+      const spoolsResponse = await fetch("/api/inventory/spools");
       if (!spoolsResponse.ok) {
         if (spoolsResponse.status === 404) {
-          statusDiv.textContent = "Spoolman integration is not enabled";
+          statusDiv.textContent = "No filament inventory is available";
           statusDiv.className = "status error";
           spoolmanFields.style.display = "none";
           manualEntrySection.style.display = "block";
@@ -164,7 +229,7 @@ document.addEventListener("DOMContentLoaded", () => {
       window.allSpools = spools;
 
       // Load materials
-      const materialsResponse = await fetch("/api/spoolman/materials");
+      const materialsResponse = await fetch("/api/inventory/materials");
       if (!materialsResponse.ok) {
         throw new Error(
           `Failed to load materials: ${materialsResponse.status}`,
@@ -233,7 +298,7 @@ document.addEventListener("DOMContentLoaded", () => {
     }
 
     try {
-      const response = await fetch(`/api/spoolman/spool?id=${spoolId}`);
+      const response = await fetch(`/api/inventory/spool?id=${spoolId}`);
       if (!response.ok) {
         throw new Error(`Failed to load spool details: ${response.status}`);
       }
@@ -296,6 +361,21 @@ document.addEventListener("DOMContentLoaded", () => {
       }
     }
 
+    const groupId = document.getElementById("group").value;
+    if (groupId) {
+      formData.group_id = groupId;
+    }
+
+    // Add slicer estimates used for pricing
+    const estimatedGrams = parseFloat(document.getElementById("estimatedGrams").value);
+    if (!isNaN(estimatedGrams)) {
+      formData.estimated_grams = estimatedGrams;
+    }
+    const estimatedHours = parseFloat(document.getElementById("estimatedHours").value);
+    if (!isNaN(estimatedHours)) {
+      formData.estimated_hours = estimatedHours;
+    }
+
     try {
       const response = await fetch("/api/print-requests", {
         method: "POST",
@@ -306,13 +386,23 @@ document.addEventListener("DOMContentLoaded", () => {
       });
 
       if (!response.ok) {
+        // Show which quota or field was rejected, if the server said
+        const errorData = await response.json().catch(() => null);
+        const details = errorData && errorData.error && errorData.error.details;
+        if (Array.isArray(details) && details.length > 0) {
+          throw new Error(details.map((d) => `${d.field.replace(/_/g, " ")} ${d.message}`).join("; "));
+        }
         throw new Error(`HTTP error! status: ${response.status}`);
       }
 
       const result = await response.json();
 
-      // Show success message
+      // Show success message, with the estimated cost if the request was priced
       statusDiv.textContent = "Print job submitted successfully!";
+      const created = result.data || result;
+      if (created && created.estimated_cost != null) {
+        statusDiv.textContent += ` Estimated cost: ${created.estimated_cost.toFixed(2)}`;
+      }
       statusDiv.className = "status success";
 
       // Reset form
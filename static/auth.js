@@ -14,6 +14,19 @@ document.addEventListener("DOMContentLoaded", async () => {
   // Check OIDC providers and show if available
   await checkOIDCProviders();
 
+  // Offer passkey login in browsers that support it
+  const passkeyButton = document.getElementById("passkeyLogin");
+  if (window.PublicKeyCredential) {
+    passkeyButton.style.display = "flex";
+    passkeyButton.addEventListener("click", handlePasskeyLogin);
+  }
+
+  // Password reset links
+  document.getElementById("forgotPassword").addEventListener("click", async (e) => {
+    e.preventDefault();
+    await handleForgotPassword();
+  });
+
   // Form switching
   showRegisterLink.addEventListener("click", (e) => {
     e.preventDefault();
@@ -187,7 +200,13 @@ document.addEventListener("DOMContentLoaded", async () => {
         throw new Error(errorMessage);
       }
 
-      const user = responseData.data || responseData;
+      let user = responseData.data || responseData;
+
+      // Accounts with two-factor authentication need a code from their
+      // authenticator app, or a recovery code, before they are logged in
+      if (user.two_factor_required) {
+        user = await completeTwoFactorLogin();
+      }
       
       // Set user in shared auth module
       window.authModule.setCurrentUser(user);
@@ -208,12 +227,106 @@ document.addEventListener("DOMContentLoaded", async () => {
     }
   }
 
+  async function completeTwoFactorLogin() {
+    const code = window.prompt("Enter the code from your authenticator app, or a recovery code");
+    if (!code) {
+      throw new Error("Two-factor code is required");
+    }
+
+    // Recovery codes are longer than authenticator codes and contain letters
+    const trimmed = code.trim();
+    const body = /^\d{6}$/.test(trimmed) ? { code: trimmed } : { recovery_code: trimmed };
+    const response = await fetch("/api/auth/login/2fa", {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify(body),
+    });
+
+    const responseData = await response.json();
+    if (!response.ok) {
+      throw new Error(responseData.error?.message || responseData.message || "Invalid code");
+    }
+    return responseData.data || responseData;
+  }
+
+  async function handlePasskeyLogin() {
+    clearStatus();
+    setButtonLoading(passkeyButton, true);
+
+    try {
+      const optionsResponse = await fetch("/api/auth/login/passkey/options", { method: "POST" });
+      const optionsData = await optionsResponse.json();
+      if (!optionsResponse.ok) {
+        throw new Error(optionsData.error?.message || "Passkey login is not available");
+      }
+      const options = optionsData.data;
+
+      // Binary fields are sent as base64url
+      const credential = await navigator.credentials.get({
+        publicKey: {
+          ...options,
+          challenge: fromBase64URL(options.challenge),
+          allowCredentials: options.allowCredentials.map((c) => ({ ...c, id: fromBase64URL(c.id) })),
+        },
+      });
+
+      const response = await fetch("/api/auth/login/passkey", {
+        method: "POST",
+        headers: {
+          "Content-Type": "application/json",
+        },
+        body: JSON.stringify({
+          id: credential.id,
+          rawId: toBase64URL(credential.rawId),
+          type: credential.type,
+          response: {
+            clientDataJSON: toBase64URL(credential.response.clientDataJSON),
+            authenticatorData: toBase64URL(credential.response.authenticatorData),
+            signature: toBase64URL(credential.response.signature),
+            userHandle: credential.response.userHandle ? toBase64URL(credential.response.userHandle) : "",
+          },
+        }),
+      });
+      const responseData = await response.json();
+      if (!response.ok) {
+        throw new Error(responseData.error?.message || "Passkey login failed");
+      }
+
+      const user = responseData.data;
+      window.authModule.setCurrentUser(user);
+      showStatus(`Welcome back, ${user.username}!`, "success");
+      setTimeout(() => {
+        window.location.href = "/";
+      }, 1500);
+    } catch (error) {
+      console.error("Passkey login error:", error);
+      // The browser reports cancelling as NotAllowedError
+      const message = error.name === "NotAllowedError" ? "Passkey login was cancelled" : error.message;
+      showStatus(message || "Passkey login failed", "error");
+    } finally {
+      setButtonLoading(passkeyButton, false);
+    }
+  }
+
+  function fromBase64URL(value) {
+    const base64 = value.replace(/-/g, "+").replace(/_/g, "/");
+    return Uint8Array.from(atob(base64), (c) => c.charCodeAt(0));
+  }
+
+  function toBase64URL(buffer) {
+    const base64 = btoa(String.fromCharCode(...new Uint8Array(buffer)));
+    return base64.replace(/\+/g, "-").replace(/\//g, "_").replace(/=+$/, "");
+  }
+
   async function handleRegistration(e) {
     const formData = new FormData(e.target);
     const username = formData.get("username");
     const email = formData.get("email");
     const password = formData.get("password");
     const confirmPassword = formData.get("confirmPassword");
+    const invitationCode = formData.get("invitationCode");
 
     if (!username || !password || !confirmPassword) {
       showStatus("Please fill in all required fields", "error");
@@ -239,15 +352,27 @@ document.addEventListener("DOMContentLoaded", async () => {
         headers: {
           "Content-Type": "application/json",
         },
-        body: JSON.stringify({ username, email: email || undefined, password }),
+        body: JSON.stringify({
+          username,
+          email: email || undefined,
+          password,
+          invitation_code: invitationCode || undefined,
+        }),
       });
 
+      const responseData = await response.json();
       if (!response.ok) {
-        const errorText = await response.text();
-        throw new Error(errorText || `HTTP error! status: ${response.status}`);
+        throw new Error(responseData.error?.message || `HTTP error! status: ${response.status}`);
       }
 
-      const user = await response.json();
+      const user = responseData.data;
+
+      // New accounts may need to verify their email address before logging in
+      if (user.email_verification_required) {
+        showLoginForm();
+        showStatus("Account created! Open the link we emailed you to verify your address, then sign in.", "info");
+        return;
+      }
       
       // Set user in shared auth module
       window.authModule.setCurrentUser(user);
@@ -275,6 +400,61 @@ document.addEventListener("DOMContentLoaded", async () => {
     }
   }
 
+  async function handleForgotPassword() {
+    const email = window.prompt("Enter your account's email address and we'll send you a link to reset your password");
+    if (!email) {
+      return;
+    }
+
+    try {
+      const responseData = await postJSON("/api/auth/forgot-password", { email });
+      showStatus(responseData.message, "info");
+    } catch (error) {
+      console.error("Password reset error:", error);
+      showStatus(error.message || "Failed to send password reset link", "error");
+    }
+  }
+
+  async function handleResetPassword(token) {
+    const password = window.prompt("Choose a new password (at least 8 characters)");
+    if (!password) {
+      return;
+    }
+
+    try {
+      const responseData = await postJSON("/api/auth/reset-password", { token, password });
+      showStatus(responseData.message, "success");
+    } catch (error) {
+      console.error("Password reset error:", error);
+      showStatus(error.message || "Failed to reset password", "error");
+    }
+  }
+
+  async function handleVerifyEmail(token) {
+    try {
+      const responseData = await postJSON("/api/auth/verify-email", { token });
+      showStatus(responseData.message, "success");
+    } catch (error) {
+      console.error("Email verification error:", error);
+      showStatus(error.message || "Failed to verify email address", "error");
+    }
+  }
+
+  async function postJSON(url, body) {
+    const response = await fetch(url, {
+      method: "POST",
+      headers: {
+        "Content-Type": "application/json",
+      },
+      body: JSON.stringify(body),
+    });
+    const responseData = await response.json();
+    if (!response.ok) {
+      throw new Error(responseData.error?.message || `HTTP error! status: ${response.status}`);
+    }
+    return responseData;
+  }
+
   async function checkAuthStatus() {
     // Use shared auth module to check authentication
     const user = await window.authModule.checkAuthenticationStatus();
@@ -286,27 +466,31 @@ document.addEventListener("DOMContentLoaded", async () => {
 
   async function checkOIDCProviders() {
     try {
-      // Check if OIDC providers are configured by trying to access the endpoints
-      // We'll make this a simple check by seeing if the links would work
-
-      // For now, we'll check the config or make a simple request
-      // This is a placeholder - in a real implementation, you'd have an endpoint
-      // that returns the available OIDC providers
-
-      // Show OIDC section if we detect any providers are available
-      // This is a simplified check - you'd want to make this more robust
-      const googleBtn = oidcSection.querySelector(".google-btn");
-      const microsoftBtn = oidcSection.querySelector(".microsoft-btn");
-
-      // For demo purposes, let's show Google and Microsoft if they might be configured
-      // In a real implementation, you'd check the server configuration
-      const hasProviders = false; // Set to true when OIDC is properly configured
-
-      if (hasProviders) {
-        oidcSection.style.display = "block";
-        googleBtn.style.display = "flex";
-        microsoftBtn.style.display = "flex";
-      }
+      const response = await fetch("/api/auth/oidc/providers");
+      if (!response.ok) return;
+      const result = await response.json();
+      const providers = result.data || [];
+      if (providers.length === 0) return;
+
+      const buttons = oidcSection.querySelector(".oidc-buttons");
+      providers.forEach((provider) => {
+        // Google and Microsoft have branded buttons; other providers get a
+        // plain one
+        let button = ["google", "microsoft"].includes(provider.name)
+          ? buttons.querySelector(`.${provider.name}-btn`)
+          : null;
+        if (!button) {
+          button = document.createElement("a");
+          button.className = "oidc-btn";
+          button.textContent = `Continue with ${provider.display_name}`;
+          button.setAttribute("aria-label", `Sign in with ${provider.display_name}`);
+          buttons.appendChild(button);
+        }
+        button.href = provider.login_url;
+        button.style.display = "flex";
+      });
+
+      oidcSection.style.display = "block";
     } catch (error) {
       console.log("OIDC providers not available");
     }
@@ -356,6 +540,34 @@ document.addEventListener("DOMContentLoaded", async () => {
     showStatus(message, "info");
   }
 
+  // Invitation links open the registration form with the code filled in
+  const invitationCode = urlParams.get("invitation_code");
+  if (invitationCode) {
+    document.getElementById("invitationCode").value = invitationCode;
+    // Invitations emailed by a bulk import also suggest a username
+    for (const [param, field] of [["username", "registerUsername"], ["email", "registerEmail"]]) {
+      const value = urlParams.get(param);
+      if (value) {
+        document.getElementById(field).value = value;
+      }
+    }
+    showRegistrationForm();
+    showStatus("You've been invited! Choose a username and password to create your account.", "info");
+  }
+
+  // Links emailed to reset a password or verify an email address
+  const resetToken = urlParams.get("reset_token");
+  const verifyToken = urlParams.get("verify_token");
+  if (resetToken || verifyToken) {
+    // Keep tokens out of the history once used
+    window.history.replaceState(null, "", window.location.pathname);
+    if (resetToken) {
+      await handleResetPassword(resetToken);
+    } else {
+      await handleVerifyEmail(verifyToken);
+    }
+  }
+
   // Check if registration is allowed by trying to access the register endpoint info
   // This is a simple way to hide the registration link if it's disabled
   try {
@@ -38,7 +38,7 @@ document.addEventListener("DOMContentLoaded", () => {
 
     // Show admin link if user has permissions
     const adminLink = document.getElementById("adminLink");
-    if (adminLink && window.authModule.hasRole('moderator')) {
+    if (adminLink && (window.authModule.hasPermission('manage_print_requests') || window.authModule.moderatesGroup())) {
       adminLink.style.display = "block";
       adminLink.href = "/admin.html";
     }
@@ -133,30 +133,32 @@ document.addEventListener("DOMContentLoaded", () => {
     }
   }
 
-  // Update statistics cards
-  function updateStats() {
-    const stats = {
-      total: allRequests.length,
-      pending: allRequests.filter(
-        (r) => r.status === "StatusPendingApproval" || r.status === 0,
-      ).length,
-      inProgress: allRequests.filter(
-        (r) =>
-          r.status === "StatusEnqueued" ||
-          r.status === "StatusInProgress" ||
-          r.status === 1 ||
-          r.status === 2,
-      ).length,
-      completed: allRequests.filter(
-        (r) => r.status === "StatusDone" || r.status === 3,
-      ).length,
-    };
-
-    document.getElementById("totalRequests").textContent = stats.total;
-    document.getElementById("pendingRequests").textContent = stats.pending;
-    document.getElementById("inProgressRequests").textContent =
-      stats.inProgress;
-    document.getElementById("completedRequests").textContent = stats.completed;
+  // Update statistics cards from the counts the server keeps
+  async function updateStats() {
+    try {
+      const response = await fetch("/api/user/stats?months=1", {
+        method: "GET",
+        credentials: "same-origin",
+      });
+
+      if (!response.ok) {
+        throw new Error(`Failed to load statistics: ${response.status}`);
+      }
+
+      const responseData = await response.json();
+      const stats = responseData.data || responseData;
+      const counts = stats.counts || {};
+
+      document.getElementById("totalRequests").textContent = stats.total;
+      document.getElementById("pendingRequests").textContent =
+        counts.StatusPendingApproval || 0;
+      document.getElementById("inProgressRequests").textContent =
+        (counts.StatusEnqueued || 0) + (counts.StatusInProgress || 0);
+      document.getElementById("completedRequests").textContent =
+        counts.StatusDone || 0;
+    } catch (error) {
+      console.error("Failed to load statistics:", error.message || error);
+    }
   }
 
   // Render print requests table
@@ -19,6 +19,11 @@ window.authModule = (function() {
                 const responseData = await response.json();
                 // Extract the user data from the API response
                 currentUser = responseData.data || responseData;
+                // Users given a temporary password by an admin must choose
+                // their own before doing anything else
+                if (currentUser.password_change_required) {
+                    showChangePasswordModal();
+                }
                 return currentUser;
             } else {
                 currentUser = null;
@@ -62,6 +67,18 @@ window.authModule = (function() {
         return userLevel >= requiredLevel;
     }
 
+    // Check if the user's role grants a permission
+    function hasPermission(permission) {
+        if (!currentUser || !currentUser.permissions) return false;
+        return currentUser.permissions.includes(permission);
+    }
+
+    // Check if the user moderates at least one group
+    function moderatesGroup() {
+        if (!currentUser || !currentUser.groups) return false;
+        return currentUser.groups.some(group => group.role === 'moderator');
+    }
+
     // Handle logout
     async function handleLogout() {
         try {
@@ -283,13 +300,13 @@ window.authModule = (function() {
             // Show/hide admin links based on role
             const adminLinks = document.querySelectorAll('.admin-only');
             adminLinks.forEach(link => {
-                link.style.display = hasRole('moderator') ? 'block' : 'none';
+                link.style.display = hasPermission('view_users') ? 'block' : 'none';
             });
             
             // Update admin link visibility
             const adminLink = document.getElementById("adminLink");
             if (adminLink) {
-                adminLink.style.display = hasRole('moderator') ? 'block' : 'none';
+                adminLink.style.display = hasPermission('manage_print_requests') || moderatesGroup() ? 'block' : 'none';
                 adminLink.href = "/admin.html";
             }
         } else {
@@ -416,6 +433,8 @@ window.authModule = (function() {
         setCurrentUser,
         clearCurrentUser,
         hasRole,
+        hasPermission,
+        moderatesGroup,
         handleLogout,
         showChangePasswordModal,
         hideChangePasswordModal,